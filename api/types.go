@@ -0,0 +1,627 @@
+// Package api defines the JSON request and response types of the vulnscan
+// HTTP API. It has no server dependencies so it can be shared by clients.
+package api
+
+import (
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// ScanRequest defines the expected request structure for /scan endpoint
+type ScanRequest struct {
+	Repo  string   `json:"repo"`            // GitHub repository URL
+	Files []string `json:"files"`           // List of JSON files to process
+	Ref   string   `json:"ref,omitempty"`   // Branch, tag, or commit to fetch files from; the repository's default branch when empty
+	Image string   `json:"image,omitempty"` // Container image reference to scan, e.g. alpine:3.18
+	Force bool     `json:"force,omitempty"` // Ingest files even when unchanged since their last scan
+	// Expected SHA-256 hex digests keyed by file path; a fetched file that
+	// doesn't match fails instead of being ingested
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Labels attached to every stored scan, e.g. {"team": "payments"}
+	Labels map[string]string `json:"labels,omitempty"`
+	// PathPrefix is a directory, e.g. "security/reports", that files and
+	// the keys of checksums are relative to. Results and stored scans use
+	// the full paths.
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Exclude are file patterns, e.g. "testdata" or "test/*", of files not
+	// to ingest, matched against the full paths once the files are known,
+	// including those a repository's registration selects. A pattern also
+	// excludes every file below a directory it matches.
+	Exclude []string `json:"exclude,omitempty"`
+	// ParseMode is "strict", where a malformed vulnerability entry fails its
+	// file, or "lenient", where it is skipped with a warning. Empty uses the
+	// server default.
+	ParseMode string `json:"parse_mode,omitempty"`
+	// Timeout bounds the whole scan and FileTimeout each file, as durations
+	// such as "5m"; empty uses the server defaults. Files still outstanding
+	// when either passes fail with category "timeout".
+	Timeout     string `json:"timeout,omitempty"`
+	FileTimeout string `json:"file_timeout,omitempty"`
+}
+
+// FileError tracks processing failures for individual files
+type FileError struct {
+	File     string `json:"file"`     // Failed file path
+	Error    string `json:"error"`    // Error description
+	Category string `json:"category"` // Failed step: fetch, checksum, image, parse, correlation, db, incomplete, or timeout
+	// RetryAfterSeconds is how long to wait before retrying a file that
+	// failed because an upstream service throttled requests or the
+	// database was busy; absent for failures a retry won't fix
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+}
+
+// FileSkip records a file that was not ingested, and why
+type FileSkip struct {
+	File   string `json:"file"`   // Skipped file path
+	Reason string `json:"reason"` // Why it was skipped
+}
+
+// FileWarning records a vulnerability entry skipped by lenient parsing, or
+// a file stored although its scanner reported an incomplete run
+type FileWarning struct {
+	File   string `json:"file"`   // File the entry was in
+	Index  int    `json:"index"`  // Position among the file's vulnerability entries, from 0; -1 for the whole file
+	Reason string `json:"reason"` // Why it was skipped, or what the scanner reported
+}
+
+// ScanResponse defines the response structure for /scan endpoint
+type ScanResponse struct {
+	Status   string        `json:"status"`             // Outcome: completed, partial, or failed
+	Success  []string      `json:"success"`            // List of successfully processed files
+	Failed   []FileError   `json:"failed"`             // List of files that failed processing
+	Skipped  []FileSkip    `json:"skipped,omitempty"`  // Files unchanged since their last scan or excluded
+	Warnings []FileWarning `json:"warnings,omitempty"` // Malformed entries skipped by lenient parsing, and incomplete runs
+}
+
+// QueryRequest defines the expected request structure for /query endpoint
+type QueryRequest struct {
+	Filters    QueryFilters `json:"filters"`
+	Columns    []string     `json:"columns,omitempty"`     // Columns of CSV and Excel exports, in order
+	CountOnly  bool         `json:"count_only,omitempty"`  // Return only the number of results, as a QueryCount
+	ExistsOnly bool         `json:"exists_only,omitempty"` // Return only whether there are results, as a QueryExists
+	Limit      int          `json:"limit,omitempty"`       // Results returned at most; defaults to QUERY_MAX_ROWS (10000)
+	Cursor     string       `json:"cursor,omitempty"`      // next_cursor of the previous page
+}
+
+// QueryPage is the JSON response of a query that sets a limit or a cursor,
+// or whose results were cut at QUERY_MAX_ROWS
+type QueryPage struct {
+	Results    []models.Vulnerability `json:"results"`               // Results of this page
+	Truncated  bool                   `json:"truncated"`             // Whether more results follow
+	NextCursor string                 `json:"next_cursor,omitempty"` // Cursor of the next page, when truncated
+}
+
+// QueryCount is the response of a count-only query
+type QueryCount struct {
+	Count int `json:"count"` // Number of results the query would return
+}
+
+// QueryExists is the response of an exists-only query
+type QueryExists struct {
+	Exists bool `json:"exists"` // Whether the query would return any results
+}
+
+// SavedQuery is a named set of query filters stored for reuse
+type SavedQuery struct {
+	Name        string       `json:"name"`                  // Unique name, used in /queries/{name}
+	Description string       `json:"description,omitempty"` // What the query is for
+	Filters     QueryFilters `json:"filters"`               // Filters applied when the query is run
+	Columns     []string     `json:"columns,omitempty"`     // Columns of CSV and Excel exports, in order
+	CreatedAt   time.Time    `json:"created_at"`            // Time the query was first saved
+	UpdatedAt   time.Time    `json:"updated_at"`            // Time of the last change
+}
+
+// QueryFilters restricts which vulnerabilities a query returns
+type QueryFilters struct {
+	Severity     string   `json:"severity"`                // Severity filter value
+	ID           string   `json:"id,omitempty"`            // CVE or GHSA identifier, matched against known aliases
+	PURL         string   `json:"purl,omitempty"`          // Package URL; compared after normalization
+	VEXStatus    string   `json:"vex_status,omitempty"`    // VEX status of the applicable statement, or "none"
+	TriageStatus string   `json:"triage_status,omitempty"` // Triage status (open, acknowledged, false_positive, wont_fix, resolved)
+	Assignee     string   `json:"assignee,omitempty"`      // Assigned user
+	EPSSMin      *float64 `json:"epss_min,omitempty"`      // Minimum EPSS exploit probability (0-1)
+	License      string   `json:"license,omitempty"`       // License pattern of license violations, e.g. AGPL-* or *
+	PackageClass string   `json:"package_class,omitempty"` // os for operating system packages, application for application dependencies
+	Ecosystem    string   `json:"ecosystem,omitempty"`     // Package ecosystem, e.g. npm or Alpine (case-insensitive)
+	ResourceType string   `json:"resource_type,omitempty"` // Resource type of the scan that reported it, e.g. container_image
+	// SeveritySource is the severity opinion the severity filter matches:
+	// "effective" (the default), "reported", "nvd", or "override"
+	SeveritySource string `json:"severity_source,omitempty"`
+	// Labels the vulnerability's scan must all carry
+	Labels map[string]string `json:"labels,omitempty"`
+	// CustomFields are values of custom fields the vulnerability, or its
+	// scan, must all have
+	CustomFields map[string]string `json:"custom_fields,omitempty"`
+	// Expr is a boolean filter expression the vulnerability must match
+	// besides the other filters, e.g.
+	// severity in (critical, high) AND package_name ~ "openssl*"
+	Expr string `json:"expr,omitempty"`
+	// Dedup merges occurrences of a vulnerability in a repository that
+	// share a key: "cve+purl", "cve+package", or "off". Empty uses the
+	// server default.
+	Dedup string `json:"dedup,omitempty"`
+	// Sort orders the results by these keys, each ascending or, prefixed
+	// with "-", descending: severity, cvss, epss, cve_id, package,
+	// published_date, or finding_id. Ties fall back to the default order,
+	// -severity, -cvss, cve_id.
+	Sort []string `json:"sort,omitempty"`
+	// IncludeRaw adds each result's report fields that no other field
+	// holds, as raw
+	IncludeRaw bool `json:"include_raw,omitempty"`
+}
+
+// RepoScore is the composite risk score of a repository's open findings
+type RepoScore struct {
+	Repo       string         `json:"repo"`           // Repository URL
+	Team       string         `json:"team,omitempty"` // Owning team, if registered
+	Tier       int            `json:"tier,omitempty"` // Criticality tier, if registered
+	Score      float64        `json:"score"`          // Risk score (0-100)
+	Points     float64        `json:"points"`         // Summed weighted finding points behind the score
+	Findings   int            `json:"findings"`       // Open findings in the latest scans
+	BySeverity map[string]int `json:"by_severity"`    // Open findings keyed by severity
+	KEV        int            `json:"kev"`            // Open findings listed in the CISA KEV catalog
+	MaxEPSS    float64        `json:"max_epss"`       // Highest EPSS probability among open findings
+	OldestDays int            `json:"oldest_days"`    // Age in days of the oldest open finding
+}
+
+// TrendResponse defines the response structure for /trends endpoint
+type TrendResponse struct {
+	Repo   string       `json:"repo,omitempty"` // Repository URL, empty for all repositories
+	Days   int          `json:"days"`           // Requested window in days
+	Points []TrendPoint `json:"points"`         // One point per day, oldest first
+}
+
+// TrendPoint is the number of findings in the latest scan of each file as of
+// the end of one day
+type TrendPoint struct {
+	Date       time.Time      `json:"date"`        // Day (UTC midnight)
+	Total      int            `json:"total"`       // Findings across all severities
+	BySeverity map[string]int `json:"by_severity"` // Findings keyed by severity (CRITICAL, HIGH, MEDIUM, LOW, UNKNOWN)
+}
+
+// Finding is a unique vulnerability in a repository's package, tracked
+// across scans
+type Finding struct {
+	ID          int64      `db:"id" json:"id"`                             // Row identifier
+	Repo        string     `db:"repo" json:"repo"`                         // Repository URL
+	PackageName string     `db:"package_name" json:"package_name"`         // Affected package
+	CVEID       string     `db:"cve_id" json:"cve_id"`                     // Vulnerability identifier
+	Severity    string     `db:"severity" json:"severity"`                 // Severity reported by the latest sighting
+	Status      string     `db:"status" json:"status"`                     // Lifecycle status: open or resolved
+	FirstSeen   time.Time  `db:"first_seen" json:"first_seen"`             // Time of the first scan reporting it
+	LastSeen    time.Time  `db:"last_seen" json:"last_seen"`               // Time of the latest scan reporting it
+	LastScanID  int64      `db:"last_scan_id" json:"last_scan_id"`         // Row ID of the latest scan reporting it
+	ResolvedAt  *time.Time `db:"resolved_at" json:"resolved_at,omitempty"` // Time a rescan stopped reporting it, while resolved
+}
+
+// ScanSummary is one ingested scan file in the scan history
+type ScanSummary struct {
+	models.Scan
+	Findings   int            `json:"findings"`    // Vulnerabilities stored for the scan
+	BySeverity map[string]int `json:"by_severity"` // Vulnerability counts keyed by severity
+}
+
+// FileIngest is one ingest of a repository file in its history, compared
+// with the ingest before it
+type FileIngest struct {
+	ScanTime   time.Time      `json:"scan_time"`   // Time the file was ingested
+	ScanIDs    []int64        `json:"scan_ids"`    // Stored scans of the ingest, one per scan the file held
+	SHA256     string         `json:"sha256"`      // Hex SHA-256 of the ingested content
+	Findings   int            `json:"findings"`    // Vulnerabilities stored for the ingest
+	BySeverity map[string]int `json:"by_severity"` // Vulnerability counts keyed by severity
+	Delta      map[string]int `json:"delta"`       // Change of each severity's count since the previous ingest
+	New        int            `json:"new"`         // Vulnerabilities the previous ingest did not report
+	Fixed      int            `json:"fixed"`       // Vulnerabilities of the previous ingest no longer reported
+}
+
+// StatsResponse defines the response structure for /stats endpoint
+type StatsResponse struct {
+	Scans           int            `json:"scans"`           // Number of ingested scans
+	Repos           int            `json:"repos"`           // Number of distinct repositories
+	Vulnerabilities int            `json:"vulnerabilities"` // Number of stored vulnerabilities
+	BySeverity      map[string]int `json:"by_severity"`     // Vulnerability counts keyed by severity
+
+	SLA   map[string]SLACompliance `json:"sla"`   // SLA adherence of open findings keyed by severity
+	Aging map[string]AgingBuckets  `json:"aging"` // Ages of open findings keyed by severity
+	// Counts keyed by the value of the group_by label; scans without it
+	// are counted under ""
+	ByLabel map[string]LabelStats `json:"by_label,omitempty"`
+}
+
+// LabelStats are the counts of scans sharing a label value
+type LabelStats struct {
+	Scans           int            `json:"scans"`           // Number of ingested scans
+	Repos           int            `json:"repos"`           // Number of distinct repositories
+	Vulnerabilities int            `json:"vulnerabilities"` // Number of stored vulnerabilities
+	BySeverity      map[string]int `json:"by_severity"`     // Vulnerability counts keyed by severity
+}
+
+// SLACompliance summarizes SLA adherence of the open findings of one severity
+type SLACompliance struct {
+	Days       int     `json:"sla_days"`   // Remediation window in days
+	Open       int     `json:"open"`       // Open or acknowledged findings
+	Overdue    int     `json:"overdue"`    // Open findings past their due date
+	Compliance float64 `json:"compliance"` // Share of open findings within SLA (0-1)
+}
+
+// TopOffender is a package, vulnerability, or repository ranked by the open
+// findings it contributes
+type TopOffender struct {
+	Name       string         `json:"name"`            // Package name, vulnerability ID, or repository URL
+	Score      float64        `json:"score"`           // Open findings weighted by severity
+	Findings   int            `json:"findings"`        // Open findings
+	BySeverity map[string]int `json:"by_severity"`     // Open findings keyed by severity
+	Repos      int            `json:"repos,omitempty"` // Repositories with the package or vulnerability
+}
+
+// AgingBuckets counts the open findings of one severity by how long ago
+// they were first seen
+type AgingBuckets struct {
+	Under30Days int `json:"under_30d"` // First seen less than 30 days ago
+	Days30To90  int `json:"30_90d"`    // First seen 30 to 90 days ago
+	Over90Days  int `json:"over_90d"`  // First seen more than 90 days ago
+}
+
+// OverdueFinding is an open finding past its remediation due date
+type OverdueFinding struct {
+	models.Vulnerability
+	Repo        string    `json:"repo"`         // Repository the finding belongs to
+	FilePath    string    `json:"file_path"`    // Scan file the finding was ingested from
+	FirstSeen   time.Time `json:"first_seen"`   // Earliest scan of the repository reporting the finding
+	DueDate     time.Time `json:"due_date"`     // First seen plus the severity's SLA
+	DaysOverdue int       `json:"days_overdue"` // Whole days past the due date
+}
+
+// Package identifies a package version to look up in OSV
+type Package struct {
+	Name      string `json:"name"`           // Package name
+	Ecosystem string `json:"ecosystem"`      // OSV ecosystem, e.g. npm, PyPI, Go
+	Version   string `json:"version"`        // Installed version
+	PURL      string `json:"purl,omitempty"` // Package URL, used instead of name/ecosystem when set
+}
+
+// PackageScanRequest defines the expected request structure for /packages/scan endpoint
+type PackageScanRequest struct {
+	Repo     string    `json:"repo"`     // Repository the packages belong to
+	Packages []Package `json:"packages"` // Package versions to look up
+}
+
+// PackageScanResponse defines the response structure for /packages/scan endpoint
+type PackageScanResponse struct {
+	ScanID   int64 `json:"scan_id"`  // Stored scan row ID
+	Packages int   `json:"packages"` // Number of packages looked up
+	Findings int   `json:"findings"` // Number of vulnerabilities stored
+}
+
+// FixReport defines the response structure for /reports/fixes endpoint
+type FixReport struct {
+	Packages []PackageFix `json:"packages"` // Packages with available fixes, most urgent first
+	Findings int          `json:"findings"` // Total fixable findings across all packages
+}
+
+// PackageFix is the remediation suggestion for one package
+type PackageFix struct {
+	PackageName       string         `json:"package_name"`        // Affected package
+	Ecosystem         string         `json:"ecosystem,omitempty"` // Package ecosystem
+	InstalledVersions []string       `json:"installed_versions"`  // Distinct installed versions, ascending
+	UpgradeTo         string         `json:"upgrade_to"`          // Minimal version that fixes every finding
+	Findings          int            `json:"findings"`            // Number of fixable findings
+	MaxCVSS           float64        `json:"max_cvss"`            // Highest CVSS score among the findings
+	BySeverity        map[string]int `json:"by_severity"`         // Finding counts keyed by severity
+	CVEs              []string       `json:"cves"`                // Distinct vulnerability identifiers
+	Repos             []string       `json:"repos"`               // Repositories using the package
+}
+
+// VEXImportResponse defines the response structure for POST /vex
+type VEXImportResponse struct {
+	Statements int `json:"statements"` // Number of stored statements (one per vulnerability and package)
+}
+
+// CSVImportResponse defines the response structure for POST /import/csv
+type CSVImportResponse struct {
+	Findings int `json:"findings"` // Number of imported rows
+	Repos    int `json:"repos"`    // Number of repositories they were seen in
+	Scans    int `json:"scans"`    // Number of stored scans, one per repository and last sighting
+	Resolved int `json:"resolved"` // Number of findings resolved because the import's latest scan left them out
+}
+
+// TriageUpdate defines the request structure for PATCH /vulnerabilities/{id}/triage.
+// Omitted fields are left unchanged.
+type TriageUpdate struct {
+	Status   *string `json:"status,omitempty"`   // New triage status
+	Assignee *string `json:"assignee,omitempty"` // New assignee ("" to unassign)
+	Comment  string  `json:"comment,omitempty"`  // Optional comment recorded with the change
+}
+
+// CommentRequest defines the request structure for POST /vulnerabilities/{id}/comments
+type CommentRequest struct {
+	Body string `json:"body"` // Comment text
+}
+
+// BulkTriageRequest defines the request structure for POST
+// /vulnerabilities/bulk-update. Without Confirm the update is only
+// previewed.
+type BulkTriageRequest struct {
+	Filters QueryFilters `json:"filters"`           // Findings to update, as for /query
+	Patch   TriageUpdate `json:"patch"`             // Update applied to every matched finding
+	Confirm *int         `json:"confirm,omitempty"` // Matched count from the preview; applies the update
+}
+
+// BulkTriageResponse defines the response structure for POST /vulnerabilities/bulk-update
+type BulkTriageResponse struct {
+	Applied   bool    `json:"applied"`   // Whether the update was stored
+	Matched   int     `json:"matched"`   // Findings matching the filters
+	Updated   int     `json:"updated"`   // Findings the patch changes
+	Unchanged int     `json:"unchanged"` // Findings already in the patched state
+	Skipped   []int64 `json:"skipped"`   // Findings whose status cannot change to the patched one
+}
+
+// TriageResponse describes the triage state of a vulnerability
+type TriageResponse struct {
+	FindingID int64                `json:"finding_id"` // Vulnerability row identifier
+	Status    string               `json:"status"`     // Current triage status
+	Assignee  string               `json:"assignee"`   // Current assignee
+	Comments  []models.Comment     `json:"comments"`   // Comments, oldest first
+	History   []models.TriageEvent `json:"history"`    // Audit trail, oldest first
+}
+
+// VulnerabilityDetail defines the response structure for GET
+// /vulnerabilities/{id}: one stored vulnerability with the history of the
+// finding it belongs to, the same vulnerability in the same repository and
+// package
+type VulnerabilityDetail struct {
+	Vulnerability models.Vulnerability `json:"vulnerability"`     // The stored vulnerability, as /query returns it
+	Repo          string               `json:"repo"`              // Repository of the scan that reported it
+	Finding       *Finding             `json:"finding,omitempty"` // Lifecycle of the finding, when tracked
+	Occurrences   []Occurrence         `json:"occurrences"`       // Stored reports of the finding, oldest first
+	Timeline      []PresenceChange     `json:"timeline"`          // Scans where the finding appeared in or disappeared from a file, oldest first
+	Triage        TriageResponse       `json:"triage"`            // Triage state, comments, and audit trail
+}
+
+// Occurrence is one scan's report of a finding
+type Occurrence struct {
+	FindingID      int64     `db:"finding_id" json:"finding_id"`           // Vulnerability row identifier
+	ScanID         int64     `db:"scan_id" json:"scan_id"`                 // Row ID of the scan
+	FilePath       string    `db:"file_path" json:"file_path"`             // Scan file the report came from
+	Source         string    `db:"source" json:"source,omitempty"`         // Format of the scan file
+	ScanTime       time.Time `db:"scan_time" json:"scan_time"`             // Time the file was ingested
+	Severity       string    `db:"severity" json:"severity"`               // Severity the scan reported
+	CurrentVersion string    `db:"current_version" json:"current_version"` // Package version the scan reported
+}
+
+// Presence changes of a PresenceChange
+const (
+	PresenceAppeared    = "appeared"    // The file's scan reported the finding, and its previous scan didn't
+	PresenceDisappeared = "disappeared" // The file's scan no longer reported the finding
+)
+
+// PresenceChange is a scan of a file that started or stopped reporting a
+// finding
+type PresenceChange struct {
+	FilePath string    `json:"file_path"` // Scan file
+	ScanTime time.Time `json:"scan_time"` // Time the file was ingested
+	Change   string    `json:"change"`    // appeared or disappeared
+}
+
+// Badge is the shields.io endpoint badge schema, returned by GET
+// /badge/{repo} with format=json
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"` // Always 1
+	Label         string `json:"label"`         // Left-hand text
+	Message       string `json:"message"`       // Right-hand text, e.g. "2 critical, 5 high"
+	Color         string `json:"color"`         // Background of the message
+}
+
+// PolicyRule limits the number of open findings matching its conditions.
+// Conditions that are unset match every finding.
+type PolicyRule struct {
+	Name       string   `json:"name"`                 // Rule name reported in violations
+	Severities []string `json:"severities,omitempty"` // Severities to count (case-insensitive)
+	MinCVSS    float64  `json:"min_cvss,omitempty"`   // Minimum CVSS score to count
+	EPSSMin    float64  `json:"epss_min,omitempty"`   // Minimum EPSS exploit probability to count
+	KEV        bool     `json:"kev,omitempty"`        // Count only CVEs in the CISA KEV catalog
+	Fixable    bool     `json:"fixable,omitempty"`    // Count only findings with a fixed version
+	Licenses   []string `json:"licenses,omitempty"`   // Count only license violations of these license patterns
+	Max        int      `json:"max"`                  // Maximum matching findings allowed
+}
+
+// Policy is a named set of rules; a repository passes when no rule is violated
+type Policy struct {
+	Name  string       `json:"name"`  // Policy name
+	Rules []PolicyRule `json:"rules"` // Rules, all of which must pass
+}
+
+// PolicyEvaluateRequest defines the request structure for POST /policy/evaluate
+type PolicyEvaluateRequest struct {
+	Repo   string       `json:"repo"`             // Repository whose latest scans are evaluated
+	Files  []string     `json:"files,omitempty"`  // Scan files to evaluate; empty means all
+	Policy string       `json:"policy,omitempty"` // Configured policy name (default "default")
+	Rules  []PolicyRule `json:"rules,omitempty"`  // Inline rules, used instead of a configured policy
+}
+
+// PolicyResult defines the response structure for POST /policy/evaluate
+type PolicyResult struct {
+	Policy     string            `json:"policy"`     // Evaluated policy name
+	Passed     bool              `json:"passed"`     // Whether every rule passed
+	Findings   int               `json:"findings"`   // Open findings evaluated
+	Violations []PolicyViolation `json:"violations"` // Rules that failed
+}
+
+// PolicyViolation describes a failed rule and the findings that broke it
+type PolicyViolation struct {
+	Rule     string                 `json:"rule"`     // Rule name
+	Count    int                    `json:"count"`    // Matching findings
+	Max      int                    `json:"max"`      // Maximum allowed
+	Findings []models.Vulnerability `json:"findings"` // Matching findings
+}
+
+// BlastRadius defines the response structure for /blast-radius endpoint
+type BlastRadius struct {
+	ID       string             `json:"id"`       // Queried CVE or GHSA identifier
+	Affected []BlastRadiusScope `json:"affected"` // Latest scans reporting the vulnerability
+}
+
+// BlastRadiusScope is one vulnerable package in the latest scan of a
+// repository file and the top-level dependencies that pull it in
+type BlastRadiusScope struct {
+	Repo     string               `db:"repo" json:"repo"`                 // Repository URL
+	FilePath string               `db:"file_path" json:"file_path"`       // Scan file path
+	ScanID   int64                `db:"scan_id" json:"scan_id"`           // Stored scan row ID
+	Package  string               `db:"package_name" json:"package_name"` // Vulnerable package
+	Version  string               `db:"version" json:"version"`           // Vulnerable package version
+	Graph    bool                 `db:"-" json:"graph"`                   // Whether the scan recorded dependency relationships
+	TopLevel []TopLevelDependency `db:"-" json:"top_level"`               // Top-level dependencies that transitively depend on the package
+}
+
+// TopLevelDependency is a direct dependency of a scanned project and the
+// shortest chain through which it depends on a vulnerable package
+type TopLevelDependency struct {
+	Name    string   `json:"name"`           // Package name
+	Version string   `json:"version"`        // Package version
+	PURL    string   `json:"purl,omitempty"` // Package URL
+	Path    []string `json:"path"`           // name@version chain from this dependency down to the vulnerable package
+}
+
+// ArchiveScanRequest defines the JSON request structure for POST
+// /scan/archive; archives can also be uploaded as multipart form data
+type ArchiveScanRequest struct {
+	Repo string `json:"repo"` // Repository the reports belong to
+	URL  string `json:"url"`  // Location of a .tar.gz, .tar, or .zip archive of reports
+	// Labels attached to every stored scan
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BulkScanRequest defines the request structure for POST /scan/bulk
+type BulkScanRequest struct {
+	Entries     []BulkScanEntry `json:"entries"`               // Repositories to scan
+	Concurrency int             `json:"concurrency,omitempty"` // Repositories scanned at a time; defaults to BULK_SCAN_CONCURRENCY (4)
+	Force       bool            `json:"force,omitempty"`       // Ingest files even when unchanged since their last scan
+	// Labels attached to every stored scan of the job
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BulkScanEntry selects the files of one repository to scan
+type BulkScanEntry struct {
+	Repo       string   `json:"repo"`                  // GitHub repository URL
+	Ref        string   `json:"ref,omitempty"`         // Branch, tag, or commit; the repository's default branch when empty
+	PathPrefix string   `json:"path_prefix,omitempty"` // Directory the files are relative to
+	Files      []string `json:"files,omitempty"`       // File paths to process
+	Patterns   []string `json:"patterns,omitempty"`    // File patterns, e.g. "reports/*.json" or "*.sarif"
+	Exclude    []string `json:"exclude,omitempty"`     // Patterns of files not to ingest, as in ScanRequest
+}
+
+// OrgScanRequest defines the request structure for POST /scan/org
+type OrgScanRequest struct {
+	Org         string   `json:"org"`                   // GitHub organization
+	Patterns    []string `json:"patterns,omitempty"`    // File patterns; defaults to ORG_SCAN_PATTERNS
+	Include     []string `json:"include,omitempty"`     // Repository name patterns to scan; all when empty
+	Exclude     []string `json:"exclude,omitempty"`     // Repository name patterns to skip
+	Archived    bool     `json:"archived,omitempty"`    // Also scan archived repositories
+	Forks       bool     `json:"forks,omitempty"`       // Also scan forks
+	Concurrency int      `json:"concurrency,omitempty"` // Repositories scanned at a time; defaults to BULK_SCAN_CONCURRENCY (4)
+	Force       bool     `json:"force,omitempty"`       // Ingest files even when unchanged since their last scan
+	// ExcludeFiles are patterns of files not to ingest, as ScanRequest's
+	// Exclude
+	ExcludeFiles []string `json:"exclude_files,omitempty"`
+	// Labels attached to every stored scan of the job
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BulkScanJob is the progress of a bulk scan
+type BulkScanJob struct {
+	ID             string           `json:"id"`                    // Job identifier
+	Status         string           `json:"status"`                // running or completed
+	CreatedAt      time.Time        `json:"created_at"`            // Time the job was submitted
+	FinishedAt     *time.Time       `json:"finished_at,omitempty"` // Time the last repository finished
+	Repos          int              `json:"repos"`                 // Repositories in the job
+	ReposDone      int              `json:"repos_done"`            // Repositories finished
+	FilesSucceeded int              `json:"files_succeeded"`       // Files ingested so far
+	FilesFailed    int              `json:"files_failed"`          // Files that failed so far
+	FilesSkipped   int              `json:"files_skipped"`         // Files unchanged since their last scan
+	Results        []BulkScanResult `json:"results"`               // Per-repository outcomes, in request order
+}
+
+// BulkScanResult is the outcome of one repository of a bulk scan
+type BulkScanResult struct {
+	Repo    string      `json:"repo"`            // Repository URL
+	Status  string      `json:"status"`          // pending, running, completed, partial, or failed
+	Error   string      `json:"error,omitempty"` // Why the repository could not be scanned at all
+	Success []string    `json:"success"`         // Successfully processed files
+	Failed  []FileError `json:"failed"`          // Files that failed, with reasons
+	Skipped []FileSkip  `json:"skipped"`         // Files unchanged since their last scan
+	// Malformed entries skipped by lenient parsing, and incomplete runs
+	Warnings []FileWarning `json:"warnings,omitempty"`
+}
+
+// ReprocessRequest defines the request structure for POST /admin/reprocess.
+// At least one selector, or All, is required.
+type ReprocessRequest struct {
+	Repo    string     `json:"repo,omitempty"`     // Reprocess this repository's ingests
+	ScanIDs []int64    `json:"scan_ids,omitempty"` // Reprocess the ingests that stored these scans
+	Since   *time.Time `json:"since,omitempty"`    // Reprocess ingests at or after this time
+	All     bool       `json:"all,omitempty"`      // Reprocess every ingest
+	DryRun  bool       `json:"dry_run,omitempty"`  // Report the changes without storing them
+}
+
+// ReprocessResponse defines the response structure for POST /admin/reprocess
+type ReprocessResponse struct {
+	DryRun      bool              `json:"dry_run,omitempty"`
+	Reprocessed int               `json:"reprocessed"` // Ingests parsed again and stored
+	Skipped     int               `json:"skipped"`     // Ingests without stored content
+	Failed      int               `json:"failed"`      // Ingests that could not be reprocessed
+	Added       int               `json:"added"`       // Vulnerabilities the parser now reports
+	Updated     int               `json:"updated"`     // Vulnerabilities stored again in place
+	Removed     int               `json:"removed"`     // Vulnerabilities the parser no longer reports
+	Results     []ReprocessResult `json:"results"`     // Per-ingest outcomes, oldest first
+}
+
+// ReprocessResult is the outcome of reprocessing one ingested file
+type ReprocessResult struct {
+	Repo     string    `json:"repo"`
+	File     string    `json:"file"`
+	ScanTime time.Time `json:"scan_time"`         // Time of the original ingest
+	ScanIDs  []int64   `json:"scan_ids"`          // Scans stored by the ingest
+	Status   string    `json:"status"`            // reprocessed, skipped, or failed
+	Reason   string    `json:"reason,omitempty"`  // Why it was skipped or failed
+	Format   string    `json:"format,omitempty"`  // Detected report format
+	Added    int       `json:"added,omitempty"`   // Vulnerabilities the parser now reports
+	Updated  int       `json:"updated,omitempty"` // Vulnerabilities stored again in place
+	Removed  int       `json:"removed,omitempty"` // Vulnerabilities the parser no longer reports
+}
+
+// MaintenanceRequest defines the request structure for POST
+// /admin/maintenance, whose body is optional
+type MaintenanceRequest struct {
+	FullVacuum bool `json:"full_vacuum,omitempty"` // Rebuild the database file, switching it to incremental vacuum
+}
+
+// DeleteRequest defines the request structure for POST /admin/delete.
+// Without Confirm the deletion is only previewed.
+type DeleteRequest struct {
+	Target  string       `json:"target"`            // What to delete: scans or vulnerabilities
+	Filter  DeleteFilter `json:"filter"`            // What to select; at least one of repo and older_than is required
+	Confirm string       `json:"confirm,omitempty"` // Confirmation token of the preview; applies the deletion
+}
+
+// DeleteFilter selects the scans or vulnerabilities POST /admin/delete
+// removes. Every filter that is set must match.
+type DeleteFilter struct {
+	Repo      string `json:"repo,omitempty"`       // Repository URL, as stored
+	OlderThan string `json:"older_than,omitempty"` // Minimum age of the scan, e.g. 90d or 720h
+	Severity  string `json:"severity,omitempty"`   // Severity after overrides; vulnerabilities only
+}
+
+// DeleteResponse defines the response structure for POST /admin/delete
+type DeleteResponse struct {
+	Applied           bool   `json:"applied"`                      // Whether the matches were deleted
+	Scans             int    `json:"scans"`                        // Scans matched
+	Vulnerabilities   int    `json:"vulnerabilities"`              // Vulnerabilities matched, including those of matched scans
+	ConfirmationToken string `json:"confirmation_token,omitempty"` // Token to send as confirm to apply this preview
+}
+
+// ReloadResponse defines the response structure for POST /admin/reload
+type ReloadResponse struct {
+	Applied         []string `json:"applied"`          // Changed settings now in effect
+	RestartRequired []string `json:"restart_required"` // Changed settings that take effect after a restart
+}
@@ -0,0 +1,146 @@
+// Package archive extracts scan reports from .tar.gz, .tar, and .zip
+// archives in memory, as CI systems bundle build artifacts. Entry count and
+// sizes are bounded so a hostile archive can't exhaust memory.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Limits bound what an archive may contain
+type Limits struct {
+	MaxEntries   int   // Files extracted at most
+	MaxEntrySize int64 // Uncompressed size of one file
+	MaxTotalSize int64 // Uncompressed size of all files together
+}
+
+// DefaultLimits are applied to uploaded and downloaded archives
+var DefaultLimits = Limits{
+	MaxEntries:   1000,
+	MaxEntrySize: 50 << 20,
+	MaxTotalSize: 200 << 20,
+}
+
+// ErrLimit is returned when an archive exceeds its limits
+var ErrLimit = errors.New("archive exceeds limits")
+
+// File is an extracted archive entry
+type File struct {
+	Name    string // Slash-separated path within the archive
+	Content []byte // Uncompressed contents
+}
+
+// Extract returns the regular files of a gzipped or plain tar or zip
+// archive, recognized by content. Directories, links, and hidden files such
+// as .DS_Store are skipped.
+func Extract(data []byte, limits Limits) ([]File, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return extractZip(data, limits)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("archive: gzip: %v", err)
+		}
+		defer gz.Close()
+		return extractTar(gz, limits)
+	case len(data) > 262 && string(data[257:262]) == "ustar":
+		return extractTar(bytes.NewReader(data), limits)
+	}
+	return nil, fmt.Errorf("archive: unrecognized format (want .tar.gz, .tar, or .zip)")
+}
+
+// extractTar reads the regular files of a tar stream
+func extractTar(r io.Reader, limits Limits) ([]File, error) {
+	var (
+		files []File
+		total int64
+		tr    = tar.NewReader(r)
+	)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: tar: %v", err)
+		}
+		name, ok := entryName(h.Name)
+		if h.Typeflag != tar.TypeReg || !ok {
+			continue
+		}
+		content, err := readEntry(tr, len(files), &total, limits)
+		if err != nil {
+			return nil, fmt.Errorf("archive: %s: %w", name, err)
+		}
+		files = append(files, File{Name: name, Content: content})
+	}
+}
+
+// extractZip reads the regular files of a zip archive
+func extractZip(data []byte, limits Limits) ([]File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("archive: zip: %v", err)
+	}
+	var (
+		files []File
+		total int64
+	)
+	for _, f := range zr.File {
+		name, ok := entryName(f.Name)
+		if !f.Mode().IsRegular() || !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("archive: %s: %v", name, err)
+		}
+		content, err := readEntry(rc, len(files), &total, limits)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("archive: %s: %w", name, err)
+		}
+		files = append(files, File{Name: name, Content: content})
+	}
+	return files, nil
+}
+
+// readEntry reads one file, enforcing the limits on the bytes actually
+// read rather than on the sizes headers declare
+func readEntry(r io.Reader, extracted int, total *int64, limits Limits) ([]byte, error) {
+	if extracted >= limits.MaxEntries {
+		return nil, fmt.Errorf("%w: more than %d files", ErrLimit, limits.MaxEntries)
+	}
+	limit := min(limits.MaxEntrySize, limits.MaxTotalSize-*total)
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		if limit == limits.MaxEntrySize {
+			return nil, fmt.Errorf("%w: file larger than %d bytes", ErrLimit, limits.MaxEntrySize)
+		}
+		return nil, fmt.Errorf("%w: files larger than %d bytes in total", ErrLimit, limits.MaxTotalSize)
+	}
+	*total += int64(len(content))
+	return content, nil
+}
+
+// entryName normalizes an entry path, reporting false for entries that are
+// not scan reports: hidden files and macOS resource forks
+func entryName(name string) (string, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "" || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return "", false
+	}
+	return name, true
+}
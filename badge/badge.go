@@ -0,0 +1,62 @@
+// Package badge renders status badges as flat SVG images in the style of
+// shields.io, for embedding in READMEs.
+package badge
+
+import (
+	"fmt"
+	"html"
+	"io"
+)
+
+// Colors of badge messages
+const (
+	Red         = "#e05d44"
+	Orange      = "#fe7d37"
+	Yellow      = "#dfb317"
+	YellowGreen = "#a4a61d"
+	BrightGreen = "#4c1"
+	Grey        = "#9f9f9f"
+)
+
+// labelColor is the background of the label half
+const labelColor = "#555"
+
+// padding is the horizontal space around each half's text, in pixels
+const padding = 10
+
+// Render writes a badge with the label on the left and the message on the
+// right, on a background of the color
+func Render(w io.Writer, label, message, color string) error {
+	lw, mw := textWidth(label)+padding, textWidth(message)+padding
+	label, message, color = html.EscapeString(label), html.EscapeString(message), html.EscapeString(color)
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">
+<title>%[3]s: %[4]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="%[6]s"/><rect x="%[2]d" width="%[7]d" height="20" fill="%[5]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[3]s</text><text x="%[8]d" y="14">%[3]s</text>
+<text x="%[9]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[9]d" y="14">%[4]s</text>
+</g>
+</svg>
+`, lw+mw, lw, label, message, color, labelColor, mw, lw/2, lw+mw/2)
+	return err
+}
+
+// textWidth estimates the width in pixels of text in 11px Verdana
+func textWidth(s string) int {
+	var w float64
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == 'i' || r == 'j' || r == 'l' || r == '.' || r == ',' || r == ':' || r == ';' || r == '|' || r == '!' || r == '\'':
+			w += 3.5
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			w += 10
+		case r >= 'A' && r <= 'Z':
+			w += 7.5
+		default:
+			w += 6.5
+		}
+	}
+	return int(w + 0.5)
+}
@@ -0,0 +1,342 @@
+// Package client is a Go SDK for the vulnscan HTTP API.
+//
+//	c := client.New("http://localhost:8080", client.WithToken(token))
+//	resp, err := c.Scan(ctx, api.ScanRequest{Repo: repo, Files: files})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Client calls a vulnscan server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying HTTP client (default has a 5 minute timeout)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken sends the token as a bearer Authorization header on every request
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithRetries sets how many times failed requests are retried and the base
+// backoff, which doubles after each attempt
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New creates a client for the server at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		maxRetries: 2,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// maxErrorBody bounds the response body kept in an APIError. It fits the
+// per-file failures of a failed scan.
+const maxErrorBody = 1 << 20
+
+// APIError is returned when the server responds with a non-200 status
+type APIError struct {
+	StatusCode int    // HTTP status code
+	Message    string // Response body
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("vulnscan: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Scan ingests scan report files from a repository. Because scans are not
+// idempotent, they are only retried when the server rejected the request
+// outright (429 or 503). A scan in which every file failed is returned with
+// status "failed" rather than as an error.
+func (c *Client) Scan(ctx context.Context, req api.ScanRequest) (*api.ScanResponse, error) {
+	var resp api.ScanResponse
+	err := c.do(ctx, http.MethodPost, "/scan", req, &resp, false)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && json.Unmarshal([]byte(apiErr.Message), &resp) == nil && resp.Status != "" {
+		// Every file failed; the body still reports why
+		return &resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BulkScan submits a multi-repository scan job; poll its progress with
+// BulkScanStatus
+func (c *Client) BulkScan(ctx context.Context, req api.BulkScanRequest) (*api.BulkScanJob, error) {
+	var job api.BulkScanJob
+	if err := c.do(ctx, http.MethodPost, "/scan/bulk", req, &job, false); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// OrgScan submits a scan of an organization's repositories as a bulk scan
+// job; poll its progress with BulkScanStatus
+func (c *Client) OrgScan(ctx context.Context, req api.OrgScanRequest) (*api.BulkScanJob, error) {
+	var job api.BulkScanJob
+	if err := c.do(ctx, http.MethodPost, "/scan/org", req, &job, false); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// BulkScanStatus returns the progress of a bulk scan job
+func (c *Client) BulkScanStatus(ctx context.Context, id string) (*api.BulkScanJob, error) {
+	var job api.BulkScanJob
+	if err := c.do(ctx, http.MethodGet, "/scan/bulk/"+url.PathEscape(id), nil, &job, true); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Query returns stored vulnerabilities matching the request filters, at
+// most the server's QUERY_MAX_ROWS of them unless the request sets a limit.
+// Use QueryPage to learn whether results were left out.
+func (c *Client) Query(ctx context.Context, req api.QueryRequest) ([]models.Vulnerability, error) {
+	if req.Limit > 0 || req.Cursor != "" {
+		page, err := c.QueryPage(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return page.Results, nil
+	}
+	// Results cut at QUERY_MAX_ROWS come as a page
+	var resp json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/query", req, &resp, true); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(resp), []byte("{")) {
+		var page api.QueryPage
+		err := json.Unmarshal(resp, &page)
+		return page.Results, err
+	}
+	var vulns []models.Vulnerability
+	err := json.Unmarshal(resp, &vulns)
+	return vulns, err
+}
+
+// QueryPage returns a page of stored vulnerabilities matching the request,
+// at most its limit, continuing from its cursor. Pass the page's
+// NextCursor as the next request's cursor until it is no longer truncated.
+func (c *Client) QueryPage(ctx context.Context, req api.QueryRequest) (*api.QueryPage, error) {
+	if req.Limit == 0 && req.Cursor == "" {
+		return nil, fmt.Errorf("limit or cursor is required")
+	}
+	var page api.QueryPage
+	if err := c.do(ctx, http.MethodPost, "/query", req, &page, true); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// QueryCount returns the number of stored vulnerabilities matching the
+// filters, without transferring them
+func (c *Client) QueryCount(ctx context.Context, filters api.QueryFilters) (int, error) {
+	var resp api.QueryCount
+	if err := c.do(ctx, http.MethodPost, "/query", api.QueryRequest{Filters: filters, CountOnly: true}, &resp, true); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// QueryExists reports whether any stored vulnerability matches the filters
+func (c *Client) QueryExists(ctx context.Context, filters api.QueryFilters) (bool, error) {
+	var resp api.QueryExists
+	if err := c.do(ctx, http.MethodPost, "/query", api.QueryRequest{Filters: filters, ExistsOnly: true}, &resp, true); err != nil {
+		return false, err
+	}
+	return resp.Exists, nil
+}
+
+// Stats returns aggregate counts, optionally restricted to one repository
+func (c *Client) Stats(ctx context.Context, repo string) (*api.StatsResponse, error) {
+	path := "/stats"
+	if repo != "" {
+		path += "?repo=" + url.QueryEscape(repo)
+	}
+
+	var stats api.StatsResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, &stats, true); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// RegisterRepository registers a repository, or replaces its registration
+func (c *Client) RegisterRepository(ctx context.Context, repo models.Repository) (*models.Repository, error) {
+	var registered models.Repository
+	if err := c.do(ctx, http.MethodPost, "/repos", repo, &registered, true); err != nil {
+		return nil, err
+	}
+	return &registered, nil
+}
+
+// Repositories lists registered repositories, optionally only one team's
+func (c *Client) Repositories(ctx context.Context, team string) ([]models.Repository, error) {
+	path := "/repos"
+	if team != "" {
+		path += "?team=" + url.QueryEscape(team)
+	}
+
+	var repos []models.Repository
+	if err := c.do(ctx, http.MethodGet, path, nil, &repos, true); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// SaveQuery saves a named query, or replaces the one of the same name
+func (c *Client) SaveQuery(ctx context.Context, q api.SavedQuery) (*api.SavedQuery, error) {
+	var saved api.SavedQuery
+	if err := c.do(ctx, http.MethodPost, "/queries", q, &saved, true); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// SavedQueries lists the saved queries
+func (c *Client) SavedQueries(ctx context.Context) ([]api.SavedQuery, error) {
+	var queries []api.SavedQuery
+	if err := c.do(ctx, http.MethodGet, "/queries", nil, &queries, true); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// SavedQuery returns the query saved under name
+func (c *Client) SavedQuery(ctx context.Context, name string) (*api.SavedQuery, error) {
+	var q api.SavedQuery
+	if err := c.do(ctx, http.MethodGet, "/queries/"+url.PathEscape(name), nil, &q, true); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// RunSavedQuery returns the vulnerabilities matching a saved query
+func (c *Client) RunSavedQuery(ctx context.Context, name string) ([]models.Vulnerability, error) {
+	var vulns []models.Vulnerability
+	if err := c.do(ctx, http.MethodGet, "/queries/"+url.PathEscape(name)+"/run", nil, &vulns, true); err != nil {
+		return nil, err
+	}
+	return vulns, nil
+}
+
+// do sends a request with retries and decodes the JSON response into out.
+// When idempotent is false, only responses that guarantee the server did
+// no work (429, 503) are retried.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.backoff << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		retry, err := c.attempt(ctx, method, path, payload, out, idempotent)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+// attempt performs a single request and reports whether a failure is retryable
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out interface{}, idempotent bool) (bool, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The request may have reached the server, so only retry reads
+		return idempotent, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			return true, apiErr
+		case resp.StatusCode >= http.StatusInternalServerError:
+			return idempotent, apiErr
+		default:
+			return false, apiErr
+		}
+	}
+
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("vulnscan: decode response: %v", err)
+	}
+	return false, nil
+}
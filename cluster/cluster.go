@@ -0,0 +1,112 @@
+// Package cluster coordinates replicas of the service that share one
+// database. A replica is elected leader by holding a lease row it keeps
+// renewing, and each run of a background job is claimed in the database,
+// so that scheduled work runs on one replica rather than on all of them.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/jobs"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// leaderLease is the name of the lease its holder leads with
+const leaderLease = "leader"
+
+// Node is one replica of the service
+type Node struct {
+	ID  string        // Unique identifier of the replica
+	DB  *sqlx.DB      // Database the replicas share
+	TTL time.Duration // How long leadership lasts without renewal
+
+	leader atomic.Bool
+}
+
+// Default is the node of this process, when replicas share the database
+var Default *Node
+
+// NewNode creates a node identified by the host name and a random suffix,
+// so that restarts and replicas on one host are told apart
+func NewNode(db *sqlx.DB, ttl time.Duration) *Node {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "vulnscan"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &Node{ID: host + "-" + hex.EncodeToString(b), DB: db, TTL: ttl}
+}
+
+// Run campaigns for leadership until ctx is cancelled, renewing the lease
+// three times per TTL while it is held, and then gives it up
+func (n *Node) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.TTL / 3)
+	defer ticker.Stop()
+	for {
+		n.Campaign(ctx)
+		select {
+		case <-ctx.Done():
+			if n.leader.Swap(false) {
+				storage.ReleaseLease(context.Background(), n.DB, leaderLease, n.ID)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Campaign takes or renews the leader lease once, reporting whether this
+// node leads. A node that can't reach the database stops leading, since
+// its lease may run out meanwhile.
+func (n *Node) Campaign(ctx context.Context) bool {
+	ok, err := storage.AcquireLease(ctx, n.DB, leaderLease, n.ID, n.TTL)
+	if err != nil {
+		slog.Warn("leader election failed", "node", n.ID, "error", err)
+	}
+	if was := n.leader.Swap(ok); was != ok {
+		slog.Info("leadership changed", "node", n.ID, "leader", ok)
+	}
+	return ok
+}
+
+// IsLeader reports whether this node leads
+func (n *Node) IsLeader() bool {
+	return n.leader.Load()
+}
+
+// Claim decides whether this node runs a scheduled job: jobs marked Local
+// run on every node, jobs marked LeaderOnly on the leader, and other jobs
+// on the first node to claim each interval's run. It is meant for
+// jobs.Runner.Claim.
+func (n *Node) Claim(ctx context.Context, job jobs.Job) (bool, error) {
+	if job.Local {
+		return true, nil
+	}
+	if job.LeaderOnly {
+		return n.IsLeader(), nil
+	}
+	return storage.ClaimJobRun(ctx, n.DB, job.Name, n.ID, job.Interval)
+}
+
+// Status describes this node and the current leader
+func (n *Node) Status(ctx context.Context) (models.ClusterStatus, error) {
+	status := models.ClusterStatus{Node: n.ID, Leader: n.IsLeader()}
+	holder, expires, err := storage.LeaseHolder(ctx, n.DB, leaderLease)
+	if err != nil {
+		return status, err
+	}
+	if holder != "" {
+		status.LeaderNode, status.LeaseExpiresAt = holder, &expires
+	}
+	return status, nil
+}
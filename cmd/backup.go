@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/encrypt"
+	"github.com/Chinzzii/vulnscan/secrets"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// sqliteHeader starts every SQLite database file
+const sqliteHeader = "SQLite format 3\x00"
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Write a consistent copy of the local database, encrypted when an encryption key is configured",
+	Long: `Write a consistent copy of the database at DATABASE_DSN to a new file. The
+copy is taken while the server keeps running. With ENCRYPTION_KEY,
+ENCRYPTION_KEY_FILE, or ENCRYPTION_KEY_COMMAND set, the copy is encrypted
+with AES-256-GCM and can only be restored with the same key.`,
+	Example: `  vulnscan backup vulnscan-$(date +%F).db.enc
+  ENCRYPTION_KEY_COMMAND='aws kms decrypt --ciphertext-blob fileb://key.enc --query Plaintext --output text | base64 -d' vulnscan backup backup.db.enc`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if err := configureVault(cmd.Context(), cfg); err != nil {
+			return err
+		}
+		key, err := loadEncryptionKey(cfg)
+		if err != nil {
+			return err
+		}
+		if err := openOfflineDB(); err != nil {
+			return err
+		}
+		if err := backup(cmd.Context(), args[0], key); err != nil {
+			return err
+		}
+		if key == nil {
+			fmt.Fprintln(cmd.ErrOrStderr(), "warning: backup is not encrypted; set ENCRYPTION_KEY, ENCRYPTION_KEY_FILE, or ENCRYPTION_KEY_COMMAND to encrypt it")
+		}
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup> <database>",
+	Short: "Write the database file of a backup, decrypting it with the configured encryption key",
+	Long: `Write the database file of a backup taken with vulnscan backup to a path
+that doesn't exist yet. Encrypted backups need the key they were taken with.
+Stop the server and point DATABASE_DSN at the restored file to use it.`,
+	Example: `  vulnscan restore backup.db.enc vulnerabilities.db`,
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if err := configureVault(cmd.Context(), cfg); err != nil {
+			return err
+		}
+		key, err := loadEncryptionKey(cfg)
+		if err != nil {
+			return err
+		}
+		return restore(args[0], args[1], key)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
+
+// loadEncryptionKey reads the configured encryption key, or returns nil
+// when none is configured. ENCRYPTION_KEY may be a secret reference.
+func loadEncryptionKey(cfg config.Config) (*encrypt.Key, error) {
+	ctx := context.Background()
+	value, err := secrets.Default.Resolve(ctx, "ENCRYPTION_KEY", cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return encrypt.LoadKey(ctx, encrypt.KeySource{
+		Value:   value,
+		File:    cfg.EncryptionKeyFile,
+		Command: cfg.EncryptionKeyCommand,
+	})
+}
+
+// backup copies the database to a new file at path, encrypted with the
+// key when it is set. The copy is written next to path and renamed into
+// place, so path never holds a partial backup.
+func backup(ctx context.Context, path string, key *encrypt.Key) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".vulnscan-backup-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := storage.Backup(ctx, storage.DB, tmp.Name()); err != nil {
+		return fmt.Errorf("copy database: %v", err)
+	}
+
+	if key != nil {
+		sealed := tmp.Name() + ".enc"
+		defer os.Remove(sealed)
+		if err := encryptFile(tmp.Name(), sealed, key); err != nil {
+			return fmt.Errorf("encrypt backup: %v", err)
+		}
+		return os.Rename(sealed, path)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encryptFile writes the encrypted content of src to a new file dst
+func encryptFile(src, dst string, key *encrypt.Key) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := encrypt.NewWriter(out, key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// restore writes the database file of the backup at src to a new file at
+// dst, decrypting it with the key when the backup is encrypted
+func restore(src, dst string, key *encrypt.Key) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	br := bufio.NewReader(in)
+	head, _ := br.Peek(len(sqliteHeader))
+
+	var r io.Reader = br
+	if encrypt.IsEncrypted(head) {
+		if key == nil {
+			return fmt.Errorf("%s is encrypted; set ENCRYPTION_KEY, ENCRYPTION_KEY_FILE, or ENCRYPTION_KEY_COMMAND to the key it was taken with", src)
+		}
+		if r, err = encrypt.NewReader(br, key); err != nil {
+			return fmt.Errorf("decrypt backup: %v", err)
+		}
+	} else if !bytes.Equal(head, []byte(sqliteHeader)) {
+		return fmt.Errorf("%s is not a vulnscan backup", src)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("restore backup: %v", err)
+	}
+	return out.Close()
+}
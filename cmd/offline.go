@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Chinzzii/vulnscan/client"
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// newClient returns an API client for the configured server
+func newClient() *client.Client {
+	return client.New(serverURL)
+}
+
+// openOfflineDB opens the local database for offline subcommands
+func openOfflineDB() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := storage.InitDB(cfg.DatabaseDSN, ""); err != nil {
+		return fmt.Errorf("open database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+var (
+	querySeverity string            // Severity filter
+	queryID       string            // CVE or GHSA identifier filter
+	queryEPSSMin  float64           // Minimum EPSS score filter
+	querySource   string            // Severity opinion the severity filter matches
+	queryLicense  string            // License violation pattern filter
+	queryLabels   map[string]string // Scan label filter
+	queryFields   map[string]string // Custom field filter
+	queryClass    string            // Package class filter (os or application)
+	queryDedup    string            // Deduplication key
+	querySort     []string          // Sort keys, "-" prefixed for descending
+	queryExpr     string            // Boolean filter expression
+	queryRaw      bool              // Include unrecognized report fields
+	queryOutput   string            // Output format (table, json, or csv)
+	queryColumns  []string          // CSV columns
+	querySaved    string            // Saved query to run
+	queryCount    bool              // Print only the number of results
+	queryExists   bool              // Print only whether there are results
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Query stored vulnerabilities",
+	Example: `  vulnscan query --severity HIGH --output table
+  vulnscan query --severity CRITICAL --epss-min 0.5
+  vulnscan query --severity CRITICAL --severity-source nvd
+  vulnscan query --label team=payments --sort -epss,package
+  vulnscan query --expr 'severity in (critical, high) AND NOT status = fixed'
+  vulnscan query --id GHSA-jfh8-c2jp-5v3q
+  vulnscan query --license 'AGPL-*'
+  vulnscan query --label team=payments --severity CRITICAL
+  vulnscan query --field business_unit=payments --severity HIGH
+  vulnscan query --saved prod-critical
+  vulnscan query --severity CRITICAL --count
+  vulnscan query --severity HIGH --package-class application
+  vulnscan query --id CVE-2024-3094 --include-raw -o json
+  vulnscan query --severity HIGH -o csv --columns id,package_name,fixed_version > high.csv`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if queryOutput != "table" && queryOutput != "json" && queryOutput != "csv" {
+			return fmt.Errorf("invalid --output %q (want table, json, or csv)", queryOutput)
+		}
+		columns, err := export.SelectColumns(queryColumns)
+		if err != nil {
+			return err
+		}
+
+		if queryCount && queryExists {
+			return fmt.Errorf("--count and --exists are mutually exclusive")
+		}
+		if querySaved != "" {
+			if queryCount || queryExists {
+				return fmt.Errorf("--count and --exists can't be combined with --saved")
+			}
+			return runSavedQuery(cmd, columns)
+		}
+
+		filters := handlers.QueryFilters{Severity: querySeverity, SeveritySource: querySource, ID: queryID, License: queryLicense, Labels: queryLabels, CustomFields: queryFields, PackageClass: queryClass, Dedup: queryDedup, Sort: querySort, Expr: queryExpr, IncludeRaw: queryRaw}
+		if cmd.Flags().Changed("epss-min") {
+			filters.EPSSMin = &queryEPSSMin
+		}
+		if err := handlers.ValidateQueryFilters(filters); err != nil {
+			return err
+		}
+		if queryCount || queryExists {
+			return printQueryCount(cmd, filters)
+		}
+
+		var vulns []models.Vulnerability
+		if offline {
+			if err := openOfflineDB(); err != nil {
+				return err
+			}
+			if vulns, err = handlers.QueryVulnerabilities(cmd.Context(), filters); err != nil {
+				return err
+			}
+		} else {
+			req := handlers.QueryRequest{Filters: filters}
+			if vulns, err = newClient().Query(cmd.Context(), req); err != nil {
+				return err
+			}
+		}
+
+		return printVulnerabilities(vulns, columns)
+	},
+}
+
+func init() {
+	queryCmd.Flags().StringVar(&querySeverity, "severity", "", "severity to filter by (e.g. HIGH)")
+	queryCmd.Flags().StringVar(&querySource, "severity-source", "", "severity --severity matches: effective, reported, nvd, or override (default effective)")
+	queryCmd.Flags().StringVar(&queryID, "id", "", "CVE or GHSA identifier, including aliases")
+	queryCmd.Flags().StringVar(&queryLicense, "license", "", "license violations of a license pattern (e.g. AGPL-*, or * for all)")
+	queryCmd.Flags().StringToStringVar(&queryLabels, "label", nil, "labels the scans must carry, as key=value pairs")
+	queryCmd.Flags().StringToStringVar(&queryFields, "field", nil, "custom field values the findings or their scans must have, as name=value pairs")
+	queryCmd.Flags().StringVar(&queryClass, "package-class", "", "os for operating system packages, application for application dependencies")
+	queryCmd.Flags().StringVar(&queryDedup, "dedup", "", "merge occurrences by cve+purl, cve+package, or off (default the server's)")
+	queryCmd.Flags().StringVar(&queryExpr, "expr", "", `filter expression, e.g. 'severity in (critical, high) AND package_name ~ "openssl*"'`)
+	queryCmd.Flags().StringSliceVar(&querySort, "sort", nil, "sort keys, comma-separated, - prefixed for descending (default -severity,-cvss,cve_id)")
+	queryCmd.Flags().BoolVar(&queryRaw, "include-raw", false, "include report fields vulnscan doesn't recognize (shown with -o json)")
+	queryCmd.Flags().Float64Var(&queryEPSSMin, "epss-min", 0, "minimum EPSS exploit probability (0-1)")
+	queryCmd.Flags().StringVarP(&queryOutput, "output", "o", "table", "output format: table, json, or csv")
+	queryCmd.Flags().StringVar(&querySaved, "saved", "", "name of a saved query to run instead of the filter flags")
+	queryCmd.Flags().BoolVar(&queryCount, "count", false, "print only the number of matching vulnerabilities")
+	queryCmd.Flags().BoolVar(&queryExists, "exists", false, "print only whether any vulnerability matches (true or false)")
+	queryCmd.Flags().StringSliceVar(&queryColumns, "columns", nil, "CSV columns, comma-separated (default id,severity,cvss,...)")
+	rootCmd.AddCommand(queryCmd)
+}
+
+// printQueryCount prints the number of results of the filters for --count,
+// or whether there are any for --exists
+func printQueryCount(cmd *cobra.Command, filters handlers.QueryFilters) error {
+	if offline {
+		if err := openOfflineDB(); err != nil {
+			return err
+		}
+	}
+	if queryExists {
+		var (
+			exists bool
+			err    error
+		)
+		if offline {
+			exists, err = handlers.VulnerabilitiesExist(cmd.Context(), filters)
+		} else {
+			exists, err = newClient().QueryExists(cmd.Context(), filters)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(exists)
+		return nil
+	}
+
+	var (
+		count int
+		err   error
+	)
+	if offline {
+		count, err = handlers.CountVulnerabilities(cmd.Context(), filters)
+	} else {
+		count, err = newClient().QueryCount(cmd.Context(), filters)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(count)
+	return nil
+}
+
+// runSavedQuery runs the query saved under --saved. Its saved columns apply
+// to CSV output unless --columns is given.
+func runSavedQuery(cmd *cobra.Command, columns []export.Column) error {
+	var (
+		q     handlers.SavedQuery
+		vulns []models.Vulnerability
+		err   error
+	)
+	if offline {
+		if err := openOfflineDB(); err != nil {
+			return err
+		}
+		if q, err = handlers.GetSavedQuery(cmd.Context(), querySaved); err != nil {
+			return fmt.Errorf("saved query %q: %v", querySaved, err)
+		}
+		if vulns, err = handlers.QueryVulnerabilities(cmd.Context(), q.Filters); err != nil {
+			return err
+		}
+	} else {
+		c := newClient()
+		if vulns, err = c.RunSavedQuery(cmd.Context(), querySaved); err != nil {
+			return err
+		}
+		// The saved columns only matter for CSV
+		if queryOutput == "csv" && !cmd.Flags().Changed("columns") {
+			saved, err := c.SavedQuery(cmd.Context(), querySaved)
+			if err != nil {
+				return err
+			}
+			q = *saved
+		}
+	}
+
+	if !cmd.Flags().Changed("columns") && len(q.Columns) > 0 {
+		if columns, err = export.SelectColumns(q.Columns); err != nil {
+			return err
+		}
+	}
+	return printVulnerabilities(vulns, columns)
+}
+
+// printVulnerabilities writes vulnerabilities in the --output format
+func printVulnerabilities(vulns []models.Vulnerability, columns []export.Column) error {
+	switch queryOutput {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(vulns)
+	case "csv":
+		return export.WriteCSV(os.Stdout, vulns, columns)
+	}
+	return printVulnerabilityTable(vulns)
+}
+
+// printVulnerabilityTable writes vulnerabilities as an aligned text table
+func printVulnerabilityTable(vulns []models.Vulnerability) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CVE\tSEVERITY\tCVSS\tEPSS\tPACKAGE\tCURRENT\tFIXED\tSTATUS")
+	for _, v := range vulns {
+		epss := "-"
+		if v.EPSS != nil {
+			epss = fmt.Sprintf("%.3f", *v.EPSS)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\t%s\t%s\t%s\n",
+			v.CVEID, v.Severity, v.CVSS, epss, v.PackageName, v.CurrentVersion, v.FixedVersion, v.Status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/delivery"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/jobs"
+	"github.com/Chinzzii/vulnscan/notify"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// reloadableSettings take effect on reload without further checks
+var reloadableSettings = []string{
+	"LOG_LEVEL", "LOG_FORMAT", "LOG_SAMPLE_INITIAL", "LOG_SAMPLE_THEREAFTER",
+	"SCAN_FILE_CONCURRENCY", "SCAN_PERSIST_CONCURRENCY", "BULK_SCAN_CONCURRENCY",
+}
+
+// notifySettings take effect on reload when notifications were configured
+// at startup
+var notifySettings = []string{"NOTIFY_CONFIG", "PUBLIC_URL"}
+
+// jobIntervals maps the interval settings of background jobs to the jobs
+// they reschedule. Jobs disabled at startup need a restart to enable.
+var jobIntervals = map[string]struct {
+	job      string
+	interval func(config.Config) time.Duration
+}{
+	"DB_MAINTENANCE_INTERVAL": {"db-maintenance", func(c config.Config) time.Duration { return c.DBMaintenanceInterval }},
+	"OSV_REFRESH_INTERVAL":    {"osv-refresh", func(c config.Config) time.Duration { return c.OSVRefreshInterval }},
+	"NVD_ENRICH_INTERVAL":     {"nvd-enrich", func(c config.Config) time.Duration { return c.NVDEnrichInterval }},
+	"EPSS_SYNC_INTERVAL":      {"epss-sync", func(c config.Config) time.Duration { return c.EPSSSyncInterval }},
+	"KEV_SYNC_INTERVAL":       {"kev-sync", func(c config.Config) time.Duration { return c.KEVSyncInterval }},
+	"GHSA_RESOLVE_INTERVAL":   {"ghsa-resolve", func(c config.Config) time.Duration { return c.GHSAResolveInterval }},
+	"JIRA_SYNC_INTERVAL":      {"jira-sync", func(c config.Config) time.Duration { return c.JiraSyncInterval }},
+	"DTRACK_SYNC_INTERVAL":    {"dtrack-pull", func(c config.Config) time.Duration { return c.DTrackSyncInterval }},
+	"NOTIFY_DIGEST_INTERVAL":  {"notify-digest", func(c config.Config) time.Duration { return c.NotifyDigestInterval }},
+}
+
+// runtimeConfig is the configuration the running server applied, with the
+// notification pipeline a reload replaces
+type runtimeConfig struct {
+	reloadMu sync.Mutex // Serializes reloads
+
+	mu        sync.Mutex
+	started   config.Config // Configuration at startup
+	cfg       config.Config // Configuration last applied
+	notifier  *notify.Notifier
+	deliverer *delivery.Deliverer
+	stop      context.CancelFunc // Stops the notifier's event delivery
+}
+
+// current is the configuration of the server this process runs
+var current = &runtimeConfig{}
+
+// init records the startup configuration
+func (rc *runtimeConfig) init(cfg config.Config) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.started, rc.cfg = cfg, cfg
+}
+
+// applied returns the configuration last applied
+func (rc *runtimeConfig) applied() config.Config {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.cfg
+}
+
+// notifications returns the current notifier and report deliverer
+func (rc *runtimeConfig) notifications() (*notify.Notifier, *delivery.Deliverer) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.notifier, rc.deliverer
+}
+
+// setNotifications starts delivering events to notifier and stops the
+// notifier it replaces
+func (rc *runtimeConfig) setNotifications(notifier *notify.Notifier, deliverer *delivery.Deliverer) {
+	ctx, stop := context.WithCancel(context.Background())
+	notifier.Start(ctx, events.Default)
+
+	rc.mu.Lock()
+	previous := rc.stop
+	rc.notifier, rc.deliverer, rc.stop = notifier, deliverer, stop
+	rc.mu.Unlock()
+	if previous != nil {
+		previous()
+	}
+}
+
+// loadNotifications reads the notification channels and scheduled reports
+// of cfg.NotifyConfig
+func loadNotifications(cfg config.Config) (*notify.Notifier, *delivery.Deliverer, error) {
+	notifier, err := notify.Load(cfg.NotifyConfig, storage.DB)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load notification channels: %v", err)
+	}
+	// Scheduled reports are configured in the same file
+	deliverer, err := delivery.Load(cfg.NotifyConfig, notifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load scheduled reports: %v", err)
+	}
+	deliverer.BaseURL = cfg.PublicURL
+	return notifier, deliverer, nil
+}
+
+// reload re-reads the configuration and applies the settings that can
+// change while the server runs: logging, scan concurrency, notification
+// channels and scheduled reports, and job intervals. Nothing is applied
+// when the new configuration is invalid. Changed settings that need a
+// restart are reported, until the server restarts.
+func (rc *runtimeConfig) reload() (handlers.ReloadResponse, error) {
+	rc.reloadMu.Lock()
+	defer rc.reloadMu.Unlock()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return handlers.ReloadResponse{}, err
+	}
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return handlers.ReloadResponse{}, err
+	}
+	rc.mu.Lock()
+	started, previous := rc.started, rc.cfg
+	rc.mu.Unlock()
+	notifying := started.NotifyConfig != "" && cfg.NotifyConfig != ""
+	var (
+		notifier  *notify.Notifier
+		deliverer *delivery.Deliverer
+	)
+	if notifying {
+		if notifier, deliverer, err = loadNotifications(cfg); err != nil {
+			return handlers.ReloadResponse{}, err
+		}
+	}
+	if err := handlers.SetConcurrency(cfg.ScanFileConcurrency, cfg.BulkScanConcurrency); err != nil {
+		return handlers.ReloadResponse{}, err
+	}
+	if err := handlers.SetPersistConcurrency(cfg.ScanPersistConcurrency); err != nil {
+		return handlers.ReloadResponse{}, err
+	}
+
+	slog.SetDefault(logger)
+	if notifying {
+		rc.setNotifications(notifier, deliverer)
+	}
+	scheduled := map[string]bool{}
+	for _, st := range jobs.Default.Statuses() {
+		scheduled[st.Name] = true
+	}
+
+	// A setting is applied when it changed since the last reload, and
+	// needs a restart while it differs from its startup value
+	res := handlers.ReloadResponse{Applied: []string{}, RestartRequired: []string{}}
+	applies := func(key string) bool {
+		if j, ok := jobIntervals[key]; ok {
+			return scheduled[j.job]
+		}
+		return slices.Contains(reloadableSettings, key) || notifying && slices.Contains(notifySettings, key)
+	}
+	for _, key := range config.Changed(previous, cfg) {
+		if !applies(key) {
+			continue
+		}
+		if j, ok := jobIntervals[key]; ok {
+			jobs.Default.Reschedule(j.job, j.interval(cfg))
+		}
+		res.Applied = append(res.Applied, key)
+	}
+	for _, key := range config.Changed(started, cfg) {
+		if !applies(key) {
+			res.RestartRequired = append(res.RestartRequired, key)
+		}
+	}
+
+	rc.mu.Lock()
+	rc.cfg = cfg
+	rc.mu.Unlock()
+	slog.Info("Configuration reloaded", "applied", res.Applied, "restart_required", res.RestartRequired)
+	return res, nil
+}
+
+// reloadOnSignal reloads the configuration on each SIGHUP
+func reloadOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if _, err := current.reload(); err != nil {
+				slog.Error("Configuration reload failed", "error", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Global flags shared by client subcommands
+var (
+	serverURL string // Base URL of a running vulnscan server
+	offline   bool   // Operate directly on the local database instead of the server
+)
+
+// rootCmd is the base command; subcommands register themselves in init
+var rootCmd = &cobra.Command{
+	Use:           "vulnscan",
+	Short:         "Scan GitHub repositories for vulnerability reports and query stored findings",
+	SilenceUsage:  true,
+	SilenceErrors: false,
+}
+
+func init() {
+	defaultServer := os.Getenv("VULNSCAN_SERVER")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:8080"
+	}
+	rootCmd.PersistentFlags().StringVar(&serverURL, "server", defaultServer, "vulnscan server URL (env VULNSCAN_SERVER)")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "operate directly on the local database instead of a server")
+}
+
+// Execute runs the CLI
+func Execute() error {
+	return rootCmd.Execute()
+}
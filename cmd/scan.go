@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+)
+
+var (
+	scanRepo  string            // Repository URL to scan
+	scanFiles []string          // Scan report files to ingest
+	scanImage string            // Container image reference to scan
+	scanForce bool              // Ingest files even when unchanged
+	scanSHA   map[string]string // Expected SHA-256 of files
+	scanLabel map[string]string // Labels attached to the scans
+
+	scanRef         string        // Branch, tag, or commit; empty uses the default branch
+	scanPathPrefix  string        // Directory the files are relative to
+	scanExclude     []string      // Patterns of files not to ingest
+	scanParseMode   string        // strict or lenient; empty uses the server default
+	scanTimeout     time.Duration // Bound on the whole scan; 0 uses the server default
+	scanFileTimeout time.Duration // Bound on each file; 0 uses the server default
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Ingest vulnerability reports from a GitHub repository or a container image scan",
+	Example: `  vulnscan scan --repo https://github.com/velancio/vulnerability_scans --files vulnscan15.json,vulnscan16.json
+  vulnscan scan --offline --repo https://github.com/velancio/vulnerability_scans --files vulnscan16.json
+  vulnscan scan --repo https://github.com/velancio/vulnerability_scans --files vulnscan16.json --label team=payments,env=prod
+  vulnscan scan --image alpine:3.18`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if scanImage == "" && (scanRepo == "" || len(scanFiles) == 0) {
+			return fmt.Errorf("--repo and --files are required unless --image is given")
+		}
+		req := handlers.ScanRequest{Repo: scanRepo, Files: scanFiles, Ref: scanRef, PathPrefix: scanPathPrefix, Exclude: scanExclude, Image: scanImage, Force: scanForce, Checksums: scanSHA, Labels: scanLabel, ParseMode: scanParseMode}
+		if scanTimeout != 0 {
+			req.Timeout = scanTimeout.String()
+		}
+		if scanFileTimeout != 0 {
+			req.FileTimeout = scanFileTimeout.String()
+		}
+		if err := handlers.ValidateScanRequest(req); err != nil {
+			return err
+		}
+
+		var resp handlers.ScanResponse
+		if offline {
+			if err := openOfflineDB(); err != nil {
+				return err
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			scanner := handlers.NewScanner(github.DefaultFetcher)
+			if cfg.PushgatewayURL != "" {
+				if err := configurePushgateway(cfg, scanner); err != nil {
+					return err
+				}
+			}
+			resp = scanner.Run(cmd.Context(), req)
+		} else {
+			r, err := newClient().Scan(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			resp = *r
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+		if len(resp.Failed) > 0 {
+			return fmt.Errorf("%d file(s) failed", len(resp.Failed))
+		}
+		return nil
+	},
+}
+
+func init() {
+	scanCmd.Flags().StringVar(&scanRepo, "repo", "", "GitHub repository URL")
+	scanCmd.Flags().StringSliceVar(&scanFiles, "files", nil, "comma-separated scan report files")
+	scanCmd.Flags().StringVar(&scanRef, "ref", "", "branch, tag, or commit to fetch files from; defaults to the repository's default branch")
+	scanCmd.Flags().StringVar(&scanPathPrefix, "path-prefix", "", "directory the files are relative to, e.g. security/reports")
+	scanCmd.Flags().StringSliceVar(&scanExclude, "exclude", nil, "comma-separated patterns of files not to ingest, e.g. testdata,*.fixture.json")
+	scanCmd.Flags().StringVar(&scanImage, "image", "", "container image reference to scan with trivy, e.g. alpine:3.18")
+	scanCmd.Flags().BoolVar(&scanForce, "force", false, "ingest files even when unchanged since their last scan")
+	scanCmd.Flags().StringToStringVar(&scanSHA, "sha256", nil, "expected SHA-256 of files, as file=digest pairs")
+	scanCmd.Flags().StringToStringVar(&scanLabel, "label", nil, "labels to attach to the scans, as key=value pairs")
+	scanCmd.Flags().StringVar(&scanParseMode, "parse-mode", "", "strict or lenient handling of malformed vulnerability entries; defaults to the server's")
+	scanCmd.Flags().DurationVar(&scanTimeout, "timeout", 0, "bound on the whole scan, e.g. 5m; defaults to the server's")
+	scanCmd.Flags().DurationVar(&scanFileTimeout, "file-timeout", 0, "bound on fetching and ingesting each file, e.g. 1m; defaults to the server's")
+	rootCmd.AddCommand(scanCmd)
+}
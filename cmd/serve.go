@@ -0,0 +1,867 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/cluster"
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/dtrack"
+	"github.com/Chinzzii/vulnscan/epss"
+	"github.com/Chinzzii/vulnscan/eventbus"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/ghsa"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/image"
+	"github.com/Chinzzii/vulnscan/jira"
+	"github.com/Chinzzii/vulnscan/jobs"
+	"github.com/Chinzzii/vulnscan/kev"
+	"github.com/Chinzzii/vulnscan/license"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/metrics"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/nvd"
+	"github.com/Chinzzii/vulnscan/osv"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/policy"
+	"github.com/Chinzzii/vulnscan/pushgateway"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/secrets"
+	"github.com/Chinzzii/vulnscan/siem"
+	"github.com/Chinzzii/vulnscan/sla"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/telemetry"
+	"github.com/Chinzzii/vulnscan/ui"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the vulnscan HTTP server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		return serve(cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serve initializes logging, tracing, and storage, then runs the HTTP server
+func serve(cfg config.Config) error {
+	if err := setupLogging(cfg); err != nil {
+		return err
+	}
+
+	// Configure OpenTelemetry tracing (exports via OTLP when configured)
+	shutdownTracing, err := telemetry.Init(context.Background(), "vulnscan")
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	allowedNetworks := make([]netip.Prefix, len(cfg.HTTPAllowedNetworks))
+	for i, n := range cfg.HTTPAllowedNetworks {
+		if allowedNetworks[i], err = netip.ParsePrefix(n); err != nil {
+			slog.Error("Failed to configure HTTP client", "error", err)
+			return err
+		}
+	}
+	if err := httpclient.Configure(httpclient.Config{
+		Timeout:    cfg.HTTPTimeout,
+		MaxRetries: cfg.HTTPMaxRetries,
+		Backoff:    cfg.HTTPRetryBackoff,
+		MaxBackoff: cfg.HTTPRetryMaxBackoff,
+		CABundle:   cfg.HTTPCABundle,
+
+		BreakerThreshold: cfg.HTTPBreakerFailures,
+		BreakerCooldown:  cfg.HTTPBreakerCooldown,
+		AllowedNetworks:  allowedNetworks,
+	}); err != nil {
+		slog.Error("Failed to configure HTTP client", "error", err)
+		return err
+	}
+	if err := resolveSecrets(context.Background(), &cfg); err != nil {
+		slog.Error("Failed to resolve secrets", "error", err)
+		return err
+	}
+	configureOSV(cfg)
+	sla.Default = cfg.SLAPolicy
+	github.DefaultClient = github.NewClient(cfg.GitHubAPIURL, cfg.GitHubToken)
+	github.DefaultClient.Reserve = cfg.GitHubRateReserve
+	github.DefaultClient.BranchTTL = cfg.GitHubBranchTTL
+	if github.DefaultFetcher.Hosts, err = github.ParseRawHosts(cfg.GitHubRawHosts); err != nil {
+		slog.Error("Failed to configure raw file hosts", "error", err)
+		return err
+	}
+	handlers.OrgScanPatterns = cfg.OrgScanPatterns
+	handlers.AdminAPIKey = cfg.AdminAPIKey
+	handlers.ScanAccess = handlers.RepoAccess{Allow: cfg.ScanRepoAllow, Deny: cfg.ScanRepoDeny}
+	if err := handlers.ScanAccess.Validate(); err != nil {
+		slog.Error("Failed to configure repository access", "error", err)
+		return err
+	}
+	switch cfg.RawFileStore {
+	case storage.RawGzip, storage.RawIdentity:
+		handlers.RawFileEncoding = cfg.RawFileStore
+	case "off":
+		handlers.RawFileEncoding = ""
+	default:
+		err := fmt.Errorf("unknown RAW_FILE_STORE %q (want gzip, identity, or off)", cfg.RawFileStore)
+		slog.Error("Failed to configure raw file storage", "error", err)
+		return err
+	}
+	if storage.EncryptionKey, err = loadEncryptionKey(cfg); err != nil {
+		slog.Error("Failed to configure encryption", "error", err)
+		return err
+	}
+	switch cfg.ParseMode {
+	case handlers.ParseStrict, handlers.ParseLenient:
+		handlers.DefaultParseMode = cfg.ParseMode
+	default:
+		err := fmt.Errorf("unknown PARSE_MODE %q (want strict or lenient)", cfg.ParseMode)
+		slog.Error("Failed to configure parsing", "error", err)
+		return err
+	}
+	switch cfg.DedupKey {
+	case handlers.DedupCVEPURL, handlers.DedupCVEPackage, handlers.DedupOff:
+		handlers.DefaultDedupKey = cfg.DedupKey
+	default:
+		err := fmt.Errorf("unknown DEDUP_KEY %q (want cve+purl, cve+package, or off)", cfg.DedupKey)
+		slog.Error("Failed to configure deduplication", "error", err)
+		return err
+	}
+	if cfg.QueryMaxRows < 0 {
+		err := fmt.Errorf("invalid QUERY_MAX_ROWS %d (want 0 or more)", cfg.QueryMaxRows)
+		slog.Error("Failed to configure queries", "error", err)
+		return err
+	}
+	handlers.QueryMaxRows = cfg.QueryMaxRows
+	handlers.IdempotencyTTL = cfg.IdempotencyTTL
+	if cfg.ScanFailedStatus < 200 || cfg.ScanFailedStatus > 599 || http.StatusText(cfg.ScanFailedStatus) == "" {
+		err := fmt.Errorf("invalid SCAN_FAILED_STATUS %d (want an HTTP status code from 200 to 599)", cfg.ScanFailedStatus)
+		slog.Error("Failed to configure scan responses", "error", err)
+		return err
+	}
+	handlers.ScanFailedStatus = cfg.ScanFailedStatus
+	handlers.ScanTimeout, handlers.FileTimeout = cfg.ScanTimeout, cfg.ScanFileTimeout
+	switch cfg.IncompleteScanAction {
+	case handlers.IncompleteFlag, handlers.IncompleteSkip:
+		handlers.IncompleteScanAction = cfg.IncompleteScanAction
+	default:
+		err := fmt.Errorf("unknown INCOMPLETE_SCAN_ACTION %q (want flag or skip)", cfg.IncompleteScanAction)
+		slog.Error("Failed to configure incomplete scans", "error", err)
+		return err
+	}
+	handlers.IncompleteScanStatuses = cfg.IncompleteScanStatuses
+	if cfg.NotifyFetchFailures < 0 {
+		err := fmt.Errorf("invalid NOTIFY_FETCH_FAILURES %d (want 0 or more)", cfg.NotifyFetchFailures)
+		slog.Error("Failed to configure operational alerts", "error", err)
+		return err
+	}
+	handlers.FetchFailureThreshold, handlers.ScanStuckAfter = cfg.NotifyFetchFailures, cfg.NotifyScanStuckAfter
+	httpclient.OnCircuitChange = handlers.PublishCircuitChange
+	if err := handlers.SetConcurrency(cfg.ScanFileConcurrency, cfg.BulkScanConcurrency); err != nil {
+		slog.Error("Failed to configure scan concurrency", "error", err)
+		return err
+	}
+	if err := handlers.SetPersistConcurrency(cfg.ScanPersistConcurrency); err != nil {
+		slog.Error("Failed to configure scan concurrency", "error", err)
+		return err
+	}
+	if cfg.IngestMemoryLimitMB < 0 {
+		err := fmt.Errorf("invalid INGEST_MEMORY_LIMIT_MB %d (want 0 or more)", cfg.IngestMemoryLimitMB)
+		slog.Error("Failed to configure ingest memory", "error", err)
+		return err
+	}
+	handlers.IngestBudget = pipeline.NewBudget(int64(cfg.IngestMemoryLimitMB) << 20)
+	license.Default = license.Policy{Deny: cfg.LicenseDeny, Severity: cfg.LicenseSeverity}
+	image.DefaultScanner = &image.Trivy{Path: cfg.ImageScanner, Timeout: cfg.ImageScanTimeout}
+
+	if cfg.PolicyFile != "" {
+		if policy.Policies, err = policy.Load(cfg.PolicyFile); err != nil {
+			slog.Error("Failed to load policies", "error", err)
+			return err
+		}
+	}
+
+	// Initialize SQLite database connections
+	if err := storage.InitDB(cfg.DatabaseDSN, cfg.DatabaseReadDSN); err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		return err
+	}
+	storage.Statements.Resize(cfg.StatementCache)
+	current.init(cfg)
+
+	// Elect a leader among replicas sharing the database, and claim each
+	// job run so that only one of them does it
+	switch cfg.ClusterMode {
+	case "single":
+	case "shared":
+		if cfg.LeaderLeaseTTL <= 0 {
+			err := fmt.Errorf("invalid LEADER_LEASE_TTL %s (want a positive duration)", cfg.LeaderLeaseTTL)
+			slog.Error("Failed to configure clustering", "error", err)
+			return err
+		}
+		cluster.Default = cluster.NewNode(storage.DB, cfg.LeaderLeaseTTL)
+		cluster.Default.Campaign(context.Background())
+		go cluster.Default.Run(context.Background())
+		jobs.Default.Claim = cluster.Default.Claim
+		registerClusterMetrics()
+		slog.Info("Joined cluster", "node", cluster.Default.ID, "leader", cluster.Default.IsLeader())
+	default:
+		err := fmt.Errorf("unknown CLUSTER_MODE %q (want single or shared)", cfg.ClusterMode)
+		slog.Error("Failed to configure clustering", "error", err)
+		return err
+	}
+
+	// Limit what each tenant may ingest
+	if cfg.QuotaConfig != "" {
+		q, err := quota.Load(cfg.QuotaConfig, storage.DB)
+		if err != nil {
+			slog.Error("Failed to load quotas", "error", err)
+			return err
+		}
+		quota.Default = q
+		slog.Info("Quotas enabled", "tenants", len(q.Tenants()))
+	}
+
+	// Schedule background jobs
+	if cfg.DBMaintenanceInterval > 0 {
+		if cfg.DBVacuumPages < 0 {
+			err := fmt.Errorf("invalid DB_VACUUM_PAGES %d (want 0 or more)", cfg.DBVacuumPages)
+			slog.Error("Failed to configure database maintenance", "error", err)
+			return err
+		}
+		handlers.MaintenanceVacuumPages = cfg.DBVacuumPages
+		jobs.Default.Add(jobs.Job{
+			Name:     "db-maintenance",
+			Interval: cfg.DBMaintenanceInterval,
+			Run: func(ctx context.Context) error {
+				_, err := handlers.RunMaintenance(ctx, false)
+				return err
+			},
+		})
+	}
+	if cfg.OSVRefreshInterval > 0 {
+		jobs.Default.Add(jobs.Job{
+			Name:     "osv-refresh",
+			Interval: cfg.OSVRefreshInterval,
+			Run: func(ctx context.Context) error {
+				n, err := osv.DefaultClient.Refresh(ctx, storage.DB)
+				slog.Info("OSV refresh completed", "new_findings", n)
+				return err
+			},
+		})
+	}
+	if cfg.NVDEnrichInterval > 0 {
+		nvd.DefaultClient = nvd.NewClient(cfg.NVDURL, cfg.NVDAPIKey)
+		jobs.Default.Add(jobs.Job{
+			Name:     "nvd-enrich",
+			Interval: cfg.NVDEnrichInterval,
+			Run: func(ctx context.Context) error {
+				n, err := nvd.DefaultClient.Enrich(ctx, storage.DB, cfg.NVDCacheTTL)
+				slog.Info("NVD enrichment completed", "records", n)
+				return err
+			},
+		})
+	}
+	if cfg.EPSSSyncInterval > 0 {
+		epss.DefaultClient.FeedURL = cfg.EPSSFeedURL
+		jobs.Default.Add(jobs.Job{
+			Name:     "epss-sync",
+			Interval: cfg.EPSSSyncInterval,
+			Run: func(ctx context.Context) error {
+				n, err := epss.DefaultClient.Sync(ctx, storage.DB)
+				slog.Info("EPSS sync completed", "scores", n)
+				return err
+			},
+		})
+	}
+	if cfg.KEVSyncInterval > 0 {
+		kev.DefaultClient.FeedURL = cfg.KEVFeedURL
+		jobs.Default.Add(jobs.Job{
+			Name:     "kev-sync",
+			Interval: cfg.KEVSyncInterval,
+			Run: func(ctx context.Context) error {
+				n, err := kev.DefaultClient.Sync(ctx, storage.DB)
+				slog.Info("KEV sync completed", "cves", n)
+				return err
+			},
+		})
+	}
+	if cfg.GHSAResolveInterval > 0 {
+		ghsa.DefaultClient = ghsa.NewClient(cfg.GitHubAPIURL, cfg.GitHubToken)
+		jobs.Default.Add(jobs.Job{
+			Name:     "ghsa-resolve",
+			Interval: cfg.GHSAResolveInterval,
+			Run: func(ctx context.Context) error {
+				n, err := ghsa.DefaultClient.ResolveStored(ctx, storage.DB, cfg.GHSACacheTTL)
+				slog.Info("GHSA resolution completed", "identifiers", n)
+				return err
+			},
+		})
+	}
+	if cfg.JiraURL != "" && cfg.JiraSyncInterval > 0 {
+		jira.DefaultClient = jira.NewClient(cfg.JiraURL, cfg.JiraEmail, cfg.JiraToken, cfg.JiraProject)
+		jira.DefaultClient.IssueType = cfg.JiraIssueType
+		jira.DefaultClient.Labels = cfg.JiraLabels
+		jira.DefaultClient.Severities = cfg.JiraSeverities
+		jobs.Default.Add(jobs.Job{
+			Name:     "jira-sync",
+			Interval: cfg.JiraSyncInterval,
+			Run: func(ctx context.Context) error {
+				created, updated, err := jira.DefaultClient.Sync(ctx, storage.DB)
+				slog.Info("Jira sync completed", "issues_created", created, "findings_updated", updated)
+				return err
+			},
+		})
+	}
+	if cfg.NotifyConfig != "" {
+		notifier, deliverer, err := loadNotifications(cfg)
+		if err != nil {
+			slog.Error("Failed to load notifications", "error", err)
+			return err
+		}
+		current.setNotifications(notifier, deliverer)
+		if cfg.NotifyDigestInterval > 0 {
+			jobs.Default.Add(jobs.Job{
+				Name:     "notify-digest",
+				Interval: cfg.NotifyDigestInterval,
+				Run: func(ctx context.Context) error {
+					notifier, _ := current.notifications()
+					return notifier.SendDigest(ctx, time.Now().Add(-current.applied().NotifyDigestInterval))
+				},
+			})
+		}
+		// Always scheduled, so that reports added by a reload are delivered.
+		// Each replica tracks when reports fall due, so only the leader sends them.
+		jobs.Default.Add(jobs.Job{
+			Name:     "report-delivery",
+			Interval: time.Minute,
+			Run: func(ctx context.Context) error {
+				_, deliverer := current.notifications()
+				return deliverer.RunDue(ctx, time.Now())
+			},
+			LeaderOnly: true,
+		})
+	}
+	if cfg.SIEMConfig != "" {
+		forwarder, err := siem.Load(cfg.SIEMConfig)
+		if err != nil {
+			slog.Error("Failed to load SIEM outputs", "error", err)
+			return err
+		}
+		forwarder.Start(context.Background(), events.Default)
+		registerSIEMMetrics(forwarder)
+	}
+	if cfg.EventBusConfig != "" {
+		bus, err := eventbus.Load(cfg.EventBusConfig)
+		if err != nil {
+			slog.Error("Failed to load event bus publishers", "error", err)
+			return err
+		}
+		bus.Start(context.Background(), events.Default)
+		registerEventBusMetrics(bus)
+	}
+	if cfg.NotifyScanStuckAfter > 0 {
+		// Bulk scans are tracked in memory, so each replica checks its own
+		jobs.Default.Add(jobs.Job{
+			Name:     "scan-watchdog",
+			Interval: time.Minute,
+			Run: func(ctx context.Context) error {
+				if n := handlers.CheckStuckScans(time.Now()); n > 0 {
+					slog.Warn("Bulk scans stuck", "scans", n)
+				}
+				return nil
+			},
+			Local: true,
+		})
+	}
+	jobs.Default.Start(context.Background())
+	handlers.RegisterReadinessCheck("jobs", jobs.Default.Check)
+
+	// Register API endpoints
+	fetcher, err := contentFetcher(cfg)
+	if err != nil {
+		slog.Error("Failed to configure file fetching", "error", err)
+		return err
+	}
+	scanner := handlers.NewScanner(fetcher)
+	if cfg.PushgatewayURL != "" {
+		if err := configurePushgateway(cfg, scanner); err != nil {
+			slog.Error("Failed to configure Pushgateway", "error", err)
+			return err
+		}
+	}
+	if cfg.DTrackURL != "" {
+		if err := configureDTrack(cfg, scanner); err != nil {
+			slog.Error("Failed to configure Dependency-Track", "error", err)
+			return err
+		}
+	}
+	registerGitHubMetrics()
+	registerStatementMetrics()
+	registerCircuitMetrics()
+	registerIngestMetrics()
+	registerMaintenanceMetrics()
+	http.HandleFunc("/scan", auditedRoute("/scan", handlers.Idempotent("/scan", scanner.ServeHTTP)))                                         // Vulnerability scan API Endpoint
+	http.HandleFunc("/scan/bulk", auditedRoute("/scan/bulk", handlers.Idempotent("/scan/bulk", scanner.BulkScanHandler)))                    // Multi-repository bulk scan API Endpoint
+	http.HandleFunc("/scan/archive", auditedRoute("/scan/archive", scanner.ArchiveScanHandler))                                              // Report archive ingest API Endpoint
+	http.HandleFunc("/scan/org", auditedRoute("/scan/org", handlers.Idempotent("/scan/org", scanner.OrgScanHandler)))                        // Organization-wide scan API Endpoint
+	http.HandleFunc("/scan/bulk/{id}", route("/scan/bulk/{id}", handlers.BulkScanStatusHandler))                                             // Bulk scan progress API Endpoint
+	http.HandleFunc("/query", route("/query", handlers.QueryHandler))                                                                        // Vulnerability query API Endpoint
+	http.HandleFunc("/queries", auditedRoute("/queries", handlers.SavedQueriesHandler))                                                      // Saved queries API Endpoint
+	http.HandleFunc("/queries/{name}", auditedRoute("/queries/{name}", handlers.SavedQueryHandler))                                          // Saved query API Endpoint
+	http.HandleFunc("/queries/{name}/run", route("/queries/{name}/run", handlers.RunSavedQueryHandler))                                      // Saved query results API Endpoint
+	http.HandleFunc("/scans", route("/scans", handlers.ScansHandler))                                                                        // Scan history API Endpoint
+	http.HandleFunc("/scans/{id}/fields", auditedRoute("/scans/{id}/fields", handlers.ScanFieldsHandler))                                    // Scan custom fields API Endpoint
+	http.HandleFunc("/stats", route("/stats", handlers.StatsHandler))                                                                        // Aggregate statistics API Endpoint
+	http.HandleFunc("/stats/top", route("/stats/top", handlers.TopOffendersHandler))                                                         // Top offenders API Endpoint
+	http.HandleFunc("/trends", route("/trends", handlers.TrendsHandler))                                                                     // Vulnerability trend API Endpoint
+	http.HandleFunc("/graphql", route("/graphql", handlers.GraphQLHandler))                                                                  // GraphQL API Endpoint
+	http.HandleFunc("/reports/fixes", route("/reports/fixes", handlers.FixesHandler))                                                        // Fix-available report API Endpoint
+	http.HandleFunc("/reports/{repo...}", route("/reports/{repo...}", handlers.ReportHandler))                                               // HTML repository report API Endpoint
+	http.HandleFunc("/badge/{repo...}", route("/badge/{repo...}", handlers.BadgeHandler))                                                    // README status badge API Endpoint
+	http.HandleFunc("/repos", auditedRoute("/repos", handlers.ReposHandler))                                                                 // Repository registry API Endpoint
+	http.HandleFunc("/repos/scores", route("/repos/scores", handlers.RepoScoresHandler))                                                     // Ranked repository risk scores API Endpoint
+	http.HandleFunc("/repos/{path...}", auditedRoute("/repos/{path...}", handlers.RepoHandler))                                              // Per-repository resources API Endpoint
+	http.HandleFunc("/blast-radius", route("/blast-radius", handlers.BlastRadiusHandler))                                                    // Dependency blast radius API Endpoint
+	http.HandleFunc("/findings", route("/findings", handlers.FindingsHandler))                                                               // Unique findings API Endpoint
+	http.HandleFunc("/vulnerabilities/overdue", route("/vulnerabilities/overdue", handlers.OverdueHandler))                                  // Overdue findings API Endpoint
+	http.HandleFunc("/vulnerabilities/{id}", route("/vulnerabilities/{id}", handlers.VulnerabilityHandler))                                  // Vulnerability detail API Endpoint
+	http.HandleFunc("/vulnerabilities/{id}/triage", auditedRoute("/vulnerabilities/{id}/triage", handlers.TriageHandler))                    // Triage state API Endpoint
+	http.HandleFunc("/vulnerabilities/{id}/comments", auditedRoute("/vulnerabilities/{id}/comments", handlers.CommentsHandler))              // Vulnerability comments API Endpoint
+	http.HandleFunc("/vulnerabilities/{id}/fields", auditedRoute("/vulnerabilities/{id}/fields", handlers.VulnerabilityFieldsHandler))       // Vulnerability custom fields API Endpoint
+	http.HandleFunc("/vulnerabilities/bulk-update", auditedRoute("/vulnerabilities/bulk-update", handlers.BulkTriageHandler))                // Bulk triage API Endpoint
+	http.HandleFunc("/policy/evaluate", route("/policy/evaluate", handlers.PolicyHandler))                                                   // CI policy gate API Endpoint
+	http.HandleFunc("/vex", auditedRoute("/vex", handlers.VEXHandler))                                                                       // OpenVEX import/export API Endpoint
+	http.HandleFunc("/import/csv", auditedRoute("/import/csv", handlers.CSVImportHandler))                                                   // Historical CSV import API Endpoint
+	http.HandleFunc("/packages/scan", auditedRoute("/packages/scan", handlers.Idempotent("/packages/scan", handlers.PackageScanHandler)))    // OSV package lookup API Endpoint
+	http.HandleFunc("/admin/reprocess", auditedAdminRoute("/admin/reprocess", handlers.ReprocessHandler))                                    // Stored file reprocessing API Endpoint
+	http.HandleFunc("/admin/severity-overrides", auditedAdminRoute("/admin/severity-overrides", handlers.SeverityOverridesHandler))          // Severity override rules API Endpoint
+	http.HandleFunc("/admin/severity-overrides/{id}", auditedAdminRoute("/admin/severity-overrides/{id}", handlers.SeverityOverrideHandler)) // Severity override rule API Endpoint
+	http.HandleFunc("/admin/repo-aliases", auditedAdminRoute("/admin/repo-aliases", handlers.RepoAliasesHandler))                            // Repository aliases API Endpoint
+	http.HandleFunc("/admin/custom-fields", auditedAdminRoute("/admin/custom-fields", handlers.CustomFieldsHandler))                         // Custom field definitions API Endpoint
+	http.HandleFunc("/admin/custom-fields/{name}", auditedAdminRoute("/admin/custom-fields/{name}", handlers.CustomFieldHandler))            // Custom field definition API Endpoint
+	http.HandleFunc("/admin/delete", auditedAdminRoute("/admin/delete", handlers.DeleteHandler))                                             // Bulk deletion API Endpoint
+	http.HandleFunc("/admin/maintenance", auditedAdminRoute("/admin/maintenance", handlers.MaintenanceHandler))                              // Database maintenance API Endpoint
+	http.HandleFunc("/admin/secrets", adminRoute("/admin/secrets", handlers.SecretsHandler))                                                 // Configured secrets API Endpoint
+	http.HandleFunc("/admin/reload", auditedAdminRoute("/admin/reload", handlers.ReloadHandler))                                             // Configuration reload API Endpoint
+	http.HandleFunc("/admin/cluster", adminRoute("/admin/cluster", handlers.ClusterHandler))                                                 // Replica leadership API Endpoint
+	http.HandleFunc("/admin/usage", adminRoute("/admin/usage", handlers.TenantUsageHandler))                                                 // Tenant quota usage API Endpoint
+	http.HandleFunc("/usage", route("/usage", handlers.UsageHandler))                                                                        // Caller's quota usage API Endpoint
+	http.HandleFunc("/audit", route("/audit", handlers.AuditHandler))                                                                        // Audit log API Endpoint
+	http.HandleFunc("/events", logging.Middleware(handlers.EventsHandler))                                                                   // Ingest event stream (SSE)
+
+	// Serve the embedded web dashboard
+	http.Handle(ui.Prefix, logging.Middleware(ui.Handler().ServeHTTP))
+
+	// Expose operational metrics for Prometheus
+	http.HandleFunc("/metrics", metrics.Handler)
+
+	// Register probe endpoints for Kubernetes and load balancers
+	http.HandleFunc("/healthz", handlers.HealthzHandler) // Process is up
+	http.HandleFunc("/livez", handlers.LivezHandler)     // Process is alive
+	http.HandleFunc("/readyz", handlers.ReadyzHandler)   // Dependencies are ready
+
+	// Reload the configuration on SIGHUP or POST /admin/reload
+	handlers.Reloader = func(context.Context) (handlers.ReloadResponse, error) { return current.reload() }
+	reloadOnSignal()
+
+	// Start HTTP server
+	slog.Info("Server starting", "addr", cfg.Addr)
+	err = http.ListenAndServe(cfg.Addr, nil)
+	slog.Error("Server stopped", "error", err)
+	return err
+}
+
+// contentFetcher returns the fetcher of report files selected by the
+// configured mode
+func contentFetcher(cfg config.Config) (handlers.ContentFetcher, error) {
+	switch cfg.GitHubFetchMode {
+	case "raw":
+		return github.DefaultFetcher, nil
+	case "api":
+		return github.DefaultClient, nil
+	}
+	return nil, fmt.Errorf("unknown GITHUB_FETCH_MODE %q (want raw or api)", cfg.GitHubFetchMode)
+}
+
+// registerGitHubMetrics exposes the GitHub API rate limit on /metrics
+func registerGitHubMetrics() {
+	rate := func(fn func(github.RateLimit) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			rl := github.DefaultClient.RateLimit()
+			if rl.Limit == 0 {
+				return nil // No API response yet
+			}
+			return []metrics.Sample{{Value: fn(rl)}}
+		}
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_github_rate_limit", Type: metrics.Gauge,
+		Help:    "GitHub API requests allowed per rate limit window",
+		Collect: rate(func(rl github.RateLimit) float64 { return float64(rl.Limit) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_github_rate_limit_remaining", Type: metrics.Gauge,
+		Help:    "GitHub API requests left in the current rate limit window",
+		Collect: rate(func(rl github.RateLimit) float64 { return float64(rl.Remaining) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_github_rate_limit_reset_timestamp_seconds", Type: metrics.Gauge,
+		Help:    "Unix time the GitHub API rate limit window resets",
+		Collect: rate(func(rl github.RateLimit) float64 { return float64(rl.Reset.Unix()) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_github_rate_limit_pauses_total", Type: metrics.Counter,
+		Help:    "GitHub API requests that waited for a rate limit reset",
+		Collect: metrics.Value(func() float64 { return float64(github.DefaultClient.RateLimit().Pauses) })})
+}
+
+// registerStatementMetrics exposes the prepared statement cache on /metrics
+func registerStatementMetrics() {
+	stat := func(fn func(storage.StatementCacheStats) float64) func() []metrics.Sample {
+		return metrics.Value(func() float64 { return fn(storage.Statements.Stats()) })
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_statement_cache_hits_total", Type: metrics.Counter,
+		Help:    "Database queries that reused a cached prepared statement",
+		Collect: stat(func(s storage.StatementCacheStats) float64 { return float64(s.Hits) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_statement_cache_misses_total", Type: metrics.Counter,
+		Help:    "Database queries that prepared a statement for the cache",
+		Collect: stat(func(s storage.StatementCacheStats) float64 { return float64(s.Misses) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_statement_cache_statements", Type: metrics.Gauge,
+		Help:    "Prepared statements in the cache",
+		Collect: stat(func(s storage.StatementCacheStats) float64 { return float64(s.Statements) })})
+}
+
+// registerIngestMetrics exposes the ingest memory budget on /metrics
+func registerIngestMetrics() {
+	metrics.Register(metrics.Metric{Name: "vulnscan_ingest_bytes_in_flight", Type: metrics.Gauge,
+		Help: "Report bytes held by ingests between fetch and store",
+		Collect: metrics.Value(func() float64 {
+			used, _ := handlers.IngestBudget.Stats()
+			return float64(used)
+		})})
+	metrics.Register(metrics.Metric{Name: "vulnscan_ingest_waiting", Type: metrics.Gauge,
+		Help: "Fetched files waiting for room in the ingest memory budget",
+		Collect: metrics.Value(func() float64 {
+			_, waiting := handlers.IngestBudget.Stats()
+			return float64(waiting)
+		})})
+}
+
+// registerSIEMMetrics exposes the SIEM outputs' event counts on /metrics
+func registerSIEMMetrics(f *siem.Forwarder) {
+	outputs := func(fn func(siem.Stats) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, s := range f.Stats() {
+				samples = append(samples, metrics.Sample{Labels: map[string]string{"output": s.Name}, Value: fn(s)})
+			}
+			return samples
+		}
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_siem_events_sent_total", Type: metrics.Counter,
+		Help:    "Finding events delivered to a SIEM output",
+		Collect: outputs(func(s siem.Stats) float64 { return float64(s.Sent) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_siem_events_dropped_total", Type: metrics.Counter,
+		Help:    "Finding events a SIEM output dropped because its queue was full or retries ran out",
+		Collect: outputs(func(s siem.Stats) float64 { return float64(s.Dropped) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_siem_events_queued", Type: metrics.Gauge,
+		Help:    "Finding events waiting to be sent to a SIEM output",
+		Collect: outputs(func(s siem.Stats) float64 { return float64(s.Queued) })})
+}
+
+// registerEventBusMetrics exposes the event bus publishers' message counts
+// on /metrics
+func registerEventBusMetrics(b *eventbus.Bus) {
+	publishers := func(fn func(eventbus.Stats) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, s := range b.Stats() {
+				samples = append(samples, metrics.Sample{Labels: map[string]string{"publisher": s.Name}, Value: fn(s)})
+			}
+			return samples
+		}
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_eventbus_messages_published_total", Type: metrics.Counter,
+		Help:    "Events accepted by an event bus publisher's broker",
+		Collect: publishers(func(s eventbus.Stats) float64 { return float64(s.Published) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_eventbus_messages_dropped_total", Type: metrics.Counter,
+		Help:    "Events an event bus publisher dropped because its queue was full or retries ran out",
+		Collect: publishers(func(s eventbus.Stats) float64 { return float64(s.Dropped) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_eventbus_messages_queued", Type: metrics.Gauge,
+		Help:    "Events waiting to be sent by an event bus publisher",
+		Collect: publishers(func(s eventbus.Stats) float64 { return float64(s.Queued) })})
+}
+
+// registerCircuitMetrics exposes the outbound circuit breakers on /metrics
+func registerCircuitMetrics() {
+	circuits := func(fn func(httpclient.Circuit) []metrics.Sample) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, c := range httpclient.Circuits() {
+				samples = append(samples, fn(c)...)
+			}
+			return samples
+		}
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_http_circuit_state", Type: metrics.Gauge,
+		Help: "Circuit breaker state of an upstream host: 1 for the current state, 0 for the others",
+		Collect: circuits(func(c httpclient.Circuit) []metrics.Sample {
+			var samples []metrics.Sample
+			for _, state := range []string{httpclient.CircuitClosed, httpclient.CircuitOpen, httpclient.CircuitHalfOpen} {
+				value := 0.0
+				if c.State == state {
+					value = 1
+				}
+				samples = append(samples, metrics.Sample{Labels: map[string]string{"host": c.Host, "state": state}, Value: value})
+			}
+			return samples
+		})})
+	metrics.Register(metrics.Metric{Name: "vulnscan_http_circuit_failures", Type: metrics.Gauge,
+		Help: "Consecutive upstream failures of a host",
+		Collect: circuits(func(c httpclient.Circuit) []metrics.Sample {
+			return []metrics.Sample{{Labels: map[string]string{"host": c.Host}, Value: float64(c.Failures)}}
+		})})
+	metrics.Register(metrics.Metric{Name: "vulnscan_http_circuit_opens_total", Type: metrics.Counter,
+		Help: "Times a host's circuit breaker opened",
+		Collect: circuits(func(c httpclient.Circuit) []metrics.Sample {
+			return []metrics.Sample{{Labels: map[string]string{"host": c.Host}, Value: float64(c.Opens)}}
+		})})
+}
+
+// registerMaintenanceMetrics exposes the database size and the latest
+// maintenance run on /metrics
+func registerMaintenanceMetrics() {
+	size := func(fn func(size, free int64) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			size, free, err := storage.DatabaseSize(context.Background(), storage.DB)
+			if err != nil {
+				return nil
+			}
+			return []metrics.Sample{{Value: fn(size, free)}}
+		}
+	}
+	last := func(fn func(models.MaintenanceResult) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			res, ok := storage.LastMaintenance()
+			if !ok {
+				return nil // No run yet
+			}
+			return []metrics.Sample{{Value: fn(res)}}
+		}
+	}
+	flag := func(ok bool) float64 {
+		if ok {
+			return 1
+		}
+		return 0
+	}
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_size_bytes", Type: metrics.Gauge,
+		Help:    "Size of the database file",
+		Collect: size(func(size, _ int64) float64 { return float64(size) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_free_bytes", Type: metrics.Gauge,
+		Help:    "Unused space in the database file that a vacuum can release",
+		Collect: size(func(_, free int64) float64 { return float64(free) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_maintenance_last_run_timestamp_seconds", Type: metrics.Gauge,
+		Help:    "Unix time the latest database maintenance run started",
+		Collect: last(func(r models.MaintenanceResult) float64 { return float64(r.StartedAt.Unix()) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_maintenance_duration_seconds", Type: metrics.Gauge,
+		Help: "Duration of the latest database maintenance run",
+		Collect: last(func(r models.MaintenanceResult) float64 {
+			d, _ := time.ParseDuration(r.Duration)
+			return d.Seconds()
+		})})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_maintenance_success", Type: metrics.Gauge,
+		Help:    "Whether every step of the latest database maintenance run completed: 1 or 0",
+		Collect: last(func(r models.MaintenanceResult) float64 { return flag(r.Error == "") })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_maintenance_vacuumed_pages", Type: metrics.Gauge,
+		Help:    "Free pages the latest database maintenance run released to the filesystem",
+		Collect: last(func(r models.MaintenanceResult) float64 { return float64(r.VacuumedPages) })})
+	metrics.Register(metrics.Metric{Name: "vulnscan_db_integrity_ok", Type: metrics.Gauge,
+		Help: "Whether the latest integrity check found no problems: 1 or 0",
+		Collect: func() []metrics.Sample {
+			res, ok := storage.LastMaintenance()
+			if !ok || len(res.Integrity) == 0 {
+				return nil // The check hasn't run
+			}
+			return []metrics.Sample{{Value: flag(res.IntegrityOK())}}
+		}})
+}
+
+// registerClusterMetrics exposes this replica's leadership on /metrics
+func registerClusterMetrics() {
+	metrics.Register(metrics.Metric{Name: "vulnscan_cluster_leader", Type: metrics.Gauge,
+		Help: "Whether this replica leads the replicas sharing the database: 1 or 0",
+		Collect: metrics.Value(func() float64 {
+			if cluster.Default.IsLeader() {
+				return 1
+			}
+			return 0
+		})})
+}
+
+// resolveSecrets replaces the secret references of integration
+// credentials in cfg with their values
+func resolveSecrets(ctx context.Context, cfg *config.Config) error {
+	if err := configureVault(ctx, *cfg); err != nil {
+		return err
+	}
+	for _, s := range []struct {
+		name  string
+		value *string
+	}{
+		{"GITHUB_TOKEN", &cfg.GitHubToken},
+		{"NVD_API_KEY", &cfg.NVDAPIKey},
+		{"JIRA_API_TOKEN", &cfg.JiraToken},
+		{"DTRACK_API_KEY", &cfg.DTrackAPIKey},
+		{"ADMIN_API_KEY", &cfg.AdminAPIKey},
+	} {
+		value, err := secrets.Default.Resolve(ctx, s.name, *s.value)
+		if err != nil {
+			return err
+		}
+		*s.value = value
+	}
+	return nil
+}
+
+// configureVault points vault: secret references at VAULT_ADDR
+func configureVault(ctx context.Context, cfg config.Config) error {
+	if cfg.VaultAddr == "" {
+		return nil
+	}
+	token, err := secrets.Default.Resolve(ctx, "VAULT_TOKEN", cfg.VaultToken)
+	if err != nil {
+		return err
+	}
+	secrets.Default.Vault = secrets.Vault{Addr: cfg.VaultAddr, Token: token, Client: httpclient.New(cfg.HTTPTimeout)}
+	return nil
+}
+
+// configureDTrack uploads the components of ingested SBOMs to the push
+// projects of DTRACK_CONFIG, and schedules pulls of its pull projects'
+// findings, ingested through scanner
+func configureDTrack(cfg config.Config, scanner *handlers.Scanner) error {
+	if cfg.DTrackConfig == "" {
+		return errors.New("DTRACK_CONFIG is required with DTRACK_URL")
+	}
+	dc, err := dtrack.LoadConfig(cfg.DTrackConfig)
+	if err != nil {
+		return err
+	}
+	dtrack.DefaultClient = dtrack.NewClient(cfg.DTrackURL, cfg.DTrackAPIKey, dc.Projects)
+	handlers.IngestPipeline.Add(pipeline.Persist, dtrack.DefaultClient.Push)
+	if cfg.DTrackSyncInterval > 0 {
+		jobs.Default.Add(jobs.Job{
+			Name:     "dtrack-pull",
+			Interval: cfg.DTrackSyncInterval,
+			Run: func(ctx context.Context) error {
+				n, err := dtrack.DefaultClient.Pull(ctx, func(ctx context.Context, repo, file string, content []byte) error {
+					resp := scanner.IngestArchive(ctx, repo, []archive.File{{Name: file, Content: content}}, nil)
+					if len(resp.Failed) > 0 {
+						return errors.New(resp.Failed[0].Error)
+					}
+					return nil
+				})
+				slog.Info("Dependency-Track pull completed", "projects", n)
+				return err
+			},
+		})
+	}
+	return nil
+}
+
+// configurePushgateway pushes a summary of each scan the scanner runs to
+// the Pushgateway: the repository's open findings by severity and the
+// scan's file outcomes. A failed push is logged; the scan is unaffected.
+func configurePushgateway(cfg config.Config, scanner *handlers.Scanner) error {
+	client, err := pushgateway.New(cfg.PushgatewayURL, cfg.PushgatewayJob)
+	if err != nil {
+		return err
+	}
+	scanner.AddHook(func(ctx context.Context, req handlers.ScanRequest, resp handlers.ScanResponse) {
+		// Image findings belong to the given repository, or to the image itself
+		repo := req.Repo
+		if repo == "" {
+			repo = req.Image
+		}
+		counts, err := storage.OpenFindingCounts(ctx, storage.Reader(ctx), repo)
+		if err == nil {
+			err = client.Push(ctx, pushgateway.Summary{
+				Repo: repo, Ref: req.Ref, Status: resp.Status, BySeverity: counts,
+				Succeeded: len(resp.Success), Failed: len(resp.Failed), Skipped: len(resp.Skipped), Time: time.Now(),
+			})
+		}
+		if err != nil {
+			slog.Warn("Pushgateway push failed", "repo", repo, "ref", req.Ref, "error", err)
+		}
+	})
+	return nil
+}
+
+// configureOSV applies the OSV endpoint, rate limit, and cache settings
+func configureOSV(cfg config.Config) {
+	osv.DefaultClient.BaseURL = cfg.OSVURL
+	if cfg.OSVRateLimit > 0 {
+		osv.DefaultClient.Limiter = rate.NewLimiter(rate.Limit(cfg.OSVRateLimit), cfg.OSVRateLimit)
+	} else {
+		osv.DefaultClient.Limiter = nil
+	}
+	osv.DefaultClient.Cache = osv.NewCache(cfg.OSVCacheTTL)
+}
+
+// setupLogging installs the configured structured logger as the default
+func setupLogging(cfg config.Config) error {
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// newLogger builds the configured structured logger
+func newLogger(cfg config.Config) (*slog.Logger, error) {
+	return logging.New(os.Stderr, logging.Options{
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		Initial:    cfg.LogSampleInitial,
+		Thereafter: cfg.LogSampleThereafter,
+	})
+}
+
+// route wraps an API handler with tracing and request-scoped logging
+func route(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	return telemetry.Middleware(pattern, logging.Middleware(quota.Middleware(h)))
+}
+
+// auditedRoute is route for endpoints that change state, recording their
+// mutating requests in the audit log
+func auditedRoute(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	return route(pattern, handlers.Audit(pattern, h))
+}
+
+// adminRoute is route for administrative endpoints, which only serve
+// requests carrying the admin API key
+func adminRoute(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	return route(pattern, handlers.AdminOnly(h))
+}
+
+// auditedAdminRoute is auditedRoute for administrative endpoints
+func auditedAdminRoute(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	return adminRoute(pattern, handlers.Audit(pattern, h))
+}
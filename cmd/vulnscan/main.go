@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	"github.com/Chinzzii/vulnscan/cmd"
+)
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
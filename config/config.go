@@ -0,0 +1,354 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/sla"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Config holds runtime settings for the service, read from the environment
+// and an optional settings file
+type Config struct {
+	File string // Path of a KEY=VALUE settings file overriding the environment, re-read on reload
+
+	Addr      string // HTTP listen address
+	LogLevel  string // Minimum log level (debug, info, warn, error)
+	LogFormat string // Log output format (json or text)
+
+	LogSampleInitial    int // Identical log messages emitted per second before sampling
+	LogSampleThereafter int // After the initial burst, emit every Nth identical message
+
+	DatabaseDSN     string // SQLite data source name of the database
+	DatabaseReadDSN string // Optional SQLite data source name read-only queries use instead
+	StatementCache  int    // Prepared statements kept per process (0 disables caching)
+
+	ClusterMode    string        // Whether replicas share the database: single or shared
+	LeaderLeaseTTL time.Duration // How long a replica leads without renewing its lease, in shared mode
+
+	DBMaintenanceInterval time.Duration // Interval between database maintenance runs (0 disables)
+	DBVacuumPages         int           // Free pages each maintenance run releases at most (0 for all)
+
+	OSVURL             string        // OSV API base URL used to correlate SBOM components
+	OSVRateLimit       int           // Maximum OSV API requests per second
+	OSVCacheTTL        time.Duration // How long OSV responses are cached
+	OSVRefreshInterval time.Duration // Interval between OSV refreshes of stored components (0 disables)
+
+	NVDURL            string        // NVD API base URL used for CVE enrichment
+	NVDAPIKey         string        // Optional NVD API key, raising the rate limit
+	NVDEnrichInterval time.Duration // Interval between NVD enrichment runs (0 disables)
+	NVDCacheTTL       time.Duration // How long stored NVD records are considered fresh
+
+	EPSSFeedURL      string        // EPSS CSV feed location
+	EPSSSyncInterval time.Duration // Interval between EPSS feed imports (0 disables)
+
+	KEVFeedURL      string        // CISA KEV catalog location
+	KEVSyncInterval time.Duration // Interval between KEV catalog imports (0 disables)
+
+	GitHubAPIURL        string        // GitHub REST API base URL
+	GitHubToken         string        // Optional GitHub token, raising the rate limit
+	GitHubFetchMode     string        // How report files are fetched: "raw" or "api"
+	GitHubRawHosts      []string      // Repository hosts raw files may be fetched from, as host=raw content URL
+	GitHubRateReserve   int           // API requests left below which requests wait for the rate limit reset
+	GitHubBranchTTL     time.Duration // How long looked-up default branches are cached (0 disables the cache)
+	OrgScanPatterns     []string      // Default file patterns of organization scans
+	ScanRepoAllow       []string      // Repository patterns that can be scanned (empty allows any)
+	ScanRepoDeny        []string      // Repository patterns that can't be scanned
+	GHSAResolveInterval time.Duration // Interval between GHSA/CVE alias resolution runs (0 disables)
+	GHSACacheTTL        time.Duration // How long resolved aliases are considered fresh
+
+	SLAPolicy sla.Policy // Remediation days allowed per severity
+
+	JiraURL          string        // Jira site URL (empty disables the integration)
+	JiraEmail        string        // Jira account email for basic auth
+	JiraToken        string        // Jira API token or personal access token
+	JiraProject      string        // Project key issues are created in
+	JiraIssueType    string        // Issue type of created issues
+	JiraLabels       []string      // Labels applied to created issues
+	JiraSeverities   []string      // Finding severities that get an issue
+	JiraSyncInterval time.Duration // Interval between Jira syncs (0 disables)
+
+	DTrackURL          string        // Dependency-Track server URL (empty disables the integration)
+	DTrackAPIKey       string        // Dependency-Track API key
+	DTrackConfig       string        // Path to the Dependency-Track projects file
+	DTrackSyncInterval time.Duration // Interval between pulls of Dependency-Track findings (0 disables)
+
+	QuotaConfig string // Path to the tenant quotas file (empty disables quotas)
+
+	AdminAPIKey string // API key /admin endpoints require (empty refuses every request to them)
+
+	NotifyConfig         string        // Path to the notification channels file (empty disables)
+	NotifyDigestInterval time.Duration // Interval between notification digests (0 disables)
+	NotifyFetchFailures  int           // Consecutive fetch failures of a repository before an alert (0 disables)
+	NotifyScanStuckAfter time.Duration // Running time of a bulk scan before an alert (0 disables)
+	PublicURL            string        // Externally reachable server URL, linked from scheduled reports
+
+	SIEMConfig     string // Path to the SIEM outputs file (empty disables forwarding)
+	EventBusConfig string // Path to the Kafka and NATS publishers file (empty disables publishing)
+
+	PushgatewayURL string // Prometheus Pushgateway scan summaries are pushed to (empty disables)
+	PushgatewayJob string // Job grouping label of pushed scan summaries
+
+	PolicyFile string // Path to the CI gate policies file (empty uses the default policy only)
+
+	LicenseDeny     []string // License patterns recorded as violations at ingest (empty disables)
+	LicenseSeverity string   // Severity of license violation findings
+
+	RawFileStore string // How ingested files are kept for reprocessing: gzip, identity, or off
+	ParseMode    string // Default handling of malformed vulnerability entries: strict or lenient
+	DedupKey     string // Default key merging query results: cve+purl, cve+package, or off
+	QueryMaxRows int    // Results of a query without its own limit (0 disables)
+
+	EncryptionKey        string // Base64-encoded AES-256 key encrypting stored files and backups
+	EncryptionKeyFile    string // Path of a file holding the encryption key
+	EncryptionKeyCommand string // Shell command printing the encryption key, e.g. a KMS decrypt call
+
+	VaultAddr  string // Vault server URL that vault: secret references are read from
+	VaultToken string // Token authenticating Vault reads
+
+	ScanFileConcurrency    int // Files of a scan fetched at a time
+	ScanPersistConcurrency int // Fetched files of a scan decoded and stored at a time
+	IngestMemoryLimitMB    int // Report content held by ingests at a time, in MiB (0 disables)
+	BulkScanConcurrency    int // Repositories of a bulk scan scanned at a time, unless the request sets its own
+
+	IdempotencyTTL   time.Duration // How long responses to requests with an Idempotency-Key are replayed
+	ScanFailedStatus int           // HTTP status code of a scan in which every file failed
+	ScanTimeout      time.Duration // Default bound on a whole scan (0 disables it)
+	ScanFileTimeout  time.Duration // Default bound on fetching and ingesting one file (0 disables it)
+
+	IncompleteScanAction   string   // Handling of reports whose scanner run was incomplete: flag or skip
+	IncompleteScanStatuses []string // Scanner-reported statuses that mark a run incomplete
+
+	ImageScanner     string        // Trivy executable used for container image scans
+	ImageScanTimeout time.Duration // Maximum duration of one image scan, including the pull
+
+	HTTPTimeout         time.Duration // Wait for response headers of outbound requests, per attempt
+	HTTPMaxRetries      int           // Retries of failed outbound requests
+	HTTPRetryBackoff    time.Duration // Delay before the first retry, doubling after each
+	HTTPRetryMaxBackoff time.Duration // Longest retry delay, including Retry-After
+	HTTPCABundle        string        // PEM file of extra trusted CA certificates (empty uses the system's only)
+	HTTPBreakerFailures int           // Consecutive upstream failures that open a host's circuit breaker (0 disables it)
+	HTTPBreakerCooldown time.Duration // How long an open circuit breaker fails requests before probing the host
+	HTTPAllowedNetworks []string      // Private CIDR ranges repository and archive downloads may still reach
+
+	values map[string]string // Raw value of each setting read, by key
+}
+
+// Load reads the configuration from environment variables and the
+// settings file CONFIG_FILE names, applying defaults
+func Load() (Config, error) {
+	path := os.Getenv("CONFIG_FILE")
+	s, err := readSettings(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		File:                   path,
+		Addr:                   s.get("VULNSCAN_ADDR", ":8080"),
+		LogLevel:               s.get("LOG_LEVEL", "info"),
+		LogFormat:              s.get("LOG_FORMAT", "json"),
+		LogSampleInitial:       s.getInt("LOG_SAMPLE_INITIAL", 10),
+		LogSampleThereafter:    s.getInt("LOG_SAMPLE_THEREAFTER", 100),
+		DatabaseDSN:            s.get("DATABASE_DSN", storage.DefaultDSN),
+		DatabaseReadDSN:        s.get("DATABASE_READ_DSN", ""),
+		StatementCache:         s.getInt("STATEMENT_CACHE_SIZE", storage.DefaultStatementCacheSize),
+		ClusterMode:            s.get("CLUSTER_MODE", "single"),
+		LeaderLeaseTTL:         s.getDuration("LEADER_LEASE_TTL", 30*time.Second),
+		DBMaintenanceInterval:  s.getDuration("DB_MAINTENANCE_INTERVAL", 24*time.Hour),
+		DBVacuumPages:          s.getInt("DB_VACUUM_PAGES", 0),
+		OSVURL:                 s.get("OSV_API_URL", "https://api.osv.dev"),
+		OSVRateLimit:           s.getInt("OSV_RATE_LIMIT", 10),
+		OSVCacheTTL:            s.getDuration("OSV_CACHE_TTL", 6*time.Hour),
+		OSVRefreshInterval:     s.getDuration("OSV_REFRESH_INTERVAL", 24*time.Hour),
+		NVDURL:                 s.get("NVD_API_URL", "https://services.nvd.nist.gov"),
+		NVDAPIKey:              s.get("NVD_API_KEY", ""),
+		NVDEnrichInterval:      s.getDuration("NVD_ENRICH_INTERVAL", time.Hour),
+		NVDCacheTTL:            s.getDuration("NVD_CACHE_TTL", 7*24*time.Hour),
+		EPSSFeedURL:            s.get("EPSS_FEED_URL", "https://epss.cyentia.com/epss_scores-current.csv.gz"),
+		EPSSSyncInterval:       s.getDuration("EPSS_SYNC_INTERVAL", 24*time.Hour),
+		KEVFeedURL:             s.get("KEV_FEED_URL", "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"),
+		KEVSyncInterval:        s.getDuration("KEV_SYNC_INTERVAL", 24*time.Hour),
+		GitHubAPIURL:           s.get("GITHUB_API_URL", "https://api.github.com"),
+		GitHubToken:            s.get("GITHUB_TOKEN", ""),
+		GitHubFetchMode:        s.get("GITHUB_FETCH_MODE", "raw"),
+		GitHubRawHosts:         s.getList("GITHUB_RAW_HOSTS", []string{"github.com=https://raw.githubusercontent.com"}),
+		GitHubRateReserve:      s.getInt("GITHUB_RATE_LIMIT_RESERVE", 10),
+		GitHubBranchTTL:        s.getDuration("GITHUB_BRANCH_TTL", time.Hour),
+		OrgScanPatterns:        s.getList("ORG_SCAN_PATTERNS", nil),
+		ScanRepoAllow:          s.getList("SCAN_REPO_ALLOW", nil),
+		ScanRepoDeny:           s.getList("SCAN_REPO_DENY", nil),
+		GHSAResolveInterval:    s.getDuration("GHSA_RESOLVE_INTERVAL", time.Hour),
+		GHSACacheTTL:           s.getDuration("GHSA_CACHE_TTL", 7*24*time.Hour),
+		SLAPolicy:              s.getSLA("SLA_DAYS", sla.Default),
+		JiraURL:                s.get("JIRA_URL", ""),
+		JiraEmail:              s.get("JIRA_EMAIL", ""),
+		JiraToken:              s.get("JIRA_API_TOKEN", ""),
+		JiraProject:            s.get("JIRA_PROJECT", ""),
+		JiraIssueType:          s.get("JIRA_ISSUE_TYPE", "Bug"),
+		JiraLabels:             s.getList("JIRA_LABELS", []string{"vulnscan"}),
+		JiraSeverities:         s.getList("JIRA_SEVERITIES", []string{"CRITICAL", "HIGH"}),
+		JiraSyncInterval:       s.getDuration("JIRA_SYNC_INTERVAL", 15*time.Minute),
+		DTrackURL:              s.get("DTRACK_URL", ""),
+		DTrackAPIKey:           s.get("DTRACK_API_KEY", ""),
+		DTrackConfig:           s.get("DTRACK_CONFIG", ""),
+		DTrackSyncInterval:     s.getDuration("DTRACK_SYNC_INTERVAL", time.Hour),
+		QuotaConfig:            s.get("QUOTA_CONFIG", ""),
+		AdminAPIKey:            s.get("ADMIN_API_KEY", ""),
+		NotifyConfig:           s.get("NOTIFY_CONFIG", ""),
+		NotifyDigestInterval:   s.getDuration("NOTIFY_DIGEST_INTERVAL", 24*time.Hour),
+		NotifyFetchFailures:    s.getInt("NOTIFY_FETCH_FAILURES", 3),
+		NotifyScanStuckAfter:   s.getDuration("NOTIFY_SCAN_STUCK_AFTER", 30*time.Minute),
+		PublicURL:              s.get("PUBLIC_URL", ""),
+		SIEMConfig:             s.get("SIEM_CONFIG", ""),
+		EventBusConfig:         s.get("EVENTBUS_CONFIG", ""),
+		PushgatewayURL:         s.get("PUSHGATEWAY_URL", ""),
+		PushgatewayJob:         s.get("PUSHGATEWAY_JOB", "vulnscan"),
+		PolicyFile:             s.get("POLICY_FILE", ""),
+		LicenseDeny:            s.getList("LICENSE_DENY", nil),
+		LicenseSeverity:        s.get("LICENSE_SEVERITY", "HIGH"),
+		RawFileStore:           s.get("RAW_FILE_STORE", "gzip"),
+		EncryptionKey:          s.get("ENCRYPTION_KEY", ""),
+		EncryptionKeyFile:      s.get("ENCRYPTION_KEY_FILE", ""),
+		EncryptionKeyCommand:   s.get("ENCRYPTION_KEY_COMMAND", ""),
+		VaultAddr:              s.get("VAULT_ADDR", ""),
+		VaultToken:             s.get("VAULT_TOKEN", ""),
+		ParseMode:              s.get("PARSE_MODE", "strict"),
+		DedupKey:               s.get("DEDUP_KEY", "cve+purl"),
+		QueryMaxRows:           s.getInt("QUERY_MAX_ROWS", 10000),
+		ScanFileConcurrency:    s.getInt("SCAN_FILE_CONCURRENCY", 3),
+		ScanPersistConcurrency: s.getInt("SCAN_PERSIST_CONCURRENCY", 2),
+		IngestMemoryLimitMB:    s.getInt("INGEST_MEMORY_LIMIT_MB", 512),
+		BulkScanConcurrency:    s.getInt("BULK_SCAN_CONCURRENCY", 4),
+		IdempotencyTTL:         s.getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		ScanFailedStatus:       s.getInt("SCAN_FAILED_STATUS", 422),
+		ScanTimeout:            s.getDuration("SCAN_TIMEOUT", 10*time.Minute),
+		ScanFileTimeout:        s.getDuration("SCAN_FILE_TIMEOUT", 2*time.Minute),
+		IncompleteScanAction:   s.get("INCOMPLETE_SCAN_ACTION", "flag"),
+		IncompleteScanStatuses: s.getList("INCOMPLETE_SCAN_STATUSES", []string{"failed", "partial"}),
+		ImageScanner:           s.get("IMAGE_SCANNER", "trivy"),
+		ImageScanTimeout:       s.getDuration("IMAGE_SCAN_TIMEOUT", 10*time.Minute),
+		HTTPTimeout:            s.getDuration("HTTP_TIMEOUT", 30*time.Second),
+		HTTPMaxRetries:         s.getInt("HTTP_MAX_RETRIES", 3),
+		HTTPRetryBackoff:       s.getDuration("HTTP_RETRY_BACKOFF", 500*time.Millisecond),
+		HTTPRetryMaxBackoff:    s.getDuration("HTTP_RETRY_MAX_BACKOFF", 30*time.Second),
+		HTTPCABundle:           s.get("HTTP_CA_BUNDLE", ""),
+		HTTPBreakerFailures:    s.getInt("HTTP_BREAKER_FAILURES", 5),
+		HTTPBreakerCooldown:    s.getDuration("HTTP_BREAKER_COOLDOWN", 30*time.Second),
+		HTTPAllowedNetworks:    s.getList("HTTP_ALLOWED_NETWORKS", nil),
+	}
+	cfg.values = s.values
+	return cfg, nil
+}
+
+// Changed returns the keys of the settings whose values differ between two
+// loaded configurations, sorted
+func Changed(old, cfg Config) []string {
+	var keys []string
+	for key, value := range cfg.values {
+		if old.values[key] != value {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settings holds the values of a settings file, which take precedence
+// over the environment, and records the values read
+type settings struct {
+	file   map[string]string
+	values map[string]string
+}
+
+// readSettings parses a settings file of KEY=VALUE lines; blank lines and
+// lines starting with # are ignored. An empty path has no settings.
+func readSettings(path string) (settings, error) {
+	s := settings{file: map[string]string{}, values: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("config: %v", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return s, fmt.Errorf("config: %s:%d: want KEY=VALUE", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		s.file[key] = value
+	}
+	return s, nil
+}
+
+// lookup returns the value of key in the settings file or the environment
+func (s settings) lookup(key string) string {
+	v, ok := s.file[key]
+	if !ok {
+		v = os.Getenv(key)
+	}
+	s.values[key] = v
+	return v
+}
+
+// get returns the value of key, or def when unset
+func (s settings) get(key, def string) string {
+	if v := s.lookup(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getInt returns the integer value of key, or def when unset or invalid
+func (s settings) getInt(key string, def int) int {
+	v, err := strconv.Atoi(s.lookup(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getDuration returns the duration value of key, or def when unset or invalid
+func (s settings) getDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s.lookup(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// getList returns the comma-separated values of key, or def when unset
+func (s settings) getList(key string, def []string) []string {
+	var list []string
+	for _, v := range strings.Split(s.lookup(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	if len(list) == 0 {
+		return def
+	}
+	return list
+}
+
+// getSLA returns the SLA policy in key, or def when unset or invalid
+func (s settings) getSLA(key string, def sla.Policy) sla.Policy {
+	p, err := sla.Parse(s.lookup(key))
+	if err != nil || len(p) == 0 {
+		return def
+	}
+	return p
+}
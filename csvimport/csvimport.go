@@ -0,0 +1,253 @@
+// Package csvimport reads historical findings from CSV files, such as
+// spreadsheets or other trackers' exports, mapping their columns onto
+// finding fields.
+package csvimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Fields lists the finding fields a column can map to. Columns are matched
+// to them by name, ignoring case and with spaces read as underscores, or by
+// the header vulnscan's own CSV export gives them.
+var Fields = []string{
+	"repo", "id", "severity", "cvss", "status", "package_name", "current_version", "fixed_version",
+	"description", "published_date", "link", "ecosystem", "purl", "location",
+	"first_seen", "last_seen", "triage_status", "assignee",
+}
+
+// aliases are other names of fields, as other trackers call them
+var aliases = map[string]string{
+	"cve_id":    "id",
+	"cve":       "id",
+	"package":   "package_name",
+	"version":   "current_version",
+	"published": "published_date",
+}
+
+// dateLayouts are the layouts dates are parsed with, in order
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// maxErrors bounds the errors a Parse error lists
+const maxErrors = 20
+
+// Row is one finding read from a CSV file
+type Row struct {
+	Line          int                  // Line of the row in the file
+	Repo          string               // Repository the finding was seen in
+	Vulnerability models.Vulnerability // Finding, with its triage status and assignee
+	FirstSeen     time.Time            // When the finding was first seen
+	LastSeen      time.Time            // When the finding was last seen
+}
+
+// Error lists the problems found in a CSV file, by line
+type Error struct {
+	Problems []string
+}
+
+// Error joins the problems, at most maxErrors of them
+func (e *Error) Error() string {
+	msg := strings.Join(e.Problems[:min(len(e.Problems), maxErrors)], "; ")
+	if n := len(e.Problems) - maxErrors; n > 0 {
+		msg += fmt.Sprintf("; and %d more", n)
+	}
+	return msg
+}
+
+// Options control how a CSV file is read
+type Options struct {
+	Mapping map[string]string // Field each column header maps to, overriding the matching by name
+	Repo    string            // Repository of rows without one
+	Now     time.Time         // Last sighting of rows without one
+}
+
+// Parse reads the findings of a CSV file with a header row. A file without
+// findings or an id or package_name column, or a row without a repository, ID, or
+// package, with an invalid number or date, or first seen after it was last
+// seen, fails the whole file with an *Error. Columns mapping to no field
+// are ignored.
+func Parse(r io.Reader, opts Options) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &Error{Problems: []string{"empty file"}}
+	}
+	if err != nil {
+		return nil, &Error{Problems: []string{err.Error()}}
+	}
+	columns, err := mapColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	var problems []string
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, &Error{Problems: append(problems, err.Error())}
+		}
+		line, _ := cr.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+		values := map[string]string{}
+		for i, field := range columns {
+			if field != "" && i < len(record) {
+				values[field] = strings.TrimSpace(record[i])
+			}
+		}
+		row, err := parseRow(values, opts)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	if len(rows) == 0 {
+		return nil, &Error{Problems: []string{"no findings"}}
+	}
+	return rows, nil
+}
+
+// mapColumns returns the field each column maps to, "" for none
+func mapColumns(header []string, mapping map[string]string) ([]string, error) {
+	byName := map[string]string{}
+	for _, f := range Fields {
+		byName[f] = f
+	}
+	for alias, f := range aliases {
+		byName[alias] = f
+	}
+	for _, c := range export.Columns {
+		if slices.Contains(Fields, c.Name) {
+			byName[fieldName(c.Header)] = c.Name
+		}
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		field, ok := mapping[strings.TrimSpace(h)]
+		if ok && field != "" && !slices.Contains(Fields, field) {
+			return nil, &Error{Problems: []string{fmt.Sprintf("column %q maps to unknown field %q", h, field)}}
+		}
+		if !ok {
+			field = byName[fieldName(h)]
+		}
+		if field == "" {
+			continue
+		}
+		if seen[field] {
+			return nil, &Error{Problems: []string{fmt.Sprintf("more than one column maps to %s", field)}}
+		}
+		seen[field], columns[i] = true, field
+	}
+	for _, required := range []string{"id", "package_name"} {
+		if !seen[required] {
+			return nil, &Error{Problems: []string{"no column maps to " + required}}
+		}
+	}
+	return columns, nil
+}
+
+// fieldName folds a header to the form of a field name
+func fieldName(header string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))), " ", "_")
+}
+
+// isBlank reports whether every cell of a record is empty
+func isBlank(record []string) bool {
+	return !slices.ContainsFunc(record, func(v string) bool { return strings.TrimSpace(v) != "" })
+}
+
+// parseRow converts the values of a row's fields into a finding
+func parseRow(values map[string]string, opts Options) (Row, error) {
+	row := Row{Repo: values["repo"]}
+	if row.Repo == "" {
+		row.Repo = opts.Repo
+	}
+	v := models.Vulnerability{
+		CVEID:          values["id"],
+		Severity:       strings.ToUpper(values["severity"]),
+		Status:         values["status"],
+		PackageName:    values["package_name"],
+		CurrentVersion: values["current_version"],
+		FixedVersion:   values["fixed_version"],
+		Description:    values["description"],
+		Link:           values["link"],
+		Ecosystem:      values["ecosystem"],
+		PURL:           values["purl"],
+		Location:       values["location"],
+		TriageStatus:   strings.ToLower(values["triage_status"]),
+		Assignee:       values["assignee"],
+		RiskFactors:    models.RiskFactors{},
+	}
+	switch {
+	case row.Repo == "":
+		return row, errors.New("repo is required")
+	case v.CVEID == "":
+		return row, errors.New("id is required")
+	case v.PackageName == "":
+		return row, errors.New("package_name is required")
+	}
+	if v.Severity == "" {
+		v.Severity = "UNKNOWN"
+	}
+	if s := values["cvss"]; s != "" {
+		cvss, err := strconv.ParseFloat(s, 64)
+		if err != nil || cvss < 0 || cvss > 10 {
+			return row, fmt.Errorf("invalid cvss %q", s)
+		}
+		v.CVSS = cvss
+	}
+
+	var err error
+	if v.PublishedDate, err = parseDate("published_date", values["published_date"], time.Time{}); err != nil {
+		return row, err
+	}
+	if row.LastSeen, err = parseDate("last_seen", values["last_seen"], opts.Now); err != nil {
+		return row, err
+	}
+	if row.FirstSeen, err = parseDate("first_seen", values["first_seen"], row.LastSeen); err != nil {
+		return row, err
+	}
+	if row.FirstSeen.After(row.LastSeen) {
+		return row, errors.New("first_seen is after last_seen")
+	}
+	row.Vulnerability = v
+	return row, nil
+}
+
+// parseDate parses a date in any of dateLayouts, read as UTC when it has
+// no zone, returning def for an empty one
+func parseDate(field, s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q", field, s)
+}
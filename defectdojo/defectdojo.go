@@ -0,0 +1,185 @@
+// Package defectdojo reads and writes DefectDojo's Generic Findings Import
+// JSON (https://docs.defectdojo.com), so findings can move between
+// DefectDojo and vulnscan in either direction.
+package defectdojo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// MediaType is the Accept value that selects DefectDojo output
+const MediaType = "application/vnd.defectdojo+json"
+
+// dateLayout is the layout of DefectDojo's dates
+const dateLayout = "2006-01-02"
+
+// Report is a Generic Findings Import document
+type Report struct {
+	Findings []Finding `json:"findings"`
+}
+
+// Finding is one finding of a Generic Findings Import document. Its boolean
+// flags carry the finding's triage state.
+type Finding struct {
+	Title                     string            `json:"title"`
+	Description               string            `json:"description"`
+	Severity                  string            `json:"severity"`
+	Date                      string            `json:"date,omitempty"`
+	PublishDate               string            `json:"publish_date,omitempty"`
+	CVSSv3Score               *float64          `json:"cvssv3_score,omitempty"`
+	Mitigation                string            `json:"mitigation,omitempty"`
+	References                string            `json:"references,omitempty"`
+	FilePath                  string            `json:"file_path,omitempty"`
+	ComponentName             string            `json:"component_name,omitempty"`
+	ComponentVersion          string            `json:"component_version,omitempty"`
+	PlannedRemediationVersion string            `json:"planned_remediation_version,omitempty"`
+	Active                    *bool             `json:"active,omitempty"` // DefectDojo defaults it to true
+	Verified                  bool              `json:"verified"`
+	FalseP                    bool              `json:"false_p"`
+	RiskAccepted              bool              `json:"risk_accepted"`
+	IsMitigated               bool              `json:"is_mitigated"`
+	StaticFinding             bool              `json:"static_finding,omitempty"`
+	UniqueIDFromTool          string            `json:"unique_id_from_tool,omitempty"`
+	VulnIDFromTool            string            `json:"vuln_id_from_tool,omitempty"`
+	CVE                       string            `json:"cve,omitempty"` // Older documents' single vulnerability ID
+	VulnerabilityIDs          []VulnerabilityID `json:"vulnerability_ids,omitempty"`
+}
+
+// VulnerabilityID is one identifier of a finding's vulnerability
+type VulnerabilityID struct {
+	VulnerabilityID string `json:"vulnerability_id"`
+}
+
+// Triage statuses, as vulnscan names them, that DefectDojo's flags map to
+const (
+	triageAcknowledged  = "acknowledged"
+	triageFalsePositive = "false_positive"
+	triageWontFix       = "wont_fix"
+	triageResolved      = "resolved"
+)
+
+// severities maps vulnscan severities to DefectDojo's; others are Info
+var severities = map[string]string{
+	"CRITICAL": "Critical",
+	"HIGH":     "High",
+	"MEDIUM":   "Medium",
+	"LOW":      "Low",
+}
+
+// Export converts query results into a Generic Findings Import document.
+// Each finding's fingerprint becomes its unique_id_from_tool, so DefectDojo
+// deduplicates reimports the way vulnscan does.
+func Export(vulns []models.Vulnerability) Report {
+	report := Report{Findings: make([]Finding, 0, len(vulns))}
+	for _, v := range vulns {
+		severity := v.EffectiveSeverity
+		if severity == "" {
+			severity = v.Severity
+		}
+		f := Finding{
+			Title:                     strings.TrimSpace(v.CVEID + " in " + v.PackageName + " " + v.CurrentVersion),
+			Description:               v.Description,
+			Severity:                  exportSeverity(severity),
+			References:                v.Link,
+			FilePath:                  v.Location,
+			ComponentName:             v.PackageName,
+			ComponentVersion:          v.CurrentVersion,
+			PlannedRemediationVersion: v.FixedVersion,
+			StaticFinding:             true,
+			UniqueIDFromTool:          v.Fingerprint,
+			VulnIDFromTool:            v.CVEID,
+		}
+		if f.Description == "" {
+			f.Description = f.Title
+		}
+		if v.CVSS > 0 {
+			score := v.CVSS
+			f.CVSSv3Score = &score
+		}
+		if !v.PublishedDate.IsZero() {
+			f.PublishDate = v.PublishedDate.UTC().Format(dateLayout)
+		}
+		if v.FixedVersion != "" {
+			f.Mitigation = "Upgrade " + v.PackageName + " to " + v.FixedVersion
+		}
+		for _, id := range append([]string{v.CVEID}, v.Aliases...) {
+			f.VulnerabilityIDs = append(f.VulnerabilityIDs, VulnerabilityID{VulnerabilityID: id})
+		}
+
+		active := true
+		switch v.TriageStatus {
+		case triageAcknowledged:
+			f.Verified = true
+		case triageFalsePositive:
+			f.FalseP, active = true, false
+		case triageWontFix:
+			f.RiskAccepted, active = true, false
+		case triageResolved:
+			f.IsMitigated, active = true, false
+		}
+		f.Active = &active
+		report.Findings = append(report.Findings, f)
+	}
+	return report
+}
+
+// exportSeverity returns the DefectDojo severity of a vulnscan severity
+func exportSeverity(severity string) string {
+	if s, ok := severities[strings.ToUpper(severity)]; ok {
+		return s
+	}
+	return "Info"
+}
+
+// importSeverity returns the vulnscan severity of a DefectDojo severity
+func importSeverity(severity string) string {
+	s := strings.ToUpper(strings.TrimSpace(severity))
+	if _, ok := severities[s]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+// triageStatus returns the triage status a finding's flags give, or "" for
+// an active, unverified finding, whose triage state is left to vulnscan
+func (f Finding) triageStatus() string {
+	switch {
+	case f.FalseP:
+		return triageFalsePositive
+	case f.RiskAccepted:
+		return triageWontFix
+	case f.IsMitigated, f.Active != nil && !*f.Active:
+		return triageResolved
+	case f.Verified:
+		return triageAcknowledged
+	}
+	return ""
+}
+
+// id returns the finding's vulnerability ID, the first it gives of its
+// vulnerability_ids, cve, and vuln_id_from_tool
+func (f Finding) id() string {
+	for _, id := range f.VulnerabilityIDs {
+		if id.VulnerabilityID != "" {
+			return id.VulnerabilityID
+		}
+	}
+	if f.CVE != "" {
+		return f.CVE
+	}
+	return f.VulnIDFromTool
+}
+
+// parseDate parses a DefectDojo date, or an RFC 3339 time, returning the
+// zero time for an empty or invalid one
+func parseDate(s string) time.Time {
+	for _, layout := range []string{dateLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
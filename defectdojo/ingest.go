@@ -0,0 +1,95 @@
+package defectdojo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+func init() {
+	formats.Register(Adapter{})
+}
+
+// Adapter is the formats.Adapter for Generic Findings Import documents
+type Adapter struct{}
+
+// Name identifies the format
+func (Adapter) Name() string { return "defectdojo" }
+
+// Detect matches objects with findings carrying a title and severity.
+// Dependency-Track's findings, which nest theirs under a vulnerability
+// with a vulnId, are left to its adapter.
+func (Adapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' &&
+		bytes.Contains(trimmed, []byte(`"findings"`)) &&
+		bytes.Contains(trimmed, []byte(`"title"`)) &&
+		bytes.Contains(trimmed, []byte(`"severity"`)) &&
+		!bytes.Contains(trimmed, []byte(`"vulnId"`))
+}
+
+// Parse converts the document's findings into one scan result. A finding's
+// flags set its triage status; the fixed version is its planned remediation
+// version.
+func (Adapter) Parse(content []byte) ([]models.ScanResult, error) {
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, err
+	}
+	if report.Findings == nil {
+		return nil, errors.New("missing findings")
+	}
+
+	sum := sha256.Sum256(content)
+	result := models.ScanResult{
+		ScanID:       "defectdojo:" + hex.EncodeToString(sum[:6]),
+		ScanStatus:   "completed",
+		ResourceType: "defectdojo",
+		Timestamp:    time.Now().UTC(),
+	}
+	for i, f := range report.Findings {
+		v := models.Vulnerability{
+			CVEID:          f.id(),
+			Severity:       importSeverity(f.Severity),
+			PackageName:    f.ComponentName,
+			CurrentVersion: f.ComponentVersion,
+			FixedVersion:   f.PlannedRemediationVersion,
+			Description:    f.Description,
+			PublishedDate:  parseDate(f.PublishDate),
+			Link:           firstLine(f.References),
+			Location:       f.FilePath,
+			TriageStatus:   f.triageStatus(),
+			RiskFactors:    models.RiskFactors{},
+		}
+		if v.CVEID == "" {
+			return nil, fmt.Errorf("finding %d: no vulnerability ID", i)
+		}
+		if v.Description == "" {
+			v.Description = f.Title
+		}
+		if f.CVSSv3Score != nil {
+			v.CVSS = *f.CVSSv3Score
+		}
+		result.Vulnerabilities = append(result.Vulnerabilities, v)
+	}
+	return []models.ScanResult{result}, nil
+}
+
+// firstLine returns the first non-empty line of references, which list one
+// per line
+func firstLine(references string) string {
+	for _, line := range strings.Split(references, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+// Package delivery runs saved queries on schedules and sends the exported
+// results to notification channels, e.g. a CSV of critical findings mailed
+// every Monday morning.
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/notify"
+)
+
+// Report configures one scheduled delivery
+type Report struct {
+	Name     string   `json:"name"`               // Unique name used in logs and message titles
+	Query    string   `json:"query"`              // Saved query to run
+	Schedule string   `json:"schedule"`           // Cron expression, e.g. "0 8 * * mon"
+	Timezone string   `json:"timezone,omitempty"` // IANA zone the schedule is in (default UTC)
+	Format   string   `json:"format,omitempty"`   // Attachment format: csv (default) or xlsx
+	Channels []string `json:"channels"`           // Names of notification channels to send to
+}
+
+// Config is the "reports" section of the notification configuration file
+type Config struct {
+	Reports []Report `json:"reports"`
+}
+
+// scheduled is a report with its parsed schedule and next run
+type scheduled struct {
+	Report
+	schedule Schedule
+	loc      *time.Location
+	next     time.Time
+}
+
+// Deliverer sends reports through a notifier when they fall due
+type Deliverer struct {
+	Notifier *notify.Notifier
+	BaseURL  string // Public server URL linked from messages; empty omits the link
+
+	mu      sync.Mutex
+	reports []*scheduled
+}
+
+// New validates the configured reports against the notifier's channels and
+// schedules each for its first run after now
+func New(cfg Config, n *notify.Notifier, now time.Time) (*Deliverer, error) {
+	d := &Deliverer{Notifier: n}
+	seen := map[string]bool{}
+	for _, r := range cfg.Reports {
+		if r.Name == "" || r.Query == "" {
+			return nil, errors.New("delivery: reports need a name and a query")
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("delivery: report %q: duplicate name", r.Name)
+		}
+		seen[r.Name] = true
+
+		s, err := ParseSchedule(r.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("delivery: report %q: %v", r.Name, err)
+		}
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("delivery: report %q: %v", r.Name, err)
+		}
+		if r.Format = strings.ToLower(r.Format); r.Format == "" {
+			r.Format = "csv"
+		}
+		if r.Format != "csv" && r.Format != "xlsx" {
+			return nil, fmt.Errorf("delivery: report %q: unknown format %q (want csv or xlsx)", r.Name, r.Format)
+		}
+		if len(r.Channels) == 0 {
+			return nil, fmt.Errorf("delivery: report %q: channels is required", r.Name)
+		}
+		for _, c := range r.Channels {
+			if !n.HasChannel(c) {
+				return nil, fmt.Errorf("delivery: report %q: unknown channel %q", r.Name, c)
+			}
+		}
+		d.reports = append(d.reports, &scheduled{Report: r, schedule: s, loc: loc, next: s.Next(now.In(loc))})
+	}
+	return d, nil
+}
+
+// Load reads the reports section of a JSON configuration file
+func Load(path string, n *notify.Notifier) (*Deliverer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("delivery: parse %s: %v", path, err)
+	}
+	return New(cfg, n, time.Now())
+}
+
+// Len returns the number of configured reports
+func (d *Deliverer) Len() int {
+	return len(d.reports)
+}
+
+// Next returns when the named report runs next
+func (d *Deliverer) Next(name string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.reports {
+		if r.Name == name {
+			return r.next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RunDue delivers every report whose next run is at or before now and
+// schedules its following run. Runs missed while the server was down are
+// not made up.
+func (d *Deliverer) RunDue(ctx context.Context, now time.Time) error {
+	var due []Report
+	d.mu.Lock()
+	for _, r := range d.reports {
+		if !now.Before(r.next) {
+			due = append(due, r.Report)
+			r.next = r.schedule.Next(now.In(r.loc))
+		}
+	}
+	d.mu.Unlock()
+
+	var errs []error
+	for _, r := range due {
+		if err := d.deliver(ctx, r, now); err != nil {
+			slog.Warn("report delivery failed", "report", r.Name, "error", err)
+			errs = append(errs, fmt.Errorf("report %q: %v", r.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deliver sends the named report immediately, outside its schedule
+func (d *Deliverer) Deliver(ctx context.Context, name string) error {
+	for _, r := range d.reports {
+		if r.Name == name {
+			return d.deliver(ctx, r.Report, time.Now())
+		}
+	}
+	return fmt.Errorf("unknown report %q", name)
+}
+
+// deliver runs the report's saved query and sends the exported results
+func (d *Deliverer) deliver(ctx context.Context, r Report, now time.Time) error {
+	q, err := handlers.GetSavedQuery(ctx, r.Query)
+	if err != nil {
+		return fmt.Errorf("saved query %q: %v", r.Query, err)
+	}
+	vulns, err := handlers.QueryVulnerabilities(ctx, q.Filters)
+	if err != nil {
+		return err
+	}
+	columns, err := export.SelectColumns(q.Columns)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	attachment := &notify.Attachment{Name: fmt.Sprintf("%s-%s.%s", r.Name, now.Format("2006-01-02"), r.Format)}
+	if r.Format == "xlsx" {
+		attachment.ContentType = export.XLSXMediaType
+		err = export.WriteXLSX(&buf, vulns, columns)
+	} else {
+		attachment.ContentType = export.CSVMediaType
+		err = export.WriteCSV(&buf, vulns, columns)
+	}
+	if err != nil {
+		return err
+	}
+	attachment.Data = buf.Bytes()
+
+	report := notify.Report{
+		Name: r.Name, Query: q.Name, Description: q.Description, Total: len(vulns),
+		Counts: map[string]int{}, Attachment: attachment,
+	}
+	for _, v := range vulns {
+		report.Counts[strings.ToUpper(v.Severity)]++
+	}
+	if d.BaseURL != "" {
+		report.Link = strings.TrimSuffix(d.BaseURL, "/") + "/queries/" + url.PathEscape(q.Name) + "/run"
+	}
+
+	if err := d.Notifier.SendReport(ctx, r.Channels, report); err != nil {
+		return err
+	}
+	slog.Info("report delivered", "report", r.Name, "query", q.Name, "findings", len(vulns), "channels", r.Channels)
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package dtrack connects vulnscan to an existing OWASP Dependency-Track
+// server (REST API v1): it uploads the components of ingested SBOMs to
+// Dependency-Track projects, and pulls projects' findings, with their
+// analysis state, back as scans, so the two can run side by side.
+package dtrack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// Modes of a configured project
+const (
+	ModePush = "push" // Components of ingested SBOMs are uploaded to the project
+	ModePull = "pull" // The project's findings are ingested as scans of the repository
+)
+
+// Config is the JSON Dependency-Track projects file
+type Config struct {
+	Projects []Project `json:"projects"`
+}
+
+// Project links repositories to a Dependency-Track project
+type Project struct {
+	Repo    string `json:"repo"`    // Repository URL; for push, may be a path.Match pattern of them
+	Mode    string `json:"mode"`    // push or pull
+	UUID    string `json:"uuid"`    // Project UUID; without one the project is found, or for push created, by name and version
+	Name    string `json:"name"`    // Project name, by default the repository's path
+	Version string `json:"version"` // Project version, by default latest
+}
+
+// Client uploads BOMs to and reads findings from one Dependency-Track
+// server
+type Client struct {
+	BaseURL  string       // Server root, e.g. https://dtrack.example.com
+	APIKey   string       // API key of a team with BOM_UPLOAD, PROJECT_CREATION_UPLOAD, and VIEW_VULNERABILITY
+	Projects []Project    // Configured projects, in file order
+	HTTP     *http.Client // Underlying HTTP client
+}
+
+// NewClient creates a client for the configured projects
+func NewClient(baseURL, apiKey string, projects []Project) *Client {
+	return &Client{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		APIKey:   apiKey,
+		Projects: projects,
+		HTTP:     httpclient.New(30 * time.Second),
+	}
+}
+
+// DefaultClient is used by the ingest pipeline and the pull job; nil until
+// configured
+var DefaultClient *Client
+
+// LoadConfig reads and validates a projects file
+func LoadConfig(file string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("dtrack: parse %s: %v", file, err)
+	}
+	for i, p := range cfg.Projects {
+		if err := p.validate(); err != nil {
+			return cfg, fmt.Errorf("dtrack: project %d: %v", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// validate checks a project's repository and mode
+func (p Project) validate() error {
+	switch p.Mode {
+	case ModePush:
+		if _, err := path.Match(p.Repo, ""); err != nil || p.Repo == "" {
+			return fmt.Errorf("invalid repo pattern %q", p.Repo)
+		}
+	case ModePull:
+		// Findings are stored under one repository
+		if p.Repo == "" || strings.ContainsAny(p.Repo, `*?[\`) {
+			return fmt.Errorf("pull needs a repository URL, got %q", p.Repo)
+		}
+	default:
+		return fmt.Errorf("invalid mode %q, want push or pull", p.Mode)
+	}
+	return nil
+}
+
+// project returns the first project of the mode whose repo matches,
+// ignoring case, with its name and version defaulted for repo
+func (c *Client) project(mode, repo string) (Project, bool) {
+	for _, p := range c.Projects {
+		if p.Mode != mode {
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(p.Repo), strings.ToLower(repo)); ok {
+			return p.withDefaults(repo), true
+		}
+	}
+	return Project{}, false
+}
+
+// withDefaults fills in the name and version of a project of repo
+func (p Project) withDefaults(repo string) Project {
+	if p.Name == "" {
+		p.Name = repo
+		if u, err := url.Parse(repo); err == nil && u.Host != "" {
+			p.Name = strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+		}
+	}
+	if p.Version == "" {
+		p.Version = "latest"
+	}
+	return p
+}
+
+// UploadBOM uploads a CycloneDX BOM to the project, creating the project
+// if it is named rather than given by UUID. Dependency-Track analyzes the
+// BOM in the background; the returned token identifies that processing.
+func (c *Client) UploadBOM(ctx context.Context, p Project, bom []byte) (string, error) {
+	body := map[string]interface{}{"bom": bom} // Encoded as base64
+	if p.UUID != "" {
+		body["project"] = p.UUID
+	} else {
+		body["projectName"], body["projectVersion"], body["autoCreate"] = p.Name, p.Version, true
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	data, err := c.do(ctx, http.MethodPut, "/api/v1/bom", payload)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("dtrack: decode response: %v", err)
+	}
+	return resp.Token, nil
+}
+
+// Findings returns the project's findings in Dependency-Track's Finding
+// Packaging Format, looking the project up by name and version when it
+// has no UUID
+func (c *Client) Findings(ctx context.Context, p Project) ([]byte, error) {
+	uuid := p.UUID
+	if uuid == "" {
+		q := url.Values{"name": {p.Name}, "version": {p.Version}}
+		data, err := c.do(ctx, http.MethodGet, "/api/v1/project/lookup?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var project struct {
+			UUID string `json:"uuid"`
+		}
+		if err := json.Unmarshal(data, &project); err != nil || project.UUID == "" {
+			return nil, fmt.Errorf("dtrack: look up project %s %s: invalid response", p.Name, p.Version)
+		}
+		uuid = project.UUID
+	}
+	return c.do(ctx, http.MethodGet, "/api/v1/finding/project/"+url.PathEscape(uuid)+"/export", nil)
+}
+
+// do sends a request with the API key and returns the response body
+func (c *Client) do(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Api-Key", c.APIKey)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dtrack: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("dtrack: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("dtrack: read response: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,185 @@
+package dtrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+func init() {
+	formats.Register(Adapter{})
+}
+
+// FPF is a project's findings in Dependency-Track's Finding Packaging
+// Format, as GET /api/v1/finding/project/{uuid}/export returns them
+type FPF struct {
+	Version string `json:"version"`
+	Meta    struct {
+		Application string `json:"application"`
+		Timestamp   string `json:"timestamp"`
+	} `json:"meta"`
+	Project struct {
+		UUID    string `json:"uuid"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"project"`
+	Findings []Finding `json:"findings"`
+}
+
+// Finding is a vulnerability of a component of the project, with its
+// analysis
+type Finding struct {
+	Component struct {
+		Name    string `json:"name"`
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		PURL    string `json:"purl"`
+	} `json:"component"`
+	Vulnerability struct {
+		VulnID          string   `json:"vulnId"`
+		Title           string   `json:"title"`
+		Severity        string   `json:"severity"`
+		CVSSv3BaseScore *float64 `json:"cvssV3BaseScore"`
+		CVSSv2BaseScore *float64 `json:"cvssV2BaseScore"`
+		Description     string   `json:"description"`
+		Published       string   `json:"published"`
+		PatchedVersions string   `json:"patchedVersions"`
+		Aliases         []Alias  `json:"aliases"`
+	} `json:"vulnerability"`
+	Analysis struct {
+		State        string `json:"state"`
+		IsSuppressed bool   `json:"isSuppressed"`
+	} `json:"analysis"`
+}
+
+// Alias lists other identifiers of a vulnerability, by source
+type Alias struct {
+	CVEID  string `json:"cveId"`
+	GHSAID string `json:"ghsaId"`
+	OSVID  string `json:"osvId"`
+	SnykID string `json:"snykId"`
+}
+
+// triageStatuses maps analysis states to triage statuses; NOT_SET and
+// unknown states leave the triage state to vulnscan
+var triageStatuses = map[string]string{
+	"EXPLOITABLE":    "acknowledged",
+	"IN_TRIAGE":      "acknowledged",
+	"FALSE_POSITIVE": "false_positive",
+	"NOT_AFFECTED":   "false_positive",
+	"RESOLVED":       "resolved",
+}
+
+// severities are Dependency-Track's severities vulnscan shares; INFO and
+// UNASSIGNED are UNKNOWN
+var severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}
+
+// Adapter is the formats.Adapter for Finding Packaging Format documents
+type Adapter struct{}
+
+// Name identifies the format
+func (Adapter) Name() string { return "dependency-track" }
+
+// Detect matches objects with findings naming their vulnerability's vulnId
+func (Adapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' &&
+		bytes.Contains(trimmed, []byte(`"findings"`)) &&
+		bytes.Contains(trimmed, []byte(`"vulnId"`))
+}
+
+// Parse converts the document's findings into one scan result of the
+// project. A finding's analysis state, or its suppression, sets its triage
+// status.
+func (Adapter) Parse(content []byte) ([]models.ScanResult, error) {
+	var doc FPF
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Findings == nil {
+		return nil, errors.New("missing findings")
+	}
+
+	result := models.ScanResult{
+		ScanID:       "dependency-track:" + doc.Project.UUID + "@" + doc.Meta.Timestamp,
+		ScanStatus:   "completed",
+		ResourceType: "dependency-track",
+		ResourceName: strings.TrimSpace(doc.Project.Name + " " + doc.Project.Version),
+		Timestamp:    parseTime(doc.Meta.Timestamp),
+	}
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+	for i, f := range doc.Findings {
+		c, fv := f.Component, f.Vulnerability
+		v := models.Vulnerability{
+			CVEID:          fv.VulnID,
+			Severity:       importSeverity(fv.Severity),
+			PackageName:    c.Name,
+			CurrentVersion: c.Version,
+			FixedVersion:   fv.PatchedVersions,
+			Description:    fv.Description,
+			PublishedDate:  parseTime(fv.Published),
+			PURL:           c.PURL,
+			Ecosystem:      purl.Ecosystem(c.PURL),
+			TriageStatus:   triageStatuses[f.Analysis.State],
+			RiskFactors:    models.RiskFactors{},
+		}
+		if v.CVEID == "" {
+			return nil, fmt.Errorf("finding %d: no vulnerability ID", i)
+		}
+		if c.PURL != "" {
+			v.PackageName = purl.Name(c.PURL)
+		} else if c.Group != "" {
+			v.PackageName = c.Group + "/" + c.Name
+		}
+		if v.Description == "" {
+			v.Description = fv.Title
+		}
+		if fv.CVSSv3BaseScore != nil {
+			v.CVSS = *fv.CVSSv3BaseScore
+		} else if fv.CVSSv2BaseScore != nil {
+			v.CVSS = *fv.CVSSv2BaseScore
+		}
+		if v.TriageStatus == "" && f.Analysis.IsSuppressed {
+			v.TriageStatus = "wont_fix"
+		}
+		for _, a := range fv.Aliases {
+			for _, id := range []string{a.CVEID, a.GHSAID, a.OSVID, a.SnykID} {
+				if id != "" && id != v.CVEID && !slices.Contains(v.Aliases, id) {
+					v.Aliases = append(v.Aliases, id)
+				}
+			}
+		}
+		result.Vulnerabilities = append(result.Vulnerabilities, v)
+	}
+	return []models.ScanResult{result}, nil
+}
+
+// importSeverity returns the vulnscan severity of a Dependency-Track
+// severity
+func importSeverity(severity string) string {
+	s := strings.ToUpper(strings.TrimSpace(severity))
+	if slices.Contains(severities, s) {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+// parseTime parses one of Dependency-Track's RFC 3339 times, returning the
+// zero time for an empty or invalid one
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
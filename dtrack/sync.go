@@ -0,0 +1,140 @@
+package dtrack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/pipeline"
+)
+
+// cycloneDXBOM is the CycloneDX JSON BOM uploaded to Dependency-Track
+type cycloneDXBOM struct {
+	BOMFormat   string `json:"bomFormat"`
+	SpecVersion string `json:"specVersion"`
+	Version     int    `json:"version"`
+	Metadata    struct {
+		Timestamp string             `json:"timestamp"`
+		Tools     []cycloneDXTool    `json:"tools"`
+		Component cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// cycloneDXTool names the tool that produced a BOM
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+// cycloneDXComponent is one component of an uploaded BOM
+type cycloneDXComponent struct {
+	Type     string             `json:"type"`
+	Name     string             `json:"name"`
+	Version  string             `json:"version,omitempty"`
+	PURL     string             `json:"purl,omitempty"`
+	Licenses []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+// cycloneDXLicense is a component's SPDX license expression
+type cycloneDXLicense struct {
+	Expression string `json:"expression"`
+}
+
+// BOM builds a CycloneDX JSON BOM of the project's components, listing
+// each name, version, and package URL once
+func BOM(p Project, components []models.Component, now time.Time) ([]byte, error) {
+	bom := cycloneDXBOM{BOMFormat: "CycloneDX", SpecVersion: "1.5", Version: 1}
+	bom.Metadata.Timestamp = now.UTC().Format(time.RFC3339)
+	bom.Metadata.Tools = []cycloneDXTool{{Name: "vulnscan"}}
+	bom.Metadata.Component = cycloneDXComponent{Type: "application", Name: p.Name, Version: p.Version}
+	bom.Components = []cycloneDXComponent{}
+	seen := map[[3]string]bool{}
+	for _, c := range components {
+		key := [3]string{c.Name, c.Version, c.PURL}
+		if c.Name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		component := cycloneDXComponent{Type: c.Type, Name: c.Name, Version: c.Version, PURL: c.PURL}
+		if component.Type == "" {
+			component.Type = "library"
+		}
+		if c.License != "" {
+			component.Licenses = []cycloneDXLicense{{Expression: c.License}}
+		}
+		bom.Components = append(bom.Components, component)
+	}
+	return json.Marshal(bom)
+}
+
+// Push is a persist step uploading the components of a stored SBOM to the
+// push project its repository matches. Dependency-Track being unreachable
+// doesn't fail the ingest: the failure is logged and reported as a warning
+// of the file.
+func (c *Client) Push(ctx context.Context, in *pipeline.Ingest) error {
+	var components []models.Component
+	for _, sr := range in.Results {
+		components = append(components, sr.Components...)
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	p, ok := c.project(ModePush, in.Repo)
+	if !ok {
+		return nil
+	}
+
+	bom, err := BOM(p, components, time.Now())
+	if err == nil {
+		var token string
+		if token, err = c.UploadBOM(ctx, p, bom); err == nil {
+			logging.FromContext(ctx).Info("BOM uploaded to Dependency-Track",
+				"repo", in.Repo, "file", in.File, "project", p.Name, "version", p.Version, "token", token)
+			return nil
+		}
+	}
+	logging.FromContext(ctx).Warn("Dependency-Track upload failed",
+		"repo", in.Repo, "file", in.File, "project", p.Name, "error", err)
+	in.Warnings = append(in.Warnings, formats.Warning{Index: -1, Reason: "Dependency-Track upload failed: " + err.Error()})
+	return nil
+}
+
+// IngestFunc stores a pulled findings document as a file of repo
+type IngestFunc func(ctx context.Context, repo, file string, content []byte) error
+
+// Pull ingests the findings of every pull project as a scan of its
+// repository, stored under a file named after the project, and returns the
+// number of projects pulled. A failing project doesn't stop the others.
+func (c *Client) Pull(ctx context.Context, ingest IngestFunc) (int, error) {
+	var pulled int
+	var errs []error
+	for _, p := range c.Projects {
+		if p.Mode != ModePull {
+			continue
+		}
+		p = p.withDefaults(p.Repo)
+		content, err := c.Findings(ctx, p)
+		if err == nil {
+			err = ingest(ctx, p.Repo, p.file(), content)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("project %s %s: %w", p.Name, p.Version, err))
+			continue
+		}
+		pulled++
+	}
+	return pulled, errors.Join(errs...)
+}
+
+// file is the file path a pull project's findings are stored under
+func (p Project) file() string {
+	if p.UUID != "" {
+		return "dependency-track/" + p.UUID
+	}
+	return "dependency-track/" + p.Name + "@" + p.Version
+}
@@ -0,0 +1,232 @@
+// Package encrypt seals data at rest with AES-256-GCM, in a chunked format
+// that can be written and read as a stream, so that large files such as
+// database backups need not fit in memory.
+//
+// An encrypted stream starts with a header of the magic "vsenc1", the ID of
+// the key, and a random nonce prefix, followed by chunks of up to 64 KiB of
+// plaintext, each sealed under a nonce of the prefix, the chunk's index,
+// and whether it is the last chunk, so that chunks can't be reordered,
+// dropped, or truncated without failing to decrypt.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// magic starts every encrypted stream
+const magic = "vsenc1"
+
+// Sizes of the parts of an encrypted stream, in bytes
+const (
+	chunkSize  = 64 * 1024 // Plaintext of each chunk
+	prefixSize = 7         // Random nonce prefix
+	headerSize = len(magic) + keyIDSize + prefixSize
+)
+
+// ErrWrongKey is returned when data was encrypted with another key
+var ErrWrongKey = errors.New("data was encrypted with a different key")
+
+// IsEncrypted reports whether data starts like an encrypted stream
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Seal encrypts data with the key
+func Seal(key *Key, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Open decrypts data sealed with the key
+func Open(key *Key, data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// writer encrypts what is written to it chunk by chunk
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint32
+	closed bool
+}
+
+// NewWriter returns a writer encrypting to w with the key. The last chunk
+// is only written by Close, without which the stream doesn't decrypt.
+func NewWriter(w io.Writer, key *Key) (io.WriteCloser, error) {
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, key.ID()...)
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, header: header, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Write buffers p, sealing each full chunk once more data follows it
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals the last chunk. It doesn't close the underlying writer.
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+// flush seals and writes the buffered chunk
+func (w *writer) flush(last bool) error {
+	if w.index == math.MaxUint32 {
+		return errors.New("encrypted stream too long")
+	}
+	sealed := w.aead.Seal(nil, nonce(w.header, w.index, last), w.buf, w.header)
+	w.buf = w.buf[:0]
+	w.index++
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+// reader decrypts an encrypted stream chunk by chunk
+type reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  []byte
+	plain  []byte
+	index  uint32
+	done   bool
+}
+
+// NewReader returns a reader decrypting the stream r with the key. Reads
+// fail if the stream was modified or cut short.
+func NewReader(r io.Reader, key *Key) (io.Reader, error) {
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || !IsEncrypted(header) {
+		return nil, errors.New("not an encrypted stream")
+	}
+	if !bytes.Equal(header[len(magic):len(magic)+keyIDSize], key.ID()) {
+		return nil, ErrWrongKey
+	}
+	return &reader{r: bufio.NewReader(r), aead: aead, header: header,
+		chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+// Read returns decrypted plaintext, opening the next chunk when the last
+// one is used up
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk. A chunk is the last one when the
+// stream ends after it.
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		r.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.r.Peek(1); errors.Is(err, io.EOF) {
+			r.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := r.aead.Open(r.chunk[:0], nonce(r.header, r.index, r.done), r.chunk[:n], r.header)
+	if err != nil {
+		return fmt.Errorf("decrypt chunk %d: stream modified or truncated", r.index)
+	}
+	r.plain = plain
+	r.index++
+	return nil
+}
+
+// nonce returns the nonce of a chunk: the stream's prefix, the chunk's
+// index, and a byte marking the last chunk
+func nonce(header []byte, index uint32, last bool) []byte {
+	n := make([]byte, 0, 12)
+	n = append(n, header[headerSize-prefixSize:]...)
+	n = binary.BigEndian.AppendUint32(n, index)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// aead returns the AES-256-GCM cipher of the key
+func (k *Key) aead() (cipher.AEAD, error) {
+	if k == nil {
+		return nil, errors.New("no encryption key configured")
+	}
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
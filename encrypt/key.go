@@ -0,0 +1,90 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// KeySize is the length of an encryption key, in bytes
+const KeySize = 32
+
+// keyIDSize is the length of the key ID in the header of encrypted data
+const keyIDSize = 4
+
+// keyCommandTimeout bounds a key command such as a KMS decrypt call
+const keyCommandTimeout = 30 * time.Second
+
+// Key is an AES-256 encryption key
+type Key [KeySize]byte
+
+// ID returns a short identifier of the key, stored with encrypted data so
+// that decrypting with another key fails with ErrWrongKey
+func (k *Key) ID() []byte {
+	sum := sha256.Sum256(k[:])
+	return sum[:keyIDSize]
+}
+
+// ParseKey parses a base64-encoded 32-byte key, e.g. from
+// openssl rand -base64 32
+func ParseKey(s string) (*Key, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("encryption key is not valid base64")
+	}
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("encryption key is %d bytes (want %d)", len(raw), KeySize)
+	}
+	var k Key
+	copy(k[:], raw)
+	return &k, nil
+}
+
+// KeySource names where the encryption key is read from; at most one of
+// its fields may be set
+type KeySource struct {
+	Value   string // Base64-encoded key
+	File    string // Path of a file holding the base64-encoded key
+	Command string // Shell command printing the base64-encoded key, e.g. a KMS or Vault decrypt call
+}
+
+// LoadKey reads the key from the source, or returns nil when it names none
+func LoadKey(ctx context.Context, src KeySource) (*Key, error) {
+	set := 0
+	for _, v := range []string{src.Value, src.File, src.Command} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, nil
+	case set > 1:
+		return nil, errors.New("set only one of the encryption key, key file, and key command")
+	case src.File != "":
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption key file: %v", err)
+		}
+		return ParseKey(string(data))
+	case src.Command != "":
+		ctx, cancel := context.WithTimeout(ctx, keyCommandTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", src.Command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("encryption key command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return ParseKey(string(out))
+	}
+	return ParseKey(src.Value)
+}
@@ -0,0 +1,170 @@
+// Package epss imports the daily FIRST EPSS (Exploit Prediction Scoring
+// System) feed of exploit-probability scores per CVE.
+package epss
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// DefaultFeedURL is the published location of the current EPSS scores
+const DefaultFeedURL = "https://epss.cyentia.com/epss_scores-current.csv.gz"
+
+// Score is the EPSS score of a single CVE
+type Score struct {
+	CVEID      string  // CVE identifier
+	EPSS       float64 // Probability of exploitation in the next 30 days
+	Percentile float64 // Rank among all scored CVEs
+}
+
+// Feed is a parsed EPSS feed
+type Feed struct {
+	ScoreDate string  // Date the scores were computed, as published in the feed
+	Scores    []Score // Scores per CVE
+}
+
+// Client downloads the EPSS feed
+type Client struct {
+	FeedURL string       // Location of the (optionally gzipped) CSV feed
+	HTTP    *http.Client // Underlying HTTP client
+}
+
+// DefaultClient is used by the sync job
+var DefaultClient = &Client{
+	FeedURL: DefaultFeedURL,
+	HTTP:    httpclient.New(5 * time.Minute),
+}
+
+// Fetch downloads and parses the feed
+func (c *Client) Fetch(ctx context.Context) (*Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("epss: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("epss: HTTP status %d", resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
+
+// Parse reads an EPSS CSV feed, gzipped or plain. The feed starts with a
+// comment line carrying the model version and score date, followed by a
+// "cve,epss,percentile" header.
+func Parse(r io.Reader) (*Feed, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("epss: %v", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	feed := &Feed{}
+	for {
+		line, err := br.Peek(1)
+		if err != nil || line[0] != '#' {
+			break
+		}
+		comment, _ := br.ReadString('\n')
+		for _, field := range strings.Split(strings.TrimPrefix(strings.TrimSpace(comment), "#"), ",") {
+			if k, v, ok := strings.Cut(field, ":"); ok && k == "score_date" {
+				feed.ScoreDate = v
+			}
+		}
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = 3
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("epss: read header: %v", err)
+	}
+	if header[0] != "cve" || header[1] != "epss" || header[2] != "percentile" {
+		return nil, fmt.Errorf("epss: unexpected header %v", header)
+	}
+
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("epss: %v", err)
+		}
+		score, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("epss: %s: invalid score %q", rec[0], rec[1])
+		}
+		pct, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("epss: %s: invalid percentile %q", rec[0], rec[2])
+		}
+		feed.Scores = append(feed.Scores, Score{CVEID: rec[0], EPSS: score, Percentile: pct})
+	}
+	return feed, nil
+}
+
+// Sync downloads the feed and replaces the stored scores, returning the
+// number of CVEs scored
+func (c *Client) Sync(ctx context.Context, db *sqlx.DB) (int, error) {
+	feed, err := c.Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Store(ctx, db, feed)
+}
+
+// Store writes the feed's scores in a single transaction
+func Store(ctx context.Context, db *sqlx.DB, feed *Feed) (int, error) {
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, `INSERT INTO epss_scores (cve_id, epss, percentile, score_date, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(cve_id) DO UPDATE SET epss = excluded.epss, percentile = excluded.percentile,
+			score_date = excluded.score_date, updated_at = excluded.updated_at`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, s := range feed.Scores {
+		if _, err := stmt.ExecContext(ctx, s.CVEID, s.EPSS, s.Percentile, feed.ScoreDate, now); err != nil {
+			return 0, fmt.Errorf("store %s: %v", s.CVEID, err)
+		}
+	}
+	return len(feed.Scores), tx.Commit()
+}
@@ -0,0 +1,108 @@
+// Package errs defines the categories of errors shared by the fetching,
+// storage, and API layers, so that callers tell failures apart with
+// errors.Is rather than by their messages, and map them onto HTTP status
+// codes in one place
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error categories
+var (
+	ErrNotFound            = errors.New("not found")             // The referenced row, file, or repository does not exist
+	ErrFetch               = errors.New("fetch failed")          // An upstream service or host failed to respond usably
+	ErrParse               = errors.New("parse failed")          // Content could not be decoded or recognized
+	ErrConflict            = errors.New("conflict")              // The request conflicts with the current state
+	ErrUpstreamRateLimited = errors.New("upstream rate limited") // An upstream service refused requests until its limit resets
+	ErrQuotaExceeded       = errors.New("quota exceeded")        // The caller used up its share of the service
+)
+
+// categorized is an error in a category, keeping its own message
+type categorized struct {
+	kind error
+	err  error
+}
+
+// Error returns the underlying message
+func (e *categorized) Error() string { return e.err.Error() }
+
+// Unwrap returns the category and the underlying error, so errors.Is
+// matches either
+func (e *categorized) Unwrap() []error { return []error{e.kind, e.err} }
+
+// New returns an error with message msg in the category kind. Being a
+// distinct value, it can serve as a sentinel of its own.
+func New(kind error, msg string) error {
+	return &categorized{kind: kind, err: errors.New(msg)}
+}
+
+// Errorf formats an error in the category kind, wrapping the %w operands
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &categorized{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// Wrap puts err in the category kind without changing its message. It
+// returns nil for a nil err.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorized{kind: kind, err: err}
+}
+
+// HTTPStatus returns the status code answering a request that failed with
+// err: 404 for ErrNotFound, 409 for ErrConflict, 422 for ErrParse, 429 for
+// ErrQuotaExceeded, 503 for ErrUpstreamRateLimited, and 502 for ErrFetch.
+// Errors in no category get fallback.
+func HTTPStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrParse):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrUpstreamRateLimited):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrFetch):
+		return http.StatusBadGateway
+	}
+	return fallback
+}
+
+// retryable is an error that can be retried after a wait
+type retryable struct {
+	err   error
+	after time.Duration
+}
+
+// Error returns the underlying message
+func (e *retryable) Error() string { return e.err.Error() }
+
+// Unwrap returns the underlying error
+func (e *retryable) Unwrap() error { return e.err }
+
+// WithRetryAfter records that the operation failing with err may succeed
+// when retried after d, e.g. once an upstream rate limit resets. It
+// returns nil for a nil err.
+func WithRetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryable{err: err, after: max(d, 0)}
+}
+
+// RetryAfter returns the wait recorded by WithRetryAfter in err's chain
+func RetryAfter(err error) (time.Duration, bool) {
+	var r *retryable
+	if errors.As(err, &r) {
+		return r.after, true
+	}
+	return 0, false
+}
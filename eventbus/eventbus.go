@@ -0,0 +1,377 @@
+// Package eventbus publishes scan-completed and finding-created events to
+// Kafka, through a Confluent REST Proxy, or to NATS subjects, as JSON or
+// protobuf, so data pipelines can consume vulnerability data without
+// polling the API. Delivery is at least once: a failed batch is retried
+// whole.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/secrets"
+)
+
+// Publisher types
+const (
+	TypeKafka = "kafka" // Kafka topics, through a Confluent REST Proxy (API v2)
+	TypeNATS  = "nats"  // NATS subjects
+)
+
+// Payload formats
+const (
+	FormatJSON     = "json"     // JSON objects
+	FormatProtobuf = "protobuf" // vulnscan.events.v1.Event messages, see events.proto
+)
+
+// Published event names
+const (
+	EventScanCompleted  = "scan_completed"  // A scan of a report file was stored
+	EventFindingCreated = "finding_created" // A vulnerability was seen in a repository for the first time
+)
+
+// eventTypes maps broker event types to published event names
+var eventTypes = map[string]string{
+	events.TypeScan:    EventScanCompleted,
+	events.TypeFinding: EventFindingCreated,
+}
+
+// Defaults of a publisher
+const (
+	defaultTopic        = "vulnscan.{event}"
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = time.Second
+	defaultQueueSize    = 10000
+	maxBatch            = 100 // Messages sent at a time
+)
+
+// PublisherConfig configures one publisher and the events it publishes
+type PublisherConfig struct {
+	Name   string   `json:"name"`             // Name used in logs and metrics
+	Type   string   `json:"type"`             // kafka or nats
+	URL    string   `json:"url"`              // REST Proxy URL, or nats:// or tls:// server URL
+	Topic  string   `json:"topic,omitempty"`  // Topic or subject, with {event}, {host}, {owner}, and {repo} placeholders (default vulnscan.{event})
+	Format string   `json:"format,omitempty"` // json (default) or protobuf
+	Events []string `json:"events,omitempty"` // Events to publish; empty means all
+
+	Username string `json:"username,omitempty"` // REST Proxy basic auth or NATS user
+	Password string `json:"password,omitempty"` // Password, or a secret reference to it
+	Token    string `json:"token,omitempty"`    // NATS auth token, or a secret reference to it
+
+	MaxRetries   *int   `json:"max_retries,omitempty"`   // Retries of a failed batch before it is dropped (default 3)
+	RetryBackoff string `json:"retry_backoff,omitempty"` // Delay before the first retry, doubling after each (default 1s)
+	QueueSize    int    `json:"queue_size,omitempty"`    // Messages waiting to be sent before new ones are dropped (default 10000)
+}
+
+// Config is the JSON event bus configuration file
+type Config struct {
+	Publishers []PublisherConfig `json:"publishers"`
+}
+
+// Message is one event ready to publish
+type Message struct {
+	Topic string // Topic or subject
+	Key   string // Partitioning key: the repository, keeping each one's events in order
+	Value []byte // Encoded payload
+}
+
+// transport sends a batch of messages to a broker
+type transport interface {
+	Publish(ctx context.Context, batch []Message) error
+}
+
+// publisher is a configured publisher with its queue
+type publisher struct {
+	PublisherConfig
+	transport transport
+	queue     chan Message
+	retries   int
+	backoff   time.Duration
+
+	published atomic.Int64
+	dropped   atomic.Int64
+}
+
+// Stats counts the messages of a publisher
+type Stats struct {
+	Name      string // Publisher name
+	Published int64  // Messages accepted by the broker
+	Dropped   int64  // Messages dropped because the queue was full or retries ran out
+	Queued    int    // Messages waiting to be sent
+}
+
+// Bus publishes events to the configured publishers
+type Bus struct {
+	publishers []*publisher
+}
+
+// placeholder matches the placeholders of a topic template
+var placeholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// kafkaTopic matches valid Kafka topic names
+var kafkaTopic = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+// New creates a bus for the configured publishers, resolving their
+// credentials
+func New(cfg Config) (*Bus, error) {
+	b := &Bus{}
+	names := map[string]bool{}
+	for _, c := range cfg.Publishers {
+		if c.Name == "" || names[c.Name] {
+			return nil, fmt.Errorf("eventbus: publisher name %q missing or repeated", c.Name)
+		}
+		names[c.Name] = true
+		p, err := newPublisher(c)
+		if err != nil {
+			return nil, fmt.Errorf("eventbus: publisher %q: %v", c.Name, err)
+		}
+		b.publishers = append(b.publishers, p)
+	}
+	return b, nil
+}
+
+// newPublisher validates a publisher's configuration and applies its
+// defaults
+func newPublisher(c PublisherConfig) (*publisher, error) {
+	if c.Topic == "" {
+		c.Topic = defaultTopic
+	}
+	if c.Format = strings.ToLower(c.Format); c.Format == "" {
+		c.Format = FormatJSON
+	}
+	if c.Format != FormatJSON && c.Format != FormatProtobuf {
+		return nil, fmt.Errorf("unknown format %q, want json or protobuf", c.Format)
+	}
+	for _, e := range c.Events {
+		if e != EventScanCompleted && e != EventFindingCreated {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+	}
+	for _, p := range placeholder.FindAllString(c.Topic, -1) {
+		if !slices.Contains([]string{"{event}", "{host}", "{owner}", "{repo}"}, p) {
+			return nil, fmt.Errorf("unknown topic placeholder %s", p)
+		}
+	}
+	// Placeholders expand to letters, digits, _ and -, so a sample checks the template
+	sample := topic(c.Topic, EventFindingCreated, "https://github.com/acme/api")
+	if c.Type == TypeKafka && !kafkaTopic.MatchString(sample) ||
+		c.Type == TypeNATS && !validSubject(sample) {
+		return nil, fmt.Errorf("invalid topic %q", c.Topic)
+	}
+
+	p := &publisher{retries: defaultMaxRetries}
+	var err error
+	if p.backoff, err = time.ParseDuration(c.RetryBackoff); c.RetryBackoff == "" {
+		p.backoff = defaultRetryBackoff
+	} else if err != nil || p.backoff <= 0 {
+		return nil, fmt.Errorf("invalid retry_backoff %q", c.RetryBackoff)
+	}
+	if c.MaxRetries != nil {
+		if p.retries = *c.MaxRetries; p.retries < 0 {
+			return nil, fmt.Errorf("invalid max_retries %d", p.retries)
+		}
+	}
+	if c.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid queue_size %d", c.QueueSize)
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	for _, s := range []struct {
+		key   string
+		value *string
+	}{
+		{"password", &c.Password},
+		{"token", &c.Token},
+	} {
+		if *s.value == "" {
+			continue
+		}
+		if *s.value, err = secrets.Default.Resolve(context.Background(), "eventbus."+c.Name+"."+s.key, *s.value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.Type {
+	case TypeKafka:
+		p.transport, err = newKafka(c)
+	case TypeNATS:
+		p.transport, err = newNATS(c)
+	default:
+		err = fmt.Errorf("unknown type %q", c.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.PublisherConfig = c
+	p.queue = make(chan Message, c.QueueSize)
+	return p, nil
+}
+
+// validSubject reports whether s is a NATS subject to publish to: tokens
+// separated by dots, none empty or a wildcard, and no whitespace
+func validSubject(s string) bool {
+	if s == "" || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	for _, token := range strings.Split(s, ".") {
+		if token == "" || token == "*" || token == ">" {
+			return false
+		}
+	}
+	return true
+}
+
+// Load reads a JSON configuration file and creates a bus
+func Load(path string) (*Bus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("eventbus: parse %s: %v", path, err)
+	}
+	return New(cfg)
+}
+
+// Start publishes scan and finding events from broker until ctx is
+// cancelled
+func (b *Bus) Start(ctx context.Context, broker *events.Broker) {
+	ch, cancel := broker.Subscribe(events.Filter{Types: []string{events.TypeScan, events.TypeFinding}})
+	for _, p := range b.publishers {
+		go p.run(ctx)
+	}
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-ch:
+				b.Handle(e)
+			}
+		}
+	}()
+}
+
+// Handle queues an event on every publisher that publishes it, dropping it
+// for publishers whose queue is full rather than holding up the others
+func (b *Bus) Handle(e events.Event) {
+	name, ok := eventTypes[e.Type]
+	if !ok {
+		return
+	}
+	payload, err := newPayload(name, e)
+	if err != nil {
+		slog.Warn("event bus payload invalid", "type", e.Type, "error", err)
+		return
+	}
+	for _, p := range b.publishers {
+		if len(p.Events) > 0 && !slices.Contains(p.Events, name) {
+			continue
+		}
+		value, err := payload.encode(p.Format)
+		if err != nil {
+			slog.Warn("event bus payload invalid", "type", e.Type, "error", err)
+			continue
+		}
+		m := Message{Topic: topic(p.Topic, name, e.Repo), Key: e.Repo, Value: value}
+		select {
+		case p.queue <- m:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns the counts of each publisher, in configuration order
+func (b *Bus) Stats() []Stats {
+	stats := make([]Stats, 0, len(b.publishers))
+	for _, p := range b.publishers {
+		stats = append(stats, Stats{Name: p.Name, Published: p.published.Load(), Dropped: p.dropped.Load(), Queued: len(p.queue)})
+	}
+	return stats
+}
+
+// run sends queued messages, up to maxBatch at a time, until ctx is
+// cancelled
+func (p *publisher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-p.queue:
+			p.deliver(ctx, p.drain([]Message{m}))
+		}
+	}
+}
+
+// drain adds the messages already queued to batch, up to maxBatch
+func (p *publisher) drain(batch []Message) []Message {
+	for len(batch) < maxBatch {
+		select {
+		case m := <-p.queue:
+			batch = append(batch, m)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// deliver publishes a batch, retrying with doubling backoff, and drops it
+// once the retries run out
+func (p *publisher) deliver(ctx context.Context, batch []Message) {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		err := p.transport.Publish(ctx, batch)
+		if err == nil {
+			p.published.Add(int64(len(batch)))
+			return
+		}
+		if attempt >= p.retries || ctx.Err() != nil {
+			slog.Warn("event bus publishing failed", "publisher", p.Name, "messages", len(batch), "attempts", attempt+1, "error", err)
+			p.dropped.Add(int64(len(batch)))
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// unsafeChars matches characters placeholders can't expand to
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// topic expands a topic template for an event of repo. The host, owner,
+// and name of the repository URL have other characters replaced with _, so
+// they can't add topic or subject separators; a repository that isn't a
+// URL has an empty host and owner.
+func topic(template, event, repo string) string {
+	var host, owner, name string
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		host = u.Host
+		owner, name, _ = strings.Cut(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	} else {
+		name = repo
+	}
+	return strings.NewReplacer(
+		"{event}", event,
+		"{host}", unsafeChars.ReplaceAllString(host, "_"),
+		"{owner}", unsafeChars.ReplaceAllString(owner, "_"),
+		"{repo}", unsafeChars.ReplaceAllString(name, "_"),
+	).Replace(template)
+}
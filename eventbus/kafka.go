@@ -0,0 +1,124 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// Content types of the Confluent REST Proxy API v2
+const (
+	kafkaBinary   = "application/vnd.kafka.binary.v2+json" // Base64 keys and values
+	kafkaJSON     = "application/vnd.kafka.json.v2+json"   // JSON keys and values
+	kafkaResponse = "application/vnd.kafka.v2+json"
+)
+
+// kafkaRecord is one record of a produce request
+type kafkaRecord struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// kafkaOffsets is a produce response: an offset, or an error, per record
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition *int   `json:"partition"`
+		Offset    *int64 `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// kafkaPublisher produces records to Kafka topics through a Confluent REST
+// Proxy. Records are keyed by repository, so each one's events land on one
+// partition, in order.
+type kafkaPublisher struct {
+	url      string
+	binary   bool
+	username string
+	password string
+	client   *http.Client
+}
+
+// newKafka creates a Kafka publisher; JSON payloads are produced as JSON
+// records and protobuf ones as binary records
+func newKafka(c PublisherConfig) (*kafkaPublisher, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", c.URL)
+	}
+	return &kafkaPublisher{
+		url: strings.TrimSuffix(u.String(), "/"), binary: c.Format == FormatProtobuf,
+		username: c.Username, password: c.Password, client: httpclient.New(10 * time.Second),
+	}, nil
+}
+
+// Publish produces the batch with one request per topic, in order
+func (k *kafkaPublisher) Publish(ctx context.Context, batch []Message) error {
+	var topics []string
+	records := map[string][]kafkaRecord{}
+	for _, m := range batch {
+		if _, ok := records[m.Topic]; !ok {
+			topics = append(topics, m.Topic)
+		}
+		r := kafkaRecord{Key: m.Key, Value: json.RawMessage(m.Value)}
+		if k.binary {
+			r = kafkaRecord{Key: []byte(m.Key), Value: m.Value} // []byte marshals as base64
+		}
+		records[m.Topic] = append(records[m.Topic], r)
+	}
+	for _, topic := range topics {
+		if err := k.produce(ctx, topic, records[topic]); err != nil {
+			return fmt.Errorf("topic %s: %v", topic, err)
+		}
+	}
+	return nil
+}
+
+// produce posts records to a topic, failing if the proxy rejects any
+func (k *kafkaPublisher) produce(ctx context.Context, topic string, records []kafkaRecord) error {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaJSON)
+	if k.binary {
+		req.Header.Set("Content-Type", kafkaBinary)
+	}
+	req.Header.Set("Accept", kafkaResponse)
+	if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var offsets kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	for _, o := range offsets.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return fmt.Errorf("record rejected: %s", o.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsTimeout bounds connecting to a NATS server and each publish
+const natsTimeout = 10 * time.Second
+
+// natsPort is the default NATS client port
+const natsPort = "4222"
+
+// natsInfo is the part of a server's INFO message the client uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT message
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// natsPublisher publishes messages to NATS subjects over the text protocol,
+// keeping a connection open between batches. NATS doesn't key messages:
+// each repository's events are kept in order by publishing in order.
+type natsPublisher struct {
+	address string
+	tls     bool
+	host    string
+	connect natsConnect
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newNATS creates a NATS publisher; credentials in the URL are used when
+// the configuration has none
+func newNATS(c PublisherConfig) (*natsPublisher, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid url %q, want nats://host:port or tls://host:port", c.URL)
+	}
+	p := &natsPublisher{
+		address: u.Host,
+		tls:     u.Scheme == "tls",
+		host:    u.Hostname(),
+		connect: natsConnect{Name: "vulnscan", Lang: "go", Version: "1", Protocol: 1,
+			User: c.Username, Pass: c.Password, AuthToken: c.Token},
+	}
+	if u.Port() == "" {
+		p.address = net.JoinHostPort(u.Hostname(), natsPort)
+	}
+	if p.connect.User == "" && p.connect.AuthToken == "" && u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			p.connect.User, p.connect.Pass = u.User.Username(), pass
+		} else {
+			p.connect.AuthToken = u.User.Username()
+		}
+	}
+	return p, nil
+}
+
+// Publish sends a PUB per message and a PING, and waits for the PONG, which
+// the server sends once it has processed the messages. A failure closes the
+// connection so the retry reconnects.
+func (p *natsPublisher) Publish(ctx context.Context, batch []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.dial(ctx); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, m := range batch {
+		fmt.Fprintf(&buf, "PUB %s %d\r\n", m.Topic, len(m.Value))
+		buf.Write(m.Value)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("PING\r\n")
+	p.conn.SetDeadline(time.Now().Add(natsTimeout))
+	_, err := p.conn.Write(buf.Bytes())
+	if err == nil {
+		err = p.pong()
+	}
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+// dial connects to the server: it reads the INFO message, upgrades to TLS
+// when either side requires it, and sends CONNECT, confirmed by a PING
+func (p *natsPublisher) dial(ctx context.Context) error {
+	conn, err := (&net.Dialer{Timeout: natsTimeout}).DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	p.conn, p.r = conn, bufio.NewReader(conn)
+
+	line, err := p.readLine()
+	if err == nil && !strings.HasPrefix(line, "INFO ") {
+		err = fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err == nil {
+		err = json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	}
+	if err == nil && (p.tls || info.TLSRequired) {
+		tc := tls.Client(conn, &tls.Config{ServerName: p.host})
+		if err = tc.HandshakeContext(ctx); err == nil {
+			p.conn, p.r = tc, bufio.NewReader(tc)
+		}
+	}
+	if err == nil {
+		connect := p.connect
+		connect.TLSRequired = p.tls || info.TLSRequired
+		data, _ := json.Marshal(connect)
+		if _, err = fmt.Fprintf(p.conn, "CONNECT %s\r\nPING\r\n", data); err == nil {
+			err = p.pong()
+		}
+	}
+	if err != nil {
+		conn.Close()
+		p.conn = nil
+		return fmt.Errorf("connect to %s: %v", p.address, err)
+	}
+	return nil
+}
+
+// pong reads until the server's PONG, answering its PINGs and returning
+// its errors
+func (p *natsPublisher) pong() error {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
+
+// readLine reads a protocol line without its CRLF
+func (p *natsPublisher) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,191 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Payload is a published event. It is the JSON payload as is; the protobuf
+// payload is a vulnscan.events.v1.Event with the same fields.
+type Payload struct {
+	Event   string          `json:"event"`             // scan_completed or finding_created
+	Time    time.Time       `json:"time"`              // When vulnscan published the event
+	Repo    string          `json:"repo"`              // Repository the event is about
+	Scan    *ScanCompleted  `json:"scan,omitempty"`    // Set for scan_completed
+	Finding *FindingCreated `json:"finding,omitempty"` // Set for finding_created
+}
+
+// ScanCompleted is a scan of a report file that was stored
+type ScanCompleted struct {
+	File            string `json:"file"`
+	ScanID          string `json:"scan_id"`
+	ScanStatus      string `json:"scan_status,omitempty"`
+	Incomplete      bool   `json:"incomplete,omitempty"`
+	Vulnerabilities int    `json:"vulnerabilities"` // Vulnerabilities stored
+	Resolved        int    `json:"resolved,omitempty"`
+}
+
+// FindingCreated is a vulnerability seen in the repository for the first
+// time
+type FindingCreated struct {
+	ID             string   `json:"id"`
+	Severity       string   `json:"severity"`
+	CVSS           float64  `json:"cvss"`
+	PackageName    string   `json:"package_name"`
+	CurrentVersion string   `json:"current_version"`
+	FixedVersion   string   `json:"fixed_version,omitempty"`
+	Ecosystem      string   `json:"ecosystem,omitempty"`
+	PURL           string   `json:"purl,omitempty"`
+	Location       string   `json:"location,omitempty"`
+	Fingerprint    string   `json:"fingerprint,omitempty"`
+	Link           string   `json:"link,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Aliases        []string `json:"aliases,omitempty"`
+}
+
+// newPayload converts a scan or finding event into the published event
+func newPayload(name string, e events.Event) (*Payload, error) {
+	p := &Payload{Event: name, Time: e.Time.UTC(), Repo: e.Repo}
+	switch name {
+	case EventScanCompleted:
+		p.Scan = &ScanCompleted{}
+		return p, e.DecodeData(p.Scan)
+	case EventFindingCreated:
+		var v models.Vulnerability
+		if err := e.DecodeData(&v); err != nil {
+			return nil, err
+		}
+		p.Finding = &FindingCreated{
+			ID:             v.CVEID,
+			Severity:       v.Severity,
+			CVSS:           v.CVSS,
+			PackageName:    v.PackageName,
+			CurrentVersion: v.CurrentVersion,
+			FixedVersion:   v.FixedVersion,
+			Ecosystem:      v.Ecosystem,
+			PURL:           v.PURL,
+			Location:       v.Location,
+			Fingerprint:    v.Fingerprint,
+			Link:           v.Link,
+			Description:    v.Description,
+			Aliases:        v.Aliases,
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown event %q", name)
+}
+
+// encode returns the payload in a format
+func (p *Payload) encode(format string) ([]byte, error) {
+	if format == FormatProtobuf {
+		return p.MarshalProto(), nil
+	}
+	return json.Marshal(p)
+}
+
+// Field numbers of events.proto
+const (
+	eventName          = 1
+	eventTimeUnixMilli = 2
+	eventRepo          = 3
+	eventScan          = 10
+	eventFinding       = 11
+
+	scanFile            = 1
+	scanID              = 2
+	scanStatus          = 3
+	scanIncomplete      = 4
+	scanVulnerabilities = 5
+	scanResolved        = 6
+
+	findingID             = 1
+	findingSeverity       = 2
+	findingCVSS           = 3
+	findingPackageName    = 4
+	findingCurrentVersion = 5
+	findingFixedVersion   = 6
+	findingEcosystem      = 7
+	findingPURL           = 8
+	findingLocation       = 9
+	findingFingerprint    = 10
+	findingLink           = 11
+	findingDescription    = 12
+	findingAliases        = 13
+)
+
+// MarshalProto encodes the payload as a vulnscan.events.v1.Event message.
+// Fields with their zero value are omitted, as proto3 does.
+func (p *Payload) MarshalProto() []byte {
+	var b []byte
+	b = appendString(b, eventName, p.Event)
+	b = appendVarint(b, eventTimeUnixMilli, uint64(p.Time.UnixMilli()))
+	b = appendString(b, eventRepo, p.Repo)
+	if s := p.Scan; s != nil {
+		var m []byte
+		m = appendString(m, scanFile, s.File)
+		m = appendString(m, scanID, s.ScanID)
+		m = appendString(m, scanStatus, s.ScanStatus)
+		if s.Incomplete {
+			m = appendVarint(m, scanIncomplete, 1)
+		}
+		m = appendVarint(m, scanVulnerabilities, uint64(s.Vulnerabilities))
+		m = appendVarint(m, scanResolved, uint64(s.Resolved))
+		b = appendMessage(b, eventScan, m)
+	}
+	if f := p.Finding; f != nil {
+		var m []byte
+		m = appendString(m, findingID, f.ID)
+		m = appendString(m, findingSeverity, f.Severity)
+		if f.CVSS != 0 {
+			m = protowire.AppendTag(m, findingCVSS, protowire.Fixed64Type)
+			m = protowire.AppendFixed64(m, math.Float64bits(f.CVSS))
+		}
+		m = appendString(m, findingPackageName, f.PackageName)
+		m = appendString(m, findingCurrentVersion, f.CurrentVersion)
+		m = appendString(m, findingFixedVersion, f.FixedVersion)
+		m = appendString(m, findingEcosystem, f.Ecosystem)
+		m = appendString(m, findingPURL, f.PURL)
+		m = appendString(m, findingLocation, f.Location)
+		m = appendString(m, findingFingerprint, f.Fingerprint)
+		m = appendString(m, findingLink, f.Link)
+		m = appendString(m, findingDescription, f.Description)
+		for _, alias := range f.Aliases {
+			m = protowire.AppendTag(m, findingAliases, protowire.BytesType)
+			m = protowire.AppendString(m, alias)
+		}
+		b = appendMessage(b, eventFinding, m)
+	}
+	return b
+}
+
+// appendString appends a string field unless it is empty
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendVarint appends an integer field unless it is zero
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMessage appends an embedded message field, even an empty one, so
+// the oneof is set
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
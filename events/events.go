@@ -0,0 +1,136 @@
+package events
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published by the ingest pipeline
+const (
+	TypeScan          = "scan"          // A scan file was ingested
+	TypeVulnerability = "vulnerability" // A critical/high vulnerability was ingested
+	TypeFinding       = "finding"       // A vulnerability of any severity was seen in a repository for the first time
+	TypeScanFailed    = "scan_failed"   // A scan file could not be fetched, parsed, or stored
+)
+
+// Operational event types, about the health of the service rather than of
+// the scanned repositories
+const (
+	TypeFetchFailures  = "fetch_failures"  // A repository's files failed to download several times in a row
+	TypeScanStuck      = "scan_stuck"      // A bulk scan has been running longer than expected
+	TypeDatabaseError  = "database_error"  // Ingest results could not be stored
+	TypeUpstreamOutage = "upstream_outage" // An upstream host's circuit breaker opened, or closed again
+)
+
+// Event is a single notification delivered to subscribers
+type Event struct {
+	Type     string      `json:"type"`               // Event type
+	Repo     string      `json:"repo"`               // Repository the event relates to
+	Severity string      `json:"severity,omitempty"` // Vulnerability severity (vulnerability and finding events only)
+	Time     time.Time   `json:"time"`               // Time the event was published
+	Data     interface{} `json:"data"`               // Event payload
+}
+
+// DecodeData converts the event's payload into out via JSON, e.g. back into
+// the type it was published as
+func (e Event) DecodeData(out interface{}) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Filter restricts which events a subscriber receives. Empty fields match everything.
+type Filter struct {
+	Types      []string // Event types to receive
+	Severities []string // Vulnerability and finding severities to receive (case-insensitive)
+	Repo       string   // Repository to receive events for
+}
+
+// Matches reports whether the event passes the filter
+func (f Filter) Matches(e Event) bool {
+	if len(f.Types) > 0 && !slices.ContainsFunc(f.Types, func(v string) bool { return strings.EqualFold(v, e.Type) }) {
+		return false
+	}
+	if len(f.Severities) > 0 && (e.Type == TypeVulnerability || e.Type == TypeFinding) && !slices.ContainsFunc(f.Severities, func(v string) bool { return strings.EqualFold(v, e.Severity) }) {
+		return false
+	}
+	if f.Repo != "" && f.Repo != e.Repo {
+		return false
+	}
+	return true
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag before drops
+const subscriberBuffer = 64
+
+// subscription is a registered subscriber channel and its filter
+type subscription struct {
+	ch     chan Event
+	filter Filter
+}
+
+// Broker fans published events out to subscribers. Publishing never blocks:
+// events are dropped for subscribers whose buffers are full.
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*subscription]struct{})}
+}
+
+// Default is the process-wide broker used by handlers
+var Default = NewBroker()
+
+// Subscribe registers a subscriber. The returned cancel function must be
+// called to release the subscription; it closes the channel.
+func (b *Broker) Subscribe(filter Filter) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, subscriberBuffer), filter: filter}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// Publish delivers the event to every matching subscriber
+func (b *Broker) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default: // Subscriber is too slow; drop rather than stall ingest
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
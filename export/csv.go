@@ -0,0 +1,49 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// WriteCSV writes a header row and one row per finding. Text that a
+// spreadsheet would evaluate as a formula is prefixed with a quote.
+func WriteCSV(w io.Writer, vulns []models.Vulnerability, cols []Column) error {
+	cw := csv.NewWriter(w)
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = col.Header
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	for _, v := range vulns {
+		for i, col := range cols {
+			row[i] = csvCell(col.Value(v))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell formats a column value as CSV text
+func csvCell(value interface{}) string {
+	switch val := value.(type) {
+	case string:
+		if val != "" && strings.ContainsRune("=+-@\t\r", rune(val[0])) {
+			return "'" + val
+		}
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return ""
+}
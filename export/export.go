@@ -0,0 +1,102 @@
+// Package export writes query results as spreadsheets (CSV and Excel .xlsx)
+// with a configurable set of columns.
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Media types selecting each export format
+const (
+	CSVMediaType  = "text/csv"
+	XLSXMediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Column is one exported field of a finding. Value returns a string,
+// float64, bool, or nil for an empty cell.
+type Column struct {
+	Name   string // Name used to select the column, matching the JSON field
+	Header string // Header row label
+	Value  func(v models.Vulnerability) interface{}
+}
+
+// Columns lists every exportable column, in the order they appear in the
+// JSON response
+var Columns = []Column{
+	{"finding_id", "Finding ID", func(v models.Vulnerability) interface{} { return float64(v.FindingID) }},
+	{"id", "ID", func(v models.Vulnerability) interface{} { return v.CVEID }},
+	{"severity", "Severity", func(v models.Vulnerability) interface{} { return v.Severity }},
+	{"effective_severity", "Effective Severity", func(v models.Vulnerability) interface{} { return v.EffectiveSeverity }},
+	{"nvd_severity", "NVD Severity", func(v models.Vulnerability) interface{} { return v.NVDSeverity }},
+	{"override_severity", "Override Severity", func(v models.Vulnerability) interface{} { return v.OverrideSeverity }},
+	{"cvss", "CVSS", func(v models.Vulnerability) interface{} { return v.CVSS }},
+	{"status", "Status", func(v models.Vulnerability) interface{} { return v.Status }},
+	{"package_name", "Package", func(v models.Vulnerability) interface{} { return v.PackageName }},
+	{"current_version", "Installed Version", func(v models.Vulnerability) interface{} { return v.CurrentVersion }},
+	{"fixed_version", "Fixed Version", func(v models.Vulnerability) interface{} { return v.FixedVersion }},
+	{"description", "Description", func(v models.Vulnerability) interface{} { return v.Description }},
+	{"published_date", "Published", func(v models.Vulnerability) interface{} {
+		if v.PublishedDate.IsZero() {
+			return nil
+		}
+		return v.PublishedDate.Format("2006-01-02")
+	}},
+	{"link", "Link", func(v models.Vulnerability) interface{} { return v.Link }},
+	{"risk_factors", "Risk Factors", func(v models.Vulnerability) interface{} { return strings.Join(v.RiskFactors, "; ") }},
+	{"ecosystem", "Ecosystem", func(v models.Vulnerability) interface{} { return v.Ecosystem }},
+	{"purl", "Package URL", func(v models.Vulnerability) interface{} { return v.PURL }},
+	{"location", "Location", func(v models.Vulnerability) interface{} { return v.Location }},
+	{"fingerprint", "Fingerprint", func(v models.Vulnerability) interface{} { return v.Fingerprint }},
+	{"triage_status", "Triage Status", func(v models.Vulnerability) interface{} { return v.TriageStatus }},
+	{"assignee", "Assignee", func(v models.Vulnerability) interface{} { return v.Assignee }},
+	{"jira_issue", "Jira Issue", func(v models.Vulnerability) interface{} { return v.JiraIssue }},
+	{"epss", "EPSS", func(v models.Vulnerability) interface{} { return optional(v.EPSS) }},
+	{"epss_percentile", "EPSS Percentile", func(v models.Vulnerability) interface{} { return optional(v.EPSSPercentile) }},
+	{"kev", "Known Exploited", func(v models.Vulnerability) interface{} { return v.KEV }},
+	{"aliases", "Aliases", func(v models.Vulnerability) interface{} { return strings.Join(v.Aliases, "; ") }},
+}
+
+// DefaultColumns are exported when a request names no columns
+var DefaultColumns = []string{
+	"id", "severity", "cvss", "epss", "kev", "package_name", "current_version",
+	"fixed_version", "triage_status", "assignee", "link",
+}
+
+// SelectColumns resolves column names, returning DefaultColumns when names
+// is empty and an error naming any unknown column
+func SelectColumns(names []string) ([]Column, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	cols := make([]Column, 0, len(names))
+	for _, name := range names {
+		col, ok := lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// lookup finds a column by name, ignoring case and surrounding space
+func lookup(name string) (Column, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, col := range Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// optional dereferences an optional number, leaving missing values empty
+func optional(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
@@ -0,0 +1,132 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Static parts of a single-sheet workbook (Office Open XML, ECMA-376)
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Vulnerabilities" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	// Style 1 is the bold header row
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// WriteXLSX writes an Excel workbook with a single sheet holding a header
+// row and one row per finding. Numbers and booleans are stored as typed
+// cells so they sort and filter as such.
+func WriteXLSX(w io.Writer, vulns []models.Vulnerability, cols []Column) error {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Keep the header row in view while scrolling
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sb.WriteString(`<sheetData>`)
+	sb.WriteString(`<row r="1">`)
+	for i, col := range cols {
+		xlsxCell(&sb, cellRef(i, 1), col.Header, 1)
+	}
+	sb.WriteString(`</row>`)
+	for n, v := range vulns {
+		r := n + 2
+		sb.WriteString(`<row r="` + strconv.Itoa(r) + `">`)
+		for i, col := range cols {
+			xlsxCell(&sb, cellRef(i, r), col.Value(v), 0)
+		}
+		sb.WriteString(`</row>`)
+		// Flush periodically to bound memory on large exports
+		if sb.Len() > 1<<16 {
+			if _, err := io.WriteString(f, sb.String()); err != nil {
+				return err
+			}
+			sb.Reset()
+		}
+	}
+	sb.WriteString(`</sheetData>`)
+	if len(cols) > 0 {
+		sb.WriteString(`<autoFilter ref="A1:` + cellRef(len(cols)-1, len(vulns)+1) + `"/>`)
+	}
+	sb.WriteString(`</worksheet>`)
+	if _, err := io.WriteString(f, sb.String()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// xlsxCell writes one cell. Empty values are omitted.
+func xlsxCell(sb *strings.Builder, ref string, value interface{}, style int) {
+	attrs := `r="` + ref + `"`
+	if style != 0 {
+		attrs += ` s="` + strconv.Itoa(style) + `"`
+	}
+	switch val := value.(type) {
+	case string:
+		if val == "" {
+			return
+		}
+		sb.WriteString(`<c ` + attrs + ` t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(sb, []byte(val))
+		sb.WriteString(`</t></is></c>`)
+	case float64:
+		sb.WriteString(`<c ` + attrs + `><v>` + strconv.FormatFloat(val, 'f', -1, 64) + `</v></c>`)
+	case bool:
+		b := "0"
+		if val {
+			b = "1"
+		}
+		sb.WriteString(`<c ` + attrs + ` t="b"><v>` + b + `</v></c>`)
+	}
+}
+
+// cellRef returns the A1-style reference of a zero-based column and
+// one-based row, e.g. (27, 3) is "AB3"
+func cellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
@@ -0,0 +1,347 @@
+// Package filterexpr parses boolean filter expressions, such as
+//
+//	severity in (critical, high) AND package_name ~ "openssl*" AND NOT status = "fixed"
+//
+// and compiles them into parameterized SQL conditions over the fields a
+// caller defines. Expressions combine comparisons with AND, OR, NOT, and
+// parentheses; AND binds tighter than OR.
+package filterexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits on an expression, so a request can't make the parser or the
+// database do unbounded work
+const (
+	MaxLength = 4096 // Bytes in an expression
+	MaxDepth  = 32   // Nesting of parentheses and NOT
+)
+
+// Field is a name an expression can compare, and the SQL it stands for
+type Field struct {
+	Column  string // SQL expression of the field's value
+	Numeric bool   // Compared as a number rather than as text
+}
+
+// Error describes an invalid expression
+type Error struct {
+	Offset int    // Byte offset in the expression where the problem is
+	Msg    string // What is wrong
+}
+
+// Error returns the message with its offset
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid filter expression: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Compile parses the expression and returns the SQL condition it stands
+// for, with its arguments. Text comparisons ignore case; ~ matches a glob
+// where * is any run of characters and ? any one character. A comparison
+// of a field whose column is NULL is false, even with != or !~, and NOT of
+// it is true.
+func Compile(expr string, fields map[string]Field) (string, []any, error) {
+	if len(expr) > MaxLength {
+		return "", nil, &Error{Offset: MaxLength, Msg: fmt.Sprintf("longer than %d bytes", MaxLength)}
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+	cond, err := p.or(0)
+	if err != nil {
+		return "", nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return "", nil, &Error{Offset: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return cond, p.args, nil
+}
+
+// Token kinds
+const (
+	tokEOF    = iota
+	tokWord   // Field name, keyword, or bare value
+	tokString // Quoted value
+	tokOp     // Comparison operator
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+// token is a lexical element of an expression
+type token struct {
+	kind int
+	text string // Source text; the unquoted value of a string
+	pos  int    // Byte offset in the expression
+}
+
+// isWordByte reports whether c can appear in a field name or bare value,
+// e.g. pkg:npm/lodash@4.17.21 or openssl*
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("_.-:@/*?+%", c) >= 0
+}
+
+// lex splits the expression into tokens
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, &Error{Offset: i, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokString, b.String(), i})
+			i = j + 1
+		case strings.IndexByte("=!<>~", c) >= 0:
+			op := string(c)
+			if i+1 < len(s) && (s[i+1] == '=' || (c == '!' && s[i+1] == '~')) {
+				op = s[i : i+2]
+			}
+			switch op {
+			case "=", "!=", "<", "<=", ">", ">=", "~", "!~":
+			default:
+				return nil, &Error{Offset: i, Msg: fmt.Sprintf("unknown operator %q", op)}
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		case isWordByte(c):
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, s[i:j], i})
+			i = j
+		default:
+			return nil, &Error{Offset: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(s)}), nil
+}
+
+// parser compiles tokens by recursive descent
+type parser struct {
+	tokens []token
+	i      int
+	fields map[string]Field
+	args   []any
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+// next consumes the next token
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the keyword, consuming it if so
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// or parses terms joined by OR
+func (p *parser) or(depth int) (string, error) {
+	cond, err := p.and(depth)
+	if err != nil {
+		return "", err
+	}
+	terms := []string{cond}
+	for p.keyword("OR") {
+		cond, err := p.and(depth)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, cond)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", nil
+}
+
+// and parses factors joined by AND
+func (p *parser) and(depth int) (string, error) {
+	cond, err := p.not(depth)
+	if err != nil {
+		return "", err
+	}
+	factors := []string{cond}
+	for p.keyword("AND") {
+		cond, err := p.not(depth)
+		if err != nil {
+			return "", err
+		}
+		factors = append(factors, cond)
+	}
+	if len(factors) == 1 {
+		return factors[0], nil
+	}
+	return "(" + strings.Join(factors, " AND ") + ")", nil
+}
+
+// not parses a negated factor, a parenthesized expression, or a comparison
+func (p *parser) not(depth int) (string, error) {
+	if depth >= MaxDepth {
+		return "", &Error{Offset: p.peek().pos, Msg: fmt.Sprintf("nested deeper than %d", MaxDepth)}
+	}
+	if p.keyword("NOT") {
+		cond, err := p.not(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		// A comparison of a missing value is NULL; its negation is true
+		return "NOT COALESCE(" + cond + ", 0)", nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		cond, err := p.or(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return "", &Error{Offset: t.pos, Msg: fmt.Sprintf("expected \")\", found %q", t.text)}
+		}
+		return cond, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses a field compared with a value, or tested against a list
+// with IN or NOT IN
+func (p *parser) comparison() (string, error) {
+	name := p.next()
+	if name.kind != tokWord {
+		return "", &Error{Offset: name.pos, Msg: fmt.Sprintf("expected a field, found %q", name.text)}
+	}
+	field, ok := p.fields[strings.ToLower(name.text)]
+	if !ok {
+		return "", &Error{Offset: name.pos, Msg: fmt.Sprintf("unknown field %q", name.text)}
+	}
+
+	negated := p.keyword("NOT")
+	if p.keyword("IN") {
+		return p.in(field, negated)
+	}
+	if negated {
+		t := p.peek()
+		return "", &Error{Offset: t.pos, Msg: fmt.Sprintf("expected IN, found %q", t.text)}
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return "", &Error{Offset: op.pos, Msg: fmt.Sprintf("expected an operator, found %q", op.text)}
+	}
+	switch text := op.text == "~" || op.text == "!~"; {
+	case text && field.Numeric:
+		return "", &Error{Offset: op.pos, Msg: fmt.Sprintf("%s needs a text field, not %q", op.text, name.text)}
+	case !text && op.text != "=" && op.text != "!=" && !field.Numeric:
+		return "", &Error{Offset: op.pos, Msg: fmt.Sprintf("%s needs a numeric field, not %q", op.text, name.text)}
+	}
+	v, err := p.value(field)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case op.text == "~" || op.text == "!~":
+		p.args = append(p.args, globToLike(v.(string)))
+		like := " LIKE "
+		if op.text == "!~" {
+			like = " NOT LIKE "
+		}
+		return "(" + field.Column + like + "? ESCAPE '\\')", nil
+	case field.Numeric:
+		p.args = append(p.args, v)
+		return "(" + field.Column + " " + op.text + " ?)", nil
+	default:
+		p.args = append(p.args, v)
+		return "(" + field.Column + " " + op.text + " ? COLLATE NOCASE)", nil
+	}
+}
+
+// in parses the parenthesized list of IN
+func (p *parser) in(field Field, negated bool) (string, error) {
+	if t := p.next(); t.kind != tokLParen {
+		return "", &Error{Offset: t.pos, Msg: fmt.Sprintf("expected \"(\", found %q", t.text)}
+	}
+	var marks []string
+	for {
+		v, err := p.value(field)
+		if err != nil {
+			return "", err
+		}
+		p.args = append(p.args, v)
+		marks = append(marks, "?")
+		t := p.next()
+		if t.kind == tokRParen {
+			break
+		}
+		if t.kind != tokComma {
+			return "", &Error{Offset: t.pos, Msg: fmt.Sprintf("expected \",\" or \")\", found %q", t.text)}
+		}
+	}
+	in := " IN "
+	if negated {
+		in = " NOT IN "
+	}
+	column := field.Column
+	if !field.Numeric {
+		column += " COLLATE NOCASE"
+	}
+	return "(" + column + in + "(" + strings.Join(marks, ", ") + "))", nil
+}
+
+// value parses a value for the field: a number for numeric fields, a bare
+// word or quoted string for text fields
+func (p *parser) value(field Field) (any, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return nil, &Error{Offset: t.pos, Msg: fmt.Sprintf("expected a value, found %q", t.text)}
+	}
+	if !field.Numeric {
+		return t.text, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, &Error{Offset: t.pos, Msg: fmt.Sprintf("expected a number, found %q", t.text)}
+	}
+	return n, nil
+}
+
+// globToLike converts a glob to a LIKE pattern escaped with backslashes
+func globToLike(glob string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%", "?", "_").Replace(glob)
+}
@@ -0,0 +1,143 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+// cycloneDXComponent is a (possibly nested) CycloneDX component
+type cycloneDXComponent struct {
+	BOMRef     string               `json:"bom-ref"`
+	Type       string               `json:"type"`
+	Name       string               `json:"name"`
+	Group      string               `json:"group"`
+	Version    string               `json:"version"`
+	PURL       string               `json:"purl"`
+	Licenses   []cycloneDXLicense   `json:"licenses"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// cycloneDXLicense is a license choice: a license by SPDX ID or name, or an
+// SPDX expression
+type cycloneDXLicense struct {
+	License struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"license"`
+	Expression string `json:"expression"`
+}
+
+// cycloneDXExpression combines a component's licenses into one SPDX
+// expression; several listed licenses all apply
+func cycloneDXExpression(licenses []cycloneDXLicense) string {
+	var parts []string
+	for _, l := range licenses {
+		expr := l.Expression
+		if expr == "" {
+			expr = l.License.ID
+		}
+		if expr == "" {
+			expr = l.License.Name
+		}
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		if len(licenses) > 1 && strings.Contains(expr, " ") {
+			expr = "(" + expr + ")"
+		}
+		parts = append(parts, expr)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// cycloneDXBOM mirrors the subset of a CycloneDX JSON BOM we ingest
+type cycloneDXBOM struct {
+	BOMFormat    string `json:"bomFormat"`
+	SerialNumber string `json:"serialNumber"`
+	Metadata     struct {
+		Timestamp timestamp          `json:"timestamp"`
+		Component cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+	Dependencies []struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	} `json:"dependencies"`
+}
+
+// cycloneDXAdapter maps CycloneDX JSON SBOMs into component lists
+type cycloneDXAdapter struct{}
+
+// Name identifies the format
+func (cycloneDXAdapter) Name() string { return "cyclonedx" }
+
+// Detect matches objects declaring bomFormat CycloneDX
+func (cycloneDXAdapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"CycloneDX"`))
+}
+
+// Parse flattens the component tree into a single scan result
+func (cycloneDXAdapter) Parse(content []byte) ([]models.ScanResult, error) {
+	var bom cycloneDXBOM
+	if err := json.Unmarshal(content, &bom); err != nil {
+		return nil, err
+	}
+
+	result := models.ScanResult{
+		ScanID:       "cyclonedx:" + bom.SerialNumber,
+		Timestamp:    bom.Metadata.Timestamp.Time,
+		ScanStatus:   "completed",
+		ResourceType: "sbom",
+		ResourceName: bom.Metadata.Component.Name,
+	}
+	if bom.SerialNumber == "" {
+		result.ScanID = "cyclonedx:" + bom.Metadata.Component.Name
+	}
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+
+	var walk func([]cycloneDXComponent)
+	walk = func(components []cycloneDXComponent) {
+		for _, c := range components {
+			name := c.Name
+			if c.Group != "" {
+				name = c.Group + "/" + c.Name
+			}
+			if c.PURL != "" {
+				name = purl.Name(c.PURL)
+			}
+			result.Components = append(result.Components, models.Component{
+				Name:      name,
+				Version:   c.Version,
+				Ecosystem: purl.Ecosystem(c.PURL),
+				PURL:      c.PURL,
+				Type:      c.Type,
+				License:   cycloneDXExpression(c.Licenses),
+				Ref:       c.BOMRef,
+			})
+			walk(c.Components)
+		}
+	}
+	walk(bom.Components)
+
+	// Edges from the BOM's own component are the top-level dependencies
+	root := bom.Metadata.Component.BOMRef
+	for _, d := range bom.Dependencies {
+		parent := d.Ref
+		if parent == root && root != "" {
+			parent = ""
+		}
+		for _, child := range d.DependsOn {
+			result.Dependencies = append(result.Dependencies, models.Dependency{Parent: parent, Child: child})
+		}
+	}
+
+	return []models.ScanResult{result}, nil
+}
@@ -0,0 +1,182 @@
+// Package formats detects scanner report formats and converts them into the
+// canonical models.ScanResult representation stored by vulnscan.
+package formats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// ErrUnknownFormat is returned when no registered adapter recognizes a report
+var ErrUnknownFormat = errs.New(errs.ErrParse, "unrecognized report format")
+
+// Adapter converts one scanner report format into scan results
+type Adapter interface {
+	// Name identifies the format (e.g. "trivy")
+	Name() string
+	// Detect reports whether content looks like this format
+	Detect(content []byte) bool
+	// Parse converts content into scan results
+	Parse(content []byte) ([]models.ScanResult, error)
+}
+
+// LenientAdapter is an Adapter that can skip malformed vulnerability entries
+// instead of rejecting the whole report
+type LenientAdapter interface {
+	Adapter
+	// ParseLenient is Parse, except that vulnerability entries that fail to
+	// decode or lack an identifier are skipped and reported as warnings
+	ParseLenient(content []byte) ([]models.ScanResult, []Warning, error)
+}
+
+// Warning describes a vulnerability entry skipped by lenient parsing, or
+// a problem with a report that was still ingested
+type Warning struct {
+	Index  int    // Position of the entry among the report's vulnerability entries, from 0; -1 for the whole report
+	Reason string // Why the entry was skipped, or what is wrong with the report
+}
+
+var (
+	mu       sync.RWMutex
+	adapters []Adapter // Consulted in registration order
+)
+
+// Register adds an adapter. Adapters registered earlier take precedence, so
+// specific formats should register before permissive ones.
+func Register(a Adapter) {
+	mu.Lock()
+	defer mu.Unlock()
+	adapters = append(adapters, a)
+}
+
+// Parse detects the report format and converts content into scan results
+func Parse(content []byte) (string, []models.ScanResult, error) {
+	format, results, _, err := parse(content, false)
+	return format, results, err
+}
+
+// ParseLenient is Parse, skipping malformed vulnerability entries of formats
+// that support it and returning a warning for each
+func ParseLenient(content []byte) (string, []models.ScanResult, []Warning, error) {
+	return parse(content, true)
+}
+
+// parse converts content with the first adapter that detects it
+func parse(content []byte, lenient bool) (string, []models.ScanResult, []Warning, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, a := range adapters {
+		if !a.Detect(content) {
+			continue
+		}
+		var (
+			results  []models.ScanResult
+			warnings []Warning
+			err      error
+		)
+		if la, ok := a.(LenientAdapter); ok && lenient {
+			results, warnings, err = la.ParseLenient(content)
+		} else {
+			results, err = a.Parse(content)
+		}
+		if err != nil {
+			return a.Name(), nil, nil, fmt.Errorf("invalid %s report: %v", a.Name(), err)
+		}
+		normalizeTimes(results)
+		return a.Name(), results, warnings, nil
+	}
+	return "", nil, nil, ErrUnknownFormat
+}
+
+// entryDecoder decodes a report's vulnerability entries in document order.
+// Strictly, a malformed entry fails the report; leniently, it is skipped
+// with a warning.
+type entryDecoder struct {
+	lenient  bool
+	next     int // Index of the next entry
+	warnings []Warning
+}
+
+// decode unmarshals one entry into v and reports whether to keep it. id
+// reads the entry's identifier once decoded; leniently, an entry without
+// one is malformed.
+func (d *entryDecoder) decode(raw json.RawMessage, v interface{}, id func() string) (bool, error) {
+	index := d.next
+	d.next++
+
+	err := json.Unmarshal(raw, v)
+	if err == nil && d.lenient && id() == "" {
+		err = errors.New("missing vulnerability identifier")
+	}
+	switch {
+	case err == nil:
+		return true, nil
+	case d.lenient:
+		d.warnings = append(d.warnings, Warning{Index: index, Reason: err.Error()})
+		return false, nil
+	default:
+		return false, fmt.Errorf("vulnerability %d: %v", index, err)
+	}
+}
+
+// knownKeys caches the JSON keys each entry type decodes, lower-cased
+var knownKeys sync.Map // reflect.Type -> map[string]bool
+
+// extraFields returns the fields of a decoded entry that v, a pointer to
+// the struct it was decoded into, has no field for. Keys match ignoring
+// case, as in decoding.
+func extraFields(raw json.RawMessage, v interface{}) models.RawFields {
+	var fields models.RawFields
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	t := reflect.TypeOf(v).Elem()
+	known, ok := knownKeys.Load(t)
+	if !ok {
+		known, _ = knownKeys.LoadOrStore(t, structKeys(t, make(map[string]bool)))
+	}
+	for k := range fields {
+		if known.(map[string]bool)[strings.ToLower(k)] {
+			delete(fields, k)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// structKeys adds the lower-cased JSON keys of the struct's fields,
+// including those of embedded structs, to keys
+func structKeys(t reflect.Type, keys map[string]bool) map[string]bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			structKeys(f.Type, keys)
+		case name != "":
+			keys[strings.ToLower(name)] = true
+		case f.IsExported():
+			keys[strings.ToLower(f.Name)] = true
+		}
+	}
+	return keys
+}
+
+func init() {
+	// Specific formats first; the native format is the permissive fallback
+	Register(trivyAdapter{})
+	Register(cycloneDXAdapter{})
+	Register(spdxAdapter{})
+	Register(nativeAdapter{})
+}
@@ -0,0 +1,381 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+// manifest extracts the dependencies declared by one kind of package manifest
+type manifest struct {
+	name      string                                      // Format name, e.g. "gomod"
+	ecosystem string                                      // OSV ecosystem of the dependencies
+	match     func(base string) bool                      // Reports whether a file name is this manifest
+	parse     func(content []byte) (string, []dep, error) // Returns the project name and dependencies
+}
+
+// dep is one declared dependency version
+type dep struct {
+	name, version, license string
+	parents                []string // Refs of the dependencies requiring it, "" for the project
+}
+
+// ref identifies a dependency version in dependency edges
+func (d dep) ref() string {
+	return d.name + "@" + d.version
+}
+
+// manifests are matched by file name, since their content is not
+// self-describing the way scanner reports are
+var manifests = []manifest{
+	{name: "gomod", ecosystem: "Go", match: equals("go.mod"), parse: parseGoMod},
+	{name: "npm-lock", ecosystem: "npm", match: equals("package-lock.json"), parse: parsePackageLock},
+	{name: "requirements", ecosystem: "PyPI", match: isRequirements, parse: parseRequirements},
+}
+
+// ParseFile converts a fetched file into scan results. Dependency manifests
+// (go.mod, package-lock.json, requirements*.txt) are recognized by name and
+// become component lists for OSV correlation; anything else goes through
+// Parse.
+func ParseFile(filePath string, content []byte) (string, []models.ScanResult, error) {
+	format, results, _, err := parseFile(filePath, content, false)
+	return format, results, err
+}
+
+// ParseFileLenient is ParseFile, skipping malformed vulnerability entries of
+// scanner reports as ParseLenient does. Manifests list no vulnerabilities, so
+// they parse as in ParseFile.
+func ParseFileLenient(filePath string, content []byte) (string, []models.ScanResult, []Warning, error) {
+	return parseFile(filePath, content, true)
+}
+
+// parseFile converts a fetched file as a manifest or a scanner report
+func parseFile(filePath string, content []byte, lenient bool) (string, []models.ScanResult, []Warning, error) {
+	base := path.Base(filePath)
+	for _, m := range manifests {
+		if !m.match(base) {
+			continue
+		}
+		project, deps, err := m.parse(content)
+		if err != nil {
+			return m.name, nil, nil, fmt.Errorf("invalid %s manifest: %v", m.name, err)
+		}
+		if project == "" {
+			project = filePath
+		}
+
+		result := models.ScanResult{
+			ScanID:       m.name + ":" + filePath,
+			Timestamp:    time.Now().UTC(),
+			ScanStatus:   "completed",
+			ResourceType: "manifest",
+			ResourceName: project,
+		}
+		seen := make(map[string]map[string]bool) // Parents recorded per ref
+		for _, d := range deps {
+			if d.name == "" || d.version == "" {
+				continue
+			}
+			ref := d.ref()
+			known, dup := seen[ref]
+			if !dup {
+				known = make(map[string]bool)
+				seen[ref] = known
+			}
+			for _, parent := range d.parents {
+				if !known[parent] {
+					known[parent] = true
+					result.Dependencies = append(result.Dependencies, models.Dependency{Parent: parent, Child: ref})
+				}
+			}
+			if dup {
+				continue
+			}
+			result.Components = append(result.Components, models.Component{
+				Name:      d.name,
+				Version:   d.version,
+				Ecosystem: m.ecosystem,
+				PURL:      purl.Build(m.ecosystem, d.name, d.version),
+				Type:      "library",
+				License:   d.license,
+				Ref:       ref,
+			})
+		}
+		result.Timestamp = normalizeTime(result.Timestamp)
+		return m.name, []models.ScanResult{result}, nil, nil
+	}
+	return parse(content, lenient)
+}
+
+// equals matches one exact file name
+func equals(name string) func(string) bool {
+	return func(base string) bool { return base == name }
+}
+
+// isRequirements matches requirements.txt and variants like
+// requirements-dev.txt
+func isRequirements(base string) bool {
+	return strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt")
+}
+
+// parseGoMod reads the module path and require directives of a go.mod file,
+// applying version replacements
+func parseGoMod(content []byte) (string, []dep, error) {
+	var (
+		module   string
+		deps     []dep
+		replaces = make(map[string]dep)
+		block    string // Directive of the enclosing ( ... ) block
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text, comment, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		directive := block
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			directive, fields = fields[0], fields[1:]
+		}
+
+		switch directive {
+		case "module":
+			if len(fields) != 1 {
+				return "", nil, fmt.Errorf("line %d: malformed module directive", line)
+			}
+			module = strings.Trim(fields[0], `"`)
+		case "require":
+			if len(fields) != 2 {
+				return "", nil, fmt.Errorf("line %d: malformed require directive", line)
+			}
+			d := dep{name: strings.Trim(fields[0], `"`), version: fields[1]}
+			if strings.TrimSpace(comment) != "indirect" {
+				d.parents = []string{""} // Required by the module itself
+			}
+			deps = append(deps, d)
+		case "replace":
+			// old [v] => new [v]; only replacements by another module version
+			// change what is built, local directories have no version
+			i := indexOf(fields, "=>")
+			if i < 1 || i == len(fields)-1 {
+				return "", nil, fmt.Errorf("line %d: malformed replace directive", line)
+			}
+			if to := fields[i+1:]; len(to) == 2 {
+				replaces[fields[0]] = dep{name: to[0], version: to[1]}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if block != "" {
+		return "", nil, fmt.Errorf("unterminated %s block", block)
+	}
+
+	for i, d := range deps {
+		if r, ok := replaces[d.name]; ok {
+			r.parents = d.parents
+			deps[i] = r
+		}
+	}
+	return module, deps, nil
+}
+
+// indexOf returns the index of s in list, or -1
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// packageLock mirrors the subset of an npm package-lock.json we read. Lockfile
+// versions 2 and 3 list every installed package under "packages"; version 1
+// only has the nested "dependencies" tree.
+type packageLock struct {
+	Name            string                    `json:"name"`
+	LockfileVersion int                       `json:"lockfileVersion"`
+	Packages        map[string]lockPackage    `json:"packages"`
+	Dependencies    map[string]lockDependency `json:"dependencies"`
+}
+
+// lockPackage is a lockfile version 2 or 3 package entry, keyed by its
+// install path
+type lockPackage struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Link                 bool              `json:"link"`
+	License              json.RawMessage   `json:"license"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+}
+
+// requires lists the names of the packages p depends on
+func (p lockPackage) requires() []string {
+	var names []string
+	for _, m := range []map[string]string{p.Dependencies, p.DevDependencies, p.OptionalDependencies, p.PeerDependencies} {
+		for name := range m {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveLockPath finds the install path a package at from loads name from,
+// searching node_modules directories upward like Node's resolver
+func resolveLockPath(packages map[string]lockPackage, from, name string) (string, bool) {
+	dir := from
+	for {
+		candidate := "node_modules/" + name
+		if dir != "" {
+			candidate = dir + "/" + candidate
+		}
+		if _, ok := packages[candidate]; ok {
+			return candidate, true
+		}
+		if dir == "" {
+			return "", false
+		}
+		if i := strings.LastIndex(dir, "/node_modules/"); i >= 0 {
+			dir = dir[:i]
+		} else {
+			dir = ""
+		}
+	}
+}
+
+// lockDependency is a lockfile version 1 dependency entry
+type lockDependency struct {
+	Version      string                    `json:"version"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+// parsePackageLock reads every installed package of an npm lockfile
+func parsePackageLock(content []byte) (string, []dep, error) {
+	var lock packageLock
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return "", nil, err
+	}
+	if lock.LockfileVersion == 0 {
+		return "", nil, fmt.Errorf("missing lockfileVersion")
+	}
+
+	var deps []dep
+	if len(lock.Packages) > 0 {
+		byPath := make(map[string]*dep)
+		for key, p := range lock.Packages {
+			// The root project is keyed "", workspace links have no version
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || p.Link {
+				continue
+			}
+			name := p.Name
+			if name == "" {
+				name = key[i+len("node_modules/"):]
+			}
+			byPath[key] = &dep{name: name, version: p.Version, license: lockLicense(p.License)}
+		}
+
+		// Link each package to the installed copies of what it requires
+		for key, p := range lock.Packages {
+			parent, ok := "", key == ""
+			if d := byPath[key]; d != nil {
+				parent, ok = d.ref(), true
+			}
+			if !ok {
+				continue
+			}
+			for _, name := range p.requires() {
+				if path, found := resolveLockPath(lock.Packages, key, name); found && byPath[path] != nil {
+					byPath[path].parents = append(byPath[path].parents, parent)
+				}
+			}
+		}
+		for _, d := range byPath {
+			sort.Strings(d.parents)
+			deps = append(deps, *d)
+		}
+	} else {
+		var walk func(map[string]lockDependency)
+		walk = func(m map[string]lockDependency) {
+			for name, d := range m {
+				deps = append(deps, dep{name: name, version: d.Version})
+				walk(d.Dependencies)
+			}
+		}
+		walk(lock.Dependencies)
+	}
+
+	// Map iteration order is random; keep stored components stable
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].name != deps[j].name {
+			return deps[i].name < deps[j].name
+		}
+		return deps[i].version < deps[j].version
+	})
+	return lock.Name, deps, nil
+}
+
+// lockLicense reads a package's license, which is usually an SPDX
+// expression string but is an object in some legacy packages
+func lockLicense(raw json.RawMessage) string {
+	var expr string
+	if json.Unmarshal(raw, &expr) == nil {
+		return expr
+	}
+	var legacy struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(raw, &legacy)
+	return legacy.Type
+}
+
+// requirementPattern matches a pinned requirement: name, optional extras,
+// and an exact == or === version
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*===?\s*([^\s;,#]+)`)
+
+// pep503Separators are collapsed to "-" when normalizing PyPI names
+var pep503Separators = regexp.MustCompile(`[-_.]+`)
+
+// parseRequirements reads the pinned requirements of a pip requirements
+// file. Unpinned requirements, options, and includes are skipped since they
+// don't name a single version to look up.
+func parseRequirements(content []byte) (string, []dep, error) {
+	var deps []dep
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "-") {
+			continue
+		}
+		m := requirementPattern.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		name := pep503Separators.ReplaceAllString(strings.ToLower(m[1]), "-")
+		deps = append(deps, dep{name: name, version: m[2]})
+	}
+	return "", deps, scanner.Err()
+}
@@ -0,0 +1,100 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// nativeAdapter parses vulnscan's own scanResults format: either a JSON array
+// of {"scanResults": {...}} objects or a single such object
+type nativeAdapter struct{}
+
+// Name identifies the format
+func (nativeAdapter) Name() string { return "native" }
+
+// Detect accepts any JSON array, or an object carrying scanResults
+func (nativeAdapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 {
+		return false
+	}
+	if trimmed[0] == '[' {
+		return true
+	}
+	return trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"scanResults"`))
+}
+
+// nativeScanFile is a ScanFile as written in reports: its times may use any
+// accepted layout, and its vulnerability entries are decoded one at a time
+type nativeScanFile struct {
+	ScanResults struct {
+		models.ScanResult
+		Timestamp       timestamp         `json:"timestamp"`
+		Vulnerabilities []json.RawMessage `json:"vulnerabilities"`
+	} `json:"scanResults"`
+}
+
+// nativeVulnerability is a Vulnerability as written in reports
+type nativeVulnerability struct {
+	models.Vulnerability
+	PublishedDate timestamp `json:"published_date"`
+}
+
+// Parse decodes the scan files and returns their results
+func (nativeAdapter) Parse(content []byte) ([]models.ScanResult, error) {
+	results, _, err := parseNative(content, false)
+	return results, err
+}
+
+// ParseLenient is Parse, skipping malformed vulnerabilities
+func (nativeAdapter) ParseLenient(content []byte) ([]models.ScanResult, []Warning, error) {
+	return parseNative(content, true)
+}
+
+// parseNative decodes the scan files, decoding vulnerabilities leniently or
+// strictly
+func parseNative(content []byte, lenient bool) ([]models.ScanResult, []Warning, error) {
+	var scanFiles []nativeScanFile
+	if bytes.TrimSpace(content)[0] == '{' {
+		var single nativeScanFile
+		if err := json.Unmarshal(content, &single); err != nil {
+			return nil, nil, err
+		}
+		scanFiles = append(scanFiles, single)
+	} else if err := json.Unmarshal(content, &scanFiles); err != nil {
+		return nil, nil, err
+	}
+
+	dec := entryDecoder{lenient: lenient}
+	results := make([]models.ScanResult, 0, len(scanFiles))
+	for _, sf := range scanFiles {
+		sr := sf.ScanResults.ScanResult
+		sr.Timestamp = sf.ScanResults.Timestamp.Time
+		for _, raw := range sf.ScanResults.Vulnerabilities {
+			var nv nativeVulnerability
+			keep, err := dec.decode(raw, &nv, func() string { return nv.CVEID })
+			if err != nil {
+				return nil, nil, err
+			}
+			if keep {
+				v := nv.Vulnerability
+				v.PublishedDate = nv.PublishedDate.Time
+				// Triage state and identity are vulnscan's own, even in an
+				// exported report ingested again
+				v.TriageStatus, v.Assignee, v.Fingerprint = "", "", ""
+				// Unrecognized fields join any raw fields the entry carries, e.g. from an export
+				for k, val := range extraFields(raw, &nv) {
+					if v.Raw == nil {
+						v.Raw = make(models.RawFields)
+					}
+					v.Raw[k] = val
+				}
+				sr.Vulnerabilities = append(sr.Vulnerabilities, v)
+			}
+		}
+		results = append(results, sr)
+	}
+	return results, dec.warnings, nil
+}
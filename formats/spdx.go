@@ -0,0 +1,133 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+// spdxDocument mirrors the subset of an SPDX 2.x JSON document we ingest
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created timestamp `json:"created"`
+	} `json:"creationInfo"`
+	Packages []struct {
+		SPDXID       string `json:"SPDXID"`
+		Name         string `json:"name"`
+		VersionInfo  string `json:"versionInfo"`
+		Purpose      string `json:"primaryPackagePurpose"`
+		Concluded    string `json:"licenseConcluded"`
+		Declared     string `json:"licenseDeclared"`
+		ExternalRefs []struct {
+			Category string `json:"referenceCategory"`
+			Type     string `json:"referenceType"`
+			Locator  string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+	DocumentDescribes []string `json:"documentDescribes"`
+	Relationships     []struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	} `json:"relationships"`
+}
+
+// spdxAdapter maps SPDX JSON SBOMs into component lists
+type spdxAdapter struct{}
+
+// Name identifies the format
+func (spdxAdapter) Name() string { return "spdx" }
+
+// Detect matches objects declaring an spdxVersion
+func (spdxAdapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"spdxVersion"`))
+}
+
+// Parse converts SPDX packages into components, using purl external refs
+func (spdxAdapter) Parse(content []byte) ([]models.ScanResult, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	result := models.ScanResult{
+		ScanID:       "spdx:" + doc.DocumentNamespace,
+		Timestamp:    doc.CreationInfo.Created.Time,
+		ScanStatus:   "completed",
+		ResourceType: "sbom",
+		ResourceName: doc.Name,
+	}
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+
+	for _, p := range doc.Packages {
+		c := models.Component{Name: p.Name, Version: p.VersionInfo, Type: p.Purpose,
+			License: spdxLicense(p.Concluded, p.Declared), Ref: p.SPDXID}
+		for _, ref := range p.ExternalRefs {
+			if ref.Type == "purl" {
+				c.PURL = ref.Locator
+				c.Name = purl.Name(ref.Locator)
+				c.Ecosystem = purl.Ecosystem(ref.Locator)
+				break
+			}
+		}
+		result.Components = append(result.Components, c)
+	}
+	result.Dependencies = spdxDependencies(doc)
+	return []models.ScanResult{result}, nil
+}
+
+// spdxDependencies converts dependency relationships into edges. The
+// packages the document describes stand for the project, so their direct
+// dependencies become top-level ones.
+func spdxDependencies(doc spdxDocument) []models.Dependency {
+	roots := make(map[string]bool)
+	for _, id := range doc.DocumentDescribes {
+		roots[id] = true
+	}
+	for _, r := range doc.Relationships {
+		switch r.Type {
+		case "DESCRIBES":
+			roots[r.Related] = true
+		case "DESCRIBED_BY":
+			roots[r.Element] = true
+		}
+	}
+
+	var deps []models.Dependency
+	for _, r := range doc.Relationships {
+		var d models.Dependency
+		switch r.Type {
+		case "DEPENDS_ON":
+			d = models.Dependency{Parent: r.Element, Child: r.Related}
+		case "DEPENDENCY_OF":
+			d = models.Dependency{Parent: r.Related, Child: r.Element}
+		default:
+			continue
+		}
+		if roots[d.Parent] {
+			d.Parent = ""
+		}
+		deps = append(deps, d)
+	}
+	return deps
+}
+
+// spdxLicense prefers the concluded license over the declared one, skipping
+// the NOASSERTION and NONE placeholders
+func spdxLicense(candidates ...string) string {
+	for _, l := range candidates {
+		if l != "" && l != "NOASSERTION" && l != "NONE" {
+			return l
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// timeLayouts are the timestamp layouts accepted in reports, tried in order.
+// Fractional seconds are accepted after the seconds of any of them. Layouts
+// without a zone are read as UTC.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700 MST", // Go's time.Time.String
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseTime reads s in any of timeLayouts, or as Unix seconds, and returns
+// it normalized. An empty s is the zero time.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return normalizeTime(t), nil
+		}
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return normalizeTime(time.Unix(secs, 0)), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
+
+// normalizeTime converts t to UTC at second precision, the form timestamps
+// are stored and served in
+func normalizeTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+// timestamp is a report time decoded with parseTime from a JSON string or
+// Unix seconds; null is the zero time
+type timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON decodes a timestamp in any accepted layout
+func (t *timestamp) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// normalizeTimes converts the scan and publication times of results to
+// their normalized form, whatever the adapter produced
+func normalizeTimes(results []models.ScanResult) {
+	for i := range results {
+		results[i].Timestamp = normalizeTime(results[i].Timestamp)
+		for j := range results[i].Vulnerabilities {
+			v := &results[i].Vulnerabilities[j]
+			v.PublishedDate = normalizeTime(v.PublishedDate)
+		}
+	}
+}
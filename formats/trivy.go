@@ -0,0 +1,189 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// trivyReport mirrors the subset of Trivy's JSON output (SchemaVersion 2) we map
+type trivyReport struct {
+	SchemaVersion int       `json:"SchemaVersion"`
+	CreatedAt     timestamp `json:"CreatedAt"`
+	ArtifactName  string    `json:"ArtifactName"`
+	ArtifactType  string    `json:"ArtifactType"`
+	Results       []struct {
+		Target          string            `json:"Target"`
+		Class           string            `json:"Class"`
+		Type            string            `json:"Type"`
+		Vulnerabilities []json.RawMessage `json:"Vulnerabilities"` // trivyVulnerability entries
+	} `json:"Results"`
+}
+
+// trivyVulnerability is a single finding in a Trivy result
+type trivyVulnerability struct {
+	VulnerabilityID  string    `json:"VulnerabilityID"`
+	PkgName          string    `json:"PkgName"`
+	InstalledVersion string    `json:"InstalledVersion"`
+	FixedVersion     string    `json:"FixedVersion"`
+	Status           string    `json:"Status"`
+	Severity         string    `json:"Severity"`
+	SeveritySource   string    `json:"SeveritySource"`
+	PrimaryURL       string    `json:"PrimaryURL"`
+	Title            string    `json:"Title"`
+	Description      string    `json:"Description"`
+	PublishedDate    timestamp `json:"PublishedDate"`
+	PkgIdentifier    struct {
+		PURL string `json:"PURL"`
+	} `json:"PkgIdentifier"`
+	CVSS map[string]struct {
+		V3Score float64 `json:"V3Score"`
+		V2Score float64 `json:"V2Score"`
+	} `json:"CVSS"`
+}
+
+// trivyAdapter maps Trivy JSON reports into scan results
+type trivyAdapter struct{}
+
+// Name identifies the format
+func (trivyAdapter) Name() string { return "trivy" }
+
+// Detect matches objects carrying Trivy's SchemaVersion and Results keys
+func (trivyAdapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' &&
+		bytes.Contains(trimmed, []byte(`"SchemaVersion"`)) &&
+		bytes.Contains(trimmed, []byte(`"Results"`))
+}
+
+// Parse flattens all Trivy results into a single scan result
+func (trivyAdapter) Parse(content []byte) ([]models.ScanResult, error) {
+	results, _, err := parseTrivy(content, false)
+	return results, err
+}
+
+// ParseLenient is Parse, skipping malformed vulnerabilities
+func (trivyAdapter) ParseLenient(content []byte) ([]models.ScanResult, []Warning, error) {
+	return parseTrivy(content, true)
+}
+
+// parseTrivy flattens all Trivy results into a single scan result, decoding
+// vulnerabilities leniently or strictly
+func parseTrivy(content []byte, lenient bool) ([]models.ScanResult, []Warning, error) {
+	var report trivyReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, nil, err
+	}
+
+	result := models.ScanResult{
+		ScanID:       "trivy:" + report.ArtifactName + "@" + report.CreatedAt.UTC().Format(time.RFC3339),
+		Timestamp:    report.CreatedAt.Time,
+		ScanStatus:   "completed",
+		ResourceType: report.ArtifactType,
+		ResourceName: report.ArtifactName,
+	}
+
+	dec := entryDecoder{lenient: lenient}
+	for _, r := range report.Results {
+		for _, raw := range r.Vulnerabilities {
+			var tv trivyVulnerability
+			keep, err := dec.decode(raw, &tv, func() string { return tv.VulnerabilityID })
+			if err != nil {
+				return nil, nil, err
+			}
+			if !keep {
+				continue
+			}
+			v := models.Vulnerability{
+				CVEID:          tv.VulnerabilityID,
+				Severity:       strings.ToUpper(tv.Severity),
+				CVSS:           trivyScore(tv),
+				Status:         trivyStatus(tv),
+				PackageName:    tv.PkgName,
+				CurrentVersion: tv.InstalledVersion,
+				FixedVersion:   tv.FixedVersion,
+				Description:    tv.Description,
+				Link:           tv.PrimaryURL,
+				RiskFactors:    models.RiskFactors{},
+				Ecosystem:      trivyEcosystems[r.Type],
+				PURL:           tv.PkgIdentifier.PURL,
+				PublishedDate:  tv.PublishedDate.Time,
+				Raw:            extraFields(raw, &tv),
+			}
+			if v.Description == "" {
+				v.Description = tv.Title
+			}
+			// A language package's target is the lockfile it was found in;
+			// an OS package's names the image, which changes with its tag
+			if r.Class == "lang-pkgs" {
+				v.Location = r.Target
+			}
+			result.Vulnerabilities = append(result.Vulnerabilities, v)
+		}
+	}
+	return []models.ScanResult{result}, dec.warnings, nil
+}
+
+// trivyEcosystems maps Trivy result types to OSV ecosystem names
+var trivyEcosystems = map[string]string{
+	"alpine":      "Alpine",
+	"debian":      "Debian",
+	"ubuntu":      "Ubuntu",
+	"redhat":      "Red Hat",
+	"rocky":       "Rocky",
+	"alma":        "AlmaLinux",
+	"npm":         "npm",
+	"yarn":        "npm",
+	"pnpm":        "npm",
+	"node-pkg":    "npm",
+	"pip":         "PyPI",
+	"pipenv":      "PyPI",
+	"poetry":      "PyPI",
+	"python-pkg":  "PyPI",
+	"gomod":       "Go",
+	"gobinary":    "Go",
+	"jar":         "Maven",
+	"pom":         "Maven",
+	"gradle":      "Maven",
+	"cargo":       "crates.io",
+	"rustbinary":  "crates.io",
+	"bundler":     "RubyGems",
+	"gemspec":     "RubyGems",
+	"composer":    "Packagist",
+	"nuget":       "NuGet",
+	"dotnet-core": "NuGet",
+	"pub":         "Pub",
+	"hex":         "Hex",
+}
+
+// trivyScore picks the CVSS v3 score, preferring NVD, then the severity
+// source, then the highest score reported by any vendor
+func trivyScore(tv trivyVulnerability) float64 {
+	if s, ok := tv.CVSS["nvd"]; ok && s.V3Score > 0 {
+		return s.V3Score
+	}
+	if s, ok := tv.CVSS[tv.SeveritySource]; ok && s.V3Score > 0 {
+		return s.V3Score
+	}
+	var best float64
+	for _, s := range tv.CVSS {
+		if s.V3Score > best {
+			best = s.V3Score
+		}
+	}
+	return best
+}
+
+// trivyStatus maps Trivy's fix status onto vulnscan's status values
+func trivyStatus(tv trivyVulnerability) string {
+	if tv.Status != "" {
+		return tv.Status
+	}
+	if tv.FixedVersion != "" {
+		return "fixed"
+	}
+	return "affected"
+}
@@ -0,0 +1,134 @@
+// Package ghsa resolves GitHub Security Advisory IDs to CVE IDs and back
+// using the GitHub global advisories API.
+package ghsa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// DefaultBaseURL is the public GitHub REST API endpoint
+const DefaultBaseURL = "https://api.github.com"
+
+// Client queries the GitHub advisory database
+type Client struct {
+	BaseURL string        // API root, e.g. https://api.github.com
+	Token   string        // Optional token, raising the rate limit
+	HTTP    *http.Client  // Underlying HTTP client
+	Limiter *rate.Limiter // Throttles outgoing requests
+}
+
+// NewClient creates a client rate limited to GitHub's REST quotas:
+// 60 requests per hour without a token, 5000 with one
+func NewClient(baseURL, token string) *Client {
+	every := time.Minute
+	if token != "" {
+		every = 720 * time.Millisecond
+	}
+	return &Client{
+		BaseURL: baseURL,
+		Token:   token,
+		HTTP:    httpclient.New(30 * time.Second),
+		Limiter: rate.NewLimiter(rate.Every(every), 1),
+	}
+}
+
+// DefaultClient is used by the resolve job
+var DefaultClient = NewClient(DefaultBaseURL, "")
+
+// advisory is the subset of a GitHub advisory we use
+type advisory struct {
+	GHSAID      string `json:"ghsa_id"`
+	CVEID       string `json:"cve_id"`
+	Identifiers []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"identifiers"`
+}
+
+// IsGHSA reports whether id is a GitHub advisory identifier
+func IsGHSA(id string) bool {
+	return strings.HasPrefix(strings.ToUpper(id), "GHSA-")
+}
+
+// Resolve returns the other identifiers of the advisory or advisories
+// known by id: the CVE for a GHSA ID, or the GHSA IDs for a CVE. An
+// unknown id resolves to no aliases.
+func (c *Client) Resolve(ctx context.Context, id string) ([]string, error) {
+	var advisories []advisory
+	if IsGHSA(id) {
+		var a advisory
+		found, err := c.get(ctx, "/advisories/"+url.PathEscape(id), &a)
+		if err != nil || !found {
+			return nil, err
+		}
+		advisories = append(advisories, a)
+	} else {
+		if _, err := c.get(ctx, "/advisories?cve_id="+url.QueryEscape(id), &advisories); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]bool{strings.ToUpper(id): true}
+	var aliases []string
+	add := func(v string) {
+		if v != "" && !seen[strings.ToUpper(v)] {
+			seen[strings.ToUpper(v)] = true
+			aliases = append(aliases, v)
+		}
+	}
+	for _, a := range advisories {
+		add(a.GHSAID)
+		add(a.CVEID)
+		for _, ident := range a.Identifiers {
+			add(ident.Value)
+		}
+	}
+	return aliases, nil
+}
+
+// get fetches path into out, reporting false when the resource does not exist
+func (c *Client) get(ctx context.Context, path string, out interface{}) (bool, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return false, fmt.Errorf("ghsa: rate limit wait: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("ghsa: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("ghsa: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("ghsa: decode response: %v", err)
+	}
+	return true, nil
+}
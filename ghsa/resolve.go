@@ -0,0 +1,78 @@
+package ghsa
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ResolveStored resolves aliases for stored CVE and GHSA identifiers that
+// have not been resolved within ttl, storing each mapping in both
+// directions. It returns the number of identifiers resolved.
+func (c *Client) ResolveStored(ctx context.Context, db *sqlx.DB, ttl time.Duration) (int, error) {
+	var ids []string
+	err := db.SelectContext(ctx, &ids, `SELECT DISTINCT v.cve_id FROM vulnerabilities v
+		LEFT JOIN identifier_resolutions r ON r.identifier = v.cve_id
+		WHERE (v.cve_id LIKE 'CVE-%' OR v.cve_id LIKE 'GHSA-%')
+			AND (r.identifier IS NULL OR r.resolved_at < ?)
+		ORDER BY v.cve_id`, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for _, id := range ids {
+		aliases, err := c.Resolve(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return resolved, ctx.Err()
+			}
+			slog.Warn("GHSA resolution failed", "id", id, "error", err)
+			continue
+		}
+		if err := StoreAliases(ctx, db, id, aliases); err != nil {
+			return resolved, fmt.Errorf("store %s: %v", id, err)
+		}
+		resolved++
+	}
+	return resolved, nil
+}
+
+// StoreAliases records that id and each alias name the same advisory and
+// marks id as resolved
+func StoreAliases(ctx context.Context, db *sqlx.DB, id string, aliases []string) error {
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, alias := range aliases {
+		for _, pair := range [][2]string{{id, alias}, {alias, id}} {
+			_, err := tx.ExecContext(ctx,
+				"INSERT OR IGNORE INTO identifiers (identifier, alias, source) VALUES (?, ?, 'github')",
+				pair[0], pair[1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO identifier_resolutions (identifier, resolved_at) VALUES (?, ?)
+		ON CONFLICT(identifier) DO UPDATE SET resolved_at = excluded.resolved_at`,
+		id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
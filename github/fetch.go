@@ -0,0 +1,300 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/telemetry"
+)
+
+// ErrNotModified is returned by a conditional fetch of an unchanged file
+var ErrNotModified = errors.New("not modified")
+
+// Validators identify a fetched file version, so the next fetch can be
+// conditional
+type Validators struct {
+	ETag         string // Entity tag of the response
+	LastModified string // Last-Modified time of the response
+}
+
+// RawFetcher downloads repository files from raw.githubusercontent.com, or
+// the raw content server of another allowed host
+type RawFetcher struct {
+	HTTP *http.Client // Underlying HTTP client
+
+	// Hosts maps each repository host files may be fetched from to the base
+	// URL of its raw content; nil uses DefaultRawHosts
+	Hosts map[string]string
+	// API looks up default branches; nil uses DefaultClient
+	API *Client
+}
+
+// DefaultRawHosts allows fetching from github.com
+var DefaultRawHosts = map[string]string{"github.com": "https://raw.githubusercontent.com"}
+
+// DefaultFetcher is used to download scan report files. Its client only
+// connects to public addresses, as repositories come from API requests.
+var DefaultFetcher = &RawFetcher{HTTP: httpclient.NewPublic(2 * time.Minute)}
+
+// DefaultBranch looks up the repository's default branch through the API
+func (f *RawFetcher) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	api := f.API
+	if api == nil {
+		api = DefaultClient
+	}
+	return api.DefaultBranch(ctx, repo)
+}
+
+// ParseRawHosts parses host=url entries, e.g.
+// github.example.com=https://raw.github.example.com, into fetcher hosts
+func ParseRawHosts(entries []string) (map[string]string, error) {
+	hosts := make(map[string]string, len(entries))
+	for _, e := range entries {
+		host, base, ok := strings.Cut(e, "=")
+		u, err := url.Parse(base)
+		if !ok || host == "" || strings.ContainsAny(host, "/:@") || err != nil ||
+			(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid raw host %q (want host=http(s) URL)", e)
+		}
+		hosts[strings.ToLower(host)] = strings.TrimSuffix(base, "/")
+	}
+	return hosts, nil
+}
+
+// repoSegment matches a valid owner or repository name
+var repoSegment = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// canonicalRepo validates a repository URL and returns its lowercase host,
+// owner, and name. The URL must be http or https, without credentials, a
+// port, a query, or a fragment; its host must be a name rather than an IP
+// address; and its path must be exactly owner/name, optionally ending in
+// .git.
+func canonicalRepo(repo string) (host, owner, name string, err error) {
+	invalid := fmt.Errorf("invalid repository URL %q", repo)
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(repo), "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Port() != "" ||
+		u.RawQuery != "" || u.Fragment != "" || u.Opaque != "" {
+		return "", "", "", invalid
+	}
+	host = strings.ToLower(u.Hostname())
+	if _, err := netip.ParseAddr(host); err == nil || host == "" {
+		return "", "", "", invalid
+	}
+	parts := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	if len(parts) != 2 {
+		return "", "", "", invalid
+	}
+	owner, name = parts[0], strings.TrimSuffix(parts[1], ".git")
+	for _, s := range []string{owner, name} {
+		if !repoSegment.MatchString(s) || s == "." || s == ".." {
+			return "", "", "", invalid
+		}
+	}
+	return host, owner, name, nil
+}
+
+// escapePath escapes each segment of a ref or file path, refusing empty
+// and dot segments, which could step outside the repository
+func escapePath(p string) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, s := range segments {
+		if s == "" || s == "." || s == ".." {
+			return "", fmt.Errorf("invalid path %q", p)
+		}
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// rawURL returns the raw content URL of a file of the repository at ref
+func (f *RawFetcher) rawURL(repo, ref, filePath string) (string, error) {
+	host, owner, name, err := canonicalRepo(repo)
+	if err != nil {
+		return "", err
+	}
+	hosts := f.Hosts
+	if hosts == nil {
+		hosts = DefaultRawHosts
+	}
+	base, ok := hosts[host]
+	if !ok {
+		return "", fmt.Errorf("fetching from %s is not allowed", host)
+	}
+	escapedRef, err := escapePath(ref)
+	if err != nil {
+		return "", err
+	}
+	escapedFile, err := escapePath(filePath)
+	if err != nil {
+		return "", err
+	}
+	return base + "/" + owner + "/" + name + "/" + escapedRef + "/" + escapedFile, nil
+}
+
+// FetchFileContent retrieves a file of the repository at ref. When cached
+// validators are given, the request is conditional and an unchanged file
+// returns ErrNotModified.
+func (f *RawFetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *Validators) (_ []byte, _ Validators, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "github.fetch", attribute.String("vulnscan.file", filePath))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	// Convert the repository URL to its raw content URL
+	rawURL, err := f.rawURL(repo, ref, filePath)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	span.SetAttributes(attribute.String("url.full", rawURL))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	// Transient failures are retried by the shared transport
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return nil, Validators{}, errs.Wrap(errs.ErrFetch, err)
+	}
+	defer resp.Body.Close()
+
+	// An unchanged file needs no download
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		span.SetAttributes(attribute.Bool("vulnscan.not_modified", true))
+		return nil, *cached, ErrNotModified
+	}
+
+	// Check for valid response
+	if resp.StatusCode != http.StatusOK {
+		return nil, Validators{}, retryHint(resp, errs.Errorf(statusCategory(resp.StatusCode), "HTTP status %d", resp.StatusCode))
+	}
+
+	// Room for the file is taken before it is downloaded
+	r, err := pipeline.Reader(ctx, resp.Body, resp.ContentLength)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	return body, Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// FetchFileContent retrieves a file of the repository at ref through the
+// contents API, which counts against the client's rate limit rather than
+// raw.githubusercontent.com's undocumented throttling. Conditional requests
+// answered 304 don't count against the limit.
+func (c *Client) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *Validators) (_ []byte, _ Validators, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "github.fetch", attribute.String("vulnscan.file", filePath))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	// The token is only sent for repositories of the API's own host
+	host, owner, name, err := canonicalRepo(repo)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	if host != c.Host {
+		return nil, Validators{}, fmt.Errorf("fetching from %s is not allowed", host)
+	}
+	escapedFile, err := escapePath(filePath)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", strings.TrimSuffix(c.BaseURL, "/"),
+		owner, name, escapedFile, url.QueryEscape(ref))
+	span.SetAttributes(attribute.String("url.full", endpoint))
+
+	header := http.Header{}
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := c.do(ctx, endpoint, header)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	defer resp.Body.Close()
+
+	// An unchanged file needs no download
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		span.SetAttributes(attribute.Bool("vulnscan.not_modified", true))
+		return nil, *cached, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, Validators{}, statusError(resp)
+	}
+
+	var file struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+		Content  string `json:"content"`
+		Size     int64  `json:"size"`
+		SHA      string `json:"sha"`
+	}
+	r, err := pipeline.Reader(ctx, resp.Body, resp.ContentLength)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	if err := json.NewDecoder(r).Decode(&file); errors.Is(err, pipeline.ErrTooLarge) {
+		return nil, Validators{}, err
+	} else if err != nil {
+		return nil, Validators{}, errs.Errorf(errs.ErrParse, "github: decode contents: %v", err)
+	}
+	if file.Type != "file" {
+		return nil, Validators{}, errs.Errorf(errs.ErrNotFound, "github: %s is not a file", filePath)
+	}
+	validators := Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+
+	// Files over 1 MB come without content; their blob has it
+	if file.Encoding == "none" || (file.Content == "" && file.Size > 0) {
+		blob := fmt.Sprintf("%s/repos/%s/%s/git/blobs/%s", strings.TrimSuffix(c.BaseURL, "/"),
+			url.PathEscape(owner), url.PathEscape(name), url.PathEscape(file.SHA))
+		if err := c.get(ctx, blob, &file); err != nil {
+			return nil, Validators{}, err
+		}
+	}
+	body, err := decodeContent(file.Encoding, file.Content)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	return body, validators, nil
+}
+
+// decodeContent decodes API file content, which is base64 wrapped in lines
+func decodeContent(encoding, content string) ([]byte, error) {
+	if encoding != "base64" && !(encoding == "" && content == "") {
+		return nil, errs.Errorf(errs.ErrParse, "github: unsupported content encoding %q", encoding)
+	}
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(content, "\n", ""))
+	if err != nil {
+		return nil, errs.Errorf(errs.ErrParse, "github: decode content: %v", err)
+	}
+	return body, nil
+}
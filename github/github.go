@@ -0,0 +1,409 @@
+// Package github fetches repository files and lists organization
+// repositories and their files through the GitHub REST API, so scans can
+// select report files by pattern. API clients track the rate limit reported
+// by GitHub and pause before exhausting it.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/pipeline"
+)
+
+// DefaultBaseURL is the public GitHub REST API
+const DefaultBaseURL = "https://api.github.com"
+
+// Client is a GitHub REST API client
+type Client struct {
+	BaseURL string       // API root, e.g. https://api.github.com
+	Host    string       // Repository host the API serves files of, e.g. github.com
+	Token   string       // Optional token, raising the rate limit and granting private repository access
+	HTTP    *http.Client // Underlying HTTP client
+	Reserve int          // Requests left in the rate limit window below which requests wait for its reset
+	// How long looked-up default branches are remembered; 0 disables the
+	// cache
+	BranchTTL time.Duration
+
+	mu       sync.Mutex
+	rate     RateLimit
+	branches map[string]cachedBranch // Default branches by lowercase owner/name
+}
+
+// cachedBranch is a looked-up default branch
+type cachedBranch struct {
+	name    string
+	expires time.Time
+}
+
+// RateLimit is the API quota reported by the latest response
+type RateLimit struct {
+	Limit     int       // Requests allowed per window
+	Remaining int       // Requests left in the current window
+	Reset     time.Time // End of the current window
+	Pauses    int       // Times requests waited for a reset
+}
+
+// NewClient creates a client for the API at baseURL
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: baseURL, Host: apiHost(baseURL), Token: token, HTTP: httpclient.New(30 * time.Second), Reserve: 10, BranchTTL: time.Hour}
+}
+
+// apiHost returns the repository host of an API root: its own host, less
+// an api. prefix, so https://api.github.com serves github.com and
+// https://ghe.example.com/api/v3 serves ghe.example.com
+func apiHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "api.")
+}
+
+// RateLimit returns the quota reported by the latest response; Limit is
+// zero until a response has been received
+func (c *Client) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
+
+// DefaultClient is used to list repository files for pattern scans
+var DefaultClient = NewClient(DefaultBaseURL, "")
+
+// ParseRepo splits a repository URL such as https://github.com/owner/name
+// into its owner and name
+func ParseRepo(repo string) (owner, name string, err error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(repo), "/"))
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid repository URL %q", repo)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository URL %q", repo)
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), nil
+}
+
+// CanonicalRepoURL returns the form a repository URL is stored in, so that
+// the ways one repository is commonly written name it once: an http or
+// https URL without a trailing slash or .git suffix, its scheme and host in
+// lower case. The SSH forms git@host:owner/name and
+// ssh://git@host/owner/name, git://host/owner/name, and host/owner/name
+// without a scheme become https URLs. Anything else, such as an image
+// reference, is returned as is. Migration 33 repeats these rules in SQL.
+func CanonicalRepoURL(repo string) string {
+	s := strings.TrimRight(strings.TrimSpace(repo), "/")
+	if strings.HasSuffix(strings.ToLower(s), ".git") {
+		s = strings.TrimRight(s[:len(s)-len(".git")], "/")
+	}
+	switch {
+	case strings.HasPrefix(s, "git@") && strings.Contains(s, ":") && !strings.Contains(s, "://"):
+		host, path, _ := strings.Cut(s[len("git@"):], ":")
+		s = "https://" + host + "/" + path
+	case strings.HasPrefix(s, "ssh://git@"):
+		s = "https://" + s[len("ssh://git@"):]
+	case strings.HasPrefix(s, "git://"):
+		s = "https://" + s[len("git://"):]
+	case !strings.Contains(s, "://") && !strings.ContainsAny(s, ":@ "):
+		if host, _, ok := strings.Cut(s, "/"); ok && strings.Contains(host, ".") {
+			s = "https://" + s
+		}
+	}
+
+	scheme, rest, ok := strings.Cut(s, "://")
+	if scheme = strings.ToLower(scheme); !ok || (scheme != "http" && scheme != "https") {
+		return strings.TrimSpace(repo)
+	}
+	host, path, hasPath := strings.Cut(rest, "/")
+	s = scheme + "://" + strings.ToLower(host)
+	if hasPath {
+		s += "/" + path
+	}
+	return s
+}
+
+// Repository is a repository listed for an organization
+type Repository struct {
+	Name          string `json:"name"`           // Repository name, e.g. "api"
+	FullName      string `json:"full_name"`      // Owner and name, e.g. "example/api"
+	HTMLURL       string `json:"html_url"`       // Repository URL
+	DefaultBranch string `json:"default_branch"` // Branch scanned by default
+	Archived      bool   `json:"archived"`       // Read-only repositories
+	Fork          bool   `json:"fork"`           // Forks of other repositories
+}
+
+// maxRepoPages bounds organization listing at 100 repositories per page
+const maxRepoPages = 100
+
+// ListOrgRepos returns every repository of an organization visible to the
+// client's token
+func (c *Client) ListOrgRepos(ctx context.Context, org string) ([]Repository, error) {
+	var repos []Repository
+	for page := 1; page <= maxRepoPages; page++ {
+		var batch []Repository
+		endpoint := fmt.Sprintf("%s/orgs/%s/repos?type=all&per_page=100&page=%d",
+			strings.TrimSuffix(c.BaseURL, "/"), url.PathEscape(org), page)
+		if err := c.get(ctx, endpoint, &batch); err != nil {
+			return nil, err
+		}
+		repos = append(repos, batch...)
+		if len(batch) < 100 {
+			return repos, nil
+		}
+	}
+	return nil, fmt.Errorf("github: organization %s has more than %d repositories", org, maxRepoPages*100)
+}
+
+// DefaultBranch returns the repository's default branch, e.g. main,
+// master, or trunk, remembering it for BranchTTL
+func (c *Client) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	owner, name, err := ParseRepo(repo)
+	if err != nil {
+		return "", err
+	}
+	key := strings.ToLower(owner + "/" + name)
+	c.mu.Lock()
+	cached, ok := c.branches[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.name, nil
+	}
+
+	var info struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s", strings.TrimSuffix(c.BaseURL, "/"), url.PathEscape(owner), url.PathEscape(name))
+	if err := c.get(ctx, endpoint, &info); err != nil {
+		return "", err
+	}
+	if info.DefaultBranch == "" {
+		return "", fmt.Errorf("github: %s/%s has no default branch", owner, name)
+	}
+	if c.BranchTTL > 0 {
+		c.mu.Lock()
+		if c.branches == nil {
+			c.branches = make(map[string]cachedBranch)
+		}
+		c.branches[key] = cachedBranch{name: info.DefaultBranch, expires: time.Now().Add(c.BranchTTL)}
+		c.mu.Unlock()
+	}
+	return info.DefaultBranch, nil
+}
+
+// ListFiles returns the paths of every file in the repository at ref
+func (c *Client) ListFiles(ctx context.Context, repo, ref string) ([]string, error) {
+	owner, name, err := ParseRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1",
+		strings.TrimSuffix(c.BaseURL, "/"), url.PathEscape(owner), url.PathEscape(name), url.PathEscape(ref))
+
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := c.get(ctx, endpoint, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("github: file tree of %s/%s is too large to list", owner, name)
+	}
+
+	var files []string
+	for _, e := range tree.Tree {
+		if e.Type == "blob" {
+			files = append(files, e.Path)
+		}
+	}
+	return files, nil
+}
+
+// get decodes the JSON response of an API request into v, read under the
+// ingest memory hold ctx fetches with, if any
+func (c *Client) get(ctx context.Context, endpoint string, v any) error {
+	resp, err := c.do(ctx, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	r, err := pipeline.Reader(ctx, resp.Body, resp.ContentLength)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(r).Decode(v); errors.Is(err, pipeline.ErrTooLarge) {
+		return err
+	} else if err != nil {
+		return errs.Errorf(errs.ErrParse, "github: decode response: %v", err)
+	}
+	return nil
+}
+
+// do sends an API request once the rate limit allows, recording the quota
+// the response reports. The caller closes the response body.
+func (c *Client) do(ctx context.Context, endpoint string, header http.Header) (*http.Response, error) {
+	if err := c.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, errs.Errorf(errs.ErrFetch, "github: %v", err)
+	}
+	c.recordRateLimit(resp.Header)
+
+	// An exhausted quota is refused with 403 or 429
+	if (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		resp.Body.Close()
+		reset := c.RateLimit().Reset
+		return nil, errs.WithRetryAfter(errs.Errorf(errs.ErrUpstreamRateLimited, "github: rate limit exhausted until %s", reset.Format(time.RFC3339)), time.Until(reset))
+	}
+	return resp, nil
+}
+
+// waitRateLimit blocks until the window resets when fewer than Reserve
+// requests are left in it
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	rl := c.rate
+	wait := rl.Limit > 0 && rl.Remaining <= c.Reserve && time.Now().Before(rl.Reset)
+	if wait {
+		c.rate.Pauses++
+	}
+	c.mu.Unlock()
+	if !wait {
+		return nil
+	}
+
+	delay := time.Until(rl.Reset) + time.Second
+	slog.WarnContext(ctx, "GitHub rate limit nearly exhausted, pausing",
+		"remaining", rl.Remaining, "limit", rl.Limit, "reset", rl.Reset, "pause", delay.Round(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// recordRateLimit stores the quota reported in response headers
+func (c *Client) recordRateLimit(h http.Header) {
+	limit, err1 := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	remaining, err2 := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	reset, err3 := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rate.Limit, c.rate.Remaining, c.rate.Reset = limit, remaining, time.Unix(reset, 0)
+}
+
+// statusError describes an unexpected API response
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return retryHint(resp, errs.Errorf(statusCategory(resp.StatusCode), "github: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg))))
+}
+
+// statusCategory returns the error category of an unexpected response
+// status: missing repositories and files are not found, throttled requests
+// rate limited, and anything else is a failed fetch
+func statusCategory(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return errs.ErrNotFound
+	case http.StatusTooManyRequests:
+		return errs.ErrUpstreamRateLimited
+	}
+	return errs.ErrFetch
+}
+
+// retryHint adds the wait the response's Retry-After header asks for to
+// err, which the shared transport gave up retrying
+func retryHint(resp *http.Response, err error) error {
+	if d, ok := httpclient.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return errs.WithRetryAfter(err, d)
+	}
+	return err
+}
+
+// ValidatePattern checks that a file pattern is well formed
+func ValidatePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+		return fmt.Errorf("invalid file pattern %q", pattern)
+	}
+	return nil
+}
+
+// MatchFiles returns the files matching any of the patterns, in order.
+// Patterns use path.Match syntax against the full path; a pattern without
+// a slash matches the file name in any directory, e.g. "*.sarif".
+func MatchFiles(files, patterns []string) []string {
+	var matched []string
+	for _, f := range files {
+		for _, p := range patterns {
+			target := f
+			if !strings.Contains(p, "/") {
+				target = path.Base(f)
+			}
+			if ok, _ := path.Match(p, target); ok {
+				matched = append(matched, f)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// ExcludedBy returns the first of the patterns excluding file, or "" when
+// none does. Patterns use path.Match syntax like those of MatchFiles, and
+// also exclude everything under a directory they match: "testdata" excludes
+// any file in a directory of that name, and "test/*" every file below test/.
+func ExcludedBy(file string, patterns []string) string {
+	for _, p := range patterns {
+		for target := file; target != "." && target != "/" && target != ""; target = path.Dir(target) {
+			name := target
+			if !strings.Contains(p, "/") {
+				name = path.Base(target)
+			}
+			if ok, _ := path.Match(p, name); ok {
+				return p
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrRepoNotAllowed is returned for a repository outside the scan access
+// list
+var ErrRepoNotAllowed = errors.New("repository not allowed")
+
+// RepoAccess restricts the repositories that can be scanned. Patterns are
+// host/owner/name paths, e.g. github.com/our-org/*, compared ignoring case;
+// a pattern of fewer segments, e.g. github.com/our-org, covers everything
+// under it. Deny patterns take precedence over allow patterns.
+type RepoAccess struct {
+	Allow []string // Only repositories matching one of these can be scanned; empty allows any
+	Deny  []string // Repositories matching one of these can't be scanned
+}
+
+// ScanAccess applies to every scan; the zero value allows any repository
+var ScanAccess RepoAccess
+
+// Validate checks every pattern
+func (a RepoAccess) Validate() error {
+	for _, p := range append(append([]string(nil), a.Allow...), a.Deny...) {
+		if _, err := path.Match(p, ""); err != nil || strings.Trim(p, "/") == "" {
+			return fmt.Errorf("invalid repository pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Check returns ErrRepoNotAllowed, naming the repository, unless it may be
+// scanned. With patterns configured, a repository must be an http or https
+// URL.
+func (a RepoAccess) Check(repo string) error {
+	if len(a.Allow) == 0 && len(a.Deny) == 0 {
+		return nil
+	}
+	key, ok := repoKey(repo)
+	switch {
+	case !ok,
+		len(a.Allow) > 0 && !matchRepoKey(a.Allow, key),
+		matchRepoKey(a.Deny, key):
+		return fmt.Errorf("%w: %s", ErrRepoNotAllowed, repo)
+	}
+	return nil
+}
+
+// repoKey returns the lowercase host/owner/name path of a repository URL
+func repoKey(repo string) (string, bool) {
+	u, err := url.Parse(repo)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil ||
+		u.RawQuery != "" || u.Fragment != "" {
+		return "", false
+	}
+	// Repository paths need no escaping, and dot segments could step
+	// outside the owner once the URL is resolved
+	p := strings.TrimSuffix(strings.Trim(u.EscapedPath(), "/"), ".git")
+	if p == "" || strings.ContainsAny(p, "%\\") || strings.Contains(p, "//") ||
+		strings.Contains("/"+p+"/", "/../") || strings.Contains("/"+p+"/", "/./") {
+		return "", false
+	}
+	return strings.ToLower(u.Host + "/" + p), true
+}
+
+// matchRepoKey reports whether a pattern matches the key or one of its
+// leading segments
+func matchRepoKey(patterns []string, key string) bool {
+	segments := strings.Split(key, "/")
+	for _, p := range patterns {
+		p = strings.ToLower(strings.Trim(p, "/"))
+		n := strings.Count(p, "/") + 1
+		if n > len(segments) {
+			continue
+		}
+		if ok, _ := path.Match(p, strings.Join(segments[:n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRepoAccess writes 403 and reports false unless the repository may be
+// scanned
+func checkRepoAccess(w http.ResponseWriter, repo string) bool {
+	if err := ScanAccess.Check(repo); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/quota"
+)
+
+// AdminAPIKey is the API key requests to administrative endpoints must
+// carry; when empty, every such request is refused
+var AdminAPIKey string
+
+// AdminOnly serves requests carrying AdminAPIKey, as a bearer token or in
+// the X-API-Key header, with h. Requests without it get 401, and every
+// request gets 403 while no admin key is configured.
+func AdminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if AdminAPIKey == "" {
+			http.Error(w, "Admin API is disabled; set ADMIN_API_KEY to enable it", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(quota.APIKey(r)), []byte(AdminAPIKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vulnscan admin"`)
+			http.Error(w, "Admin API key required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
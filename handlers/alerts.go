@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// Thresholds of operational events; 0 disables the event
+var (
+	FetchFailureThreshold = 3                // Consecutive files of a repository failing to download before a fetch_failures event
+	ScanStuckAfter        = 30 * time.Minute // Running time of a bulk scan before a scan_stuck event
+)
+
+// FetchFailuresEvent is the payload of a "fetch_failures" event
+type FetchFailuresEvent struct {
+	Failures int    `json:"failures"` // Consecutive files that failed to download
+	File     string `json:"file"`     // Last file that failed
+	Error    string `json:"error"`    // Error of the last failure
+}
+
+// ScanStuckEvent is the payload of a "scan_stuck" event
+type ScanStuckEvent struct {
+	Job       string    `json:"job"`        // Bulk scan ID
+	CreatedAt time.Time `json:"created_at"` // Time the scan was submitted
+	Running   string    `json:"running"`    // Time it has been running
+	Repos     int       `json:"repos"`      // Repositories of the scan
+	Done      int       `json:"done"`       // Repositories finished so far
+}
+
+// DatabaseErrorEvent is the payload of a "database_error" event
+type DatabaseErrorEvent struct {
+	File  string `json:"file"`  // File whose results could not be stored
+	Error string `json:"error"` // Database error
+}
+
+// UpstreamOutageEvent is the payload of an "upstream_outage" event
+type UpstreamOutageEvent struct {
+	Host     string `json:"host"`     // Upstream host
+	State    string `json:"state"`    // open when it went down, closed when it recovered
+	Failures int    `json:"failures"` // Consecutive failed requests
+}
+
+// PublishCircuitChange publishes an upstream_outage event for a host whose
+// circuit breaker opened or closed again. It is meant for
+// httpclient.OnCircuitChange.
+func PublishCircuitChange(c httpclient.Circuit) {
+	events.Default.Publish(events.Event{Type: events.TypeUpstreamOutage,
+		Data: UpstreamOutageEvent{Host: c.Host, State: c.State, Failures: c.Failures}})
+}
+
+// fetchFailures counts the consecutive fetch failures of each repository
+var fetchFailures = struct {
+	sync.Mutex
+	byRepo map[string]int
+}{byRepo: make(map[string]int)}
+
+// publishFileOutcome publishes the operational events of one file's
+// ingest: a fetch_failures event once the repository's files failed to
+// download FetchFailureThreshold times in a row, and a database_error event
+// when its results could not be stored. fe is nil for a file that was
+// fetched, whether or not it was ingested.
+func publishFileOutcome(repo string, fe *FileError) {
+	if fe != nil && fe.Category == FailureDB {
+		events.Default.Publish(events.Event{Type: events.TypeDatabaseError, Repo: repo,
+			Data: DatabaseErrorEvent{File: fe.File, Error: fe.Error}})
+	}
+
+	fetchFailures.Lock()
+	if fe == nil || fe.Category != FailureFetch {
+		delete(fetchFailures.byRepo, repo)
+		fetchFailures.Unlock()
+		return
+	}
+	fetchFailures.byRepo[repo]++
+	failures := fetchFailures.byRepo[repo]
+	fetchFailures.Unlock()
+
+	// Sent once per run of failures, when it reaches the threshold
+	if FetchFailureThreshold > 0 && failures == FetchFailureThreshold {
+		events.Default.Publish(events.Event{Type: events.TypeFetchFailures, Repo: repo,
+			Data: FetchFailuresEvent{Failures: failures, File: fe.File, Error: fe.Error}})
+	}
+}
+
+// CheckStuckScans publishes a scan_stuck event for each bulk scan of this
+// process that has been running for ScanStuckAfter by now, once per scan,
+// and returns how many it published
+func CheckStuckScans(now time.Time) int {
+	if ScanStuckAfter <= 0 {
+		return 0
+	}
+	var stuck []ScanStuckEvent
+	bulkJobs.Lock()
+	for _, id := range bulkJobs.order {
+		job := bulkJobs.byID[id]
+		if job.Status != BulkRunning || bulkJobs.stuck[id] || now.Sub(job.CreatedAt) < ScanStuckAfter {
+			continue
+		}
+		bulkJobs.stuck[id] = true
+		e := ScanStuckEvent{Job: id, CreatedAt: job.CreatedAt, Running: now.Sub(job.CreatedAt).Round(time.Second).String(), Repos: job.Repos}
+		for _, r := range job.Results {
+			if r.Status != BulkPending && r.Status != BulkRunning {
+				e.Done++
+			}
+		}
+		stuck = append(stuck, e)
+	}
+	bulkJobs.Unlock()
+
+	for _, e := range stuck {
+		events.Default.Publish(events.Event{Type: events.TypeScanStuck, Data: e})
+	}
+	return len(stuck)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/telemetry"
+)
+
+// ArchiveScanRequest defines the JSON request structure for POST /scan/archive
+type ArchiveScanRequest = api.ArchiveScanRequest
+
+// maxArchiveSize bounds uploaded and downloaded archives, compressed
+const maxArchiveSize = 100 << 20
+
+// archiveClient downloads archives given by URL, from public addresses only
+var archiveClient = httpclient.NewPublic(5 * time.Minute)
+
+// ArchiveScanHandler ingests every report in a .tar.gz, .tar, or .zip
+// archive, uploaded as the multipart "file" field or downloaded from the
+// JSON request's url, reporting per-entry outcomes. Uploads give labels as
+// repeated "label" fields of the form key:value.
+func (s *Scanner) ArchiveScanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		req  ArchiveScanRequest
+		data []byte
+		err  error
+	)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		req, data, err = readArchiveUpload(w, r)
+	} else {
+		req, data, err = readArchiveURL(r)
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("Archive larger than %d bytes", maxArchiveSize), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, ErrRepoNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := archive.Extract(data, archive.DefaultLimits)
+	switch {
+	case errors.Is(err, archive.ErrLimit):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case len(files) == 0:
+		http.Error(w, "Archive contains no files", http.StatusBadRequest)
+		return
+	}
+
+	auditTarget(r.Context(), req.Repo)
+	if !checkQuota(w, r, len(files)) {
+		return
+	}
+	writeScanResponse(w, s.IngestArchive(r.Context(), req.Repo, files, req.Labels))
+}
+
+// readArchiveUpload reads the repo, label, and file fields of a multipart
+// upload
+func readArchiveUpload(w http.ResponseWriter, r *http.Request) (ArchiveScanRequest, []byte, error) {
+	var req ArchiveScanRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return req, nil, err
+		}
+		return req, nil, fmt.Errorf("invalid multipart form: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if req.Repo = canonicalRepo(r.Context(), r.FormValue("repo")); req.Repo == "" {
+		return req, nil, fmt.Errorf("repo is required")
+	}
+	if err := ScanAccess.Check(req.Repo); err != nil {
+		return req, nil, err
+	}
+	labels, err := parseLabelParams(r.MultipartForm.Value["label"])
+	if err != nil {
+		return req, nil, err
+	}
+	req.Labels = labels
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return req, nil, fmt.Errorf("file is required")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	return req, data, err
+}
+
+// readArchiveURL downloads the archive named by a JSON request
+func readArchiveURL(r *http.Request) (ArchiveScanRequest, []byte, error) {
+	var req ArchiveScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, nil, errors.New("Invalid request body")
+	}
+	if req.Repo = canonicalRepo(r.Context(), req.Repo); req.Repo == "" {
+		return req, nil, fmt.Errorf("repo is required")
+	}
+	if err := ScanAccess.Check(req.Repo); err != nil {
+		return req, nil, err
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return req, nil, err
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return req, nil, fmt.Errorf("url must be an http or https URL")
+	}
+	if _, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return req, nil, fmt.Errorf("url must name a host rather than an IP address")
+	}
+	data, err := downloadArchive(r.Context(), u.String())
+	return req, data, err
+}
+
+// downloadArchive fetches an archive, refusing ones over maxArchiveSize
+func downloadArchive(ctx context.Context, rawURL string) (_ []byte, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "archive.download", attribute.String("url.full", rawURL))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := archiveClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: HTTP status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+	if len(data) > maxArchiveSize {
+		return nil, &http.MaxBytesError{Limit: maxArchiveSize}
+	}
+	return data, nil
+}
+
+// IngestArchive ingests each extracted file as a scan of repo carrying the
+// labels, processing a few at a time, and reports per-entry outcomes
+func (s *Scanner) IngestArchive(ctx context.Context, repo string, files []archive.File, labels map[string]string) ScanResponse {
+	repo = canonicalRepo(ctx, repo)
+	tasks := make([]scanTask, len(files))
+	for i, f := range files {
+		content := f.Content
+		tasks[i] = scanTask{repo: repo, name: f.Name, timeout: FileTimeout, fetch: func(ctx context.Context, repo, name string) (ingestFunc, error) {
+			ctx, span := telemetry.StartSpan(ctx, "scan.file",
+				attribute.String("vulnscan.repo", repo),
+				attribute.String("vulnscan.file", name),
+			)
+			in := &pipeline.Ingest{Repo: repo, File: name, Labels: labels, Lenient: isLenient(""), Content: content}
+			return fetchIngest(ctx, span, in)
+		}}
+	}
+	return runTasks(ctx, repo, tasks, ScanTimeout)
+}
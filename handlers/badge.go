@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/badge"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Badge is the shields.io endpoint badge schema
+type Badge = api.Badge
+
+// badgeSeverity is a severity a badge counts, with the color of a badge
+// whose most severe finding has it
+type badgeSeverity struct {
+	severity string
+	color    string
+}
+
+// badgeSeverities are the severities a badge counts, most severe first
+var badgeSeverities = []badgeSeverity{
+	{"CRITICAL", badge.Red},
+	{"HIGH", badge.Orange},
+	{"MEDIUM", badge.Yellow},
+	{"LOW", badge.YellowGreen},
+}
+
+// defaultBadgeLabel is the label of badges that don't set one
+const defaultBadgeLabel = "vulnerabilities"
+
+// badgeMaxAge is how long, in seconds, clients and image proxies may cache
+// a badge
+const badgeMaxAge = 300
+
+// BadgeHandler renders a badge of a repository's open findings, as counted
+// by policy gates, for embedding in a README. The repository is the rest
+// of the path, without its https:// scheme, as for /reports. Optional
+// `severity` (comma-separated) limits the severities counted and `label`
+// replaces the left-hand text; `format=json` returns the shields.io
+// endpoint schema instead of an SVG image.
+func BadgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "svg" && format != "json" {
+		http.Error(w, fmt.Sprintf("unknown format %q (want svg or json)", format), http.StatusBadRequest)
+		return
+	}
+	var severities []string
+	if s := q.Get("severity"); s != "" {
+		for _, sev := range strings.Split(strings.ToUpper(s), ",") {
+			sev = strings.TrimSpace(sev)
+			if !slices.ContainsFunc(badgeSeverities, func(b badgeSeverity) bool { return b.severity == sev }) {
+				http.Error(w, fmt.Sprintf("unknown severity %q (want critical, high, medium, or low)", sev), http.StatusBadRequest)
+				return
+			}
+			severities = append(severities, sev)
+		}
+	}
+	b := Badge{SchemaVersion: 1, Label: q.Get("label")}
+	if b.Label == "" {
+		b.Label = defaultBadgeLabel
+	}
+
+	code := http.StatusOK
+	repo, err := resolveRepo(r.Context(), r.PathValue("repo"))
+	if err == nil {
+		b.Message, b.Color, err = badgeMessage(r.Context(), repo, severities)
+	}
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		// Still an image, so an embedding page shows why there are no counts
+		code, b.Message, b.Color = http.StatusNotFound, "not found", badge.Grey
+	case err != nil:
+		logging.FromContext(r.Context()).Error("badge failed", "error", err)
+		http.Error(w, "Badge failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", badgeMaxAge))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(b)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(code)
+	if err := badge.Render(w, b.Label, b.Message, b.Color); err != nil {
+		logging.FromContext(r.Context()).Error("badge render failed", "error", err)
+	}
+}
+
+// badgeMessage counts the repository's open findings of the severities,
+// or of every severity when none are given, and returns the badge message
+// and color. Requested severities are listed even when they have no
+// findings; otherwise only those with findings are.
+func badgeMessage(ctx context.Context, repo string, severities []string) (string, string, error) {
+	findings, err := gateFindings(ctx, storage.Reader(ctx), repo, nil)
+	if err != nil {
+		return "", "", err
+	}
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[strings.ToUpper(effectiveSeverity(f))]++
+	}
+
+	var parts []string
+	color := badge.BrightGreen
+	for _, b := range badgeSeverities {
+		n := counts[b.severity]
+		if (len(severities) > 0 && !slices.Contains(severities, b.severity)) || (len(severities) == 0 && n == 0) {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", n, strings.ToLower(b.severity)))
+		if n > 0 && color == badge.BrightGreen {
+			color = b.color
+		}
+	}
+	if len(parts) == 0 {
+		return "none", color, nil
+	}
+	return strings.Join(parts, ", "), color, nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// BlastRadius defines the response structure for /blast-radius endpoint
+type BlastRadius = api.BlastRadius
+
+// BlastRadiusScope is one vulnerable package in the latest scan of a file
+type BlastRadiusScope = api.BlastRadiusScope
+
+// TopLevelDependency is a direct dependency pulling in a vulnerable package
+type TopLevelDependency = api.TopLevelDependency
+
+// BlastRadiusHandler reports, for every latest scan containing the
+// vulnerability in the required `id` query parameter, which top-level
+// dependencies transitively depend on the vulnerable package. The optional
+// `repo` parameter narrows the scans.
+func BlastRadiusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := QueryBlastRadius(r.Context(), id, canonicalRepo(r.Context(), r.URL.Query().Get("repo")))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("blast radius query failed", "error", err)
+		http.Error(w, "Blast radius query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// QueryBlastRadius finds the vulnerable packages of a CVE or GHSA
+// identifier, or any alias of it, in the latest scans and walks each scan's
+// dependency graph up to the top-level dependencies
+func QueryBlastRadius(ctx context.Context, id, repo string) (BlastRadius, error) {
+	query := `SELECT DISTINCT s.id AS scan_id, s.repo, s.file_path,
+		COALESCE(v.package_name, '') AS package_name, COALESCE(v.current_version, '') AS version
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE (v.cve_id = ? OR v.cve_id IN (SELECT alias FROM identifiers WHERE identifier = ?))
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)`
+	args := []interface{}{id, id}
+	if repo != "" {
+		query += " AND s.repo = ?"
+		args = append(args, repo)
+	}
+	query += " ORDER BY s.repo, s.file_path, package_name"
+
+	resp := BlastRadius{ID: id, Affected: []BlastRadiusScope{}}
+	if err := storage.Reader(ctx).SelectContext(ctx, &resp.Affected, query, args...); err != nil {
+		return resp, err
+	}
+
+	graphs := make(map[int64]*dependencyGraph)
+	for i := range resp.Affected {
+		a := &resp.Affected[i]
+		g, ok := graphs[a.ScanID]
+		if !ok {
+			var err error
+			if g, err = loadDependencyGraph(ctx, a.ScanID); err != nil {
+				return resp, err
+			}
+			graphs[a.ScanID] = g
+		}
+		a.Graph = len(g.parents) > 0
+		a.TopLevel = g.topLevel(a.Package, a.Version)
+	}
+	return resp, nil
+}
+
+// dependencyGraph is the dependency graph of one scan, walked upward
+type dependencyGraph struct {
+	components map[string]models.Component // By ref
+	parents    map[string][]string         // Child ref to parent refs; "" is the project
+	rooted     bool                        // Whether any edge starts at the project
+}
+
+// loadDependencyGraph reads the components and edges stored for a scan
+func loadDependencyGraph(ctx context.Context, scanID int64) (*dependencyGraph, error) {
+	var components []models.Component
+	err := storage.Reader(ctx).SelectContext(ctx, &components, `SELECT COALESCE(name, '') AS name,
+		COALESCE(version, '') AS version, COALESCE(purl, '') AS purl, ref
+		FROM components WHERE scan_id = ? AND ref != ''`, scanID)
+	if err != nil {
+		return nil, err
+	}
+	var edges []models.Dependency
+	err = storage.Reader(ctx).SelectContext(ctx, &edges,
+		"SELECT parent, child FROM component_dependencies WHERE scan_id = ? ORDER BY id", scanID)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &dependencyGraph{components: make(map[string]models.Component), parents: make(map[string][]string)}
+	for _, c := range components {
+		g.components[c.Ref] = c
+	}
+	for _, e := range edges {
+		g.parents[e.Child] = append(g.parents[e.Child], e.Parent)
+		g.rooted = g.rooted || e.Parent == ""
+	}
+	return g, nil
+}
+
+// topLevel walks breadth-first from the components matching a package
+// version to the top-level dependencies above them, keeping the shortest
+// path to each. Top-level means required by the project; when the graph has
+// no edges from the project, components nothing depends on are used.
+func (g *dependencyGraph) topLevel(name, version string) []TopLevelDependency {
+	next := make(map[string]string) // Ref to the ref one step closer to the vulnerable package
+	var queue []string
+	for ref, c := range g.components {
+		if c.Name == name && c.Version == version {
+			next[ref] = ""
+			queue = append(queue, ref)
+		}
+	}
+	sort.Strings(queue)
+
+	found := []TopLevelDependency{}
+	for len(queue) > 0 {
+		ref := queue[0]
+		queue = queue[1:]
+
+		parents := g.parents[ref]
+		top := !g.rooted && len(parents) == 0 && len(g.parents) > 0
+		for _, p := range parents {
+			if p == "" {
+				top = true
+				continue
+			}
+			if _, seen := next[p]; !seen {
+				next[p] = ref
+				queue = append(queue, p)
+			}
+		}
+		if top {
+			c := g.components[ref]
+			dep := TopLevelDependency{Name: c.Name, Version: c.Version, PURL: c.PURL}
+			for r := ref; r != ""; r = next[r] {
+				dep.Path = append(dep.Path, g.label(r))
+			}
+			found = append(found, dep)
+		}
+	}
+	return found
+}
+
+// label names a ref as name@version, falling back to the ref itself
+func (g *dependencyGraph) label(ref string) string {
+	c, ok := g.components[ref]
+	if !ok || c.Name == "" {
+		return ref
+	}
+	return c.Name + "@" + c.Version
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/logging"
+)
+
+// BulkScanRequest defines the request structure for POST /scan/bulk
+type BulkScanRequest = api.BulkScanRequest
+
+// BulkScanEntry selects the files of one repository to scan
+type BulkScanEntry = api.BulkScanEntry
+
+// BulkScanJob is the progress of a bulk scan
+type BulkScanJob = api.BulkScanJob
+
+// BulkScanResult is the outcome of one repository of a bulk scan
+type BulkScanResult = api.BulkScanResult
+
+// Bulk scan job and repository states
+const (
+	BulkPending   = "pending"
+	BulkRunning   = "running"
+	BulkCompleted = "completed"
+	BulkPartial   = "partial" // Repositories only: some of the files failed
+	BulkFailed    = "failed"
+)
+
+const (
+	maxBulkEntries = 1000 // Repositories accepted per request
+	maxBulkJobs    = 100  // Jobs kept for status queries; the oldest finished ones are dropped
+	bulkRepoSlots  = 4    // Repositories scanned concurrently by default, unless configured otherwise
+	maxBulkSlots   = 16   // Upper bound on a request's concurrency
+)
+
+// bulkJobs holds submitted bulk scans in memory
+var bulkJobs = struct {
+	sync.Mutex
+	byID  map[string]*BulkScanJob
+	order []string        // Submission order
+	stuck map[string]bool // Jobs reported stuck by CheckStuckScans
+}{byID: make(map[string]*BulkScanJob), stuck: make(map[string]bool)}
+
+// BulkScanHandler accepts a list of repositories and scans them in the
+// background as one job, answering 202 with the job to poll
+func (s *Scanner) BulkScanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BulkScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for i := range req.Entries {
+		req.Entries[i].Repo = canonicalRepo(r.Context(), req.Entries[i].Repo)
+	}
+	if err := applyBulkDefaults(r.Context(), &req); err != nil {
+		logging.FromContext(r.Context()).Error("read repository registrations failed", "error", err)
+		http.Error(w, "Read repository registrations failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := validateBulkScan(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	named := 0
+	for i, e := range req.Entries {
+		if err := ScanAccess.Check(e.Repo); err != nil {
+			http.Error(w, fmt.Sprintf("entry %d: %v", i+1, err), http.StatusForbidden)
+			return
+		}
+		named += len(e.Files)
+	}
+	// Files matching patterns count against the quota as they are scanned
+	if !checkQuota(w, r, max(named, 1)) {
+		return
+	}
+
+	// The job outlives the request but keeps its logging context
+	job := s.StartBulkScan(context.WithoutCancel(r.Context()), req)
+	logging.FromContext(r.Context()).Info("bulk scan started", "job", job.ID, "repos", job.Repos)
+	auditTarget(r.Context(), "/scan/bulk/"+job.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/scan/bulk/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// BulkScanStatusHandler returns the progress of the bulk scan in the path
+func BulkScanStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := GetBulkScan(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Bulk scan not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// validateBulkScan checks that every entry names a repository and files
+func validateBulkScan(req BulkScanRequest) error {
+	if len(req.Entries) == 0 {
+		return fmt.Errorf("entries is required")
+	}
+	if len(req.Entries) > maxBulkEntries {
+		return fmt.Errorf("at most %d entries are allowed", maxBulkEntries)
+	}
+	if err := validateConcurrency(req.Concurrency); err != nil {
+		return err
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+	for i, e := range req.Entries {
+		if e.Repo == "" {
+			return fmt.Errorf("entry %d: repo is required", i+1)
+		}
+		if len(e.Files) == 0 && len(e.Patterns) == 0 {
+			return fmt.Errorf("entry %d: files or patterns is required", i+1)
+		}
+		for _, p := range e.Patterns {
+			if err := github.ValidatePattern(p); err != nil {
+				return fmt.Errorf("entry %d: %v", i+1, err)
+			}
+		}
+		if err := ValidateExcludes(e.Exclude); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		if err := ValidatePathPrefix(e.PathPrefix); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateConcurrency checks a requested number of concurrent repositories
+func validateConcurrency(n int) error {
+	if n < 0 || n > maxBulkSlots {
+		return fmt.Errorf("concurrency must be between 1 and %d", maxBulkSlots)
+	}
+	return nil
+}
+
+// StartBulkScan registers a job for the request and scans its repositories
+// in the background, returning a snapshot of the new job
+func (s *Scanner) StartBulkScan(ctx context.Context, req BulkScanRequest) BulkScanJob {
+	job := &BulkScanJob{
+		ID:        newBulkID(),
+		Status:    BulkRunning,
+		CreatedAt: time.Now().UTC(),
+		Repos:     len(req.Entries),
+		Results:   make([]BulkScanResult, len(req.Entries)),
+	}
+	for i, e := range req.Entries {
+		job.Results[i] = BulkScanResult{Repo: e.Repo, Status: BulkPending, Success: []string{}, Failed: []FileError{}, Skipped: []FileSkip{}}
+	}
+
+	bulkJobs.Lock()
+	bulkJobs.byID[job.ID] = job
+	bulkJobs.order = append(bulkJobs.order, job.ID)
+	pruneBulkJobs()
+	snapshot := copyBulkJob(job)
+	bulkJobs.Unlock()
+
+	slots := req.Concurrency
+	if slots <= 0 {
+		_, slots = scanConcurrency()
+	}
+	go s.runBulkScan(ctx, job, req, slots)
+	return snapshot
+}
+
+// GetBulkScan returns a snapshot of a job's progress
+func GetBulkScan(id string) (BulkScanJob, bool) {
+	bulkJobs.Lock()
+	defer bulkJobs.Unlock()
+	job, ok := bulkJobs.byID[id]
+	if !ok {
+		return BulkScanJob{}, false
+	}
+	return copyBulkJob(job), true
+}
+
+// runBulkScan scans the entries a few repositories at a time, recording
+// progress on the job as each one finishes
+func (s *Scanner) runBulkScan(ctx context.Context, job *BulkScanJob, req BulkScanRequest, slots int) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, slots)
+	)
+	for i, e := range req.Entries {
+		wg.Add(1)
+		go func(i int, e BulkScanEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			updateBulkResult(job, i, func(res *BulkScanResult) { res.Status = BulkRunning })
+			files, err := bulkFiles(ctx, e)
+			if err != nil {
+				logging.FromContext(ctx).Warn("bulk scan repository failed", "job", job.ID, "repo", e.Repo, "error", err)
+				updateBulkResult(job, i, func(res *BulkScanResult) {
+					res.Status, res.Error = BulkFailed, err.Error()
+				})
+				return
+			}
+
+			// Add the labels the repository is registered with
+			sr := ScanRequest{Repo: e.Repo, Files: files, Ref: e.Ref, Force: req.Force, Labels: req.Labels, Exclude: e.Exclude}
+			if err := applyRepoDefaults(ctx, &sr); err != nil {
+				logging.FromContext(ctx).Warn("bulk scan repository failed", "job", job.ID, "repo", e.Repo, "error", err)
+				updateBulkResult(job, i, func(res *BulkScanResult) {
+					res.Status, res.Error = BulkFailed, err.Error()
+				})
+				return
+			}
+
+			resp := s.Run(ctx, sr)
+			updateBulkResult(job, i, func(res *BulkScanResult) {
+				res.Status = resp.Status
+				res.Success = append(res.Success, resp.Success...)
+				res.Failed = append(res.Failed, resp.Failed...)
+				res.Skipped = append(res.Skipped, resp.Skipped...)
+				res.Warnings = append(res.Warnings, resp.Warnings...)
+				job.FilesSucceeded += len(resp.Success)
+				job.FilesFailed += len(resp.Failed)
+				job.FilesSkipped += len(resp.Skipped)
+			})
+		}(i, e)
+	}
+	wg.Wait()
+
+	bulkJobs.Lock()
+	now := time.Now().UTC()
+	job.Status, job.FinishedAt = BulkCompleted, &now
+	bulkJobs.Unlock()
+	logging.FromContext(ctx).Info("bulk scan completed", "job", job.ID, "repos", job.Repos,
+		"files_succeeded", job.FilesSucceeded, "files_failed", job.FilesFailed, "files_skipped", job.FilesSkipped)
+}
+
+// bulkFiles returns the entry's files, under its path prefix, plus those of
+// the repository matching its patterns at its ref or default branch, without
+// duplicates
+func bulkFiles(ctx context.Context, e BulkScanEntry) ([]string, error) {
+	files := append([]string(nil), prefixFiles(e.PathPrefix, e.Files)...)
+	if len(e.Patterns) > 0 {
+		all, err := github.DefaultClient.ListFiles(ctx, e.Repo, resolveRef(ctx, github.DefaultClient, e.Repo, e.Ref))
+		if err != nil {
+			return nil, fmt.Errorf("list files failed: %v", err)
+		}
+		files = append(files, github.MatchFiles(all, e.Patterns)...)
+	}
+
+	seen := make(map[string]bool, len(files))
+	unique := files[:0]
+	for _, f := range files {
+		if !seen[f] {
+			seen[f] = true
+			unique = append(unique, f)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no files match %v", e.Patterns)
+	}
+	return unique, nil
+}
+
+// updateBulkResult applies fn to one repository's result under the job lock,
+// counting the repository done once it completes, partly or not at all
+func updateBulkResult(job *BulkScanJob, i int, fn func(*BulkScanResult)) {
+	bulkJobs.Lock()
+	defer bulkJobs.Unlock()
+	fn(&job.Results[i])
+	if s := job.Results[i].Status; s == BulkCompleted || s == BulkPartial || s == BulkFailed {
+		job.ReposDone++
+	}
+}
+
+// pruneBulkJobs drops the oldest finished jobs beyond maxBulkJobs. The
+// caller holds the lock.
+func pruneBulkJobs() {
+	for i := 0; len(bulkJobs.order) > maxBulkJobs && i < len(bulkJobs.order); {
+		id := bulkJobs.order[i]
+		if bulkJobs.byID[id].Status == BulkRunning {
+			i++
+			continue
+		}
+		delete(bulkJobs.byID, id)
+		delete(bulkJobs.stuck, id)
+		bulkJobs.order = append(bulkJobs.order[:i], bulkJobs.order[i+1:]...)
+	}
+}
+
+// copyBulkJob returns a copy of job that is safe to use without the lock
+func copyBulkJob(job *BulkScanJob) BulkScanJob {
+	c := *job
+	c.Results = make([]BulkScanResult, len(job.Results))
+	for i, r := range job.Results {
+		r.Success = append([]string{}, r.Success...)
+		r.Failed = append([]FileError{}, r.Failed...)
+		r.Skipped = append([]FileSkip{}, r.Skipped...)
+		c.Results[i] = r
+	}
+	return c
+}
+
+// newBulkID generates a random 8-byte hex job identifier
+func newBulkID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/cluster"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// ClusterStatus describes this replica's part among the replicas sharing
+// the database
+type ClusterStatus = models.ClusterStatus
+
+// ClusterHandler returns this replica's identifier and the current leader.
+// It answers 404 unless replicas share the database.
+func ClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cluster.Default == nil {
+		http.Error(w, "Clustering is not enabled", http.StatusNotFound)
+		return
+	}
+	status, err := cluster.Default.Status(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("read cluster status failed", "error", err)
+		http.Error(w, "Failed to read cluster status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
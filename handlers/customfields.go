@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// CustomField is an admin-defined field that can be set on vulnerabilities
+// or scans
+type CustomField = models.CustomField
+
+// customFieldName matches custom field names, e.g. business_unit
+var customFieldName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// Limits on custom fields, so one definition or update stays small
+const (
+	maxAllowedValues     = 256  // Allowed values of a string field
+	maxCustomFieldLength = 1024 // Bytes in a string value
+)
+
+// errUnknownTarget is returned when the vulnerability or scan whose custom
+// fields are set doesn't exist
+var errUnknownTarget = errors.New("unknown custom field target")
+
+// CustomFieldsHandler lists custom field definitions on GET and defines one
+// on POST, replacing any of the same name
+func CustomFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		fields, err := storage.ListCustomFields(r.Context(), storage.DB)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("list custom fields failed", "error", err)
+			http.Error(w, "List custom fields failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fields)
+
+	case http.MethodPost:
+		var f CustomField
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		auditTarget(r.Context(), f.Name)
+		if err := validateCustomField(f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.CreatedBy = actorFromRequest(r)
+		created, err := storage.UpsertCustomField(r.Context(), storage.DB, &f)
+		if errors.Is(err, errs.ErrConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("define custom field failed", "name", f.Name, "error", err)
+			http.Error(w, "Define custom field failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Info("custom field defined", "name", f.Name,
+			"target", f.Target, "type", f.Type, "created", created)
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.Header().Set("Location", "/admin/custom-fields/"+f.Name)
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(f)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CustomFieldHandler returns the custom field in the path on GET and
+// deletes it, with every value it was set to, on DELETE
+func CustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var (
+		f   CustomField
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		f, err = storage.GetCustomField(r.Context(), storage.DB, name)
+	case http.MethodDelete:
+		err = storage.DeleteCustomField(r.Context(), storage.DB, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Custom field not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("custom field failed", "name", name, "error", err)
+		http.Error(w, "Custom field failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		logging.FromContext(r.Context()).Info("custom field deleted", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+// VulnerabilityFieldsHandler reads (GET) or sets (PATCH) the custom fields
+// of the vulnerability identified by the {id} path segment
+func VulnerabilityFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := findingID(w, r)
+	if !ok {
+		return
+	}
+	customFieldValues(w, r, storage.CustomFieldVulnerability, id)
+}
+
+// ScanFieldsHandler reads (GET) or sets (PATCH) the custom fields of the
+// scan identified by the {id} path segment
+func ScanFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid scan id", http.StatusBadRequest)
+		return
+	}
+	customFieldValues(w, r, storage.CustomFieldScan, id)
+}
+
+// customFieldValues serves the custom fields of a vulnerability or scan. A
+// PATCH body maps field names to values, null removing a field, and the
+// response is every field set afterwards.
+func customFieldValues(w http.ResponseWriter, r *http.Request, target string, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var values map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		auditTarget(r.Context(), r.URL.Path)
+		err := SetCustomFields(r.Context(), target, id, values)
+		if errors.Is(err, errUnknownTarget) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		var invalid *customFieldError
+		if errors.As(err, &invalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("set custom fields failed", "target", target, "id", id, "error", err)
+			http.Error(w, "Set custom fields failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var values map[string]any
+	ok, err := customFieldTargetExists(r.Context(), storage.DB, target, id)
+	if err == nil && ok {
+		values, err = storage.CustomFieldValues(r.Context(), storage.DB, target, id)
+	}
+	if err == nil && !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("custom fields query failed", "target", target, "id", id, "error", err)
+		http.Error(w, "Custom fields query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
+
+// customFieldError describes a value that can't be set
+type customFieldError struct {
+	field string
+	msg   string
+}
+
+// Error returns the message with the field's name
+func (e *customFieldError) Error() string {
+	return fmt.Sprintf("custom field %q: %s", e.field, e.msg)
+}
+
+// SetCustomFields sets custom fields of the vulnerability or scan with the
+// ID, as a target of storage.CustomFieldVulnerability or
+// storage.CustomFieldScan. A null value removes the field. Every field must
+// be defined for the target and every value of its type, or nothing is set.
+func SetCustomFields(ctx context.Context, target string, id int64, values map[string]json.RawMessage) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		ok, err := customFieldTargetExists(ctx, tx, target, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errUnknownTarget
+		}
+		for _, name := range names {
+			f, err := storage.GetCustomField(ctx, tx, name)
+			if errors.Is(err, errs.ErrNotFound) || (err == nil && f.Target != target) {
+				return &customFieldError{name, "not a " + target + " field"}
+			}
+			if err != nil {
+				return err
+			}
+			if string(values[name]) == "null" {
+				err = storage.ClearCustomFieldValue(ctx, tx, name, id)
+			} else {
+				var text string
+				if text, err = customFieldText(f, values[name]); err != nil {
+					return err
+				}
+				err = storage.SetCustomFieldValue(ctx, tx, name, id, text)
+			}
+			if err != nil {
+				return fmt.Errorf("set custom field failed: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// customFieldTargetExists reports whether the vulnerability or scan is stored
+func customFieldTargetExists(ctx context.Context, db sqlx.QueryerContext, target string, id int64) (bool, error) {
+	table := "vulnerabilities"
+	if target == storage.CustomFieldScan {
+		table = "scans"
+	}
+	var ok bool
+	err := sqlx.GetContext(ctx, db, &ok, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = ?)", id)
+	return ok, err
+}
+
+// customFieldText checks that a JSON value is of the field's type, and
+// allowed, and returns it in its stored text form
+func customFieldText(f CustomField, raw json.RawMessage) (string, error) {
+	switch f.Type {
+	case storage.CustomFieldNumber:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return "", &customFieldError{f.Name, "want a number"}
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case storage.CustomFieldBoolean:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", &customFieldError{f.Name, "want true or false"}
+		}
+		return strconv.FormatBool(b), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", &customFieldError{f.Name, "want a string"}
+	}
+	if len(s) > maxCustomFieldLength {
+		return "", &customFieldError{f.Name, fmt.Sprintf("longer than %d bytes", maxCustomFieldLength)}
+	}
+	if len(f.AllowedValues) > 0 && !slices.Contains(f.AllowedValues, s) {
+		return "", &customFieldError{f.Name, fmt.Sprintf("%q is not an allowed value", s)}
+	}
+	return s, nil
+}
+
+// validateCustomField checks the name, target, and type of a field
+// definition, and that only string fields restrict their values
+func validateCustomField(f CustomField) error {
+	if !customFieldName.MatchString(f.Name) {
+		return fmt.Errorf("invalid name %q (want lowercase letters, digits, and underscores)", f.Name)
+	}
+	if f.Target != storage.CustomFieldVulnerability && f.Target != storage.CustomFieldScan {
+		return fmt.Errorf("unknown target %q (want %s or %s)", f.Target, storage.CustomFieldVulnerability, storage.CustomFieldScan)
+	}
+	switch f.Type {
+	case storage.CustomFieldString:
+	case storage.CustomFieldNumber, storage.CustomFieldBoolean:
+		if len(f.AllowedValues) > 0 {
+			return errors.New("allowed_values applies to string fields only")
+		}
+	default:
+		return fmt.Errorf("unknown type %q (want %s, %s, or %s)", f.Type,
+			storage.CustomFieldString, storage.CustomFieldNumber, storage.CustomFieldBoolean)
+	}
+	if len(f.Description) > 1024 {
+		return errors.New("description must be at most 1024 bytes")
+	}
+	if len(f.AllowedValues) > maxAllowedValues {
+		return fmt.Errorf("at most %d allowed_values", maxAllowedValues)
+	}
+	for _, v := range f.AllowedValues {
+		if len(v) > maxCustomFieldLength {
+			return fmt.Errorf("allowed value longer than %d bytes", maxCustomFieldLength)
+		}
+	}
+	return nil
+}
+
+// ValidateCustomFieldFilter checks the names and values of a custom field
+// filter
+func ValidateCustomFieldFilter(values map[string]string) error {
+	if len(values) > maxLabels {
+		return fmt.Errorf("at most %d custom fields can be filtered on", maxLabels)
+	}
+	for name, value := range values {
+		if !customFieldName.MatchString(name) {
+			return fmt.Errorf("invalid custom field name %q", name)
+		}
+		if len(value) > maxCustomFieldLength {
+			return fmt.Errorf("custom field %q filter is longer than %d bytes", name, maxCustomFieldLength)
+		}
+	}
+	return nil
+}
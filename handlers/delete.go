@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// DeleteRequest defines the request structure for POST /admin/delete
+type DeleteRequest = api.DeleteRequest
+
+// DeleteFilter selects what POST /admin/delete removes
+type DeleteFilter = api.DeleteFilter
+
+// DeleteResponse defines the response structure for POST /admin/delete
+type DeleteResponse = api.DeleteResponse
+
+// Targets of a deletion, in DeleteRequest.Target
+const (
+	DeleteTargetScans           = "scans"           // Scans with everything stored with them
+	DeleteTargetVulnerabilities = "vulnerabilities" // Vulnerabilities, keeping their scans
+)
+
+// maxAgeDays bounds the older_than of a deletion, in days
+const maxAgeDays = 100 * 365
+
+// DeleteHandler deletes scans or vulnerabilities matching a filter. Without
+// confirm it previews the deletion, returning the match counts and a
+// confirmation token; with confirm set to the token it deletes the matches
+// in one transaction, and when they have changed since the preview nothing
+// is deleted and 409 is returned with the new counts and token.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateDeleteRequest(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	auditTarget(r.Context(), deleteDescription(req))
+
+	resp, err := Delete(r.Context(), req, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("delete failed", "target", req.Target, "error", err)
+		http.Error(w, "Delete failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("delete", "target", req.Target, "repo", req.Filter.Repo,
+		"older_than", req.Filter.OlderThan, "severity", req.Filter.Severity, "applied", resp.Applied,
+		"scans", resp.Scans, "vulnerabilities", resp.Vulnerabilities)
+	if resp.Applied {
+		auditTarget(r.Context(), fmt.Sprintf("%s: deleted %d scans, %d vulnerabilities",
+			deleteDescription(req), resp.Scans, resp.Vulnerabilities))
+	}
+
+	code := http.StatusOK
+	if req.Confirm != "" && !resp.Applied {
+		code = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ValidateDeleteRequest checks the target and filter of a deletion
+func ValidateDeleteRequest(req DeleteRequest) error {
+	if req.Target != DeleteTargetScans && req.Target != DeleteTargetVulnerabilities {
+		return fmt.Errorf("unknown target %q (want %s or %s)", req.Target, DeleteTargetScans, DeleteTargetVulnerabilities)
+	}
+	f := req.Filter
+	if f.Repo == "" && f.OlderThan == "" {
+		return errors.New("filter must set repo or older_than")
+	}
+	if f.OlderThan != "" {
+		if _, err := parseAge(f.OlderThan); err != nil {
+			return err
+		}
+	}
+	if f.Severity != "" && req.Target != DeleteTargetVulnerabilities {
+		return fmt.Errorf("severity applies to %s only", DeleteTargetVulnerabilities)
+	}
+	return nil
+}
+
+// Delete removes the scans or vulnerabilities matching req.Filter, as of
+// now, when req.Confirm is the confirmation token of the current matches,
+// and otherwise reports what it would remove with that token
+func Delete(ctx context.Context, req DeleteRequest, now time.Time) (DeleteResponse, error) {
+	var resp DeleteResponse
+	err := executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		scans, vulns, err := matchDeletion(ctx, tx, req, now)
+		if err != nil {
+			return err
+		}
+		resp = DeleteResponse{Scans: len(scans), Vulnerabilities: len(vulns),
+			ConfirmationToken: deletionToken(req.Target, scans, vulns)}
+		if req.Confirm != resp.ConfirmationToken {
+			return errDryRun
+		}
+		if req.Target == DeleteTargetScans {
+			return storage.DeleteScans(ctx, tx, scans)
+		}
+		return storage.DeleteVulnerabilities(ctx, tx, vulns)
+	})
+	if errors.Is(err, errDryRun) {
+		return resp, nil
+	}
+	if err != nil {
+		return DeleteResponse{}, err
+	}
+	resp.Applied, resp.ConfirmationToken = true, ""
+	return resp, nil
+}
+
+// matchDeletion returns the IDs of the scans and vulnerabilities a
+// deletion removes, in order. Deleting scans removes their vulnerabilities.
+func matchDeletion(ctx context.Context, tx *sqlx.Tx, req DeleteRequest, now time.Time) ([]int64, []int64, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if req.Filter.Repo != "" {
+		where = append(where, "s.repo = ?")
+		args = append(args, strings.TrimSuffix(req.Filter.Repo, "/"))
+	}
+	if req.Filter.OlderThan != "" {
+		age, err := parseAge(req.Filter.OlderThan)
+		if err != nil {
+			return nil, nil, err
+		}
+		where = append(where, "s.scan_time < ?")
+		args = append(args, now.Add(-age).UTC())
+	}
+	if req.Filter.Severity != "" {
+		where = append(where, storage.EffectiveSeverity+" = ? COLLATE NOCASE")
+		args = append(args, req.Filter.Severity)
+	}
+	cond := " WHERE " + strings.Join(where, " AND ")
+
+	scans := []int64{}
+	vulns := []int64{}
+	if req.Target == DeleteTargetScans {
+		if err := tx.SelectContext(ctx, &scans, "SELECT s.id FROM scans s"+cond+" ORDER BY s.id", args...); err != nil {
+			return nil, nil, err
+		}
+		err := tx.SelectContext(ctx, &vulns, "SELECT v.id FROM vulnerabilities v WHERE v.scan_id IN (SELECT s.id FROM scans s"+cond+") ORDER BY v.id", args...)
+		return scans, vulns, err
+	}
+	err := tx.SelectContext(ctx, &vulns, "SELECT v.id FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id"+cond+" ORDER BY v.id", args...)
+	return scans, vulns, err
+}
+
+// deletionToken identifies the rows a deletion matches, so that a
+// confirmation only applies to the rows that were previewed
+func deletionToken(target string, scans, vulns []int64) string {
+	h := sha256.New()
+	h.Write([]byte(target))
+	for _, ids := range [][]int64{scans, vulns} {
+		h.Write(binary.AppendVarint(nil, int64(len(ids))))
+		for _, id := range ids {
+			h.Write(binary.AppendVarint(nil, id))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// deleteDescription names a deletion in the audit log, e.g.
+// "scans repo=https://github.com/acme/api older_than=90d"
+func deleteDescription(req DeleteRequest) string {
+	desc := req.Target
+	for _, f := range []struct{ name, value string }{
+		{"repo", req.Filter.Repo},
+		{"older_than", req.Filter.OlderThan},
+		{"severity", req.Filter.Severity},
+	} {
+		if f.value != "" {
+			desc += " " + f.name + "=" + f.value
+		}
+	}
+	return desc
+}
+
+// parseAge parses an age of a number of days, e.g. 90d, or a Go duration,
+// e.g. 720h
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 && n <= maxAgeDays {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid older_than %q (want a number of days, e.g. 90d, or a duration, e.g. 720h)", s)
+}
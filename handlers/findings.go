@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Finding is a unique vulnerability in a repository's package, tracked
+// across scans
+type Finding = api.Finding
+
+// FindingFilters restricts which findings ListFindings returns
+type FindingFilters struct {
+	Repo     string
+	Status   string
+	Severity string
+	ID       string
+	Limit    int
+	Offset   int
+}
+
+// FindingsHandler lists unique findings with when they were first and last
+// seen, most recently seen first. Optional `repo`, `status`, `severity`, and
+// `id` query parameters narrow the list; `limit` (default 50, at most 500)
+// and `offset` page through it.
+func FindingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filters := FindingFilters{
+		Repo:     canonicalRepo(r.Context(), q.Get("repo")),
+		Status:   q.Get("status"),
+		Severity: q.Get("severity"),
+		ID:       q.Get("id"),
+		Limit:    defaultPageSize,
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		filters.Limit = min(n, maxPageSize)
+	}
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		filters.Offset = n
+	}
+
+	findings, err := ListFindings(r.Context(), filters)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("findings query failed", "error", err)
+		http.Error(w, "Findings query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findings)
+}
+
+// ListFindings returns unique findings matching the filters, most recently
+// seen first
+func ListFindings(ctx context.Context, filters FindingFilters) ([]Finding, error) {
+	query := `SELECT id, repo, package_name, cve_id, COALESCE(severity, '') AS severity, status,
+		first_seen, last_seen, COALESCE(last_scan_id, 0) AS last_scan_id, resolved_at FROM findings WHERE 1 = 1`
+	var args []interface{}
+	if filters.Repo != "" {
+		query += " AND repo = ?"
+		args = append(args, filters.Repo)
+	}
+	if filters.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filters.Status)
+	}
+	if filters.Severity != "" {
+		query += " AND UPPER(severity) = UPPER(?)"
+		args = append(args, filters.Severity)
+	}
+	if filters.ID != "" {
+		query += " AND (cve_id = ? OR cve_id IN (SELECT alias FROM identifiers WHERE identifier = ?))"
+		args = append(args, filters.ID, filters.ID)
+	}
+	query += " ORDER BY last_seen DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, filters.Limit, filters.Offset)
+
+	findings := []Finding{}
+	if err := storage.Reader(ctx).SelectContext(ctx, &findings, query, args...); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/versions"
+)
+
+// FixReport defines the response structure for /reports/fixes endpoint
+type FixReport = api.FixReport
+
+// PackageFix is the remediation suggestion for one package
+type PackageFix = api.PackageFix
+
+// severityRank orders severities for prioritization; unknown ranks lowest
+var severityRank = map[string]int{"CRITICAL": 4, "HIGH": 3, "MEDIUM": 2, "LOW": 1}
+
+// FixesHandler lists fixable vulnerabilities grouped by package, with the
+// upgrade that clears them all. Optional `repo` and `severity` query
+// parameters narrow the report.
+func FixesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := BuildFixReport(r.Context(), canonicalRepo(r.Context(), r.URL.Query().Get("repo")), r.URL.Query().Get("severity"))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("fix report failed", "error", err)
+		http.Error(w, "Fix report failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// BuildFixReport groups the fixable findings of the latest scan of every
+// repository file by package. Packages are ordered by their most severe
+// finding, then by number of findings, then by highest CVSS score.
+func BuildFixReport(ctx context.Context, repo, severity string) (FixReport, error) {
+	query := `SELECT v.cve_id, v.severity, v.cvss, v.package_name, v.ecosystem,
+		v.current_version, v.fixed_version, COALESCE(s.repo, '') AS repo
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE v.fixed_version <> ''
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)`
+	var args []interface{}
+	if repo != "" {
+		query += " AND s.repo = ?"
+		args = append(args, repo)
+	}
+	if severity != "" {
+		query += " AND UPPER(v.severity) = UPPER(?)"
+		args = append(args, severity)
+	}
+
+	var rows []struct {
+		CVEID          string  `db:"cve_id"`
+		Severity       string  `db:"severity"`
+		CVSS           float64 `db:"cvss"`
+		PackageName    string  `db:"package_name"`
+		Ecosystem      string  `db:"ecosystem"`
+		CurrentVersion string  `db:"current_version"`
+		FixedVersion   string  `db:"fixed_version"`
+		Repo           string  `db:"repo"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &rows, query, args...); err != nil {
+		return FixReport{}, err
+	}
+
+	type group struct {
+		fix                    PackageFix
+		installed, cves, repos map[string]bool
+	}
+	groups := make(map[[2]string]*group)
+	var order [][2]string
+	for _, row := range rows {
+		key := [2]string{row.Ecosystem, row.PackageName}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{
+				fix:       PackageFix{PackageName: row.PackageName, Ecosystem: row.Ecosystem, BySeverity: map[string]int{}},
+				installed: map[string]bool{}, cves: map[string]bool{}, repos: map[string]bool{},
+			}
+			groups[key] = g
+			order = append(order, key)
+		}
+
+		g.fix.Findings++
+		g.fix.BySeverity[strings.ToUpper(row.Severity)]++
+		g.fix.MaxCVSS = max(g.fix.MaxCVSS, row.CVSS)
+		g.fix.UpgradeTo = versions.Max(g.fix.UpgradeTo, fixTarget(row.CurrentVersion, row.FixedVersion))
+		addOnce(g.installed, &g.fix.InstalledVersions, row.CurrentVersion)
+		addOnce(g.cves, &g.fix.CVEs, row.CVEID)
+		addOnce(g.repos, &g.fix.Repos, row.Repo)
+	}
+
+	report := FixReport{Packages: []PackageFix{}}
+	for _, key := range order {
+		g := groups[key]
+		sort.Slice(g.fix.InstalledVersions, func(i, j int) bool {
+			return versions.Less(g.fix.InstalledVersions[i], g.fix.InstalledVersions[j])
+		})
+		sort.Strings(g.fix.CVEs)
+		sort.Strings(g.fix.Repos)
+		report.Packages = append(report.Packages, g.fix)
+		report.Findings += g.fix.Findings
+	}
+
+	sort.SliceStable(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		ra := severityRank[topSeverity(a.BySeverity)]
+		rb := severityRank[topSeverity(b.BySeverity)]
+		if ra != rb {
+			return ra > rb
+		}
+		if a.Findings != b.Findings {
+			return a.Findings > b.Findings
+		}
+		if a.MaxCVSS != b.MaxCVSS {
+			return a.MaxCVSS > b.MaxCVSS
+		}
+		return a.PackageName < b.PackageName
+	})
+	return report, nil
+}
+
+// fixTarget picks the fix for the installed version from a fixed_version
+// field, which may list one fix per release line ("1.2.5, 1.3.1"): the
+// lowest fix above the installed version, or the highest fix listed
+func fixTarget(installed, fixed string) string {
+	var best string
+	var candidates []string
+	for _, f := range strings.Split(fixed, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			candidates = append(candidates, f)
+		}
+	}
+	for _, f := range candidates {
+		if versions.Compare(f, installed) > 0 && (best == "" || versions.Less(f, best)) {
+			best = f
+		}
+	}
+	if best == "" {
+		best = versions.Max(candidates...)
+	}
+	return best
+}
+
+// topSeverity returns the most severe key of a severity count map
+func topSeverity(counts map[string]int) string {
+	var top string
+	for sev := range counts {
+		if top == "" || severityRank[sev] > severityRank[top] {
+			top = sev
+		}
+	}
+	return top
+}
+
+// addOnce appends v to list the first time it is seen
+func addOnce(seen map[string]bool, list *[]string, v string) {
+	if v != "" && !seen[v] {
+		seen[v] = true
+		*list = append(*list, v)
+	}
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/graphql-go/graphql"
+)
+
+// Pagination limits applied to every list field
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// GraphQLRequest defines the expected request structure for /graphql endpoint
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`         // GraphQL document
+	Variables     map[string]interface{} `json:"variables"`     // Variable values
+	OperationName string                 `json:"operationName"` // Operation to execute
+}
+
+// graphQLVulnerability is a vulnerability row joined with its parent scan ID
+type graphQLVulnerability struct {
+	models.Vulnerability
+	ScanRef int64 `db:"scan_ref"`
+}
+
+// graphQLSchema is built once at package initialization
+var graphQLSchema = mustBuildSchema()
+
+// GraphQLHandler executes GraphQL queries over scans and vulnerabilities.
+// Accepts POST with a JSON body or GET with a `query` URL parameter.
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	if result.HasErrors() {
+		logging.FromContext(r.Context()).Debug("graphql query returned errors", "errors", result.Errors)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// mustBuildSchema constructs the GraphQL schema, panicking on programmer error
+func mustBuildSchema() graphql.Schema {
+	vulnType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Vulnerability",
+		Fields: graphql.Fields{
+			"id":             vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.CVEID }),
+			"severity":       vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Severity }),
+			"cvss":           vulnField(graphql.Float, func(v graphQLVulnerability) interface{} { return v.CVSS }),
+			"status":         vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Status }),
+			"packageName":    vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.PackageName }),
+			"currentVersion": vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.CurrentVersion }),
+			"fixedVersion":   vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.FixedVersion }),
+			"description":    vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Description }),
+			"publishedDate":  vulnField(graphql.DateTime, func(v graphQLVulnerability) interface{} { return v.PublishedDate }),
+			"link":           vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Link }),
+			"ecosystem":      vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Ecosystem }),
+			"purl":           vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.PURL }),
+			"location":       vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Location }),
+			"fingerprint":    vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Fingerprint }),
+			"findingId":      vulnField(graphql.Int, func(v graphQLVulnerability) interface{} { return v.FindingID }),
+			"triageStatus":   vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.TriageStatus }),
+			"assignee":       vulnField(graphql.String, func(v graphQLVulnerability) interface{} { return v.Assignee }),
+			"riskFactors": vulnField(graphql.NewList(graphql.String), func(v graphQLVulnerability) interface{} {
+				return []string(v.RiskFactors)
+			}),
+		},
+	})
+
+	scanType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Scan",
+		Fields: graphql.Fields{
+			"id":        scanField(graphql.Int, func(s models.Scan) interface{} { return s.ID }),
+			"repo":      scanField(graphql.String, func(s models.Scan) interface{} { return s.Repo }),
+			"filePath":  scanField(graphql.String, func(s models.Scan) interface{} { return s.FilePath }),
+			"scanTime":  scanField(graphql.DateTime, func(s models.Scan) interface{} { return s.ScanTime }),
+			"scanId":    scanField(graphql.String, func(s models.Scan) interface{} { return s.ScanID }),
+			"timestamp": scanField(graphql.DateTime, func(s models.Scan) interface{} { return s.Timestamp }),
+			"vulnerabilities": &graphql.Field{
+				Type: graphql.NewList(vulnType),
+				Args: withPagination(graphql.FieldConfigArgument{
+					"severity": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					scan := p.Source.(models.Scan)
+					args := p.Args
+					args["scanRef"] = int(scan.ID)
+					return queryVulnerabilities(p, args)
+				},
+			},
+		},
+	})
+
+	// Vulnerability.scan closes the relationship cycle
+	vulnType.AddFieldConfig("scan", &graphql.Field{
+		Type: scanType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			v := p.Source.(graphQLVulnerability)
+			return getScan(p, v.ScanRef)
+		},
+	})
+
+	repoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Repo",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type:    graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(string), nil },
+			},
+			"latestScan": &graphql.Field{
+				Type: scanType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var scans []models.Scan
+					err := storage.Reader(p.Context).SelectContext(p.Context, &scans,
+						`SELECT id, repo, file_path, scan_time, scan_id, timestamp
+						FROM scans WHERE repo = ? ORDER BY scan_time DESC, id DESC LIMIT 1`, p.Source.(string))
+					if err != nil || len(scans) == 0 {
+						return nil, err
+					}
+					return scans[0], nil
+				},
+			},
+			"scans": &graphql.Field{
+				Type: graphql.NewList(scanType),
+				Args: withPagination(graphql.FieldConfigArgument{}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := p.Args
+					args["repo"] = p.Source.(string)
+					return queryScans(p, args)
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"repos": &graphql.Field{
+				Type: graphql.NewList(repoType),
+				Args: withPagination(graphql.FieldConfigArgument{}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, offset := pageArgs(p.Args)
+					var repos []string
+					err := storage.Reader(p.Context).SelectContext(p.Context, &repos,
+						"SELECT DISTINCT repo FROM scans ORDER BY repo LIMIT ? OFFSET ?", limit, offset)
+					return repos, err
+				},
+			},
+			"repo": &graphql.Field{
+				Type: repoType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name := p.Args["name"].(string)
+					var count int
+					if err := storage.Reader(p.Context).GetContext(p.Context, &count, "SELECT COUNT(*) FROM scans WHERE repo = ?", name); err != nil {
+						return nil, err
+					}
+					if count == 0 {
+						return nil, nil
+					}
+					return name, nil
+				},
+			},
+			"scan": &graphql.Field{
+				Type: scanType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getScan(p, int64(p.Args["id"].(int)))
+				},
+			},
+			"scans": &graphql.Field{
+				Type: graphql.NewList(scanType),
+				Args: withPagination(graphql.FieldConfigArgument{
+					"repo": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return queryScans(p, p.Args)
+				},
+			},
+			"vulnerabilities": &graphql.Field{
+				Type: graphql.NewList(vulnType),
+				Args: withPagination(graphql.FieldConfigArgument{
+					"severity":    &graphql.ArgumentConfig{Type: graphql.String},
+					"cveId":       &graphql.ArgumentConfig{Type: graphql.String},
+					"packageName": &graphql.ArgumentConfig{Type: graphql.String},
+					"repo":        &graphql.ArgumentConfig{Type: graphql.String},
+					"minCvss":     &graphql.ArgumentConfig{Type: graphql.Float},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return queryVulnerabilities(p, p.Args)
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic("graphql schema: " + err.Error())
+	}
+	return schema
+}
+
+// vulnField builds a field resolved from a vulnerability row
+func vulnField(t graphql.Output, get func(graphQLVulnerability) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(graphQLVulnerability)), nil
+		},
+	}
+}
+
+// scanField builds a field resolved from a scan row
+func scanField(t graphql.Output, get func(models.Scan) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(models.Scan)), nil
+		},
+	}
+}
+
+// withPagination adds limit/offset arguments to a field's arguments
+func withPagination(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["limit"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize}
+	args["offset"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0}
+	return args
+}
+
+// pageArgs returns sanitized limit and offset values
+func pageArgs(args map[string]interface{}) (int, int) {
+	limit, _ := args["limit"].(int)
+	offset, _ := args["offset"].(int)
+	if limit <= 0 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// getScan loads a single scan by row ID
+func getScan(p graphql.ResolveParams, id int64) (interface{}, error) {
+	var scans []models.Scan
+	err := storage.Reader(p.Context).SelectContext(p.Context, &scans,
+		"SELECT id, repo, file_path, scan_time, scan_id, timestamp FROM scans WHERE id = ?", id)
+	if err != nil || len(scans) == 0 {
+		return nil, err
+	}
+	return scans[0], nil
+}
+
+// queryScans lists scans, optionally filtered by repo, newest first
+func queryScans(p graphql.ResolveParams, args map[string]interface{}) (interface{}, error) {
+	var (
+		conds  []string
+		params []interface{}
+	)
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		conds = append(conds, "repo = ?")
+		params = append(params, repo)
+	}
+
+	query := "SELECT id, repo, file_path, scan_time, scan_id, timestamp FROM scans"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit, offset := pageArgs(args)
+	query += " ORDER BY scan_time DESC, id DESC LIMIT ? OFFSET ?"
+	params = append(params, limit, offset)
+
+	var scans []models.Scan
+	err := storage.Reader(p.Context).SelectContext(p.Context, &scans, query, params...)
+	return scans, err
+}
+
+// queryVulnerabilities lists vulnerabilities matching the filter arguments
+func queryVulnerabilities(p graphql.ResolveParams, args map[string]interface{}) (interface{}, error) {
+	var (
+		conds  []string
+		params []interface{}
+	)
+	if v, ok := args["severity"].(string); ok && v != "" {
+		conds = append(conds, "v.severity = ?")
+		params = append(params, v)
+	}
+	if v, ok := args["cveId"].(string); ok && v != "" {
+		conds = append(conds, "v.cve_id = ?")
+		params = append(params, v)
+	}
+	if v, ok := args["packageName"].(string); ok && v != "" {
+		conds = append(conds, "v.package_name = ?")
+		params = append(params, v)
+	}
+	if v, ok := args["repo"].(string); ok && v != "" {
+		conds = append(conds, "s.repo = ?")
+		params = append(params, v)
+	}
+	if v, ok := args["minCvss"].(float64); ok {
+		conds = append(conds, "v.cvss >= ?")
+		params = append(params, v)
+	}
+	if v, ok := args["scanRef"].(int); ok {
+		conds = append(conds, "v.scan_id = ?")
+		params = append(params, v)
+	}
+
+	query := `SELECT
+		v.cve_id, v.severity, v.cvss, v.status, v.package_name, v.current_version,
+		v.fixed_version, v.description, v.published_date, v.link, v.risk_factors,
+		v.ecosystem, v.purl, v.location, v.fingerprint, v.id AS finding_id, v.triage_status, v.assignee,
+		COALESCE(s.id, 0) AS scan_ref
+		FROM vulnerabilities v LEFT JOIN scans s ON s.id = v.scan_id`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit, offset := pageArgs(args)
+	query += " ORDER BY v.id LIMIT ? OFFSET ?"
+	params = append(params, limit, offset)
+
+	var vulns []graphQLVulnerability
+	err := storage.Reader(p.Context).SelectContext(p.Context, &vulns, query, params...)
+	return vulns, err
+}
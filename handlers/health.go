@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ReadinessCheck reports whether a dependency is ready to serve traffic
+type ReadinessCheck func() error
+
+// HealthResponse defines the response structure for health endpoints
+type HealthResponse struct {
+	Status string            `json:"status"`           // Overall status ("ok" or "unavailable")
+	Uptime string            `json:"uptime,omitempty"` // Time since process start
+	Checks map[string]string `json:"checks,omitempty"` // Result of each readiness check
+}
+
+var (
+	startTime = time.Now()
+
+	checksMu        sync.RWMutex                  // Protects readinessChecks
+	readinessChecks = map[string]ReadinessCheck{} // Checks evaluated by /readyz
+)
+
+// RegisterReadinessCheck adds a named check evaluated by /readyz.
+// Background components (e.g. queue workers) register here when they start.
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	readinessChecks[name] = check
+}
+
+// HealthzHandler reports that the process is up
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{
+		Status: "ok",
+		Uptime: time.Since(startTime).Round(time.Second).String(),
+	})
+}
+
+// LivezHandler reports that the process is alive and able to serve requests
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadyzHandler reports whether the service can accept traffic: the database
+// is reachable, migrations are applied, and registered workers are running
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]ReadinessCheck{
+		"database":   checkDatabase,
+		"migrations": checkMigrations,
+	}
+	checksMu.RLock()
+	for name, check := range readinessChecks {
+		checks[name] = check
+	}
+	checksMu.RUnlock()
+
+	// Evaluate checks in a stable order
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := HealthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	code := http.StatusOK
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			resp.Checks[name] = err.Error()
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	writeHealth(w, code, resp)
+}
+
+// checkDatabase verifies the database connection, and the read-only one
+// when configured, is usable
+func checkDatabase() error {
+	if storage.DB == nil {
+		return errors.New("database not initialized")
+	}
+	if err := storage.DB.Ping(); err != nil {
+		return err
+	}
+	if storage.ReadDB != nil {
+		if err := storage.ReadDB.Ping(); err != nil {
+			return fmt.Errorf("read database: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkMigrations verifies the schema is at the version this build expects
+func checkMigrations() error {
+	if storage.DB == nil {
+		return errors.New("database not initialized")
+	}
+	version, err := storage.SchemaVersion(storage.DB)
+	if err != nil {
+		return err
+	}
+	if latest := storage.LatestSchemaVersion(); version < latest {
+		return fmt.Errorf("schema at version %d, expected %d", version, latest)
+	}
+	return nil
+}
+
+// writeHealth encodes a health response with the given status code
+func writeHealth(w http.ResponseWriter, code int, resp HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Idempotency headers
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+var (
+	// IdempotencyTTL is how long the response to a request with an
+	// Idempotency-Key is replayed to retries
+	IdempotencyTTL = 24 * time.Hour
+	// IdempotencyLease is how long a retry waits on the original request
+	// before taking its key over, should that request have been abandoned
+	IdempotencyLease = time.Hour
+)
+
+// idempotencyRecorder captures the response of a request for replay while
+// writing it through
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code before delegating
+func (ir *idempotencyRecorder) WriteHeader(code int) {
+	if ir.status == 0 {
+		ir.status = code
+	}
+	ir.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the body before delegating
+func (ir *idempotencyRecorder) Write(b []byte) (int, error) {
+	if ir.status == 0 {
+		ir.status = http.StatusOK
+	}
+	ir.body.Write(b)
+	return ir.ResponseWriter.Write(b)
+}
+
+// Idempotent wraps the handler of a POST route so that requests sent with
+// the same Idempotency-Key header by the same actor run once: retries
+// within IdempotencyTTL receive the stored response with an
+// Idempotent-Replayed header instead. Reusing a key for a different request
+// returns 422, and retrying while the original is still running returns
+// 409. Server errors are not stored, so a retry after one runs again.
+func Idempotent(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost || storage.DB == nil {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			http.Error(w, "Invalid Idempotency-Key (want 1-255 printable ASCII characters)", http.StatusBadRequest)
+			return
+		}
+
+		// A retry must repeat the request exactly
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h := sha256.New()
+		io.WriteString(h, r.URL.RequestURI()+"\n")
+		h.Write(body)
+		hash := hex.EncodeToString(h.Sum(nil))
+
+		k := storage.IdempotencyKey{Actor: actorFromRequest(r), Route: route, Key: key}
+		stored, err := storage.ClaimIdempotencyKey(r.Context(), storage.DB, k, hash, IdempotencyTTL, IdempotencyLease)
+		switch {
+		case errors.Is(err, storage.ErrIdempotencyMismatch):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, storage.ErrIdempotencyInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			logging.FromContext(r.Context()).Error("idempotency key lookup failed", "key", key, "error", err)
+			http.Error(w, "Idempotency key lookup failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		case stored != nil:
+			logging.FromContext(r.Context()).Info("replaying idempotent response", "key", key, "status", stored.Status)
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			if stored.Location != "" {
+				w.Header().Set("Location", stored.Location)
+			}
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.Header().Set("Content-Length", strconv.Itoa(len(stored.Body)))
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		// Keep the outcome even if the caller has gone away, since a retry
+		// is what the key is for
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			err = storage.ReleaseIdempotencyKey(ctx, storage.DB, k)
+		} else {
+			err = storage.CompleteIdempotencyKey(ctx, storage.DB, k, storage.IdempotentResponse{
+				Status:      rec.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Location:    w.Header().Get("Location"),
+				Body:        rec.body.Bytes(),
+			})
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("idempotency key write failed", "key", key, "error", err)
+		}
+	}
+}
+
+// validIdempotencyKey reports whether key is 1-255 printable ASCII
+// characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return key != ""
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/csvimport"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// maxCSVImportBytes bounds the size of an imported CSV file
+const maxCSVImportBytes = 64 << 20
+
+// csvImportFilePath is the file imported findings are stored under unless
+// the request names another
+const csvImportFilePath = "import.csv"
+
+// CSVImportResponse defines the response structure for POST /import/csv
+type CSVImportResponse = api.CSVImportResponse
+
+// CSVImportHandler stores the historical findings of a CSV file posted as
+// the request body. The repo query parameter gives the repository of rows
+// without a repo column, file the file they are stored under, and each map
+// parameter, of the form header:field, the field a column maps to.
+func CSVImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	mapping := map[string]string{}
+	for _, m := range q["map"] {
+		header, field, ok := strings.Cut(m, ":")
+		if !ok || strings.TrimSpace(header) == "" {
+			http.Error(w, fmt.Sprintf("invalid map %q, want header:field", m), http.StatusBadRequest)
+			return
+		}
+		mapping[strings.TrimSpace(header)] = strings.TrimSpace(field)
+	}
+	file := strings.TrimSpace(q.Get("file"))
+	if file == "" {
+		file = csvImportFilePath
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSVImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "CSV file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rows, err := csvimport.Parse(bytes.NewReader(content), csvimport.Options{
+		Mapping: mapping, Repo: q.Get("repo"), Now: time.Now().UTC(),
+	})
+	if err != nil {
+		http.Error(w, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range rows {
+		rows[i].Repo = canonicalRepo(r.Context(), rows[i].Repo)
+		if status := rows[i].Vulnerability.TriageStatus; status != "" && triageTransitions[status] == nil {
+			http.Error(w, fmt.Sprintf("Invalid CSV: line %d: %v %q", rows[i].Line, errInvalidStatus, status), http.StatusBadRequest)
+			return
+		}
+		if !checkRepoAccess(w, rows[i].Repo) {
+			return
+		}
+	}
+
+	resp, err := ImportCSV(r.Context(), actorFromRequest(r), file, content, rows)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("CSV import failed", "file", file, "error", err)
+		if errors.Is(err, errs.ErrQuotaExceeded) {
+			writeQuotaError(w, err)
+			return
+		}
+		http.Error(w, "CSV import failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("CSV imported",
+		"file", file, "findings", resp.Findings, "repos", resp.Repos, "scans", resp.Scans)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ImportCSV stores parsed CSV rows in one transaction as scans of file: one
+// per repository and last sighting, so the repository's history shows when
+// each finding was seen. Findings are backdated to their first sighting,
+// rows' triage status and assignee are applied with actor in the audit
+// trail, and findings the latest of a repository's scans leave out are
+// resolved as a rescan would. The import counts as one file against the
+// tenant's quota unless it fails, and publishes no events or alerts.
+func ImportCSV(ctx context.Context, actor, file string, content []byte, rows []csvimport.Row) (CSVImportResponse, error) {
+	resp := CSVImportResponse{Findings: len(rows)}
+	release, err := quota.Default.Reserve(ctx, quota.TenantFromContext(ctx))
+	if err != nil {
+		return resp, err
+	}
+
+	// Oldest sightings first, so each repository's latest scan is its last
+	slices.SortStableFunc(rows, func(a, b csvimport.Row) int {
+		if c := strings.Compare(a.Repo, b.Repo); c != 0 {
+			return c
+		}
+		return a.LastSeen.Compare(b.LastSeen)
+	})
+	sum := sha256.Sum256(content)
+	err = executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		resp.Repos, resp.Scans, resp.Resolved = 0, 0, 0
+		var scanID int64
+		for i, row := range rows {
+			newRepo := i == 0 || row.Repo != rows[i-1].Repo
+			if newRepo || !row.LastSeen.Equal(rows[i-1].LastSeen) {
+				res, err := tx.ExecContext(ctx,
+					`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, sha256, source, tenant)
+					VALUES (?, ?, ?, ?, ?, ?, 'csv', ?)`,
+					row.Repo, file, row.LastSeen, "csv:"+file+"@"+storage.FormatTime(row.LastSeen), storage.FormatTime(row.LastSeen),
+					hex.EncodeToString(sum[:]), quota.TenantFromContext(ctx),
+				)
+				if err != nil {
+					return fmt.Errorf("insert scan failed: %w", err)
+				}
+				if scanID, err = res.LastInsertId(); err != nil {
+					return fmt.Errorf("get scan ID failed: %w", err)
+				}
+				resp.Scans++
+			}
+			if newRepo {
+				resp.Repos++
+			}
+
+			if err := importRow(ctx, tx, actor, scanID, row); err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+
+			if i == len(rows)-1 || rows[i+1].Repo != row.Repo {
+				resolved, err := storage.ResolveFindings(ctx, tx, row.Repo, row.LastSeen)
+				if err != nil {
+					return fmt.Errorf("resolve findings failed: %w", err)
+				}
+				resp.Resolved += int(resolved)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Nothing was stored, so the file doesn't count
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			logging.FromContext(ctx).Warn("quota release failed", "file", file, "error", err)
+		}
+	}
+	return resp, err
+}
+
+// importRow stores one row under a scan with its first sighting and triage
+// state
+func importRow(ctx context.Context, tx *sqlx.Tx, actor string, scanID int64, row csvimport.Row) error {
+	v := row.Vulnerability
+	stored := v
+	stored.TriageStatus, stored.Assignee = "", "" // Set below, with an audit trail entry
+	if err := storage.InsertVulnerability(ctx, tx, scanID, stored); err != nil {
+		return fmt.Errorf("insert vulnerability failed: %w", err)
+	}
+	if err := storage.BackdateFinding(ctx, tx, row.Repo, v.PackageName, v.CVEID, row.FirstSeen); err != nil {
+		return fmt.Errorf("backdate finding failed: %w", err)
+	}
+	if v.TriageStatus == "" && v.Assignee == "" {
+		return nil
+	}
+
+	var id int64
+	if err := tx.GetContext(ctx, &id, "SELECT MAX(id) FROM vulnerabilities WHERE scan_id = ?", scanID); err != nil {
+		return fmt.Errorf("get vulnerability ID failed: %w", err)
+	}
+	current, err := storage.GetTriageState(ctx, tx, id)
+	if err != nil {
+		return fmt.Errorf("read triage state failed: %w", err)
+	}
+	if v.TriageStatus != "" && v.TriageStatus != current.Status {
+		if err := storage.SetTriageField(ctx, tx, id, actor, "triage_status", current.Status, v.TriageStatus); err != nil {
+			return fmt.Errorf("set triage status failed: %w", err)
+		}
+	}
+	if v.Assignee != "" && v.Assignee != current.Assignee {
+		if err := storage.SetTriageField(ctx, tx, id, actor, "assignee", current.Assignee, v.Assignee); err != nil {
+			return fmt.Errorf("set assignee failed: %w", err)
+		}
+	}
+	return nil
+}
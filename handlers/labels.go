@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxLabels bounds the labels of a scan
+const maxLabels = 32
+
+// labelKey matches label keys, e.g. team or ci.pipeline_id
+var labelKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// ValidateLabels checks label keys and values
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+	for key, value := range labels {
+		if !labelKey.MatchString(key) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+		if len(value) > 256 {
+			return fmt.Errorf("label %q is longer than 256 bytes", key)
+		}
+	}
+	return nil
+}
+
+// parseLabelParams parses label query parameters of the form key:value
+func parseLabelParams(params []string) (map[string]string, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(params))
+	for _, p := range params {
+		key, value, ok := strings.Cut(p, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q (want key:value)", p)
+		}
+		labels[key] = value
+	}
+	return labels, ValidateLabels(labels)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// MaintenanceRequest defines the request structure for POST /admin/maintenance
+type MaintenanceRequest = api.MaintenanceRequest
+
+// MaintenanceResult is the outcome of a database maintenance run
+type MaintenanceResult = models.MaintenanceResult
+
+// MaintenanceVacuumPages bounds the free pages each maintenance run
+// releases to the filesystem (0 for all)
+var MaintenanceVacuumPages = 0
+
+// MaintenanceHandler returns the result of the latest database maintenance
+// run on GET, and runs maintenance now on POST. A run already in progress
+// gets 409.
+func MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		res, ok := storage.LastMaintenance()
+		if !ok {
+			http.Error(w, "No maintenance run yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+
+	case http.MethodPost:
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		res, err := RunMaintenance(r.Context(), req.FullVacuum)
+		if errors.Is(err, errs.ErrConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil && res.Error != "" {
+			http.Error(w, "Maintenance failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Integrity problems are in the result
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RunMaintenance checkpoints, vacuums, analyzes, and checks the database,
+// rebuilding the file first when fullVacuum is set, and logs the outcome.
+// Problems integrity_check finds are returned as an error alongside the
+// result.
+func RunMaintenance(ctx context.Context, fullVacuum bool) (MaintenanceResult, error) {
+	res, err := storage.Maintain(ctx, storage.DB, storage.MaintenanceOptions{
+		VacuumPages: MaintenanceVacuumPages,
+		FullVacuum:  fullVacuum,
+	})
+	log := logging.FromContext(ctx)
+	switch {
+	case errors.Is(err, storage.ErrMaintenanceRunning):
+		return res, err
+	case err != nil:
+		log.Error("database maintenance failed", "error", err)
+		return res, err
+	case !res.IntegrityOK():
+		log.Error("database integrity check failed", "problems", res.Integrity)
+		return res, fmt.Errorf("integrity check found %d problems", len(res.Integrity))
+	}
+	log.Info("database maintenance completed", "duration", res.Duration, "wal_frames", res.WALFrames,
+		"checkpoint_busy", res.CheckpointBusy, "auto_vacuum", res.AutoVacuum, "full_vacuum", res.FullVacuum,
+		"vacuumed_pages", res.VacuumedPages, "size_bytes", res.SizeBytes, "free_bytes", res.FreeBytes)
+	return res, nil
+}
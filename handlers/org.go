@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/logging"
+)
+
+// OrgScanRequest defines the request structure for POST /scan/org
+type OrgScanRequest = api.OrgScanRequest
+
+// OrgScanPatterns are the file patterns scanned in every repository when a
+// request names none
+var OrgScanPatterns []string
+
+// orgName matches GitHub organization logins
+var orgName = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,38})$`)
+
+// OrgScanHandler lists an organization's repositories and scans the report
+// files matching the patterns in each, as one bulk scan job
+func (s *Scanner) OrgScanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req OrgScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	auditTarget(r.Context(), req.Org)
+	if len(req.Patterns) == 0 {
+		req.Patterns = OrgScanPatterns
+	}
+	if err := validateOrgScan(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkQuota(w, r, 1) {
+		return
+	}
+
+	bulk, err := OrgBulkScan(r.Context(), req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list organization repositories failed", "org", req.Org, "error", err)
+		http.Error(w, "Failed to list organization repositories", errs.HTTPStatus(err, http.StatusBadGateway))
+		return
+	}
+	if len(bulk.Entries) == 0 {
+		http.Error(w, "No repositories match", http.StatusBadRequest)
+		return
+	}
+
+	job := s.StartBulkScan(context.WithoutCancel(r.Context()), bulk)
+	auditTarget(r.Context(), "/scan/bulk/"+job.ID)
+	logging.FromContext(r.Context()).Info("organization scan started", "job", job.ID, "org", req.Org, "repos", job.Repos)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/scan/bulk/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// validateOrgScan checks the organization name and every pattern
+func validateOrgScan(req OrgScanRequest) error {
+	if !orgName.MatchString(req.Org) {
+		return fmt.Errorf("invalid organization %q", req.Org)
+	}
+	if len(req.Patterns) == 0 {
+		return fmt.Errorf("patterns is required")
+	}
+	for _, p := range req.Patterns {
+		if err := github.ValidatePattern(p); err != nil {
+			return err
+		}
+	}
+	for _, p := range append(append([]string(nil), req.Include...), req.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return fmt.Errorf("invalid repository pattern %q", p)
+		}
+	}
+	if err := ValidateExcludes(req.ExcludeFiles); err != nil {
+		return err
+	}
+	if err := validateConcurrency(req.Concurrency); err != nil {
+		return err
+	}
+	return ValidateLabels(req.Labels)
+}
+
+// OrgBulkScan lists the organization's repositories and returns a bulk scan
+// of those selected by the request
+func OrgBulkScan(ctx context.Context, req OrgScanRequest) (BulkScanRequest, error) {
+	repos, err := github.DefaultClient.ListOrgRepos(ctx, req.Org)
+	if err != nil {
+		return BulkScanRequest{}, err
+	}
+
+	bulk := BulkScanRequest{Concurrency: req.Concurrency, Force: req.Force, Labels: req.Labels}
+	for _, repo := range repos {
+		if (repo.Archived && !req.Archived) || (repo.Fork && !req.Forks) {
+			continue
+		}
+		if len(req.Include) > 0 && !matchRepo(req.Include, repo.Name) {
+			continue
+		}
+		if matchRepo(req.Exclude, repo.Name) || ScanAccess.Check(repo.HTMLURL) != nil {
+			continue
+		}
+		bulk.Entries = append(bulk.Entries, BulkScanEntry{Repo: repo.HTMLURL, Ref: repo.DefaultBranch, Patterns: req.Patterns, Exclude: req.ExcludeFiles})
+	}
+	return bulk, nil
+}
+
+// matchRepo reports whether a repository name matches any of the patterns,
+// ignoring case as GitHub does
+func matchRepo(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Scan outcomes, in ScanResponse.Status
+const (
+	ScanCompleted = "completed" // No file or image failed
+	ScanPartial   = "partial"   // Some failed, others were ingested or skipped
+	ScanFailed    = "failed"    // Every file and image failed
+)
+
+// Failure categories, in FileError.Category
+const (
+	FailureFetch       = "fetch"       // The file could not be downloaded
+	FailureChecksum    = "checksum"    // The file did not match its expected checksum
+	FailureImage       = "image"       // The image scanner failed
+	FailureParse       = "parse"       // The report could not be parsed
+	FailureCorrelation = "correlation" // SBOM components could not be correlated against OSV
+	FailureDB          = "db"          // The results could not be stored
+	FailureIncomplete  = "incomplete"  // The scanner reported an incomplete run, with IncompleteSkip
+	FailureTimeout     = "timeout"     // The file or the whole scan ran out of time
+	FailureQuota       = "quota"       // The tenant used up its daily files or stored rows
+)
+
+// ScanFailedStatus is the HTTP status code of a scan in which every file
+// failed. Partly failed scans return 207 Multi-Status.
+var ScanFailedStatus = http.StatusUnprocessableEntity
+
+// Retry hints of failures whose cause doesn't say when to retry
+var (
+	RateLimitRetryAfter = time.Minute     // After an upstream service throttled requests
+	BusyRetryAfter      = 5 * time.Second // After the database stayed locked past its busy timeout
+)
+
+// stepError is the failure of one step of ingesting a file, categorized
+// for clients
+type stepError struct {
+	category string
+	err      error
+}
+
+// failStep returns a stepError of the category with a formatted message
+func failStep(category, format string, args ...interface{}) error {
+	return &stepError{category: category, err: fmt.Errorf(format, args...)}
+}
+
+// Error returns the underlying message
+func (e *stepError) Error() string { return e.err.Error() }
+
+// Unwrap returns the underlying error
+func (e *stepError) Unwrap() error { return e.err }
+
+// failureCategory returns the category of a failed file: the failed step's
+// own, or else that of the pipeline stage it ran in, or else that of the
+// error's errs category. Other failures happened while storing the results.
+func failureCategory(err error) string {
+	if errors.Is(err, errs.ErrQuotaExceeded) {
+		return FailureQuota
+	}
+	var se *stepError
+	if errors.As(err, &se) {
+		return se.category
+	}
+	var stage *pipeline.StageError
+	if errors.As(err, &stage) {
+		return stageCategories[stage.Stage]
+	}
+	switch {
+	case errors.Is(err, errs.ErrFetch), errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrUpstreamRateLimited):
+		return FailureFetch
+	case errors.Is(err, errs.ErrParse):
+		return FailureParse
+	}
+	return FailureDB
+}
+
+// retryAfterSeconds returns the whole seconds to wait before retrying a
+// file that failed with err, or 0 when retrying won't help: the wait an
+// upstream service asked for, or else RateLimitRetryAfter when it throttled
+// requests and BusyRetryAfter when the database was busy
+func retryAfterSeconds(err error) int {
+	d, ok := errs.RetryAfter(err)
+	switch {
+	case ok:
+	case errors.Is(err, errs.ErrUpstreamRateLimited):
+		d = RateLimitRetryAfter
+	case storage.Busy(err):
+		d = BusyRetryAfter
+	default:
+		return 0
+	}
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
+
+// scanOutcome summarizes a scan's per-file results
+func scanOutcome(resp ScanResponse) string {
+	switch {
+	case len(resp.Failed) == 0:
+		return ScanCompleted
+	case len(resp.Success) == 0 && len(resp.Skipped) == 0:
+		return ScanFailed
+	}
+	return ScanPartial
+}
+
+// writeScanResponse writes a scan response with a status code matching its
+// outcome: 200 when complete, 207 when partial, and ScanFailedStatus when
+// every file failed, or 429 when they all failed on the tenant's quota. A
+// failed scan whose files can all be retried carries the longest of their
+// waits in a Retry-After header.
+func writeScanResponse(w http.ResponseWriter, resp ScanResponse) {
+	code := http.StatusOK
+	switch resp.Status {
+	case ScanPartial:
+		code = http.StatusMultiStatus
+	case ScanFailed:
+		code = ScanFailedStatus
+		if !slices.ContainsFunc(resp.Failed, func(fe FileError) bool { return fe.Category != FailureQuota }) {
+			code = http.StatusTooManyRequests
+		}
+		if wait := scanRetryAfter(resp.Failed); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(wait))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// scanRetryAfter returns the longest wait of the failures, or 0 when any
+// of them can't be retried
+func scanRetryAfter(failed []FileError) int {
+	wait := 0
+	for _, fe := range failed {
+		if fe.RetryAfterSeconds == 0 {
+			return 0
+		}
+		wait = max(wait, fe.RetryAfterSeconds)
+	}
+	return wait
+}
+
+// writeQuotaError answers a request the tenant's quota refused with 429,
+// and when the quota resets with a Retry-After header
+func writeQuotaError(w http.ResponseWriter, err error) {
+	if wait := retryAfterSeconds(err); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(wait))
+	}
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// checkQuota checks that the request's tenant may ingest files more files,
+// answering the request when it may not or the check failed
+func checkQuota(w http.ResponseWriter, r *http.Request, files int) bool {
+	err := quota.Default.Check(r.Context(), quota.TenantFromContext(r.Context()), files)
+	switch {
+	case errors.Is(err, errs.ErrQuotaExceeded):
+		writeQuotaError(w, err)
+		return false
+	case err != nil:
+		logging.FromContext(r.Context()).Error("check quota failed", "error", err)
+		http.Error(w, "Check quota failed: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/report"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// SeverityOverride replaces the reported severity of matching findings
+type SeverityOverride = models.SeverityOverride
+
+// SeverityOverridesHandler lists severity overrides on GET and creates one
+// on POST. Overrides apply to findings as they are read, so a new rule
+// takes effect on every stored finding at once.
+func SeverityOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		overrides, err := storage.ListSeverityOverrides(r.Context(), storage.DB)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("list severity overrides failed", "error", err)
+			http.Error(w, "List severity overrides failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(overrides)
+
+	case http.MethodPost:
+		var o SeverityOverride
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		o.Severity = strings.ToUpper(o.Severity)
+		if err := validateSeverityOverride(o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o.CreatedBy = actorFromRequest(r)
+		if err := storage.InsertSeverityOverride(r.Context(), storage.DB, &o); err != nil {
+			logging.FromContext(r.Context()).Error("create severity override failed", "error", err)
+			http.Error(w, "Create severity override failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		location := "/admin/severity-overrides/" + strconv.FormatInt(o.ID, 10)
+		auditTarget(r.Context(), location)
+		logging.FromContext(r.Context()).Info("severity override created", "id", o.ID,
+			"org", o.Org, "cve_id", o.CVEID, "risk_factor", o.RiskFactor, "severity", o.Severity)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(o)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SeverityOverrideHandler returns the severity override in the path on GET
+// and deletes it on DELETE
+func SeverityOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid override ID", http.StatusBadRequest)
+		return
+	}
+
+	var o SeverityOverride
+	switch r.Method {
+	case http.MethodGet:
+		o, err = storage.GetSeverityOverride(r.Context(), storage.DB, id)
+	case http.MethodDelete:
+		err = storage.DeleteSeverityOverride(r.Context(), storage.DB, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Severity override not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("severity override failed", "id", id, "error", err)
+		http.Error(w, "Severity override failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		logging.FromContext(r.Context()).Info("severity override deleted", "id", id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o)
+}
+
+// validateSeverityOverride checks that a rule selects findings by
+// vulnerability or risk factor and sets a known severity
+func validateSeverityOverride(o SeverityOverride) error {
+	if o.CVEID == "" && o.RiskFactor == "" {
+		return errors.New("cve_id or risk_factor is required")
+	}
+	if !slices.Contains(report.Severities, o.Severity) {
+		return fmt.Errorf("invalid severity %q (want one of %s)", o.Severity, strings.Join(report.Severities, ", "))
+	}
+	if o.Org != "" && !orgName.MatchString(o.Org) {
+		return fmt.Errorf("invalid org %q", o.Org)
+	}
+	if len(o.CVEID) > 128 || len(o.RiskFactor) > 256 || len(o.Reason) > 1024 {
+		return errors.New("cve_id, risk_factor, or reason is too long")
+	}
+	return nil
+}
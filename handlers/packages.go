@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/osv"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// packagesFilePath is recorded as the file path of package lookup scans
+const packagesFilePath = "osv:packages"
+
+// PackageScanRequest defines the expected request structure for /packages/scan endpoint
+type PackageScanRequest = api.PackageScanRequest
+
+// PackageScanResponse defines the response structure for /packages/scan endpoint
+type PackageScanResponse = api.PackageScanResponse
+
+// PackageScanHandler looks up package versions in OSV and stores the findings
+func PackageScanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Decode and validate request body
+	var req PackageScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Repo = canonicalRepo(r.Context(), req.Repo)
+	auditTarget(r.Context(), req.Repo)
+	if req.Repo != "" && !checkRepoAccess(w, req.Repo) {
+		return
+	}
+	if len(req.Packages) == 0 {
+		http.Error(w, "At least one package is required", http.StatusBadRequest)
+		return
+	}
+	for _, p := range req.Packages {
+		if p.PURL == "" && (p.Name == "" || p.Ecosystem == "") {
+			http.Error(w, "Each package needs a purl or a name and ecosystem", http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := ScanPackages(r.Context(), req)
+	if errors.Is(err, errs.ErrQuotaExceeded) {
+		writeQuotaError(w, err)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("package scan failed", "repo", req.Repo, "error", err)
+		http.Error(w, "Package scan failed: "+err.Error(), errs.HTTPStatus(err, http.StatusBadGateway))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ScanPackages records the packages as a scan and materializes their OSV
+// findings into the vulnerabilities table. The scan counts as one file
+// against the tenant's quota. Repository access rules are left to the
+// caller.
+func ScanPackages(ctx context.Context, req PackageScanRequest) (PackageScanResponse, error) {
+	req.Repo = canonicalRepo(ctx, req.Repo)
+	if _, err := quota.Default.Reserve(ctx, quota.TenantFromContext(ctx)); err != nil {
+		return PackageScanResponse{}, err
+	}
+	components := make([]models.Component, 0, len(req.Packages))
+	for _, p := range req.Packages {
+		components = append(components, models.Component{
+			Name: p.Name, Version: p.Version, Ecosystem: p.Ecosystem, PURL: p.PURL, Type: "library",
+		})
+	}
+
+	// Look the packages up first, so a failed lookup stores nothing
+	found, err := osv.DefaultClient.Correlate(ctx, components)
+	if err != nil {
+		return PackageScanResponse{}, err
+	}
+
+	var (
+		scanID   int64
+		findings int
+	)
+	err = executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, source, tenant) VALUES (?, ?, ?, ?, ?, 'osv', ?)",
+			req.Repo, packagesFilePath, now, fmt.Sprintf("osv-%d", now.UnixNano()), storage.FormatTime(now), quota.TenantFromContext(ctx),
+		)
+		if err != nil {
+			return fmt.Errorf("insert scan failed: %v", err)
+		}
+		if scanID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("get scan ID failed: %v", err)
+		}
+		for _, c := range components {
+			if err := storage.InsertComponent(ctx, tx, scanID, c); err != nil {
+				return fmt.Errorf("insert component failed: %v", err)
+			}
+		}
+		if findings, err = osv.StoreFindings(ctx, tx, scanID, found); err != nil {
+			return err
+		}
+		// Resolve with the scan stored, before another ingest can commit
+		if _, err := storage.ResolveFindings(ctx, tx, req.Repo, now); err != nil {
+			return fmt.Errorf("resolve findings failed: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return PackageScanResponse{}, err
+	}
+
+	logging.FromContext(ctx).Info("package scan completed",
+		"repo", req.Repo, "packages", len(components), "findings", findings)
+	return PackageScanResponse{ScanID: scanID, Packages: len(components), Findings: findings}, nil
+}
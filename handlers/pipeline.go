@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/telemetry"
+)
+
+// IngestPipeline ingests every scan report, whether fetched from a
+// repository, produced by an image scan, or extracted from an archive.
+// Its built-in steps come first in each stage: fetch runs the ingest's
+// Source, decode parses the report with the registered format adapters,
+// enrich correlates SBOM components against OSV and the license policy,
+// and persist checks the scanner-reported status, then stores the results
+// and publishes their events. Extensions add steps or middleware at
+// startup; reprocessing runs decode, normalize, and enrich.
+var IngestPipeline = newIngestPipeline()
+
+// IngestBudget bounds the report content scans hold in memory, from
+// fetching each file until it is stored. A file waits for room before it is
+// downloaded, holding up further fetches of its scan.
+var IngestBudget = pipeline.NewBudget(0)
+
+// newIngestPipeline returns a pipeline with the built-in steps
+func newIngestPipeline() *pipeline.Pipeline {
+	p := pipeline.New()
+	p.Add(pipeline.Fetch, fetchContent)
+	p.Add(pipeline.Decode, decodeContent)
+	p.Add(pipeline.Enrich, correlateResults)
+	p.Add(pipeline.Persist, checkScanStatus)
+	p.Add(pipeline.Persist, persistResults)
+	return p
+}
+
+// Handling of reports whose scanner reported an incomplete run, in
+// IncompleteScanAction
+const (
+	IncompleteFlag = "flag" // Stored and marked incomplete, with a warning
+	IncompleteSkip = "skip" // Not stored; the file fails
+)
+
+// IncompleteScanAction is how reports with a status in
+// IncompleteScanStatuses are ingested
+var IncompleteScanAction = IncompleteFlag
+
+// IncompleteScanStatuses are the scanner-reported statuses, compared
+// ignoring case, that mark a run as incomplete
+var IncompleteScanStatuses = []string{"failed", "partial"}
+
+// isIncomplete reports whether a scanner-reported status marks the run as
+// incomplete
+func isIncomplete(status string) bool {
+	return slices.ContainsFunc(IncompleteScanStatuses, func(s string) bool { return strings.EqualFold(s, status) })
+}
+
+// checkScanStatus fails an ingest whose scanner reported an incomplete run
+// when IncompleteScanAction is IncompleteSkip, or else warns of it. An
+// ingest with results of an incomplete run never resolves findings it
+// leaves out, even those its complete results would.
+func checkScanStatus(ctx context.Context, in *pipeline.Ingest) error {
+	for _, sr := range in.Results {
+		if !isIncomplete(sr.ScanStatus) {
+			continue
+		}
+		if IncompleteScanAction == IncompleteSkip {
+			return failStep(FailureIncomplete, "scanner reported status %q, not ingested", sr.ScanStatus)
+		}
+		logging.FromContext(ctx).Warn("storing incomplete scan",
+			"repo", in.Repo, "file", in.File, "scan_id", sr.ScanID, "scan_status", sr.ScanStatus)
+		in.Warnings = append(in.Warnings, formats.Warning{
+			Index: -1, Reason: fmt.Sprintf("scanner reported status %q; stored as incomplete", sr.ScanStatus),
+		})
+	}
+	return nil
+}
+
+// stageCategories are the failure categories of errors from extension
+// steps, which the built-in steps don't categorize themselves
+var stageCategories = map[string]string{
+	pipeline.Fetch:     FailureFetch,
+	pipeline.Decode:    FailureParse,
+	pipeline.Normalize: FailureParse,
+	pipeline.Enrich:    FailureCorrelation,
+	pipeline.Persist:   FailureDB,
+}
+
+// fetchContent obtains the content from the ingest's source, unless it was
+// given up front
+func fetchContent(ctx context.Context, in *pipeline.Ingest) (err error) {
+	if in.Source == nil {
+		return nil
+	}
+	in.Content, err = in.Source(ctx)
+	return err
+}
+
+// parseFile converts a file into scan results, skipping malformed
+// vulnerability entries with a warning when lenient
+func parseFile(filePath string, content []byte, lenient bool) (string, []models.ScanResult, []formats.Warning, error) {
+	if lenient {
+		return formats.ParseFileLenient(filePath, content)
+	}
+	format, scanResults, err := formats.ParseFile(filePath, content)
+	return format, scanResults, nil, err
+}
+
+// decodeContent detects the report format and converts the content into
+// scan results
+func decodeContent(ctx context.Context, in *pipeline.Ingest) (err error) {
+	_, span := telemetry.StartSpan(ctx, "scan.parse", attribute.Int("vulnscan.bytes", len(in.Content)))
+	in.Format, in.Results, in.Warnings, err = parseFile(in.File, in.Content, in.Lenient)
+	span.SetAttributes(attribute.String("vulnscan.format", in.Format))
+	if err != nil {
+		err = failStep(FailureParse, "parse failed: %w", errs.Wrap(errs.ErrParse, err))
+		telemetry.EndSpan(span, err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("vulnscan.warnings", len(in.Warnings)))
+	telemetry.EndSpan(span, nil)
+	if len(in.Warnings) > 0 {
+		logging.FromContext(ctx).Warn("skipped malformed vulnerabilities",
+			"repo", in.Repo, "file", in.File, "count", len(in.Warnings), "first", in.Warnings[0].Reason)
+	}
+	return nil
+}
+
+// correlateResults derives findings from SBOM components
+func correlateResults(ctx context.Context, in *pipeline.Ingest) error {
+	if err := correlateComponents(ctx, in.Results); err != nil {
+		return failStep(FailureCorrelation, "correlation failed: %w", err)
+	}
+	return nil
+}
+
+// persistResults stores the scan results as scans of the ingest's file
+// carrying its labels, and publishes their events once committed
+func persistResults(ctx context.Context, in *pipeline.Ingest) error {
+	sum := sha256.Sum256(in.Content)
+	var pending []events.Event
+	err := executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		pending, in.ScanIDs = pending[:0], in.ScanIDs[:0]
+		scanTime := time.Now().UTC()
+
+		// Keep the original content for reprocessing
+		if RawFileEncoding != "" {
+			if err := storage.PutRawFile(ctx, tx, hex.EncodeToString(sum[:]), RawFileEncoding, in.Content); err != nil {
+				return fmt.Errorf("store raw file failed: %w", err)
+			}
+		}
+
+		// Findings recorded before this ingest, to announce the others as new
+		known, err := storage.RepoFindingKeys(ctx, tx, in.Repo)
+		if err != nil {
+			return fmt.Errorf("read findings failed: %w", err)
+		}
+
+		// Rows after the first carry its ID, so findings resolve against
+		// every scan result of the ingest
+		var ingestID interface{}
+		for _, sr := range in.Results {
+			res, err := tx.ExecContext(ctx,
+				`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, sha256, source, resource_type, resource_name,
+					scan_status, incomplete, tenant, ingest_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				in.Repo, in.File, scanTime, sr.ScanID, storage.FormatTime(sr.Timestamp), hex.EncodeToString(sum[:]), in.Format,
+				sr.ResourceType, sr.ResourceName, sr.ScanStatus, isIncomplete(sr.ScanStatus), quota.TenantFromContext(ctx),
+				ingestID,
+			)
+			if err != nil {
+				return fmt.Errorf("insert scan failed: %w", err)
+			}
+
+			scanID, err := res.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("get scan ID failed: %w", err)
+			}
+			in.ScanIDs = append(in.ScanIDs, scanID)
+			if ingestID == nil {
+				ingestID = scanID
+			}
+			if err := storage.InsertScanLabels(ctx, tx, scanID, in.Labels); err != nil {
+				return fmt.Errorf("insert labels failed: %w", err)
+			}
+
+			for _, c := range sr.Components {
+				if err := storage.InsertComponent(ctx, tx, scanID, c); err != nil {
+					return fmt.Errorf("insert component failed: %w", err)
+				}
+			}
+			for _, d := range sr.Dependencies {
+				if err := storage.InsertDependency(ctx, tx, scanID, d); err != nil {
+					return fmt.Errorf("insert dependency failed: %w", err)
+				}
+			}
+
+			for _, vuln := range sr.Vulnerabilities {
+				if vuln.Fingerprint == "" {
+					vuln.Fingerprint = storage.Fingerprint(quota.TenantFromContext(ctx), in.Repo, vuln)
+				}
+				if err := storage.InsertVulnerability(ctx, tx, scanID, vuln); err != nil {
+					return fmt.Errorf("insert vulnerability failed: %w", err)
+				}
+
+				if isAlertSeverity(vuln.Severity) {
+					pending = append(pending, events.Event{
+						Type: events.TypeVulnerability, Repo: in.Repo, Severity: vuln.Severity, Data: vuln,
+					})
+				}
+				if key := (storage.FindingKey{PackageName: vuln.PackageName, CVEID: vuln.CVEID}); !known[key] {
+					known[key] = true
+					pending = append(pending, events.Event{
+						Type: events.TypeFinding, Repo: in.Repo, Severity: vuln.Severity, Data: vuln,
+					})
+				}
+			}
+
+			pending = append(pending, events.Event{
+				Type: events.TypeScan,
+				Repo: in.Repo,
+				Data: ScanEvent{File: in.File, ScanID: sr.ScanID, ScanStatus: sr.ScanStatus,
+					Incomplete: isIncomplete(sr.ScanStatus), Vulnerabilities: len(sr.Vulnerabilities)},
+			})
+		}
+
+		// Close out findings the rescan no longer reports
+		resolved, err := storage.ResolveFindings(ctx, tx, in.Repo, scanTime)
+		if err != nil {
+			return fmt.Errorf("resolve findings failed: %w", err)
+		}
+		for i := len(pending) - 1; i >= 0 && resolved > 0; i-- {
+			if se, ok := pending[i].Data.(ScanEvent); ok {
+				se.Resolved = int(resolved) // Reported on the file's last scan event
+				pending[i].Data = se
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range pending {
+		events.Default.Publish(e)
+	}
+	return nil
+}
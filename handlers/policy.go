@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/policy"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/vex"
+)
+
+// PolicyEvaluateRequest defines the request structure for POST /policy/evaluate
+type PolicyEvaluateRequest = api.PolicyEvaluateRequest
+
+// PolicyHandler evaluates a repository's open findings against a policy and
+// returns a pass/fail verdict. The response is 200 either way; CI callers
+// check the `passed` field.
+func PolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PolicyEvaluateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Repo = canonicalRepo(r.Context(), req.Repo); req.Repo == "" {
+		http.Error(w, "repo is required", http.StatusBadRequest)
+		return
+	}
+
+	p := policy.Policy{Name: "inline", Rules: req.Rules}
+	if len(req.Rules) == 0 {
+		name := req.Policy
+		if name == "" {
+			name = policy.Default.Name
+		}
+		var ok bool
+		if p, ok = policy.Policies[name]; !ok {
+			http.Error(w, "Unknown policy "+name, http.StatusBadRequest)
+			return
+		}
+	} else if err := policy.Validate(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	findings, err := gateFindings(r.Context(), storage.DB, req.Repo, req.Files)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("policy evaluation failed", "error", err)
+		http.Error(w, "Policy evaluation failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := policy.Evaluate(p, findings)
+
+	logging.FromContext(r.Context()).Info("policy evaluated",
+		"repo", req.Repo, "policy", p.Name, "passed", result.Passed, "violations", len(result.Violations))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// gateFindings returns the findings policies and badges count: open or
+// acknowledged findings in the latest scan of each of the repository's
+// files, or of the given files, excluding those a VEX statement marks as
+// not affected or fixed, with their severity after overrides. Policy gates
+// read them from the primary, so a gate run right after a scan never
+// misses it on a lagging replica.
+func gateFindings(ctx context.Context, db *sqlx.DB, repo string, files []string) ([]models.Vulnerability, error) {
+	query := `SELECT
+		v.id AS finding_id, v.cve_id, v.severity, v.cvss, v.status, v.package_name, v.current_version,
+		v.fixed_version, v.description, v.published_date, v.link, v.risk_factors,
+		v.ecosystem, v.purl, v.location, v.fingerprint, v.triage_status, v.assignee,
+		e.epss, e.percentile AS epss_percentile, ` + kevColumn + `,
+		` + storage.EffectiveSeverity + ` AS effective_severity
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		LEFT JOIN epss_scores e ON e.cve_id = v.cve_id
+		WHERE s.repo = ? AND v.triage_status IN (?, ?)
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)`
+	args := []interface{}{repo, TriageOpen, TriageAcknowledged}
+	if len(files) > 0 {
+		query += " AND s.file_path IN (?)"
+		args = append(args, files)
+	}
+	query, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var vulns []models.Vulnerability
+	if err := db.SelectContext(ctx, &vulns, query, args...); err != nil {
+		return nil, err
+	}
+	if err := storage.AttachVEX(ctx, db, vulns); err != nil {
+		return nil, err
+	}
+
+	kept := vulns[:0]
+	for _, v := range vulns {
+		if v.VEX != nil && (strings.EqualFold(v.VEX.Status, vex.StatusNotAffected) || strings.EqualFold(v.VEX.Status, vex.StatusFixed)) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept, nil
+}
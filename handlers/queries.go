@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// SavedQuery is a named set of query filters stored for reuse
+type SavedQuery = api.SavedQuery
+
+// savedQueryName matches names of saved queries, e.g. prod-critical
+var savedQueryName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// SavedQueriesHandler lists saved queries on GET and saves one on POST,
+// replacing any of the same name
+func SavedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		queries, err := ListSavedQueries(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("list saved queries failed", "error", err)
+			http.Error(w, "List saved queries failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(queries)
+
+	case http.MethodPost:
+		var q SavedQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		auditTarget(r.Context(), q.Name)
+		if err := validateSavedQuery(q); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		created, err := SaveQuery(r.Context(), &q)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("save query failed", "name", q.Name, "error", err)
+			http.Error(w, "Save query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Info("query saved", "name", q.Name, "created", created)
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.Header().Set("Location", "/queries/"+q.Name)
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(q)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SavedQueryHandler returns the saved query in the path on GET and deletes
+// it on DELETE
+func SavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var (
+		q   SavedQuery
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		q, err = GetSavedQuery(r.Context(), name)
+	case http.MethodDelete:
+		err = storage.DeleteSavedQuery(r.Context(), storage.DB, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Saved query not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("saved query failed", "name", name, "error", err)
+		http.Error(w, "Saved query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		logging.FromContext(r.Context()).Info("saved query deleted", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(q)
+}
+
+// RunSavedQueryHandler runs the saved query in the path, writing the
+// results in the format the Accept header selects, as /query does. The
+// count_only=true or exists_only=true parameter returns just the count or
+// whether there are results.
+func RunSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := GetSavedQuery(r.Context(), r.PathValue("name"))
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Saved query not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("saved query failed", "name", r.PathValue("name"), "error", err)
+		http.Error(w, "Saved query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeQueryResults(w, r, QueryRequest{
+		Filters:    q.Filters,
+		Columns:    q.Columns,
+		CountOnly:  r.URL.Query().Get("count_only") == "true",
+		ExistsOnly: r.URL.Query().Get("exists_only") == "true",
+	})
+}
+
+// validateSavedQuery checks the name, filters, and columns of a query
+func validateSavedQuery(q SavedQuery) error {
+	if !savedQueryName.MatchString(q.Name) {
+		return fmt.Errorf("invalid name %q", q.Name)
+	}
+	if len(q.Description) > 1024 {
+		return fmt.Errorf("description must be at most 1024 bytes")
+	}
+	if err := ValidateQueryFilters(q.Filters); err != nil {
+		return err
+	}
+	_, err := export.SelectColumns(q.Columns)
+	return err
+}
+
+// SaveQuery stores a query under its name, reporting whether it was newly
+// created, and sets its timestamps
+func SaveQuery(ctx context.Context, q *SavedQuery) (bool, error) {
+	filters, err := json.Marshal(q.Filters)
+	if err != nil {
+		return false, err
+	}
+	row := storage.SavedQuery{
+		Name: q.Name, Description: q.Description, Filters: string(filters), Columns: models.StringList(q.Columns),
+	}
+	created, err := storage.UpsertSavedQuery(ctx, storage.DB, &row)
+	q.CreatedAt, q.UpdatedAt = row.CreatedAt, row.UpdatedAt
+	return created, err
+}
+
+// GetSavedQuery returns the query saved under name, or errs.ErrNotFound
+func GetSavedQuery(ctx context.Context, name string) (SavedQuery, error) {
+	row, err := storage.GetSavedQuery(ctx, storage.DB, name)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	return fromSavedQueryRow(row)
+}
+
+// ListSavedQueries returns every saved query ordered by name
+func ListSavedQueries(ctx context.Context) ([]SavedQuery, error) {
+	rows, err := storage.ListSavedQueries(ctx, storage.DB)
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]SavedQuery, 0, len(rows))
+	for _, row := range rows {
+		q, err := fromSavedQueryRow(row)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// fromSavedQueryRow decodes a stored query
+func fromSavedQueryRow(row storage.SavedQuery) (SavedQuery, error) {
+	q := SavedQuery{
+		Name: row.Name, Description: row.Description, Columns: row.Columns,
+		CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(row.Filters), &q.Filters); err != nil {
+		return q, fmt.Errorf("saved query %q: invalid filters: %v", row.Name, err)
+	}
+	return q, nil
+}
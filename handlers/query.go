@@ -1,20 +1,135 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
+	"strings"
 
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/defectdojo"
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/filterexpr"
+	"github.com/Chinzzii/vulnscan/license"
+	"github.com/Chinzzii/vulnscan/logging"
 	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+	"github.com/Chinzzii/vulnscan/sarif"
 	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// QueryRequest defines the expected request structure for /query endpoint
-type QueryRequest struct {
-	Filters struct {
-		Severity string `json:"severity"` // Severity filter value
-	} `json:"filters"`
+// sarifMediaType is the Accept value that selects SARIF output
+const sarifMediaType = "application/sarif+json"
+
+// kevColumn selects whether a finding's identifier, or any alias of it, is
+// in the KEV catalog
+const kevColumn = `EXISTS (SELECT 1 FROM kev_catalog k WHERE k.cve_id = v.cve_id
+			OR k.cve_id IN (SELECT alias FROM identifiers WHERE identifier = v.cve_id)) AS kev`
+
+// Deduplication keys of QueryFilters.Dedup. Occurrences are only ever merged
+// within one repository.
+const (
+	DedupCVEPURL    = "cve+purl"    // Same identifier and package URL, which includes the version
+	DedupCVEPackage = "cve+package" // Same identifier, package name ignoring case, and version
+	DedupOff        = "off"         // Every stored occurrence is returned
+)
+
+// Severity sources of QueryFilters.SeveritySource, the opinions of a
+// finding's severity a severity filter can match
+const (
+	SeveritySourceEffective = "effective" // The first of override, reported, and NVD severity; see storage.EffectiveSeverity
+	SeveritySourceReported  = "reported"  // The severity the scanner reported
+	SeveritySourceNVD       = "nvd"       // NVD's rating of the CVSS base score
+	SeveritySourceOverride  = "override"  // The severity of the matching severity override
+)
+
+// severitySourceColumns are the SQL expressions of each severity source
+var severitySourceColumns = map[string]string{
+	"":                      storage.EffectiveSeverity,
+	SeveritySourceEffective: storage.EffectiveSeverity,
+	SeveritySourceReported:  "v.severity",
+	SeveritySourceNVD:       storage.NVDSeverity,
+	SeveritySourceOverride:  storage.OverrideSeverity,
+}
+
+// DefaultDedupKey applies to queries that don't choose a deduplication key
+var DefaultDedupKey = DedupCVEPURL
+
+// QueryExprFields are the fields filter expressions can compare, over the
+// columns of QueryVulnerabilities
+var QueryExprFields = map[string]filterexpr.Field{
+	"id":                {Column: "v.cve_id"},
+	"cve_id":            {Column: "v.cve_id"},
+	"severity":          {Column: storage.EffectiveSeverity},
+	"reported_severity": {Column: "v.severity"},
+	"nvd_severity":      {Column: "COALESCE(" + storage.NVDSeverity + ", '')"},
+	"override_severity": {Column: "COALESCE(" + storage.OverrideSeverity + ", '')"},
+	"cvss":              {Column: "v.cvss", Numeric: true},
+	"epss":              {Column: "e.epss", Numeric: true},
+	"status":            {Column: "COALESCE(v.status, '')"},
+	"package_name":      {Column: "v.package_name"},
+	"current_version":   {Column: "v.current_version"},
+	"fixed_version":     {Column: "COALESCE(v.fixed_version, '')"},
+	"ecosystem":         {Column: "COALESCE(v.ecosystem, '')"},
+	"purl":              {Column: "COALESCE(v.purl, '')"},
+	"package_class":     {Column: "v.package_class"},
+	"location":          {Column: "v.location"},
+	"fingerprint":       {Column: "v.fingerprint"},
+	"resource_type":     {Column: "COALESCE(s.resource_type, '')"},
+	"resource_name":     {Column: "COALESCE(s.resource_name, '')"},
+	"triage_status":     {Column: "COALESCE(v.triage_status, '')"},
+	"assignee":          {Column: "COALESCE(v.assignee, '')"},
+	"repo":              {Column: "COALESCE(s.repo, '')"},
+	"source":            {Column: "COALESCE(s.source, s.file_path, '')"},
+}
+
+// querySort is a key query results can be ordered by
+type querySort struct {
+	column string                           // SQL expression of the key, over the columns loadVulnerabilities reads
+	value  func(v models.Vulnerability) any // Value of the column for a result, as cursors record it
 }
 
+// severityRankColumn ranks effective severities as severityRank does
+const severityRankColumn = `CASE UPPER(effective_severity) WHEN 'CRITICAL' THEN 4 WHEN 'HIGH' THEN 3
+	WHEN 'MEDIUM' THEN 2 WHEN 'LOW' THEN 1 ELSE 0 END`
+
+// querySortKeys are the keys of QueryFilters.Sort, ordering ascending
+var querySortKeys = map[string]querySort{
+	"severity": {severityRankColumn, func(v models.Vulnerability) any {
+		return severityRank[strings.ToUpper(effectiveSeverity(v))]
+	}},
+	"cvss":           {"cvss", func(v models.Vulnerability) any { return v.CVSS }},
+	"epss":           {"COALESCE(epss, -1)", func(v models.Vulnerability) any { return epssScore(v) }},
+	"cve_id":         {"cve_id", func(v models.Vulnerability) any { return v.CVEID }},
+	"package":        {"package_name", func(v models.Vulnerability) any { return v.PackageName }},
+	"published_date": {"published_date", func(v models.Vulnerability) any { return storage.FormatTime(v.PublishedDate) }},
+	"finding_id":     {"finding_id", func(v models.Vulnerability) any { return v.FindingID }},
+}
+
+// DefaultQuerySort orders query results, after any sort keys a query
+// gives. Remaining ties are broken by finding ID, so the order doesn't
+// depend on how the database returns rows.
+var DefaultQuerySort = []string{"-severity", "-cvss", "cve_id"}
+
+// QueryRequest defines the expected request structure for /query endpoint
+type QueryRequest = api.QueryRequest
+
+// QueryFilters restricts which vulnerabilities a query returns
+type QueryFilters = api.QueryFilters
+
+// QueryCount is the response of a count-only query
+type QueryCount = api.QueryCount
+
+// QueryExists is the response of an exists-only query
+type QueryExists = api.QueryExists
+
 // QueryHandler processes the query request and returns the matching vulnerabilities
 func QueryHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode and validate request body
@@ -24,24 +139,563 @@ func QueryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Filters.Severity == "" {
-		http.Error(w, "Severity filter is required", http.StatusBadRequest)
+	if err := ValidateQueryFilters(req.Filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	writeQueryResults(w, r, req)
+}
 
-	// Query the database for vulnerabilities matching the severity
-	var vulns []models.Vulnerability
-	query := `SELECT 
-		cve_id, severity, cvss, status, package_name, current_version, 
-		fixed_version, description, published_date, link, risk_factors 
-		FROM vulnerabilities WHERE severity = ?`
+// writeQueryResults runs a validated query and writes the vulnerabilities in
+// the format the Accept header selects: JSON, SARIF, DefectDojo findings,
+// CSV, or Excel. It writes at most the request's limit of them, and no more
+// than QueryMaxRows except for complete DefectDojo and spreadsheet exports.
+// A count-only or exists-only query writes just that, as JSON.
+func writeQueryResults(w http.ResponseWriter, r *http.Request, req QueryRequest) {
+	if req.CountOnly && req.ExistsOnly {
+		http.Error(w, "count_only and exists_only are mutually exclusive", http.StatusBadRequest)
+		return
+	}
+	if req.CountOnly || req.ExistsOnly {
+		var (
+			resp any
+			err  error
+		)
+		if req.CountOnly {
+			var c QueryCount
+			c.Count, err = CountVulnerabilities(r.Context(), req.Filters)
+			resp = c
+		} else {
+			var e QueryExists
+			e.Exists, err = VulnerabilitiesExist(r.Context(), req.Filters)
+			resp = e
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("query failed", "error", err)
+			http.Error(w, "Query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
 
-	if err := storage.DB.Select(&vulns, query, req.Filters.Severity); err != nil {
+	after, err := validateQueryPage(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve spreadsheet columns up front so a typo fails before the query
+	accept := r.Header.Get("Accept")
+	spreadsheet := strings.Contains(accept, export.CSVMediaType) || strings.Contains(accept, export.XLSXMediaType)
+	var columns []export.Column
+	if spreadsheet {
+		if columns, err = export.SelectColumns(req.Columns); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	maxRows := QueryMaxRows
+	if spreadsheet || strings.Contains(accept, defectdojo.MediaType) {
+		maxRows = 0 // Exports are meant to be complete
+	}
+	page, err := queryPage(r.Context(), req, after, maxRows)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("query failed", "error", err)
 		http.Error(w, "Query failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	setPageHeaders(w, page)
+	vulns := page.Results
+
+	// Export as SARIF when requested, e.g. for GitHub code scanning upload
+	if strings.Contains(accept, sarifMediaType) {
+		w.Header().Set("Content-Type", sarifMediaType)
+		json.NewEncoder(w).Encode(sarif.Export(vulns, ""))
+		return
+	}
 
-	// Return the list of vulnerabilities as JSON response
+	// Export as DefectDojo findings when requested, for its generic import
+	if strings.Contains(accept, defectdojo.MediaType) {
+		w.Header().Set("Content-Type", defectdojo.MediaType)
+		json.NewEncoder(w).Encode(defectdojo.Export(vulns))
+		return
+	}
+
+	// Export as a spreadsheet when requested
+	if strings.Contains(accept, export.XLSXMediaType) {
+		w.Header().Set("Content-Type", export.XLSXMediaType)
+		w.Header().Set("Content-Disposition", `attachment; filename="vulnerabilities.xlsx"`)
+		if err := export.WriteXLSX(w, vulns, columns); err != nil {
+			logging.FromContext(r.Context()).Error("xlsx export failed", "error", err)
+		}
+		return
+	}
+	if spreadsheet {
+		w.Header().Set("Content-Type", export.CSVMediaType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="vulnerabilities.csv"`)
+		if err := export.WriteCSV(w, vulns, columns); err != nil {
+			logging.FromContext(r.Context()).Error("csv export failed", "error", err)
+		}
+		return
+	}
+
+	// Return the list of vulnerabilities as JSON response, as a page when
+	// the request pages through them or results were left out
 	w.Header().Set("Content-Type", "application/json")
+	if req.Limit > 0 || req.Cursor != "" || page.Truncated {
+		json.NewEncoder(w).Encode(page)
+		return
+	}
 	json.NewEncoder(w).Encode(vulns)
 }
+
+// ValidateQueryFilters checks that filters select a bounded, well-formed result
+func ValidateQueryFilters(f QueryFilters) error {
+	if f.Severity == "" && f.ID == "" && f.PURL == "" && f.License == "" && len(f.Labels) == 0 && len(f.CustomFields) == 0 && f.Expr == "" {
+		return errors.New("Severity, id, purl, license, labels, custom_fields, or expr filter is required")
+	}
+	if f.Expr != "" {
+		if _, _, err := filterexpr.Compile(f.Expr, QueryExprFields); err != nil {
+			return err
+		}
+	}
+	if err := ValidateLabels(f.Labels); err != nil {
+		return err
+	}
+	if err := ValidateCustomFieldFilter(f.CustomFields); err != nil {
+		return err
+	}
+	if f.EPSSMin != nil && (*f.EPSSMin < 0 || *f.EPSSMin > 1) {
+		return errors.New("epss_min must be between 0 and 1")
+	}
+	switch f.PackageClass {
+	case "", purl.ClassOS, purl.ClassApplication:
+	default:
+		return fmt.Errorf("unknown package_class %q (want %s or %s)", f.PackageClass, purl.ClassOS, purl.ClassApplication)
+	}
+	if _, ok := severitySourceColumns[f.SeveritySource]; !ok {
+		return fmt.Errorf("unknown severity_source %q (want %s, %s, %s, or %s)", f.SeveritySource,
+			SeveritySourceEffective, SeveritySourceReported, SeveritySourceNVD, SeveritySourceOverride)
+	}
+	if err := ValidateQuerySort(f.Sort); err != nil {
+		return err
+	}
+	return ValidateDedupKey(f.Dedup)
+}
+
+// ValidateQuerySort checks that every sort key is known
+func ValidateQuerySort(keys []string) error {
+	for _, k := range keys {
+		if _, ok := querySortKeys[strings.TrimPrefix(k, "-")]; !ok {
+			names := slices.Sorted(maps.Keys(querySortKeys))
+			return fmt.Errorf("unknown sort key %q (want one of %s, optionally prefixed with -)", k, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// sortTerm is a sort key in the direction it orders by
+type sortTerm struct {
+	querySort
+	desc bool
+}
+
+// sortTerms returns the terms results are ordered by: the keys, then
+// DefaultQuerySort and finding ID. Unknown keys are ignored.
+func sortTerms(keys []string) []sortTerm {
+	var terms []sortTerm
+	for _, k := range append(append(slices.Clip(keys), DefaultQuerySort...), "finding_id") {
+		if key, ok := querySortKeys[strings.TrimPrefix(k, "-")]; ok {
+			terms = append(terms, sortTerm{key, strings.HasPrefix(k, "-")})
+		}
+	}
+	return terms
+}
+
+// sortKey returns the values of a result's sort terms
+func sortKey(terms []sortTerm, v models.Vulnerability) []any {
+	key := make([]any, len(terms))
+	for i, t := range terms {
+		key[i] = t.value(v)
+	}
+	return key
+}
+
+// pageClause returns the condition selecting results that sort after the
+// key, or every result when it is nil, followed by the ORDER BY of the
+// terms and, unless limit is 0, a LIMIT, and the clause's arguments
+func pageClause(terms []sortTerm, after []any, limit int) (string, []interface{}) {
+	var (
+		clause string
+		args   []interface{}
+	)
+	if after != nil {
+		// Results past the key on the first term they differ from it in
+		var or []string
+		for i, t := range terms {
+			var and []string
+			for j := range i {
+				and = append(and, terms[j].column+" = ?")
+				args = append(args, after[j])
+			}
+			op := " > ?"
+			if t.desc {
+				op = " < ?"
+			}
+			and = append(and, t.column+op)
+			args = append(args, after[i])
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		clause = " AND (" + strings.Join(or, " OR ") + ")"
+	}
+
+	order := make([]string, len(terms))
+	for i, t := range terms {
+		order[i] = t.column
+		if t.desc {
+			order[i] += " DESC"
+		}
+	}
+	clause += " ORDER BY " + strings.Join(order, ", ")
+	if limit > 0 {
+		clause += " LIMIT ?"
+		args = append(args, limit)
+	}
+	return clause, args
+}
+
+// effectiveSeverity returns the effective severity, when read with it, or
+// the reported one
+func effectiveSeverity(v models.Vulnerability) string {
+	if v.EffectiveSeverity != "" {
+		return v.EffectiveSeverity
+	}
+	return v.Severity
+}
+
+// epssScore returns the EPSS probability, or -1 for findings without one so
+// they sort below every scored finding
+func epssScore(v models.Vulnerability) float64 {
+	if v.EPSS == nil {
+		return -1
+	}
+	return *v.EPSS
+}
+
+// ValidateDedupKey checks that key is empty or a known deduplication key
+func ValidateDedupKey(key string) error {
+	switch key {
+	case "", DedupCVEPURL, DedupCVEPackage, DedupOff:
+		return nil
+	}
+	return fmt.Errorf("unknown dedup key %q (want %s, %s, or %s)", key, DedupCVEPURL, DedupCVEPackage, DedupOff)
+}
+
+// QueryVulnerabilities returns stored vulnerabilities matching the filters.
+// An id filter matches the stored identifier or any known alias of it, so a
+// GHSA ID finds findings recorded under the corresponding CVE and vice versa.
+// Occurrences of a vulnerability are merged by the filters' dedup key, each
+// listing the sources that reported it, and results are ordered by the
+// filters' sort keys and DefaultQuerySort. A severity filter matches the
+// effective severity, or the filters' severity source, and each result
+// carries every opinion of its severity.
+func QueryVulnerabilities(ctx context.Context, filters QueryFilters) ([]models.Vulnerability, error) {
+	vulns, _, err := queryVulnerabilitiesAfter(ctx, filters, nil, 0)
+	return vulns, err
+}
+
+// queryVulnerabilitiesAfter returns the results of QueryVulnerabilities
+// that sort after the key, or all of them when it is nil, at most limit of
+// them unless it is 0, and whether more follow. The database orders and
+// limits the results, so only those returned are read.
+func queryVulnerabilitiesAfter(ctx context.Context, filters QueryFilters, after []any, limit int) ([]models.Vulnerability, bool, error) {
+	where, args, err := queryConditions(filters)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "db.query",
+		attribute.String("db.system", "sqlite"),
+		attribute.String("vulnscan.severity", filters.Severity),
+	)
+	var (
+		terms = sortTerms(filters.Sort)
+		vulns = []models.Vulnerability{}
+		more  bool
+	)
+	for {
+		// One result past the limit tells whether more follow. VEX
+		// statements are matched in Go, so results a VEX status filter
+		// drops are made up for by reading on.
+		want := 0
+		if limit > 0 {
+			want = limit - len(vulns) + 1
+		}
+		page, pageArgs := pageClause(terms, after, want)
+		var batch []models.Vulnerability
+		batch, err = loadVulnerabilities(ctx, where, args, dedupKeyOf(filters), filters.IncludeRaw, page, pageArgs)
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		read := len(batch)
+		after = sortKey(terms, batch[read-1])
+		if filters.VEXStatus != "" {
+			batch = filterVEXStatus(batch, filters.VEXStatus)
+		}
+		vulns = append(vulns, batch...)
+		if limit > 0 && len(vulns) > limit {
+			vulns, more = vulns[:limit], true
+			break
+		}
+		if want == 0 || read < want {
+			break
+		}
+	}
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return vulns, more, nil
+}
+
+// loadVulnerabilities reads the vulnerabilities the WHERE clause selects,
+// merged by the dedup key, with their CVE metadata, aliases, VEX
+// statements, labels, custom fields, and, when includeRaw is set, raw
+// report fields. The page clause, as pageClause returns, applies to the
+// merged results.
+func loadVulnerabilities(ctx context.Context, where string, args []interface{}, key string, includeRaw bool, page string, pageArgs []interface{}) ([]models.Vulnerability, error) {
+	var rows []queryRow
+	raw := ""
+	if includeRaw {
+		raw = " v.raw_json,"
+	}
+	// A merged result is the latest occurrence of its key, listing the
+	// sources of every occurrence
+	partition := dedupPartitions[key]
+	query := `SELECT * FROM (SELECT 
+		v.id AS finding_id, v.cve_id, v.severity, v.cvss, v.status, v.package_name, v.current_version, 
+		v.fixed_version, v.description, v.published_date, v.link, v.risk_factors,
+		v.ecosystem, v.purl, v.package_class, v.location, v.fingerprint, v.triage_status, v.assignee, COALESCE(j.issue_key, '') AS jira_issue,` + raw + `
+		e.epss, e.percentile AS epss_percentile, ` + kevColumn + `,
+		` + storage.EffectiveSeverity + ` AS effective_severity,
+		COALESCE(` + storage.NVDSeverity + `, '') AS nvd_severity,
+		COALESCE(` + storage.OverrideSeverity + `, '') AS override_severity,
+		GROUP_CONCAT(COALESCE(s.source, s.file_path, ''), char(31)) OVER (PARTITION BY ` + partition + `) AS sources,
+		ROW_NUMBER() OVER (PARTITION BY ` + partition + ` ORDER BY v.id DESC) AS occurrence
+		FROM vulnerabilities v LEFT JOIN epss_scores e ON e.cve_id = v.cve_id
+		LEFT JOIN jira_issues j ON j.cve_id = v.cve_id AND j.package_name = v.package_name
+		LEFT JOIN scans s ON s.id = v.scan_id` + where + `)
+		WHERE occurrence = 1` + page
+	if err := storage.Statements.SelectContext(ctx, storage.Queryer(ctx), &rows, query, append(slices.Clip(args), pageArgs...)...); err != nil {
+		return nil, err
+	}
+	vulns := make([]models.Vulnerability, len(rows))
+	for i, row := range rows {
+		vulns[i] = row.Vulnerability
+		vulns[i].Sources = row.sourceList()
+	}
+	err := storage.AttachCVEMetadata(ctx, storage.Queryer(ctx), vulns)
+	if err == nil {
+		err = storage.AttachAliases(ctx, storage.Queryer(ctx), vulns)
+	}
+	if err == nil {
+		err = storage.AttachVEX(ctx, storage.Queryer(ctx), vulns)
+	}
+	if err == nil {
+		err = storage.AttachLabels(ctx, storage.Queryer(ctx), vulns)
+	}
+	if err == nil {
+		err = storage.AttachCustomFields(ctx, storage.Queryer(ctx), vulns)
+	}
+	return vulns, err
+}
+
+// CountVulnerabilities returns how many results QueryVulnerabilities would
+// return for the filters, without reading the results' details
+func CountVulnerabilities(ctx context.Context, filters QueryFilters) (int, error) {
+	// VEX statements are matched to findings in Go
+	if filters.VEXStatus != "" {
+		vulns, err := QueryVulnerabilities(ctx, filters)
+		return len(vulns), err
+	}
+	where, args, err := queryConditions(filters)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "db.query",
+		attribute.String("db.system", "sqlite"),
+		attribute.String("vulnscan.severity", filters.Severity),
+	)
+	var count int
+	key := dedupKeyOf(filters)
+	if key == DedupOff {
+		err = storage.Statements.GetContext(ctx, storage.Queryer(ctx), &count, "SELECT COUNT(*)"+queryFrom+where, args...)
+	} else {
+		// Count distinct dedup keys in the database
+		err = storage.Statements.GetContext(ctx, storage.Queryer(ctx), &count,
+			"SELECT COUNT(*) FROM (SELECT DISTINCT "+dedupPartitions[key]+queryFrom+where+")", args...)
+	}
+	telemetry.EndSpan(span, err)
+	return count, err
+}
+
+// VulnerabilitiesExist reports whether QueryVulnerabilities would return
+// any result for the filters, stopping at the first match
+func VulnerabilitiesExist(ctx context.Context, filters QueryFilters) (bool, error) {
+	if filters.VEXStatus != "" {
+		n, err := CountVulnerabilities(ctx, filters)
+		return n > 0, err
+	}
+	where, args, err := queryConditions(filters)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "db.query",
+		attribute.String("db.system", "sqlite"),
+		attribute.String("vulnscan.severity", filters.Severity),
+	)
+	var exists bool
+	err = storage.Statements.GetContext(ctx, storage.Queryer(ctx), &exists, "SELECT EXISTS (SELECT 1"+queryFrom+where+")", args...)
+	telemetry.EndSpan(span, err)
+	return exists, err
+}
+
+// queryFrom joins the tables whose columns query conditions refer to, for
+// counting matches
+const queryFrom = ` FROM vulnerabilities v LEFT JOIN epss_scores e ON e.cve_id = v.cve_id
+	LEFT JOIN scans s ON s.id = v.scan_id`
+
+// queryConditions returns the WHERE clause selecting the filters' matches,
+// empty when no filter is set, and its arguments
+func queryConditions(filters QueryFilters) (string, []interface{}, error) {
+	// Build the WHERE clause from the filters that are set
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filters.Severity != "" {
+		// The severity source decides which opinion a severity selects
+		where = append(where, severitySourceColumns[filters.SeveritySource]+" = ?")
+		args = append(args, filters.Severity)
+	}
+	if filters.ID != "" {
+		where = append(where, "(v.cve_id = ? OR v.cve_id IN (SELECT alias FROM identifiers WHERE identifier = ?))")
+		args = append(args, filters.ID, filters.ID)
+	}
+	if filters.PURL != "" {
+		// A version-less purl matches every version of the package
+		p := purl.Normalize(filters.PURL)
+		if strings.Contains(p, "@") {
+			where = append(where, "v.purl = ?")
+			args = append(args, p)
+		} else {
+			where = append(where, "(v.purl = ? OR v.purl LIKE ? ESCAPE '\\')")
+			args = append(args, p, strings.NewReplacer("%", "\\%", "_", "\\_").Replace(p)+"@%")
+		}
+	}
+	if filters.TriageStatus != "" {
+		where = append(where, "v.triage_status = ?")
+		args = append(args, filters.TriageStatus)
+	}
+	if filters.Assignee != "" {
+		where = append(where, "v.assignee = ?")
+		args = append(args, filters.Assignee)
+	}
+	if filters.PackageClass != "" {
+		where = append(where, "v.package_class = ?")
+		args = append(args, filters.PackageClass)
+	}
+	if filters.Ecosystem != "" {
+		where = append(where, "v.ecosystem = ? COLLATE NOCASE")
+		args = append(args, filters.Ecosystem)
+	}
+	if filters.ResourceType != "" {
+		where = append(where, "s.resource_type = ?")
+		args = append(args, filters.ResourceType)
+	}
+	if filters.EPSSMin != nil {
+		where = append(where, "e.epss >= ?")
+		args = append(args, *filters.EPSSMin)
+	}
+	if filters.License != "" {
+		// License violations are stored under license:<id>; * is a wildcard
+		pattern := strings.NewReplacer("%", "\\%", "_", "\\_", "*", "%").Replace(filters.License)
+		where = append(where, "v.cve_id LIKE ? ESCAPE '\\'")
+		args = append(args, license.IDPrefix+pattern)
+	}
+	if len(filters.Labels) > 0 {
+		cond, labelArgs := storage.LabelFilter("v.scan_id", filters.Labels)
+		where = append(where, cond)
+		args = append(args, labelArgs...)
+	}
+	if len(filters.CustomFields) > 0 {
+		cond, fieldArgs := storage.CustomFieldFilter(filters.CustomFields)
+		where = append(where, cond)
+		args = append(args, fieldArgs...)
+	}
+	if filters.Expr != "" {
+		cond, exprArgs, err := filterexpr.Compile(filters.Expr, QueryExprFields)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, cond)
+		args = append(args, exprArgs...)
+	}
+	if len(where) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args, nil
+}
+
+// queryRow is a queried vulnerability, the latest occurrence of its dedup
+// key
+type queryRow struct {
+	models.Vulnerability
+	Sources    string `db:"sources"`    // Formats, or files for scans stored without one, of every occurrence, separated by \x1f
+	Occurrence int    `db:"occurrence"` // Position among occurrences, latest first
+}
+
+// sourceList returns the distinct sources of the row's occurrences, sorted
+func (row queryRow) sourceList() []string {
+	var sources []string
+	for _, source := range strings.Split(row.Sources, "\x1f") {
+		if source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// dedupPartitions are the SQL expressions occurrences are merged by under
+// each dedup key, always within one repository
+var dedupPartitions = map[string]string{
+	DedupCVEPURL:    "COALESCE(s.repo, ''), v.cve_id, v.purl",
+	DedupCVEPackage: "COALESCE(s.repo, ''), v.cve_id, LOWER(v.package_name), v.current_version",
+	DedupOff:        "v.id",
+}
+
+// dedupKeyOf returns the filters' dedup key, or DefaultDedupKey
+func dedupKeyOf(filters QueryFilters) string {
+	if filters.Dedup == "" {
+		return DefaultDedupKey
+	}
+	return filters.Dedup
+}
+
+// filterVEXStatus keeps vulnerabilities whose VEX status matches. Findings
+// without a statement match "none".
+func filterVEXStatus(vulns []models.Vulnerability, status string) []models.Vulnerability {
+	kept := vulns[:0]
+	for _, v := range vulns {
+		if (v.VEX == nil && status == "none") || (v.VEX != nil && v.VEX.Status == status) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/api"
+)
+
+// QueryPage is the JSON response of a query that sets a limit or a cursor,
+// or whose results were cut at QueryMaxRows
+type QueryPage = api.QueryPage
+
+// QueryMaxRows bounds the JSON and SARIF results of a query that doesn't
+// set its own limit, so an accidentally broad query can't dump every stored
+// finding; 0 disables it. CSV, Excel, and DefectDojo exports stay complete.
+var QueryMaxRows = 10000
+
+// Response headers of a truncated query, whatever its format
+const (
+	truncatedHeader  = "X-Truncated"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// errInvalidCursor is returned for a cursor that wasn't issued for the
+// query it is given with
+var errInvalidCursor = errors.New("invalid cursor for these filters")
+
+// cursor is the decoded form of a next_cursor: the sort key of the last
+// result of a page, which the next page continues after
+type cursor struct {
+	Key     []any  `json:"k"` // Values of the query's sort terms, see sortKey
+	Filters string `json:"f"` // Fingerprint of the filters it was issued for
+}
+
+// queryFingerprint identifies the filters a cursor was issued for
+func queryFingerprint(f QueryFilters) string {
+	b, _ := json.Marshal(f)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// encodeCursor returns the cursor of the results after a sort key
+func encodeCursor(f QueryFilters, key []any) string {
+	b, _ := json.Marshal(cursor{Key: key, Filters: queryFingerprint(f)})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the sort key a cursor continues after, nil for none
+func decodeCursor(f QueryFilters, s string) ([]any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c cursor
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if d.Decode(&c) != nil || c.Filters != queryFingerprint(f) || len(c.Key) != len(sortTerms(f.Sort)) {
+		return nil, errInvalidCursor
+	}
+	// Keys hold numbers and strings only, bound as query arguments
+	for i, v := range c.Key {
+		switch v := v.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				c.Key[i] = n
+			} else if x, err := v.Float64(); err == nil {
+				c.Key[i] = x
+			} else {
+				return nil, errInvalidCursor
+			}
+		case string:
+		default:
+			return nil, errInvalidCursor
+		}
+	}
+	return c.Key, nil
+}
+
+// validateQueryPage checks the request's limit and cursor, returning the
+// sort key its results continue after
+func validateQueryPage(req QueryRequest) ([]any, error) {
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative, got %d", req.Limit)
+	}
+	return decodeCursor(req.Filters, req.Cursor)
+}
+
+// queryPage returns the results of the request's page, those after the
+// sort key and at most its limit, or maxRows when it sets none, of them
+func queryPage(ctx context.Context, req QueryRequest, after []any, maxRows int) (QueryPage, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = maxRows
+	}
+	vulns, more, err := queryVulnerabilitiesAfter(ctx, req.Filters, after, limit)
+	if err != nil {
+		return QueryPage{}, err
+	}
+	page := QueryPage{Results: vulns, Truncated: more}
+	if more {
+		last := vulns[len(vulns)-1]
+		page.NextCursor = encodeCursor(req.Filters, sortKey(sortTerms(req.Filters.Sort), last))
+	}
+	return page, nil
+}
+
+// setPageHeaders marks a truncated response, so that clients reading an
+// export learn of it too
+func setPageHeaders(w http.ResponseWriter, page QueryPage) {
+	if page.Truncated {
+		w.Header().Set(truncatedHeader, "true")
+		w.Header().Set(nextCursorHeader, page.NextCursor)
+	}
+}
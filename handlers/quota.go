@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/quota"
+)
+
+// QuotaUsage is what a tenant ingested against its quotas
+type QuotaUsage = models.QuotaUsage
+
+// UsageHandler returns the quota usage of the tenant of the request's API
+// key. It answers 404 unless quotas are configured.
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if quota.Default == nil {
+		http.Error(w, "Quotas are not enabled", http.StatusNotFound)
+		return
+	}
+	usage, err := quota.Default.Usage(r.Context(), quota.Default.Tenant(r))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("read quota usage failed", "error", err)
+		http.Error(w, "Failed to read quota usage", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// TenantUsageHandler returns the quota usage of every tenant. It answers
+// 404 unless quotas are configured.
+func TenantUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if quota.Default == nil {
+		http.Error(w, "Quotas are not enabled", http.StatusNotFound)
+		return
+	}
+	usages := []QuotaUsage{}
+	for _, tenant := range quota.Default.Tenants() {
+		usage, err := quota.Default.Usage(r.Context(), tenant)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("read quota usage failed", "tenant", tenant, "error", err)
+			http.Error(w, "Failed to read quota usage", http.StatusInternalServerError)
+			return
+		}
+		usages = append(usages, usage)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usages)
+}
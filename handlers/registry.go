@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ReposHandler lists registered repositories on GET, optionally only those
+// of the `team` query parameter, and registers or updates one on POST
+func ReposHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		repos, err := storage.ListRepositories(r.Context(), storage.DB, r.URL.Query().Get("team"))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("list repositories failed", "error", err)
+			http.Error(w, "List repositories failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(repos)
+
+	case http.MethodPost:
+		var repo models.Repository
+		if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		repo.URL = strings.TrimSuffix(repo.URL, "/")
+		auditTarget(r.Context(), repo.URL)
+		if err := validateRepository(repo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Registered under the URL its scans are stored under
+		repo.URL = canonicalRepo(r.Context(), repo.URL)
+		created, err := storage.UpsertRepository(r.Context(), storage.DB, &repo)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("register repository failed", "repo", repo.URL, "error", err)
+			http.Error(w, "Register repository failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Info("repository registered", "repo", repo.URL, "team", repo.Team, "created", created)
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(repo)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateRepository checks a registration's URL, owner, and defaults
+func validateRepository(repo models.Repository) error {
+	u, err := url.Parse(repo.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if strings.TrimSpace(repo.Team) == "" {
+		return fmt.Errorf("team is required")
+	}
+	if len(repo.Team) > 256 || len(repo.Contact) > 256 {
+		return fmt.Errorf("team and contact must be at most 256 bytes")
+	}
+	if repo.Tier < 0 || repo.Tier > 4 {
+		return fmt.Errorf("tier must be between 1 and 4")
+	}
+	for _, p := range repo.Patterns {
+		if err := github.ValidatePattern(p); err != nil {
+			return err
+		}
+	}
+	return ValidateLabels(repo.Labels)
+}
+
+// repoRegistration returns or deletes the registration of a repository
+// given without its scheme
+func repoRegistration(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	repo, err := storage.FindRepository(r.Context(), storage.DB, path)
+	if err == nil && r.Method == http.MethodDelete {
+		auditTarget(r.Context(), repo.URL)
+		err = storage.DeleteRepository(r.Context(), storage.DB, repo.URL)
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Repository not registered", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("repository registration failed", "repo", path, "error", err)
+		http.Error(w, "Repository registration failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		logging.FromContext(r.Context()).Info("repository unregistered", "repo", repo.URL)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(repo)
+}
+
+// registration returns the registration of a repository, if it has one
+func registration(ctx context.Context, repo string) (models.Repository, bool, error) {
+	reg, err := storage.GetRepository(ctx, storage.DB, canonicalRepo(ctx, repo))
+	if errors.Is(err, errs.ErrNotFound) {
+		return reg, false, nil
+	}
+	return reg, err == nil, err
+}
+
+// applyRepoDefaults fills in a scan request's files from the repository's
+// registered files and patterns when it names none, and adds the
+// registered labels the request doesn't set
+func applyRepoDefaults(ctx context.Context, req *ScanRequest) error {
+	if req.Repo == "" {
+		return nil
+	}
+	reg, ok, err := registration(ctx, req.Repo)
+	if err != nil || !ok {
+		return err
+	}
+	req.Labels = mergeLabels(reg.Labels, req.Labels)
+	if len(req.Files) > 0 || req.Image != "" || (len(reg.Files) == 0 && len(reg.Patterns) == 0) {
+		return nil
+	}
+	req.Files, err = bulkFiles(ctx, BulkScanEntry{Repo: req.Repo, Ref: req.Ref, Files: reg.Files, Patterns: reg.Patterns})
+	return err
+}
+
+// applyBulkDefaults fills in the files and patterns of bulk scan entries
+// naming neither from their repositories' registrations
+func applyBulkDefaults(ctx context.Context, req *BulkScanRequest) error {
+	for i, e := range req.Entries {
+		if e.Repo == "" || len(e.Files) > 0 || len(e.Patterns) > 0 {
+			continue
+		}
+		reg, ok, err := registration(ctx, e.Repo)
+		if err != nil {
+			return err
+		}
+		if ok {
+			req.Entries[i].Files, req.Entries[i].Patterns = reg.Files, reg.Patterns
+		}
+	}
+	return nil
+}
+
+// mergeLabels returns the defaults overridden by labels
+func mergeLabels(defaults, labels map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+	merged := make(map[string]string, len(defaults)+len(labels))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
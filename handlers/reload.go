@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+)
+
+// ReloadResponse defines the response structure for POST /admin/reload
+type ReloadResponse = api.ReloadResponse
+
+// Reloader re-reads the configuration and applies the settings that can
+// change without a restart. The server sets it; while it is nil reloading
+// is unavailable.
+var Reloader func(ctx context.Context) (ReloadResponse, error)
+
+// ReloadHandler re-reads the configuration on POST, answering with the
+// changed settings that were applied and those that need a restart. Scans
+// in progress are not interrupted.
+func ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if Reloader == nil {
+		http.Error(w, "Configuration reload is not available", http.StatusServiceUnavailable)
+		return
+	}
+	res, err := Reloader(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("configuration reload failed", "error", err)
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
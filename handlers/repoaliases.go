@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// RepoAlias maps another URL of a repository to its canonical URL
+type RepoAlias = models.RepoAlias
+
+// canonicalRepo returns the URL a repository's rows are stored under: the
+// canonical form of repo, or the repository it is an alias of. A failed
+// alias lookup is logged and the canonical form used as is.
+func canonicalRepo(ctx context.Context, repo string) string {
+	if repo == "" {
+		return ""
+	}
+	repo = github.CanonicalRepoURL(repo)
+	aliased, ok, err := storage.LookupRepoAlias(ctx, storage.Reader(ctx), repo)
+	if err != nil {
+		logging.FromContext(ctx).Warn("repository alias lookup failed", "repo", repo, "error", err)
+	}
+	if ok {
+		return aliased
+	}
+	return repo
+}
+
+// RepoAliasesHandler lists repository aliases on GET, optionally only those
+// of the `repo` query parameter; adds one on POST, moving the scans and
+// findings stored under the alias to its repository; and removes the one
+// named by the `alias` query parameter on DELETE
+func RepoAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		aliases, err := storage.ListRepoAliases(r.Context(), storage.DB, canonicalRepo(r.Context(), r.URL.Query().Get("repo")))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("list repository aliases failed", "error", err)
+			http.Error(w, "List repository aliases failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(aliases)
+
+	case http.MethodPost:
+		var a RepoAlias
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		a.Alias, a.Repo = github.CanonicalRepoURL(a.Alias), github.CanonicalRepoURL(a.Repo)
+		auditTarget(r.Context(), a.Alias)
+		if err := validateRepoAlias(a); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := storage.AddRepoAlias(r.Context(), storage.DB, &a); err != nil {
+			logging.FromContext(r.Context()).Error("add repository alias failed", "alias", a.Alias, "repo", a.Repo, "error", err)
+			http.Error(w, "Add repository alias failed: "+err.Error(), errs.HTTPStatus(err, http.StatusInternalServerError))
+			return
+		}
+		logging.FromContext(r.Context()).Info("repository alias added", "alias", a.Alias, "repo", a.Repo)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+
+	case http.MethodDelete:
+		alias := github.CanonicalRepoURL(r.URL.Query().Get("alias"))
+		if alias == "" {
+			http.Error(w, "alias is required", http.StatusBadRequest)
+			return
+		}
+		auditTarget(r.Context(), alias)
+		err := storage.DeleteRepoAlias(r.Context(), storage.DB, alias)
+		if errors.Is(err, errs.ErrNotFound) {
+			http.Error(w, "Repository alias not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("delete repository alias failed", "alias", alias, "error", err)
+			http.Error(w, "Delete repository alias failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Info("repository alias deleted", "alias", alias)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateRepoAlias checks that an alias names two different repositories
+func validateRepoAlias(a RepoAlias) error {
+	if a.Alias == "" || a.Repo == "" {
+		return errors.New("alias and repo are required")
+	}
+	if len(a.Alias) > 2048 || len(a.Repo) > 2048 {
+		return errors.New("alias and repo must be at most 2048 bytes")
+	}
+	if a.Alias == a.Repo {
+		return fmt.Errorf("alias %q is already the canonical form of the repository", a.Alias)
+	}
+	return nil
+}
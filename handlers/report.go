@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/report"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ReportHandler renders an HTML report of a repository's latest scans. The
+// repository is the rest of the path, without its https:// scheme, e.g.
+// /reports/github.com/owner/name.
+func ReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rep, err := BuildReport(r.Context(), r.PathValue("repo"), time.Now())
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("report failed", "error", err)
+		http.Error(w, "Report failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := report.Render(w, rep); err != nil {
+		logging.FromContext(r.Context()).Error("report render failed", "error", err)
+	}
+}
+
+// BuildReport gathers the report data for a repository. repo may omit the
+// https:// scheme of the stored repository URL.
+func BuildReport(ctx context.Context, repo string, now time.Time) (*report.Report, error) {
+	repo, err := resolveRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report.Report{
+		Repo:        repo,
+		GeneratedAt: now.UTC(),
+		BySeverity:  map[string]int{},
+		ByTriage:    map[string]int{},
+	}
+	if reg, ok, err := registration(ctx, repo); err != nil {
+		return nil, err
+	} else if ok {
+		rep.Owner = &reg
+	}
+
+	// Findings of the latest scan of each file
+	err = storage.Reader(ctx).SelectContext(ctx, &rep.Findings, `SELECT
+		v.id AS finding_id, v.cve_id, v.severity, v.cvss, v.status, v.package_name, v.current_version,
+		v.fixed_version, v.description, v.published_date, v.link, v.risk_factors,
+		v.ecosystem, v.purl, v.location, v.fingerprint, v.triage_status, v.assignee,
+		e.epss, e.percentile AS epss_percentile, `+kevColumn+`
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		LEFT JOIN epss_scores e ON e.cve_id = v.cve_id
+		WHERE s.repo = ? AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)`, repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rep.Findings {
+		rep.BySeverity[reportSeverity(v.Severity)]++
+		rep.ByTriage[v.TriageStatus]++
+		if v.KEV {
+			rep.KEV++
+		}
+		if v.FixedVersion != "" {
+			rep.Fixable++
+		}
+	}
+	sort.SliceStable(rep.Findings, func(i, j int) bool {
+		a, b := rep.Findings[i], rep.Findings[j]
+		ra, rb := severityRank[strings.ToUpper(a.Severity)], severityRank[strings.ToUpper(b.Severity)]
+		if ra != rb {
+			return ra > rb
+		}
+		if a.CVSS != b.CVSS {
+			return a.CVSS > b.CVSS
+		}
+		return a.CVEID < b.CVEID
+	})
+
+	var last struct {
+		Files    int    `db:"files"`
+		ScanTime string `db:"scan_time"`
+	}
+	err = storage.Reader(ctx).GetContext(ctx, &last,
+		"SELECT COUNT(DISTINCT COALESCE(file_path, '')) AS files, MAX(scan_time) AS scan_time FROM scans WHERE repo = ?", repo)
+	if err != nil {
+		return nil, err
+	}
+	rep.Files = last.Files
+	if rep.LastScan, err = parseTimestamp(last.ScanTime); err != nil {
+		return nil, err
+	}
+
+	rep.Trend, err = QueryTrend(ctx, repo, defaultTrendDays, now)
+	return rep, err
+}
+
+// resolveRepo returns the stored repository URL that a path segment names,
+// with or without its scheme or in any form aliased to it, or
+// errs.ErrNotFound if it was never scanned
+func resolveRepo(ctx context.Context, repo string) (string, error) {
+	repo = strings.TrimSuffix(repo, "/")
+	query, args, err := sqlx.In("SELECT repo FROM scans WHERE repo IN (?) ORDER BY id DESC LIMIT 1",
+		[]string{canonicalRepo(ctx, repo), repo, "https://" + repo, "http://" + repo})
+	if err != nil {
+		return "", err
+	}
+	if err := storage.Reader(ctx).GetContext(ctx, &repo, query, args...); errors.Is(err, sql.ErrNoRows) {
+		return "", errs.ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return repo, nil
+}
+
+// reportSeverity maps a stored severity onto report.Severities
+func reportSeverity(severity string) string {
+	sev := strings.ToUpper(severity)
+	if _, ok := severityRank[sev]; !ok {
+		return "UNKNOWN"
+	}
+	return sev
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/risk"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// RepoScore is the composite risk score of a repository's open findings
+type RepoScore = api.RepoScore
+
+// RepoHandler serves per-repository resources under /repos/. The repository
+// is the path up to the resource name, without its https:// scheme, e.g.
+// /repos/github.com/owner/name/score or
+// /repos/github.com/owner/name/files/reports/trivy.json/history; without a
+// resource name, the path is the repository's registration.
+func RepoHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	repo, file, isFile := strings.Cut(strings.TrimSuffix(path, "/history"), "/files/")
+	switch {
+	case strings.HasSuffix(path, "/history") && isFile && repo != "" && file != "":
+		fileHistory(w, r, repo, file)
+	case strings.HasSuffix(path, "/score"):
+		repoScore(w, r, strings.TrimSuffix(path, "/score"))
+	case path != "":
+		repoRegistration(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// repoScore returns the risk score of one repository
+func repoScore(w http.ResponseWriter, r *http.Request, repo string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	repo, err := resolveRepo(r.Context(), repo)
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	var scores []RepoScore
+	if err == nil {
+		scores, err = QueryRepoScores(r.Context(), repo, time.Now())
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("risk score failed", "error", err)
+		http.Error(w, "Risk score failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scores[0])
+}
+
+// RepoScoresHandler ranks every scanned repository by risk score, highest
+// first, optionally only those the `team` query parameter owns
+func RepoScoresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scores, err := QueryRepoScores(r.Context(), "", time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("risk scores failed", "error", err)
+		http.Error(w, "Risk scores failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if team := r.URL.Query().Get("team"); team != "" {
+		owned := scores[:0]
+		for _, s := range scores {
+			if s.Team == team {
+				owned = append(owned, s)
+			}
+		}
+		scores = owned
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scores)
+}
+
+// repoOwner is a scanned repository and its registered owner, if any
+type repoOwner struct {
+	Repo string `db:"repo"`
+	Team string `db:"team"`
+	Tier int    `db:"tier"`
+}
+
+// QueryRepoScores scores the open findings of the latest scans per
+// risk.Default, for one repository or all, highest score first. Scanned
+// repositories without open findings score 0.
+func QueryRepoScores(ctx context.Context, repo string, now time.Time) ([]RepoScore, error) {
+	query := `SELECT DISTINCT s.repo, COALESCE(r.team, '') AS team, COALESCE(r.tier, 0) AS tier
+		FROM scans s LEFT JOIN repositories r ON r.url = s.repo WHERE s.repo IS NOT NULL`
+	var args []interface{}
+	if repo != "" {
+		query += " AND s.repo = ?"
+		args = append(args, repo)
+	}
+	var repos []repoOwner
+	if err := storage.Reader(ctx).SelectContext(ctx, &repos, query, args...); err != nil {
+		return nil, err
+	}
+	if repo != "" && len(repos) == 0 {
+		repos = []repoOwner{{Repo: repo}}
+	}
+
+	byRepo := make(map[string]*RepoScore, len(repos))
+	for _, r := range repos {
+		byRepo[r.Repo] = &RepoScore{Repo: r.Repo, Team: r.Team, Tier: r.Tier, BySeverity: map[string]int{}}
+	}
+
+	findings, err := openFindings(ctx, repo, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		s, ok := byRepo[f.Repo]
+		if !ok {
+			continue
+		}
+		rf := risk.Finding{Severity: f.Severity, KEV: f.KEV, FirstSeen: f.FirstSeen}
+		if f.EPSS != nil {
+			rf.EPSS = *f.EPSS
+		}
+		s.Points += risk.Default.Points(rf, now)
+		s.Findings++
+		s.BySeverity[strings.ToUpper(f.Severity)]++
+		if f.KEV {
+			s.KEV++
+		}
+		s.MaxEPSS = math.Max(s.MaxEPSS, rf.EPSS)
+		s.OldestDays = max(s.OldestDays, int(now.Sub(f.FirstSeen).Hours()/24))
+	}
+
+	scores := make([]RepoScore, 0, len(byRepo))
+	for _, s := range byRepo {
+		s.Score = risk.Default.Score(s.Points)
+		s.Points = math.Round(s.Points*100) / 100
+		scores = append(scores, *s)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Points != scores[j].Points {
+			return scores[i].Points > scores[j].Points
+		}
+		return scores[i].Repo < scores[j].Repo
+	})
+	return scores, nil
+}
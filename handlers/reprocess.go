@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ReprocessRequest defines the request structure for POST /admin/reprocess
+type ReprocessRequest = api.ReprocessRequest
+
+// ReprocessResponse defines the response structure for POST /admin/reprocess
+type ReprocessResponse = api.ReprocessResponse
+
+// ReprocessResult is the outcome of reprocessing one ingested file
+type ReprocessResult = api.ReprocessResult
+
+// Reprocess outcomes
+const (
+	ReprocessDone    = "reprocessed"
+	ReprocessSkipped = "skipped"
+	ReprocessFailed  = "failed"
+)
+
+// RawFileEncoding is how the original content of ingested files is kept
+// for reprocessing: storage.RawGzip, storage.RawIdentity, or empty to not
+// keep it
+var RawFileEncoding = storage.RawGzip
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// ReprocessHandler parses previously ingested files again from their stored
+// content and updates the stored scans in place, e.g. after a parser fix
+func ReprocessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Repo = canonicalRepo(r.Context(), req.Repo)
+	if req.Repo == "" && len(req.ScanIDs) == 0 && req.Since == nil && !req.All {
+		http.Error(w, "repo, scan_ids, since, or all is required", http.StatusBadRequest)
+		return
+	}
+	auditTarget(r.Context(), req.Repo)
+
+	resp, err := Reprocess(r.Context(), req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("reprocess failed", "error", err)
+		http.Error(w, "Reprocess failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("reprocess completed", "dry_run", req.DryRun, "reprocessed", resp.Reprocessed,
+		"skipped", resp.Skipped, "failed", resp.Failed, "added", resp.Added, "updated", resp.Updated, "removed", resp.Removed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ingest is the set of scans stored from one ingested file
+type ingest struct {
+	Repo     string
+	FilePath string
+	ScanTime time.Time
+	SHA256   string
+	ScanIDs  []int64
+}
+
+// Reprocess parses the selected ingests again and stores the results over
+// the original scans. Vulnerabilities still reported keep their IDs and
+// triage state; ones no longer reported are removed. No ingest events or
+// notifications are published.
+func Reprocess(ctx context.Context, req ReprocessRequest) (ReprocessResponse, error) {
+	resp := ReprocessResponse{DryRun: req.DryRun, Results: []ReprocessResult{}}
+	ingests, err := selectIngests(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	for _, in := range ingests {
+		res := ReprocessResult{Repo: in.Repo, File: in.FilePath, ScanTime: in.ScanTime, ScanIDs: in.ScanIDs, Status: ReprocessDone}
+		err := reprocessIngest(ctx, in, req.DryRun, &res)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			res.Status, res.Reason = ReprocessSkipped, "original content not stored"
+			resp.Skipped++
+		case err != nil:
+			res.Status, res.Reason = ReprocessFailed, err.Error()
+			resp.Failed++
+			logging.FromContext(ctx).Warn("reprocess ingest failed", "repo", in.Repo, "file", in.FilePath, "error", err)
+		default:
+			resp.Reprocessed++
+			resp.Added += res.Added
+			resp.Updated += res.Updated
+			resp.Removed += res.Removed
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return resp, nil
+}
+
+// selectIngests returns the ingests with a scan matching the request, each
+// with all of its scans, oldest first
+func selectIngests(ctx context.Context, req ReprocessRequest) ([]ingest, error) {
+	where, args := "1 = 1", []interface{}{}
+	if req.Repo != "" {
+		where += " AND m.repo = ?"
+		args = append(args, req.Repo)
+	}
+	if req.Since != nil {
+		where += " AND m.scan_time >= ?"
+		args = append(args, req.Since.UTC())
+	}
+	if len(req.ScanIDs) > 0 {
+		where += " AND m.id IN (?)"
+		args = append(args, req.ScanIDs)
+	}
+	query, args, err := sqlx.In(`SELECT s.id, COALESCE(s.repo, '') AS repo, COALESCE(s.file_path, '') AS file_path,
+		s.scan_time, s.sha256 FROM scans s
+		WHERE EXISTS (SELECT 1 FROM scans m WHERE m.repo IS s.repo AND m.file_path IS s.file_path
+			AND m.scan_time = s.scan_time AND `+where+`)
+		ORDER BY s.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID       int64     `db:"id"`
+		Repo     string    `db:"repo"`
+		FilePath string    `db:"file_path"`
+		ScanTime time.Time `db:"scan_time"`
+		SHA256   string    `db:"sha256"`
+	}
+	if err := storage.DB.SelectContext(ctx, &rows, storage.DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	// The scans of one ingest share the repository, file, and time
+	var ingests []ingest
+	index := map[string]int{}
+	for _, row := range rows {
+		key := row.Repo + "\x00" + row.FilePath + "\x00" + row.ScanTime.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(ingests)
+			index[key] = i
+			ingests = append(ingests, ingest{Repo: row.Repo, FilePath: row.FilePath, ScanTime: row.ScanTime, SHA256: row.SHA256})
+		}
+		ingests[i].ScanIDs = append(ingests[i].ScanIDs, row.ID)
+	}
+	return ingests, nil
+}
+
+// reprocessIngest parses the stored content of one ingest and stores the
+// results over its scans, counting the changes in res. A dry run rolls the
+// changes back.
+func reprocessIngest(ctx context.Context, in ingest, dryRun bool, res *ReprocessResult) error {
+	if in.SHA256 == "" {
+		return errs.ErrNotFound
+	}
+	content, err := storage.GetRawFile(ctx, storage.DB, in.SHA256)
+	if err != nil {
+		return err
+	}
+	parsed := &pipeline.Ingest{Repo: in.Repo, File: in.FilePath, Lenient: isLenient(""), Content: content}
+	err = IngestPipeline.Run(ctx, parsed, pipeline.Decode, pipeline.Normalize, pipeline.Enrich)
+	res.Format = parsed.Format
+	if err != nil {
+		return err
+	}
+	scanResults := parsed.Results
+	if len(scanResults) != len(in.ScanIDs) {
+		return fmt.Errorf("file now yields %d scan(s) instead of %d", len(scanResults), len(in.ScanIDs))
+	}
+
+	err = executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		for i, sr := range scanResults {
+			if err := replaceScanResult(ctx, tx, in.ScanIDs[i], sr, res); err != nil {
+				return err
+			}
+		}
+		if _, err := storage.ResolveFindings(ctx, tx, in.Repo, time.Now().UTC()); err != nil {
+			return fmt.Errorf("resolve findings failed: %v", err)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// replaceScanResult stores a parsed scan result over a stored scan,
+// updating vulnerabilities matched by ID, package, and version in place
+func replaceScanResult(ctx context.Context, tx *sqlx.Tx, scanID int64, sr models.ScanResult, res *ReprocessResult) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE scans SET scan_id = ?, timestamp = ?, source = ?, resource_type = ?, resource_name = ?,
+		scan_status = ?, incomplete = ? WHERE id = ?`,
+		sr.ScanID, storage.FormatTime(sr.Timestamp), res.Format, sr.ResourceType, sr.ResourceName,
+		sr.ScanStatus, isIncomplete(sr.ScanStatus), scanID); err != nil {
+		return fmt.Errorf("update scan failed: %v", err)
+	}
+
+	// Components and dependency edges carry no state of their own
+	for _, query := range []string{"DELETE FROM components WHERE scan_id = ?", "DELETE FROM component_dependencies WHERE scan_id = ?"} {
+		if _, err := tx.ExecContext(ctx, query, scanID); err != nil {
+			return fmt.Errorf("delete components failed: %v", err)
+		}
+	}
+	for _, c := range sr.Components {
+		if err := storage.InsertComponent(ctx, tx, scanID, c); err != nil {
+			return fmt.Errorf("insert component failed: %v", err)
+		}
+	}
+	for _, d := range sr.Dependencies {
+		if err := storage.InsertDependency(ctx, tx, scanID, d); err != nil {
+			return fmt.Errorf("insert dependency failed: %v", err)
+		}
+	}
+
+	var stored []struct {
+		ID             int64  `db:"id"`
+		CVEID          string `db:"cve_id"`
+		PackageName    string `db:"package_name"`
+		CurrentVersion string `db:"current_version"`
+	}
+	err := tx.SelectContext(ctx, &stored, `SELECT id, COALESCE(cve_id, '') AS cve_id, COALESCE(package_name, '') AS package_name,
+		COALESCE(current_version, '') AS current_version FROM vulnerabilities WHERE scan_id = ? ORDER BY id`, scanID)
+	if err != nil {
+		return fmt.Errorf("read vulnerabilities failed: %v", err)
+	}
+	existing := map[string][]int64{}
+	for _, v := range stored {
+		key := v.CVEID + "\x00" + v.PackageName + "\x00" + v.CurrentVersion
+		existing[key] = append(existing[key], v.ID)
+	}
+
+	for _, vuln := range sr.Vulnerabilities {
+		key := vuln.CVEID + "\x00" + vuln.PackageName + "\x00" + vuln.CurrentVersion
+		if ids := existing[key]; len(ids) > 0 {
+			existing[key] = ids[1:]
+			if err := storage.UpdateVulnerability(ctx, tx, ids[0], scanID, vuln); err != nil {
+				return fmt.Errorf("update vulnerability failed: %v", err)
+			}
+			res.Updated++
+			continue
+		}
+		if err := storage.InsertVulnerability(ctx, tx, scanID, vuln); err != nil {
+			return fmt.Errorf("insert vulnerability failed: %v", err)
+		}
+		res.Added++
+	}
+	for _, ids := range existing {
+		for _, id := range ids {
+			if err := storage.DeleteVulnerability(ctx, tx, id); err != nil {
+				return fmt.Errorf("delete vulnerability failed: %v", err)
+			}
+			res.Removed++
+		}
+	}
+	return nil
+}
@@ -1,168 +1,771 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/image"
+	"github.com/Chinzzii/vulnscan/license"
+	"github.com/Chinzzii/vulnscan/logging"
 	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/osv"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/quota"
 	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/telemetry"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ScanRequest defines the expected request structure for /scan endpoint
-type ScanRequest struct {
-	Repo  string   `json:"repo"`  // GitHub repository URL
-	Files []string `json:"files"` // List of JSON files to process
-}
+type ScanRequest = api.ScanRequest
 
 // FileError tracks processing failures for individual files
-type FileError struct {
-	File  string `json:"file"`  // Failed file path
-	Error string `json:"error"` // Error description
-}
+type FileError = api.FileError
+
+// FileSkip records a file that was not ingested, and why
+type FileSkip = api.FileSkip
+
+// FileWarning records a vulnerability entry skipped by lenient parsing
+type FileWarning = api.FileWarning
 
 // ScanResponse defines the response structure for /scan endpoint
-type ScanResponse struct {
-	Success []string    `json:"success"` // List of successfully processed files
-	Failed  []FileError `json:"failed"`  // List of files that failed processing
+type ScanResponse = api.ScanResponse
+
+// Parse modes of ScanRequest.ParseMode
+const (
+	ParseStrict  = "strict"  // A malformed vulnerability entry fails its file
+	ParseLenient = "lenient" // Malformed vulnerability entries are skipped with a warning
+)
+
+// DefaultParseMode applies to scans that don't choose a parse mode, and to
+// archive ingests and reprocessing
+var DefaultParseMode = ParseStrict
+
+// ValidateParseMode checks that mode is empty or a known parse mode
+func ValidateParseMode(mode string) error {
+	switch mode {
+	case "", ParseStrict, ParseLenient:
+		return nil
+	}
+	return fmt.Errorf("unknown parse mode %q (want %s or %s)", mode, ParseStrict, ParseLenient)
+}
+
+// isLenient reports whether mode, or the default when it is empty, skips
+// malformed entries
+func isLenient(mode string) bool {
+	if mode == "" {
+		mode = DefaultParseMode
+	}
+	return mode == ParseLenient
+}
+
+var (
+	// ScanTimeout bounds a whole scan that doesn't set its own timeout; 0
+	// disables it
+	ScanTimeout = 10 * time.Minute
+	// FileTimeout bounds fetching and ingesting one file of a scan that
+	// doesn't set its own file timeout; 0 disables it. Image scans are
+	// bounded by the image scanner's timeout instead.
+	FileTimeout = 2 * time.Minute
+)
+
+// concurrency holds the scan concurrency limits, which a configuration
+// reload can change while scans run
+var concurrency = struct {
+	sync.RWMutex
+	files, persist, repos int
+}{files: 3, persist: 2, repos: bulkRepoSlots}
+
+// SetConcurrency sets the files of a scan fetched at a time and the
+// repositories of a bulk scan scanned at a time by default. Scans already
+// running keep the limits they started with.
+func SetConcurrency(files, repos int) error {
+	if files < 1 {
+		return fmt.Errorf("file concurrency must be at least 1, got %d", files)
+	}
+	if repos < 1 || repos > maxBulkSlots {
+		return fmt.Errorf("repository concurrency must be between 1 and %d, got %d", maxBulkSlots, repos)
+	}
+	concurrency.Lock()
+	defer concurrency.Unlock()
+	concurrency.files, concurrency.repos = files, repos
+	return nil
+}
+
+// SetPersistConcurrency sets the fetched files of a scan decoded, enriched,
+// and stored at a time. Scans already running keep the limit they started
+// with.
+func SetPersistConcurrency(files int) error {
+	if files < 1 {
+		return fmt.Errorf("persist concurrency must be at least 1, got %d", files)
+	}
+	concurrency.Lock()
+	defer concurrency.Unlock()
+	concurrency.persist = files
+	return nil
+}
+
+// scanConcurrency returns the current scan concurrency limits
+func scanConcurrency() (files, repos int) {
+	concurrency.RLock()
+	defer concurrency.RUnlock()
+	return concurrency.files, concurrency.repos
+}
+
+// persistConcurrency returns the current limit of files of a scan stored at
+// a time
+func persistConcurrency() int {
+	concurrency.RLock()
+	defer concurrency.RUnlock()
+	return concurrency.persist
 }
 
-// ScanHandler handles incoming scan requests
-func ScanHandler(w http.ResponseWriter, r *http.Request) {
+// ValidateTimeouts checks that the request's timeouts are empty or positive
+// durations
+func ValidateTimeouts(req ScanRequest) error {
+	for _, t := range []struct{ name, value string }{{"timeout", req.Timeout}, {"file_timeout", req.FileTimeout}} {
+		if t.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(t.value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q (want a positive duration, e.g. 30s)", t.name, t.value)
+		}
+	}
+	return nil
+}
+
+// scanTimeouts returns the request's scan and file timeouts, or the
+// defaults where it sets none
+func scanTimeouts(req ScanRequest) (scan, file time.Duration) {
+	scan, file = ScanTimeout, FileTimeout
+	if d, err := time.ParseDuration(req.Timeout); err == nil {
+		scan = d
+	}
+	if d, err := time.ParseDuration(req.FileTimeout); err == nil {
+		file = d
+	}
+	return scan, file
+}
+
+// fallbackRef is the branch files are fetched from when a repository's
+// default branch can't be looked up
+const fallbackRef = "main"
+
+// BranchResolver looks up the default branch of a repository. Fetchers
+// that implement it are asked for the branch of scans naming no ref.
+type BranchResolver interface {
+	DefaultBranch(ctx context.Context, repo string) (string, error)
+}
+
+// resolveRef returns ref, or when it is empty the repository's default
+// branch, falling back to main when resolver is nil or the lookup fails
+func resolveRef(ctx context.Context, resolver BranchResolver, repo, ref string) string {
+	if ref != "" {
+		return ref
+	}
+	if resolver != nil {
+		branch, err := resolver.DefaultBranch(ctx, repo)
+		if err == nil {
+			return branch
+		}
+		logging.FromContext(ctx).Warn("default branch lookup failed, using "+fallbackRef, "repo", repo, "error", err)
+	}
+	return fallbackRef
+}
+
+// ContentFetcher retrieves repository files. When cached validators are
+// given, an unchanged file returns github.ErrNotModified.
+type ContentFetcher interface {
+	FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error)
+}
+
+// ScanHook is called once a scan run is done, with the request as run,
+// its ref resolved, and the run's outcome
+type ScanHook func(ctx context.Context, req ScanRequest, resp ScanResponse)
+
+// Scanner fetches and ingests repository scan reports
+type Scanner struct {
+	fetcher ContentFetcher
+	hooks   []ScanHook
+}
+
+// NewScanner creates a scanner that retrieves files with fetcher
+func NewScanner(fetcher ContentFetcher) *Scanner {
+	return &Scanner{fetcher: fetcher}
+}
+
+// AddHook adds a hook called after each scan run, in the order added. Hooks
+// must be added before the scanner runs scans.
+func (s *Scanner) AddHook(h ScanHook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// ServeHTTP handles incoming scan requests
+func (s *Scanner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Decode and validate request body
 	var req ScanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	req.Repo = canonicalRepo(r.Context(), req.Repo)
+	auditTarget(r.Context(), req.Repo)
+	if req.Repo != "" && !checkRepoAccess(w, req.Repo) {
+		return
+	}
+	if req.Image != "" {
+		auditTarget(r.Context(), req.Image)
+	}
+	if err := ValidateScanRequest(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyPathPrefix(&req)
+
+	// Scan the files a registered repository defaults to when none are named
+	if err := applyRepoDefaults(r.Context(), &req); err != nil {
+		logging.FromContext(r.Context()).Error("apply repository defaults failed", "repo", req.Repo, "error", err)
+		http.Error(w, "Apply repository defaults failed: "+err.Error(), errs.HTTPStatus(err, http.StatusBadGateway))
+		return
+	}
+	// Excluded files are skipped without counting against the quota
+	kept, _ := excludeFiles(req.Files, req.Exclude)
+	files := len(kept)
+	if req.Image != "" {
+		files++
+	}
+	if !checkQuota(w, r, files) {
+		return
+	}
+
+	writeScanResponse(w, s.Run(r.Context(), req))
+}
+
+// Scan validates a request and runs it as POST /scan does, scanning the
+// files a registered repository defaults to when the request names none.
+// Repository access rules are left to the caller.
+func (s *Scanner) Scan(ctx context.Context, req ScanRequest) (ScanResponse, error) {
+	req.Repo = canonicalRepo(ctx, req.Repo)
+	if err := ValidateScanRequest(req); err != nil {
+		return ScanResponse{}, err
+	}
+	applyPathPrefix(&req)
+	if err := applyRepoDefaults(ctx, &req); err != nil {
+		return ScanResponse{}, fmt.Errorf("apply repository defaults: %w", err)
+	}
+	return s.Run(ctx, req), nil
+}
+
+// Run fetches and ingests every file in the request, under its path prefix,
+// from its ref or the repository's default branch, and the container image
+// if one is given, processing a few at a time within the request's
+// timeouts, and reports per-file outcomes, which the scanner's hooks are
+// called with first. Findings are stored under the repository's canonical
+// URL.
+func (s *Scanner) Run(ctx context.Context, req ScanRequest) ScanResponse {
+	req.Repo = canonicalRepo(ctx, req.Repo)
+	applyPathPrefix(&req)
+	var excluded []FileSkip
+	req.Files, excluded = excludeFiles(req.Files, req.Exclude)
+	scanTimeout, fileTimeout := scanTimeouts(req)
+	if len(req.Files) > 0 {
+		resolver, _ := s.fetcher.(BranchResolver)
+		req.Ref = resolveRef(ctx, resolver, req.Repo, req.Ref)
+	}
+	var tasks []scanTask
+	for _, file := range req.Files {
+		tasks = append(tasks, scanTask{repo: req.Repo, name: file, timeout: fileTimeout, fetch: func(ctx context.Context, repo, name string) (ingestFunc, error) {
+			return s.fetchFile(ctx, req, name)
+		}})
+	}
+	if req.Image != "" {
+		// Image findings belong to the given repository, or to the image itself
+		imageRepo := req.Repo
+		if imageRepo == "" {
+			imageRepo = req.Image
+		}
+		tasks = append(tasks, scanTask{repo: imageRepo, name: req.Image, fetch: func(ctx context.Context, repo, ref string) (ingestFunc, error) {
+			return fetchImage(ctx, repo, ref, req.Labels, isLenient(req.ParseMode))
+		}})
+	}
+	resp := runTasks(ctx, req.Repo, tasks, scanTimeout)
+	if len(excluded) > 0 {
+		resp.Skipped = append(excluded, resp.Skipped...)
+		resp.Status = scanOutcome(resp)
+	}
+	for _, h := range s.hooks {
+		h(ctx, req, resp)
+	}
+	return resp
+}
 
-	// Concurrency control structures
+// excludeFiles splits the files into those to scan and those matching one
+// of the exclude patterns, which are skipped
+func excludeFiles(files, patterns []string) ([]string, []FileSkip) {
+	if len(patterns) == 0 {
+		return files, nil
+	}
 	var (
-		wg      sync.WaitGroup           // Tracks active goroutines
-		mu      sync.Mutex               // Protects shared data structures
-		success []string                 // Track successful files
-		failed  []FileError              // Track failed files
-		sem     = make(chan struct{}, 3) // Semaphore for limiting concurrency
+		kept     []string
+		excluded []FileSkip
 	)
+	for _, f := range files {
+		if p := github.ExcludedBy(f, patterns); p != "" {
+			excluded = append(excluded, FileSkip{File: f, Reason: fmt.Sprintf("excluded by pattern %q, skipped", p)})
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, excluded
+}
 
-	// Process each file concurrently
-	for _, file := range req.Files {
-		wg.Add(1)
-		go func(f string) {
-			defer wg.Done()
-			sem <- struct{}{}        // Acquire semaphore slot
-			defer func() { <-sem }() // Release semaphore slot
-
-			// Process file and update success/failed lists
-			if err := processFile(req.Repo, f); err != nil {
-				mu.Lock()
-				failed = append(failed, FileError{File: f, Error: err.Error()})
-				mu.Unlock()
-			} else {
-				mu.Lock()
-				success = append(success, f)
-				mu.Unlock()
+// scanTask is one file or image of a scan
+type scanTask struct {
+	repo    string        // Repository the findings belong to
+	name    string        // File path or image reference
+	timeout time.Duration // Bound on fetching and ingesting it; 0 for none
+	// Fetches it, returning the rest of its ingest
+	fetch func(ctx context.Context, repo, name string) (ingestFunc, error)
+}
+
+// ingestFunc decodes, enriches, and stores a fetched file or image in the
+// context it was fetched in, returning the entries lenient parsing skipped
+type ingestFunc func() ([]formats.Warning, error)
+
+// fetchedTask is a task whose fetch has finished, waiting for a persist
+// worker
+type fetchedTask struct {
+	scanTask
+	ingest ingestFunc
+	ctx    context.Context    // Context of the task, bounded by its timeout
+	cancel context.CancelFunc // Releases ctx once the task is done
+}
+
+// runTasks processes the tasks in two stages and reports per-file outcomes,
+// with any entries skipped by lenient parsing. A pool of fetch workers
+// downloads files and hands them to persist workers, which decode, enrich,
+// and store them, so network latency overlaps with database work. Once
+// timeout has passed, unless it is 0, outstanding tasks are cancelled and
+// tasks not yet started fail without running.
+func runTasks(ctx context.Context, repo string, tasks []scanTask, timeout time.Duration) ScanResponse {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	fetchSlots, _ := scanConcurrency()
+	persistSlots := persistConcurrency()
+	var (
+		mu      sync.Mutex    // Protects the outcome lists
+		success []string      // Track successful files
+		failed  []FileError   // Track failed files
+		skipped []FileSkip    // Track unchanged files
+		warned  []FileWarning // Track skipped malformed entries
+	)
+
+	// record updates the success/failed/skipped lists with a task's outcome
+	record := func(t scanTask, warnings []formats.Warning, err error) {
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = failStep(FailureTimeout, "scan timed out after %s: %v", timeout, err)
+		}
+		switch {
+		case errors.Is(err, github.ErrNotModified):
+			publishFileOutcome(t.repo, nil)
+			mu.Lock()
+			skipped = append(skipped, FileSkip{File: t.name, Reason: "not modified, skipped"})
+			mu.Unlock()
+		case err != nil:
+			logging.FromContext(ctx).Warn("file ingest failed",
+				"repo", t.repo, "file", t.name, "error", err)
+			mu.Lock()
+			fe := FileError{File: t.name, Error: err.Error(), Category: failureCategory(err), RetryAfterSeconds: retryAfterSeconds(err)}
+			failed = append(failed, fe)
+			mu.Unlock()
+			events.Default.Publish(events.Event{Type: events.TypeScanFailed, Repo: t.repo, Data: fe})
+			publishFileOutcome(t.repo, &fe)
+		default:
+			publishFileOutcome(t.repo, nil)
+			mu.Lock()
+			success = append(success, t.name)
+			for _, w := range warnings {
+				warned = append(warned, FileWarning{File: t.name, Index: w.Index, Reason: w.Reason})
 			}
-		}(file)
+			mu.Unlock()
+		}
 	}
 
-	wg.Wait() // Wait for all goroutines to finish
+	// Fetched files wait in a queue as long as the fetch pool, so fetch
+	// workers get ahead of persist workers by at most that many files
+	var (
+		queue    = make(chan scanTask)
+		fetched  = make(chan fetchedTask, fetchSlots)
+		fetchers sync.WaitGroup
+		persists sync.WaitGroup
+	)
+	for range min(fetchSlots, len(tasks)) {
+		fetchers.Add(1)
+		go func() {
+			defer fetchers.Done()
+			for t := range queue {
+				if err := ctx.Err(); err != nil {
+					record(t, nil, err)
+					continue
+				}
+				// Count the file against the tenant's quota before fetching
+				// it, and take it back when the fetch brings nothing to
+				// ingest, e.g. as the file is not modified
+				release, err := quota.Default.Reserve(ctx, quota.TenantFromContext(ctx))
+				if err != nil {
+					record(t, nil, err)
+					continue
+				}
+				f, err := t.start(ctx)
+				if err != nil {
+					if err := release(context.WithoutCancel(ctx)); err != nil {
+						logging.FromContext(ctx).Warn("quota release failed", "file", t.name, "error", err)
+					}
+					record(t, nil, err)
+					continue
+				}
+				fetched <- f
+			}
+		}()
+	}
+	for range min(persistSlots, len(tasks)) {
+		persists.Add(1)
+		go func() {
+			defer persists.Done()
+			for f := range fetched {
+				warnings, err := f.ingest()
+				record(f.scanTask, warnings, f.finish(ctx, err))
+			}
+		}()
+	}
 
-	// Return response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ScanResponse{Success: success, Failed: failed})
+	for _, t := range tasks {
+		queue <- t
+	}
+	close(queue)
+	fetchers.Wait()
+	close(fetched)
+	persists.Wait()
+
+	logging.FromContext(ctx).Info("scan completed",
+		"repo", repo, "succeeded", len(success), "failed", len(failed), "skipped", len(skipped), "warnings", len(warned))
+
+	resp := ScanResponse{Success: success, Failed: failed, Skipped: skipped, Warnings: warned}
+	resp.Status = scanOutcome(resp)
+	return resp
+}
+
+// start fetches the task within its timeout, which goes on to bound the
+// rest of its ingest. A task whose fetch fails is done.
+func (t scanTask) start(ctx context.Context) (fetchedTask, error) {
+	f := fetchedTask{scanTask: t, ctx: ctx, cancel: func() {}}
+	if t.timeout > 0 {
+		f.ctx, f.cancel = context.WithTimeout(ctx, t.timeout)
+	}
+	ingest, err := t.fetch(f.ctx, t.repo, t.name)
+	if err != nil {
+		return fetchedTask{}, f.finish(ctx, err)
+	}
+	f.ingest = ingest
+	return f, nil
 }
 
-// processFile handles individual file processing pipeline with retries
-func processFile(repo, filePath string) error {
-	const maxRetries = 2
-	var lastErr error
+// finish releases the task's context and returns err, reporting the task's
+// timeout as such rather than as a failure of the step it interrupted
+func (f fetchedTask) finish(ctx context.Context, err error) error {
+	defer f.cancel()
+	if err != nil && ctx.Err() == nil && errors.Is(f.ctx.Err(), context.DeadlineExceeded) {
+		return failStep(FailureTimeout, "timed out after %s: %v", f.timeout, err)
+	}
+	return err
+}
 
-	// Retry loop with maxRetries attempts
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+// ingestStages are the stages of an ingest run by persist workers, after
+// its fetch
+var ingestStages = []string{pipeline.Decode, pipeline.Normalize, pipeline.Enrich, pipeline.Persist}
+
+// fetchIngest runs the fetch stage of the ingest within span, under a hold
+// on IngestBudget that fetchers take room in before they download, then
+// fits the hold to the content fetched, waiting for room for content that
+// wasn't downloaded under it. It returns the rest of the ingest, which
+// releases the hold. Content larger than the whole budget fails the fetch.
+// The span ends with the ingest, or with its fetch when that fails.
+func fetchIngest(ctx context.Context, span trace.Span, in *pipeline.Ingest) (ingestFunc, error) {
+	hold := IngestBudget.Hold()
+	err := IngestPipeline.Run(pipeline.WithHold(ctx, hold), in, pipeline.Fetch)
+	if err == nil {
+		if err = hold.Fit(ctx, int64(len(in.Content))); errors.Is(err, pipeline.ErrTooLarge) {
+			err = failStep(FailureFetch, "fetch failed: %w", err)
+		} else if err != nil {
+			err = fmt.Errorf("waiting for ingest memory: %w", err)
 		}
-		
-		err := processFileWithRetry(repo, filePath)
-		if err == nil {
-			return nil
+	}
+	if err != nil {
+		hold.Release()
+		telemetry.EndSpan(span, err)
+		return nil, err
+	}
+	return func() (warnings []formats.Warning, err error) {
+		defer hold.Release()
+		defer func() { telemetry.EndSpan(span, err) }()
+		if err := IngestPipeline.Run(ctx, in, ingestStages...); err != nil {
+			return nil, err
 		}
+		return in.Warnings, nil
+	}, nil
+}
 
-		// Check for lock errors and retry
-		if isLockError(err) {
-			lastErr = err
-			continue
+// ValidateScanRequest checks everything about a scan request that can be
+// checked without fetching its files
+func ValidateScanRequest(req ScanRequest) error {
+	if req.Image != "" {
+		if err := image.ValidateRef(req.Image); err != nil {
+			return err
 		}
+	}
+	if err := ValidateChecksums(req); err != nil {
+		return err
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+	if err := ValidateParseMode(req.ParseMode); err != nil {
 		return err
 	}
+	if err := ValidateTimeouts(req); err != nil {
+		return err
+	}
+	if err := ValidateExcludes(req.Exclude); err != nil {
+		return err
+	}
+	return ValidatePathPrefix(req.PathPrefix)
+}
 
-	return fmt.Errorf("failed after %d attempts: %v", maxRetries, lastErr)
+// ValidateChecksums checks that every expected checksum is a SHA-256 hex
+// digest of one of the request's files
+func ValidateChecksums(req ScanRequest) error {
+	for file, sum := range req.Checksums {
+		if !slices.Contains(req.Files, file) {
+			return fmt.Errorf("checksum given for %q, which is not in files", file)
+		}
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid SHA-256 checksum for %q", file)
+		}
+	}
+	return nil
 }
 
-// processFileWithRetry handles individual file processing pipeline
-func processFileWithRetry(repo, filePath string) error {
-	content, err := FetchFileContent(repo, filePath)
-	if err != nil {
-		return fmt.Errorf("fetch failed: %v", err)
+// ValidatePathPrefix checks that a path prefix is a relative directory
+// without empty or dot segments
+func ValidatePathPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
 	}
+	for _, s := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if s == "" || s == "." || s == ".." {
+			return fmt.Errorf("invalid path_prefix %q", prefix)
+		}
+	}
+	return nil
+}
 
-	// Unmarshal JSON content
-	var scanFiles []models.ScanFile
-	if err := json.Unmarshal(content, &scanFiles); err != nil {
-		return fmt.Errorf("invalid JSON: %v", err)
+// ValidateExcludes checks that every exclude pattern is a valid file
+// pattern
+func ValidateExcludes(patterns []string) error {
+	for _, p := range patterns {
+		if err := github.ValidatePattern(p); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Insert scan results into database
-	return executeInTransaction(func(tx *sqlx.Tx) error {
-		scanTime := time.Now().UTC()
+// prefixFiles returns the files as paths under prefix. Files are joined
+// without cleaning, so one can't step outside the prefix unnoticed.
+func prefixFiles(prefix string, files []string) []string {
+	if prefix == "" {
+		return files
+	}
+	prefixed := make([]string, len(files))
+	for i, f := range files {
+		prefixed[i] = strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(f, "/")
+	}
+	return prefixed
+}
 
-		for _, sf := range scanFiles {
-			sr := sf.ScanResults
+// applyPathPrefix rewrites the request's files and checksums to full paths,
+// clearing its prefix so it is applied once
+func applyPathPrefix(req *ScanRequest) {
+	if req.PathPrefix == "" {
+		return
+	}
+	req.Files = prefixFiles(req.PathPrefix, req.Files)
+	if len(req.Checksums) > 0 {
+		checksums := make(map[string]string, len(req.Checksums))
+		for f, sum := range req.Checksums {
+			checksums[prefixFiles(req.PathPrefix, []string{f})[0]] = sum
+		}
+		req.Checksums = checksums
+	}
+	req.PathPrefix = ""
+}
 
-			res, err := tx.Exec(
-				"INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
-				repo, filePath, scanTime, sr.ScanID, sr.Timestamp,
-			)
-			if err != nil {
-				return fmt.Errorf("insert scan failed: %v", err)
-			}
+// fetchFile fetches a file of the request and returns the rest of its
+// ingest. Unless the request forces it, a file unchanged since its last
+// ingest is skipped with github.ErrNotModified. A checksum given for the
+// file must match its SHA-256.
+func (s *Scanner) fetchFile(ctx context.Context, req ScanRequest, filePath string) (ingestFunc, error) {
+	ctx, span := telemetry.StartSpan(ctx, "scan.file",
+		attribute.String("vulnscan.repo", req.Repo),
+		attribute.String("vulnscan.file", filePath),
+	)
 
-			scanID, err := res.LastInsertId()
-			if err != nil {
-				return fmt.Errorf("get scan ID failed: %v", err)
-			}
+	repo, checksum := req.Repo, req.Checksums[filePath]
+	var cached *github.Validators
+	if !req.Force {
+		v, ok, err := storage.GetFetchValidators(ctx, storage.DB, repo, req.Ref, filePath)
+		if err != nil {
+			err = fmt.Errorf("read fetch cache failed: %w", err)
+			telemetry.EndSpan(span, err)
+			return nil, err
+		}
+		if ok {
+			cached = &github.Validators{ETag: v.ETag, LastModified: v.LastModified}
+		}
+	}
 
-			for _, vuln := range sr.Vulnerabilities {
-				_, err := tx.Exec(`INSERT INTO vulnerabilities (
-					scan_id, cve_id, severity, cvss, status, package_name, 
-					current_version, fixed_version, description, 
-					published_date, link, risk_factors
-				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-					scanID, vuln.CVEID, vuln.Severity, vuln.CVSS, vuln.Status,
-					vuln.PackageName, vuln.CurrentVersion, vuln.FixedVersion,
-					vuln.Description, vuln.PublishedDate, vuln.Link, vuln.RiskFactors,
-				)
-				if err != nil {
-					return fmt.Errorf("insert vulnerability failed: %v", err)
-				}
+	var validators github.Validators
+	in := &pipeline.Ingest{Repo: repo, File: filePath, Labels: req.Labels, Lenient: isLenient(req.ParseMode)}
+	in.Source = func(ctx context.Context) ([]byte, error) {
+		content, v, err := s.fetcher.FetchFileContent(ctx, repo, req.Ref, filePath, cached)
+		if errors.Is(err, github.ErrNotModified) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, failStep(FailureFetch, "fetch failed: %w", errs.Wrap(errs.ErrFetch, err))
+		}
+		if sum := sha256.Sum256(content); checksum != "" && !strings.EqualFold(checksum, hex.EncodeToString(sum[:])) {
+			logging.FromContext(ctx).Warn("checksum mismatch", "repo", repo, "file", filePath,
+				"expected", checksum, "actual", hex.EncodeToString(sum[:]))
+			return nil, failStep(FailureChecksum, "checksum mismatch: expected SHA-256 %s, got %x", strings.ToLower(checksum), sum)
+		}
+		validators = v
+		return content, nil
+	}
+	ingest, err := fetchIngest(ctx, span, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]formats.Warning, error) {
+		warnings, err := ingest()
+		if err != nil {
+			return nil, err
+		}
+
+		// Remember the ingested version only once it is stored, so a failed
+		// ingest is retried on the next scan
+		if validators != (github.Validators{}) {
+			v := storage.FetchValidators{ETag: validators.ETag, LastModified: validators.LastModified}
+			if err := storage.SetFetchValidators(ctx, storage.DB, repo, req.Ref, filePath, v); err != nil {
+				logging.FromContext(ctx).Warn("store fetch validators failed", "repo", repo, "file", filePath, "error", err)
 			}
 		}
-		return nil
-	})
+		return warnings, nil
+	}, nil
+}
+
+// fetchImage scans a container image and returns the rest of the report's
+// ingest
+func fetchImage(ctx context.Context, repo, ref string, labels map[string]string, lenient bool) (ingestFunc, error) {
+	ctx, span := telemetry.StartSpan(ctx, "scan.image",
+		attribute.String("vulnscan.repo", repo),
+		attribute.String("vulnscan.image", ref),
+	)
+
+	in := &pipeline.Ingest{Repo: repo, File: ref, Labels: labels, Lenient: lenient}
+	in.Source = func(ctx context.Context) ([]byte, error) {
+		content, err := image.DefaultScanner.Scan(ctx, ref)
+		if err != nil {
+			return nil, failStep(FailureImage, "image scan failed: %v", err)
+		}
+		return content, nil
+	}
+	return fetchIngest(ctx, span, in)
 }
 
-// executeInTransaction executes a function within a database transaction
-func executeInTransaction(fn func(*sqlx.Tx) error) error {
+// correlateComponents appends OSV findings and license violations for any
+// SBOM components
+func correlateComponents(ctx context.Context, scanResults []models.ScanResult) error {
+	for i := range scanResults {
+		sr := &scanResults[i]
+		if len(sr.Components) == 0 {
+			continue
+		}
+		sr.Vulnerabilities = append(sr.Vulnerabilities, license.Default.Violations(sr.Components)...)
+
+		ctx, span := telemetry.StartSpan(ctx, "osv.correlate", attribute.Int("vulnscan.components", len(sr.Components)))
+		findings, err := osv.DefaultClient.Correlate(ctx, sr.Components)
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			return err
+		}
+		sr.Vulnerabilities = append(sr.Vulnerabilities, findings...)
+	}
+	return nil
+}
+
+// ScanEvent is the payload of a "scan" event
+type ScanEvent struct {
+	File            string `json:"file"`                  // Ingested file path
+	ScanID          string `json:"scan_id"`               // Scanner-assigned scan identifier
+	ScanStatus      string `json:"scan_status,omitempty"` // Scanner-reported status
+	Incomplete      bool   `json:"incomplete,omitempty"`  // Whether the status marked the run incomplete
+	Vulnerabilities int    `json:"vulnerabilities"`       // Number of vulnerabilities ingested
+	Resolved        int    `json:"resolved,omitempty"`    // Findings of the repository no longer reported
+}
+
+// isAlertSeverity reports whether a severity warrants a vulnerability event
+func isAlertSeverity(severity string) bool {
+	return strings.EqualFold(severity, "critical") || strings.EqualFold(severity, "high")
+}
+
+// executeInTransaction executes a function within a database transaction,
+// waiting for the writer's turn first
+func executeInTransaction(ctx context.Context, fn func(*sqlx.Tx) error) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "db.transaction", attribute.String("db.system", "sqlite"))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return fmt.Errorf("db transaction failed: %w", err)
+	}
+	defer unlock()
+
 	// Start transaction
-	tx, err := storage.DB.Beginx()
+	tx, err := storage.DB.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("db transaction failed: %v", err)
+		return fmt.Errorf("db transaction failed: %w", err)
 	}
 
 	// Rollback transaction on panic
@@ -181,51 +784,7 @@ func executeInTransaction(fn func(*sqlx.Tx) error) error {
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit failed: %v", err)
+		return fmt.Errorf("commit failed: %w", err)
 	}
 	return nil
 }
-
-// isLockError checks if the error is due to database lock contention
-func isLockError(err error) bool {
-	return strings.Contains(err.Error(), "locked") ||
-		strings.Contains(err.Error(), "busy")
-}
-
-// FetchFileContent retrieves file contents from GitHub with retries
-func FetchFileContent(repo, filePath string) ([]byte, error) {
-
-	// Convert GitHub repository URL to raw content URL
-	repo = strings.TrimSuffix(repo, "/")
-	rawURL := strings.Replace(repo, "github.com", "raw.githubusercontent.com", 1) + "/main/" + filePath
-
-	var body []byte
-	var err error
-
-	// Retry loop with 2 attempts
-	for attempt := 0; attempt < 2; attempt++ {
-		var resp *http.Response
-		resp, err = http.Get(rawURL)
-		if err != nil {
-			time.Sleep(time.Second * time.Duration(attempt+1))
-			continue
-		}
-		defer resp.Body.Close()
-
-		// Check for valid response
-		if resp.StatusCode != http.StatusOK {
-			err = fmt.Errorf("HTTP status %d", resp.StatusCode)
-			time.Sleep(time.Second * time.Duration(attempt+1))
-			continue
-		}
-
-		// Read response body
-		body, err = io.ReadAll(resp.Body)
-		if err != nil {
-			time.Sleep(time.Second * time.Duration(attempt+1))
-			continue
-		}
-		return body, nil
-	}
-	return nil, fmt.Errorf("failed after 2 attempts: %v", err)
-}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// ScanSummary is one ingested scan file in the scan history
+type ScanSummary = api.ScanSummary
+
+// FileIngest is one ingest of a file in its history
+type FileIngest = api.FileIngest
+
+// ScansHandler lists ingested scans, most recent first. Optional `repo`
+// narrows the list to one repository and `limit` (default 50, at most 500)
+// bounds its length.
+func ScansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	scans, err := ListScans(r.Context(), canonicalRepo(r.Context(), r.URL.Query().Get("repo")), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("scan history query failed", "error", err)
+		http.Error(w, "Scan history query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scans)
+}
+
+// ListScans returns up to limit scans with their finding counts, most recent
+// first, optionally for a single repository
+func ListScans(ctx context.Context, repo string, limit int) ([]ScanSummary, error) {
+	query := `SELECT id, COALESCE(repo, '') AS repo, COALESCE(file_path, '') AS file_path,
+		scan_time, COALESCE(scan_id, '') AS scan_id, timestamp, sha256, resource_type, resource_name,
+		scan_status, incomplete FROM scans`
+	var args []interface{}
+	if repo != "" {
+		query += " WHERE repo = ?"
+		args = append(args, repo)
+	}
+	query += " ORDER BY scan_time DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	scans := []ScanSummary{}
+	if err := storage.Reader(ctx).SelectContext(ctx, &scans, query, args...); err != nil {
+		return nil, err
+	}
+	if len(scans) == 0 {
+		return scans, nil
+	}
+
+	index := make(map[int64]int, len(scans))
+	ids := make([]int64, len(scans))
+	for i := range scans {
+		scans[i].BySeverity = map[string]int{}
+		index[scans[i].ID] = i
+		ids[i] = scans[i].ID
+	}
+	query, args, err := sqlx.In(`SELECT scan_id, COALESCE(severity, '') AS severity, COUNT(*) AS count
+		FROM vulnerabilities WHERE scan_id IN (?) GROUP BY scan_id, severity`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		ScanID   int64  `db:"scan_id"`
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &counts, query, args...); err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		s := &scans[index[c.ScanID]]
+		s.Findings += c.Count
+		s.BySeverity[c.Severity] += c.Count
+	}
+	return scans, nil
+}
+
+// fileHistory returns the ingests of one file of a repository, most recent
+// first, each with its severity counts and their changes since the ingest
+// before it. Optional `limit` (default 50, at most 500) bounds the length.
+func fileHistory(w http.ResponseWriter, r *http.Request, repo, file string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	repo, err := resolveRepo(r.Context(), repo)
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	var history []FileIngest
+	if err == nil {
+		history, err = QueryFileHistory(r.Context(), repo, file, limit)
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("file history query failed", "error", err)
+		http.Error(w, "File history query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// QueryFileHistory returns up to limit ingests of a repository's file, most
+// recent first. The scans stored from one ingest are counted together, and
+// each ingest is compared with the one before it: the change of each
+// severity's count, and how many vulnerabilities, told apart by identifier,
+// package, and version, are new or no longer reported. The oldest ingest is
+// compared with nothing, so all its vulnerabilities are new. It returns
+// errs.ErrNotFound when the file was never ingested.
+func QueryFileHistory(ctx context.Context, repo, file string, limit int) ([]FileIngest, error) {
+	var scans []struct {
+		ID       int64     `db:"id"`
+		ScanTime time.Time `db:"scan_time"`
+		SHA256   string    `db:"sha256"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &scans, `SELECT id, scan_time, COALESCE(sha256, '') AS sha256
+		FROM scans WHERE repo = ? AND file_path = ? ORDER BY scan_time DESC, id`, repo, file); err != nil {
+		return nil, err
+	}
+	if len(scans) == 0 {
+		return nil, errs.ErrNotFound
+	}
+
+	// Group the scans into ingests, keeping one more than requested to
+	// compare the oldest with
+	var (
+		history []FileIngest
+		ids     []int64
+		ingest  = map[int64]int{} // Index into history by scan ID
+	)
+	for _, s := range scans {
+		if n := len(history); n == 0 || !history[n-1].ScanTime.Equal(s.ScanTime) {
+			if n == limit+1 {
+				break
+			}
+			history = append(history, FileIngest{ScanTime: s.ScanTime, SHA256: s.SHA256, ScanIDs: []int64{}, BySeverity: map[string]int{}})
+		}
+		history[len(history)-1].ScanIDs = append(history[len(history)-1].ScanIDs, s.ID)
+		ingest[s.ID] = len(history) - 1
+		ids = append(ids, s.ID)
+	}
+
+	query, args, err := sqlx.In(`SELECT scan_id, COALESCE(severity, '') AS severity, cve_id,
+		LOWER(COALESCE(package_name, '')) AS package_name, COALESCE(current_version, '') AS current_version
+		FROM vulnerabilities WHERE scan_id IN (?)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var vulns []struct {
+		ScanID         int64  `db:"scan_id"`
+		Severity       string `db:"severity"`
+		CVEID          string `db:"cve_id"`
+		PackageName    string `db:"package_name"`
+		CurrentVersion string `db:"current_version"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &vulns, query, args...); err != nil {
+		return nil, err
+	}
+	keys := make([]map[string]bool, len(history))
+	for i := range keys {
+		keys[i] = map[string]bool{}
+	}
+	for _, v := range vulns {
+		i := ingest[v.ScanID]
+		history[i].Findings++
+		history[i].BySeverity[v.Severity]++
+		keys[i][v.CVEID+"\x00"+v.PackageName+"\x00"+v.CurrentVersion] = true
+	}
+
+	for i := range history {
+		previous, previousKeys := FileIngest{}, map[string]bool{}
+		if i+1 < len(history) {
+			previous, previousKeys = history[i+1], keys[i+1]
+		}
+		delta := map[string]int{}
+		for sev, n := range history[i].BySeverity {
+			delta[sev] += n
+		}
+		for sev, n := range previous.BySeverity {
+			delta[sev] -= n
+		}
+		for sev, n := range delta {
+			if n == 0 {
+				delete(delta, sev)
+			}
+		}
+		history[i].Delta = delta
+		for k := range keys[i] {
+			if !previousKeys[k] {
+				history[i].New++
+			}
+		}
+		for k := range previousKeys {
+			if !keys[i][k] {
+				history[i].Fixed++
+			}
+		}
+	}
+	return history[:min(len(history), limit)], nil
+}
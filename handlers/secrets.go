@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/secrets"
+)
+
+// SecretStatus describes a credential of an integration without its value
+type SecretStatus = models.SecretStatus
+
+// SecretsHandler lists the credentials of integrations, whether each is
+// configured, and where its value came from. Values are never returned.
+func SecretsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secrets.Default.List())
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/sla"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// OverdueFinding is an open finding past its remediation due date
+type OverdueFinding = api.OverdueFinding
+
+// SLACompliance summarizes SLA adherence of the open findings of one severity
+type SLACompliance = api.SLACompliance
+
+// AgingBuckets counts the open findings of one severity by age
+type AgingBuckets = api.AgingBuckets
+
+// OverdueHandler lists open findings past their SLA due date, most overdue
+// first. Optional `repo` and `severity` query parameters narrow the list.
+func OverdueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	overdue, err := QueryOverdue(r.Context(), canonicalRepo(r.Context(), q.Get("repo")), q.Get("severity"), time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("overdue query failed", "error", err)
+		http.Error(w, "Overdue query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overdue)
+}
+
+// QueryOverdue returns the open findings of the latest scans whose due date,
+// per sla.Default, is before now
+func QueryOverdue(ctx context.Context, repo, severity string, now time.Time) ([]OverdueFinding, error) {
+	findings, err := openFindings(ctx, repo, severity)
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := []OverdueFinding{}
+	for _, f := range findings {
+		due, ok := sla.Default.DueDate(f.Severity, f.FirstSeen)
+		if !ok || !now.After(due) {
+			continue
+		}
+		f.DueDate = due
+		f.DaysOverdue = int(now.Sub(due).Hours() / 24)
+		overdue = append(overdue, f)
+	}
+
+	sort.SliceStable(overdue, func(i, j int) bool {
+		return overdue[i].DueDate.Before(overdue[j].DueDate)
+	})
+	return overdue, nil
+}
+
+// QuerySLACompliance counts open and overdue findings per severity that has
+// an SLA, optionally for a single repository
+func QuerySLACompliance(ctx context.Context, repo string, now time.Time) (map[string]SLACompliance, error) {
+	findings, err := openFindings(ctx, repo, "")
+	if err != nil {
+		return nil, err
+	}
+	return slaCompliance(findings, now), nil
+}
+
+// slaCompliance counts the open and overdue findings per severity that has
+// an SLA
+func slaCompliance(findings []OverdueFinding, now time.Time) map[string]SLACompliance {
+	stats := make(map[string]SLACompliance, len(sla.Default))
+	for sev, days := range sla.Default {
+		stats[sev] = SLACompliance{Days: days, Compliance: 1}
+	}
+	for _, f := range findings {
+		sev := strings.ToUpper(f.Severity)
+		s, ok := stats[sev]
+		if !ok {
+			continue
+		}
+		s.Open++
+		if due, _ := sla.Default.DueDate(sev, f.FirstSeen); now.After(due) {
+			s.Overdue++
+		}
+		s.Compliance = float64(s.Open-s.Overdue) / float64(s.Open)
+		stats[sev] = s
+	}
+	return stats
+}
+
+// agingBuckets counts the open findings per severity by the time since
+// they were first seen: under 30 days, 30 to 90 days, and over 90 days
+func agingBuckets(findings []OverdueFinding, now time.Time) map[string]AgingBuckets {
+	aging := make(map[string]AgingBuckets)
+	for _, f := range findings {
+		sev := reportSeverity(f.Severity)
+		b := aging[sev]
+		switch age := now.Sub(f.FirstSeen); {
+		case age < 30*24*time.Hour:
+			b.Under30Days++
+		case age <= 90*24*time.Hour:
+			b.Days30To90++
+		default:
+			b.Over90Days++
+		}
+		aging[sev] = b
+	}
+	return aging
+}
+
+// openFindings loads the open and acknowledged findings of the latest scan
+// of every repository file, with their EPSS and KEV data and the time each
+// was first reported in its repository, per the findings table
+func openFindings(ctx context.Context, repo, severity string) ([]OverdueFinding, error) {
+	query := `SELECT
+		v.id AS finding_id, v.cve_id, v.severity, v.cvss, v.status, v.package_name, v.current_version,
+		v.fixed_version, v.description, v.published_date, v.link, v.risk_factors,
+		v.ecosystem, v.purl, v.location, v.fingerprint, v.triage_status, v.assignee,
+		e.epss, e.percentile AS epss_percentile, ` + kevColumn + `,
+		COALESCE(s.repo, '') AS repo, COALESCE(s.file_path, '') AS file_path, f.first_seen
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		JOIN findings f ON f.repo = COALESCE(s.repo, '') AND f.package_name = COALESCE(v.package_name, '')
+			AND f.cve_id = COALESCE(v.cve_id, '')
+		LEFT JOIN epss_scores e ON e.cve_id = v.cve_id
+		WHERE v.triage_status IN (?, ?)
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)`
+	args := []interface{}{TriageOpen, TriageAcknowledged}
+	if repo != "" {
+		query += " AND s.repo = ?"
+		args = append(args, repo)
+	}
+	if severity != "" {
+		query += " AND UPPER(v.severity) = UPPER(?)"
+		args = append(args, severity)
+	}
+
+	var rows []struct {
+		models.Vulnerability
+		Repo      string    `db:"repo"`
+		FilePath  string    `db:"file_path"`
+		FirstSeen time.Time `db:"first_seen"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	findings := make([]OverdueFinding, 0, len(rows))
+	for _, row := range rows {
+		findings = append(findings, OverdueFinding{
+			Vulnerability: row.Vulnerability,
+			Repo:          row.Repo,
+			FilePath:      row.FilePath,
+			FirstSeen:     row.FirstSeen.UTC(),
+		})
+	}
+	return findings, nil
+}
+
+// parseTimestamp parses a DATETIME value returned without its column type,
+// as aggregate results are, in any format the SQLite driver writes
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// StatsResponse defines the response structure for /stats endpoint
+type StatsResponse = api.StatsResponse
+
+// LabelStats are the counts of scans sharing a label value
+type LabelStats = api.LabelStats
+
+// StatsFilter restricts and groups the scans counted by QueryStats
+type StatsFilter struct {
+	Repo    string            // Repository URL; all when empty
+	Labels  map[string]string // Labels counted scans must all carry
+	GroupBy string            // Label key to break the counts down by
+}
+
+// StatsHandler returns aggregate counts of stored scans and vulnerabilities
+// and the SLA compliance and ages of open findings. The `repo` query parameter
+// restricts them to one repository, repeated `label` parameters of the
+// form key:value to scans carrying those labels, and `group_by` breaks the
+// counts down by the value of a label.
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	labels, err := parseLabelParams(q["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := StatsFilter{Repo: canonicalRepo(r.Context(), q.Get("repo")), Labels: labels, GroupBy: q.Get("group_by")}
+	if filter.GroupBy != "" && !labelKey.MatchString(filter.GroupBy) {
+		http.Error(w, fmt.Sprintf("invalid group_by label %q", filter.GroupBy), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := QueryStats(r.Context(), filter)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("stats query failed", "error", err)
+		http.Error(w, "Stats query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// QueryStats computes aggregate counts, SLA compliance, and aging of the
+// scans the filter selects. SLA compliance and aging are of the
+// repository's findings, which outlive the labels of any one scan.
+func QueryStats(ctx context.Context, filter StatsFilter) (StatsResponse, error) {
+	stats := StatsResponse{BySeverity: map[string]int{}}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Repo != "" {
+		where = append(where, "s.repo = ?")
+		args = append(args, filter.Repo)
+	}
+	if len(filter.Labels) > 0 {
+		cond, labelArgs := storage.LabelFilter("s.id", filter.Labels)
+		where = append(where, cond)
+		args = append(args, labelArgs...)
+	}
+	scanFilter := ""
+	if len(where) > 0 {
+		scanFilter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var counts struct {
+		Scans int `db:"scans"`
+		Repos int `db:"repos"`
+	}
+	err := storage.Statements.GetContext(ctx, storage.Reader(ctx), &counts,
+		"SELECT COUNT(*) AS scans, COUNT(DISTINCT s.repo) AS repos FROM scans s"+scanFilter, args...)
+	if err != nil {
+		return stats, err
+	}
+	stats.Scans, stats.Repos = counts.Scans, counts.Repos
+
+	var rows []struct {
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	err = storage.Statements.SelectContext(ctx, storage.Reader(ctx), &rows, `SELECT COALESCE(v.severity, '') AS severity, COUNT(*) AS count
+		FROM vulnerabilities v LEFT JOIN scans s ON s.id = v.scan_id`+scanFilter+`
+		GROUP BY v.severity`, args...)
+	if err != nil {
+		return stats, err
+	}
+	for _, row := range rows {
+		stats.BySeverity[row.Severity] = row.Count
+		stats.Vulnerabilities += row.Count
+	}
+
+	if filter.GroupBy != "" {
+		if stats.ByLabel, err = queryLabelStats(ctx, filter.GroupBy, scanFilter, args); err != nil {
+			return stats, err
+		}
+	}
+
+	findings, err := openFindings(ctx, filter.Repo, "")
+	if err != nil {
+		return stats, err
+	}
+	now := time.Now()
+	stats.SLA, stats.Aging = slaCompliance(findings, now), agingBuckets(findings, now)
+	return stats, nil
+}
+
+// queryLabelStats counts the scans matching scanFilter, and their
+// vulnerabilities, by the value of the key label
+func queryLabelStats(ctx context.Context, key, scanFilter string, args []interface{}) (map[string]LabelStats, error) {
+	// Join on the grouping label, keeping scans without it under ""
+	join := " LEFT JOIN scan_labels g ON g.scan_id = s.id AND g.key = ?"
+	args = append([]interface{}{key}, args...)
+
+	var scans []struct {
+		Value string `db:"value"`
+		Scans int    `db:"scans"`
+		Repos int    `db:"repos"`
+	}
+	err := storage.Statements.SelectContext(ctx, storage.Reader(ctx), &scans, `SELECT COALESCE(g.value, '') AS value,
+		COUNT(*) AS scans, COUNT(DISTINCT s.repo) AS repos FROM scans s`+join+scanFilter+`
+		GROUP BY value`, args...)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]LabelStats, len(scans))
+	for _, row := range scans {
+		groups[row.Value] = LabelStats{Scans: row.Scans, Repos: row.Repos, BySeverity: map[string]int{}}
+	}
+
+	var vulns []struct {
+		Value    string `db:"value"`
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	err = storage.Statements.SelectContext(ctx, storage.Reader(ctx), &vulns, `SELECT COALESCE(g.value, '') AS value,
+		COALESCE(v.severity, '') AS severity, COUNT(*) AS count
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id`+join+scanFilter+`
+		GROUP BY value, v.severity`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range vulns {
+		g := groups[row.Value]
+		g.BySeverity[row.Severity] = row.Count
+		g.Vulnerabilities += row.Count
+		groups[row.Value] = g
+	}
+	return groups, nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/risk"
+)
+
+// TopOffender is a package, vulnerability, or repository ranked by the open
+// findings it contributes
+type TopOffender = api.TopOffender
+
+// Groupings of GET /stats/top
+const (
+	TopByPackage = "package"
+	TopByCVE     = "cve"
+	TopByRepo    = "repo"
+)
+
+// defaultTopLimit is the number of offenders returned when no limit is given
+const defaultTopLimit = 20
+
+// TopOffendersHandler ranks the packages, vulnerabilities, or repositories
+// named by the `by` query parameter by their open findings weighted by
+// severity, highest first. `limit` (default 20, at most 500) bounds the
+// list and the optional `repo` parameter restricts it to one repository.
+func TopOffendersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	by := q.Get("by")
+	if by == "" {
+		by = TopByPackage
+	}
+	if by != TopByPackage && by != TopByCVE && by != TopByRepo {
+		http.Error(w, fmt.Sprintf("invalid by %q (want %s, %s, or %s)", by, TopByPackage, TopByCVE, TopByRepo), http.StatusBadRequest)
+		return
+	}
+	limit := defaultTopLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	offenders, err := QueryTopOffenders(r.Context(), by, canonicalRepo(r.Context(), q.Get("repo")), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("top offenders query failed", "error", err)
+		http.Error(w, "Top offenders query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offenders)
+}
+
+// QueryTopOffenders groups the open findings of the latest scans, of one
+// repository or all, by package name, vulnerability ID, or repository and
+// returns the limit groups of highest score. A finding scores the severity
+// weight of risk.Default; ties go to the group with more findings, then by
+// name.
+func QueryTopOffenders(ctx context.Context, by, repo string, limit int) ([]TopOffender, error) {
+	findings, err := openFindings(ctx, repo, "")
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		offender TopOffender
+		repos    map[string]bool
+	}
+	groups := make(map[string]*group)
+	for _, f := range findings {
+		name := f.PackageName
+		switch by {
+		case TopByCVE:
+			name = f.CVEID
+		case TopByRepo:
+			name = f.Repo
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &group{offender: TopOffender{Name: name, BySeverity: map[string]int{}}, repos: map[string]bool{}}
+			groups[name] = g
+		}
+		sev := reportSeverity(f.Severity)
+		weight, ok := risk.Default.Severity[sev]
+		if !ok {
+			weight = risk.Default.Unknown
+		}
+		g.offender.Score += weight
+		g.offender.Findings++
+		g.offender.BySeverity[sev]++
+		g.repos[f.Repo] = true
+	}
+
+	offenders := make([]TopOffender, 0, len(groups))
+	for _, g := range groups {
+		if by != TopByRepo {
+			g.offender.Repos = len(g.repos)
+		}
+		offenders = append(offenders, g.offender)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		a, b := offenders[i], offenders[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Findings != b.Findings {
+			return a.Findings > b.Findings
+		}
+		return a.Name < b.Name
+	})
+	if limit > 0 && len(offenders) > limit {
+		offenders = offenders[:limit]
+	}
+	return offenders, nil
+}
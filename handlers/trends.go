@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Trend window limits, in days
+const (
+	defaultTrendDays = 90
+	maxTrendDays     = 365
+)
+
+// TrendResponse defines the response structure for /trends endpoint
+type TrendResponse = api.TrendResponse
+
+// TrendPoint is the number of findings as of the end of one day
+type TrendPoint = api.TrendPoint
+
+// TrendsHandler returns daily vulnerability counts by severity, computed from
+// scan history. Optional `repo` narrows the counts to one repository and
+// `window` (e.g. 30d, default 90d, at most 365d) sets how far back to go.
+func TrendsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultTrendDays
+	if s := r.URL.Query().Get("window"); s != "" {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 || n > maxTrendDays {
+			http.Error(w, "window must be a number of days between 1d and 365d", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	repo := canonicalRepo(r.Context(), r.URL.Query().Get("repo"))
+	points, err := QueryTrend(r.Context(), repo, days, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("trend query failed", "error", err)
+		http.Error(w, "Trend query failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TrendResponse{Repo: repo, Days: days, Points: points})
+}
+
+// QueryTrend counts, for each of the last days days up to now, the findings
+// in the latest scan of every file as of the end of that day, optionally for
+// a single repository. The series starts at the first scanned day if that
+// is later, and is empty when nothing was scanned.
+func QueryTrend(ctx context.Context, repo string, days int, now time.Time) ([]TrendPoint, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	end := today.AddDate(0, 0, 1)
+
+	scanQuery := "SELECT id, COALESCE(repo, '') AS repo, COALESCE(file_path, '') AS file_path, scan_time FROM scans WHERE scan_time < ?"
+	countQuery := `SELECT v.scan_id, COALESCE(v.severity, '') AS severity, COUNT(*) AS count
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id WHERE s.scan_time < ?`
+	args := []interface{}{end}
+	if repo != "" {
+		scanQuery += " AND repo = ?"
+		countQuery += " AND s.repo = ?"
+		args = append(args, repo)
+	}
+
+	var scans []struct {
+		ID       int64     `db:"id"`
+		Repo     string    `db:"repo"`
+		FilePath string    `db:"file_path"`
+		ScanTime time.Time `db:"scan_time"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &scans, scanQuery+" ORDER BY scan_time, id", args...); err != nil {
+		return nil, err
+	}
+	points := []TrendPoint{}
+	if len(scans) == 0 {
+		return points, nil
+	}
+
+	var counts []struct {
+		ScanID   int64  `db:"scan_id"`
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	if err := storage.Reader(ctx).SelectContext(ctx, &counts, countQuery+" GROUP BY v.scan_id, v.severity", args...); err != nil {
+		return nil, err
+	}
+	perScan := map[int64]map[string]int{}
+	for _, c := range counts {
+		if perScan[c.ScanID] == nil {
+			perScan[c.ScanID] = map[string]int{}
+		}
+		perScan[c.ScanID][reportSeverity(c.Severity)] += c.Count
+	}
+
+	start := today.AddDate(0, 0, 1-days)
+	if first := scans[0].ScanTime.UTC().Truncate(24 * time.Hour); first.After(start) {
+		start = first
+	}
+
+	// Walk the days in order, replaying scans up to the end of each day
+	latest := map[[2]string]int64{} // repo and file -> latest scan ID so far
+	next := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1)
+		for ; next < len(scans) && scans[next].ScanTime.Before(dayEnd); next++ {
+			latest[[2]string{scans[next].Repo, scans[next].FilePath}] = scans[next].ID
+		}
+		point := TrendPoint{Date: day, BySeverity: map[string]int{}}
+		for _, id := range latest {
+			for sev, n := range perScan[id] {
+				point.BySeverity[sev] += n
+				point.Total += n
+			}
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Triage statuses
+const (
+	TriageOpen          = "open"
+	TriageAcknowledged  = "acknowledged"
+	TriageFalsePositive = "false_positive"
+	TriageWontFix       = "wont_fix"
+	TriageResolved      = "resolved"
+)
+
+// triageTransitions lists the statuses reachable from each status. Closed
+// states (false_positive, wont_fix, resolved) can only be reopened.
+var triageTransitions = map[string][]string{
+	TriageOpen:          {TriageAcknowledged, TriageFalsePositive, TriageWontFix, TriageResolved},
+	TriageAcknowledged:  {TriageOpen, TriageFalsePositive, TriageWontFix, TriageResolved},
+	TriageFalsePositive: {TriageOpen},
+	TriageWontFix:       {TriageOpen},
+	TriageResolved:      {TriageOpen},
+}
+
+// actorHeader identifies the user making a change, set by the calling
+// client or an authenticating proxy
+const actorHeader = "X-Actor"
+
+// TriageUpdate defines the request structure for PATCH /vulnerabilities/{id}/triage
+type TriageUpdate = api.TriageUpdate
+
+// CommentRequest defines the request structure for POST /vulnerabilities/{id}/comments
+type CommentRequest = api.CommentRequest
+
+// TriageResponse describes the triage state of a vulnerability
+type TriageResponse = api.TriageResponse
+
+// BulkTriageRequest defines the request structure for POST /vulnerabilities/bulk-update
+type BulkTriageRequest = api.BulkTriageRequest
+
+// BulkTriageResponse defines the response structure for POST /vulnerabilities/bulk-update
+type BulkTriageResponse = api.BulkTriageResponse
+
+var (
+	errInvalidStatus     = errors.New("unknown triage status")                            // Status not in triageTransitions
+	errInvalidTransition = errs.New(errs.ErrConflict, "invalid triage status transition") // Disallowed status change
+)
+
+// TriageHandler reads (GET) or updates (PATCH) the triage state of the
+// vulnerability identified by the {id} path segment
+func TriageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := findingID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var req TriageUpdate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := UpdateTriage(r.Context(), id, actorFromRequest(r), req); err != nil {
+			writeTriageError(w, r, err)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeTriage(w, r, id, http.StatusOK)
+}
+
+// CommentsHandler adds a comment (POST) to the vulnerability identified by
+// the {id} path segment
+func CommentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := findingID(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return
+	}
+	err := executeInTransaction(r.Context(), func(tx *sqlx.Tx) error {
+		if _, err := storage.GetTriageState(r.Context(), tx, id); err != nil {
+			return err
+		}
+		return storage.AddComment(r.Context(), tx, id, actorFromRequest(r), req.Body)
+	})
+	if err != nil {
+		writeTriageError(w, r, err)
+		return
+	}
+
+	writeTriage(w, r, id, http.StatusCreated)
+}
+
+// BulkTriageHandler applies one triage update to every finding matching a
+// query filter. Without confirm it previews the update; with confirm set to
+// the previewed match count it applies the update in one transaction, and
+// when the count has changed since the preview nothing is applied and 409
+// is returned with the new counts. Findings whose status cannot change to
+// the patched one are skipped.
+func BulkTriageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BulkTriageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateQueryFilters(req.Filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Patch.Status == nil && req.Patch.Assignee == nil && strings.TrimSpace(req.Patch.Comment) == "" {
+		http.Error(w, "patch must set status, assignee, or comment", http.StatusBadRequest)
+		return
+	}
+	if req.Patch.Status != nil {
+		if _, ok := triageTransitions[*req.Patch.Status]; !ok {
+			http.Error(w, fmt.Sprintf("%v %q", errInvalidStatus, *req.Patch.Status), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := BulkUpdateTriage(r.Context(), actorFromRequest(r), req)
+	if err != nil {
+		writeTriageError(w, r, err)
+		return
+	}
+	logging.FromContext(r.Context()).Info("bulk triage", "applied", resp.Applied, "matched", resp.Matched,
+		"updated", resp.Updated, "skipped", len(resp.Skipped))
+
+	code := http.StatusOK
+	if req.Confirm != nil && !resp.Applied {
+		code = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// BulkUpdateTriage applies req.Patch to the findings matching req.Filters
+// when req.Confirm equals their number, and otherwise reports what it
+// would change
+func BulkUpdateTriage(ctx context.Context, actor string, req BulkTriageRequest) (BulkTriageResponse, error) {
+	// Every stored occurrence is updated, not just one per merged result
+	filters := req.Filters
+	filters.Dedup = DedupOff
+
+	var (
+		resp  BulkTriageResponse
+		apply bool
+	)
+	err := executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		// Select in the transaction, so that the count confirmed is that of
+		// the findings updated
+		vulns, err := QueryVulnerabilities(storage.WithTx(ctx, tx), filters)
+		if err != nil {
+			return err
+		}
+		resp = BulkTriageResponse{Matched: len(vulns), Skipped: []int64{}}
+		apply = req.Confirm != nil && *req.Confirm == resp.Matched
+		for _, v := range vulns {
+			changed, err := applyTriage(ctx, tx, v.FindingID, actor, req.Patch)
+			switch {
+			case errors.Is(err, errInvalidTransition):
+				resp.Skipped = append(resp.Skipped, v.FindingID)
+			case err != nil:
+				return err
+			case changed:
+				resp.Updated++
+			default:
+				resp.Unchanged++
+			}
+		}
+		if !apply {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	resp.Applied = apply && err == nil
+	return resp, err
+}
+
+// UpdateTriage applies a triage update, recording every changed field in
+// the audit trail
+func UpdateTriage(ctx context.Context, id int64, actor string, req TriageUpdate) error {
+	return executeInTransaction(ctx, func(tx *sqlx.Tx) error {
+		_, err := applyTriage(ctx, tx, id, actor, req)
+		return err
+	})
+}
+
+// applyTriage applies a triage update within tx and reports whether it
+// changed anything
+func applyTriage(ctx context.Context, tx *sqlx.Tx, id int64, actor string, req TriageUpdate) (bool, error) {
+	current, err := storage.GetTriageState(ctx, tx, id)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if req.Status != nil && *req.Status != current.Status {
+		if _, ok := triageTransitions[*req.Status]; !ok {
+			return false, fmt.Errorf("%w %q", errInvalidStatus, *req.Status)
+		}
+		if !canTransition(current.Status, *req.Status) {
+			return false, fmt.Errorf("%w: %s -> %s", errInvalidTransition, current.Status, *req.Status)
+		}
+		if err := storage.SetTriageField(ctx, tx, id, actor, "triage_status", current.Status, *req.Status); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	if req.Assignee != nil && *req.Assignee != current.Assignee {
+		if err := storage.SetTriageField(ctx, tx, id, actor, "assignee", current.Assignee, *req.Assignee); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	if strings.TrimSpace(req.Comment) != "" {
+		return true, storage.AddComment(ctx, tx, id, actor, req.Comment)
+	}
+	return changed, nil
+}
+
+// canTransition reports whether a status change is allowed
+func canTransition(from, to string) bool {
+	for _, s := range triageTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// findingID parses the {id} path segment, writing an error when invalid
+func findingID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid vulnerability id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// actorFromRequest identifies who is making a change
+func actorFromRequest(r *http.Request) string {
+	if actor := strings.TrimSpace(r.Header.Get(actorHeader)); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// writeTriage writes the full triage state of a vulnerability
+func writeTriage(w http.ResponseWriter, r *http.Request, id int64, code int) {
+	resp, err := GetTriage(r.Context(), id)
+	if err != nil {
+		writeTriageError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetTriage returns the triage state, comments, and audit trail of a vulnerability
+func GetTriage(ctx context.Context, id int64) (TriageResponse, error) {
+	state, err := storage.GetTriageState(ctx, storage.DB, id)
+	if err != nil {
+		return TriageResponse{}, err
+	}
+	resp := TriageResponse{FindingID: id, Status: state.Status, Assignee: state.Assignee}
+	if resp.Comments, err = storage.ListComments(ctx, storage.DB, id); err != nil {
+		return resp, err
+	}
+	resp.History, err = storage.ListTriageEvents(ctx, storage.DB, id)
+	return resp, err
+}
+
+// writeTriageError maps triage errors onto HTTP status codes
+func writeTriageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		http.Error(w, "Vulnerability not found", http.StatusNotFound)
+	case errors.Is(err, errInvalidStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errs.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logging.FromContext(r.Context()).Error("triage failed", "error", err)
+		http.Error(w, "Triage failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
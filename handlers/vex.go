@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/vex"
+)
+
+// maxVEXBytes bounds the size of an imported VEX document
+const maxVEXBytes = 10 << 20
+
+// VEXImportResponse defines the response structure for POST /vex
+type VEXImportResponse = api.VEXImportResponse
+
+// VEXHandler imports OpenVEX documents (POST) and exports the current VEX
+// state as an OpenVEX document (GET, optionally scoped by `repo`)
+func VEXHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		importVEX(w, r)
+	case http.MethodGet:
+		exportVEX(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// importVEX stores every statement of the posted document
+func importVEX(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxVEXBytes))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	doc, err := vex.Parse(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := statementRows(doc)
+	if err := storage.InsertVEXStatements(r.Context(), storage.DB, rows); err != nil {
+		logging.FromContext(r.Context()).Error("VEX import failed", "error", err)
+		http.Error(w, "VEX import failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("VEX document imported",
+		"document", doc.ID, "statements", len(rows))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VEXImportResponse{Statements: len(rows)})
+}
+
+// statementRows flattens a document into one row per vulnerability and
+// package, normalizing package URLs so they match stored findings
+func statementRows(doc *vex.Document) []models.VEXStatement {
+	var rows []models.VEXStatement
+	for _, s := range doc.Statements {
+		ts := doc.Timestamp
+		if s.Timestamp != nil {
+			ts = *s.Timestamp
+		}
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		for _, id := range s.PackageIDs() {
+			rows = append(rows, models.VEXStatement{
+				VulnID:          s.Vulnerability.Name,
+				Product:         purl.Normalize(id),
+				Status:          s.Status,
+				Justification:   s.Justification,
+				ImpactStatement: s.ImpactStatement,
+				ActionStatement: s.ActionStatement,
+				Author:          doc.Author,
+				DocumentID:      doc.ID,
+				Timestamp:       ts.UTC(),
+			})
+		}
+	}
+	return rows
+}
+
+// exportVEX writes stored statements, or for a repository, the status of
+// every finding in its latest scans
+func exportVEX(w http.ResponseWriter, r *http.Request) {
+	var (
+		statements []models.VEXStatement
+		err        error
+	)
+	if repo := canonicalRepo(r.Context(), r.URL.Query().Get("repo")); repo != "" {
+		statements, err = repoVEXStatements(r.Context(), repo)
+	} else {
+		statements, err = storage.ListVEXStatements(r.Context(), storage.DB)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("VEX export failed", "error", err)
+		http.Error(w, "VEX export failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]vex.Statement, 0, len(statements))
+	for _, s := range statements {
+		ts := s.Timestamp
+		out = append(out, vex.Statement{
+			Vulnerability:   vex.Vulnerability{Name: s.VulnID},
+			Timestamp:       &ts,
+			Products:        []vex.Product{{ID: s.Product}},
+			Status:          s.Status,
+			Justification:   s.Justification,
+			ImpactStatement: s.ImpactStatement,
+			ActionStatement: s.ActionStatement,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vex.NewDocument("vulnscan", out))
+}
+
+// repoVEXStatements returns one statement per finding in the latest scan of
+// each repository file: the applicable stored statement, or one derived
+// from the finding's triage status when none has been imported
+func repoVEXStatements(ctx context.Context, repo string) ([]models.VEXStatement, error) {
+	var vulns []models.Vulnerability
+	err := storage.DB.SelectContext(ctx, &vulns, `SELECT v.cve_id, v.severity, v.cvss, v.status,
+		v.package_name, v.current_version, v.fixed_version, v.description, v.published_date,
+		v.link, v.risk_factors, v.ecosystem, v.purl, v.triage_status
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE s.repo = ? AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)
+		ORDER BY v.cve_id, v.purl`, repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.AttachAliases(ctx, storage.DB, vulns); err != nil {
+		return nil, err
+	}
+	if err := storage.AttachVEX(ctx, storage.DB, vulns); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[[2]string]bool)
+	var statements []models.VEXStatement
+	for _, v := range vulns {
+		key := [2]string{v.CVEID, v.PURL}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		s := triageStatement(v.TriageStatus)
+		s.Timestamp = time.Now().UTC()
+		if v.VEX != nil {
+			s = *v.VEX
+		}
+		s.VulnID, s.Product = v.CVEID, v.PURL
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+// triageStatement expresses a triage status as a VEX statement
+func triageStatement(status string) models.VEXStatement {
+	switch status {
+	case TriageFalsePositive:
+		return models.VEXStatement{Status: vex.StatusNotAffected, ImpactStatement: "Triaged as a false positive"}
+	case TriageResolved:
+		return models.VEXStatement{Status: vex.StatusFixed}
+	case TriageWontFix:
+		return models.VEXStatement{Status: vex.StatusAffected, ActionStatement: "Risk accepted; no fix planned"}
+	case TriageAcknowledged:
+		return models.VEXStatement{Status: vex.StatusAffected, ActionStatement: "Remediation in progress"}
+	}
+	return models.VEXStatement{Status: vex.StatusUnderInvestigation}
+}
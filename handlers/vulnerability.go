@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// VulnerabilityDetail defines the response structure for GET /vulnerabilities/{id}
+type VulnerabilityDetail = api.VulnerabilityDetail
+
+// Occurrence is one scan's report of a finding
+type Occurrence = api.Occurrence
+
+// PresenceChange is a scan of a file that started or stopped reporting a
+// finding
+type PresenceChange = api.PresenceChange
+
+// VulnerabilityHandler returns the vulnerability identified by the {id}
+// path segment with its occurrence history and triage trail
+func VulnerabilityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := findingID(w, r)
+	if !ok {
+		return
+	}
+
+	detail, err := GetVulnerabilityDetail(r.Context(), id)
+	if errors.Is(err, errs.ErrNotFound) {
+		http.Error(w, "Vulnerability not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("vulnerability detail failed", "id", id, "error", err)
+		http.Error(w, "Vulnerability detail failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// GetVulnerabilityDetail returns a stored vulnerability, with its raw
+// report fields, and every stored report of its finding, the scans where
+// the finding appeared in or disappeared from each file, and its triage
+// state. It returns errs.ErrNotFound for an unknown id.
+func GetVulnerabilityDetail(ctx context.Context, id int64) (VulnerabilityDetail, error) {
+	var detail VulnerabilityDetail
+	var key struct {
+		Repo        string `db:"repo"`
+		PackageName string `db:"package_name"`
+		CVEID       string `db:"cve_id"`
+	}
+	err := storage.Reader(ctx).GetContext(ctx, &key, `SELECT COALESCE(s.repo, '') AS repo,
+		COALESCE(v.package_name, '') AS package_name, COALESCE(v.cve_id, '') AS cve_id
+		FROM vulnerabilities v LEFT JOIN scans s ON s.id = v.scan_id WHERE v.id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return detail, errs.ErrNotFound
+	}
+	if err != nil {
+		return detail, err
+	}
+	detail.Repo = key.Repo
+
+	vulns, err := loadVulnerabilities(ctx, " WHERE v.id = ?", []interface{}{id}, DedupOff, true, "", nil)
+	if err != nil {
+		return detail, err
+	}
+	if len(vulns) == 0 {
+		return detail, errs.ErrNotFound
+	}
+	detail.Vulnerability = vulns[0]
+
+	var f Finding
+	err = storage.Reader(ctx).GetContext(ctx, &f, `SELECT id, repo, package_name, cve_id, COALESCE(severity, '') AS severity,
+		status, first_seen, last_seen, COALESCE(last_scan_id, 0) AS last_scan_id, resolved_at FROM findings
+		WHERE repo = ? AND package_name = ? AND cve_id = ?`, key.Repo, key.PackageName, key.CVEID)
+	switch {
+	case err == nil:
+		detail.Finding = &f
+	case !errors.Is(err, sql.ErrNoRows):
+		return detail, err
+	}
+
+	detail.Occurrences = []Occurrence{}
+	err = storage.Reader(ctx).SelectContext(ctx, &detail.Occurrences, `SELECT v.id AS finding_id, s.id AS scan_id,
+		COALESCE(s.file_path, '') AS file_path, COALESCE(s.source, '') AS source, s.scan_time,
+		COALESCE(v.severity, '') AS severity, COALESCE(v.current_version, '') AS current_version
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE COALESCE(s.repo, '') = ? AND COALESCE(v.package_name, '') = ? AND COALESCE(v.cve_id, '') = ?
+		ORDER BY s.scan_time, s.id, v.id`, key.Repo, key.PackageName, key.CVEID)
+	if err != nil {
+		return detail, err
+	}
+
+	if detail.Timeline, err = presenceTimeline(ctx, key.Repo, detail.Occurrences); err != nil {
+		return detail, err
+	}
+
+	detail.Triage, err = GetTriage(ctx, id)
+	return detail, err
+}
+
+// presenceTimeline walks the scans of each file with occurrences, oldest
+// first, and returns those where the file started or stopped reporting the
+// finding. Scans of a file stored at one time count as one scan.
+func presenceTimeline(ctx context.Context, repo string, occurrences []Occurrence) ([]PresenceChange, error) {
+	timeline := []PresenceChange{}
+	if len(occurrences) == 0 {
+		return timeline, nil
+	}
+	type fileScan struct {
+		FilePath string    `db:"file_path"`
+		ScanTime time.Time `db:"scan_time"`
+	}
+	present := make(map[fileScan]bool, len(occurrences))
+	var files []string
+	for _, o := range occurrences {
+		k := fileScan{o.FilePath, o.ScanTime.UTC()}
+		if !present[k] {
+			present[k] = true
+			files = append(files, o.FilePath)
+		}
+	}
+
+	query, args, err := sqlx.In(`SELECT DISTINCT COALESCE(file_path, '') AS file_path, scan_time FROM scans
+		WHERE COALESCE(repo, '') = ? AND COALESCE(file_path, '') IN (?) ORDER BY scan_time, file_path`, repo, files)
+	if err != nil {
+		return nil, err
+	}
+	var scans []fileScan
+	if err := storage.Reader(ctx).SelectContext(ctx, &scans, query, args...); err != nil {
+		return nil, err
+	}
+
+	reported := make(map[string]bool) // Whether each file's previous scan reported the finding
+	for _, s := range scans {
+		now := present[fileScan{s.FilePath, s.ScanTime.UTC()}]
+		if now == reported[s.FilePath] {
+			continue
+		}
+		reported[s.FilePath] = now
+		change := api.PresenceAppeared
+		if !now {
+			change = api.PresenceDisappeared
+		}
+		timeline = append(timeline, PresenceChange{FilePath: s.FilePath, ScanTime: s.ScanTime, Change: change})
+	}
+	return timeline, nil
+}
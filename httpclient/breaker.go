@@ -0,0 +1,129 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending a request while its host's
+// circuit breaker is open
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // Requests are sent
+	CircuitOpen     = "open"      // Requests fail fast until the cooldown has passed
+	CircuitHalfOpen = "half-open" // One probe request is sent; the rest fail fast
+)
+
+// Circuit is the breaker state of one host
+type Circuit struct {
+	Host     string // Host name, with the port when given
+	State    string // Closed, open, or half-open
+	Failures int    // Consecutive upstream failures
+	Opens    int    // Times the breaker has opened
+}
+
+// OnCircuitChange, when set, is called with a host's breaker whenever it
+// opens, and when it closes again after having been open, e.g. to alert on
+// upstream outages. It is called without locks held, and is meant to be
+// set once at startup.
+var OnCircuitChange func(c Circuit)
+
+// circuit tracks the failures of one host
+type circuit struct {
+	state    string
+	failures int
+	opens    int
+	openedAt time.Time
+	probing  bool // A half-open probe is in flight
+}
+
+// circuits holds the breakers of every host a transport has sent requests
+// to
+type circuits struct {
+	mu     sync.Mutex
+	byHost map[string]*circuit
+}
+
+// allow reports whether a request to host may be sent. Once an open
+// breaker's cooldown has passed, it lets one probe through.
+func (cs *circuits) allow(cfg Config, host string) error {
+	if cfg.BreakerThreshold <= 0 {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c := cs.byHost[host]
+	switch {
+	case c == nil || c.state == CircuitClosed:
+		return nil
+	case c.state == CircuitOpen && time.Since(c.openedAt) >= cfg.BreakerCooldown:
+		c.state, c.probing = CircuitHalfOpen, true
+		return nil
+	case c.state == CircuitHalfOpen && !c.probing:
+		c.probing = true
+		return nil
+	}
+	return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+}
+
+// record counts the outcome of an attempt sent to host. Upstream failures
+// are transport errors and 5xx responses; any other response shows the
+// host is up. Cancelled and blocked requests say nothing about the host.
+func (cs *circuits) record(cfg Config, req *http.Request, resp *http.Response, err error) {
+	if cfg.BreakerThreshold <= 0 {
+		return
+	}
+	host := req.URL.Host
+	cs.mu.Lock()
+	if cs.byHost == nil {
+		cs.byHost = make(map[string]*circuit)
+	}
+	c := cs.byHost[host]
+	if c == nil {
+		c = &circuit{state: CircuitClosed}
+		cs.byHost[host] = c
+	}
+
+	previous := c.state
+	switch {
+	case err != nil && (req.Context().Err() != nil || errors.Is(err, ErrBlockedAddress)):
+		c.probing = false
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		c.failures++
+		if c.state == CircuitHalfOpen || c.failures >= cfg.BreakerThreshold {
+			if c.state != CircuitOpen {
+				c.opens++
+			}
+			c.state, c.openedAt, c.probing = CircuitOpen, time.Now(), false
+		}
+	default:
+		c.state, c.failures, c.probing = CircuitClosed, 0, false
+	}
+	state := Circuit{Host: host, State: c.state, Failures: c.failures, Opens: c.opens}
+	cs.mu.Unlock()
+
+	// A half-open probe failing reopens the breaker without a new outage
+	changed := (state.State == CircuitOpen && previous == CircuitClosed) ||
+		(state.State == CircuitClosed && previous != CircuitClosed)
+	if changed && OnCircuitChange != nil {
+		OnCircuitChange(state)
+	}
+}
+
+// list returns the state of every host's breaker, sorted by host
+func (cs *circuits) list() []Circuit {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	list := make([]Circuit, 0, len(cs.byHost))
+	for host, c := range cs.byHost {
+		list = append(list, Circuit{Host: host, State: c.state, Failures: c.failures, Opens: c.opens})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+	return list
+}
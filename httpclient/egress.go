@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a public transport would connect to an
+// internal address
+var ErrBlockedAddress = errors.New("httpclient: address not allowed")
+
+// reservedNetworks are ranges that aren't publicly routed, besides those
+// netip.Addr classifies
+var reservedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // This network
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can embed any IPv4 address
+	netip.MustParsePrefix("2002::/16"),     // 6to4, likewise
+}
+
+// allowedAddr reports whether a public transport may connect to ip
+func allowedAddr(ip netip.Addr, allowed []netip.Prefix) bool {
+	ip = ip.Unmap()
+	for _, p := range allowed {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	switch {
+	case !ip.IsValid(), ip.IsUnspecified(), ip.IsLoopback(), ip.IsPrivate(),
+		ip.IsLinkLocalUnicast(), ip.IsMulticast():
+		return false
+	}
+	for _, p := range reservedNetworks {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// guard restricts the connections of base to allowed addresses. Each
+// address is checked as it is dialed, after name resolution, so a name
+// can't pass a check and then resolve elsewhere. Requests sent through a
+// proxy are checked when their host is an IP address; the proxy resolves
+// names itself.
+func guard(base *http.Transport, allowed []netip.Prefix) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !allowedAddr(ap.Addr(), allowed) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			return nil
+		},
+	}
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	proxies := proxyAddrs()
+	base.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if proxies[address] {
+			return direct.DialContext(ctx, network, address)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	proxy := base.Proxy
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		if ip, err := netip.ParseAddr(req.URL.Hostname()); err == nil && !allowedAddr(ip, allowed) {
+			return nil, fmt.Errorf("%w: %s", ErrBlockedAddress, req.URL.Host)
+		}
+		return proxy(req)
+	}
+}
+
+// proxyAddrs returns the host:port of each proxy configured in the
+// environment, which may be internal
+func proxyAddrs() map[string]bool {
+	addrs := make(map[string]bool)
+	for _, key := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			if u, err = url.Parse("http://" + v); err != nil {
+				continue
+			}
+		}
+		port := u.Port()
+		if port == "" {
+			switch u.Scheme {
+			case "https":
+				port = "443"
+			case "socks5", "socks5h":
+				port = "1080"
+			default:
+				port = "80"
+			}
+		}
+		addrs[net.JoinHostPort(u.Hostname(), port)] = true
+	}
+	return addrs
+}
@@ -0,0 +1,257 @@
+// Package httpclient provides the HTTP transport shared by every outbound
+// integration: per-attempt timeouts, retries with exponential backoff that
+// honor Retry-After, per-host circuit breakers, proxies from
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY, and extra trusted CA certificates for
+// TLS-intercepting corporate proxies.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config controls the shared transport
+type Config struct {
+	Timeout    time.Duration // Wait for response headers, per attempt
+	MaxRetries int           // Retries after the first attempt
+	Backoff    time.Duration // Delay before the first retry, doubling after each
+	MaxBackoff time.Duration // Longest delay; a longer Retry-After ends retrying
+	CABundle   string        // PEM file of CA certificates trusted besides the system's
+
+	// Consecutive upstream failures of a host after which its requests fail
+	// fast with ErrCircuitOpen; 0 disables the breaker
+	BreakerThreshold int
+	// How long an open breaker fails requests before letting one probe
+	// through
+	BreakerCooldown time.Duration
+
+	// Private address ranges public clients may still connect to, e.g. an
+	// internal GitHub Enterprise server
+	AllowedNetworks []netip.Prefix
+}
+
+// DefaultConfig is used until Configure is called
+var DefaultConfig = Config{
+	Timeout:    30 * time.Second,
+	MaxRetries: 3,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// Transport is a retrying http.RoundTripper. Its settings can be replaced
+// while in use, so clients created at package initialization pick up the
+// configuration applied at startup.
+type Transport struct {
+	mu       sync.RWMutex
+	cfg      Config
+	base     http.RoundTripper
+	public   bool // Connect to public addresses only
+	circuits *circuits
+}
+
+// NewTransport creates a transport with the given settings
+func NewTransport(cfg Config) (*Transport, error) {
+	return newTransport(cfg, false, &circuits{})
+}
+
+// NewPublicTransport creates a transport that refuses, with
+// ErrBlockedAddress, to connect to loopback, private, link-local, and other
+// internal addresses outside cfg.AllowedNetworks. Addresses are checked
+// after name resolution, as each connection is made, so redirects and
+// names that resolve to internal addresses are refused too.
+func NewPublicTransport(cfg Config) (*Transport, error) {
+	return newTransport(cfg, true, &circuits{})
+}
+
+// newTransport creates a transport recording upstream failures in cs
+func newTransport(cfg Config, public bool, cs *circuits) (*Transport, error) {
+	t := &Transport{public: public, circuits: cs}
+	if err := t.Configure(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Configure replaces the transport's settings. Requests in flight finish
+// with the previous ones.
+func (t *Transport) Configure(cfg Config) error {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = http.ProxyFromEnvironment
+	base.ResponseHeaderTimeout = cfg.Timeout
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return fmt.Errorf("httpclient: read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("httpclient: no certificates in CA bundle %s", cfg.CABundle)
+		}
+		base.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	if t.public {
+		guard(base, cfg.AllowedNetworks)
+	}
+
+	t.mu.Lock()
+	t.cfg, t.base = cfg, base
+	t.mu.Unlock()
+	return nil
+}
+
+// RoundTrip sends the request, retrying transport errors and retryable
+// statuses. Requests that may not be safe to repeat, such as a POST, are
+// retried only when the server refused them with 429 or 503. While the
+// host's circuit breaker is open, attempts fail with ErrCircuitOpen instead
+// of being sent.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	cfg, base := t.cfg, t.base
+	t.mu.RUnlock()
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		if err := t.circuits.allow(cfg, req.URL.Host); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		t.circuits.record(cfg, req, resp, err)
+		if attempt >= cfg.MaxRetries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		delay, ok := retryDelay(cfg, attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a failed attempt should be repeated
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // The body can't be sent again
+	}
+	if err != nil {
+		return req.Context().Err() == nil && !errors.Is(err, ErrBlockedAddress) && idempotent(req)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
+}
+
+// idempotent reports whether repeating the request has no further effect
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryDelay returns the wait before the next attempt: the response's
+// Retry-After when given, otherwise the doubling backoff. It reports false
+// when the server asks for a longer wait than MaxBackoff.
+func retryDelay(cfg Config, attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if d, ok := ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, d <= cfg.MaxBackoff
+		}
+	}
+	delay := cfg.Backoff << attempt
+	if delay > cfg.MaxBackoff || delay <= 0 {
+		delay = cfg.MaxBackoff
+	}
+	return delay, true
+}
+
+// ParseRetryAfter parses a Retry-After value in seconds or as an HTTP date
+func ParseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// shared backs every client returned by New, and public every client
+// returned by NewPublic; they share circuit breakers
+var (
+	shared, _ = NewTransport(DefaultConfig)
+	public, _ = newTransport(DefaultConfig, true, shared.circuits)
+)
+
+// Configure applies cfg to the shared and public transports
+func Configure(cfg Config) error {
+	if err := shared.Configure(cfg); err != nil {
+		return err
+	}
+	return public.Configure(cfg)
+}
+
+// Circuits returns the circuit breaker state of every host the transport
+// has sent requests to, sorted by host
+func (t *Transport) Circuits() []Circuit {
+	return t.circuits.list()
+}
+
+// Circuits returns the circuit breaker states of the shared transport
+func Circuits() []Circuit {
+	return shared.Circuits()
+}
+
+// New returns a client on the shared transport whose requests, retries
+// included, are bounded by timeout
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: shared}
+}
+
+// NewPublic returns a client like New whose connections may only reach
+// public addresses, for fetching URLs given in API requests
+func NewPublic(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: public}
+}
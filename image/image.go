@@ -0,0 +1,78 @@
+// Package image scans container images by running an external scanner and
+// returning its report for ingestion
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Scanner produces a vulnerability report for a container image reference
+type Scanner interface {
+	Scan(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Trivy runs the trivy CLI as a subprocess and returns its JSON report
+type Trivy struct {
+	Path    string        // Executable; looked up in PATH when not absolute
+	Timeout time.Duration // Maximum run time per image, including the pull
+	Args    []string      // Extra arguments, e.g. --username or --platform
+}
+
+// DefaultScanner is the scanner used for image scan requests
+var DefaultScanner Scanner = &Trivy{Path: "trivy", Timeout: 10 * time.Minute}
+
+// refPattern matches registry/repository[:tag][@digest] references. It
+// rejects leading dashes and whitespace so a reference can never be read
+// as a scanner option.
+var refPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/:@+-]*$`)
+
+// ValidateRef checks that ref is a plausible image reference
+func ValidateRef(ref string) error {
+	if len(ref) > 512 || !refPattern.MatchString(ref) {
+		return fmt.Errorf("invalid image reference %q", ref)
+	}
+	return nil
+}
+
+// Scan runs `trivy image` on ref and returns its JSON report
+func (t *Trivy) Scan(ctx context.Context, ref string) ([]byte, error) {
+	if err := ValidateRef(ref); err != nil {
+		return nil, err
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	args := append([]string{"image", "--format", "json", "--quiet", "--scanners", "vuln"}, t.Args...)
+	args = append(args, "--", ref)
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("trivy timed out after %s", t.Timeout)
+		}
+		if msg := lastLine(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("trivy failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("trivy failed: %v", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// lastLine returns the last non-empty line of s, which for scanner CLIs is
+// usually the fatal error
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
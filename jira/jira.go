@@ -0,0 +1,178 @@
+// Package jira opens Jira issues for findings and syncs their status back
+// using the Jira REST API (v2, supported by Cloud and Data Center).
+package jira
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// Client creates and searches issues in one Jira project
+type Client struct {
+	BaseURL    string       // Site root, e.g. https://example.atlassian.net
+	Email      string       // Account email for basic auth; empty uses Token as a bearer token
+	Token      string       // API token (Cloud) or personal access token (Data Center)
+	Project    string       // Project key issues are created in
+	IssueType  string       // Issue type name, e.g. Bug
+	Labels     []string     // Labels applied to created issues
+	Severities []string     // Finding severities that get an issue
+	HTTP       *http.Client // Underlying HTTP client
+}
+
+// NewClient creates a client for project with the default issue type,
+// labels, and severities
+func NewClient(baseURL, email, token, project string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Email:      email,
+		Token:      token,
+		Project:    project,
+		IssueType:  "Bug",
+		Labels:     []string{"vulnscan"},
+		Severities: []string{"CRITICAL", "HIGH"},
+		HTTP:       httpclient.New(30 * time.Second),
+	}
+}
+
+// DefaultClient is used by the sync job; nil until configured
+var DefaultClient *Client
+
+// Issue is a new issue to create
+type Issue struct {
+	Summary     string
+	Description string
+}
+
+// Status is the workflow status of an existing issue
+type Status struct {
+	Key  string // Issue key, e.g. SEC-123
+	Name string // Status name, e.g. In Progress
+	Done bool   // Whether the status is in the Done category
+}
+
+// CreateIssue creates an issue and returns its key
+func (c *Client) CreateIssue(ctx context.Context, issue Issue) (string, error) {
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": c.Project},
+			"issuetype":   map[string]string{"name": c.IssueType},
+			"summary":     issue.Summary,
+			"description": issue.Description,
+			"labels":      c.Labels,
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := c.do(ctx, "/rest/api/2/issue", body, &created); err != nil {
+		return "", err
+	}
+	if created.Key == "" {
+		return "", fmt.Errorf("jira: create issue: response has no key")
+	}
+	return created.Key, nil
+}
+
+// FindIssue returns the key of an issue in the project whose summary
+// contains the phrase, or "" when there is none
+func (c *Client) FindIssue(ctx context.Context, phrase string) (string, error) {
+	jql := fmt.Sprintf("project = %s AND summary ~ %s ORDER BY created ASC", quoteJQL(c.Project), quoteJQL(`"`+phrase+`"`))
+	issues, err := c.search(ctx, jql, 1)
+	if err != nil || len(issues) == 0 {
+		return "", err
+	}
+	return issues[0].Key, nil
+}
+
+// Statuses returns the current status of each issue key. Keys that no
+// longer exist are omitted.
+func (c *Client) Statuses(ctx context.Context, keys []string) ([]Status, error) {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = quoteJQL(k)
+	}
+	return c.search(ctx, "key in ("+strings.Join(quoted, ", ")+")", len(keys))
+}
+
+// search runs a JQL query, returning the status of each matching issue
+func (c *Client) search(ctx context.Context, jql string, max int) ([]Status, error) {
+	body := map[string]interface{}{
+		"jql":           jql,
+		"fields":        []string{"status"},
+		"maxResults":    max,
+		"validateQuery": "warn",
+	}
+	var result struct {
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Status struct {
+					Name           string `json:"name"`
+					StatusCategory struct {
+						Key string `json:"key"`
+					} `json:"statusCategory"`
+				} `json:"status"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := c.do(ctx, "/rest/api/2/search", body, &result); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(result.Issues))
+	for _, issue := range result.Issues {
+		statuses = append(statuses, Status{
+			Key:  issue.Key,
+			Name: issue.Fields.Status.Name,
+			Done: issue.Fields.Status.StatusCategory.Key == "done",
+		})
+	}
+	return statuses, nil
+}
+
+// do POSTs body as JSON to path and decodes the response into out
+func (c *Client) do(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.Email != "" {
+		req.SetBasicAuth(c.Email, c.Token)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("jira: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("jira: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("jira: decode response: %v", err)
+	}
+	return nil
+}
+
+// quoteJQL quotes a value for use in a JQL query
+func quoteJQL(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,230 @@
+package jira
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// statusBatch is the number of issue keys looked up per search
+const statusBatch = 50
+
+// Sync opens issues for open findings that do not have one yet, then
+// syncs the status of known issues back to triage. It returns the number of
+// issues created and of findings whose triage status changed.
+func (c *Client) Sync(ctx context.Context, db *sqlx.DB) (created, updated int, err error) {
+	if created, err = c.CreateIssues(ctx, db); err != nil {
+		return created, 0, err
+	}
+	updated, err = c.SyncStatuses(ctx, db)
+	return created, updated, err
+}
+
+// CreateIssues opens one issue per vulnerability and package among the open
+// findings of the latest scans with a configured severity. An issue already
+// recorded for the pair, or found in the project by summary, is reused.
+func (c *Client) CreateIssues(ctx context.Context, db *sqlx.DB) (int, error) {
+	if len(c.Severities) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In(`SELECT v.cve_id, v.package_name, v.severity, v.cvss, v.description,
+		v.current_version, v.fixed_version, v.link, COALESCE(s.repo, '') AS repo
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE UPPER(v.severity) IN (?)
+			AND v.triage_status IN ('open', 'acknowledged')
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)
+			AND NOT EXISTS (SELECT 1 FROM jira_issues j
+				WHERE j.cve_id = v.cve_id AND j.package_name = v.package_name)
+		ORDER BY v.cve_id, v.package_name`, upper(c.Severities))
+	if err != nil {
+		return 0, err
+	}
+	var rows []struct {
+		CVEID          string  `db:"cve_id"`
+		PackageName    string  `db:"package_name"`
+		Severity       string  `db:"severity"`
+		CVSS           float64 `db:"cvss"`
+		Description    string  `db:"description"`
+		CurrentVersion string  `db:"current_version"`
+		FixedVersion   string  `db:"fixed_version"`
+		Link           string  `db:"link"`
+		Repo           string  `db:"repo"`
+	}
+	if err := db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return 0, err
+	}
+
+	// Group the findings of each vulnerability and package across repositories
+	created := 0
+	for i := 0; i < len(rows); {
+		j := i
+		repos := map[string]bool{}
+		for ; j < len(rows) && rows[j].CVEID == rows[i].CVEID && rows[j].PackageName == rows[i].PackageName; j++ {
+			repos[rows[j].Repo] = true
+		}
+		r := rows[i]
+		i = j
+
+		phrase := fmt.Sprintf("%s in %s", r.CVEID, r.PackageName)
+		key, err := c.FindIssue(ctx, phrase)
+		if err == nil && key == "" {
+			key, err = c.CreateIssue(ctx, Issue{
+				Summary: fmt.Sprintf("%s (%s)", phrase, strings.ToUpper(r.Severity)),
+				Description: fmt.Sprintf("%s\n\nSeverity: %s (CVSS %.1f)\nPackage: %s %s\nFixed in: %s\nRepositories: %s\n\n%s",
+					r.Description, strings.ToUpper(r.Severity), r.CVSS, r.PackageName, r.CurrentVersion,
+					orNone(r.FixedVersion), strings.Join(sortedKeys(repos), ", "), r.Link),
+			})
+			if err == nil {
+				created++
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return created, ctx.Err()
+			}
+			slog.Warn("Jira issue creation failed", "cve", r.CVEID, "package", r.PackageName, "error", err)
+			continue
+		}
+
+		_, err = db.ExecContext(ctx, `INSERT OR IGNORE INTO jira_issues (cve_id, package_name, issue_key, created_at)
+			VALUES (?, ?, ?, ?)`, r.CVEID, r.PackageName, key, time.Now().UTC())
+		if err != nil {
+			return created, fmt.Errorf("store issue %s: %v", key, err)
+		}
+	}
+	return created, nil
+}
+
+// SyncStatuses records the current status of every known issue. Findings
+// are resolved when their issue moves to a Done status and reopened when it
+// leaves one; each change is attributed to the issue in the audit trail.
+func (c *Client) SyncStatuses(ctx context.Context, db *sqlx.DB) (int, error) {
+	var issues []struct {
+		CVEID       string `db:"cve_id"`
+		PackageName string `db:"package_name"`
+		Key         string `db:"issue_key"`
+		Done        bool   `db:"done"`
+	}
+	err := db.SelectContext(ctx, &issues, "SELECT cve_id, package_name, issue_key, done FROM jira_issues ORDER BY issue_key")
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for start := 0; start < len(issues); start += statusBatch {
+		batch := issues[start:min(start+statusBatch, len(issues))]
+		keys := make([]string, len(batch))
+		for i, issue := range batch {
+			keys[i] = issue.Key
+		}
+		statuses, err := c.Statuses(ctx, keys)
+		if err != nil {
+			return updated, err
+		}
+		byKey := make(map[string]Status, len(statuses))
+		for _, st := range statuses {
+			byKey[st.Key] = st
+		}
+
+		for _, issue := range batch {
+			st, ok := byKey[issue.Key]
+			if !ok {
+				continue
+			}
+			n, err := applyStatus(ctx, db, issue.CVEID, issue.PackageName, issue.Done, st)
+			if err != nil {
+				return updated, fmt.Errorf("sync %s: %v", issue.Key, err)
+			}
+			updated += n
+		}
+	}
+	return updated, nil
+}
+
+// applyStatus stores an issue's status and, when it entered or left the
+// Done category, updates the triage status of its findings
+func applyStatus(ctx context.Context, db *sqlx.DB, cveID, pkg string, wasDone bool, st Status) (int, error) {
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE jira_issues SET status = ?, done = ?, synced_at = ? WHERE issue_key = ?",
+		st.Name, st.Done, time.Now().UTC(), st.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	var from []string
+	to := "resolved"
+	switch {
+	case st.Done && !wasDone:
+		from = []string{"open", "acknowledged"}
+	case !st.Done && wasDone:
+		from, to = []string{"resolved"}, "open"
+	default:
+		return 0, tx.Commit()
+	}
+
+	query, args, err := sqlx.In(`SELECT id, triage_status FROM vulnerabilities
+		WHERE cve_id = ? AND package_name = ? AND triage_status IN (?)`, cveID, pkg, from)
+	if err != nil {
+		return 0, err
+	}
+	var findings []struct {
+		ID     int64  `db:"id"`
+		Status string `db:"triage_status"`
+	}
+	if err := tx.SelectContext(ctx, &findings, query, args...); err != nil {
+		return 0, err
+	}
+	for _, f := range findings {
+		if err := storage.SetTriageField(ctx, tx, f.ID, "jira:"+st.Key, "triage_status", f.Status, to); err != nil {
+			return 0, err
+		}
+	}
+	return len(findings), tx.Commit()
+}
+
+// upper returns the upper-cased values
+func upper(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToUpper(v)
+	}
+	return out
+}
+
+// sortedKeys returns the non-empty keys of set in order
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for k := range set {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// orNone substitutes "none" for an empty value
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+// Package jobs runs periodic background work such as feed refreshes.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is a unit of periodic background work
+type Job struct {
+	Name       string                          // Unique job name
+	Interval   time.Duration                   // Time between runs
+	Run        func(ctx context.Context) error // Work to perform
+	LeaderOnly bool                            // Run only on the leader of replicas sharing the database
+	Local      bool                            // Run on every replica, for work on the process's own state
+}
+
+// Status describes the most recent run of a job
+type Status struct {
+	Name     string    `json:"name"`               // Job name
+	LastRun  time.Time `json:"last_run,omitempty"` // Start time of the last run
+	Duration string    `json:"duration,omitempty"` // Duration of the last run
+	Error    string    `json:"error,omitempty"`    // Error from the last run, if any
+	Runs     int       `json:"runs"`               // Number of completed runs
+	Skipped  int       `json:"skipped,omitempty"`  // Scheduled runs left to another replica
+}
+
+// Runner schedules registered jobs on their intervals
+type Runner struct {
+	// Claim, when set, decides before each scheduled run whether this
+	// process runs the job, so that replicas sharing a database don't
+	// duplicate work. Runs it declines or fails to decide are skipped.
+	Claim func(ctx context.Context, job Job) (bool, error)
+
+	mu      sync.Mutex
+	jobs    []Job
+	status  map[string]*Status
+	resets  map[string]chan time.Duration // New intervals for each job's loop
+	started bool
+}
+
+// NewRunner creates an empty runner
+func NewRunner() *Runner {
+	return &Runner{status: make(map[string]*Status), resets: make(map[string]chan time.Duration)}
+}
+
+// Default is the process-wide runner started by the server
+var Default = NewRunner()
+
+// Add registers a job. Jobs added after Start begin immediately.
+func (r *Runner) Add(job Job) {
+	r.mu.Lock()
+	r.jobs = append(r.jobs, job)
+	r.status[job.Name] = &Status{Name: job.Name}
+	r.resets[job.Name] = make(chan time.Duration, 1)
+	started := r.started
+	r.mu.Unlock()
+
+	if started {
+		go r.loop(context.Background(), job)
+	}
+}
+
+// Start launches a goroutine per job; each runs once immediately and then
+// on its interval until ctx is cancelled
+func (r *Runner) Start(ctx context.Context) {
+	r.mu.Lock()
+	r.started = true
+	jobs := append([]Job(nil), r.jobs...)
+	r.mu.Unlock()
+
+	for _, job := range jobs {
+		go r.loop(ctx, job)
+	}
+}
+
+// Reschedule changes the interval of the named job, counting the next run
+// from now; an interval of 0 pauses the job until it is rescheduled. A run
+// in progress completes. It reports whether the job exists.
+func (r *Runner) Reschedule(name string, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reset, ok := r.resets[name]
+	if !ok {
+		return false
+	}
+	for i := range r.jobs {
+		if r.jobs[i].Name == name {
+			r.jobs[i].Interval = interval
+		}
+	}
+	select {
+	case <-reset: // Replace a change the loop hasn't picked up yet
+	default:
+	}
+	reset <- interval
+	return true
+}
+
+// Check reports an error until the runner has been started, for /readyz
+func (r *Runner) Check() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		return errors.New("background jobs not started")
+	}
+	return nil
+}
+
+// Statuses returns a snapshot of every job's last run
+func (r *Runner) Statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Status, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		out = append(out, *r.status[job.Name])
+	}
+	return out
+}
+
+// RunNow executes the named job synchronously
+func (r *Runner) RunNow(ctx context.Context, name string) error {
+	r.mu.Lock()
+	var job *Job
+	for i := range r.jobs {
+		if r.jobs[i].Name == name {
+			job = &r.jobs[i]
+		}
+	}
+	r.mu.Unlock()
+
+	if job == nil {
+		return errors.New("unknown job " + name)
+	}
+	return r.run(ctx, *job)
+}
+
+// loop runs job on its interval until ctx is done
+func (r *Runner) loop(ctx context.Context, job Job) {
+	r.mu.Lock()
+	reset := r.resets[job.Name]
+	r.mu.Unlock()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	r.runClaimed(ctx, job)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.runClaimed(ctx, job)
+		case interval := <-reset:
+			job.Interval = interval
+			if interval > 0 {
+				ticker.Reset(interval)
+			} else {
+				ticker.Stop()
+			}
+		}
+	}
+}
+
+// runClaimed runs a scheduled job once, unless Claim leaves it to another
+// replica
+func (r *Runner) runClaimed(ctx context.Context, job Job) {
+	if r.Claim != nil {
+		ok, err := r.Claim(ctx, job)
+		if err != nil {
+			slog.Warn("background job claim failed", "job", job.Name, "error", err)
+		}
+		if !ok {
+			r.mu.Lock()
+			r.status[job.Name].Skipped++
+			r.mu.Unlock()
+			return
+		}
+	}
+	r.run(ctx, job)
+}
+
+// run executes a job once and records its outcome
+func (r *Runner) run(ctx context.Context, job Job) error {
+	start := time.Now()
+	err := job.Run(ctx)
+
+	r.mu.Lock()
+	st := r.status[job.Name]
+	st.LastRun = start.UTC()
+	st.Duration = time.Since(start).Round(time.Millisecond).String()
+	st.Runs++
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		slog.Warn("background job failed", "job", job.Name, "error", err)
+	} else {
+		slog.Debug("background job completed", "job", job.Name, "duration", time.Since(start))
+	}
+	return err
+}
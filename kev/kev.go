@@ -0,0 +1,128 @@
+// Package kev imports the CISA Known Exploited Vulnerabilities catalog,
+// the CVEs with confirmed exploitation in the wild.
+package kev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// DefaultFeedURL is the published location of the catalog
+const DefaultFeedURL = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+
+// Entry is one catalog entry
+type Entry struct {
+	CVEID            string `json:"cveID"`                      // CVE identifier
+	VendorProject    string `json:"vendorProject"`              // Affected vendor or project
+	Product          string `json:"product"`                    // Affected product
+	Name             string `json:"vulnerabilityName"`          // Short vulnerability name
+	DateAdded        string `json:"dateAdded"`                  // Date added to the catalog (YYYY-MM-DD)
+	DueDate          string `json:"dueDate"`                    // Federal remediation deadline (YYYY-MM-DD)
+	KnownRansomware  string `json:"knownRansomwareCampaignUse"` // "Known" or "Unknown"
+	RequiredAction   string `json:"requiredAction"`             // Required remediation action
+	ShortDescription string `json:"shortDescription"`           // Vulnerability summary
+}
+
+// Catalog is a parsed catalog
+type Catalog struct {
+	Version         string  `json:"catalogVersion"`  // Catalog version
+	DateReleased    string  `json:"dateReleased"`    // Release timestamp
+	Vulnerabilities []Entry `json:"vulnerabilities"` // Catalog entries
+}
+
+// Client downloads the catalog
+type Client struct {
+	FeedURL string       // Location of the JSON catalog
+	HTTP    *http.Client // Underlying HTTP client
+}
+
+// DefaultClient is used by the sync job
+var DefaultClient = &Client{
+	FeedURL: DefaultFeedURL,
+	HTTP:    httpclient.New(2 * time.Minute),
+}
+
+// Fetch downloads and parses the catalog
+func (c *Client) Fetch(ctx context.Context) (*Catalog, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kev: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kev: HTTP status %d", resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
+
+// Parse reads a catalog in the CISA JSON format
+func Parse(r io.Reader) (*Catalog, error) {
+	var c Catalog
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("kev: %v", err)
+	}
+	if c.Vulnerabilities == nil {
+		return nil, fmt.Errorf("kev: catalog has no vulnerabilities list")
+	}
+	return &c, nil
+}
+
+// Sync downloads the catalog and replaces the stored entries, returning the
+// number of CVEs listed
+func (c *Client) Sync(ctx context.Context, db *sqlx.DB) (int, error) {
+	catalog, err := c.Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Store(ctx, db, catalog)
+}
+
+// Store replaces the stored catalog in a single transaction
+func Store(ctx context.Context, db *sqlx.DB, catalog *Catalog) (int, error) {
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM kev_catalog"); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PreparexContext(ctx, `INSERT OR REPLACE INTO kev_catalog
+		(cve_id, vendor_project, product, name, date_added, due_date, known_ransomware, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, e := range catalog.Vulnerabilities {
+		_, err := stmt.ExecContext(ctx, e.CVEID, e.VendorProject, e.Product, e.Name,
+			e.DateAdded, e.DueDate, e.KnownRansomware == "Known", now)
+		if err != nil {
+			return 0, fmt.Errorf("store %s: %v", e.CVEID, err)
+		}
+	}
+	return len(catalog.Vulnerabilities), tx.Commit()
+}
@@ -0,0 +1,195 @@
+// Package license evaluates component licenses against a deny-list and
+// turns violations into findings, so they are queried, triaged, and gated
+// alongside vulnerabilities.
+package license
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// IDPrefix starts the identifier of every license violation finding, e.g.
+// "license:AGPL-3.0-only"
+const IDPrefix = "license:"
+
+// Policy lists the licenses components must not use
+type Policy struct {
+	Deny     []string // License patterns; a trailing * matches any suffix, e.g. "AGPL-*"
+	Severity string   // Severity of violation findings
+}
+
+// Default is the policy applied at ingest. Its deny-list is empty until
+// configured, so no violations are recorded.
+var Default = Policy{Severity: "HIGH"}
+
+// Match reports whether a license identifier matches a pattern, ignoring case
+func Match(pattern, id string) bool {
+	pattern, id = strings.ToLower(strings.TrimSpace(pattern)), strings.ToLower(id)
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(id, prefix)
+	}
+	return pattern == id
+}
+
+// MatchAny reports whether a license identifier matches any of the patterns
+func MatchAny(patterns []string, id string) bool {
+	for _, p := range patterns {
+		if Match(p, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Denied returns the denied licenses that make an SPDX license expression
+// unacceptable, or nil when it is allowed. For "A OR B" it is enough that
+// one alternative is allowed; "A AND B" needs both. Expressions that don't
+// parse are treated as requiring every license they mention.
+func (p Policy) Denied(expr string) []string {
+	if len(p.Deny) == 0 || strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	e := &parser{tokens: tokenize(expr), deny: p.Deny}
+	ok, denied, err := e.or()
+	if err == nil && e.pos < len(e.tokens) {
+		err = fmt.Errorf("unexpected %q", e.tokens[e.pos])
+	}
+	if err != nil {
+		// Fall back to every identifier, conjunctively
+		denied = nil
+		for _, t := range e.tokens {
+			if !isOperator(t) && MatchAny(p.Deny, t) {
+				denied = append(denied, t)
+			}
+		}
+		return denied
+	}
+	if ok {
+		return nil
+	}
+	return denied
+}
+
+// Violations returns a finding for every component whose license is denied
+func (p Policy) Violations(components []models.Component) []models.Vulnerability {
+	var findings []models.Vulnerability
+	for _, c := range components {
+		seen := make(map[string]bool)
+		for _, id := range p.Denied(c.License) {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			findings = append(findings, models.Vulnerability{
+				CVEID:          IDPrefix + id,
+				Severity:       strings.ToUpper(p.Severity),
+				Status:         "affected",
+				PackageName:    c.Name,
+				CurrentVersion: c.Version,
+				Description:    fmt.Sprintf("%s %s is licensed under %s, which is on the license deny-list", c.Name, c.Version, c.License),
+				Link:           "https://spdx.org/licenses/" + id + ".html",
+				RiskFactors:    models.RiskFactors{},
+				Ecosystem:      c.Ecosystem,
+				PURL:           c.PURL,
+			})
+		}
+	}
+	return findings
+}
+
+// tokenize splits a license expression into identifiers, operators, and
+// parentheses
+func tokenize(expr string) []string {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	return strings.Fields(expr)
+}
+
+// isOperator reports whether a token is expression syntax
+func isOperator(t string) bool {
+	switch strings.ToUpper(t) {
+	case "AND", "OR", "WITH", "(", ")":
+		return true
+	}
+	return false
+}
+
+// parser evaluates a tokenized license expression against a deny-list
+type parser struct {
+	tokens []string
+	pos    int
+	deny   []string
+}
+
+// peek reports whether the next token is op, ignoring case
+func (e *parser) peek(op string) bool {
+	return e.pos < len(e.tokens) && strings.EqualFold(e.tokens[e.pos], op)
+}
+
+// or evaluates alternatives: allowed when any alternative is
+func (e *parser) or() (bool, []string, error) {
+	ok, denied, err := e.and()
+	for err == nil && e.peek("OR") {
+		e.pos++
+		var rok bool
+		var rdenied []string
+		if rok, rdenied, err = e.and(); err == nil {
+			ok = ok || rok
+			denied = append(denied, rdenied...)
+		}
+	}
+	if ok {
+		denied = nil // An allowed alternative can be chosen instead
+	}
+	return ok, denied, err
+}
+
+// and evaluates conjunctions: allowed only when every part is
+func (e *parser) and() (bool, []string, error) {
+	ok, denied, err := e.primary()
+	for err == nil && e.peek("AND") {
+		e.pos++
+		var rok bool
+		var rdenied []string
+		if rok, rdenied, err = e.primary(); err == nil {
+			ok = ok && rok
+			denied = append(denied, rdenied...)
+		}
+	}
+	return ok, denied, err
+}
+
+// primary evaluates a parenthesized expression or a license, with an
+// optional exception that does not change whether it is denied
+func (e *parser) primary() (bool, []string, error) {
+	if e.pos >= len(e.tokens) {
+		return false, nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := e.tokens[e.pos]
+	e.pos++
+	if t == "(" {
+		ok, denied, err := e.or()
+		if err != nil {
+			return false, nil, err
+		}
+		if !e.peek(")") {
+			return false, nil, fmt.Errorf("missing )")
+		}
+		e.pos++
+		return ok, denied, nil
+	}
+	if isOperator(t) {
+		return false, nil, fmt.Errorf("unexpected %q", t)
+	}
+	if e.peek("WITH") {
+		e.pos += 2
+		if e.pos > len(e.tokens) {
+			return false, nil, fmt.Errorf("missing exception")
+		}
+	}
+	if MatchAny(e.deny, t) {
+		return false, []string{t}, nil
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader carries the per-request correlation ID
+const RequestIDHeader = "X-Request-ID"
+
+// contextKey namespaces values stored in request contexts
+type contextKey struct{}
+
+// Options configures the process-wide logger
+type Options struct {
+	Level      string // debug, info, warn, or error
+	Format     string // json or text
+	Initial    int    // Identical messages logged per second before sampling kicks in
+	Thereafter int    // After the initial burst, log every Nth identical message
+}
+
+// New builds a logger writing to w according to opts
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", opts.Level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "json", "":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", opts.Format)
+	}
+
+	if opts.Initial > 0 {
+		handler = NewSamplingHandler(handler, opts.Initial, opts.Thereafter)
+	}
+	return slog.New(handler), nil
+}
+
+// FromContext returns the request-scoped logger, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Middleware assigns each request an ID (honoring an incoming X-Request-ID),
+// echoes it in the response, and stores a logger tagged with it in the context
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := slog.Default().With(
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		)
+		logger.Debug("request started")
+		next(w, r.WithContext(WithLogger(r.Context(), logger)))
+	}
+}
+
+// RequestID returns the request ID assigned by Middleware, if any
+func RequestID(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
+
+// newRequestID generates a random 16-byte hex identifier
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in log output
+const Redacted = "[REDACTED]"
+
+// minRedactLen is the shortest value Redact hides, so that short values
+// don't blank out unrelated text
+const minRedactLen = 6
+
+// sensitiveKeys are attribute keys whose values are always redacted
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "api_key"}
+
+// redactions holds the secret values hidden from log output
+var redactions struct {
+	sync.RWMutex
+	values []string
+}
+
+// Redact hides value wherever it appears in log messages and attributes
+// from now on. Values shorter than six characters are ignored.
+func Redact(value string) {
+	if len(value) < minRedactLen {
+		return
+	}
+	redactions.Lock()
+	defer redactions.Unlock()
+	for _, v := range redactions.values {
+		if v == value {
+			return
+		}
+	}
+	redactions.values = append(redactions.values, value)
+}
+
+// RedactString returns s with the values passed to Redact replaced
+func RedactString(s string) string {
+	redactions.RLock()
+	defer redactions.RUnlock()
+	for _, v := range redactions.values {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	return s
+}
+
+// redactAttr is the ReplaceAttr of the process-wide logger: it redacts the
+// values of sensitive keys and secret values in strings and errors
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+	switch v := a.Value.Any().(type) {
+	case string:
+		if r := RedactString(v); r != v {
+			return slog.String(a.Key, r)
+		}
+	case error:
+		if s := v.Error(); RedactString(s) != s {
+			return slog.String(a.Key, RedactString(s))
+		}
+	}
+	return a
+}
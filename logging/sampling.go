@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SamplingHandler drops repetitive records so high-volume errors (e.g. one
+// failure per ingested file) cannot flood the log. Within each one-second
+// window the first `initial` records with a given level and message are
+// emitted, then only every `thereafter`th one.
+type SamplingHandler struct {
+	next       slog.Handler
+	initial    int
+	thereafter int
+	state      *samplerState
+}
+
+// samplerState is shared by handlers derived via WithAttrs/WithGroup
+type samplerState struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+// NewSamplingHandler wraps next with per-message sampling
+func NewSamplingHandler(next slog.Handler, initial, thereafter int) *SamplingHandler {
+	return &SamplingHandler{
+		next:       next,
+		initial:    initial,
+		thereafter: thereafter,
+		state:      &samplerState{counts: make(map[string]int)},
+	}
+}
+
+// Enabled delegates to the wrapped handler
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle emits the record unless it has been sampled out
+func (h *SamplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.allow(record) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a sampling handler sharing this handler's counters
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), initial: h.initial, thereafter: h.thereafter, state: h.state}
+}
+
+// WithGroup returns a sampling handler sharing this handler's counters
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), initial: h.initial, thereafter: h.thereafter, state: h.state}
+}
+
+// allow records the occurrence and reports whether it should be emitted
+func (h *SamplingHandler) allow(record slog.Record) bool {
+	s := h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := record.Time.Truncate(time.Second)
+	if !window.Equal(s.window) {
+		s.window = window
+		clear(s.counts)
+	}
+
+	key := record.Level.String() + "|" + record.Message
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= h.initial {
+		return true
+	}
+	return h.thereafter > 0 && (n-h.initial)%h.thereafter == 0
+}
@@ -0,0 +1,106 @@
+// Package metrics exposes operational metrics in the Prometheus text
+// format. Components register collectors that are read on every scrape, so
+// values are never stale and nothing is kept twice.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Sample is one value of a metric, optionally labelled
+type Sample struct {
+	Labels map[string]string // Label names and values
+	Value  float64           // Current value
+}
+
+// Metric describes a metric and how to read its samples
+type Metric struct {
+	Name    string          // Metric name, e.g. vulnscan_github_rate_limit_remaining
+	Help    string          // One-line description
+	Type    string          // Gauge or Counter
+	Collect func() []Sample // Returns the current samples; none hides the metric
+}
+
+var (
+	mu      sync.RWMutex
+	metrics = map[string]Metric{}
+)
+
+// Register adds a metric, replacing one of the same name
+func Register(m Metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	metrics[m.Name] = m
+}
+
+// Value returns a collector of a single unlabelled sample
+func Value(fn func() float64) func() []Sample {
+	return func() []Sample { return []Sample{{Value: fn()}} }
+}
+
+// Write renders every registered metric, sorted by name
+func Write(w io.Writer) error {
+	mu.RLock()
+	list := make([]Metric, 0, len(metrics))
+	for _, m := range metrics {
+		list = append(list, m)
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	var b strings.Builder
+	for _, m := range list {
+		samples := m.Collect()
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type)
+		for _, s := range samples {
+			b.WriteString(m.Name)
+			writeLabels(&b, s.Labels)
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeLabels renders a label set, sorted by name
+func writeLabels(b *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=%q", name, labels[name])
+	}
+	b.WriteByte('}')
+}
+
+// Handler serves the registered metrics
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w)
+}
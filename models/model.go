@@ -24,6 +24,90 @@ func (rf RiskFactors) Value() (driver.Value, error) {
 	return json.Marshal(rf)
 }
 
+// StringList is a list of strings stored as a JSON array
+type StringList []string
+
+// Scan implements sql.Scanner interface for database read
+func (sl *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, sl)
+	case string:
+		return json.Unmarshal([]byte(v), sl)
+	case nil:
+		*sl = nil
+		return nil
+	}
+	return errors.New("invalid type for string list")
+}
+
+// Value implements driver.Valuer interface for database write
+func (sl StringList) Value() (driver.Value, error) {
+	if sl == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(sl)
+	return string(b), err
+}
+
+// StringMap is a string-keyed map of strings stored as a JSON object
+type StringMap map[string]string
+
+// Scan implements sql.Scanner interface for database read
+func (sm *StringMap) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, sm)
+	case string:
+		return json.Unmarshal([]byte(v), sm)
+	case nil:
+		*sm = nil
+		return nil
+	}
+	return errors.New("invalid type for string map")
+}
+
+// Value implements driver.Valuer interface for database write
+func (sm StringMap) Value() (driver.Value, error) {
+	if sm == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(sm)
+	return string(b), err
+}
+
+// RawFields are fields of a report entry that no model field holds, kept
+// as they appeared and stored as a JSON object
+type RawFields map[string]json.RawMessage
+
+// Scan implements sql.Scanner interface for database read
+func (rf *RawFields) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+	default:
+		return errors.New("invalid type for raw fields")
+	}
+	if len(b) == 0 {
+		*rf = nil
+		return nil
+	}
+	return json.Unmarshal(b, rf)
+}
+
+// Value implements driver.Valuer interface for database write
+func (rf RawFields) Value() (driver.Value, error) {
+	if len(rf) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(rf)
+	return string(b), err
+}
+
 // ScanFile represents the root JSON structure
 type ScanFile struct {
 	ScanResults ScanResult `json:"scanResults"` 	// Main scan data container
@@ -38,12 +122,26 @@ type ScanResult struct {
 	ResourceType    string          `json:"resource_type"`		// Type of resource scanned
 	ResourceName    string          `json:"resource_name"`		// Name of resource scanned
 	Vulnerabilities []Vulnerability `json:"vulnerabilities"`	// List of vulnerabilities found
+	Components      []Component     `json:"components,omitempty"`	// Software components (SBOM inputs)
+	Dependencies    []Dependency    `json:"dependencies,omitempty"`	// Dependency edges between components, when known
+}
+
+// Dependency is an edge of a scan's dependency graph: Parent depends on
+// Child. Both are component refs; an empty Parent is the scanned project
+// itself, making Child a top-level dependency.
+type Dependency struct {
+	Parent string `db:"parent" json:"parent"` // Depending component ref, empty for the project
+	Child  string `db:"child" json:"child"`   // Dependency component ref
 }
 
 // Vulnerability represents a single vulnerability finding
 type Vulnerability struct {
+	FindingID      int64       `db:"finding_id" json:"finding_id,omitempty"`	// Stored row identifier, used for triage
 	CVEID          string      `db:"cve_id" json:"id"`							// CVE identifier
 	Severity       string      `db:"severity" json:"severity"`					// Severity level
+	EffectiveSeverity string   `db:"effective_severity" json:"effective_severity,omitempty"`	// Severity findings are judged by, when read with it
+	NVDSeverity    string      `db:"nvd_severity" json:"nvd_severity,omitempty"`	// Severity NVD rates it with, when enriched
+	OverrideSeverity string    `db:"override_severity" json:"override_severity,omitempty"`	// Severity a severity override gives it
 	CVSS           float64     `db:"cvss" json:"cvss"`							// CVSS score
 	Status         string      `db:"status" json:"status"`						// Status of the vulnerability
 	PackageName    string      `db:"package_name" json:"package_name"`			// Affected package
@@ -53,4 +151,205 @@ type Vulnerability struct {
 	PublishedDate  time.Time   `db:"published_date" json:"published_date"`		// Date of publication
 	Link           string      `db:"link" json:"link"`							// Reference link
 	RiskFactors    RiskFactors `db:"risk_factors" json:"risk_factors"`			// Associated risk factors
+	Ecosystem      string      `db:"ecosystem" json:"ecosystem,omitempty"`		// Package ecosystem (npm, PyPI, Alpine, ...)
+	PURL           string      `db:"purl" json:"purl,omitempty"`				// Normalized package URL
+	PackageClass   string      `db:"package_class" json:"package_class,omitempty"`	// os or application, by the package URL's type
+	TriageStatus   string      `db:"triage_status" json:"triage_status,omitempty"`	// Triage state (open, acknowledged, ...)
+	Assignee       string      `db:"assignee" json:"assignee,omitempty"`		// User responsible for remediation
+	JiraIssue      string      `db:"jira_issue" json:"jira_issue,omitempty"`	// Key of the Jira issue tracking the finding
+	EPSS           *float64    `db:"epss" json:"epss,omitempty"`				// EPSS exploit probability (0-1)
+	EPSSPercentile *float64    `db:"epss_percentile" json:"epss_percentile,omitempty"`	// EPSS percentile among all CVEs
+	KEV            bool        `db:"kev" json:"kev,omitempty"`					// Listed in the CISA Known Exploited Vulnerabilities catalog
+	NVD            *CVEMetadata `db:"-" json:"nvd,omitempty"`					// NVD enrichment, when available
+	Aliases        []string    `db:"-" json:"aliases,omitempty"`				// Other identifiers of the same advisory (CVE, GHSA)
+	VEX            *VEXStatement `db:"-" json:"vex,omitempty"`				// Applicable VEX statement, when one exists
+	Labels         map[string]string `db:"-" json:"labels,omitempty"`			// Labels of the scan that reported it
+	Sources        []string    `db:"-" json:"sources,omitempty"`				// Formats of the scans reporting it, merged by deduplication
+	Raw            RawFields   `db:"raw_json" json:"raw,omitempty"`				// Report fields no other field holds, when requested
+	CustomFields   map[string]any `db:"-" json:"custom_fields,omitempty"`		// Admin-defined fields set on it or its scan
+	Location       string      `db:"location" json:"location,omitempty"`		// Path of the package within the scanned resource, e.g. a lockfile, when the report gives one
+	Fingerprint    string      `db:"fingerprint" json:"fingerprint,omitempty"`	// Stable identity across rescans, scanners, and report renames
+}
+
+// VEXStatement is a stored VEX assertion about a vulnerability in a package
+type VEXStatement struct {
+	ID              int64     `db:"id" json:"-"`                                        // Row identifier
+	VulnID          string    `db:"vuln_id" json:"vulnerability"`                       // Vulnerability identifier
+	Product         string    `db:"product" json:"product"`                             // Normalized package URL or product identifier
+	Status          string    `db:"status" json:"status"`                               // not_affected, affected, fixed, or under_investigation
+	Justification   string    `db:"justification" json:"justification,omitempty"`       // Why the product is not affected
+	ImpactStatement string    `db:"impact_statement" json:"impact_statement,omitempty"` // Free-form not_affected explanation
+	ActionStatement string    `db:"action_statement" json:"action_statement,omitempty"` // Remediation for affected products
+	Author          string    `db:"author" json:"author,omitempty"`                     // Author of the source document
+	DocumentID      string    `db:"document_id" json:"document_id,omitempty"`           // Source document identifier
+	Timestamp       time.Time `db:"timestamp" json:"timestamp"`                         // Time the statement was made
+}
+
+// CVEMetadata holds NVD data for a CVE
+type CVEMetadata struct {
+	CVEID        string     `db:"cve_id" json:"-"`                          // CVE identifier
+	CVSSVector   string     `db:"cvss_vector" json:"cvss_vector,omitempty"` // CVSS v3 vector string
+	CVSSScore    float64    `db:"cvss_score" json:"cvss_score,omitempty"`   // CVSS v3 base score
+	CWEIDs       StringList `db:"cwe_ids" json:"cwe_ids,omitempty"`         // Weakness identifiers, e.g. CWE-79
+	References   StringList `db:"refs" json:"references,omitempty"`         // Reference URLs
+	Description  string     `db:"description" json:"description,omitempty"` // Official NVD description
+	LastModified time.Time  `db:"last_modified" json:"last_modified"`       // NVD last modification time
+	FetchedAt    time.Time  `db:"fetched_at" json:"-"`                      // Time the record was fetched
+}
+
+// Scan represents a single ingest of a scan file from a repository
+type Scan struct {
+	ID           int64     `db:"id" json:"id"`                                 // Row identifier
+	Repo         string    `db:"repo" json:"repo"`                             // Repository URL
+	FilePath     string    `db:"file_path" json:"file_path"`                   // Path of the scan file in the repository
+	ScanTime     time.Time `db:"scan_time" json:"scan_time"`                   // Time the file was ingested
+	ScanID       string    `db:"scan_id" json:"scan_id"`                       // Scanner-assigned scan identifier
+	Timestamp    time.Time `db:"timestamp" json:"timestamp"`                   // Scanner-reported execution time
+	SHA256       string    `db:"sha256" json:"sha256,omitempty"`               // SHA-256 of the ingested file
+	ResourceType string    `db:"resource_type" json:"resource_type,omitempty"` // Type of resource scanned, e.g. container_image or sbom
+	ResourceName string    `db:"resource_name" json:"resource_name,omitempty"` // Name of resource scanned, e.g. an image reference
+	ScanStatus   string    `db:"scan_status" json:"scan_status,omitempty"`     // Scanner-reported status, e.g. completed or partial
+	Incomplete   bool      `db:"incomplete" json:"incomplete,omitempty"`       // Whether the status marked the run incomplete when stored
+}
+
+// Component represents a software package listed in an SBOM
+type Component struct {
+	Name      string `db:"name" json:"name"`           // Package name
+	Version   string `db:"version" json:"version"`     // Package version
+	Ecosystem string `db:"ecosystem" json:"ecosystem"` // OSV ecosystem (npm, PyPI, Go, ...)
+	PURL      string `db:"purl" json:"purl"`           // Package URL
+	Type      string `db:"type" json:"type"`           // Component type (library, application, ...)
+	License   string `db:"license" json:"license,omitempty"` // SPDX license expression, if declared
+	Ref       string `db:"ref" json:"ref,omitempty"`         // Identifier within the scan used by dependency edges
+}
+
+// Comment is a timestamped note on a vulnerability
+type Comment struct {
+	ID              int64     `db:"id" json:"id"`                 // Row identifier
+	VulnerabilityID int64     `db:"vulnerability_id" json:"-"`    // Commented vulnerability row
+	Author          string    `db:"author" json:"author"`         // Comment author
+	Body            string    `db:"body" json:"body"`             // Comment text
+	CreatedAt       time.Time `db:"created_at" json:"created_at"` // Time the comment was added
+}
+
+// TriageEvent records one change to a vulnerability's triage state
+type TriageEvent struct {
+	ID              int64     `db:"id" json:"id"`                 // Row identifier
+	VulnerabilityID int64     `db:"vulnerability_id" json:"-"`    // Changed vulnerability row
+	Actor           string    `db:"actor" json:"actor"`           // Who made the change
+	Field           string    `db:"field" json:"field"`           // Changed field (triage_status, assignee, comment)
+	OldValue        string    `db:"old_value" json:"old_value"`   // Value before the change
+	NewValue        string    `db:"new_value" json:"new_value"`   // Value after the change
+	ChangedAt       time.Time `db:"changed_at" json:"changed_at"` // Time of the change
+}
+
+// Repository is a registered repository with its owner and the settings
+// scans of it default to
+type Repository struct {
+	URL       string     `db:"url" json:"url"`                     // Repository URL, as scans refer to it
+	Team      string     `db:"team" json:"team"`                   // Owning team
+	Contact   string     `db:"contact" json:"contact,omitempty"`   // Owner contact, e.g. an email address or chat channel
+	Tier      int        `db:"tier" json:"tier,omitempty"`         // Criticality tier, 1 (most critical) to 4; 0 if unset
+	Files     StringList `db:"files" json:"files,omitempty"`       // Files scanned when a scan names none
+	Patterns  StringList `db:"patterns" json:"patterns,omitempty"` // File patterns scanned when a scan names no files
+	Labels    StringMap  `db:"labels" json:"labels,omitempty"`     // Labels attached to every scan
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`       // Time the repository was registered
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`       // Time of the last change
+}
+
+// AuditEntry records one state-changing API request
+type AuditEntry struct {
+	ID        int64     `db:"id" json:"id"`                 // Sequence number
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Time the request completed
+	Actor     string    `db:"actor" json:"actor"`           // Caller, from the X-Actor header
+	Action    string    `db:"action" json:"action"`         // Method and route, e.g. "DELETE /repos/{path...}"
+	Target    string    `db:"target" json:"target"`         // What was changed, e.g. a repository URL or request path
+	Status    int       `db:"status" json:"status"`         // Response status code
+	RequestID string    `db:"request_id" json:"request_id"` // X-Request-ID of the request
+}
+
+// MaintenanceResult is the outcome of a maintenance run
+type MaintenanceResult struct {
+	StartedAt          time.Time `json:"started_at"`            // Start time of the run
+	Duration           string    `json:"duration"`              // Duration of the run
+	WALFrames          int       `json:"wal_frames"`            // Frames in the write-ahead log before the checkpoint
+	CheckpointedFrames int       `json:"checkpointed_frames"`   // Frames copied back into the database file
+	CheckpointBusy     bool      `json:"checkpoint_busy"`       // Whether readers kept the log from being truncated
+	AutoVacuum         string    `json:"auto_vacuum"`           // Vacuum mode of the file: none, full, or incremental
+	FullVacuum         bool      `json:"full_vacuum,omitempty"` // Whether the file was rebuilt
+	VacuumedPages      int       `json:"vacuumed_pages"`        // Free pages released to the filesystem
+	Analyzed           bool      `json:"analyzed"`              // Whether query planner statistics were refreshed
+	Integrity          []string  `json:"integrity"`             // "ok", or the problems integrity_check found
+	SizeBytes          int64     `json:"size_bytes"`            // Size of the database file afterwards
+	FreeBytes          int64     `json:"free_bytes"`            // Unused space in the file afterwards
+	Error              string    `json:"error,omitempty"`       // Why the run stopped early, if it did
+}
+
+// IntegrityOK reports whether integrity_check ran and found no problems
+func (r MaintenanceResult) IntegrityOK() bool {
+	return len(r.Integrity) == 1 && r.Integrity[0] == "ok"
+}
+
+// ClusterStatus describes this replica's part among the replicas sharing
+// the database
+type ClusterStatus struct {
+	Node           string     `json:"node"`                       // Identifier of this replica
+	Leader         bool       `json:"leader"`                     // Whether this replica is the leader
+	LeaderNode     string     `json:"leader_node,omitempty"`      // Identifier of the leader, if there is one
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"` // When the leader's lease runs out unless renewed
+}
+
+// QuotaUsage is what a tenant ingested against its quotas
+type QuotaUsage struct {
+	Tenant      string    `json:"tenant"`        // Tenant name
+	Day         string    `json:"day"`           // UTC day Files counts, YYYY-MM-DD
+	Files       int       `json:"files"`         // Files ingested that day
+	FilesPerDay int       `json:"files_per_day"` // Files the tenant may ingest per day (0 for no limit)
+	Rows        int       `json:"rows"`          // Stored vulnerability and component rows
+	MaxRows     int       `json:"max_rows"`      // Rows the tenant may store (0 for no limit)
+	ResetsAt    time.Time `json:"resets_at"`     // When the daily file count starts over
+}
+
+// SecretStatus describes a credential of an integration without its value
+type SecretStatus struct {
+	Name       string     `json:"name"`                  // Environment variable or configuration key of the secret
+	Configured bool       `json:"configured"`            // Whether a value was resolved
+	Source     string     `json:"source,omitempty"`      // Where the value came from: env, file, vault, or command
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"` // When the value was last resolved
+	Error      string     `json:"error,omitempty"`       // Why resolving the value failed, if it did
+}
+
+// SeverityOverride replaces the reported severity of matching findings with
+// the organization's own assessment
+type SeverityOverride struct {
+	ID         int64     `db:"id" json:"id"`                             // Row identifier
+	Org        string    `db:"org" json:"org,omitempty"`                 // GitHub organization whose repositories it applies to; all when empty
+	CVEID      string    `db:"cve_id" json:"cve_id,omitempty"`           // Vulnerability identifier it applies to; any when empty
+	RiskFactor string    `db:"risk_factor" json:"risk_factor,omitempty"` // Risk factor a finding must carry; any when empty
+	Severity   string    `db:"severity" json:"severity"`                 // Effective severity of matching findings
+	Reason     string    `db:"reason" json:"reason,omitempty"`           // Why the severity differs
+	CreatedBy  string    `db:"created_by" json:"created_by"`             // Caller that created it, from the X-Actor header
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`             // Time it was created
+}
+
+// CustomField is an admin-defined field that can be set on vulnerabilities
+// or scans
+
+type CustomField struct {
+	Name          string     `db:"name" json:"name"`                               // Field name, e.g. business_unit
+	Target        string     `db:"target" json:"target"`                           // What it is set on: vulnerability or scan
+	Type          string     `db:"type" json:"type"`                               // Type of its values: string, number, or boolean
+	Description   string     `db:"description" json:"description,omitempty"`       // What the field records
+	AllowedValues StringList `db:"allowed_values" json:"allowed_values,omitempty"` // Values a string field may take; any when empty
+	CreatedBy     string     `db:"created_by" json:"created_by"`                   // Caller that defined it, from the X-Actor header
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`                   // Time it was defined
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`                   // Time it was last redefined
+}
+
+// RepoAlias maps another URL of a repository to the canonical URL its scans
+// and findings are stored under
+type RepoAlias struct {
+	Alias     string    `db:"alias" json:"alias"`           // URL the repository is also known by
+	Repo      string    `db:"repo" json:"repo"`             // Canonical URL of the repository
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Time the alias was added
 }
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/secrets"
+)
+
+// slack posts messages to a Slack incoming webhook
+type slack struct {
+	url    string
+	client *http.Client
+}
+
+// newSlack creates a Slack channel
+func newSlack(cfg ChannelConfig, client *http.Client) (Channel, error) {
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("webhook_url is required")
+	}
+	return &slack{url: cfg.WebhookURL, client: client}, nil
+}
+
+// Send posts msg as a header and a markdown section, with plain text for
+// notifications
+func (s *slack) Send(ctx context.Context, msg Message) error {
+	title := strings.TrimSpace(severityEmoji[strings.ToUpper(msg.Severity)] + " " + msg.Title)
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"text": title,
+		"blocks": []map[string]interface{}{
+			{"type": "header", "text": map[string]string{"type": "plain_text", "text": title}},
+			{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": msg.Text}},
+		},
+	})
+}
+
+// severityEmoji prefixes Slack titles by severity
+var severityEmoji = map[string]string{
+	"CRITICAL": ":rotating_light:",
+	"HIGH":     ":warning:",
+}
+
+// teams posts messages to a Microsoft Teams incoming webhook
+type teams struct {
+	url    string
+	client *http.Client
+}
+
+// newTeams creates a Teams channel
+func newTeams(cfg ChannelConfig, client *http.Client) (Channel, error) {
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("webhook_url is required")
+	}
+	return &teams{url: cfg.WebhookURL, client: client}, nil
+}
+
+// Send posts msg as a MessageCard colored by severity
+func (t *teams) Send(ctx context.Context, msg Message) error {
+	color, ok := severityColor[strings.ToUpper(msg.Severity)]
+	if !ok {
+		color = "808080"
+	}
+	return postJSON(ctx, t.client, t.url, map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    msg.Title,
+		"themeColor": color,
+		"title":      msg.Title,
+		// Teams renders text as markdown, where single newlines are ignored
+		"text": strings.ReplaceAll(msg.Text, "\n", "\n\n"),
+	})
+}
+
+// severityColor is the Teams card accent color per severity
+var severityColor = map[string]string{
+	"CRITICAL": "B00020",
+	"HIGH":     "E65100",
+	"MEDIUM":   "F9A825",
+	"LOW":      "2E7D32",
+}
+
+// email sends messages, with their attachments, through an SMTP server
+type email struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+// newEmail creates an email channel
+func newEmail(cfg ChannelConfig, client *http.Client) (Channel, error) {
+	if cfg.SMTPAddr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("smtp_addr, from, and to are required")
+	}
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp_addr: %v", err)
+	}
+	e := &email{addr: cfg.SMTPAddr, from: cfg.From, to: cfg.To}
+	if cfg.Username != "" {
+		password := cfg.Password
+		if password == "" {
+			var err error
+			if password, err = secrets.Default.Resolve(context.Background(), "SMTP_PASSWORD", os.Getenv("SMTP_PASSWORD")); err != nil {
+				return nil, err
+			}
+		}
+		e.auth = smtp.PlainAuth("", cfg.Username, password, host)
+	}
+	return e, nil
+}
+
+// Send mails msg as a plain text body followed by its attachments
+func (e *email) Send(ctx context.Context, msg Message) error {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		e.from, strings.Join(e.to, ", "), mime.QEncoding.Encode("utf-8", msg.Title), time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	io.WriteString(part, strings.ReplaceAll(msg.Text, "\n", "\r\n")+"\r\n")
+
+	for _, a := range msg.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return err
+		}
+		// Base64 lines are limited to 76 characters
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	// net/smtp takes no context, so cancellation is only checked up front
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(e.addr, e.auth, e.from, e.to, buf.Bytes())
+}
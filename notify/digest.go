@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SendDigest sends each channel that receives digests a summary of scans
+// ingested since the given time and open findings in the latest scans,
+// limited to the channel's repositories, teams, and severity threshold
+func (n *Notifier) SendDigest(ctx context.Context, since time.Time) error {
+	var scans []struct {
+		Repo  string `db:"repo"`
+		Team  string `db:"team"`
+		Count int    `db:"count"`
+	}
+	err := n.DB.SelectContext(ctx, &scans, `SELECT COALESCE(s.repo, '') AS repo, COALESCE(r.team, '') AS team,
+		COUNT(*) AS count FROM scans s LEFT JOIN repositories r ON r.url = s.repo
+		WHERE s.scan_time >= ? GROUP BY s.repo`, since.UTC())
+	if err != nil {
+		return err
+	}
+	var open []struct {
+		Repo     string `db:"repo"`
+		Team     string `db:"team"`
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	err = n.DB.SelectContext(ctx, &open, `SELECT COALESCE(s.repo, '') AS repo, COALESCE(r.team, '') AS team,
+		UPPER(v.severity) AS severity, COUNT(*) AS count
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id LEFT JOIN repositories r ON r.url = s.repo
+		WHERE v.triage_status IN ('open', 'acknowledged')
+			AND s.id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)
+		GROUP BY s.repo, UPPER(v.severity)`)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range n.routes {
+		if !r.wants(KindDigest, "", "", "") {
+			continue
+		}
+
+		repos := map[string]*repoDigest{}
+		get := func(repo, team string) *repoDigest {
+			if repos[repo] == nil {
+				repos[repo] = &repoDigest{Repo: repo, Team: team, Open: map[string]int{}}
+			}
+			return repos[repo]
+		}
+		for _, s := range scans {
+			if r.wants(KindDigest, s.Repo, s.Team, "") {
+				get(s.Repo, s.Team).Scans += s.Count
+			}
+		}
+		top := ""
+		for _, o := range open {
+			if r.wants(KindDigest, o.Repo, o.Team, o.Severity) {
+				get(o.Repo, o.Team).Open[o.Severity] += o.Count
+				if severityRank[o.Severity] > severityRank[top] {
+					top = o.Severity
+				}
+			}
+		}
+
+		data := digestData{Since: since.UTC()}
+		for _, d := range repos {
+			data.Repos = append(data.Repos, *d)
+		}
+		sort.Slice(data.Repos, func(i, j int) bool { return data.Repos[i].Repo < data.Repos[j].Repo })
+
+		msg, err := render(KindDigest, data)
+		if err != nil {
+			return err
+		}
+		msg.Severity = strings.ToUpper(top)
+		if err := r.channel.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+// Package notify delivers templated alerts for ingest events, periodic
+// digests, and scheduled reports to chat channels such as Slack and
+// Microsoft Teams, and to email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/secrets"
+)
+
+// Message kinds, each rendered by its own template
+const (
+	KindVulnerability = "vulnerability" // New critical/high vulnerability in a repository
+	KindScanFailed    = "scan_failed"   // A scan file failed to ingest
+	KindDigest        = "digest"        // Periodic summary of open findings
+	KindReport        = "report"        // Scheduled delivery of a saved query's results
+
+	// Operational kinds, sent only to channels listing them in events
+	KindFetchFailures  = "fetch_failures"  // A repository's files failed to download several times in a row
+	KindScanStuck      = "scan_stuck"      // A bulk scan has been running longer than expected
+	KindDatabaseError  = "database_error"  // Ingest results could not be stored
+	KindUpstreamOutage = "upstream_outage" // An upstream host went down, or recovered
+)
+
+// operationalKinds are the message kinds channels must opt in to
+var operationalKinds = []string{KindFetchFailures, KindScanStuck, KindDatabaseError, KindUpstreamOutage}
+
+// Message is a rendered notification
+type Message struct {
+	Kind     string // Message kind
+	Title    string // One-line headline
+	Text     string // Body, possibly several lines
+	Severity string // Highest severity involved, used for styling; may be empty
+	Repo     string // Repository the message is about; empty for digests
+	Team     string // Registered owner of the repository, if any
+
+	Attachments []Attachment // Files sent along, by channels able to carry them
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name        string // File name, e.g. prod-critical.csv
+	ContentType string // MIME type
+	Data        []byte
+}
+
+// Channel delivers messages to one destination
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ChannelConfig configures one channel and which messages it receives
+type ChannelConfig struct {
+	Name        string   `json:"name"`                   // Name used in logs
+	Type        string   `json:"type"`                   // Registered channel type, e.g. slack or teams
+	WebhookURL  string   `json:"webhook_url"`            // Incoming webhook URL, or a secret reference to it
+	Repos       []string `json:"repos,omitempty"`        // Repositories to notify about; empty means all
+	Teams       []string `json:"teams,omitempty"`        // Owning teams, per the repository registry, to notify about; empty means all
+	MinSeverity string   `json:"min_severity,omitempty"` // Lowest severity notified about (default HIGH)
+	Events      []string `json:"events,omitempty"`       // Message kinds to send; empty means all
+
+	To       []string `json:"to,omitempty"`        // Email recipients
+	From     string   `json:"from,omitempty"`      // Email sender address
+	SMTPAddr string   `json:"smtp_addr,omitempty"` // SMTP server host:port
+	Username string   `json:"username,omitempty"`  // SMTP user; empty sends without authentication
+	Password string   `json:"password,omitempty"`  // SMTP password or a secret reference to it, defaulting to $SMTP_PASSWORD
+}
+
+// Config is the notification configuration file
+type Config struct {
+	Channels  []ChannelConfig           `json:"channels"`
+	Templates map[string]TemplateConfig `json:"templates,omitempty"` // Template overrides keyed by message kind
+}
+
+// TemplateConfig overrides the text/template sources of a message kind
+type TemplateConfig struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Factory creates a channel from its configuration
+type Factory func(cfg ChannelConfig, client *http.Client) (Channel, error)
+
+// factories holds the registered channel types
+var factories = map[string]Factory{
+	"slack": newSlack,
+	"teams": newTeams,
+	"email": newEmail,
+}
+
+// RegisterChannel makes a channel type available to configurations
+func RegisterChannel(typ string, f Factory) {
+	factories[strings.ToLower(typ)] = f
+}
+
+// severityRank orders severities for thresholds; unknown ranks lowest
+var severityRank = map[string]int{"CRITICAL": 4, "HIGH": 3, "MEDIUM": 2, "LOW": 1}
+
+// route is a configured channel and its filters
+type route struct {
+	ChannelConfig
+	channel Channel
+}
+
+// wants reports whether the route receives a message of kind about repo,
+// owned by team, at severity; an empty severity passes the threshold.
+// Operational messages only go to routes listing their kind.
+func (r route) wants(kind, repo, team, severity string) bool {
+	isKind := func(v string) bool { return strings.EqualFold(v, kind) }
+	if (len(r.Events) > 0 || slices.ContainsFunc(operationalKinds, isKind)) && !slices.ContainsFunc(r.Events, isKind) {
+		return false
+	}
+	if len(r.Repos) > 0 && repo != "" && !slices.ContainsFunc(r.Repos, func(v string) bool { return strings.EqualFold(v, repo) }) {
+		return false
+	}
+	if len(r.Teams) > 0 && repo != "" && !slices.ContainsFunc(r.Teams, func(v string) bool { return strings.EqualFold(v, team) }) {
+		return false
+	}
+	return severity == "" || severityRank[strings.ToUpper(severity)] >= severityRank[r.MinSeverity]
+}
+
+// Notifier routes ingest events and digests to configured channels
+type Notifier struct {
+	DB     *sqlx.DB // Database used to recognize new findings and build digests
+	routes []route
+}
+
+// New creates a notifier for the configured channels
+func New(cfg Config, db *sqlx.DB) (*Notifier, error) {
+	for kind, t := range cfg.Templates {
+		if err := SetTemplate(kind, t.Title, t.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	client := httpclient.New(10 * time.Second)
+	n := &Notifier{DB: db}
+	for _, c := range cfg.Channels {
+		f, ok := factories[strings.ToLower(c.Type)]
+		if !ok {
+			return nil, fmt.Errorf("notify: channel %q: unknown type %q", c.Name, c.Type)
+		}
+		if err := resolveSecrets(&c); err != nil {
+			return nil, fmt.Errorf("notify: channel %q: %v", c.Name, err)
+		}
+		ch, err := f(c, client)
+		if err != nil {
+			return nil, fmt.Errorf("notify: channel %q: %v", c.Name, err)
+		}
+		if c.MinSeverity = strings.ToUpper(c.MinSeverity); c.MinSeverity == "" {
+			c.MinSeverity = "HIGH"
+		}
+		if _, ok := severityRank[c.MinSeverity]; !ok {
+			return nil, fmt.Errorf("notify: channel %q: unknown min_severity %q", c.Name, c.MinSeverity)
+		}
+		n.routes = append(n.routes, route{ChannelConfig: c, channel: ch})
+	}
+	return n, nil
+}
+
+// resolveSecrets replaces the secret references of a channel's webhook URL
+// and password with their values
+func resolveSecrets(c *ChannelConfig) error {
+	for _, s := range []struct {
+		key   string
+		value *string
+	}{
+		{"webhook_url", &c.WebhookURL},
+		{"password", &c.Password},
+	} {
+		if *s.value == "" {
+			continue
+		}
+		value, err := secrets.Default.Resolve(context.Background(), "notify."+c.Name+"."+s.key, *s.value)
+		if err != nil {
+			return err
+		}
+		*s.value = value
+	}
+	return nil
+}
+
+// Load reads a JSON configuration file and creates a notifier
+func Load(path string, db *sqlx.DB) (*Notifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("notify: parse %s: %v", path, err)
+	}
+	return New(cfg, db)
+}
+
+// Start delivers vulnerability, scan failure, and operational events from
+// broker until ctx is cancelled
+func (n *Notifier) Start(ctx context.Context, broker *events.Broker) {
+	ch, cancel := broker.Subscribe(events.Filter{Types: []string{events.TypeVulnerability, events.TypeScanFailed,
+		events.TypeFetchFailures, events.TypeScanStuck, events.TypeDatabaseError, events.TypeUpstreamOutage}})
+
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-ch:
+				n.Handle(ctx, e)
+			}
+		}
+	}()
+}
+
+// Handle sends the notification for one event. Vulnerabilities are only
+// announced the first time they are ingested for a repository.
+func (n *Notifier) Handle(ctx context.Context, e events.Event) {
+	var (
+		kind string
+		data interface{}
+	)
+	switch e.Type {
+	case events.TypeVulnerability:
+		var v vulnerabilityData
+		if err := e.DecodeData(&v); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		if isNew, err := n.firstSighting(ctx, e.Repo, v.CVEID, v.PackageName); err != nil || !isNew {
+			if err != nil {
+				slog.Warn("notification lookup failed", "error", err)
+			}
+			return
+		}
+		v.Repo = e.Repo
+		v.Team, v.Contact = n.owner(ctx, e.Repo)
+		kind, data = KindVulnerability, v
+	case events.TypeScanFailed:
+		var f scanFailedData
+		if err := e.DecodeData(&f); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		f.Repo = e.Repo
+		f.Team, f.Contact = n.owner(ctx, e.Repo)
+		kind, data = KindScanFailed, f
+	case events.TypeFetchFailures:
+		var f fetchFailuresData
+		if err := e.DecodeData(&f); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		f.Repo = e.Repo
+		f.Team, f.Contact = n.owner(ctx, e.Repo)
+		kind, data = KindFetchFailures, f
+	case events.TypeDatabaseError:
+		var d databaseErrorData
+		if err := e.DecodeData(&d); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		d.Repo = e.Repo
+		d.Team, d.Contact = n.owner(ctx, e.Repo)
+		kind, data = KindDatabaseError, d
+	case events.TypeScanStuck:
+		var s scanStuckData
+		if err := e.DecodeData(&s); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		kind, data = KindScanStuck, s
+	case events.TypeUpstreamOutage:
+		var u upstreamOutageData
+		if err := e.DecodeData(&u); err != nil {
+			slog.Warn("notification payload invalid", "type", e.Type, "error", err)
+			return
+		}
+		kind, data = KindUpstreamOutage, u
+	default:
+		return
+	}
+
+	msg, err := render(kind, data)
+	if err != nil {
+		slog.Error("notification template failed", "kind", kind, "error", err)
+		return
+	}
+	msg.Severity, msg.Repo = e.Severity, e.Repo
+	msg.Team, _ = n.owner(ctx, e.Repo)
+	n.send(ctx, msg)
+}
+
+// send delivers msg to every route that wants it
+func (n *Notifier) send(ctx context.Context, msg Message) {
+	for _, r := range n.routes {
+		if !r.wants(msg.Kind, msg.Repo, msg.Team, msg.Severity) {
+			continue
+		}
+		if err := r.channel.Send(ctx, msg); err != nil {
+			slog.Warn("notification failed", "channel", r.Name, "kind", msg.Kind, "error", err)
+		}
+	}
+}
+
+// HasChannel reports whether a channel of the given name is configured
+func (n *Notifier) HasChannel(name string) bool {
+	for _, r := range n.routes {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SendReport renders a scheduled report and delivers it to the named
+// channels, regardless of their repository, team, and event filters
+func (n *Notifier) SendReport(ctx context.Context, channels []string, report Report) error {
+	msg, err := render(KindReport, report)
+	if err != nil {
+		return err
+	}
+	for _, sev := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if report.Counts[sev] > 0 {
+			msg.Severity = sev
+			break
+		}
+	}
+	if report.Attachment != nil {
+		msg.Attachments = []Attachment{*report.Attachment}
+	}
+
+	var errs []error
+	for _, name := range channels {
+		sent := false
+		for _, r := range n.routes {
+			if r.Name != name {
+				continue
+			}
+			sent = true
+			if err := r.channel.Send(ctx, msg); err != nil {
+				errs = append(errs, fmt.Errorf("channel %q: %v", name, err))
+			}
+		}
+		if !sent {
+			errs = append(errs, fmt.Errorf("unknown channel %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// owner returns the registered team and contact of a repository, empty
+// when it isn't registered
+func (n *Notifier) owner(ctx context.Context, repo string) (team, contact string) {
+	if n.DB == nil {
+		return "", ""
+	}
+	var o struct {
+		Team    string `db:"team"`
+		Contact string `db:"contact"`
+	}
+	err := n.DB.GetContext(ctx, &o, "SELECT team, contact FROM repositories WHERE url = ?", repo)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Warn("notification owner lookup failed", "repo", repo, "error", err)
+	}
+	return o.Team, o.Contact
+}
+
+// firstSighting reports whether a finding appears in only one stored row
+// for the repository, i.e. the scan that just published it
+func (n *Notifier) firstSighting(ctx context.Context, repo, cveID, pkg string) (bool, error) {
+	if n.DB == nil {
+		return true, nil
+	}
+	var count int
+	err := n.DB.GetContext(ctx, &count, `SELECT COUNT(*) FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE s.repo = ? AND v.cve_id = ? AND v.package_name = ?`, repo, cveID, pkg)
+	return count <= 1, err
+}
+
+// postJSON POSTs body as JSON to url
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// vulnerabilityData is the template data of a vulnerability message
+type vulnerabilityData struct {
+	Repo           string  `json:"-"`
+	Team           string  `json:"-"`
+	Contact        string  `json:"-"`
+	CVEID          string  `json:"id"`
+	Severity       string  `json:"severity"`
+	CVSS           float64 `json:"cvss"`
+	PackageName    string  `json:"package_name"`
+	CurrentVersion string  `json:"current_version"`
+	FixedVersion   string  `json:"fixed_version"`
+	Link           string  `json:"link"`
+}
+
+// scanFailedData is the template data of a scan failure message
+type scanFailedData struct {
+	Repo    string `json:"-"`
+	Team    string `json:"-"`
+	Contact string `json:"-"`
+	File    string `json:"file"`
+	Error   string `json:"error"`
+}
+
+// fetchFailuresData is the template data of a repeated fetch failures
+// message
+type fetchFailuresData struct {
+	Repo     string `json:"-"`
+	Team     string `json:"-"`
+	Contact  string `json:"-"`
+	Failures int    `json:"failures"`
+	File     string `json:"file"`
+	Error    string `json:"error"`
+}
+
+// scanStuckData is the template data of a stuck bulk scan message
+type scanStuckData struct {
+	Job       string    `json:"job"`
+	CreatedAt time.Time `json:"created_at"`
+	Running   string    `json:"running"`
+	Repos     int       `json:"repos"`
+	Done      int       `json:"done"`
+}
+
+// databaseErrorData is the template data of a database error message
+type databaseErrorData struct {
+	Repo    string `json:"-"`
+	Team    string `json:"-"`
+	Contact string `json:"-"`
+	File    string `json:"file"`
+	Error   string `json:"error"`
+}
+
+// upstreamOutageData is the template data of an upstream outage message
+type upstreamOutageData struct {
+	Host     string `json:"host"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+}
+
+// digestData is the template data of a digest message
+type digestData struct {
+	Since time.Time    // Start of the digest period
+	Repos []repoDigest // Repositories with scans or open findings
+}
+
+// repoDigest summarizes one repository for a digest
+type repoDigest struct {
+	Repo  string         // Repository URL
+	Team  string         // Registered owner, if any
+	Scans int            // Scans ingested during the period
+	Open  map[string]int // Open findings in the latest scans keyed by severity
+}
+
+// Report is the template data of a scheduled report message
+type Report struct {
+	Name        string         // Scheduled report name
+	Query       string         // Saved query it runs
+	Description string         // Saved query description
+	Total       int            // Matching findings
+	Counts      map[string]int // Matching findings keyed by severity
+	Link        string         // URL of the live results, if the server's public URL is known
+	Attachment  *Attachment    // Exported results
+}
+
+// ownerLine ends a message about a registered repository with its owner
+const ownerLine = `{{if .Team}}
+Owner: {{.Team}}{{with .Contact}} ({{.}}){{end}}{{end}}`
+
+// templates holds a title and body template per message kind
+var templates = map[string][2]*template.Template{
+	KindVulnerability: parse(KindVulnerability,
+		`New {{.Severity}} vulnerability in {{.Repo}}`,
+		`{{.CVEID}} in {{.PackageName}} {{.CurrentVersion}} (CVSS {{printf "%.1f" .CVSS}})`+
+			`{{if .FixedVersion}}, fixed in {{.FixedVersion}}{{else}}, no fix available{{end}}`+
+			`{{if .Link}}
+{{.Link}}{{end}}`+ownerLine),
+	KindScanFailed: parse(KindScanFailed,
+		`Scan failed for {{.Repo}}`,
+		`{{.File}}: {{.Error}}`+ownerLine),
+	KindFetchFailures: parse(KindFetchFailures,
+		`Repeated fetch failures for {{.Repo}}`,
+		`{{.Failures}} files in a row failed to download. Last: {{.File}}: {{.Error}}`+ownerLine),
+	KindScanStuck: parse(KindScanStuck,
+		`Bulk scan {{.Job}} is stuck`,
+		`Running for {{.Running}} since {{.CreatedAt.Format "2006-01-02 15:04 MST"}}, {{.Done}} of {{.Repos}} repositories done`),
+	KindDatabaseError: parse(KindDatabaseError,
+		`Database error storing a scan of {{.Repo}}`,
+		`{{.File}}: {{.Error}}`+ownerLine),
+	KindUpstreamOutage: parse(KindUpstreamOutage,
+		`{{if eq .State "closed"}}Upstream {{.Host}} recovered{{else}}Upstream {{.Host}} is down{{end}}`,
+		`{{if eq .State "closed"}}Requests to {{.Host}} succeed again.`+
+			`{{else}}{{.Failures}} requests to {{.Host}} failed in a row; further requests fail fast until it recovers.{{end}}`),
+	KindDigest: parse(KindDigest,
+		`Vulnerability digest since {{.Since.Format "2006-01-02 15:04 MST"}}`,
+		`{{range .Repos}}{{.Repo}}: {{.Scans}} scan(s), open findings: {{counts .Open}}
+{{else}}No scans or open findings.{{end}}`),
+	KindReport: parse(KindReport,
+		`Scheduled report {{.Name}}: {{.Total}} finding(s)`,
+		`{{with .Description}}{{.}}
+{{end}}Saved query {{.Query}}: {{counts .Counts}}`+
+			`{{with .Attachment}}
+Attached: {{.Name}}{{end}}{{with .Link}}
+{{.}}{{end}}`),
+}
+
+// parse compiles the title and body templates of a message kind
+func parse(kind, title, body string) [2]*template.Template {
+	funcs := template.FuncMap{"counts": formatCounts}
+	return [2]*template.Template{
+		template.Must(template.New(kind + ".title").Funcs(funcs).Parse(title)),
+		template.Must(template.New(kind + ".body").Funcs(funcs).Parse(body)),
+	}
+}
+
+// SetTemplate replaces the title and body templates of a message kind.
+// Templates receive the same data as the built-in ones.
+func SetTemplate(kind, title, body string) (err error) {
+	if _, ok := templates[kind]; !ok {
+		return fmt.Errorf("notify: unknown message kind %q", kind)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("notify: %v", p)
+		}
+	}()
+	templates[kind] = parse(kind, title, body)
+	return nil
+}
+
+// render executes the templates of kind with data
+func render(kind string, data interface{}) (Message, error) {
+	tmpl, ok := templates[kind]
+	if !ok {
+		return Message{}, fmt.Errorf("no template for %q", kind)
+	}
+	var title, body bytes.Buffer
+	if err := tmpl[0].Execute(&title, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl[1].Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Kind: kind, Title: title.String(), Text: strings.TrimSpace(body.String())}, nil
+}
+
+// formatCounts lists severity counts from most to least severe
+func formatCounts(counts map[string]int) string {
+	var parts []string
+	for _, sev := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if counts[sev] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[sev], sev))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,49 @@
+package nvd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Enrich fetches NVD metadata for stored CVEs that have none, or whose
+// record is older than ttl. CVEs unknown to NVD are recorded with empty
+// metadata so they are not fetched again until the record expires.
+// It returns the number of records stored.
+func (c *Client) Enrich(ctx context.Context, db *sqlx.DB, ttl time.Duration) (int, error) {
+	var ids []string
+	err := db.SelectContext(ctx, &ids, `SELECT DISTINCT v.cve_id FROM vulnerabilities v
+		LEFT JOIN cve_metadata m ON m.cve_id = v.cve_id
+		WHERE v.cve_id LIKE 'CVE-%' AND (m.cve_id IS NULL OR m.fetched_at < ?)
+		ORDER BY v.cve_id`, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	for _, id := range ids {
+		m, err := c.Fetch(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			m = &models.CVEMetadata{CVEID: id, FetchedAt: time.Now().UTC()}
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return stored, ctx.Err()
+			}
+			slog.Warn("NVD fetch failed", "cve", id, "error", err)
+			continue
+		}
+
+		if err := storage.UpsertCVEMetadata(ctx, db, *m); err != nil {
+			return stored, fmt.Errorf("store %s: %v", id, err)
+		}
+		stored++
+	}
+	return stored, nil
+}
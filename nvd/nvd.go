@@ -0,0 +1,170 @@
+// Package nvd enriches stored CVEs with data from the NVD CVE API 2.0.
+package nvd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// DefaultBaseURL is the public NVD API endpoint
+const DefaultBaseURL = "https://services.nvd.nist.gov"
+
+// ErrNotFound is returned when NVD has no record for a CVE
+var ErrNotFound = errors.New("nvd: CVE not found")
+
+// Client queries the NVD CVE API
+type Client struct {
+	BaseURL string        // API root, e.g. https://services.nvd.nist.gov
+	APIKey  string        // Optional API key, raising the rate limit
+	HTTP    *http.Client  // Underlying HTTP client
+	Limiter *rate.Limiter // Throttles outgoing requests
+}
+
+// NewClient creates a client rate limited to NVD's published quotas:
+// 5 requests per 30 seconds without an API key, 50 with one
+func NewClient(baseURL, apiKey string) *Client {
+	every := 6 * time.Second
+	if apiKey != "" {
+		every = 600 * time.Millisecond
+	}
+	return &Client{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		HTTP:    httpclient.New(30 * time.Second),
+		Limiter: rate.NewLimiter(rate.Every(every), 1),
+	}
+}
+
+// DefaultClient is used by the enrichment job
+var DefaultClient = NewClient(DefaultBaseURL, "")
+
+// cveResponse is the subset of an NVD API 2.0 response we use
+type cveResponse struct {
+	TotalResults    int `json:"totalResults"`
+	Vulnerabilities []struct {
+		CVE struct {
+			ID           string `json:"id"`
+			LastModified string `json:"lastModified"`
+			Descriptions []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Metrics struct {
+				V31 []cvssMetric `json:"cvssMetricV31"`
+				V30 []cvssMetric `json:"cvssMetricV30"`
+			} `json:"metrics"`
+			Weaknesses []struct {
+				Description []struct {
+					Value string `json:"value"`
+				} `json:"description"`
+			} `json:"weaknesses"`
+			References []struct {
+				URL string `json:"url"`
+			} `json:"references"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// cvssMetric is one CVSS v3 score in an NVD record
+type cvssMetric struct {
+	Type     string `json:"type"` // Primary or Secondary
+	CVSSData struct {
+		VectorString string  `json:"vectorString"`
+		BaseScore    float64 `json:"baseScore"`
+	} `json:"cvssData"`
+}
+
+// Fetch returns NVD metadata for a CVE
+func (c *Client) Fetch(ctx context.Context, cveID string) (*models.CVEMetadata, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("nvd: rate limit wait: %v", err)
+		}
+	}
+
+	endpoint := c.BaseURL + "/rest/json/cves/2.0?cveId=" + url.QueryEscape(cveID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("apiKey", c.APIKey)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("nvd: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("nvd: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var body cveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("nvd: decode response: %v", err)
+	}
+	if len(body.Vulnerabilities) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cve := body.Vulnerabilities[0].CVE
+	m := &models.CVEMetadata{CVEID: cveID, FetchedAt: time.Now().UTC()}
+	for _, d := range cve.Descriptions {
+		if d.Lang == "en" {
+			m.Description = d.Value
+			break
+		}
+	}
+	if metric, ok := primaryMetric(append(cve.Metrics.V31, cve.Metrics.V30...)); ok {
+		m.CVSSVector = metric.CVSSData.VectorString
+		m.CVSSScore = metric.CVSSData.BaseScore
+	}
+	seen := make(map[string]bool)
+	for _, w := range cve.Weaknesses {
+		for _, d := range w.Description {
+			if strings.HasPrefix(d.Value, "CWE-") && !seen[d.Value] {
+				seen[d.Value] = true
+				m.CWEIDs = append(m.CWEIDs, d.Value)
+			}
+		}
+	}
+	for _, r := range cve.References {
+		m.References = append(m.References, r.URL)
+	}
+	// NVD timestamps carry no zone and are UTC
+	if t, err := time.Parse("2006-01-02T15:04:05", cve.LastModified); err == nil {
+		m.LastModified = t
+	}
+	return m, nil
+}
+
+// primaryMetric prefers the NVD-assigned primary score over secondary ones
+func primaryMetric(metrics []cvssMetric) (cvssMetric, bool) {
+	for _, m := range metrics {
+		if m.Type == "Primary" {
+			return m, true
+		}
+	}
+	if len(metrics) > 0 {
+		return metrics[0], true
+	}
+	return cvssMetric{}, false
+}
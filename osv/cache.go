@@ -0,0 +1,63 @@
+package osv
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached response and its expiry
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache is an in-memory TTL cache of OSV responses
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+// NewCache creates a cache whose entries expire after ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// Get returns the cached value for key, if present and unexpired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key
+func (c *Cache) Set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// Purge drops every entry, forcing fresh lookups (used by the refresh job)
+func (c *Cache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
@@ -0,0 +1,113 @@
+package osv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// findingKey identifies a finding within one scan
+type findingKey struct {
+	cve, pkg, version string
+}
+
+// Materialize looks up the components and stores any findings for scanID
+// that are not already recorded. It returns the number of rows inserted.
+func (c *Client) Materialize(ctx context.Context, db *sqlx.DB, scanID int64, components []models.Component) (int, error) {
+	findings, err := c.Correlate(ctx, components)
+	if err != nil {
+		return 0, err
+	}
+
+	unlock, err := storage.LockWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := StoreFindings(ctx, tx, scanID, findings)
+	if err != nil {
+		return 0, err
+	}
+	return inserted, tx.Commit()
+}
+
+// StoreFindings stores the findings for scanID in tx, skipping any already
+// recorded, and returns the number of rows inserted
+func StoreFindings(ctx context.Context, tx *sqlx.Tx, scanID int64, findings []models.Vulnerability) (int, error) {
+	var existing []struct {
+		CVEID   string `db:"cve_id"`
+		Package string `db:"package_name"`
+		Version string `db:"current_version"`
+	}
+	err := tx.SelectContext(ctx, &existing,
+		"SELECT cve_id, package_name, current_version FROM vulnerabilities WHERE scan_id = ?", scanID)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[findingKey]bool, len(existing))
+	for _, e := range existing {
+		seen[findingKey{e.CVEID, e.Package, e.Version}] = true
+	}
+
+	inserted := 0
+	for _, f := range findings {
+		key := findingKey{f.CVEID, f.PackageName, f.CurrentVersion}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := storage.InsertVulnerability(ctx, tx, scanID, f); err != nil {
+			return 0, fmt.Errorf("insert finding: %v", err)
+		}
+		inserted++
+	}
+	return inserted, nil
+}
+
+// Refresh re-checks the components of the latest scan of every repository
+// file against fresh OSV data, storing newly published findings
+func (c *Client) Refresh(ctx context.Context, db *sqlx.DB) (int, error) {
+	c.Cache.Purge()
+
+	var rows []struct {
+		ScanID int64 `db:"scan_id"`
+		models.Component
+	}
+	err := db.SelectContext(ctx, &rows, `SELECT c.scan_id, c.name, c.version, c.ecosystem, c.purl, c.type
+		FROM components c
+		WHERE c.scan_id IN (SELECT MAX(id) FROM scans GROUP BY repo, file_path)
+		ORDER BY c.scan_id`)
+	if err != nil {
+		return 0, err
+	}
+
+	byScan := make(map[int64][]models.Component)
+	var order []int64
+	for _, r := range rows {
+		if _, ok := byScan[r.ScanID]; !ok {
+			order = append(order, r.ScanID)
+		}
+		byScan[r.ScanID] = append(byScan[r.ScanID], r.Component)
+	}
+
+	total := 0
+	for _, scanID := range order {
+		n, err := c.Materialize(ctx, db, scanID, byScan[scanID])
+		if err != nil {
+			return total, fmt.Errorf("scan %d: %v", scanID, err)
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,294 @@
+// Package osv queries the OSV.dev vulnerability database for known
+// vulnerabilities affecting specific package versions.
+package osv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/models"
+	"golang.org/x/time/rate"
+)
+
+// DefaultBaseURL is the public OSV API
+const DefaultBaseURL = "https://api.osv.dev"
+
+// maxBatchSize is the OSV querybatch limit per request
+const maxBatchSize = 1000
+
+// Client queries an OSV API. Limiter and Cache are optional.
+type Client struct {
+	BaseURL string        // API root, e.g. https://api.osv.dev
+	HTTP    *http.Client  // Underlying HTTP client
+	Limiter *rate.Limiter // Throttles outgoing requests
+	Cache   *Cache        // Caches batch results and vulnerability records
+}
+
+// DefaultClient is used by the ingest pipeline and refresh job
+var DefaultClient = &Client{
+	BaseURL: DefaultBaseURL,
+	HTTP:    httpclient.New(30 * time.Second),
+	Limiter: rate.NewLimiter(rate.Limit(10), 10),
+	Cache:   NewCache(6 * time.Hour),
+}
+
+// Query identifies a package version to look up
+type Query struct {
+	Package struct {
+		Name      string `json:"name,omitempty"`
+		Ecosystem string `json:"ecosystem,omitempty"`
+		PURL      string `json:"purl,omitempty"`
+	} `json:"package"`
+	Version string `json:"version,omitempty"`
+}
+
+// Vuln is an OSV vulnerability record (subset)
+type Vuln struct {
+	ID        string    `json:"id"`
+	Summary   string    `json:"summary"`
+	Details   string    `json:"details"`
+	Aliases   []string  `json:"aliases"`
+	Published time.Time `json:"published"`
+	Modified  time.Time `json:"modified"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced string `json:"introduced,omitempty"`
+				Fixed      string `json:"fixed,omitempty"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	References []struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	} `json:"references"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// QueryForComponent builds the lookup query for a component
+func QueryForComponent(c models.Component) Query {
+	var q Query
+	if c.PURL != "" && strings.Contains(c.PURL, "@") {
+		q.Package.PURL = c.PURL
+		return q
+	}
+	q.Package.Name = c.Name
+	q.Package.Ecosystem = c.Ecosystem
+	q.Package.PURL = c.PURL
+	q.Version = c.Version
+	return q
+}
+
+// QueryBatch returns the IDs of vulnerabilities affecting each query, in
+// order. Cached answers are reused; only uncached queries are sent.
+func (c *Client) QueryBatch(ctx context.Context, queries []Query) ([][]string, error) {
+	ids := make([][]string, len(queries))
+	keys := make([]string, len(queries))
+	var pending []int // Indexes of queries that must be sent
+	for i, q := range queries {
+		key, _ := json.Marshal(q)
+		keys[i] = "query:" + string(key)
+		if cached, ok := c.Cache.Get(keys[i]); ok {
+			ids[i] = cached.([]string)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(pending))
+		batch := make([]Query, 0, end-start)
+		for _, i := range pending[start:end] {
+			batch = append(batch, queries[i])
+		}
+
+		var resp struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+			} `json:"results"`
+		}
+		body := map[string]interface{}{"queries": batch}
+		if err := c.post(ctx, "/v1/querybatch", body, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != len(batch) {
+			return nil, fmt.Errorf("osv: expected %d results, got %d", len(batch), len(resp.Results))
+		}
+		for j, r := range resp.Results {
+			list := []string{}
+			for _, v := range r.Vulns {
+				list = append(list, v.ID)
+			}
+			i := pending[start+j]
+			ids[i] = list
+			c.Cache.Set(keys[i], list)
+		}
+	}
+	return ids, nil
+}
+
+// GetVuln fetches the full record of a vulnerability
+func (c *Client) GetVuln(ctx context.Context, id string) (*Vuln, error) {
+	if cached, ok := c.Cache.Get("vuln:" + id); ok {
+		return cached.(*Vuln), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/v1/vulns/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	var v Vuln
+	if err := c.do(req, &v); err != nil {
+		return nil, err
+	}
+	c.Cache.Set("vuln:"+id, &v)
+	return &v, nil
+}
+
+// post sends a JSON body and decodes the JSON response
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+// do executes a request and decodes a 200 response into out
+func (c *Client) do(req *http.Request, out interface{}) error {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(req.Context()); err != nil {
+			return fmt.Errorf("osv: rate limit wait: %v", err)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return errs.Errorf(errs.ErrFetch, "osv: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		kind := errs.ErrFetch
+		if resp.StatusCode == http.StatusTooManyRequests {
+			kind = errs.ErrUpstreamRateLimited
+		}
+		err := errs.Errorf(kind, "osv: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		if d, ok := httpclient.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return errs.WithRetryAfter(err, d)
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ToVulnerability maps an OSV record to a finding for the given component
+func ToVulnerability(v *Vuln, c models.Component) models.Vulnerability {
+	out := models.Vulnerability{
+		CVEID:          v.ID,
+		Severity:       strings.ToUpper(v.DatabaseSpecific.Severity),
+		Status:         "affected",
+		PackageName:    c.Name,
+		CurrentVersion: c.Version,
+		Ecosystem:      c.Ecosystem,
+		PURL:           c.PURL,
+		Description:    v.Summary,
+		PublishedDate:  v.Published,
+		Link:           "https://osv.dev/vulnerability/" + v.ID,
+		RiskFactors:    models.RiskFactors{},
+	}
+
+	// Prefer the CVE alias so findings line up with other scanners
+	for _, alias := range v.Aliases {
+		if strings.HasPrefix(alias, "CVE-") {
+			out.CVEID = alias
+			break
+		}
+	}
+	if out.Description == "" {
+		out.Description = v.Details
+	}
+	if out.Severity == "MODERATE" {
+		out.Severity = "MEDIUM"
+	}
+	if out.Severity == "" {
+		out.Severity = "UNKNOWN"
+	}
+
+	// Take the first fixed event for the matching package
+	for _, a := range v.Affected {
+		if a.Package.Name != "" && !strings.EqualFold(a.Package.Name, c.Name) {
+			continue
+		}
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed != "" && out.FixedVersion == "" {
+					out.FixedVersion = e.Fixed
+				}
+			}
+		}
+	}
+	if out.FixedVersion != "" {
+		out.Status = "fixed"
+	}
+	return out
+}
+
+// Correlate looks up every component and returns the findings that affect them
+func (c *Client) Correlate(ctx context.Context, components []models.Component) ([]models.Vulnerability, error) {
+	if len(components) == 0 {
+		return nil, nil
+	}
+
+	queries := make([]Query, len(components))
+	for i, comp := range components {
+		queries[i] = QueryForComponent(comp)
+	}
+	ids, err := c.QueryBatch(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make(map[string]*Vuln)
+	var findings []models.Vulnerability
+	for i, list := range ids {
+		for _, id := range list {
+			v, ok := details[id]
+			if !ok {
+				if v, err = c.GetVuln(ctx, id); err != nil {
+					return nil, err
+				}
+				details[id] = v
+			}
+			findings = append(findings, ToVulnerability(v, components[i]))
+		}
+	}
+	return findings, nil
+}
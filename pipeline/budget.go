@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrTooLarge is the error of content larger than a whole budget
+var ErrTooLarge = errors.New("content exceeds the ingest memory limit")
+
+// Budget bounds the bytes of report content that ingests hold in memory at
+// a time. Ingests wait for room rather than exceed it, so many large
+// reports arriving at once queue up instead of exhausting memory. It is
+// safe for concurrent use.
+type Budget struct {
+	mu      sync.Mutex
+	limit   int64         // Bytes allowed at a time; 0 for no limit
+	used    int64         // Bytes taken
+	waiting int           // Acquires waiting for room
+	freed   chan struct{} // Closed, and replaced, whenever bytes are released
+}
+
+// NewBudget returns a budget of limit bytes, or one that never waits when
+// limit is 0
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit, freed: make(chan struct{})}
+}
+
+// Acquire takes n bytes, waiting until they fit. It fails with ErrTooLarge
+// when n is more than the whole budget, and with the context's error when
+// the context ends first.
+func (b *Budget) Acquire(ctx context.Context, n int64) error {
+	if b.limit > 0 && n > b.limit {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, n, b.limit)
+	}
+	b.mu.Lock()
+	for b.limit > 0 && b.used+n > b.limit {
+		freed := b.freed
+		b.waiting++
+		b.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.waiting--
+			b.mu.Unlock()
+			return ctx.Err()
+		}
+		b.mu.Lock()
+		b.waiting--
+	}
+	b.used += n
+	b.mu.Unlock()
+	return nil
+}
+
+// Release returns n bytes taken by Acquire
+func (b *Budget) Release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// Stats returns the bytes taken and the acquires waiting for room
+func (b *Budget) Stats() (used int64, waiting int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used, b.waiting
+}
+
+// Hold is the room one ingest's content takes in a budget: taken before the
+// content is fetched, and fitted to it once it has been
+type Hold struct {
+	b *Budget
+	n int64 // Bytes taken
+}
+
+// Hold returns a hold of no bytes in the budget
+func (b *Budget) Hold() *Hold {
+	return &Hold{b: b}
+}
+
+// Fit grows or shrinks the hold to n bytes. To grow, it waits for room
+// with nothing held, so that holds waiting to grow never block one another.
+// Like Acquire, it fails with ErrTooLarge or the context's error, then
+// holding nothing.
+func (h *Hold) Fit(ctx context.Context, n int64) error {
+	switch {
+	case n > h.n:
+		h.Release()
+		if err := h.b.Acquire(ctx, n); err != nil {
+			return err
+		}
+	case n < h.n:
+		h.b.Release(h.n - n)
+	}
+	h.n = n
+	return nil
+}
+
+// Release returns the bytes held
+func (h *Hold) Release() {
+	if h.n > 0 {
+		h.b.Release(h.n)
+		h.n = 0
+	}
+}
+
+// holdKey is the context key of the hold content is fetched under
+type holdKey struct{}
+
+// WithHold returns ctx fetching content under h
+func WithHold(ctx context.Context, h *Hold) context.Context {
+	return context.WithValue(ctx, holdKey{}, h)
+}
+
+// Reader returns r for reading content of size bytes, or -1 when unknown,
+// under the hold ctx fetches with, if any. It first fits the hold to size,
+// or to the whole budget when the size is unknown, so the content has room
+// before it is read; reading more than that fails with ErrTooLarge.
+func Reader(ctx context.Context, r io.Reader, size int64) (io.Reader, error) {
+	h, _ := ctx.Value(holdKey{}).(*Hold)
+	if h == nil || (h.b.limit == 0 && size < 0) {
+		return r, nil
+	}
+	if size < 0 {
+		size = h.b.limit
+	}
+	if err := h.Fit(ctx, size); err != nil {
+		return nil, err
+	}
+	return &heldReader{r: r, left: size}, nil
+}
+
+// heldReader reads up to the bytes held for it
+type heldReader struct {
+	r    io.Reader
+	left int64 // Bytes left to read
+}
+
+// Read implements io.Reader, failing with ErrTooLarge once more bytes than
+// held are available
+func (r *heldReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		// Anything past the held bytes makes the content too large
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
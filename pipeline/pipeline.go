@@ -0,0 +1,138 @@
+// Package pipeline runs the ingest of a scan report as a sequence of stages
+// (fetch, decode, normalize, enrich, persist), each a list of steps.
+// Extensions hook in by adding steps to a stage or by wrapping every stage
+// with middleware, without changing the code that drives the ingest.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Stages, in the order they run
+const (
+	Fetch     = "fetch"     // Obtain the report's content
+	Decode    = "decode"    // Detect the format and convert the content into scan results
+	Normalize = "normalize" // Clean up the scan results
+	Enrich    = "enrich"    // Add findings and details from other sources
+	Persist   = "persist"   // Store the scan results
+)
+
+// Stages lists every stage in the order it runs
+var Stages = []string{Fetch, Decode, Normalize, Enrich, Persist}
+
+// Ingest is one report passing through the pipeline. Each stage fills in
+// the fields the following ones read.
+type Ingest struct {
+	Repo    string            // Repository the findings belong to
+	File    string            // File path or image reference the scans are stored under
+	Labels  map[string]string // Labels attached to every stored scan
+	Lenient bool              // Skip malformed vulnerability entries instead of failing
+
+	// Source obtains the content during the fetch stage; nil when Content
+	// is given up front
+	Source func(ctx context.Context) ([]byte, error)
+
+	Content  []byte              // Raw report, after fetch
+	Format   string              // Detected report format, after decode
+	Results  []models.ScanResult // Scan results, after decode
+	Warnings []formats.Warning   // Entries skipped by lenient decoding
+	ScanIDs  []int64             // Row IDs of the stored scans, after persist
+}
+
+// Step performs part of a stage on an ingest. An error ends the ingest.
+type Step func(ctx context.Context, in *Ingest) error
+
+// Middleware wraps each stage, e.g. to time it or to act once it is done.
+// It receives the stage's name and the steps to run, as one Step.
+type Middleware func(stage string, next Step) Step
+
+// StageError is the error of the stage that ended an ingest
+type StageError struct {
+	Stage string // Stage that failed
+	Err   error  // Error of the failing step
+}
+
+// Error returns the step's message
+func (e *StageError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the step's error
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Pipeline holds the steps of each stage and the middleware wrapping them.
+// It is safe for concurrent use; steps added while ingests run apply to
+// later ingests.
+type Pipeline struct {
+	mu         sync.RWMutex
+	steps      map[string][]Step
+	middleware []Middleware
+}
+
+// New returns a pipeline without steps
+func New() *Pipeline {
+	return &Pipeline{steps: make(map[string][]Step)}
+}
+
+// Add appends steps to a stage; a stage runs its steps in the order added.
+// It panics on an unknown stage, as registration happens at startup.
+func (p *Pipeline) Add(stage string, steps ...Step) {
+	if !slices.Contains(Stages, stage) {
+		panic(fmt.Sprintf("pipeline: unknown stage %q", stage))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps[stage] = append(p.steps[stage], steps...)
+}
+
+// Use adds middleware around every stage. Middleware added first is
+// outermost.
+func (p *Pipeline) Use(mw ...Middleware) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.middleware = append(p.middleware, mw...)
+}
+
+// Run passes the ingest through the given stages, or all of them when none
+// are given, in pipeline order. The first failing stage ends the ingest
+// with a *StageError.
+func (p *Pipeline) Run(ctx context.Context, in *Ingest, stages ...string) error {
+	p.mu.RLock()
+	steps := make(map[string][]Step, len(p.steps))
+	for stage, list := range p.steps {
+		steps[stage] = slices.Clone(list)
+	}
+	middleware := slices.Clone(p.middleware)
+	p.mu.RUnlock()
+
+	for _, stage := range Stages {
+		if len(stages) > 0 && !slices.Contains(stages, stage) {
+			continue
+		}
+		run := sequence(steps[stage])
+		for i := len(middleware) - 1; i >= 0; i-- {
+			run = middleware[i](stage, run)
+		}
+		if err := run(ctx, in); err != nil {
+			return &StageError{Stage: stage, Err: err}
+		}
+	}
+	return nil
+}
+
+// sequence returns a step running the steps in order, stopping at the
+// first error
+func sequence(steps []Step) Step {
+	return func(ctx context.Context, in *Ingest) error {
+		for _, step := range steps {
+			if err := step(ctx, in); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
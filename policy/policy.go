@@ -0,0 +1,144 @@
+// Package policy evaluates findings against pass/fail rules, e.g. to gate
+// CI pipelines on the results of a scan.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/license"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Rule limits the number of findings matching its conditions
+type Rule = api.PolicyRule
+
+// Policy is a named set of rules
+type Policy = api.Policy
+
+// Result is the outcome of evaluating a policy
+type Result = api.PolicyResult
+
+// Violation describes a failed rule
+type Violation = api.PolicyViolation
+
+// Default fails on any critical finding, more than five high findings, or
+// any finding listed in the KEV catalog
+var Default = Policy{
+	Name: "default",
+	Rules: []Rule{
+		{Name: "no-critical", Severities: []string{"CRITICAL"}, Max: 0},
+		{Name: "max-5-high", Severities: []string{"HIGH"}, Max: 5},
+		{Name: "no-kev", KEV: true, Max: 0},
+	},
+}
+
+// Policies holds the configured policies by name
+var Policies = map[string]Policy{Default.Name: Default}
+
+// Load reads a JSON file of the form {"policies": [...]} and returns the
+// policies by name, including Default unless the file redefines it
+func Load(path string) (map[string]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Policies []Policy `json:"policies"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("policy: parse %s: %v", path, err)
+	}
+
+	policies := map[string]Policy{Default.Name: Default}
+	for _, p := range file.Policies {
+		if err := Validate(p); err != nil {
+			return nil, err
+		}
+		policies[p.Name] = p
+	}
+	return policies, nil
+}
+
+// Validate checks that a policy is well formed
+func Validate(p Policy) error {
+	if p.Name == "" {
+		return errors.New("policy: name is required")
+	}
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("policy %s: at least one rule is required", p.Name)
+	}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("policy %s: rule %d: name is required", p.Name, i+1)
+		}
+		if r.Max < 0 {
+			return fmt.Errorf("policy %s: rule %s: max must not be negative", p.Name, r.Name)
+		}
+		if r.EPSSMin < 0 || r.EPSSMin > 1 {
+			return fmt.Errorf("policy %s: rule %s: epss_min must be between 0 and 1", p.Name, r.Name)
+		}
+		for _, l := range r.Licenses {
+			if strings.TrimSpace(l) == "" {
+				return fmt.Errorf("policy %s: rule %s: licenses must not be empty", p.Name, r.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a finding meets every condition of the rule. The
+// finding's effective severity, after overrides, is used when it has one.
+func Matches(r Rule, v models.Vulnerability) bool {
+	severity := v.Severity
+	if v.EffectiveSeverity != "" {
+		severity = v.EffectiveSeverity
+	}
+	if len(r.Severities) > 0 && !slices.ContainsFunc(r.Severities, func(v string) bool { return strings.EqualFold(v, severity) }) {
+		return false
+	}
+	if r.MinCVSS > 0 && v.CVSS < r.MinCVSS {
+		return false
+	}
+	if r.EPSSMin > 0 && (v.EPSS == nil || *v.EPSS < r.EPSSMin) {
+		return false
+	}
+	if r.KEV && !v.KEV {
+		return false
+	}
+	if r.Fixable && strings.TrimSpace(v.FixedVersion) == "" {
+		return false
+	}
+	if len(r.Licenses) > 0 {
+		id, ok := strings.CutPrefix(v.CVEID, license.IDPrefix)
+		if !ok || !license.MatchAny(r.Licenses, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate applies every rule of the policy to the findings
+func Evaluate(p Policy, findings []models.Vulnerability) Result {
+	res := Result{Policy: p.Name, Passed: true, Findings: len(findings), Violations: []Violation{}}
+	for _, r := range p.Rules {
+		matched := []models.Vulnerability{}
+		for _, v := range findings {
+			if Matches(r, v) {
+				matched = append(matched, v)
+			}
+		}
+		if len(matched) > r.Max {
+			res.Passed = false
+			res.Violations = append(res.Violations, Violation{
+				Rule: r.Name, Count: len(matched), Max: r.Max, Findings: matched,
+			})
+		}
+	}
+	return res
+}
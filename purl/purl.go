@@ -0,0 +1,251 @@
+// Package purl builds, parses, and normalizes package URLs
+// (https://github.com/package-url/purl-spec) so findings for the same
+// component match across scanners.
+package purl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// purlEcosystems maps package URL types to OSV ecosystem names
+var purlEcosystems = map[string]string{
+	"npm":      "npm",
+	"pypi":     "PyPI",
+	"golang":   "Go",
+	"maven":    "Maven",
+	"gem":      "RubyGems",
+	"cargo":    "crates.io",
+	"nuget":    "NuGet",
+	"composer": "Packagist",
+	"hex":      "Hex",
+	"pub":      "Pub",
+	"deb":      "Debian",
+	"apk":      "Alpine",
+	"alpine":   "Alpine",
+	"rpm":      "Red Hat",
+}
+
+// ecosystemTypes maps OSV ecosystem names (lowercased) to a package URL
+// type and, for distributions, a namespace
+var ecosystemTypes = map[string][2]string{
+	"npm":       {"npm", ""},
+	"pypi":      {"pypi", ""},
+	"go":        {"golang", ""},
+	"maven":     {"maven", ""},
+	"rubygems":  {"gem", ""},
+	"crates.io": {"cargo", ""},
+	"nuget":     {"nuget", ""},
+	"packagist": {"composer", ""},
+	"hex":       {"hex", ""},
+	"pub":       {"pub", ""},
+	"debian":    {"deb", "debian"},
+	"ubuntu":    {"deb", "ubuntu"},
+	"alpine":    {"apk", "alpine"},
+	"red hat":   {"rpm", "redhat"},
+	"rocky":     {"rpm", "rocky"},
+	"almalinux": {"rpm", "almalinux"},
+	"suse":      {"rpm", "suse"},
+}
+
+// Package classes of Class
+const (
+	ClassOS          = "os"          // Installed by an operating system's package manager, e.g. in a container base image
+	ClassApplication = "application" // An application's dependency from a language package manager
+)
+
+// osTypes are the package URL types of operating system packages
+var osTypes = map[string]bool{
+	"deb":    true,
+	"apk":    true,
+	"alpine": true,
+	"rpm":    true,
+	"alpm":   true,
+	"ebuild": true,
+}
+
+// Class returns ClassOS or ClassApplication for a package URL by its type,
+// or "" for generic and unparsable ones
+func Class(purl string) string {
+	typ, _, _ := strings.Cut(strings.TrimPrefix(purl, "pkg:"), "/")
+	typ = strings.ToLower(typ)
+	switch {
+	case !strings.HasPrefix(purl, "pkg:") || typ == "" || typ == "generic":
+		return ""
+	case osTypes[typ]:
+		return ClassOS
+	}
+	return ClassApplication
+}
+
+// Ecosystem returns the OSV ecosystem for a package URL, or ""
+func Ecosystem(purl string) string {
+	if !strings.HasPrefix(purl, "pkg:") {
+		return ""
+	}
+	rest := strings.TrimPrefix(purl, "pkg:")
+	typ, _, _ := strings.Cut(rest, "/")
+	eco := purlEcosystems[strings.ToLower(typ)]
+
+	// Distro ecosystems are qualified by namespace (pkg:deb/ubuntu/...)
+	if eco == "Debian" {
+		if ns := purlNamespace(rest); strings.EqualFold(ns, "ubuntu") {
+			return "Ubuntu"
+		}
+	}
+	return eco
+}
+
+// Name returns the package name (with namespace where the ecosystem
+// expects it, e.g. Go module paths and npm scopes)
+func Name(purl string) string {
+	rest := strings.TrimPrefix(purl, "pkg:")
+	rest, _, _ = strings.Cut(rest, "?")
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "@")
+	typ, path, _ := strings.Cut(rest, "/")
+	path, _ = url.PathUnescape(path)
+
+	switch strings.ToLower(typ) {
+	case "golang", "npm":
+		return path
+	case "maven":
+		return strings.Replace(path, "/", ":", 1)
+	}
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// Build returns the normalized package URL of a package version. Unknown
+// ecosystems produce a pkg:generic URL so every package has one.
+func Build(ecosystem, name, version string) string {
+	typ, namespace := "generic", ""
+	if t, ok := ecosystemTypes[strings.ToLower(ecosystem)]; ok {
+		typ, namespace = t[0], t[1]
+	}
+
+	name = strings.TrimSpace(name)
+	switch typ {
+	case "golang":
+		// Module paths split into namespace and final element
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+	case "npm":
+		if scope, n, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+			namespace, name = scope, n
+		}
+	case "maven":
+		if group, artifact, ok := strings.Cut(name, ":"); ok {
+			namespace, name = group, artifact
+		}
+	case "composer":
+		if vendor, n, ok := strings.Cut(name, "/"); ok {
+			namespace, name = vendor, n
+		}
+	}
+	return format(typ, namespace, name, strings.TrimSpace(version))
+}
+
+// Normalize returns the canonical form of a package URL: lowercase type,
+// ecosystem-specific name normalization, and no qualifiers or subpath, so
+// that the same package version reported by different scanners compares
+// equal. Strings that are not package URLs are returned unchanged.
+func Normalize(purl string) string {
+	if !strings.HasPrefix(purl, "pkg:") {
+		return purl
+	}
+	rest := strings.TrimPrefix(purl, "pkg:")
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "?")
+
+	var version string
+	if i := strings.LastIndex(rest, "@"); i > strings.Index(rest, "/") {
+		rest, version = rest[:i], rest[i+1:]
+		version, _ = url.PathUnescape(version)
+	}
+
+	typ, path, _ := strings.Cut(rest, "/")
+	typ = strings.ToLower(typ)
+	var namespace, name string
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		namespace, name = path[:i], path[i+1:]
+	} else {
+		name = path
+	}
+	namespace, _ = url.PathUnescape(namespace)
+	name, _ = url.PathUnescape(name)
+	if typ == "alpine" {
+		typ = "apk"
+	}
+	return format(typ, namespace, name, version)
+}
+
+// Unversioned returns the normalized form of a package URL without its
+// version, naming the package rather than one release of it
+func Unversioned(purl string) string {
+	p := Normalize(purl)
+	if i := strings.LastIndex(p, "@"); strings.HasPrefix(p, "pkg:") && i > strings.Index(p, "/") {
+		return p[:i]
+	}
+	return p
+}
+
+// format assembles a package URL, applying per-type case rules and
+// percent-encoding each component. Go module paths are case-sensitive and
+// kept as-is.
+func format(typ, namespace, name, version string) string {
+	switch typ {
+	case "npm", "deb", "apk", "rpm", "gem", "cargo", "hex", "pub", "composer", "nuget", "generic":
+		namespace, name = strings.ToLower(namespace), strings.ToLower(name)
+	case "pypi":
+		// PEP 503: names compare case-insensitively with runs of -_. equivalent
+		name = strings.ToLower(name)
+		name = strings.NewReplacer("_", "-", ".", "-").Replace(name)
+	}
+
+	var b strings.Builder
+	b.WriteString("pkg:")
+	b.WriteString(typ)
+	b.WriteByte('/')
+	if namespace != "" {
+		for _, seg := range strings.Split(namespace, "/") {
+			b.WriteString(escape(seg))
+			b.WriteByte('/')
+		}
+	}
+	b.WriteString(escape(name))
+	if version != "" {
+		b.WriteByte('@')
+		b.WriteString(escape(version))
+	}
+	return b.String()
+}
+
+// escape percent-encodes everything but the purl-safe characters
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// purlNamespace returns the first path segment after the type
+func purlNamespace(rest string) string {
+	_, path, _ := strings.Cut(rest, "/")
+	ns, _, found := strings.Cut(path, "/")
+	if !found {
+		return ""
+	}
+	return ns
+}
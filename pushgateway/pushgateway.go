@@ -0,0 +1,126 @@
+// Package pushgateway pushes a summary metric set after each scan to a
+// Prometheus Pushgateway, grouped by repository and ref, so CI pipelines
+// can alert on regressions without querying the API.
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// Severities are the severities a summary always has a count of, so alerts
+// see zero rather than an absent series
+var Severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// Summary is the outcome of one scan of a repository
+type Summary struct {
+	Repo       string         // Repository scanned
+	Ref        string         // Branch, tag, or commit scanned; empty for image scans
+	Status     string         // Outcome: completed, partial, or failed
+	BySeverity map[string]int // Open findings of the repository after the scan, by severity
+	Succeeded  int            // Files ingested
+	Failed     int            // Files that failed
+	Skipped    int            // Files unchanged or excluded
+	Time       time.Time      // When the scan finished
+}
+
+// Client pushes summaries to a Pushgateway
+type Client struct {
+	URL  string       // Pushgateway base URL, e.g. http://pushgateway:9091
+	Job  string       // Value of the job grouping label
+	HTTP *http.Client // Client the pushes are sent with
+}
+
+// New creates a client for the Pushgateway at baseURL, pushing under job
+func New(baseURL, job string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("pushgateway: invalid url %q", baseURL)
+	}
+	if job == "" {
+		return nil, fmt.Errorf("pushgateway: job is required")
+	}
+	return &Client{URL: strings.TrimSuffix(baseURL, "/"), Job: job, HTTP: httpclient.New(10 * time.Second)}, nil
+}
+
+// Push replaces the metrics of the summary's repository and ref group with
+// the summary's
+func (c *Client) Push(ctx context.Context, s Summary) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.groupURL(s.Repo, s.Ref), bytes.NewReader(Format(s)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway: HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// groupURL returns the URL of the job's group for a repository and ref.
+// Label values are base64url encoded, since repository URLs and refs can
+// hold slashes; the Pushgateway takes "=" for an empty value.
+func (c *Client) groupURL(repo, ref string) string {
+	path := "/metrics/job/" + url.PathEscape(c.Job)
+	for _, l := range [][2]string{{"repo", repo}, {"ref", ref}} {
+		value := base64.RawURLEncoding.EncodeToString([]byte(l[1]))
+		if value == "" {
+			value = "="
+		}
+		path += "/" + l[0] + "@base64/" + value
+	}
+	return c.URL + path
+}
+
+// Format returns a summary in the Prometheus text exposition format
+func Format(s Summary) []byte {
+	var b bytes.Buffer
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("vulnscan_scan_open_findings", "gauge", "Open findings of the repository after the scan, by severity")
+	counts := map[string]int{}
+	for severity, n := range s.BySeverity {
+		severity = strings.ToUpper(severity)
+		if !slices.Contains(Severities, severity) {
+			severity = "UNKNOWN"
+		}
+		counts[severity] += n
+	}
+	for _, severity := range Severities {
+		fmt.Fprintf(&b, "vulnscan_scan_open_findings{severity=%q} %d\n", severity, counts[severity])
+	}
+
+	metric("vulnscan_scan_files", "gauge", "Files of the scan, by outcome")
+	fmt.Fprintf(&b, "vulnscan_scan_files{outcome=\"succeeded\"} %d\n", s.Succeeded)
+	fmt.Fprintf(&b, "vulnscan_scan_files{outcome=\"failed\"} %d\n", s.Failed)
+	fmt.Fprintf(&b, "vulnscan_scan_files{outcome=\"skipped\"} %d\n", s.Skipped)
+
+	metric("vulnscan_scan_completed", "gauge", "Whether every file of the scan was ingested or skipped (1) or some failed (0)")
+	completed := 0
+	if s.Status == "completed" {
+		completed = 1
+	}
+	fmt.Fprintf(&b, "vulnscan_scan_completed %d\n", completed)
+
+	metric("vulnscan_scan_timestamp_seconds", "gauge", "When the scan finished, in Unix seconds")
+	fmt.Fprintf(&b, "vulnscan_scan_timestamp_seconds %d\n", s.Time.Unix())
+	return b.Bytes()
+}
@@ -0,0 +1,254 @@
+// Package quota limits how much each tenant of a shared instance may
+// ingest, so that one busy team can't exhaust it: the report files it
+// ingests per UTC day and the vulnerability and component rows it keeps
+// stored. Tenants are told apart by the API keys their requests carry.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/secrets"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// DefaultTenant is the tenant of requests without a known API key
+const DefaultTenant = "default"
+
+// Limits are the quotas of a tenant; 0 means no limit
+type Limits struct {
+	FilesPerDay int `json:"files_per_day"` // Report files ingested per UTC day
+	MaxRows     int `json:"max_rows"`      // Stored vulnerability and component rows
+}
+
+// TenantConfig configures a tenant
+type TenantConfig struct {
+	Name    string   `json:"name"`     // Tenant name, stored with its scans
+	APIKeys []string `json:"api_keys"` // Secret references of the tenant's API keys
+	Limits
+}
+
+// Config is the JSON quota configuration file
+type Config struct {
+	Default Limits         `json:"default"` // Limits of requests without a known API key
+	Tenants []TenantConfig `json:"tenants"`
+}
+
+// Quotas enforces the limits of each tenant
+type Quotas struct {
+	DB *sqlx.DB
+
+	tenants map[string]string // Tenant names keyed by API key
+	limits  map[string]Limits // Limits keyed by tenant name
+	names   []string          // Tenant names, in configuration order
+}
+
+// Default enforces the quotas of the service; nil when none are configured
+var Default *Quotas
+
+// New creates quotas for the configured tenants, resolving their API keys
+func New(cfg Config, db *sqlx.DB) (*Quotas, error) {
+	q := &Quotas{
+		DB:      db,
+		tenants: map[string]string{},
+		limits:  map[string]Limits{DefaultTenant: cfg.Default},
+		names:   []string{DefaultTenant},
+	}
+	if err := validLimits(cfg.Default); err != nil {
+		return nil, fmt.Errorf("quota: default: %v", err)
+	}
+	for _, t := range cfg.Tenants {
+		if t.Name == "" || strings.TrimSpace(t.Name) != t.Name {
+			return nil, fmt.Errorf("quota: invalid tenant name %q", t.Name)
+		}
+		if _, ok := q.limits[t.Name]; ok {
+			return nil, fmt.Errorf("quota: tenant %q configured twice", t.Name)
+		}
+		if err := validLimits(t.Limits); err != nil {
+			return nil, fmt.Errorf("quota: tenant %q: %v", t.Name, err)
+		}
+		if len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("quota: tenant %q has no api_keys", t.Name)
+		}
+		for i, ref := range t.APIKeys {
+			key, err := secrets.Default.Resolve(context.Background(), fmt.Sprintf("quota.%s.api_keys.%d", t.Name, i), ref)
+			if err != nil {
+				return nil, fmt.Errorf("quota: tenant %q: %v", t.Name, err)
+			}
+			if key == "" {
+				return nil, fmt.Errorf("quota: tenant %q: empty API key", t.Name)
+			}
+			if other, ok := q.tenants[key]; ok {
+				return nil, fmt.Errorf("quota: tenants %q and %q share an API key", other, t.Name)
+			}
+			q.tenants[key] = t.Name
+		}
+		q.limits[t.Name] = t.Limits
+		q.names = append(q.names, t.Name)
+	}
+	return q, nil
+}
+
+// validLimits checks that limits are not negative
+func validLimits(l Limits) error {
+	if l.FilesPerDay < 0 || l.MaxRows < 0 {
+		return fmt.Errorf("limits must be 0 or more, got files_per_day %d and max_rows %d", l.FilesPerDay, l.MaxRows)
+	}
+	return nil
+}
+
+// Load reads a JSON configuration file and creates quotas
+func Load(path string, db *sqlx.DB) (*Quotas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("quota: parse %s: %v", path, err)
+	}
+	return New(cfg, db)
+}
+
+// Tenant returns the tenant of a request's API key, given as a bearer
+// token or in the X-API-Key header, or DefaultTenant without a known one.
+// It returns "" when q is nil.
+func (q *Quotas) Tenant(r *http.Request) string {
+	if q == nil {
+		return ""
+	}
+	if tenant, ok := q.tenants[APIKey(r)]; ok {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// APIKey returns the API key of a request, given in the X-API-Key header
+// or as a bearer token, or "" without one
+func APIKey(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return key
+}
+
+// Tenants returns the configured tenant names, DefaultTenant first
+func (q *Quotas) Tenants() []string {
+	return append([]string(nil), q.names...)
+}
+
+// Usage returns what tenant ingested today against its limits
+func (q *Quotas) Usage(ctx context.Context, tenant string) (models.QuotaUsage, error) {
+	day, resets := today()
+	limits := q.limits[tenant]
+	usage := models.QuotaUsage{Tenant: tenant, Day: day, FilesPerDay: limits.FilesPerDay, MaxRows: limits.MaxRows, ResetsAt: resets}
+	var err error
+	if usage.Files, err = storage.QuotaFiles(ctx, q.DB, tenant, day); err != nil {
+		return usage, err
+	}
+	usage.Rows, err = storage.TenantRows(ctx, q.DB, tenant)
+	return usage, err
+}
+
+// Check returns an error in errs.ErrQuotaExceeded when tenant can't ingest
+// that many more files today, with the wait until the count starts over, or
+// has no rows left to store them in. It checks nothing when q is nil or
+// tenant is "", e.g. for background jobs.
+func (q *Quotas) Check(ctx context.Context, tenant string, files int) error {
+	if q == nil || tenant == "" {
+		return nil
+	}
+	usage, err := q.Usage(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	if usage.FilesPerDay > 0 && usage.Files+files > usage.FilesPerDay {
+		return errs.WithRetryAfter(errs.Errorf(errs.ErrQuotaExceeded,
+			"quota exceeded: tenant %s ingested %d of %d files today; %d more requested",
+			tenant, usage.Files, usage.FilesPerDay, files), time.Until(usage.ResetsAt))
+	}
+	return q.checkRows(usage)
+}
+
+// Reserve counts one file against tenant's daily quota before it is
+// ingested. Like Check, it fails in errs.ErrQuotaExceeded when the daily
+// quota or the stored rows are used up. The returned release takes the file
+// back, from the day it was counted on, for a file that turns out to have
+// nothing to ingest. It reserves nothing when q is nil or tenant is "".
+func (q *Quotas) Reserve(ctx context.Context, tenant string) (release func(context.Context) error, err error) {
+	release = func(context.Context) error { return nil }
+	if q == nil || tenant == "" {
+		return release, nil
+	}
+	usage, err := q.Usage(ctx, tenant)
+	if err != nil {
+		return release, err
+	}
+	if err := q.checkRows(usage); err != nil {
+		return release, err
+	}
+	counted, err := storage.CountQuotaFile(ctx, q.DB, tenant, usage.Day, usage.FilesPerDay)
+	if err != nil {
+		return release, err
+	}
+	if !counted {
+		return release, errs.WithRetryAfter(errs.Errorf(errs.ErrQuotaExceeded,
+			"quota exceeded: tenant %s used all %d of its files for today", tenant, usage.FilesPerDay), time.Until(usage.ResetsAt))
+	}
+	return func(ctx context.Context) error {
+		return storage.UncountQuotaFile(ctx, q.DB, tenant, usage.Day)
+	}, nil
+}
+
+// checkRows fails when the tenant stores its maximum rows. Only deleting
+// data frees them, so the error has no retry hint.
+func (q *Quotas) checkRows(usage models.QuotaUsage) error {
+	if usage.MaxRows > 0 && usage.Rows >= usage.MaxRows {
+		return errs.Errorf(errs.ErrQuotaExceeded,
+			"quota exceeded: tenant %s stores %d of %d rows; delete old scans to free some", usage.Tenant, usage.Rows, usage.MaxRows)
+	}
+	return nil
+}
+
+// today returns the current UTC day and when it ends
+func today() (string, time.Time) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format(time.DateOnly), start.AddDate(0, 0, 1)
+}
+
+// tenantKey is the context key of the tenant a request counts against
+type tenantKey struct{}
+
+// WithTenant returns ctx counting ingests against tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant ingests under ctx count against, or
+// "" when quotas are not enforced
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Middleware attributes each request to the tenant of its API key under
+// Default
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if Default != nil {
+			r = r.WithContext(WithTenant(r.Context(), Default.Tenant(r)))
+		}
+		next(w, r)
+	}
+}
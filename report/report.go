@@ -0,0 +1,136 @@
+// Package report renders self-contained HTML vulnerability reports for a
+// repository, suitable for sharing with people without API access.
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Severities lists the severities shown in reports, most severe first
+var Severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// Report is the data shown in a repository report
+type Report struct {
+	Repo        string                 // Repository URL
+	Owner       *models.Repository     // Registration of the repository, if any
+	GeneratedAt time.Time              // Time the report was generated
+	LastScan    time.Time              // Time of the most recent scan
+	Files       int                    // Scan files included
+	BySeverity  map[string]int         // Findings keyed by severity (see Severities)
+	ByTriage    map[string]int         // Findings keyed by triage status
+	KEV         int                    // Findings listed in the CISA KEV catalog
+	Fixable     int                    // Findings with a fixed version
+	Trend       []TrendPoint           // Findings per day over the last 90 days, oldest first
+	Findings    []models.Vulnerability // Findings of the latest scans, most severe first
+}
+
+// TrendPoint is the number of findings in the latest scans as of one day
+type TrendPoint = api.TrendPoint
+
+// Total returns the number of findings
+func (r *Report) Total() int {
+	return len(r.Findings)
+}
+
+// Bar is one stacked segment of the trend chart
+type Bar struct {
+	X, Y, Width, Height float64
+	Severity            string
+	Count               int
+	Label               string
+}
+
+// Chart geometry, in SVG user units
+const (
+	chartWidth  = 720.0
+	chartHeight = 180.0
+	maxBarWidth = 40.0
+)
+
+// Chart lays out the trend as stacked bars, one column per day
+func (r *Report) Chart() []Bar {
+	if len(r.Trend) == 0 {
+		return nil
+	}
+	peak := 1
+	for _, p := range r.Trend {
+		peak = max(peak, p.Total)
+	}
+
+	slot := chartWidth / float64(len(r.Trend))
+	width := min(maxBarWidth, slot*0.7)
+	var bars []Bar
+	for i, p := range r.Trend {
+		x := float64(i)*slot + (slot-width)/2
+		y := chartHeight
+		for j := len(Severities) - 1; j >= 0; j-- {
+			n := p.BySeverity[Severities[j]]
+			if n == 0 {
+				continue
+			}
+			h := float64(n) / float64(peak) * chartHeight
+			y -= h
+			bars = append(bars, Bar{
+				X: x, Y: y, Width: width, Height: h, Severity: Severities[j], Count: n,
+				Label: fmt.Sprintf("%s: %d %s", p.Date.Format("2006-01-02"), n, Severities[j]),
+			})
+		}
+	}
+	return bars
+}
+
+// ChartLabels returns the x-axis labels: first, middle, and last day
+func (r *Report) ChartLabels() []Bar {
+	n := len(r.Trend)
+	if n == 0 {
+		return nil
+	}
+	slot := chartWidth / float64(n)
+	var labels []Bar
+	for _, i := range uniqueInts(0, n/2, n-1) {
+		labels = append(labels, Bar{X: float64(i)*slot + slot/2, Label: r.Trend[i].Date.Format("Jan 2")})
+	}
+	return labels
+}
+
+//go:embed report.html
+var reportHTML string
+
+// tmpl is the parsed report template
+var tmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower":      strings.ToLower,
+	"deref":      func(f *float64) float64 { return *f },
+	"severities": func() []string { return Severities },
+	"pct": func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	},
+}).Parse(reportHTML))
+
+// Render writes the report as an HTML document
+func Render(w io.Writer, r *Report) error {
+	return tmpl.Execute(w, r)
+}
+
+// uniqueInts returns the distinct values in order of first appearance
+func uniqueInts(values ...int) []int {
+	seen := map[int]bool{}
+	var out []int
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
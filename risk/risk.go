@@ -0,0 +1,67 @@
+// Package risk computes a composite 0-100 risk score from a repository's
+// open findings
+package risk
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Weights controls how findings contribute to a score. Each finding is worth
+// its severity weight, scaled up by its EPSS probability, KEV listing, and
+// age; the summed points map onto 0-100 so that Scale points score 63.
+type Weights struct {
+	Severity map[string]float64 // Base points per severity; others get Unknown
+	Unknown  float64            // Base points for unrecognized severities
+	EPSS     float64            // Extra multiple at EPSS 1.0, scaled linearly
+	KEV      float64            // Extra multiple for CISA KEV-listed findings
+	Age      float64            // Extra multiple at MaxAge, scaled linearly
+	MaxAge   time.Duration      // Age at which the age multiple stops growing
+	Scale    float64            // Points at which the score reaches 1-1/e (~63)
+}
+
+// Default is the weighting used by the score endpoints
+var Default = Weights{
+	Severity: map[string]float64{"CRITICAL": 10, "HIGH": 5, "MEDIUM": 2, "LOW": 0.5},
+	Unknown:  0.5,
+	EPSS:     2,
+	KEV:      1,
+	Age:      1,
+	MaxAge:   365 * 24 * time.Hour,
+	Scale:    50,
+}
+
+// Finding is the part of an open finding that affects risk
+type Finding struct {
+	Severity  string
+	EPSS      float64   // Exploit probability (0-1), 0 when unknown
+	KEV       bool      // Listed in the CISA KEV catalog
+	FirstSeen time.Time // First time the finding was reported
+}
+
+// Points returns the weighted contribution of one finding as of now
+func (w Weights) Points(f Finding, now time.Time) float64 {
+	base, ok := w.Severity[strings.ToUpper(f.Severity)]
+	if !ok {
+		base = w.Unknown
+	}
+	mult := 1 + w.EPSS*math.Min(math.Max(f.EPSS, 0), 1)
+	if f.KEV {
+		mult += w.KEV
+	}
+	if w.MaxAge > 0 && !f.FirstSeen.IsZero() {
+		age := math.Min(math.Max(float64(now.Sub(f.FirstSeen)), 0), float64(w.MaxAge))
+		mult += w.Age * age / float64(w.MaxAge)
+	}
+	return base * mult
+}
+
+// Score maps summed points onto 0-100. It grows quickly for the first few
+// serious findings and saturates rather than growing without bound.
+func (w Weights) Score(points float64) float64 {
+	if points <= 0 || w.Scale <= 0 {
+		return 0
+	}
+	return math.Round(1000*(1-math.Exp(-points/w.Scale))) / 10
+}
@@ -0,0 +1,109 @@
+package sarif
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Export builds a SARIF log with one rule per vulnerability ID and one result
+// per finding, suitable for upload to GitHub code scanning
+func Export(vulns []models.Vulnerability, toolVersion string) Log {
+	driver := Driver{
+		Name:           "vulnscan",
+		Version:        toolVersion,
+		InformationURI: "https://github.com/Chinzzii/vulnscan",
+	}
+
+	ruleIndex := make(map[string]int)
+	results := make([]Result, 0, len(vulns))
+	for _, v := range vulns {
+		idx, ok := ruleIndex[v.CVEID]
+		if !ok {
+			idx = len(driver.Rules)
+			ruleIndex[v.CVEID] = idx
+			driver.Rules = append(driver.Rules, ruleFor(v))
+		}
+		i := idx
+
+		results = append(results, Result{
+			RuleID:    v.CVEID,
+			RuleIndex: &i,
+			Level:     levelFromSeverity(v.Severity),
+			Message: Message{Text: strings.TrimSpace(v.PackageName + " " + v.CurrentVersion +
+				" is affected by " + v.CVEID + fixedSuffix(v))},
+			Locations: []Location{{
+				PhysicalLocation: &PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: v.PackageName}},
+				LogicalLocations: []LogicalLocation{{Name: v.PackageName, Kind: "package"}},
+			}},
+			PartialFingerprints: map[string]string{
+				"vulnscan/v1": v.CVEID + ":" + v.PackageName + ":" + v.CurrentVersion,
+			},
+			Properties: &Properties{
+				PackageName:      v.PackageName,
+				InstalledVersion: v.CurrentVersion,
+				FixedVersion:     v.FixedVersion,
+			},
+		})
+	}
+
+	return Log{
+		Version: Version,
+		Schema:  Schema,
+		Runs:    []Run{{Tool: Tool{Driver: driver}, Results: results}},
+	}
+}
+
+// ruleFor builds the rule describing a vulnerability ID
+func ruleFor(v models.Vulnerability) Rule {
+	score := v.CVSS
+	if score == 0 {
+		score = scoreFromSeverity(v.Severity)
+	}
+	return Rule{
+		ID:               v.CVEID,
+		Name:             v.CVEID,
+		ShortDescription: &Message{Text: v.CVEID + " in " + v.PackageName},
+		FullDescription:  &Message{Text: v.Description},
+		HelpURI:          v.Link,
+		Properties: &Properties{
+			SecuritySeverity: strconv.FormatFloat(score, 'f', 1, 64),
+			Tags:             append([]string{"security"}, v.RiskFactors...),
+		},
+	}
+}
+
+// fixedSuffix describes the fixed version, if any
+func fixedSuffix(v models.Vulnerability) string {
+	if v.FixedVersion == "" {
+		return ""
+	}
+	return " (fixed in " + v.FixedVersion + ")"
+}
+
+// levelFromSeverity maps a severity name to a SARIF result level
+func levelFromSeverity(severity string) string {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL", "HIGH":
+		return "error"
+	case "MEDIUM":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// scoreFromSeverity provides a representative score when CVSS is missing
+func scoreFromSeverity(severity string) float64 {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL":
+		return 9.5
+	case "HIGH":
+		return 8.0
+	case "MEDIUM":
+		return 5.5
+	default:
+		return 2.0
+	}
+}
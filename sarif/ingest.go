@@ -0,0 +1,195 @@
+package sarif
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+func init() {
+	formats.Register(Adapter{})
+}
+
+// Adapter is the formats.Adapter for SARIF logs
+type Adapter struct{}
+
+// Name identifies the format
+func (Adapter) Name() string { return "sarif" }
+
+// Detect matches objects declaring SARIF 2.1.0 with runs
+func (Adapter) Detect(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return len(trimmed) > 0 && trimmed[0] == '{' &&
+		bytes.Contains(trimmed, []byte(`"runs"`)) &&
+		(bytes.Contains(trimmed, []byte(`"2.1.0"`)) || bytes.Contains(trimmed, []byte("sarif")))
+}
+
+// Parse converts each SARIF run into a scan result
+func (Adapter) Parse(content []byte) ([]models.ScanResult, error) {
+	var log Log
+	if err := json.Unmarshal(content, &log); err != nil {
+		return nil, err
+	}
+	if log.Version != Version {
+		return nil, fmt.Errorf("unsupported SARIF version %q", log.Version)
+	}
+
+	results := make([]models.ScanResult, 0, len(log.Runs))
+	for i, run := range log.Runs {
+		results = append(results, convertRun(run, i))
+	}
+	return results, nil
+}
+
+// convertRun maps one SARIF run to a scan result
+func convertRun(run Run, index int) models.ScanResult {
+	driver := run.Tool.Driver
+	sr := models.ScanResult{
+		ScanID:       fmt.Sprintf("sarif:%s:%d", driver.Name, index),
+		ScanStatus:   "completed",
+		ResourceType: "sarif",
+		ResourceName: driver.Name,
+		Timestamp:    time.Now().UTC(),
+	}
+	if run.AutomationDetails != nil && run.AutomationDetails.ID != "" {
+		sr.ScanID = "sarif:" + run.AutomationDetails.ID
+	}
+	if len(run.Invocations) > 0 {
+		inv := run.Invocations[0]
+		if t, err := time.Parse(time.RFC3339, inv.EndTimeUTC); err == nil {
+			sr.Timestamp = t.UTC()
+		}
+		if !inv.ExecutionSuccessful {
+			sr.ScanStatus = "failed"
+		}
+	}
+
+	rules := make(map[string]Rule, len(driver.Rules))
+	for _, rule := range driver.Rules {
+		rules[rule.ID] = rule
+	}
+
+	for _, res := range run.Results {
+		rule := rules[res.RuleID]
+		if res.RuleIndex != nil && *res.RuleIndex >= 0 && *res.RuleIndex < len(driver.Rules) && res.RuleID == "" {
+			rule = driver.Rules[*res.RuleIndex]
+		}
+		sr.Vulnerabilities = append(sr.Vulnerabilities, convertResult(res, rule))
+	}
+	return sr
+}
+
+// convertResult maps one SARIF result (and its rule) to a vulnerability
+func convertResult(res Result, rule Rule) models.Vulnerability {
+	v := models.Vulnerability{
+		CVEID:       res.RuleID,
+		Status:      "affected",
+		Description: res.Message.Text,
+		Link:        rule.HelpURI,
+		RiskFactors: models.RiskFactors{},
+	}
+	if v.CVEID == "" {
+		v.CVEID = rule.ID
+	}
+	if v.Description == "" && rule.FullDescription != nil {
+		v.Description = rule.FullDescription.Text
+	}
+
+	props := rule.Properties
+	if res.Properties != nil {
+		props = mergeProperties(props, res.Properties)
+	}
+	if props != nil {
+		v.RiskFactors = append(v.RiskFactors, props.Tags...)
+		v.PackageName = props.PackageName
+		v.CurrentVersion = props.InstalledVersion
+		v.FixedVersion = props.FixedVersion
+		if score, err := strconv.ParseFloat(props.SecuritySeverity, 64); err == nil {
+			v.CVSS = score
+		}
+	}
+	if v.PackageName == "" {
+		v.PackageName = locationName(res.Locations)
+	}
+	if v.FixedVersion != "" {
+		v.Status = "fixed"
+	}
+
+	if v.CVSS > 0 {
+		v.Severity = SeverityFromScore(v.CVSS)
+	} else {
+		v.Severity = severityFromLevel(res.Level)
+	}
+	return v
+}
+
+// mergeProperties overlays result-level properties on rule-level ones
+func mergeProperties(rule, result *Properties) *Properties {
+	merged := Properties{}
+	if rule != nil {
+		merged = *rule
+	}
+	if result.SecuritySeverity != "" {
+		merged.SecuritySeverity = result.SecuritySeverity
+	}
+	if len(result.Tags) > 0 {
+		merged.Tags = result.Tags
+	}
+	if result.PackageName != "" {
+		merged.PackageName = result.PackageName
+	}
+	if result.InstalledVersion != "" {
+		merged.InstalledVersion = result.InstalledVersion
+	}
+	if result.FixedVersion != "" {
+		merged.FixedVersion = result.FixedVersion
+	}
+	return &merged
+}
+
+// locationName returns the first logical or physical location name
+func locationName(locations []Location) string {
+	for _, loc := range locations {
+		for _, l := range loc.LogicalLocations {
+			if l.Name != "" {
+				return l.Name
+			}
+		}
+		if loc.PhysicalLocation != nil && loc.PhysicalLocation.ArtifactLocation.URI != "" {
+			return loc.PhysicalLocation.ArtifactLocation.URI
+		}
+	}
+	return ""
+}
+
+// SeverityFromScore maps a 0–10 security-severity score to a severity name
+// using GitHub code scanning's thresholds
+func SeverityFromScore(score float64) string {
+	switch {
+	case score >= 9.0:
+		return "CRITICAL"
+	case score >= 7.0:
+		return "HIGH"
+	case score >= 4.0:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
+
+// severityFromLevel maps a SARIF result level to a severity name
+func severityFromLevel(level string) string {
+	switch level {
+	case "error":
+		return "HIGH"
+	case "warning", "":
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
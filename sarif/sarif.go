@@ -0,0 +1,114 @@
+// Package sarif converts between SARIF 2.1.0 logs and vulnscan findings.
+//
+// Ingest mapping rules:
+//   - each run becomes one scan result; the tool driver name identifies the scanner
+//   - each result becomes one vulnerability whose ID is the rule ID
+//   - severity comes from the rule's "security-severity" property (GitHub's
+//     convention, a CVSS-like 0–10 score) and falls back to the result level
+//   - the rule's tags become risk factors and its helpUri becomes the link
+//
+// Export reverses these rules so query results can be uploaded to GitHub
+// code scanning.
+package sarif
+
+// Version and Schema identify the SARIF specification produced and accepted
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Log is the root SARIF object
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema,omitempty"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is the output of a single invocation of an analysis tool
+type Run struct {
+	Tool              Tool               `json:"tool"`
+	Results           []Result           `json:"results"`
+	Invocations       []Invocation       `json:"invocations,omitempty"`
+	AutomationDetails *AutomationDetails `json:"automationDetails,omitempty"`
+}
+
+// Tool describes the analysis tool that produced a run
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the tool component that contains the rules
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+// Rule describes an analysis rule (for vulnscan, a vulnerability identifier)
+type Rule struct {
+	ID               string      `json:"id"`
+	Name             string      `json:"name,omitempty"`
+	ShortDescription *Message    `json:"shortDescription,omitempty"`
+	FullDescription  *Message    `json:"fullDescription,omitempty"`
+	HelpURI          string      `json:"helpUri,omitempty"`
+	Properties       *Properties `json:"properties,omitempty"`
+}
+
+// Properties is the property bag attached to rules and results
+type Properties struct {
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	PackageName      string   `json:"packageName,omitempty"`
+	InstalledVersion string   `json:"installedVersion,omitempty"`
+	FixedVersion     string   `json:"fixedVersion,omitempty"`
+}
+
+// Result is a single finding
+type Result struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           *int              `json:"ruleIndex,omitempty"`
+	Level               string            `json:"level,omitempty"`
+	Message             Message           `json:"message"`
+	Locations           []Location        `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          *Properties       `json:"properties,omitempty"`
+}
+
+// Message is a text message
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Location identifies where a result was found
+type Location struct {
+	PhysicalLocation *PhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []LogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+// PhysicalLocation points to an artifact (file)
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+}
+
+// ArtifactLocation is the URI of an artifact
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// LogicalLocation names a non-file location such as a package
+type LogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"`
+}
+
+// Invocation describes a single tool execution
+type Invocation struct {
+	ExecutionSuccessful bool   `json:"executionSuccessful"`
+	EndTimeUTC          string `json:"endTimeUtc,omitempty"`
+}
+
+// AutomationDetails identifies the run for deduplication across uploads
+type AutomationDetails struct {
+	ID string `json:"id,omitempty"`
+}
@@ -0,0 +1,138 @@
+// Package secrets resolves the credentials of integrations (GitHub, NVD,
+// Jira, notification channels) from where they are kept: the environment,
+// files, HashiCorp Vault, or a command such as a KMS or secrets manager
+// call. Resolved values are hidden from log output, and the store records
+// which secrets are configured without keeping their values.
+//
+// A secret is configured with a reference:
+//
+//	ghp_abc123                       the value itself, e.g. set in the environment
+//	file:/run/secrets/github_token   the content of a file
+//	vault:secret/data/vulnscan#jira  a key of a Vault KV secret
+//	cmd:aws secretsmanager ...       the output of a shell command
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Sources of secret values, in SecretStatus.Source
+const (
+	SourceEnv     = "env"     // The reference is the value
+	SourceFile    = "file"    // file:<path>
+	SourceVault   = "vault"   // vault:<path>#<key>
+	SourceCommand = "command" // cmd:<shell command>
+)
+
+// commandTimeout bounds a secret command
+const commandTimeout = 30 * time.Second
+
+// Store resolves secrets and keeps their status
+type Store struct {
+	Vault Vault // Vault server vault: references are read from
+
+	mu       sync.Mutex
+	statuses map[string]models.SecretStatus
+}
+
+// Default is the store the service resolves its secrets with
+var Default = &Store{}
+
+// Resolve returns the value ref refers to, recording the secret's status
+// under name and hiding the value from logs. An empty ref is recorded as
+// not configured.
+func (s *Store) Resolve(ctx context.Context, name, ref string) (string, error) {
+	status := models.SecretStatus{Name: name}
+	if ref == "" {
+		s.record(status)
+		return "", nil
+	}
+
+	source, value, err := s.resolve(ctx, ref)
+	status.Source = source
+	if err != nil {
+		status.Error = err.Error()
+		s.record(status)
+		return "", fmt.Errorf("secret %s: %v", name, err)
+	}
+	now := time.Now().UTC()
+	status.Configured, status.ResolvedAt = true, &now
+	logging.Redact(value)
+	s.record(status)
+	return value, nil
+}
+
+// resolve reads the value of a reference
+func (s *Store) resolve(ctx context.Context, ref string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return SourceFile, "", err
+		}
+		value, err := nonEmpty(string(data))
+		return SourceFile, value, err
+	case strings.HasPrefix(ref, "vault:"):
+		path, key, ok := strings.Cut(strings.TrimPrefix(ref, "vault:"), "#")
+		if !ok || path == "" || key == "" {
+			return SourceVault, "", fmt.Errorf("invalid vault reference (want vault:<path>#<key>)")
+		}
+		value, err := s.Vault.Read(ctx, path, key)
+		return SourceVault, value, err
+	case strings.HasPrefix(ref, "cmd:"):
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", strings.TrimPrefix(ref, "cmd:"))
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return SourceCommand, "", fmt.Errorf("command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		value, err := nonEmpty(string(out))
+		return SourceCommand, value, err
+	}
+	return SourceEnv, ref, nil
+}
+
+// nonEmpty trims the surrounding whitespace of a value read from a file or
+// command, which must not be empty
+func nonEmpty(value string) (string, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return "", fmt.Errorf("value is empty")
+	}
+	return value, nil
+}
+
+// record keeps the status of a secret
+func (s *Store) record(status models.SecretStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.statuses == nil {
+		s.statuses = map[string]models.SecretStatus{}
+	}
+	s.statuses[status.Name] = status
+}
+
+// List returns the status of every secret resolved so far, by name
+func (s *Store) List() []models.SecretStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]models.SecretStatus, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from the HTTP API of a HashiCorp Vault server
+type Vault struct {
+	Addr   string       // Server URL, e.g. https://vault.example.com:8200
+	Token  string       // Token authenticating the reads
+	Client *http.Client // Client the reads are sent with
+}
+
+// Read returns a key of the secret at path, e.g. secret/data/vulnscan for
+// the vulnscan secret of a KV version 2 engine mounted at secret
+func (v Vault) Read(ctx context.Context, path, key string) (string, error) {
+	if v.Addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(v.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return "", fmt.Errorf("vault: %s returned %s", path, resp.Status)
+	}
+
+	// A KV version 2 engine nests the secret's data in its own data field
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: decode %s: %v", path, err)
+	}
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		if _, meta := data["metadata"]; meta {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", fmt.Errorf("vault: decode %s: %v", path, err)
+			}
+		}
+	}
+	raw, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no key %q", path, key)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+		return "", fmt.Errorf("vault: %s key %q is not a non-empty string", path, key)
+	}
+	return value, nil
+}
@@ -0,0 +1,113 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// hecPath is the HEC endpoint posted to when the URL has no path
+const hecPath = "/services/collector/event"
+
+// hecEvent is one event of a HEC request
+type hecEvent struct {
+	Time       float64                `json:"time"`
+	Source     string                 `json:"source"`
+	SourceType string                 `json:"sourcetype"`
+	Index      string                 `json:"index,omitempty"`
+	Event      map[string]interface{} `json:"event"`
+}
+
+// hecSender posts batches of JSON events to a Splunk HTTP Event Collector
+type hecSender struct {
+	url        string
+	token      string
+	index      string
+	source     string
+	sourceType string
+	fields     map[string]string
+	client     *http.Client
+}
+
+// newHEC creates a HEC sender for an output
+func newHEC(c OutputConfig) (*hecSender, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", c.URL)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = hecPath
+	}
+	if c.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	s := &hecSender{
+		url: u.String(), token: c.Token, index: c.Index, source: c.Source, sourceType: c.SourceType,
+		fields: c.Fields, client: httpclient.New(10 * time.Second),
+	}
+	if s.source == "" {
+		s.source = "vulnscan"
+	}
+	if s.sourceType == "" {
+		s.sourceType = "vulnscan:finding"
+	}
+	return s, nil
+}
+
+// Send posts the batch as concatenated events in one request
+func (s *hecSender) Send(ctx context.Context, batch []Record) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range batch {
+		e := hecEvent{Source: s.source, SourceType: s.sourceType, Index: s.index, Event: s.event(r)}
+		if at, ok := r["time"].(time.Time); ok {
+			e.Time = float64(at.UnixMilli()) / 1000
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// event returns the fields of a record sent as a HEC event: every field
+// under its own name, or those fields maps, under their output names
+func (s *hecSender) event(r Record) map[string]interface{} {
+	e := map[string]interface{}{}
+	if len(s.fields) == 0 {
+		for field, value := range r {
+			e[field] = value
+		}
+		return e
+	}
+	for name, field := range s.fields {
+		if value, ok := r[field]; ok {
+			e[name] = value
+		}
+	}
+	return e
+}
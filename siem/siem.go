@@ -0,0 +1,361 @@
+// Package siem forwards new-finding events to SIEMs, as CEF messages over
+// syslog or as JSON events to a Splunk HTTP Event Collector, so security
+// operations can correlate detections with vulnerability data. Events are
+// batched per output and retried with backoff; delivery is at least once.
+package siem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/secrets"
+)
+
+// Output types
+const (
+	TypeSyslog    = "syslog"     // CEF messages over syslog (RFC 5424)
+	TypeSplunkHEC = "splunk_hec" // JSON events to a Splunk HTTP Event Collector
+)
+
+// Fields lists the finding fields an output's fields can map from
+var Fields = []string{
+	"time", "repo", "id", "severity", "cvss", "package_name", "current_version", "fixed_version",
+	"ecosystem", "purl", "location", "fingerprint", "link", "description", "published_date", "aliases",
+}
+
+// Defaults of an output's batching and retries
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = time.Second
+	defaultQueueSize     = 10000
+)
+
+// severityRank orders severities for thresholds; unknown ranks lowest
+var severityRank = map[string]int{"CRITICAL": 4, "HIGH": 3, "MEDIUM": 2, "LOW": 1}
+
+// OutputConfig configures one SIEM output and which findings it receives
+type OutputConfig struct {
+	Name string `json:"name"` // Name used in logs and metrics
+	Type string `json:"type"` // syslog or splunk_hec
+
+	Network  string `json:"network,omitempty"`  // Syslog transport: tcp (default), udp, or tls
+	Address  string `json:"address,omitempty"`  // Syslog server host:port
+	Facility string `json:"facility,omitempty"` // Syslog facility, e.g. local0 (default) or auth
+
+	URL        string `json:"url,omitempty"`        // HEC URL; a URL without a path posts to /services/collector/event
+	Token      string `json:"token,omitempty"`      // HEC token, or a secret reference to it
+	Index      string `json:"index,omitempty"`      // Splunk index; empty uses the token's default
+	Source     string `json:"source,omitempty"`     // Splunk source (default vulnscan)
+	SourceType string `json:"sourcetype,omitempty"` // Splunk sourcetype (default vulnscan:finding)
+
+	Fields      map[string]string `json:"fields,omitempty"`       // Finding field each output field or CEF extension key maps from; empty uses the defaults
+	Repos       []string          `json:"repos,omitempty"`        // Repositories to forward findings of; empty means all
+	MinSeverity string            `json:"min_severity,omitempty"` // Lowest severity forwarded; empty forwards all
+
+	BatchSize     int    `json:"batch_size,omitempty"`     // Events sent at a time (default 100)
+	FlushInterval string `json:"flush_interval,omitempty"` // Longest wait before a partial batch is sent (default 5s)
+	MaxRetries    *int   `json:"max_retries,omitempty"`    // Retries of a failed batch before it is dropped (default 3)
+	RetryBackoff  string `json:"retry_backoff,omitempty"`  // Delay before the first retry, doubling after each (default 1s)
+	QueueSize     int    `json:"queue_size,omitempty"`     // Events waiting to be sent before new ones are dropped (default 10000)
+}
+
+// Config is the JSON SIEM outputs file
+type Config struct {
+	Outputs []OutputConfig `json:"outputs"`
+}
+
+// Record is one finding's fields, by name
+type Record map[string]interface{}
+
+// sender delivers a batch of records to a SIEM
+type sender interface {
+	Send(ctx context.Context, batch []Record) error
+}
+
+// output is a configured output with its queue
+type output struct {
+	OutputConfig
+	sender  sender
+	queue   chan Record
+	flush   time.Duration
+	retries int
+	backoff time.Duration
+
+	sent    atomic.Int64
+	dropped atomic.Int64
+}
+
+// Stats counts the events of an output
+type Stats struct {
+	Name    string // Output name
+	Sent    int64  // Events delivered
+	Dropped int64  // Events dropped because the queue was full or retries ran out
+	Queued  int    // Events waiting to be sent
+}
+
+// Forwarder sends new-finding events to the configured outputs
+type Forwarder struct {
+	outputs []*output
+}
+
+// cefKey matches CEF extension keys
+var cefKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// New creates a forwarder for the configured outputs, resolving their
+// tokens
+func New(cfg Config) (*Forwarder, error) {
+	f := &Forwarder{}
+	names := map[string]bool{}
+	for _, c := range cfg.Outputs {
+		if c.Name == "" || names[c.Name] {
+			return nil, fmt.Errorf("siem: output name %q missing or repeated", c.Name)
+		}
+		names[c.Name] = true
+		o, err := newOutput(c)
+		if err != nil {
+			return nil, fmt.Errorf("siem: output %q: %v", c.Name, err)
+		}
+		f.outputs = append(f.outputs, o)
+	}
+	return f, nil
+}
+
+// newOutput validates an output's configuration and applies its defaults
+func newOutput(c OutputConfig) (*output, error) {
+	o := &output{OutputConfig: c, retries: defaultMaxRetries}
+	for key, field := range c.Fields {
+		if !slices.Contains(Fields, field) {
+			return nil, fmt.Errorf("field %q maps from unknown field %q", key, field)
+		}
+		if c.Type == TypeSyslog && !cefKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid CEF extension key %q", key)
+		}
+	}
+	if o.MinSeverity = strings.ToUpper(c.MinSeverity); o.MinSeverity != "" && severityRank[o.MinSeverity] == 0 {
+		return nil, fmt.Errorf("unknown min_severity %q", c.MinSeverity)
+	}
+
+	var err error
+	if o.flush, err = parseDuration(c.FlushInterval, defaultFlushInterval); err != nil {
+		return nil, fmt.Errorf("invalid flush_interval %q", c.FlushInterval)
+	}
+	if o.backoff, err = parseDuration(c.RetryBackoff, defaultRetryBackoff); err != nil {
+		return nil, fmt.Errorf("invalid retry_backoff %q", c.RetryBackoff)
+	}
+	if c.MaxRetries != nil {
+		if o.retries = *c.MaxRetries; o.retries < 0 {
+			return nil, fmt.Errorf("invalid max_retries %d", o.retries)
+		}
+	}
+	if c.BatchSize < 0 || c.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid batch_size or queue_size")
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = defaultQueueSize
+	}
+	o.queue = make(chan Record, o.QueueSize)
+
+	switch c.Type {
+	case TypeSyslog:
+		o.sender, err = newSyslog(c)
+	case TypeSplunkHEC:
+		if c.Token != "" {
+			if c.Token, err = secrets.Default.Resolve(context.Background(), "siem."+c.Name+".token", c.Token); err != nil {
+				return nil, err
+			}
+		}
+		o.sender, err = newHEC(c)
+	default:
+		err = fmt.Errorf("unknown type %q", c.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parseDuration parses a positive duration, returning def for an empty one
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("not positive")
+	}
+	return d, err
+}
+
+// Load reads a JSON configuration file and creates a forwarder
+func Load(path string) (*Forwarder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("siem: parse %s: %v", path, err)
+	}
+	return New(cfg)
+}
+
+// Start forwards finding events from broker until ctx is cancelled
+func (f *Forwarder) Start(ctx context.Context, broker *events.Broker) {
+	ch, cancel := broker.Subscribe(events.Filter{Types: []string{events.TypeFinding}})
+	for _, o := range f.outputs {
+		go o.run(ctx)
+	}
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-ch:
+				f.Handle(e)
+			}
+		}
+	}()
+}
+
+// Handle queues a finding event on every output that wants it, dropping it
+// for outputs whose queue is full rather than holding up the others
+func (f *Forwarder) Handle(e events.Event) {
+	if e.Type != events.TypeFinding {
+		return
+	}
+	var v models.Vulnerability
+	if err := e.DecodeData(&v); err != nil {
+		slog.Warn("SIEM payload invalid", "type", e.Type, "error", err)
+		return
+	}
+	r := record(e, v)
+	for _, o := range f.outputs {
+		if !o.wants(e.Repo, v.Severity) {
+			continue
+		}
+		select {
+		case o.queue <- r:
+		default:
+			o.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns the counts of each output, in configuration order
+func (f *Forwarder) Stats() []Stats {
+	stats := make([]Stats, 0, len(f.outputs))
+	for _, o := range f.outputs {
+		stats = append(stats, Stats{Name: o.Name, Sent: o.sent.Load(), Dropped: o.dropped.Load(), Queued: len(o.queue)})
+	}
+	return stats
+}
+
+// wants reports whether the output forwards findings of repo at severity
+func (o *output) wants(repo, severity string) bool {
+	if len(o.Repos) > 0 && !slices.ContainsFunc(o.Repos, func(r string) bool { return strings.EqualFold(r, repo) }) {
+		return false
+	}
+	return o.MinSeverity == "" || severityRank[strings.ToUpper(severity)] >= severityRank[o.MinSeverity]
+}
+
+// run sends the queued records in batches of BatchSize, or whatever has
+// queued once the flush interval passes, until ctx is cancelled
+func (o *output) run(ctx context.Context) {
+	ticker := time.NewTicker(o.flush)
+	defer ticker.Stop()
+	var batch []Record
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-o.queue:
+			if batch = append(batch, r); len(batch) >= o.BatchSize {
+				o.deliver(ctx, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				o.deliver(ctx, batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// deliver sends a batch, retrying with doubling backoff, and drops it once
+// the retries run out
+func (o *output) deliver(ctx context.Context, batch []Record) {
+	backoff := o.backoff
+	for attempt := 0; ; attempt++ {
+		err := o.sender.Send(ctx, batch)
+		if err == nil {
+			o.sent.Add(int64(len(batch)))
+			return
+		}
+		if attempt >= o.retries || ctx.Err() != nil {
+			slog.Warn("SIEM forwarding failed", "output", o.Name, "events", len(batch), "attempts", attempt+1, "error", err)
+			o.dropped.Add(int64(len(batch)))
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// record returns the fields of a finding event
+func record(e events.Event, v models.Vulnerability) Record {
+	r := Record{
+		"time":            e.Time.UTC(),
+		"repo":            e.Repo,
+		"id":              v.CVEID,
+		"severity":        v.Severity,
+		"cvss":            v.CVSS,
+		"package_name":    v.PackageName,
+		"current_version": v.CurrentVersion,
+		"fixed_version":   v.FixedVersion,
+		"ecosystem":       v.Ecosystem,
+		"purl":            v.PURL,
+		"location":        v.Location,
+		"fingerprint":     v.Fingerprint,
+		"link":            v.Link,
+		"description":     v.Description,
+		"aliases":         strings.Join(v.Aliases, ","),
+	}
+	if !v.PublishedDate.IsZero() {
+		r["published_date"] = v.PublishedDate.UTC()
+	}
+	return r
+}
+
+// text returns a record's field as text
+func (r Record) text(field string) string {
+	switch v := r[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
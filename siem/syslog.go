@@ -0,0 +1,208 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cefVendor and cefProduct name the device in CEF headers
+const (
+	cefVendor  = "vulnscan"
+	cefProduct = "vulnscan"
+	cefVersion = "1.0"
+)
+
+// dialTimeout bounds connecting to a syslog server
+const dialTimeout = 10 * time.Second
+
+// defaultCEFFields maps CEF extension keys to finding fields
+var defaultCEFFields = map[string]string{
+	"rt":       "time",
+	"cs1":      "repo",
+	"cs2":      "package_name",
+	"cs3":      "current_version",
+	"cs4":      "fixed_version",
+	"cs5":      "purl",
+	"cs6":      "fingerprint",
+	"cfp1":     "cvss",
+	"filePath": "location",
+	"request":  "link",
+	"msg":      "description",
+}
+
+// facilities are the syslog facility codes by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5, "authpriv": 10, "security": 13,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// cefSeverities are the CEF severities (0-10) of finding severities
+var cefSeverities = map[string]int{"CRITICAL": 10, "HIGH": 8, "MEDIUM": 5, "LOW": 3}
+
+// syslogSeverities are the syslog severities of finding severities; others
+// are informational (6)
+var syslogSeverities = map[string]int{"CRITICAL": 2, "HIGH": 3, "MEDIUM": 4, "LOW": 5}
+
+// syslogSender writes CEF messages to a syslog server, keeping a stream
+// connection open between batches
+type syslogSender struct {
+	network  string
+	address  string
+	facility int
+	fields   map[string]string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newSyslog creates a syslog sender for an output
+func newSyslog(c OutputConfig) (*syslogSender, error) {
+	s := &syslogSender{network: strings.ToLower(c.Network), address: c.Address, fields: c.Fields}
+	if s.network == "" {
+		s.network = "tcp"
+	}
+	if s.network != "tcp" && s.network != "udp" && s.network != "tls" {
+		return nil, fmt.Errorf("unknown network %q, want tcp, udp, or tls", c.Network)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %q", c.Address)
+	}
+	facility, ok := facilities[strings.ToLower(c.Facility)]
+	if c.Facility == "" {
+		facility, ok = facilities["local0"], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown facility %q", c.Facility)
+	}
+	s.facility = facility
+	if len(s.fields) == 0 {
+		s.fields = defaultCEFFields
+	}
+	if s.hostname, _ = os.Hostname(); s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+// Send writes one message per record: in one write, newline-framed, over
+// a stream; as one datagram each over UDP. A failed write closes the
+// connection so the retry reconnects.
+func (s *syslogSender) Send(ctx context.Context, batch []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var err error
+	if s.network == "udp" {
+		for _, r := range batch {
+			if _, err = s.conn.Write([]byte(s.message(r))); err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, r := range batch {
+			buf.WriteString(s.message(r))
+			buf.WriteByte('\n')
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+		_, err = s.conn.Write(buf.Bytes())
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// dial connects to the syslog server
+func (s *syslogSender) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+	if s.network == "tls" {
+		return (&tls.Dialer{NetDialer: d}).DialContext(ctx, "tcp", s.address)
+	}
+	return d.DialContext(ctx, s.network, s.address)
+}
+
+// message formats a record as an RFC 5424 syslog message carrying a CEF
+// event
+func (s *syslogSender) message(r Record) string {
+	severity := strings.ToUpper(r.text("severity"))
+	pri := s.facility*8 + 6
+	if sev, ok := syslogSeverities[severity]; ok {
+		pri = s.facility*8 + sev
+	}
+	at, _ := r["time"].(time.Time)
+	return fmt.Sprintf("<%d>1 %s %s vulnscan - finding - %s", pri, at.Format(time.RFC3339), s.hostname, CEF(r, s.fields))
+}
+
+// CEF formats a record as a CEF:0 event whose extension maps each key of
+// fields to the record's field; custom string and number keys (cs1, cn1,
+// cfp1, ...) are labelled with the field name
+func CEF(r Record, fields map[string]string) string {
+	id := r.text("id")
+	name := strings.TrimSpace(id + " in " + r.text("package_name") + " " + r.text("current_version"))
+	header := []string{"CEF:0", cefVendor, cefProduct, cefVersion, id, name,
+		fmt.Sprint(cefSeverities[strings.ToUpper(r.text("severity"))])}
+	for i := 1; i < len(header); i++ {
+		header[i] = escapeHeader(header[i])
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var ext []string
+	for _, key := range keys {
+		field := fields[key]
+		value := r.text(field)
+		if at, ok := r[field].(time.Time); ok && key == "rt" {
+			value = fmt.Sprint(at.UnixMilli()) // CEF receipt times are epoch milliseconds
+		}
+		if value == "" {
+			continue
+		}
+		ext = append(ext, key+"="+escapeExtension(value))
+		if isCustomKey(key) {
+			ext = append(ext, key+"Label="+escapeExtension(field))
+		}
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// isCustomKey reports whether an extension key is a CEF custom field that
+// takes a label, e.g. cs1 or cfp2
+func isCustomKey(key string) bool {
+	for _, prefix := range []string{"cs", "cn", "cfp", "flexString", "flexNumber", "flexDate"} {
+		if n := strings.TrimPrefix(key, prefix); n != key && len(n) == 1 && n[0] >= '1' && n[0] <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeHeader escapes a CEF header field
+func escapeHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// escapeExtension escapes a CEF extension value
+func escapeExtension(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
@@ -0,0 +1,55 @@
+// Package sla computes remediation deadlines from per-severity service
+// level agreements.
+package sla
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy maps an upper-case severity to the number of days allowed to
+// remediate a finding of that severity. Severities without an entry have no
+// deadline.
+type Policy map[string]int
+
+// Default is the policy used by the server, replaced from configuration
+var Default = Policy{"CRITICAL": 7, "HIGH": 30, "MEDIUM": 90, "LOW": 180}
+
+// Parse reads a policy of comma-separated severity=days pairs, e.g.
+// "critical=7,high=30"
+func Parse(s string) (Policy, error) {
+	p := Policy{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		sev, days, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid SLA %q (want severity=days)", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(days))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid SLA days %q for %s", days, sev)
+		}
+		p[strings.ToUpper(strings.TrimSpace(sev))] = n
+	}
+	return p, nil
+}
+
+// Days returns the remediation window for severity
+func (p Policy) Days(severity string) (int, bool) {
+	days, ok := p[strings.ToUpper(severity)]
+	return days, ok
+}
+
+// DueDate returns when a finding of severity first seen at firstSeen must be
+// remediated
+func (p Policy) DueDate(severity string, firstSeen time.Time) (time.Time, bool) {
+	days, ok := p.Days(severity)
+	if !ok {
+		return time.Time{}, false
+	}
+	return firstSeen.AddDate(0, 0, days), true
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// AuditFilter narrows a listing of the audit log
+type AuditFilter struct {
+	Actor  string    // Exact actor
+	Action string    // Exact action
+	Target string    // Exact target
+	Since  time.Time // Entries at or after; zero for no bound
+	Until  time.Time // Entries before; zero for no bound
+	Before int64     // Entries with a smaller ID, for paging; 0 for no bound
+	Limit  int       // Maximum entries returned
+}
+
+// InsertAuditEntry appends an entry to the audit log, setting its ID and
+// creation time. The table rejects updates and deletes.
+func InsertAuditEntry(ctx context.Context, db *sqlx.DB, e *models.AuditEntry) error {
+	e.CreatedAt = time.Now().UTC()
+	res, err := db.NamedExecContext(ctx, `INSERT INTO audit_log (created_at, actor, action, target, status, request_id)
+		VALUES (:created_at, :actor, :action, :target, :status, :request_id)`, e)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAuditLog returns entries matching the filter, most recent first
+func ListAuditLog(ctx context.Context, db *sqlx.DB, f AuditFilter) ([]models.AuditEntry, error) {
+	query := `SELECT id, created_at, actor, action, target, status, request_id FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	for _, c := range []struct {
+		column, value string
+	}{{"actor", f.Actor}, {"action", f.Action}, {"target", f.Target}} {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !f.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, f.Until.UTC())
+	}
+	if f.Before > 0 {
+		query += " AND id < ?"
+		args = append(args, f.Before)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	entries := []models.AuditEntry{}
+	err := db.SelectContext(ctx, &entries, query, args...)
+	return entries, err
+}
@@ -0,0 +1,15 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist or be empty, while other connections keep reading and writing. The
+// copy is compacted, leaving out free pages and the write-ahead log.
+func Backup(ctx context.Context, db *sqlx.DB, path string) error {
+	_, err := db.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
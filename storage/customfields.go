@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// What custom fields are set on, in CustomField.Target
+const (
+	CustomFieldVulnerability = "vulnerability" // A stored vulnerability, by finding ID
+	CustomFieldScan          = "scan"          // A stored scan, and so every vulnerability it reported
+)
+
+// Types of custom field values, in CustomField.Type
+const (
+	CustomFieldString  = "string"
+	CustomFieldNumber  = "number"
+	CustomFieldBoolean = "boolean"
+)
+
+// ErrCustomFieldInUse is returned when redefining a field with values under
+// another target or type
+var ErrCustomFieldInUse = errs.New(errs.ErrConflict, "custom field has values; delete it to change its target or type")
+
+// customFieldColumns are the columns of a CustomField
+const customFieldColumns = "name, target, type, description, allowed_values, created_by, created_at, updated_at"
+
+// UpsertCustomField stores a field definition under its name, replacing one
+// of the same name, and reports whether it was newly created. A field with
+// values keeps its target and type.
+func UpsertCustomField(ctx context.Context, db *sqlx.DB, f *models.CustomField) (bool, error) {
+	now := time.Now().UTC()
+	f.UpdatedAt = now
+
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var old models.CustomField
+	err = tx.GetContext(ctx, &old, "SELECT "+customFieldColumns+" FROM custom_fields WHERE name = ?", f.Name)
+	created := errors.Is(err, sql.ErrNoRows)
+	switch {
+	case created:
+		f.CreatedAt = now
+	case err != nil:
+		return false, err
+	default:
+		f.CreatedBy, f.CreatedAt = old.CreatedBy, old.CreatedAt
+		if old.Target != f.Target || old.Type != f.Type {
+			var used bool
+			if err := tx.GetContext(ctx, &used, "SELECT EXISTS (SELECT 1 FROM custom_field_values WHERE field = ?)", f.Name); err != nil {
+				return false, err
+			}
+			if used {
+				return false, ErrCustomFieldInUse
+			}
+		}
+	}
+
+	_, err = tx.NamedExecContext(ctx, `INSERT INTO custom_fields (`+customFieldColumns+`)
+		VALUES (:name, :target, :type, :description, :allowed_values, :created_by, :created_at, :updated_at)
+		ON CONFLICT (name) DO UPDATE SET target = excluded.target, type = excluded.type,
+			description = excluded.description, allowed_values = excluded.allowed_values, updated_at = excluded.updated_at`, f)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// GetCustomField returns the field defined under name, or ErrNotFound
+func GetCustomField(ctx context.Context, db sqlx.QueryerContext, name string) (models.CustomField, error) {
+	var f models.CustomField
+	err := sqlx.GetContext(ctx, db, &f, "SELECT "+customFieldColumns+" FROM custom_fields WHERE name = ?", name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, ErrNotFound
+	}
+	return f, err
+}
+
+// ListCustomFields returns every field definition ordered by name
+func ListCustomFields(ctx context.Context, db *sqlx.DB) ([]models.CustomField, error) {
+	fields := []models.CustomField{}
+	err := db.SelectContext(ctx, &fields, "SELECT "+customFieldColumns+" FROM custom_fields ORDER BY name")
+	return fields, err
+}
+
+// DeleteCustomField removes the field defined under name with its values,
+// or returns ErrNotFound
+func DeleteCustomField(ctx context.Context, db *sqlx.DB, name string) error {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM custom_fields WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM custom_field_values WHERE field = ?", name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetCustomFieldValue sets the field on the vulnerability or scan with the
+// ID to value, in its stored text form
+func SetCustomFieldValue(ctx context.Context, tx sqlx.ExecerContext, field string, targetID int64, value string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO custom_field_values (field, target_id, value) VALUES (?, ?, ?)
+		ON CONFLICT (field, target_id) DO UPDATE SET value = excluded.value`, field, targetID, value)
+	return err
+}
+
+// ClearCustomFieldValue removes the field from the vulnerability or scan
+// with the ID
+func ClearCustomFieldValue(ctx context.Context, tx sqlx.ExecerContext, field string, targetID int64) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM custom_field_values WHERE field = ? AND target_id = ?", field, targetID)
+	return err
+}
+
+// CustomFieldValues returns the fields set on the vulnerability or scan
+// with the ID, by name
+func CustomFieldValues(ctx context.Context, db sqlx.QueryerContext, target string, targetID int64) (map[string]any, error) {
+	var rows []customFieldRow
+	err := sqlx.SelectContext(ctx, db, &rows, `SELECT c.target_id, c.field, f.type, c.value FROM custom_field_values c
+		JOIN custom_fields f ON f.name = c.field WHERE f.target = ? AND c.target_id = ?`, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(rows))
+	for _, r := range rows {
+		values[r.Field] = r.typed()
+	}
+	return values, nil
+}
+
+// CustomFieldFilter returns a condition, and its arguments, matching
+// vulnerability rows v whose own custom fields, or whose scan's, have every
+// one of the values. Values compare as stored, except that numbers compare
+// numerically; a field that isn't defined matches nothing.
+func CustomFieldFilter(values map[string]string) (string, []interface{}) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	for _, name := range names {
+		conds = append(conds, `EXISTS (SELECT 1 FROM custom_field_values c JOIN custom_fields f ON f.name = c.field
+			WHERE c.field = ? AND c.target_id = CASE f.target WHEN '`+CustomFieldScan+`' THEN v.scan_id ELSE v.id END
+				AND (c.value = ? OR (f.type = '`+CustomFieldNumber+`' AND CAST(c.value AS REAL) = CAST(? AS REAL))))`)
+		args = append(args, name, values[name], values[name])
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// AttachCustomFields sets the custom fields of each vulnerability: its own
+// and those of the scan that reported it
+func AttachCustomFields(ctx context.Context, db sqlx.QueryerContext, vulns []models.Vulnerability) error {
+	if len(vulns) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(vulns))
+	for i, v := range vulns {
+		ids[i] = v.FindingID
+	}
+	var rows []customFieldRow
+	err := Statements.SelectContext(ctx, db, &rows, `SELECT v.id AS target_id, c.field, f.type, c.value
+		FROM vulnerabilities v JOIN custom_fields f
+		JOIN custom_field_values c ON c.field = f.name
+			AND c.target_id = CASE f.target WHEN '`+CustomFieldScan+`' THEN v.scan_id ELSE v.id END
+		WHERE v.id IN (SELECT value FROM json_each(?))`, inList(ids))
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[int64]map[string]any)
+	for _, r := range rows {
+		if fields[r.TargetID] == nil {
+			fields[r.TargetID] = make(map[string]any)
+		}
+		fields[r.TargetID][r.Field] = r.typed()
+	}
+	for i := range vulns {
+		vulns[i].CustomFields = fields[vulns[i].FindingID]
+	}
+	return nil
+}
+
+// customFieldRow is a stored custom field value with its field's type
+type customFieldRow struct {
+	TargetID int64  `db:"target_id"`
+	Field    string `db:"field"`
+	Type     string `db:"type"`
+	Value    string `db:"value"`
+}
+
+// typed returns the value as its field's type
+func (r customFieldRow) typed() any {
+	switch r.Type {
+	case CustomFieldNumber:
+		if n, err := strconv.ParseFloat(r.Value, 64); err == nil {
+			return n
+		}
+	case CustomFieldBoolean:
+		return r.Value == "true"
+	}
+	return r.Value
+}
@@ -1,52 +1,627 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// DB is the global database connection handle
-var DB *sqlx.DB
+// DefaultDSN is the SQLite database opened when no DSN is configured, with
+// Write-Ahead Logging so reads don't block on writes. Transactions take the
+// write lock when they begin, and writes outside LockWrites wait up to five
+// seconds for it rather than failing with SQLITE_BUSY. New databases are
+// created in incremental vacuum mode, so Maintain can release free pages.
+const DefaultDSN = "vulnerabilities.db?_journal=WAL&_busy_timeout=5000&_txlock=immediate&_auto_vacuum=incremental"
+
+var (
+	DB     *sqlx.DB // Global database connection handle, used for writes
+	ReadDB *sqlx.DB // Optional read-only connection pool or replica, used by Reader
+)
+
+// migrations lists schema changes in the order they must be applied.
+// Entries are append-only: never edit a migration that has shipped.
+var migrations = []string{
+	// 1: initial scans and vulnerabilities schema
+	`
+	CREATE TABLE IF NOT EXISTS scans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo TEXT,
+		file_path TEXT,
+		scan_time DATETIME,
+		scan_id TEXT,
+		timestamp DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS vulnerabilities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id TEXT,
+		cve_id TEXT,
+		severity TEXT,
+		cvss REAL,
+		status TEXT,
+		package_name TEXT,
+		current_version TEXT,
+		fixed_version TEXT,
+		description TEXT,
+		published_date DATETIME,
+		link TEXT,
+		risk_factors TEXT CHECK(json_valid(risk_factors)),
+		FOREIGN KEY(scan_id) REFERENCES scans(id)
+	);
+	`,
+	// 2: SBOM components
+	`
+	CREATE TABLE IF NOT EXISTS components (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER REFERENCES scans(id),
+		name TEXT,
+		version TEXT,
+		ecosystem TEXT,
+		purl TEXT,
+		type TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_components_purl ON components(purl);
+	CREATE INDEX IF NOT EXISTS idx_components_scan ON components(scan_id);
+	`,
+	// 3: NVD metadata for ingested CVEs
+	`
+	CREATE TABLE IF NOT EXISTS cve_metadata (
+		cve_id TEXT PRIMARY KEY,
+		cvss_vector TEXT,
+		cvss_score REAL,
+		cwe_ids TEXT CHECK(json_valid(cwe_ids)),
+		refs TEXT CHECK(json_valid(refs)),
+		description TEXT,
+		last_modified DATETIME,
+		fetched_at DATETIME
+	);
+	`,
+	// 4: EPSS exploit-probability scores
+	`
+	CREATE TABLE IF NOT EXISTS epss_scores (
+		cve_id TEXT PRIMARY KEY,
+		epss REAL,
+		percentile REAL,
+		score_date TEXT,
+		updated_at DATETIME
+	);
+	`,
+	// 5: advisory identifier aliases (GHSA <-> CVE), stored in both directions
+	`
+	CREATE TABLE IF NOT EXISTS identifiers (
+		identifier TEXT NOT NULL,
+		alias TEXT NOT NULL,
+		source TEXT,
+		PRIMARY KEY (identifier, alias)
+	);
+	CREATE TABLE IF NOT EXISTS identifier_resolutions (
+		identifier TEXT PRIMARY KEY,
+		resolved_at DATETIME
+	);
+	`,
+	// 6: normalized package URL per finding. Existing rows have no
+	// ecosystem, so they are backfilled with pkg:generic URLs.
+	`
+	ALTER TABLE vulnerabilities ADD COLUMN ecosystem TEXT NOT NULL DEFAULT '';
+	ALTER TABLE vulnerabilities ADD COLUMN purl TEXT NOT NULL DEFAULT '';
+	UPDATE vulnerabilities SET purl = 'pkg:generic/' || lower(package_name) ||
+		CASE WHEN current_version <> '' THEN '@' || current_version ELSE '' END
+		WHERE purl = '' AND package_name <> '';
+	CREATE INDEX IF NOT EXISTS idx_vulnerabilities_purl ON vulnerabilities(purl);
+	`,
+	// 7: imported VEX statements, one row per vulnerability and package
+	`
+	CREATE TABLE IF NOT EXISTS vex_statements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		vuln_id TEXT NOT NULL,
+		product TEXT NOT NULL,
+		status TEXT NOT NULL,
+		justification TEXT NOT NULL DEFAULT '',
+		impact_statement TEXT NOT NULL DEFAULT '',
+		action_statement TEXT NOT NULL DEFAULT '',
+		author TEXT NOT NULL DEFAULT '',
+		document_id TEXT NOT NULL DEFAULT '',
+		timestamp DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_vex_statements_vuln ON vex_statements(vuln_id);
+	`,
+	// 8: triage state, comments, and audit trail
+	`
+	ALTER TABLE vulnerabilities ADD COLUMN triage_status TEXT NOT NULL DEFAULT 'open';
+	ALTER TABLE vulnerabilities ADD COLUMN assignee TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS vulnerability_comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		vulnerability_id INTEGER NOT NULL REFERENCES vulnerabilities(id),
+		author TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_vulnerability_comments_vuln ON vulnerability_comments(vulnerability_id);
+	CREATE TABLE IF NOT EXISTS triage_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		vulnerability_id INTEGER NOT NULL REFERENCES vulnerabilities(id),
+		actor TEXT NOT NULL,
+		field TEXT NOT NULL,
+		old_value TEXT NOT NULL,
+		new_value TEXT NOT NULL,
+		changed_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_triage_audit_vuln ON triage_audit(vulnerability_id);
+	CREATE INDEX IF NOT EXISTS idx_vulnerabilities_triage ON vulnerabilities(triage_status);
+	`,
+	// 9: lookup of earlier sightings of a finding, for SLA first-seen dates
+	`
+	CREATE INDEX IF NOT EXISTS idx_vulnerabilities_cve_package ON vulnerabilities(cve_id, package_name);
+	`,
+	// 10: Jira issues opened for findings, one per vulnerability and package
+	`
+	CREATE TABLE IF NOT EXISTS jira_issues (
+		cve_id TEXT NOT NULL,
+		package_name TEXT NOT NULL,
+		issue_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT '',
+		done BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		synced_at DATETIME,
+		PRIMARY KEY (cve_id, package_name)
+	);
+	CREATE INDEX IF NOT EXISTS idx_jira_issues_key ON jira_issues(issue_key);
+	`,
+	// 11: CISA Known Exploited Vulnerabilities catalog
+	`
+	CREATE TABLE IF NOT EXISTS kev_catalog (
+		cve_id TEXT PRIMARY KEY,
+		vendor_project TEXT,
+		product TEXT,
+		name TEXT,
+		date_added TEXT,
+		due_date TEXT,
+		known_ransomware BOOLEAN NOT NULL DEFAULT 0,
+		updated_at DATETIME
+	);
+	`,
+	// 12: unique findings per repository, package, and vulnerability across
+	// scans, backfilled from scan history
+	`
+	CREATE TABLE IF NOT EXISTS findings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo TEXT NOT NULL,
+		package_name TEXT NOT NULL,
+		cve_id TEXT NOT NULL,
+		severity TEXT,
+		status TEXT NOT NULL DEFAULT 'open',
+		first_seen DATETIME NOT NULL,
+		last_seen DATETIME NOT NULL,
+		last_scan_id INTEGER REFERENCES scans(id),
+		UNIQUE (repo, package_name, cve_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_findings_status ON findings(status);
+	INSERT OR IGNORE INTO findings (repo, package_name, cve_id, first_seen, last_seen, last_scan_id)
+		SELECT COALESCE(s.repo, ''), COALESCE(v.package_name, ''), COALESCE(v.cve_id, ''),
+			MIN(s.scan_time), MAX(s.scan_time), MAX(s.id)
+		FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		GROUP BY COALESCE(s.repo, ''), COALESCE(v.package_name, ''), COALESCE(v.cve_id, '');
+	UPDATE findings SET severity = (SELECT v.severity FROM vulnerabilities v
+		WHERE v.scan_id = findings.last_scan_id AND COALESCE(v.package_name, '') = findings.package_name
+			AND COALESCE(v.cve_id, '') = findings.cve_id LIMIT 1);
+	`,
+	// 13: resolution time of findings no longer reported by any latest scan.
+	// Existing ones are resolved as of the first later scan of the repository.
+	// A file's latest scans are every row stored with its latest row, one per
+	// scan result of the report.
+	`
+	ALTER TABLE findings ADD COLUMN resolved_at DATETIME;
+	UPDATE findings SET status = 'resolved',
+		resolved_at = (SELECT MIN(s.scan_time) FROM scans s
+			WHERE COALESCE(s.repo, '') = findings.repo AND s.scan_time > findings.last_seen)
+	WHERE NOT EXISTS (SELECT 1 FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE s.scan_time = (SELECT l.scan_time FROM scans l WHERE l.id = (SELECT MAX(m.id) FROM scans m
+				WHERE m.repo IS s.repo AND m.file_path IS s.file_path))
+			AND COALESCE(s.repo, '') = findings.repo AND COALESCE(v.package_name, '') = findings.package_name
+			AND COALESCE(v.cve_id, '') = findings.cve_id);
+	`,
+	// 14: declared license of SBOM and manifest components
+	`
+	ALTER TABLE components ADD COLUMN license TEXT NOT NULL DEFAULT '';
+	`,
+	// 15: dependency graph edges between the components of a scan
+	`
+	ALTER TABLE components ADD COLUMN ref TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS component_dependencies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER NOT NULL REFERENCES scans(id),
+		parent TEXT NOT NULL,
+		child TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_component_dependencies_scan ON component_dependencies(scan_id);
+	`,
+	// 16: HTTP validators of the last ingested version of each fetched file
+	`
+	CREATE TABLE IF NOT EXISTS fetch_cache (
+		repo TEXT NOT NULL,
+		ref TEXT NOT NULL,
+		path TEXT NOT NULL,
+		etag TEXT NOT NULL DEFAULT '',
+		last_modified TEXT NOT NULL DEFAULT '',
+		fetched_at DATETIME NOT NULL,
+		PRIMARY KEY (repo, ref, path)
+	);
+	`,
+	// 17: SHA-256 of the ingested file, for supply-chain audits
+	`
+	ALTER TABLE scans ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
+	`,
+	// 18: caller-supplied key/value labels of scans, e.g. team or environment
+	`
+	CREATE TABLE IF NOT EXISTS scan_labels (
+		scan_id INTEGER NOT NULL REFERENCES scans(id),
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (scan_id, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_scan_labels_key ON scan_labels(key, value);
+	`,
+	// 19: registry of repositories, matched to scans by URL, with their
+	// owners and default scan settings
+	`
+	CREATE TABLE IF NOT EXISTS repositories (
+		url TEXT PRIMARY KEY,
+		team TEXT NOT NULL,
+		contact TEXT NOT NULL DEFAULT '',
+		tier INTEGER NOT NULL DEFAULT 0,
+		files TEXT NOT NULL DEFAULT '[]',
+		patterns TEXT NOT NULL DEFAULT '[]',
+		labels TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_repositories_team ON repositories(team);
+	`,
+	// 20: named query filter sets, run on demand by dashboards and exports
+	`
+	CREATE TABLE IF NOT EXISTS saved_queries (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		filters TEXT NOT NULL,
+		columns TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	`,
+	// 21: append-only log of state-changing API requests
+	`
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL,
+		request_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+	`,
+	// 22: original content of ingested files, keyed by the SHA-256 scans
+	// record, for reprocessing without refetching
+	`
+	CREATE TABLE IF NOT EXISTS raw_files (
+		sha256 TEXT PRIMARY KEY,
+		encoding TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		content BLOB NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	`,
+	// 23: report times in UTC RFC 3339, as FormatTime writes them, instead
+	// of the driver's default layout in the report's zone
+	`
+	UPDATE vulnerabilities SET published_date = strftime('%Y-%m-%dT%H:%M:%SZ', published_date)
+		WHERE strftime('%Y-%m-%dT%H:%M:%SZ', published_date) IS NOT NULL;
+	UPDATE scans SET timestamp = strftime('%Y-%m-%dT%H:%M:%SZ', timestamp)
+		WHERE strftime('%Y-%m-%dT%H:%M:%SZ', timestamp) IS NOT NULL;
+	`,
+	// 24: format each scan was parsed from, e.g. trivy, naming the scanner
+	// behind deduplicated findings
+	`
+	ALTER TABLE scans ADD COLUMN source TEXT;
+	`,
+	// 25: severity overrides, applied when findings are read
+	`
+	CREATE TABLE IF NOT EXISTS severity_overrides (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org TEXT NOT NULL DEFAULT '',
+		cve_id TEXT NOT NULL DEFAULT '',
+		risk_factor TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	`,
+	// 26: responses of requests sent with an Idempotency-Key, replayed to
+	// retries until they expire. A status of 0 marks a request in progress.
+	`
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		actor TEXT NOT NULL,
+		route TEXT NOT NULL,
+		key TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		body BLOB,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (actor, route, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys(created_at);
+	`,
+	// 27: the resource each scan covered, and whether each finding is in
+	// an operating system package or an application dependency, backfilled
+	// from the package URL's type as purl.Class does
+	`
+	ALTER TABLE scans ADD COLUMN resource_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE scans ADD COLUMN resource_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE vulnerabilities ADD COLUMN package_class TEXT NOT NULL DEFAULT '';
+	UPDATE vulnerabilities SET package_class = CASE
+		WHEN purl NOT LIKE 'pkg:%' OR purl LIKE 'pkg:generic/%' THEN ''
+		WHEN purl LIKE 'pkg:deb/%' OR purl LIKE 'pkg:apk/%' OR purl LIKE 'pkg:alpine/%' OR purl LIKE 'pkg:rpm/%'
+			OR purl LIKE 'pkg:alpm/%' OR purl LIKE 'pkg:ebuild/%' THEN 'os'
+		ELSE 'application' END;
+	`,
+	// 28: the scanner-reported status of each scan, and whether it marked
+	// the run incomplete under the configuration it was stored with
+	`
+	ALTER TABLE scans ADD COLUMN scan_status TEXT NOT NULL DEFAULT '';
+	ALTER TABLE scans ADD COLUMN incomplete INTEGER NOT NULL DEFAULT 0;
+	`,
+	// 29: report fields of each vulnerability that no column holds, as a
+	// JSON object; empty when there were none
+	`
+	ALTER TABLE vulnerabilities ADD COLUMN raw_json TEXT NOT NULL DEFAULT '';
+	`,
+	// 30: admin-defined custom fields and their values on vulnerabilities
+	// or scans, by the field's target. Values are stored as text.
+	`
+	CREATE TABLE IF NOT EXISTS custom_fields (
+		name TEXT PRIMARY KEY,
+		target TEXT NOT NULL,
+		type TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		allowed_values TEXT NOT NULL DEFAULT '[]',
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS custom_field_values (
+		field TEXT NOT NULL,
+		target_id INTEGER NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (field, target_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_custom_field_values_target ON custom_field_values(target_id);
+	`,
+	// 31: leases held by one of the replicas sharing the database, e.g.
+	// leadership, and when each background job may next be claimed
+	`
+	CREATE TABLE IF NOT EXISTS leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS job_claims (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		claimed_at DATETIME NOT NULL,
+		next_run DATETIME NOT NULL
+	);
+	`,
+	// 32: the tenant each scan counts against, and the files each tenant
+	// ingested per UTC day
+	`
+	ALTER TABLE scans ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS idx_scans_tenant ON scans(tenant);
+	CREATE TABLE IF NOT EXISTS quota_usage (
+		tenant TEXT NOT NULL,
+		day TEXT NOT NULL,
+		files INTEGER NOT NULL,
+		PRIMARY KEY (tenant, day)
+	);
+	`,
+	// 33: other URLs of repositories, mapped to the canonical URL their
+	// rows are stored under. Existing URLs in another form than
+	// github.CanonicalRepoURL gives are aliased and their rows merged;
+	// image-only scans, whose repository is the image, are left alone.
+	`
+	CREATE TABLE IF NOT EXISTS repo_aliases (
+		alias TEXT PRIMARY KEY,
+		repo TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_repo_aliases_repo ON repo_aliases(repo);
+	WITH urls(alias) AS (
+		SELECT repo FROM scans WHERE COALESCE(repo, '') <> '' AND repo <> file_path
+		UNION SELECT repo FROM fetch_cache
+		UNION SELECT url FROM repositories
+	), trimmed(alias, s) AS (
+		SELECT alias, rtrim(trim(alias), '/') FROM urls
+	), bare(alias, s) AS (
+		SELECT alias, CASE WHEN lower(s) LIKE '%.git' THEN rtrim(substr(s, 1, length(s) - 4), '/') ELSE s END
+		FROM trimmed
+	), mapped(alias, s) AS (
+		SELECT alias, CASE
+			WHEN substr(s, 1, 4) = 'git@' AND instr(s, ':') > 0 AND instr(s, '://') = 0
+				THEN 'https://' || substr(s, 5, instr(s, ':') - 5) || '/' || substr(s, instr(s, ':') + 1)
+			WHEN substr(s, 1, 10) = 'ssh://git@' THEN 'https://' || substr(s, 11)
+			WHEN substr(s, 1, 6) = 'git://' THEN 'https://' || substr(s, 7)
+			WHEN instr(s, '://') = 0 AND instr(s, ':') = 0 AND instr(s, '@') = 0 AND instr(s, ' ') = 0
+				AND instr(s, '/') > 0 AND instr(substr(s, 1, instr(s, '/') - 1), '.') > 0 THEN 'https://' || s
+			ELSE s END
+		FROM bare
+	), split(alias, scheme, rest) AS (
+		SELECT alias, lower(substr(s, 1, instr(s, '://') - 1)), substr(s, instr(s, '://') + 3)
+		FROM mapped WHERE instr(s, '://') > 0
+	), canonical(alias, repo) AS (
+		SELECT alias, scheme || '://' || CASE WHEN instr(rest, '/') > 0
+			THEN lower(substr(rest, 1, instr(rest, '/') - 1)) || substr(rest, instr(rest, '/'))
+			ELSE lower(rest) END
+		FROM split WHERE scheme IN ('http', 'https')
+	)
+	INSERT OR IGNORE INTO repo_aliases (alias, repo, created_at)
+		SELECT alias, repo, strftime('%Y-%m-%dT%H:%M:%SZ', 'now') FROM canonical WHERE alias <> repo;
+	` + mergeRepoAliases,
+	// 34: the stable identity of each finding, and where in the scanned
+	// resource its package was found. Migrate fills in the fingerprints of
+	// existing rows, which SQL can't hash.
+	`
+	ALTER TABLE vulnerabilities ADD COLUMN location TEXT NOT NULL DEFAULT '';
+	ALTER TABLE vulnerabilities ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS idx_vulnerabilities_fingerprint ON vulnerabilities(fingerprint);
+	`,
+	// 35: the ingest each scan row was stored by: the ID of the ingest's
+	// first row, which leaves it NULL. Existing rows of a file stored at
+	// the same time belong to one ingest.
+	`
+	ALTER TABLE scans ADD COLUMN ingest_id INTEGER;
+	UPDATE scans SET ingest_id = (SELECT MIN(c.id) FROM scans c
+		WHERE c.repo IS scans.repo AND c.file_path IS scans.file_path AND c.scan_time = scans.scan_time)
+	WHERE id <> (SELECT MIN(c.id) FROM scans c
+		WHERE c.repo IS scans.repo AND c.file_path IS scans.file_path AND c.scan_time = scans.scan_time);
+	CREATE INDEX IF NOT EXISTS idx_scans_ingest_id ON scans(ingest_id);
+	`,
+}
+
+// FormatTime renders t as the UTC RFC 3339 text stored for report times,
+// vulnerabilities' published_date and scans' timestamp. Unlike the driver's
+// default layout it is the same for every zone the report used, and matches
+// the JSON the API serves.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
 
-// InitDB initializes the SQLite database connection and schema
-func InitDB() error {
-	// Open database connection with Write-Ahead Logging for better concurrency
-	db, err := sqlx.Open("sqlite3", "vulnerabilities.db?_journal=WAL")
+// InitDB opens the database at dsn and brings its schema up to date. When
+// readDSN is set, a separate connection pool opened on it serves Reader;
+// its schema is left to the primary.
+func InitDB(dsn, readDSN string) error {
+	db, err := sqlx.Open("sqlite3", dsn)
 	if err != nil {
 		return err
 	}
 
-	// Create tables if they do not exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS scans (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			repo TEXT,
-			file_path TEXT,
-			scan_time DATETIME,
-			scan_id TEXT,
-			timestamp DATETIME
-		);
-		CREATE TABLE IF NOT EXISTS vulnerabilities (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			scan_id TEXT,
-			cve_id TEXT,
-			severity TEXT,
-			cvss REAL,
-			status TEXT,
-			package_name TEXT,
-			current_version TEXT,
-			fixed_version TEXT,
-			description TEXT,
-			published_date DATETIME,
-			link TEXT,
-			risk_factors TEXT CHECK(json_valid(risk_factors)),
-			FOREIGN KEY(scan_id) REFERENCES scans(id)
-		);
-	`)
+	// Bring the schema up to date
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	var readDB *sqlx.DB
+	if readDSN != "" {
+		if readDB, err = sqlx.Open("sqlite3", readDSN); err == nil {
+			err = readDB.Ping()
+		}
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("open read database: %v", err)
+		}
+	}
+
+	DB, ReadDB = db, readDB
+	return nil
+}
+
+// primaryKey marks contexts whose reads must see their own writes
+type primaryKey struct{}
+
+// WithPrimary returns a context whose Reader is the primary database, for
+// reads that decide what to write or must see a write just made
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Reader returns the database read-only queries run against: ReadDB when
+// configured, unless ctx comes from WithPrimary, and otherwise DB. A
+// replica may lag behind the primary.
+func Reader(ctx context.Context) *sqlx.DB {
+	if ReadDB == nil || ctx.Value(primaryKey{}) != nil {
+		return DB
+	}
+	return ReadDB
+}
+
+// txKey carries the transaction of a context's queries
+type txKey struct{}
+
+// WithTx returns a context whose Queryer is tx, for reads that decide what
+// tx writes, so that they see the state it commits over
+func WithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// Queryer returns the transaction of a context from WithTx, and otherwise
+// its Reader
+func Queryer(ctx context.Context) sqlx.QueryerContext {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return Reader(ctx)
+}
+
+// Migrate applies all pending schema migrations to the given database
+func Migrate(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations failed: %v", err)
+	}
+
+	current, err := SchemaVersion(db)
 	if err != nil {
 		return err
 	}
 
-	DB = db
+	// Apply each pending migration in its own transaction
+	for version := current + 1; version <= len(migrations); version++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return fmt.Errorf("migration %d: begin failed: %v", version, err)
+		}
+		if _, err := tx.Exec(migrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: record version failed: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: commit failed: %v", version, err)
+		}
+	}
+	// Every run finishes a backfill an earlier run was stopped during; once
+	// done it finds no row to fill
+	if err := fillFingerprints(db); err != nil {
+		return fmt.Errorf("fill fingerprints failed: %v", err)
+	}
 	return nil
 }
+
+// SchemaVersion returns the latest migration version applied to the database
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	var version int
+	if err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"); err != nil {
+		return 0, fmt.Errorf("read schema version failed: %v", err)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the schema version this build expects
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
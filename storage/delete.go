@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DeleteScans removes the scans with the IDs and everything stored with
+// them: their vulnerabilities, components, dependency graphs, labels, and
+// custom field values. Original file content no remaining scan refers to
+// is removed too, as are cached fetch validators of files left without a
+// scan, so that a rescan fetches them again.
+func DeleteScans(ctx context.Context, tx *sqlx.Tx, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	list := inList(ids)
+	var vulns []int64
+	// vulnerabilities.scan_id is TEXT, so match it through the join
+	if err := tx.SelectContext(ctx, &vulns, `SELECT v.id FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE s.id IN (SELECT value FROM json_each(?))`, list); err != nil {
+		return err
+	}
+	repos, err := deletedRepos(ctx, tx, "SELECT DISTINCT COALESCE(repo, '') FROM scans WHERE id IN (SELECT value FROM json_each(?))", list)
+	if err != nil {
+		return err
+	}
+	if err := deleteVulnerabilities(ctx, tx, vulns); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM components WHERE scan_id IN (SELECT value FROM json_each(?))",
+		"DELETE FROM component_dependencies WHERE scan_id IN (SELECT value FROM json_each(?))",
+		"DELETE FROM scan_labels WHERE scan_id IN (SELECT value FROM json_each(?))",
+		"DELETE FROM custom_field_values WHERE target_id IN (SELECT value FROM json_each(?)) AND field IN (SELECT name FROM custom_fields WHERE target = '" + CustomFieldScan + "')",
+		`DELETE FROM fetch_cache WHERE EXISTS (SELECT 1 FROM scans s WHERE s.id IN (SELECT value FROM json_each(?1))
+			AND s.repo = fetch_cache.repo AND s.file_path = fetch_cache.path)
+			AND NOT EXISTS (SELECT 1 FROM scans s WHERE s.id NOT IN (SELECT value FROM json_each(?1))
+				AND s.repo = fetch_cache.repo AND s.file_path = fetch_cache.path)`,
+		"DELETE FROM scans WHERE id IN (SELECT value FROM json_each(?))",
+	} {
+		if _, err := tx.ExecContext(ctx, query, list); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM raw_files WHERE NOT EXISTS (SELECT 1 FROM scans s WHERE s.sha256 = raw_files.sha256)"); err != nil {
+		return err
+	}
+	return pruneFindings(ctx, tx, repos)
+}
+
+// DeleteVulnerabilities removes the stored findings with the IDs, with
+// their comments, triage history, and custom field values, and the unique
+// findings of their repositories that no stored vulnerability reports
+// anymore
+func DeleteVulnerabilities(ctx context.Context, tx *sqlx.Tx, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	repos, err := deletedRepos(ctx, tx, `SELECT DISTINCT COALESCE(s.repo, '') FROM vulnerabilities v
+		JOIN scans s ON s.id = v.scan_id WHERE v.id IN (SELECT value FROM json_each(?))`, inList(ids))
+	if err != nil {
+		return err
+	}
+	if err := deleteVulnerabilities(ctx, tx, ids); err != nil {
+		return err
+	}
+	return pruneFindings(ctx, tx, repos)
+}
+
+// DeleteVulnerability removes a stored finding with its comments and
+// triage history
+func DeleteVulnerability(ctx context.Context, tx sqlx.ExecerContext, id int64) error {
+	return deleteVulnerabilities(ctx, tx, []int64{id})
+}
+
+// deleteVulnerabilities removes the vulnerability rows with the IDs and
+// the rows that refer to them
+func deleteVulnerabilities(ctx context.Context, tx sqlx.ExecerContext, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, query := range []string{
+		"DELETE FROM vulnerability_comments WHERE vulnerability_id IN (SELECT value FROM json_each(?))",
+		"DELETE FROM triage_audit WHERE vulnerability_id IN (SELECT value FROM json_each(?))",
+		"DELETE FROM custom_field_values WHERE target_id IN (SELECT value FROM json_each(?)) AND field IN (SELECT name FROM custom_fields WHERE target = '" + CustomFieldVulnerability + "')",
+		"DELETE FROM vulnerabilities WHERE id IN (SELECT value FROM json_each(?))",
+	} {
+		if _, err := tx.ExecContext(ctx, query, inList(ids)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletedRepos returns the repositories the query selects, before the rows
+// it reads them from are deleted
+func deletedRepos(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) ([]string, error) {
+	repos := []string{}
+	err := tx.SelectContext(ctx, &repos, query, args...)
+	return repos, err
+}
+
+// pruneFindings removes the unique findings of the repositories that no
+// stored vulnerability reports anymore
+func pruneFindings(ctx context.Context, tx sqlx.ExecerContext, repos []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM findings WHERE repo IN (SELECT value FROM json_each(?))
+		AND NOT EXISTS (SELECT 1 FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+			WHERE COALESCE(s.repo, '') = findings.repo AND COALESCE(v.package_name, '') = findings.package_name
+				AND COALESCE(v.cve_id, '') = findings.cve_id)`, inList(repos))
+	return err
+}
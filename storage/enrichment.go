@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// UpsertCVEMetadata stores or replaces the NVD record for a CVE
+func UpsertCVEMetadata(ctx context.Context, db sqlx.ExecerContext, m models.CVEMetadata) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO cve_metadata (
+		cve_id, cvss_vector, cvss_score, cwe_ids, refs, description, last_modified, fetched_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(cve_id) DO UPDATE SET
+		cvss_vector = excluded.cvss_vector, cvss_score = excluded.cvss_score,
+		cwe_ids = excluded.cwe_ids, refs = excluded.refs, description = excluded.description,
+		last_modified = excluded.last_modified, fetched_at = excluded.fetched_at`,
+		m.CVEID, m.CVSSVector, m.CVSSScore, m.CWEIDs, m.References,
+		m.Description, m.LastModified, m.FetchedAt,
+	)
+	return err
+}
+
+// AttachCVEMetadata sets the NVD field of each vulnerability that has
+// stored metadata
+func AttachCVEMetadata(ctx context.Context, db sqlx.QueryerContext, vulns []models.Vulnerability) error {
+	if len(vulns) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, v := range vulns {
+		if !seen[v.CVEID] {
+			seen[v.CVEID] = true
+			ids = append(ids, v.CVEID)
+		}
+	}
+
+	var rows []models.CVEMetadata
+	err := Statements.SelectContext(ctx, db, &rows, `SELECT cve_id, cvss_vector, cvss_score, cwe_ids, refs,
+		description, last_modified, fetched_at FROM cve_metadata
+		WHERE cve_id IN (SELECT value FROM json_each(?))`, inList(ids))
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*models.CVEMetadata, len(rows))
+	for i := range rows {
+		byID[rows[i].CVEID] = &rows[i]
+	}
+	for i := range vulns {
+		vulns[i].NVD = byID[vulns[i].CVEID]
+	}
+	return nil
+}
+
+// AttachAliases sets the Aliases field of each vulnerability from the
+// identifiers table
+func AttachAliases(ctx context.Context, db sqlx.QueryerContext, vulns []models.Vulnerability) error {
+	if len(vulns) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, v := range vulns {
+		if !seen[v.CVEID] {
+			seen[v.CVEID] = true
+			ids = append(ids, v.CVEID)
+		}
+	}
+
+	var rows []struct {
+		Identifier string `db:"identifier"`
+		Alias      string `db:"alias"`
+	}
+	err := Statements.SelectContext(ctx, db, &rows, `SELECT identifier, alias FROM identifiers
+		WHERE identifier IN (SELECT value FROM json_each(?)) ORDER BY identifier, alias`, inList(ids))
+	if err != nil {
+		return err
+	}
+
+	aliases := make(map[string][]string)
+	for _, r := range rows {
+		aliases[r.Identifier] = append(aliases[r.Identifier], r.Alias)
+	}
+	for i := range vulns {
+		vulns[i].Aliases = aliases[vulns[i].CVEID]
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// FetchValidators are the HTTP validators of an ingested file version, sent
+// back on the next fetch so an unchanged file is not downloaded again
+type FetchValidators struct {
+	ETag         string `db:"etag"`
+	LastModified string `db:"last_modified"`
+}
+
+// GetFetchValidators returns the validators stored for a file, if any
+func GetFetchValidators(ctx context.Context, db sqlx.QueryerContext, repo, ref, path string) (FetchValidators, bool, error) {
+	var v FetchValidators
+	err := sqlx.GetContext(ctx, db, &v,
+		"SELECT etag, last_modified FROM fetch_cache WHERE repo = ? AND ref = ? AND path = ?", repo, ref, path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, false, nil
+	}
+	return v, err == nil, err
+}
+
+// SetFetchValidators stores the validators of a file's ingested version
+func SetFetchValidators(ctx context.Context, db sqlx.ExecerContext, repo, ref, path string, v FetchValidators) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO fetch_cache (repo, ref, path, etag, last_modified, fetched_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(repo, ref, path) DO UPDATE SET
+		etag = excluded.etag, last_modified = excluded.last_modified, fetched_at = excluded.fetched_at`,
+		repo, ref, path, v.ETag, v.LastModified, time.Now().UTC(),
+	)
+	return err
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// Finding statuses
+const (
+	FindingOpen     = "open"     // Reported by the latest scan of a repository file
+	FindingResolved = "resolved" // No longer reported by any latest scan
+)
+
+// FindingKey identifies a finding of a repository
+type FindingKey struct {
+	PackageName string
+	CVEID       string
+}
+
+// RepoFindingKeys returns the keys of every finding recorded for a
+// repository, whatever its status
+func RepoFindingKeys(ctx context.Context, q sqlx.QueryerContext, repo string) (map[FindingKey]bool, error) {
+	var rows []struct {
+		PackageName string `db:"package_name"`
+		CVEID       string `db:"cve_id"`
+	}
+	if err := sqlx.SelectContext(ctx, q, &rows, "SELECT package_name, cve_id FROM findings WHERE repo = ?", repo); err != nil {
+		return nil, err
+	}
+	keys := make(map[FindingKey]bool, len(rows))
+	for _, r := range rows {
+		keys[FindingKey{PackageName: r.PackageName, CVEID: r.CVEID}] = true
+	}
+	return keys, nil
+}
+
+// OpenFindingCounts returns the number of open findings of a repository by
+// upper-cased severity, "" counting those without one
+func OpenFindingCounts(ctx context.Context, q sqlx.QueryerContext, repo string) (map[string]int, error) {
+	var rows []struct {
+		Severity string `db:"severity"`
+		Count    int    `db:"count"`
+	}
+	err := sqlx.SelectContext(ctx, q, &rows, `SELECT UPPER(COALESCE(severity, '')) AS severity, COUNT(*) AS count
+		FROM findings WHERE repo = ? AND status = ? GROUP BY UPPER(COALESCE(severity, ''))`, repo, FindingOpen)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.Severity] = r.Count
+	}
+	return counts, nil
+}
+
+// recordFinding creates or refreshes the unique finding a stored row
+// belongs to, keyed by the scan's repository, the package, and the
+// vulnerability ID. Sightings may arrive out of order, so first_seen and
+// last_seen only ever widen. A resolved finding sighted again after its
+// resolution is reopened.
+func recordFinding(ctx context.Context, tx sqlx.ExecerContext, scanID int64, vuln models.Vulnerability) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO findings
+		(repo, package_name, cve_id, severity, status, first_seen, last_seen, last_scan_id)
+		SELECT COALESCE(repo, ''), ?, ?, ?, ?, scan_time, scan_time, id FROM scans WHERE id = ?
+		ON CONFLICT (repo, package_name, cve_id) DO UPDATE SET
+			severity = CASE WHEN excluded.last_seen >= findings.last_seen THEN excluded.severity ELSE findings.severity END,
+			last_scan_id = CASE WHEN excluded.last_seen >= findings.last_seen THEN excluded.last_scan_id ELSE findings.last_scan_id END,
+			status = CASE WHEN findings.status = ? AND excluded.last_seen >= findings.resolved_at THEN ? ELSE findings.status END,
+			resolved_at = CASE WHEN findings.status = ? AND excluded.last_seen >= findings.resolved_at THEN NULL ELSE findings.resolved_at END,
+			first_seen = MIN(findings.first_seen, excluded.first_seen),
+			last_seen = MAX(findings.last_seen, excluded.last_seen)`,
+		vuln.PackageName, vuln.CVEID, vuln.Severity, FindingOpen, scanID,
+		FindingResolved, FindingOpen, FindingResolved,
+	)
+	return err
+}
+
+// BackdateFinding widens the first sighting of a repository's finding back
+// to at, for history recorded before it was stored
+func BackdateFinding(ctx context.Context, tx sqlx.ExecerContext, repo, packageName, cveID string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE findings SET first_seen = MIN(first_seen, ?)
+		WHERE repo = ? AND package_name = ? AND cve_id = ?`, at, repo, packageName, cveID)
+	return err
+}
+
+// ResolveFindings marks the repository's open findings that no longer
+// appear in the latest ingest of any of its files as resolved at the given
+// time, returning how many were resolved. Call it after storing a rescan.
+// An ingest stores a row per scan result of the report, and all of them
+// count. An ingest with a scan flagged incomplete can't show a finding is
+// gone: each file's latest complete ingest counts, along with any ingests
+// after it.
+func ResolveFindings(ctx context.Context, tx sqlx.ExecerContext, repo string, at time.Time) (int64, error) {
+	res, err := tx.ExecContext(ctx, `UPDATE findings SET status = ?, resolved_at = ?
+		WHERE repo = ? AND status = ? AND NOT EXISTS (
+			SELECT 1 FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+			WHERE COALESCE(s.repo, '') = ? AND COALESCE(s.ingest_id, s.id) >= COALESCE((
+					SELECT MAX(COALESCE(c.ingest_id, c.id)) FROM scans c
+					WHERE COALESCE(c.repo, '') = ? AND c.file_path IS s.file_path AND NOT EXISTS (
+						SELECT 1 FROM scans i WHERE i.incomplete = 1
+							AND (i.id = COALESCE(c.ingest_id, c.id) OR i.ingest_id = COALESCE(c.ingest_id, c.id)))), 0)
+				AND COALESCE(v.package_name, '') = findings.package_name AND COALESCE(v.cve_id, '') = findings.cve_id)`,
+		FindingResolved, at, repo, FindingOpen, repo, repo,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+// fingerprintBatch is the number of stored rows fillFingerprints hashes
+// per round
+const fingerprintBatch = 1000
+
+// Fingerprint returns the stable identity of a finding: a SHA-256 hex
+// digest of the tenant and repository of its scan, its package URL without
+// the version, its vulnerability ID, and its location in the scanned
+// resource. It stays the same across rescans, upgrades to another affected
+// version, scanners identifying the package alike, and renames of the
+// report file, so triage state can follow the finding.
+func Fingerprint(tenant, repo string, vuln models.Vulnerability) string {
+	NormalizePackage(&vuln)
+	location := vuln.Location
+	if location != "" {
+		location = strings.TrimPrefix(path.Clean("/"+location), "/")
+	}
+	h := sha256.New()
+	for _, part := range []string{tenant, repo, purl.Unversioned(vuln.PURL), strings.ToUpper(vuln.CVEID), location} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scanOwner is the repository and tenant of a stored scan
+type scanOwner struct {
+	Repo   string `db:"repo"`
+	Tenant string `db:"tenant"`
+}
+
+// fingerprint returns the fingerprint of a finding stored under a scan.
+// A scan that isn't stored counts as belonging to no repository.
+func fingerprint(ctx context.Context, db sqlx.QueryerContext, scanID int64, vuln models.Vulnerability) (string, error) {
+	var owner scanOwner
+	err := sqlx.GetContext(ctx, db, &owner, "SELECT COALESCE(repo, '') AS repo, tenant FROM scans WHERE id = ?", scanID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return Fingerprint(owner.Tenant, owner.Repo, vuln), nil
+}
+
+// fillFingerprints hashes the fingerprints of rows stored before they were
+// recorded, which SQL alone can't compute
+func fillFingerprints(db *sqlx.DB) error {
+	for {
+		var rows []struct {
+			ID          int64  `db:"id"`
+			Tenant      string `db:"tenant"`
+			Repo        string `db:"repo"`
+			CVEID       string `db:"cve_id"`
+			PackageName string `db:"package_name"`
+			Ecosystem   string `db:"ecosystem"`
+			PURL        string `db:"purl"`
+			Location    string `db:"location"`
+		}
+		err := db.Select(&rows, `SELECT v.id, COALESCE(s.tenant, '') AS tenant, COALESCE(s.repo, '') AS repo,
+			COALESCE(v.cve_id, '') AS cve_id, COALESCE(v.package_name, '') AS package_name, v.ecosystem, v.purl, v.location
+			FROM vulnerabilities v LEFT JOIN scans s ON s.id = v.scan_id
+			WHERE v.fingerprint = '' LIMIT ?`, fingerprintBatch)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			fp := Fingerprint(r.Tenant, r.Repo, models.Vulnerability{CVEID: r.CVEID, PackageName: r.PackageName,
+				Ecosystem: r.Ecosystem, PURL: r.PURL, Location: r.Location})
+			if _, err := tx.Exec("UPDATE vulnerabilities SET fingerprint = ? WHERE id = ?", fp, r.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+}
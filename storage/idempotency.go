@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrIdempotencyMismatch is returned when an idempotency key is reused
+	// with a different request
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyInProgress is returned when the request that first used
+	// an idempotency key has not completed
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// IdempotencyKey identifies the requests of one actor and route sent with
+// the same Idempotency-Key header
+type IdempotencyKey struct {
+	Actor string
+	Route string
+	Key   string
+}
+
+// IdempotentResponse is the stored response of a request sent with an
+// idempotency key
+type IdempotentResponse struct {
+	Status      int    `db:"status"`       // HTTP status code
+	ContentType string `db:"content_type"` // Content-Type header
+	Location    string `db:"location"`     // Location header
+	Body        []byte `db:"body"`         // Response body
+}
+
+// ClaimIdempotencyKey reserves k for the request with the given hash and
+// returns nil, or returns the stored response of the request that reserved
+// it earlier. It fails with ErrIdempotencyMismatch when that request had a
+// different hash, and with ErrIdempotencyInProgress when it has not
+// completed within lease. Keys older than ttl are forgotten.
+func ClaimIdempotencyKey(ctx context.Context, db *sqlx.DB, k IdempotencyKey, hash string, ttl, lease time.Duration) (*IdempotentResponse, error) {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < ?", now.Add(-ttl)); err != nil {
+		return nil, err
+	}
+
+	var stored struct {
+		IdempotentResponse
+		RequestHash string    `db:"request_hash"`
+		CreatedAt   time.Time `db:"created_at"`
+	}
+	err = tx.GetContext(ctx, &stored, `SELECT status, content_type, location, body, request_hash, created_at
+		FROM idempotency_keys WHERE actor = ? AND route = ? AND key = ?`, k.Actor, k.Route, k.Key)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	case stored.RequestHash != hash:
+		return nil, ErrIdempotencyMismatch
+	case stored.Status != 0:
+		return &stored.IdempotentResponse, nil
+	case stored.CreatedAt.After(now.Add(-lease)):
+		return nil, ErrIdempotencyInProgress
+	}
+
+	// Reserve the key, taking over a request abandoned past its lease
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO idempotency_keys
+		(actor, route, key, request_hash, created_at) VALUES (?, ?, ?, ?, ?)`, k.Actor, k.Route, k.Key, hash, now)
+	if err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed k
+func CompleteIdempotencyKey(ctx context.Context, db *sqlx.DB, k IdempotencyKey, resp IdempotentResponse) error {
+	_, err := db.ExecContext(ctx, `UPDATE idempotency_keys SET status = ?, content_type = ?, location = ?, body = ?
+		WHERE actor = ? AND route = ? AND key = ?`,
+		resp.Status, resp.ContentType, resp.Location, resp.Body, k.Actor, k.Route, k.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets k, so a retry with it runs again
+func ReleaseIdempotencyKey(ctx context.Context, db *sqlx.DB, k IdempotencyKey) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE actor = ? AND route = ? AND key = ?",
+		k.Actor, k.Route, k.Key)
+	return err
+}
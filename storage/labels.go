@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// InsertScanLabels stores the labels attached to a scan
+func InsertScanLabels(ctx context.Context, tx *sqlx.Tx, scanID int64, labels map[string]string) error {
+	for key, value := range labels {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO scan_labels (scan_id, key, value) VALUES (?, ?, ?)",
+			scanID, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LabelFilter returns a condition, and its arguments, matching rows whose
+// scan, given by the scanID column, carries every one of the labels
+func LabelFilter(scanID string, labels map[string]string) (string, []interface{}) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	for _, key := range keys {
+		conds = append(conds, "EXISTS (SELECT 1 FROM scan_labels l WHERE l.scan_id = "+scanID+" AND l.key = ? AND l.value = ?)")
+		args = append(args, key, labels[key])
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// AttachLabels sets the labels of the scan each vulnerability belongs to
+func AttachLabels(ctx context.Context, db sqlx.QueryerContext, vulns []models.Vulnerability) error {
+	if len(vulns) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(vulns))
+	for i, v := range vulns {
+		ids[i] = v.FindingID
+	}
+	var rows []struct {
+		ID    int64  `db:"id"`
+		Key   string `db:"key"`
+		Value string `db:"value"`
+	}
+	err := Statements.SelectContext(ctx, db, &rows, `SELECT v.id, l.key, l.value FROM vulnerabilities v
+		JOIN scan_labels l ON l.scan_id = v.scan_id WHERE v.id IN (SELECT value FROM json_each(?))`, inList(ids))
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[int64]map[string]string)
+	for _, r := range rows {
+		if labels[r.ID] == nil {
+			labels[r.ID] = make(map[string]string)
+		}
+		labels[r.ID][r.Key] = r.Value
+	}
+	for i := range vulns {
+		vulns[i].Labels = labels[vulns[i].FindingID]
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AcquireLease takes or renews the named lease for holder until ttl from
+// now, reporting whether holder has it. A lease held by another holder
+// can only be taken once it has expired.
+func AcquireLease(ctx context.Context, db *sqlx.DB, name, holder string, ttl time.Duration) (bool, error) {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx, `INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?`,
+		name, holder, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseLease gives up the named lease if holder has it, so another
+// holder can take it without waiting for it to expire
+func ReleaseLease(ctx context.Context, db *sqlx.DB, name, holder string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM leases WHERE name = ? AND holder = ?", name, holder)
+	return err
+}
+
+// LeaseHolder returns the holder of the named lease and when it expires,
+// or an empty holder when nobody holds it
+func LeaseHolder(ctx context.Context, db *sqlx.DB, name string) (string, time.Time, error) {
+	var lease struct {
+		Holder    string    `db:"holder"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := db.GetContext(ctx, &lease, "SELECT holder, expires_at FROM leases WHERE name = ? AND expires_at >= ?",
+		name, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	return lease.Holder, lease.ExpiresAt, err
+}
+
+// ClaimJobRun claims the run of the named job that is due now for holder,
+// reporting whether it was claimed. A claimed job can't be claimed again
+// until nearly interval has passed; a tenth of it is left as slack, so the
+// holder's own next tick isn't missed by a few milliseconds.
+func ClaimJobRun(ctx context.Context, db *sqlx.DB, name, holder string, interval time.Duration) (bool, error) {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx, `INSERT INTO job_claims (name, holder, claimed_at, next_run) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, claimed_at = excluded.claimed_at, next_run = excluded.next_run
+		WHERE job_claims.next_run <= excluded.claimed_at`,
+		name, holder, now, now.Add(interval-interval/10))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// MaintenanceOptions selects the work of a maintenance run
+type MaintenanceOptions struct {
+	VacuumPages int  // Free pages an incremental vacuum releases at most (0 for all)
+	FullVacuum  bool // Rebuild the file with VACUUM instead, switching it to incremental vacuum
+}
+
+// ErrMaintenanceRunning is returned when a maintenance run is already in
+// progress
+var ErrMaintenanceRunning = errs.New(errs.ErrConflict, "database maintenance already running")
+
+// maxIntegrityErrors bounds the problems integrity_check reports
+const maxIntegrityErrors = 100
+
+// autoVacuumModes names the values of PRAGMA auto_vacuum
+var autoVacuumModes = []string{"none", "full", "incremental"}
+
+var (
+	maintaining     sync.Mutex // Held for the duration of a run
+	maintenanceMu   sync.Mutex // Guards lastMaintenance
+	lastMaintenance *models.MaintenanceResult
+)
+
+// Maintain checkpoints the write-ahead log into the database file,
+// releases free pages to the filesystem, refreshes the query planner's
+// statistics, and checks the file's integrity, in that order. Free pages
+// are only released from files in incremental vacuum mode, which new
+// databases opened with DefaultDSN use; FullVacuum switches others by
+// rebuilding the file, which takes the write lock for as long as the
+// rebuild and needs free disk space for a copy of the database. Steps that
+// write wait for LockWrites. The result is kept for LastMaintenance, with
+// the error of a step that failed.
+func Maintain(ctx context.Context, db *sqlx.DB, opts MaintenanceOptions) (models.MaintenanceResult, error) {
+	if !maintaining.TryLock() {
+		return models.MaintenanceResult{}, ErrMaintenanceRunning
+	}
+	defer maintaining.Unlock()
+
+	start := time.Now()
+	res := models.MaintenanceResult{StartedAt: start.UTC(), Integrity: []string{}}
+	err := maintain(ctx, db, opts, &res)
+	res.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	maintenanceMu.Lock()
+	lastMaintenance = &res
+	maintenanceMu.Unlock()
+	return res, err
+}
+
+// LastMaintenance returns the result of the latest maintenance run, if any
+// has run since the process started
+func LastMaintenance() (models.MaintenanceResult, bool) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if lastMaintenance == nil {
+		return models.MaintenanceResult{}, false
+	}
+	return *lastMaintenance, true
+}
+
+// maintain runs the steps of Maintain on one connection, since PRAGMA
+// settings apply per connection
+func maintain(ctx context.Context, db *sqlx.DB, opts MaintenanceOptions, res *models.MaintenanceResult) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// A database without a write-ahead log reports -1 frames
+	err = withWriteLock(ctx, func() error {
+		var busy int
+		err := conn.QueryRowxContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &res.WALFrames, &res.CheckpointedFrames)
+		res.CheckpointBusy = busy != 0
+		res.WALFrames, res.CheckpointedFrames = max(res.WALFrames, 0), max(res.CheckpointedFrames, 0)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("checkpoint failed: %v", err)
+	}
+
+	if err := withWriteLock(ctx, func() error { return vacuum(ctx, conn, opts, res) }); err != nil {
+		return fmt.Errorf("vacuum failed: %v", err)
+	}
+
+	if err := withWriteLock(ctx, func() error {
+		_, err := conn.ExecContext(ctx, "ANALYZE")
+		return err
+	}); err != nil {
+		return fmt.Errorf("analyze failed: %v", err)
+	}
+	res.Analyzed = true
+
+	if err := sqlx.SelectContext(ctx, conn, &res.Integrity, fmt.Sprintf("PRAGMA integrity_check(%d)", maxIntegrityErrors)); err != nil {
+		return fmt.Errorf("integrity check failed: %v", err)
+	}
+
+	size, free, err := databaseSize(ctx, conn)
+	res.SizeBytes, res.FreeBytes = size, free
+	return err
+}
+
+// vacuum releases free pages as the options and the file's vacuum mode
+// allow
+func vacuum(ctx context.Context, conn *sqlx.Conn, opts MaintenanceOptions, res *models.MaintenanceResult) error {
+	var mode, before, after int
+	if err := conn.GetContext(ctx, &mode, "PRAGMA auto_vacuum"); err != nil {
+		return err
+	}
+	if err := conn.GetContext(ctx, &before, "PRAGMA freelist_count"); err != nil {
+		return err
+	}
+
+	switch {
+	case opts.FullVacuum:
+		// The mode takes effect when VACUUM rebuilds the file
+		if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+			return err
+		}
+		res.FullVacuum = true
+		if err := conn.GetContext(ctx, &mode, "PRAGMA auto_vacuum"); err != nil {
+			return err
+		}
+	case mode == 2:
+		// Each step releases one page
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", max(opts.VacuumPages, 0)))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.GetContext(ctx, &after, "PRAGMA freelist_count"); err != nil {
+		return err
+	}
+	if mode >= 0 && mode < len(autoVacuumModes) {
+		res.AutoVacuum = autoVacuumModes[mode]
+	}
+	res.VacuumedPages = max(before-after, 0)
+	return nil
+}
+
+// withWriteLock runs fn during the writer's turn
+func withWriteLock(ctx context.Context, fn func() error) error {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// DatabaseSize returns the size of the database file and how much of it
+// is free pages, in bytes
+func DatabaseSize(ctx context.Context, db *sqlx.DB) (int64, int64, error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	return databaseSize(ctx, conn)
+}
+
+// databaseSize is DatabaseSize on a connection
+func databaseSize(ctx context.Context, conn *sqlx.Conn) (int64, int64, error) {
+	var pageSize, pages, free int64
+	for _, p := range []struct {
+		pragma string
+		value  *int64
+	}{
+		{"page_size", &pageSize},
+		{"page_count", &pages},
+		{"freelist_count", &free},
+	} {
+		if err := conn.GetContext(ctx, p.value, "PRAGMA "+p.pragma); err != nil {
+			return 0, 0, err
+		}
+	}
+	return pages * pageSize, free * pageSize, nil
+}
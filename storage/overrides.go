@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// OverrideSeverity is a SQL expression for the severity severity overrides
+// give vulnerability row v, reported by scan row s, or NULL when no rule
+// matches. A rule naming the vulnerability wins over one matching a risk
+// factor, one scoped to the repository's organization over a global one,
+// and a newer over an older.
+const OverrideSeverity = `(SELECT o.severity FROM severity_overrides o
+		WHERE (o.cve_id = '' OR o.cve_id = v.cve_id)
+			AND (o.risk_factor = '' OR EXISTS (SELECT 1 FROM json_each(v.risk_factors) rf
+				WHERE LOWER(rf.value) = LOWER(o.risk_factor)))
+			AND (o.org = '' OR s.repo LIKE 'https://github.com/' || o.org || '/%')
+		ORDER BY o.cve_id = '', o.org = '', o.id DESC LIMIT 1)`
+
+// NVDSeverity is a SQL expression for the severity NVD rates vulnerability
+// row v with: the CVSS v3 qualitative rating of the base score fetched by
+// enrichment, or NULL without one
+const NVDSeverity = `(SELECT CASE WHEN m.cvss_score >= 9 THEN 'CRITICAL' WHEN m.cvss_score >= 7 THEN 'HIGH'
+		WHEN m.cvss_score >= 4 THEN 'MEDIUM' WHEN m.cvss_score > 0 THEN 'LOW' END
+		FROM cve_metadata m WHERE m.cve_id = v.cve_id)`
+
+// EffectiveSeverity is a SQL expression for the severity of vulnerability
+// row v, reported by scan row s, that findings are judged by. The first of
+// these opinions applies: a severity override, the severity the scanner
+// reported unless it is empty or UNKNOWN, NVD's rating, and the reported
+// severity as is.
+const EffectiveSeverity = `COALESCE(` + OverrideSeverity + `,
+		CASE WHEN UPPER(COALESCE(v.severity, '')) NOT IN ('', 'UNKNOWN') THEN v.severity END,
+		` + NVDSeverity + `, v.severity)`
+
+// severityOverrideColumns are the columns of a SeverityOverride
+const severityOverrideColumns = "id, org, cve_id, risk_factor, severity, reason, created_by, created_at"
+
+// InsertSeverityOverride stores a rule, setting its ID and creation time
+func InsertSeverityOverride(ctx context.Context, db *sqlx.DB, o *models.SeverityOverride) error {
+	o.CreatedAt = time.Now().UTC()
+	res, err := db.NamedExecContext(ctx, `INSERT INTO severity_overrides (org, cve_id, risk_factor, severity, reason, created_by, created_at)
+		VALUES (:org, :cve_id, :risk_factor, :severity, :reason, :created_by, :created_at)`, o)
+	if err != nil {
+		return err
+	}
+	o.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetSeverityOverride returns the rule with the ID, or ErrNotFound
+func GetSeverityOverride(ctx context.Context, db *sqlx.DB, id int64) (models.SeverityOverride, error) {
+	var o models.SeverityOverride
+	err := db.GetContext(ctx, &o, "SELECT "+severityOverrideColumns+" FROM severity_overrides WHERE id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return o, ErrNotFound
+	}
+	return o, err
+}
+
+// ListSeverityOverrides returns every rule, oldest first
+func ListSeverityOverrides(ctx context.Context, db *sqlx.DB) ([]models.SeverityOverride, error) {
+	overrides := []models.SeverityOverride{}
+	err := db.SelectContext(ctx, &overrides, "SELECT "+severityOverrideColumns+" FROM severity_overrides ORDER BY id")
+	return overrides, err
+}
+
+// DeleteSeverityOverride removes the rule with the ID, or returns
+// ErrNotFound
+func DeleteSeverityOverride(ctx context.Context, db *sqlx.DB, id int64) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM severity_overrides WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// SavedQuery is a stored, named set of query filters
+type SavedQuery struct {
+	Name        string            `db:"name"`
+	Description string            `db:"description"`
+	Filters     string            `db:"filters"` // JSON-encoded query filters
+	Columns     models.StringList `db:"columns"` // Export columns, in order
+	CreatedAt   time.Time         `db:"created_at"`
+	UpdatedAt   time.Time         `db:"updated_at"`
+}
+
+// savedQueryColumns are the columns of a SavedQuery
+const savedQueryColumns = "name, description, filters, columns, created_at, updated_at"
+
+// UpsertSavedQuery stores a query under its name, replacing one of the
+// same name, and reports whether it was newly created
+func UpsertSavedQuery(ctx context.Context, db *sqlx.DB, q *SavedQuery) (bool, error) {
+	now := time.Now().UTC()
+	q.UpdatedAt = now
+
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &q.CreatedAt, "SELECT created_at FROM saved_queries WHERE name = ?", q.Name)
+	created := errors.Is(err, sql.ErrNoRows)
+	if created {
+		q.CreatedAt = now
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = tx.NamedExecContext(ctx, `INSERT INTO saved_queries (`+savedQueryColumns+`)
+		VALUES (:name, :description, :filters, :columns, :created_at, :updated_at)
+		ON CONFLICT (name) DO UPDATE SET description = excluded.description, filters = excluded.filters,
+			columns = excluded.columns, updated_at = excluded.updated_at`, q)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// GetSavedQuery returns the query saved under name, or ErrNotFound
+func GetSavedQuery(ctx context.Context, db *sqlx.DB, name string) (SavedQuery, error) {
+	var q SavedQuery
+	err := db.GetContext(ctx, &q, "SELECT "+savedQueryColumns+" FROM saved_queries WHERE name = ?", name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q, ErrNotFound
+	}
+	return q, err
+}
+
+// ListSavedQueries returns every saved query ordered by name
+func ListSavedQueries(ctx context.Context, db *sqlx.DB) ([]SavedQuery, error) {
+	var queries []SavedQuery
+	err := db.SelectContext(ctx, &queries, "SELECT "+savedQueryColumns+" FROM saved_queries ORDER BY name")
+	return queries, err
+}
+
+// DeleteSavedQuery removes the query saved under name, or returns
+// ErrNotFound
+func DeleteSavedQuery(ctx context.Context, db *sqlx.DB, name string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM saved_queries WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
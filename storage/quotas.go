@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CountQuotaFile counts one more file ingested by tenant on day unless it
+// already ingested limit files that day, reporting whether it was counted.
+// A limit of 0 counts every file.
+func CountQuotaFile(ctx context.Context, db *sqlx.DB, tenant, day string, limit int) (bool, error) {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	res, err := db.ExecContext(ctx, `INSERT INTO quota_usage (tenant, day, files) VALUES (?, ?, 1)
+		ON CONFLICT (tenant, day) DO UPDATE SET files = files + 1
+		WHERE ? = 0 OR quota_usage.files < ?`,
+		tenant, day, limit, limit)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UncountQuotaFile takes back one file counted against tenant on day by
+// CountQuotaFile
+func UncountQuotaFile(ctx context.Context, db *sqlx.DB, tenant, day string) error {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = db.ExecContext(ctx, "UPDATE quota_usage SET files = files - 1 WHERE tenant = ? AND day = ? AND files > 0", tenant, day)
+	return err
+}
+
+// QuotaFiles returns the number of files tenant ingested on day
+func QuotaFiles(ctx context.Context, db sqlx.QueryerContext, tenant, day string) (int, error) {
+	var files int
+	err := sqlx.GetContext(ctx, db, &files, "SELECT files FROM quota_usage WHERE tenant = ? AND day = ?", tenant, day)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return files, err
+}
+
+// TenantRows returns the number of vulnerability and component rows stored
+// for the scans of tenant
+func TenantRows(ctx context.Context, db sqlx.QueryerContext, tenant string) (int, error) {
+	var rows int
+	err := sqlx.GetContext(ctx, db, &rows, `SELECT
+		(SELECT COUNT(*) FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id WHERE s.tenant = ?) +
+		(SELECT COUNT(*) FROM components c JOIN scans s ON s.id = c.scan_id WHERE s.tenant = ?)`,
+		tenant, tenant)
+	return rows, err
+}
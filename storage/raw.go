@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/encrypt"
+)
+
+// Raw file encodings
+const (
+	RawIdentity = "identity" // Stored as fetched
+	RawGzip     = "gzip"     // Gzip-compressed
+)
+
+// rawEncrypted is appended to the encoding of raw files stored encrypted
+const rawEncrypted = "+aes-256-gcm"
+
+// EncryptionKey, when set, encrypts the original content of files stored
+// from now on. Content stored encrypted can only be read with the key.
+var EncryptionKey *encrypt.Key
+
+// PutRawFile stores the original content of an ingested file under its
+// SHA-256, compressed when encoding is RawGzip and encrypted when
+// EncryptionKey is set. Content already stored is left as is.
+func PutRawFile(ctx context.Context, tx sqlx.ExecerContext, sha256, encoding string, content []byte) error {
+	data := content
+	switch encoding {
+	case RawGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(content); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	case RawIdentity:
+	default:
+		return fmt.Errorf("unknown raw file encoding %q", encoding)
+	}
+	if EncryptionKey != nil {
+		sealed, err := encrypt.Seal(EncryptionKey, data)
+		if err != nil {
+			return err
+		}
+		data, encoding = sealed, encoding+rawEncrypted
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO raw_files (sha256, encoding, size, content, created_at)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (sha256) DO NOTHING`,
+		sha256, encoding, len(content), data, time.Now().UTC())
+	return err
+}
+
+// GetRawFile returns the original content stored under a SHA-256, or
+// ErrNotFound
+func GetRawFile(ctx context.Context, db sqlx.QueryerContext, sha256 string) ([]byte, error) {
+	var row struct {
+		Encoding string `db:"encoding"`
+		Content  []byte `db:"content"`
+	}
+	err := sqlx.GetContext(ctx, db, &row, "SELECT encoding, content FROM raw_files WHERE sha256 = ?", sha256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if enc, ok := strings.CutSuffix(row.Encoding, rawEncrypted); ok {
+		if EncryptionKey == nil {
+			return nil, errors.New("raw file is encrypted and no encryption key is configured")
+		}
+		if row.Content, err = encrypt.Open(EncryptionKey, row.Content); err != nil {
+			return nil, err
+		}
+		row.Encoding = enc
+	}
+
+	switch row.Encoding {
+	case RawIdentity:
+		return row.Content, nil
+	case RawGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(row.Content))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown raw file encoding %q", row.Encoding)
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// ErrRepoAliasCycle is returned for an alias of a repository to itself,
+// directly or through another alias
+var ErrRepoAliasCycle = errs.New(errs.ErrConflict, "alias would map the repository to itself")
+
+// mergeRepoAliases moves the rows stored under aliased URLs to their
+// canonical repositories. Findings of the same package and vulnerability
+// merge into one, first seen when the earliest was and otherwise in the
+// state of the most recently seen; cache entries and registrations already
+// present under the canonical URL win. Migration 33 runs it too.
+const mergeRepoAliases = `
+	UPDATE scans SET repo = a.repo FROM repo_aliases a WHERE scans.repo = a.alias;
+	UPDATE OR IGNORE findings SET repo = a.repo FROM repo_aliases a WHERE findings.repo = a.alias;
+	UPDATE findings SET first_seen = m.first_seen, last_seen = m.last_seen, last_scan_id = m.last_scan_id,
+		severity = m.severity, status = m.status, resolved_at = m.resolved_at
+	FROM (SELECT * FROM (
+		SELECT COALESCE(a.repo, f.repo) AS repo, f.package_name, f.cve_id, MIN(f.first_seen) OVER w AS first_seen,
+			f.last_seen, f.last_scan_id, f.severity, f.status, f.resolved_at, COUNT(*) OVER w AS n,
+			ROW_NUMBER() OVER (w ORDER BY f.last_seen DESC, f.id DESC) AS latest
+		FROM findings f LEFT JOIN repo_aliases a ON a.alias = f.repo
+		WINDOW w AS (PARTITION BY COALESCE(a.repo, f.repo), f.package_name, f.cve_id))
+		WHERE n > 1 AND latest = 1) AS m
+	WHERE findings.repo = m.repo AND findings.package_name = m.package_name AND findings.cve_id = m.cve_id;
+	DELETE FROM findings WHERE repo IN (SELECT alias FROM repo_aliases);
+	UPDATE OR IGNORE fetch_cache SET repo = a.repo FROM repo_aliases a WHERE fetch_cache.repo = a.alias;
+	DELETE FROM fetch_cache WHERE repo IN (SELECT alias FROM repo_aliases);
+	UPDATE OR IGNORE repositories SET url = a.repo FROM repo_aliases a WHERE repositories.url = a.alias;
+	DELETE FROM repositories WHERE url IN (SELECT alias FROM repo_aliases);
+	`
+
+// LookupRepoAlias returns the canonical URL of an aliased repository, or
+// false when the URL is not an alias
+func LookupRepoAlias(ctx context.Context, db sqlx.QueryerContext, alias string) (string, bool, error) {
+	var repo string
+	err := sqlx.GetContext(ctx, db, &repo, "SELECT repo FROM repo_aliases WHERE alias = ?", alias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return repo, err == nil, err
+}
+
+// ListRepoAliases returns the aliases ordered by URL, optionally only those
+// of one repository
+func ListRepoAliases(ctx context.Context, db *sqlx.DB, repo string) ([]models.RepoAlias, error) {
+	query, args := "SELECT alias, repo, created_at FROM repo_aliases", []interface{}{}
+	if repo != "" {
+		query += " WHERE repo = ?"
+		args = append(args, repo)
+	}
+	aliases := []models.RepoAlias{}
+	err := db.SelectContext(ctx, &aliases, query+" ORDER BY alias", args...)
+	return aliases, err
+}
+
+// AddRepoAlias maps an alias to a repository, or to the repository that one
+// is itself an alias of, and moves the rows stored under the alias, and
+// under the aliases it had as a repository, to it. It returns
+// ErrRepoAliasCycle when the repository resolves to the alias.
+func AddRepoAlias(ctx context.Context, db *sqlx.DB, a *models.RepoAlias) error {
+	a.CreatedAt = time.Now().UTC()
+
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if repo, ok, err := LookupRepoAlias(ctx, tx, a.Repo); err != nil {
+		return err
+	} else if ok {
+		a.Repo = repo
+	}
+	if a.Repo == a.Alias {
+		return ErrRepoAliasCycle
+	}
+	if _, err := tx.NamedExecContext(ctx, `INSERT INTO repo_aliases (alias, repo, created_at)
+		VALUES (:alias, :repo, :created_at)
+		ON CONFLICT (alias) DO UPDATE SET repo = excluded.repo, created_at = excluded.created_at`, a); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE repo_aliases SET repo = ? WHERE repo = ?", a.Repo, a.Alias); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mergeRepoAliases); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteRepoAlias removes an alias, or returns ErrNotFound. Rows already
+// moved to its repository stay there.
+func DeleteRepoAlias(ctx context.Context, db *sqlx.DB, alias string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM repo_aliases WHERE alias = ?", alias)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// repositoryColumns are the columns of a models.Repository
+const repositoryColumns = "url, team, contact, tier, files, patterns, labels, created_at, updated_at"
+
+// UpsertRepository registers a repository or replaces its registration,
+// reporting whether it was newly created
+func UpsertRepository(ctx context.Context, db *sqlx.DB, repo *models.Repository) (bool, error) {
+	now := time.Now().UTC()
+	repo.UpdatedAt = now
+
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &repo.CreatedAt, "SELECT created_at FROM repositories WHERE url = ?", repo.URL)
+	created := errors.Is(err, sql.ErrNoRows)
+	if created {
+		repo.CreatedAt = now
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = tx.NamedExecContext(ctx, `INSERT INTO repositories (`+repositoryColumns+`)
+		VALUES (:url, :team, :contact, :tier, :files, :patterns, :labels, :created_at, :updated_at)
+		ON CONFLICT (url) DO UPDATE SET team = excluded.team, contact = excluded.contact,
+			tier = excluded.tier, files = excluded.files, patterns = excluded.patterns,
+			labels = excluded.labels, updated_at = excluded.updated_at`, repo)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// GetRepository returns the registration of a repository, or ErrNotFound
+func GetRepository(ctx context.Context, db sqlx.QueryerContext, url string) (models.Repository, error) {
+	var repo models.Repository
+	err := sqlx.GetContext(ctx, db, &repo, "SELECT "+repositoryColumns+" FROM repositories WHERE url = ?", url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repo, ErrNotFound
+	}
+	return repo, err
+}
+
+// FindRepository returns the registration of a repository given without
+// its scheme, e.g. github.com/owner/name, or ErrNotFound
+func FindRepository(ctx context.Context, db *sqlx.DB, path string) (models.Repository, error) {
+	path = strings.TrimSuffix(path, "/")
+	query, args, err := sqlx.In("SELECT "+repositoryColumns+" FROM repositories WHERE url IN (?) LIMIT 1",
+		[]string{path, "https://" + path, "http://" + path})
+	if err != nil {
+		return models.Repository{}, err
+	}
+	var repo models.Repository
+	err = db.GetContext(ctx, &repo, db.Rebind(query), args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repo, ErrNotFound
+	}
+	return repo, err
+}
+
+// ListRepositories returns the registered repositories ordered by URL,
+// optionally only those of one team
+func ListRepositories(ctx context.Context, db *sqlx.DB, team string) ([]models.Repository, error) {
+	query, args := "SELECT "+repositoryColumns+" FROM repositories", []interface{}{}
+	if team != "" {
+		query += " WHERE team = ?"
+		args = append(args, team)
+	}
+	repos := []models.Repository{}
+	err := db.SelectContext(ctx, &repos, query+" ORDER BY url", args...)
+	return repos, err
+}
+
+// DeleteRepository removes a registration, or returns ErrNotFound. Scans
+// of the repository are kept.
+func DeleteRepository(ctx context.Context, db *sqlx.DB, url string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM repositories WHERE url = ?", url)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
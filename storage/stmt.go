@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultStatementCacheSize is the number of prepared statements Statements
+// keeps before evicting the least recently used
+const DefaultStatementCacheSize = 256
+
+// Statements caches the prepared statements of hot queries by database and
+// query text, so SQLite parses and plans each query shape once rather than
+// on every request
+var Statements = NewStatementCache(DefaultStatementCacheSize)
+
+// StatementCacheStats counts statement cache lookups
+type StatementCacheStats struct {
+	Hits       int64 // Queries that reused a prepared statement
+	Misses     int64 // Queries that prepared a statement
+	Statements int   // Statements currently cached
+}
+
+// StatementCache is a bounded, least recently used cache of prepared
+// statements. Evicted statements are closed once no query is using them.
+type StatementCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[stmtKey]*list.Element
+	lru     *list.List // Of *stmtEntry, most recently used first
+	stats   StatementCacheStats
+}
+
+// stmtKey identifies a statement by the database it was prepared on and
+// its query text
+type stmtKey struct {
+	db    *sqlx.DB
+	query string
+}
+
+// stmtEntry is a cached statement and the queries using it
+type stmtEntry struct {
+	key     stmtKey
+	stmt    *sqlx.Stmt
+	refs    int  // Queries currently running the statement
+	evicted bool // Removed from the cache; closed when refs drops to 0
+}
+
+// NewStatementCache returns a cache holding up to size statements; with a
+// size of 0 or less, queries run unprepared
+func NewStatementCache(size int) *StatementCache {
+	return &StatementCache{size: size, entries: map[stmtKey]*list.Element{}, lru: list.New()}
+}
+
+// Resize changes the number of statements kept, evicting the least
+// recently used ones beyond it
+func (c *StatementCache) Resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+// Stats returns the cache's lookup counts and size
+func (c *StatementCache) Stats() StatementCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Statements = c.lru.Len()
+	return stats
+}
+
+// SelectContext runs query on db through a cached prepared statement,
+// scanning the rows into dest like sqlx.SelectContext. Queries in a
+// transaction run unprepared.
+func (c *StatementCache) SelectContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	db, ok := q.(*sqlx.DB)
+	if !ok {
+		return sqlx.SelectContext(ctx, q, dest, query, args...)
+	}
+	e, err := c.acquire(ctx, db, query)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return db.SelectContext(ctx, dest, query, args...)
+	}
+	defer c.release(e)
+	return e.stmt.SelectContext(ctx, dest, args...)
+}
+
+// GetContext runs query on db through a cached prepared statement,
+// scanning the single row into dest like sqlx.GetContext. Queries in a
+// transaction run unprepared.
+func (c *StatementCache) GetContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	db, ok := q.(*sqlx.DB)
+	if !ok {
+		return sqlx.GetContext(ctx, q, dest, query, args...)
+	}
+	e, err := c.acquire(ctx, db, query)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return db.GetContext(ctx, dest, query, args...)
+	}
+	defer c.release(e)
+	return e.stmt.GetContext(ctx, dest, args...)
+}
+
+// acquire returns the statement of query on db, preparing it on a miss. It
+// returns nil when caching is disabled.
+func (c *StatementCache) acquire(ctx context.Context, db *sqlx.DB, query string) (*stmtEntry, error) {
+	key := stmtKey{db, query}
+	c.mu.Lock()
+	if c.size <= 0 {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	if el, ok := c.entries[key]; ok {
+		c.stats.Hits++
+		c.lru.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Prepare outside the lock; a concurrent miss on the same query keeps
+	// whichever statement is cached first
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		stmt.Close()
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		return e, nil
+	}
+	e := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	c.entries[key] = c.lru.PushFront(e)
+	c.evict()
+	return e, nil
+}
+
+// release ends a query's use of a statement, closing it if it was evicted
+func (c *StatementCache) release(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// evict removes the least recently used statements beyond the cache size.
+// c.mu must be held.
+func (c *StatementCache) evict() {
+	for c.lru.Len() > max(c.size, 0) {
+		e := c.lru.Remove(c.lru.Back()).(*stmtEntry)
+		delete(c.entries, e.key)
+		e.evicted = true
+		if e.refs == 0 {
+			e.stmt.Close()
+		}
+	}
+}
+
+// inList encodes values as the JSON array argument of an
+// "IN (SELECT value FROM json_each(?))" condition. Unlike an expanded IN
+// list it keeps one query shape, and one cached statement, for any number
+// of values.
+func inList(values interface{}) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// ErrNotFound is returned when a referenced row does not exist
+var ErrNotFound = errs.ErrNotFound
+
+// TriageState is the mutable triage state of one vulnerability
+type TriageState struct {
+	Status   string `db:"triage_status"`
+	Assignee string `db:"assignee"`
+}
+
+// GetTriageState returns the triage state of a vulnerability row
+func GetTriageState(ctx context.Context, db sqlx.QueryerContext, id int64) (TriageState, error) {
+	var st TriageState
+	err := sqlx.GetContext(ctx, db, &st, "SELECT triage_status, assignee FROM vulnerabilities WHERE id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return st, ErrNotFound
+	}
+	return st, err
+}
+
+// SetTriageField updates one triage column and records the change in the
+// audit trail. field must be "triage_status" or "assignee".
+func SetTriageField(ctx context.Context, tx *sqlx.Tx, id int64, actor, field, oldValue, newValue string) error {
+	if field != "triage_status" && field != "assignee" {
+		return errors.New("unknown triage field " + field)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE vulnerabilities SET "+field+" = ? WHERE id = ?", newValue, id); err != nil {
+		return err
+	}
+	return insertTriageEvent(ctx, tx, id, actor, field, oldValue, newValue)
+}
+
+// AddComment stores a comment and records it in the audit trail
+func AddComment(ctx context.Context, tx *sqlx.Tx, id int64, author, body string) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO vulnerability_comments (vulnerability_id, author, body, created_at) VALUES (?, ?, ?, ?)",
+		id, author, body, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return insertTriageEvent(ctx, tx, id, author, "comment", "", body)
+}
+
+// insertTriageEvent appends an audit trail entry
+func insertTriageEvent(ctx context.Context, tx *sqlx.Tx, id int64, actor, field, oldValue, newValue string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO triage_audit
+		(vulnerability_id, actor, field, old_value, new_value, changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, actor, field, oldValue, newValue, time.Now().UTC())
+	return err
+}
+
+// ListComments returns the comments on a vulnerability, oldest first
+func ListComments(ctx context.Context, db *sqlx.DB, id int64) ([]models.Comment, error) {
+	comments := []models.Comment{}
+	err := db.SelectContext(ctx, &comments,
+		"SELECT * FROM vulnerability_comments WHERE vulnerability_id = ? ORDER BY id", id)
+	return comments, err
+}
+
+// ListTriageEvents returns the audit trail of a vulnerability, oldest first
+func ListTriageEvents(ctx context.Context, db *sqlx.DB, id int64) ([]models.TriageEvent, error) {
+	events := []models.TriageEvent{}
+	err := db.SelectContext(ctx, &events,
+		"SELECT * FROM triage_audit WHERE vulnerability_id = ? ORDER BY id", id)
+	return events, err
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// InsertVEXStatements stores statements in a single transaction
+func InsertVEXStatements(ctx context.Context, db *sqlx.DB, statements []models.VEXStatement) error {
+	unlock, err := LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range statements {
+		_, err := tx.NamedExecContext(ctx, `INSERT INTO vex_statements (
+			vuln_id, product, status, justification, impact_statement,
+			action_statement, author, document_id, timestamp
+		) VALUES (
+			:vuln_id, :product, :status, :justification, :impact_statement,
+			:action_statement, :author, :document_id, :timestamp
+		)`, s)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListVEXStatements returns every stored statement, oldest first
+func ListVEXStatements(ctx context.Context, db *sqlx.DB) ([]models.VEXStatement, error) {
+	var statements []models.VEXStatement
+	err := db.SelectContext(ctx, &statements, "SELECT * FROM vex_statements ORDER BY timestamp, id")
+	return statements, err
+}
+
+// AttachVEX sets the VEX field of each vulnerability to the most recent
+// statement about its identifier (or a known alias) and package. A
+// statement whose product has no version applies to every version.
+func AttachVEX(ctx context.Context, db sqlx.QueryerContext, vulns []models.Vulnerability) error {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, v := range vulns {
+		for _, id := range append([]string{v.CVEID}, v.Aliases...) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var statements []models.VEXStatement
+	err := Statements.SelectContext(ctx, db, &statements,
+		"SELECT * FROM vex_statements WHERE vuln_id IN (SELECT value FROM json_each(?)) ORDER BY timestamp, id", inList(ids))
+	if err != nil {
+		return err
+	}
+
+	byVuln := make(map[string][]*models.VEXStatement)
+	for i := range statements {
+		s := &statements[i]
+		byVuln[s.VulnID] = append(byVuln[s.VulnID], s)
+	}
+	for i := range vulns {
+		v := &vulns[i]
+		v.VEX = nil
+		for _, id := range append([]string{v.CVEID}, v.Aliases...) {
+			for _, s := range byVuln[id] {
+				if ProductMatches(s.Product, v.PURL) && (v.VEX == nil || !s.Timestamp.Before(v.VEX.Timestamp)) {
+					v.VEX = s
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ProductMatches reports whether a VEX product identifier covers a
+// finding's normalized package URL
+func ProductMatches(product, purl string) bool {
+	if product == "" || purl == "" {
+		return false
+	}
+	if product == purl {
+		return true
+	}
+	// A version-less package URL covers every version of the package
+	return strings.HasPrefix(product, "pkg:") && !strings.Contains(product, "@") &&
+		strings.HasPrefix(purl, product+"@")
+}
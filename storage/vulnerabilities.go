@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+)
+
+// InsertVulnerability stores a finding under the given scan row and records
+// the sighting in the findings table. The finding's package URL is
+// normalized, or derived from its ecosystem, name, and version when the
+// scanner did not report one. A finding with the fingerprint of an earlier
+// one takes over its triage status and assignee, reopening it if it was
+// resolved, unless it comes with its own, e.g. from another tracker's
+// report.
+func InsertVulnerability(ctx context.Context, tx sqlx.ExtContext, scanID int64, vuln models.Vulnerability) error {
+	NormalizePackage(&vuln)
+	if vuln.Fingerprint == "" {
+		fp, err := fingerprint(ctx, tx, scanID, vuln)
+		if err != nil {
+			return err
+		}
+		vuln.Fingerprint = fp
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO vulnerabilities (
+		scan_id, cve_id, severity, cvss, status, package_name,
+		current_version, fixed_version, description,
+		published_date, link, risk_factors, ecosystem, purl, package_class, raw_json,
+		location, fingerprint, triage_status, assignee
+	) SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		CASE WHEN ? <> '' THEN ? WHEN COALESCE(p.triage_status, 'resolved') = 'resolved' THEN 'open' ELSE p.triage_status END,
+		CASE WHEN ? <> '' THEN ? ELSE COALESCE(p.assignee, '') END
+	FROM (SELECT 1) LEFT JOIN (
+		SELECT triage_status, assignee FROM vulnerabilities WHERE fingerprint = ? ORDER BY id DESC LIMIT 1
+	) p ON 1`,
+		scanID, vuln.CVEID, vuln.Severity, vuln.CVSS, vuln.Status,
+		vuln.PackageName, vuln.CurrentVersion, vuln.FixedVersion,
+		vuln.Description, FormatTime(vuln.PublishedDate), vuln.Link, vuln.RiskFactors,
+		vuln.Ecosystem, vuln.PURL, vuln.PackageClass, vuln.Raw,
+		vuln.Location, vuln.Fingerprint, vuln.TriageStatus, vuln.TriageStatus, vuln.Assignee, vuln.Assignee, vuln.Fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+	return recordFinding(ctx, tx, scanID, vuln)
+}
+
+// NormalizePackage fills in the finding's ecosystem, normalized package
+// URL, and package class
+func NormalizePackage(vuln *models.Vulnerability) {
+	switch {
+	case vuln.PURL != "":
+		vuln.PURL = purl.Normalize(vuln.PURL)
+		if vuln.Ecosystem == "" {
+			vuln.Ecosystem = purl.Ecosystem(vuln.PURL)
+		}
+	case vuln.PackageName != "":
+		vuln.PURL = purl.Build(vuln.Ecosystem, vuln.PackageName, vuln.CurrentVersion)
+	}
+	vuln.PackageClass = purl.Class(vuln.PURL)
+}
+
+// InsertComponent stores an SBOM component under the given scan row
+func InsertComponent(ctx context.Context, tx sqlx.ExecerContext, scanID int64, c models.Component) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO components (scan_id, name, version, ecosystem, purl, type, license, ref) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		scanID, c.Name, c.Version, c.Ecosystem, c.PURL, c.Type, c.License, c.Ref,
+	)
+	return err
+}
+
+// InsertDependency stores one dependency graph edge of a scan
+func InsertDependency(ctx context.Context, tx sqlx.ExecerContext, scanID int64, d models.Dependency) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO component_dependencies (scan_id, parent, child) VALUES (?, ?, ?)",
+		scanID, d.Parent, d.Child,
+	)
+	return err
+}
+
+// UpdateVulnerability replaces the scanner-reported fields of a stored
+// finding, keeping its ID and triage state, and refreshes the finding it
+// belongs to
+func UpdateVulnerability(ctx context.Context, tx sqlx.ExtContext, id, scanID int64, vuln models.Vulnerability) error {
+	NormalizePackage(&vuln)
+	if vuln.Fingerprint == "" {
+		fp, err := fingerprint(ctx, tx, scanID, vuln)
+		if err != nil {
+			return err
+		}
+		vuln.Fingerprint = fp
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE vulnerabilities SET
+		cve_id = ?, severity = ?, cvss = ?, status = ?, package_name = ?,
+		current_version = ?, fixed_version = ?, description = ?,
+		published_date = ?, link = ?, risk_factors = ?, ecosystem = ?, purl = ?, package_class = ?, raw_json = ?,
+		location = ?, fingerprint = ?
+		WHERE id = ?`,
+		vuln.CVEID, vuln.Severity, vuln.CVSS, vuln.Status, vuln.PackageName,
+		vuln.CurrentVersion, vuln.FixedVersion, vuln.Description,
+		FormatTime(vuln.PublishedDate), vuln.Link, vuln.RiskFactors, vuln.Ecosystem, vuln.PURL, vuln.PackageClass,
+		vuln.Raw, vuln.Location, vuln.Fingerprint, id,
+	)
+	if err != nil {
+		return err
+	}
+	return recordFinding(ctx, tx, scanID, vuln)
+}
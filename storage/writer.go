@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// writeSlot holds the turn of the single writer. SQLite allows one write
+// transaction at a time and, even in WAL mode, answers a second with
+// SQLITE_BUSY; taking turns in the process makes writers queue instead.
+var writeSlot = make(chan struct{}, 1)
+
+// LockWrites waits for the writer's turn, returning the function that ends
+// it. Every write transaction takes the turn before it begins and ends it
+// once committed or rolled back, so fetching and parsing still run
+// concurrently and only the database work is serialized.
+func LockWrites(ctx context.Context) (unlock func(), err error) {
+	select {
+	case writeSlot <- struct{}{}:
+		return func() { <-writeSlot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Busy reports whether err is SQLite giving up on a locked database after
+// its busy timeout, which happens when writers of other processes, such as
+// replicas sharing the database, hold it too long. Retrying later may
+// succeed.
+func Busy(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked)
+}
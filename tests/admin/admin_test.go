@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+)
+
+// TestAdminOnly tests that administrative endpoints refuse requests
+// without the admin API key, and every request while none is configured
+func TestAdminOnly(t *testing.T) {
+	defer func(key string) { handlers.AdminAPIKey = key }(handlers.AdminAPIKey)
+	h := handlers.AdminOnly(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/admin/reprocess", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, r)
+		return rr
+	}
+
+	handlers.AdminAPIKey = ""
+	assert.Equal(t, http.StatusForbidden, serve("", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("Authorization", "Bearer ").Code)
+
+	handlers.AdminAPIKey = "s3cret"
+	rr := serve("", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, serve("Authorization", "Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("Authorization", "s3cret").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("X-API-Key", "s3cret0").Code)
+
+	assert.Equal(t, http.StatusOK, serve("Authorization", "Bearer s3cret").Code)
+	assert.Equal(t, http.StatusOK, serve("X-API-Key", "s3cret").Code)
+}
@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/httpclient"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// entries are the files of the test archives, in order
+var entries = []struct{ name, content string }{
+	{"reports/trivy.json", `{"scanResults":{}}`},
+	{"reports/.DS_Store", "junk"},
+	{"__MACOSX/reports/._trivy.json", "junk"},
+	{"./notes.txt", "not a report"},
+}
+
+// tarGz builds a gzipped tar of the entries plus a directory
+func tarGz(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "reports/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for _, e := range entries {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(e.content))}))
+		tw.Write([]byte(e.content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// zipped builds a zip of the entries
+func zipped(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		assert.NoError(t, err)
+		w.Write([]byte(e.content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// TestExtract tests extraction of both formats and the limits
+func TestExtract(t *testing.T) {
+	want := []archive.File{
+		{Name: "reports/trivy.json", Content: []byte(`{"scanResults":{}}`)},
+		{Name: "notes.txt", Content: []byte("not a report")},
+	}
+	for name, data := range map[string][]byte{"tar.gz": tarGz(t), "zip": zipped(t)} {
+		files, err := archive.Extract(data, archive.DefaultLimits)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want, files, name)
+
+		_, err = archive.Extract(data, archive.Limits{MaxEntries: 1, MaxEntrySize: 1 << 20, MaxTotalSize: 1 << 20})
+		assert.ErrorIs(t, err, archive.ErrLimit, name)
+		_, err = archive.Extract(data, archive.Limits{MaxEntries: 10, MaxEntrySize: 12, MaxTotalSize: 1 << 20})
+		assert.ErrorContains(t, err, "file larger than 12 bytes", name)
+		_, err = archive.Extract(data, archive.Limits{MaxEntries: 10, MaxEntrySize: 20, MaxTotalSize: 25})
+		assert.ErrorContains(t, err, "25 bytes in total", name)
+	}
+
+	_, err := archive.Extract([]byte(`{"scanResults":{}}`), archive.DefaultLimits)
+	assert.ErrorContains(t, err, "unrecognized format")
+}
+
+// TestArchiveScanHandler tests uploading and downloading archives
+func TestArchiveScanHandler(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	scanner := handlers.NewScanner(github.DefaultFetcher)
+
+	// Upload
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("repo", "https://github.com/acme/api")
+	fw, _ := mw.CreateFormFile("file", "reports.zip")
+	fw.Write(zipped(t))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/scan/archive", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	scanner.ArchiveScanHandler(rr, req)
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, rr.Body.String())
+	var resp handlers.ScanResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"reports/trivy.json"}, resp.Success)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, "notes.txt", resp.Failed[0].File)
+		assert.Contains(t, resp.Failed[0].Error, "parse failed")
+	}
+
+	var paths []string
+	db.Select(&paths, "SELECT file_path FROM scans WHERE repo = ?", "https://github.com/acme/api")
+	assert.Equal(t, []string{"reports/trivy.json"}, paths)
+
+	// Download
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/artifacts.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(tarGz(t))
+	}))
+	defer server.Close()
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		scanner.ArchiveScanHandler(rr, httptest.NewRequest(http.MethodPost, "/scan/archive", bytes.NewBufferString(body)))
+		return rr
+	}
+	local := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	// Internal addresses are refused unless allowed
+	rr = post(`{"repo": "https://github.com/acme/web", "url": "` + local + `/artifacts.tar.gz"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "address not allowed")
+	cfg := httpclient.DefaultConfig
+	cfg.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	assert.NoError(t, httpclient.Configure(cfg))
+	defer httpclient.Configure(httpclient.DefaultConfig)
+
+	rr = post(`{"repo": "https://github.com/acme/web", "url": "` + local + `/artifacts.tar.gz"}`)
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, rr.Body.String())
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"reports/trivy.json"}, resp.Success)
+
+	for body, code := range map[string]int{
+		`{"url": "` + local + `/artifacts.tar.gz"}`:                                             http.StatusBadRequest,
+		`{"repo": "https://github.com/acme/web", "url": "file:///etc/passwd"}`:                  http.StatusBadRequest,
+		`{"repo": "https://github.com/acme/web", "url": "` + local + `/missing.zip"}`:           http.StatusBadRequest,
+		`{"repo": "https://github.com/acme/web", "url": "` + server.URL + `/artifacts.tar.gz"}`: http.StatusBadRequest,
+	} {
+		assert.Equal(t, code, post(body).Code, body)
+	}
+}
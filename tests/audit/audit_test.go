@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// TestAuditLog tests recording of mutating requests and listing the log
+func TestAuditLog(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos", handlers.Audit("/repos", handlers.ReposHandler))
+	mux.HandleFunc("/repos/{path...}", handlers.Audit("/repos/{path...}", handlers.RepoHandler))
+	mux.HandleFunc("/queries/{name}", handlers.Audit("/queries/{name}", handlers.SavedQueryHandler))
+	mux.HandleFunc("/audit", handlers.AuditHandler)
+	do := func(method, target, body, actor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if actor != "" {
+			req.Header.Set("X-Actor", actor)
+		}
+		req.Header.Set("X-Request-ID", "req-"+method)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/repos", `{"url": "https://github.com/acme/api/", "team": "payments"}`, "alice")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	rr = do(http.MethodPost, "/repos", `{"url": "https://github.com/acme/web"}`, "bob")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/repos", "", "alice").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/repos/github.com/acme/api", "", "alice").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/queries/nightly", "", "").Code)
+
+	list := func(query string) []handlers.AuditEntry {
+		rr := do(http.MethodGet, "/audit"+query, "", "")
+		assert.Equal(t, http.StatusOK, rr.Code, query)
+		var entries []handlers.AuditEntry
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+		return entries
+	}
+
+	// Reads are not recorded; failed mutations are, with their status
+	entries := list("")
+	if assert.Len(t, entries, 4) {
+		assert.Equal(t, "anonymous", entries[0].Actor)
+		assert.Equal(t, "DELETE /queries/{name}", entries[0].Action)
+		assert.Equal(t, "/queries/nightly", entries[0].Target)
+		assert.Equal(t, http.StatusNotFound, entries[0].Status)
+
+		assert.Equal(t, "alice", entries[1].Actor)
+		assert.Equal(t, "DELETE /repos/{path...}", entries[1].Action)
+		assert.Equal(t, "https://github.com/acme/api", entries[1].Target)
+		assert.Equal(t, http.StatusNoContent, entries[1].Status)
+		assert.Equal(t, "req-DELETE", entries[1].RequestID)
+
+		assert.Equal(t, "bob", entries[2].Actor)
+		assert.Equal(t, http.StatusBadRequest, entries[2].Status)
+		assert.Equal(t, "https://github.com/acme/web", entries[2].Target)
+
+		assert.Equal(t, "POST /repos", entries[3].Action)
+		assert.Equal(t, "https://github.com/acme/api", entries[3].Target)
+		assert.Equal(t, http.StatusCreated, entries[3].Status)
+		assert.Equal(t, "req-POST", entries[3].RequestID)
+		assert.WithinDuration(t, time.Now(), entries[3].CreatedAt, time.Minute)
+	}
+
+	assert.Len(t, list("?actor=alice"), 2)
+	assert.Len(t, list("?action=POST+/repos"), 2)
+	assert.Len(t, list("?target=https://github.com/acme/api&actor=alice"), 2)
+	assert.Len(t, list("?until=2000-01-01T00:00:00Z"), 0)
+	assert.Len(t, list("?since="+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)), 4)
+	if page := list("?limit=2"); assert.Len(t, page, 2) {
+		rest := list("?before=" + strconv.FormatInt(page[1].ID, 10))
+		assert.Len(t, rest, 2)
+		assert.Less(t, rest[0].ID, page[1].ID)
+	}
+	for _, query := range []string{"?limit=0", "?since=yesterday", "?before=x"} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/audit"+query, "", "").Code, query)
+	}
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "/audit", "", "").Code)
+
+	// The log is append-only
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx, "UPDATE audit_log SET actor = 'mallory'")
+	assert.ErrorContains(t, err, "append-only")
+	_, err = db.ExecContext(ctx, "DELETE FROM audit_log")
+	assert.ErrorContains(t, err, "append-only")
+}
@@ -0,0 +1,94 @@
+package badge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/badge"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const repo = "https://github.com/acme/shop"
+
+// TestBadge tests the counts, colors, and formats of repository badges
+func TestBadge(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(file string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "high", PackageName: "curl"}
+	ignored := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "HIGH", PackageName: "zlib"}
+
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	scan("api.json", day1, critical, high)
+	scan("api.json", day1.AddDate(0, 0, 1), high, ignored) // critical fixed by the rescan
+	scan("web.json", day1, high)
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = ? WHERE cve_id = ?", handlers.TriageWontFix, ignored.CVEID)
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/badge/{repo...}", handlers.BadgeHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+	shields := func(target string) (int, handlers.Badge) {
+		rr := get(target)
+		var b handlers.Badge
+		json.Unmarshal(rr.Body.Bytes(), &b)
+		return rr.Code, b
+	}
+
+	code, b := shields("/badge/github.com/acme/shop?format=json")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.Badge{SchemaVersion: 1, Label: "vulnerabilities", Message: "2 high", Color: badge.Orange}, b)
+
+	_, b = shields("/badge/github.com/acme/shop?format=json&severity=critical,HIGH&label=security")
+	assert.Equal(t, handlers.Badge{SchemaVersion: 1, Label: "security", Message: "0 critical, 2 high", Color: badge.Orange}, b)
+	_, b = shields("/badge/github.com/acme/shop?format=json&severity=critical")
+	assert.Equal(t, "0 critical", b.Message)
+	assert.Equal(t, badge.BrightGreen, b.Color)
+
+	code, b = shields("/badge/github.com/acme/missing?format=json")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "not found", b.Message)
+
+	rr := get("/badge/github.com/acme/shop?label=<vulns>")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/svg+xml", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "<title>&lt;vulns&gt;: 2 high</title>")
+	assert.Contains(t, rr.Header().Get("Cache-Control"), "max-age=")
+
+	assert.Equal(t, http.StatusBadRequest, get("/badge/github.com/acme/shop?severity=urgent").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/badge/github.com/acme/shop?format=png").Code)
+}
@@ -0,0 +1,325 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestMatchFiles tests pattern selection of repository files
+func TestMatchFiles(t *testing.T) {
+	files := []string{"README.md", "reports/trivy.json", "reports/old/trivy.json", "scan.sarif", "ci/app.sarif"}
+	assert.Equal(t, []string{"reports/trivy.json"}, github.MatchFiles(files, []string{"reports/*.json"}))
+	assert.Equal(t, []string{"scan.sarif", "ci/app.sarif"}, github.MatchFiles(files, []string{"*.sarif"}))
+	assert.Empty(t, github.MatchFiles(files, []string{"*.xml"}))
+	assert.Error(t, github.ValidatePattern("reports/[.json"))
+
+	assert.Equal(t, "testdata", github.ExcludedBy("svc/testdata/trivy.json", []string{"*.sarif", "testdata"}))
+	assert.Equal(t, "reports/old/*", github.ExcludedBy("reports/old/2023/trivy.json", []string{"reports/old/*"}))
+	assert.Equal(t, "*.fixture.json", github.ExcludedBy("ci/app.fixture.json", []string{"*.fixture.json"}))
+	assert.Empty(t, github.ExcludedBy("reports/trivy.json", []string{"old/*", "testdata"}))
+
+	owner, name, err := github.ParseRepo("https://github.com/acme/api.git/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme", "api"}, []string{owner, name})
+	_, _, err = github.ParseRepo("acme/api")
+	assert.Error(t, err)
+}
+
+// TestBulkScan tests job submission, file listing, and progress reporting
+func TestBulkScan(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/api/git/trees/main":
+			assert.Equal(t, "1", r.URL.Query().Get("recursive"))
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"tree": [{"path": "reports", "type": "tree"}, {"path": "reports/trivy.json", "type": "blob"}]}`))
+		default:
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer func(c *github.Client) { github.DefaultClient = c }(github.DefaultClient)
+	github.DefaultClient = github.NewClient(server.URL, "secret")
+
+	files, err := github.DefaultClient.ListFiles(context.Background(), "https://github.com/acme/api", "main")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"reports/trivy.json"}, files)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan/bulk", handlers.NewScanner(github.DefaultFetcher).BulkScanHandler)
+	mux.HandleFunc("/scan/bulk/{id}", handlers.BulkScanStatusHandler)
+	do := func(method, target, body string) (int, handlers.BulkScanJob) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+		var job handlers.BulkScanJob
+		json.Unmarshal(rr.Body.Bytes(), &job)
+		return rr.Code, job
+	}
+
+	code, job := do(http.MethodPost, "/scan/bulk", `{"entries": [
+		{"repo": "https://github.com/acme/api", "patterns": ["*.sarif"]},
+		{"repo": "https://github.com/acme/missing", "patterns": ["*.json"]}
+	]}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, 2, job.Repos)
+
+	// Poll until both repositories finish
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != handlers.BulkCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		code, job = do(http.MethodGet, "/scan/bulk/"+job.ID, "")
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, handlers.BulkCompleted, job.Status)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Equal(t, 2, job.ReposDone)
+	if assert.Len(t, job.Results, 2) {
+		assert.Equal(t, handlers.BulkFailed, job.Results[0].Status)
+		assert.Contains(t, job.Results[0].Error, "no files match")
+		assert.Equal(t, "https://github.com/acme/missing", job.Results[1].Repo)
+		assert.Contains(t, job.Results[1].Error, "HTTP status 404")
+	}
+
+	for _, body := range []string{`{}`, `{"entries": [{"files": ["a.json"]}]}`,
+		`{"entries": [{"repo": "https://github.com/acme/api"}]}`,
+		`{"entries": [{"repo": "https://github.com/acme/api", "patterns": ["[x"]}]}`} {
+		code, _ = do(http.MethodPost, "/scan/bulk", body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+	code, _ = do(http.MethodGet, "/scan/bulk/unknown", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// TestOrgScan tests organization repository listing and selection
+func TestOrgScan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/acme/repos" {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		// A full first page of filler repositories, then the interesting ones
+		var repos []github.Repository
+		switch r.URL.Query().Get("page") {
+		case "1":
+			for i := 0; i < 100; i++ {
+				repos = append(repos, github.Repository{Name: fmt.Sprintf("lib-%d", i), HTMLURL: fmt.Sprintf("https://github.com/acme/lib-%d", i)})
+			}
+		case "2":
+			repos = []github.Repository{
+				{Name: "API", HTMLURL: "https://github.com/acme/API"},
+				{Name: "api-legacy", HTMLURL: "https://github.com/acme/api-legacy", Archived: true},
+				{Name: "api-fork", HTMLURL: "https://github.com/acme/api-fork", Fork: true},
+				{Name: "api-docs", HTMLURL: "https://github.com/acme/api-docs"},
+			}
+		}
+		json.NewEncoder(w).Encode(repos)
+	}))
+	defer server.Close()
+	defer func(c *github.Client) { github.DefaultClient = c }(github.DefaultClient)
+	github.DefaultClient = github.NewClient(server.URL, "")
+
+	ctx := context.Background()
+	bulk, err := handlers.OrgBulkScan(ctx, handlers.OrgScanRequest{Org: "acme", Patterns: []string{"*.sarif"}, Concurrency: 2})
+	assert.NoError(t, err)
+	assert.Len(t, bulk.Entries, 102)
+	assert.Equal(t, 2, bulk.Concurrency)
+
+	bulk, err = handlers.OrgBulkScan(ctx, handlers.OrgScanRequest{
+		Org: "acme", Patterns: []string{"*.sarif"}, Include: []string{"api*"}, Exclude: []string{"*-docs"}, Archived: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []handlers.BulkScanEntry{
+		{Repo: "https://github.com/acme/API", Patterns: []string{"*.sarif"}},
+		{Repo: "https://github.com/acme/api-legacy", Patterns: []string{"*.sarif"}},
+	}, bulk.Entries)
+
+	_, err = handlers.OrgBulkScan(ctx, handlers.OrgScanRequest{Org: "missing", Patterns: []string{"*.sarif"}})
+	assert.ErrorContains(t, err, "HTTP status 404")
+
+	for body, want := range map[string]int{
+		`{"org": "acme"}`: http.StatusBadRequest,
+		`{"org": "ac/me", "patterns": ["*.sarif"]}`:                          http.StatusBadRequest,
+		`{"org": "acme", "patterns": ["*.sarif"], "include": ["[x"]}`:        http.StatusBadRequest,
+		`{"org": "acme", "patterns": ["*.sarif"], "concurrency": 100}`:       http.StatusBadRequest,
+		`{"org": "acme", "patterns": ["*.sarif"], "include": ["nothing-*"]}`: http.StatusBadRequest,
+		`{"org": "missing", "patterns": ["*.sarif"]}`:                        http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		handlers.NewScanner(github.DefaultFetcher).OrgScanHandler(rr, httptest.NewRequest(http.MethodPost, "/scan/org", bytes.NewBufferString(body)))
+		assert.Equal(t, want, rr.Code, body)
+	}
+}
+
+// fetcherFunc adapts a function to handlers.ContentFetcher
+type fetcherFunc func(ctx context.Context, repo, file string) ([]byte, error)
+
+func (f fetcherFunc) FetchFileContent(ctx context.Context, repo, ref, file string, cached *github.Validators) ([]byte, github.Validators, error) {
+	data, err := f(ctx, repo, file)
+	return data, github.Validators{}, err
+}
+
+// TestOperationalEvents tests that repeated fetch failures and stuck bulk
+// scans are published once each
+func TestOperationalEvents(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ch, cancel := events.Default.Subscribe(events.Filter{Types: []string{events.TypeFetchFailures, events.TypeScanStuck}})
+	defer cancel()
+	release := make(chan struct{})
+	scanner := handlers.NewScanner(fetcherFunc(func(ctx context.Context, repo, file string) ([]byte, error) {
+		if repo == "https://github.com/acme/slow" {
+			<-release
+		}
+		return nil, errs.New(errs.ErrFetch, "connection refused")
+	}))
+	ctx := context.Background()
+
+	// The third failure in a row is reported, later ones are not
+	repo := "https://github.com/acme/down"
+	_, err = scanner.Scan(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"a.json", "b.json"}})
+	assert.NoError(t, err)
+	_, err = scanner.Scan(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"c.json", "d.json"}})
+	assert.NoError(t, err)
+	select {
+	case e := <-ch:
+		assert.Equal(t, events.TypeFetchFailures, e.Type)
+		assert.Equal(t, repo, e.Repo)
+		assert.Equal(t, 3, e.Data.(handlers.FetchFailuresEvent).Failures)
+		assert.Contains(t, e.Data.(handlers.FetchFailuresEvent).Error, "connection refused")
+	case <-time.After(time.Second):
+		t.Fatal("no fetch_failures event")
+	}
+	assert.Empty(t, ch)
+
+	// A bulk scan running past the threshold is reported once
+	job := scanner.StartBulkScan(ctx, handlers.BulkScanRequest{Entries: []handlers.BulkScanEntry{
+		{Repo: "https://github.com/acme/slow", Files: []string{"trivy.json"}},
+	}})
+	defer close(release)
+	assert.Zero(t, handlers.CheckStuckScans(time.Now()))
+	assert.Equal(t, 1, handlers.CheckStuckScans(time.Now().Add(handlers.ScanStuckAfter)))
+	assert.Zero(t, handlers.CheckStuckScans(time.Now().Add(handlers.ScanStuckAfter)))
+	select {
+	case e := <-ch:
+		assert.Equal(t, events.TypeScanStuck, e.Type)
+		stuck := e.Data.(handlers.ScanStuckEvent)
+		assert.Equal(t, job.ID, stuck.Job)
+		assert.Equal(t, 1, stuck.Repos)
+		assert.Zero(t, stuck.Done)
+	case <-time.After(time.Second):
+		t.Fatal("no scan_stuck event")
+	}
+}
+
+// TestBulkScanPartial tests that a repository some files of which fail
+// counts as done, so the job's progress reaches every repository
+func TestBulkScanPartial(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	scanner := handlers.NewScanner(fetcherFunc(func(ctx context.Context, repo, file string) ([]byte, error) {
+		if file == "missing.json" {
+			return nil, errs.New(errs.ErrFetch, "HTTP status 404")
+		}
+		return []byte(`{"scanResults":{"scan_id":"s","vulnerabilities":[{"id":"CVE-1","severity":"HIGH","package_name":"openssl"}]}}`), nil
+	}))
+	job := scanner.StartBulkScan(context.Background(), handlers.BulkScanRequest{Entries: []handlers.BulkScanEntry{
+		{Repo: "https://github.com/acme/api", Files: []string{"trivy.json", "missing.json"}},
+		{Repo: "https://github.com/acme/web", Files: []string{"trivy.json"}},
+	}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != handlers.BulkCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = handlers.GetBulkScan(job.ID)
+	}
+	assert.Equal(t, handlers.BulkCompleted, job.Status)
+	assert.Equal(t, 2, job.ReposDone)
+	if assert.Len(t, job.Results, 2) {
+		assert.Equal(t, handlers.BulkPartial, job.Results[0].Status)
+		assert.Equal(t, handlers.BulkCompleted, job.Results[1].Status)
+	}
+	assert.Equal(t, 2, job.FilesSucceeded)
+	assert.Equal(t, 1, job.FilesFailed)
+}
+
+// TestScanExclude tests that files matching exclude patterns are skipped
+// without being fetched
+func TestScanExclude(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	scanner := handlers.NewScanner(fetcherFunc(func(ctx context.Context, repo, file string) ([]byte, error) {
+		mu.Lock()
+		fetched = append(fetched, file)
+		mu.Unlock()
+		return nil, errs.New(errs.ErrFetch, "connection refused")
+	}))
+
+	resp := scanner.Run(context.Background(), handlers.ScanRequest{
+		Repo:       "https://github.com/acme/api",
+		PathPrefix: "svc",
+		Files:      []string{"trivy.json", "testdata/trivy.json", "test/unit/scan.sarif"},
+		Exclude:    []string{"testdata", "svc/test/*"},
+		Force:      true,
+	})
+	assert.Equal(t, []string{"svc/trivy.json"}, fetched)
+	assert.Len(t, resp.Failed, 1)
+	assert.Equal(t, []handlers.FileSkip{
+		{File: "svc/testdata/trivy.json", Reason: `excluded by pattern "testdata", skipped`},
+		{File: "svc/test/unit/scan.sarif", Reason: `excluded by pattern "svc/test/*", skipped`},
+	}, resp.Skipped)
+	assert.Equal(t, handlers.ScanPartial, resp.Status)
+
+	_, err := scanner.Scan(context.Background(), handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"trivy.json"}, Exclude: []string{"[.json"}})
+	assert.Error(t, err)
+	err = handlers.ValidateExcludes([]string{""})
+	assert.Error(t, err)
+}
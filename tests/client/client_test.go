@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/client"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// setupServer starts a test server backed by a migrated in-memory database
+func setupServer(t *testing.T) (*httptest.Server, *sqlx.DB) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	res, err := db.Exec(`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		"https://github.com/org/repo", "scan.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, severity := range []string{"HIGH", "HIGH", "LOW"} {
+		_, err := db.Exec(`INSERT INTO vulnerabilities (
+			scan_id, cve_id, severity, cvss, status, package_name, current_version,
+			fixed_version, description, published_date, link, risk_factors
+		) VALUES (?, 'CVE-2024-1234', ?, 7.5, 'active', 'openssl', '1.0', '1.1', '', ?, '', ?)`,
+			scanID, severity, time.Now().UTC(), []byte(`[]`))
+		assert.NoError(t, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", handlers.QueryHandler)
+	mux.HandleFunc("/stats", handlers.StatsHandler)
+	return httptest.NewServer(mux), db
+}
+
+// TestClientQueryAndStats tests typed Query and Stats calls against real handlers
+func TestClientQueryAndStats(t *testing.T) {
+	server, db := setupServer(t)
+	defer server.Close()
+	defer db.Close()
+
+	c := client.New(server.URL)
+
+	var req api.QueryRequest
+	req.Filters.Severity = "HIGH"
+	req.Filters.Dedup = "off"
+	vulns, err := c.Query(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 2)
+
+	// Results cut at the server's row limit are read from its page
+	defer func(n int) { handlers.QueryMaxRows = n }(handlers.QueryMaxRows)
+	handlers.QueryMaxRows = 1
+	vulns, err = c.Query(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 1)
+
+	stats, err := c.Stats(context.Background(), "https://github.com/org/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Scans)
+	assert.Equal(t, 3, stats.Vulnerabilities)
+	assert.Equal(t, map[string]int{"HIGH": 2, "LOW": 1}, stats.BySeverity)
+}
+
+// TestClientRetriesAndAuth tests retry on 503, bearer auth, and API errors
+func TestClientRetriesAndAuth(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/scan" {
+			w.Write([]byte(`{"success":["a.json"],"failed":null}`))
+			return
+		}
+		http.Error(w, "Severity filter is required", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, client.WithToken("secret"), client.WithRetries(2, time.Millisecond))
+
+	resp, err := c.Scan(context.Background(), api.ScanRequest{Repo: "r", Files: []string{"a.json"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.json"}, resp.Success)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	_, err = c.Query(context.Background(), api.QueryRequest{})
+	var apiErr *client.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls)) // 4xx is not retried
+}
+
+// TestClientFailedScan tests that a scan in which every file failed returns
+// its per-file failures rather than an error
+func TestClientFailedScan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"status":"failed","success":[],"failed":[{"file":"a.json","error":"fetch failed: HTTP status 404","category":"fetch"}]}`))
+	}))
+	defer server.Close()
+
+	resp, err := client.New(server.URL).Scan(context.Background(), api.ScanRequest{Repo: "r", Files: []string{"a.json"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", resp.Status)
+	assert.Equal(t, []api.FileError{{File: "a.json", Error: "fetch failed: HTTP status 404", Category: "fetch"}}, resp.Failed)
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/cluster"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/jobs"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestLeaderElection tests that one of two replicas leads, and that the
+// other takes over once the leader's lease expires or is given up
+func TestLeaderElection(t *testing.T) {
+	assert.NoError(t, storage.InitDB(filepath.Join(t.TempDir(), "vulnerabilities.db")+"?_journal=WAL&_busy_timeout=5000", ""))
+	defer storage.DB.Close()
+	ctx := context.Background()
+
+	a := cluster.NewNode(storage.DB, 200*time.Millisecond)
+	b := cluster.NewNode(storage.DB, 200*time.Millisecond)
+	assert.NotEqual(t, a.ID, b.ID)
+
+	assert.True(t, a.Campaign(ctx))
+	assert.False(t, b.Campaign(ctx))
+	assert.True(t, a.Campaign(ctx), "the leader renews its lease")
+	status, err := b.Status(ctx)
+	assert.NoError(t, err)
+	assert.False(t, status.Leader)
+	assert.Equal(t, a.ID, status.LeaderNode)
+	assert.NotNil(t, status.LeaseExpiresAt)
+
+	// The leader stops renewing, e.g. because it crashed
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, b.Campaign(ctx))
+	assert.False(t, a.Campaign(ctx))
+	assert.False(t, a.IsLeader())
+
+	// A leader that shuts down gives up its lease at once
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		b.Run(runCtx)
+		close(done)
+	}()
+	assert.Eventually(t, b.IsLeader, time.Second, 5*time.Millisecond)
+	stop()
+	<-done
+	assert.True(t, a.Campaign(ctx))
+
+	rr := httptest.NewRecorder()
+	handlers.ClusterHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/cluster", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	cluster.Default = a
+	defer func() { cluster.Default = nil }()
+	rr = httptest.NewRecorder()
+	handlers.ClusterHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/cluster", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var res handlers.ClusterStatus
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	assert.Equal(t, a.ID, res.Node)
+	assert.True(t, res.Leader)
+	assert.Equal(t, a.ID, res.LeaderNode)
+}
+
+// TestJobClaims tests that each run of a job scheduled on two replicas
+// runs on one of them, and that leader-only jobs run on the leader
+func TestJobClaims(t *testing.T) {
+	assert.NoError(t, storage.InitDB(filepath.Join(t.TempDir(), "vulnerabilities.db")+"?_journal=WAL&_busy_timeout=5000", ""))
+	defer storage.DB.Close()
+	ctx := context.Background()
+
+	a := cluster.NewNode(storage.DB, time.Minute)
+	b := cluster.NewNode(storage.DB, time.Minute)
+	claimed, err := storage.ClaimJobRun(ctx, storage.DB, "kev-sync", a.ID, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = storage.ClaimJobRun(ctx, storage.DB, "kev-sync", b.ID, time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	var syncs, deliveries atomic.Int32
+	runners := map[*cluster.Node]*jobs.Runner{a: jobs.NewRunner(), b: jobs.NewRunner()}
+	assert.True(t, a.Campaign(ctx))
+	assert.False(t, b.Campaign(ctx))
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for node, r := range runners {
+		r.Claim = node.Claim
+		r.Add(jobs.Job{Name: "epss-sync", Interval: 100 * time.Millisecond, Run: func(context.Context) error {
+			syncs.Add(1)
+			return nil
+		}})
+		r.Add(jobs.Job{Name: "report-delivery", Interval: time.Hour, LeaderOnly: true, Run: func(context.Context) error {
+			deliveries.Add(1)
+			return nil
+		}})
+		r.Start(runCtx)
+	}
+
+	time.Sleep(450 * time.Millisecond)
+	cancel()
+	// Two replicas ticking five times each ran about one run per interval
+	assert.GreaterOrEqual(t, syncs.Load(), int32(3))
+	assert.LessOrEqual(t, syncs.Load(), int32(6))
+	assert.Equal(t, int32(1), deliveries.Load())
+
+	skipped := 0
+	for _, st := range runners[b].Statuses() {
+		if st.Name == "report-delivery" {
+			assert.Equal(t, 0, st.Runs)
+			assert.Equal(t, 1, st.Skipped)
+		}
+		skipped += st.Skipped
+	}
+	for _, st := range runners[a].Statuses() {
+		skipped += st.Skipped
+	}
+	assert.Greater(t, skipped, 1)
+}
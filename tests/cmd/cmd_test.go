@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/cmd"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// TestMain runs the test binary as the CLI when run re-executes it, so each
+// command starts with fresh flags and state, as it does from a shell
+func TestMain(m *testing.M) {
+	if os.Getenv("VULNSCAN_TEST_CLI") == "" {
+		os.Exit(m.Run())
+	}
+	// Report files are fetched from the test's file server
+	if raw := os.Getenv("VULNSCAN_TEST_RAW_URL"); raw != "" {
+		github.DefaultFetcher = &github.RawFetcher{HTTP: http.DefaultClient, Hosts: map[string]string{"github.com": raw}}
+	}
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// cli runs vulnscan commands against a database in a temporary directory
+type cli struct {
+	t   *testing.T
+	env []string
+}
+
+// newCLI returns a CLI whose offline commands use a new database, and
+// whose scans fetch files of any repository at any ref from testdata
+func newCLI(t *testing.T) *cli {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Paths are /owner/name/ref/file
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 4)
+		if len(parts) < 4 {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", parts[3]))
+	}))
+	t.Cleanup(srv.Close)
+	return &cli{t: t, env: append(os.Environ(),
+		"VULNSCAN_TEST_CLI=1",
+		"VULNSCAN_TEST_RAW_URL="+srv.URL,
+		"DATABASE_DSN=file:"+filepath.Join(t.TempDir(), "vulnscan.db")+"?_busy_timeout=5000",
+		"VULNSCAN_SERVER=http://127.0.0.1:1", // Nothing listens; commands must not need a server
+		"CONFIG_FILE=",
+		"PUSHGATEWAY_URL=",
+	)}
+}
+
+// run runs the CLI with args, returning its standard output and error
+func (c *cli) run(args ...string) (string, string, error) {
+	command := exec.Command(os.Args[0], args...)
+	command.Env = c.env
+	var stdout, stderr bytes.Buffer
+	command.Stdout, command.Stderr = &stdout, &stderr
+	err := command.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// TestFlags tests that invalid and conflicting flags are rejected before
+// any server or database is used
+func TestFlags(t *testing.T) {
+	c := newCLI(t)
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"scan", "--repo", "https://github.com/acme/api"}, "--repo and --files are required"},
+		{[]string{"scan", "--files", "report.json"}, "--repo and --files are required"},
+		{[]string{"scan", "--repo", "https://github.com/acme/api", "--files", "report.json", "--timeout", "soon"}, `invalid argument "soon"`},
+		{[]string{"scan", "--repo", "https://github.com/acme/api", "--files", "report.json", "--label", "team"}, "team must be formatted as key=value"},
+		{[]string{"scan", "extra"}, `unknown command "extra"`},
+		{[]string{"query", "--severity", "HIGH", "--output", "xml"}, `invalid --output "xml"`},
+		{[]string{"query", "--severity", "HIGH", "--count", "--exists"}, "mutually exclusive"},
+		{[]string{"query", "--severity", "HIGH", "--columns", "nope"}, "nope"},
+		{[]string{"query", "--severity", "HIGH", "--epss-min", "high"}, `invalid argument "high"`},
+		{[]string{"query", "--severity", "HIGH", "--sort", "age"}, `unknown sort key "age"`},
+		{[]string{"query"}, "filter is required"},
+		{[]string{"query", "--severity", "HIGH", "--bogus"}, "unknown flag: --bogus"},
+	} {
+		stdout, stderr, err := c.run(tc.args...)
+		assert.Error(t, err, tc.args)
+		assert.Empty(t, stdout, tc.args)
+		assert.Contains(t, stderr, tc.err, tc.args)
+	}
+
+	stdout, _, err := c.run("query", "--help")
+	assert.NoError(t, err)
+	assert.Contains(t, stdout, "--offline")
+	assert.Contains(t, stdout, "--severity")
+}
+
+// TestOffline tests scanning a report file into the local database and
+// querying it, without a server
+func TestOffline(t *testing.T) {
+	c := newCLI(t)
+
+	stdout, stderr, err := c.run("scan", "--offline", "--repo", "https://github.com/acme/api", "--ref", "main",
+		"--files", "report.json", "--label", "team=payments")
+	if !assert.NoError(t, err, stderr) {
+		return
+	}
+	var scan api.ScanResponse
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &scan))
+	assert.Equal(t, []string{"report.json"}, scan.Success)
+	assert.Empty(t, scan.Failed)
+
+	// A missing file fails the command, after reporting it
+	stdout, _, err = c.run("scan", "--offline", "--repo", "https://github.com/acme/api", "--ref", "main", "--files", "missing.json")
+	assert.Error(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &scan))
+	assert.Len(t, scan.Failed, 1)
+
+	stdout, stderr, err = c.run("query", "--offline", "--severity", "HIGH", "-o", "json")
+	if !assert.NoError(t, err, stderr) {
+		return
+	}
+	var vulns []models.Vulnerability
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &vulns))
+	if assert.Len(t, vulns, 2) {
+		assert.Equal(t, "CVE-2024-1111", vulns[0].CVEID)
+		assert.Equal(t, "CVE-2024-2222", vulns[1].CVEID)
+	}
+
+	stdout, _, err = c.run("query", "--offline", "--label", "team=payments", "--sort", "cvss", "-o", "csv", "--columns", "id,severity")
+	assert.NoError(t, err)
+	assert.Equal(t, "ID,Severity\nCVE-2024-3333,LOW\nCVE-2024-2222,HIGH\nCVE-2024-1111,HIGH\n", stdout)
+
+	stdout, _, err = c.run("query", "--offline", "--expr", `package_name = "curl"`)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasPrefix(lines[0], "CVE "))
+		assert.True(t, strings.HasPrefix(lines[1], "CVE-2024-3333 "))
+	}
+
+	stdout, _, err = c.run("query", "--offline", "--severity", "HIGH", "--count")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", strings.TrimSpace(stdout))
+	stdout, _, err = c.run("query", "--offline", "--severity", "CRITICAL", "--exists")
+	assert.NoError(t, err)
+	assert.Equal(t, "false", strings.TrimSpace(stdout))
+}
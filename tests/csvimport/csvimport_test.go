@@ -0,0 +1,130 @@
+package csvimport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// post sends a CSV file to the import handler
+func post(target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-Actor", "migration")
+	rr := httptest.NewRecorder()
+	handlers.CSVImportHandler(rr, req)
+	return rr
+}
+
+// TestCSVImport tests that historical rows become scans at their last
+// sighting, with first-seen dates and triage state
+func TestCSVImport(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rr := post("/import/csv?repo=github.com/acme/api&map=Owner:assignee&map=Notes:", `CVE,Package,Severity,Version,First Seen,Last Seen,Triage Status,Owner,Notes
+CVE-2021-0001,openssl,high,1.1.1k,2021-03-01,2022-06-30,wont_fix,alice,legacy
+CVE-2022-0002,lodash,Critical,4.17.20,2022-01-15,2023-02-01,,,
+CVE-2022-0003,zlib,LOW,1.2.11,2022-05-01,2023-02-01,acknowledged,,
+
+CVE-2023-0004,curl,,8.0.0,2023-01-10T08:00:00Z,,,,
+`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp handlers.CSVImportResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, handlers.CSVImportResponse{Findings: 4, Repos: 1, Scans: 3, Resolved: 3}, resp)
+
+	// Rows are stored under the canonical repository as scans at their
+	// last sighting, and only the latest one's are still open
+	findings, err := handlers.ListFindings(context.Background(), handlers.FindingFilters{Repo: "https://github.com/acme/api", Limit: 10})
+	assert.NoError(t, err)
+	byPackage := map[string]handlers.Finding{}
+	for _, f := range findings {
+		byPackage[f.PackageName] = f
+	}
+	assert.Len(t, byPackage, 4)
+	assert.Equal(t, time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), byPackage["openssl"].FirstSeen.UTC())
+	assert.Equal(t, time.Date(2022, time.June, 30, 0, 0, 0, 0, time.UTC), byPackage["openssl"].LastSeen.UTC())
+	assert.Equal(t, "resolved", byPackage["openssl"].Status)
+	assert.Equal(t, "resolved", byPackage["lodash"].Status)
+	assert.Equal(t, "resolved", byPackage["zlib"].Status)
+	assert.Equal(t, time.Date(2023, time.January, 10, 8, 0, 0, 0, time.UTC), byPackage["curl"].FirstSeen.UTC())
+	assert.Equal(t, "open", byPackage["curl"].Status)
+
+	var rows []struct {
+		Package  string `db:"package_name"`
+		Severity string `db:"severity"`
+		Status   string `db:"triage_status"`
+		Assignee string `db:"assignee"`
+	}
+	assert.NoError(t, db.Select(&rows, "SELECT package_name, severity, triage_status, assignee FROM vulnerabilities ORDER BY package_name"))
+	assert.Equal(t, []struct {
+		Package  string `db:"package_name"`
+		Severity string `db:"severity"`
+		Status   string `db:"triage_status"`
+		Assignee string `db:"assignee"`
+	}{
+		{"curl", "UNKNOWN", "open", ""},
+		{"lodash", "CRITICAL", "open", ""},
+		{"openssl", "HIGH", "wont_fix", "alice"},
+		{"zlib", "LOW", "acknowledged", ""},
+	}, rows)
+	var actors []string
+	assert.NoError(t, db.Select(&actors, "SELECT DISTINCT actor FROM triage_audit"))
+	assert.Equal(t, []string{"migration"}, actors)
+}
+
+// TestCSVImportInvalid tests that a file with any invalid row is rejected
+// whole, naming the lines
+func TestCSVImportInvalid(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for body, want := range map[string]string{
+		"":                          "empty file",
+		"id,package_name\n":         "no findings",
+		"id,severity\nCVE-1,HIGH\n": "no column maps to package_name",
+		"id,package_name,cvss,first_seen,last_seen,repo\n" +
+			"CVE-1,openssl,11,,,r\n" +
+			"CVE-2,zlib,,2024-02-01,2024-01-01,r\n" +
+			"CVE-3,curl,,,yesterday,r\n" +
+			"CVE-4,,,,,r\n" +
+			"CVE-5,git,,,,\n": `line 2: invalid cvss "11"; line 3: first_seen is after last_seen; line 4: invalid last_seen "yesterday"; line 5: package_name is required; line 6: repo is required`,
+		"id,package_name,repo,triage_status\nCVE-1,openssl,r,done\n": `line 2: unknown triage status "done"`,
+	} {
+		rr := post("/import/csv", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		assert.Contains(t, rr.Body.String(), want)
+	}
+	rr := post("/import/csv?map=Severity:rating", "id,package_name,Severity\n")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM vulnerabilities"))
+	assert.Zero(t, count)
+}
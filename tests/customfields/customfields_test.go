@@ -0,0 +1,143 @@
+package customfields
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestCustomFields tests defining custom fields, setting them on
+// vulnerabilities and scans, and filtering queries by them
+func TestCustomFields(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ctx := context.Background()
+	var scans []int64
+	for _, repo := range []string{"https://github.com/acme/api", "https://github.com/acme/web"} {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, 'scan.json', ?, 'a', ?)",
+			repo, time.Now().UTC(), time.Now().UTC())
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		scans = append(scans, scanID)
+		for _, v := range []models.Vulnerability{
+			{CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "openssl", RiskFactors: models.RiskFactors{}},
+			{CVEID: "CVE-2024-5678", Severity: "HIGH", PackageName: "log4j", RiskFactors: models.RiskFactors{}},
+		} {
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/custom-fields", handlers.CustomFieldsHandler)
+	mux.HandleFunc("/admin/custom-fields/{name}", handlers.CustomFieldHandler)
+	mux.HandleFunc("/vulnerabilities/{id}/fields", handlers.VulnerabilityFieldsHandler)
+	mux.HandleFunc("/scans/{id}/fields", handlers.ScanFieldsHandler)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("X-Actor", "alice")
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Definitions
+	rr := do(http.MethodPost, "/admin/custom-fields", `{"name": "exception_ticket", "target": "vulnerability", "type": "string"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "/admin/custom-fields/exception_ticket", rr.Header().Get("Location"))
+	rr = do(http.MethodPost, "/admin/custom-fields", `{"name": "business_unit", "target": "scan", "type": "string", "allowed_values": ["payments", "retail"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	rr = do(http.MethodPost, "/admin/custom-fields", `{"name": "risk_score", "target": "vulnerability", "type": "number"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	for _, body := range []string{
+		`{"name": "Business Unit", "target": "scan", "type": "string"}`,
+		`{"name": "owner", "target": "repo", "type": "string"}`,
+		`{"name": "owner", "target": "scan", "type": "date"}`,
+		`{"name": "owner", "target": "scan", "type": "number", "allowed_values": ["1"]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/custom-fields", body).Code, body)
+	}
+	var fields []handlers.CustomField
+	rr = do(http.MethodGet, "/admin/custom-fields", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &fields))
+	if assert.Len(t, fields, 3) {
+		assert.Equal(t, "business_unit", fields[0].Name)
+		assert.Equal(t, "alice", fields[0].CreatedBy)
+	}
+
+	// Values
+	rr = do(http.MethodPatch, "/vulnerabilities/1/fields", `{"exception_ticket": "SEC-42", "risk_score": 7.5}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"exception_ticket": "SEC-42", "risk_score": 7.5}`, rr.Body.String())
+	rr = do(http.MethodPatch, "/scans/1/fields", `{"business_unit": "payments"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	for _, tc := range []struct {
+		target, body string
+		code         int
+	}{
+		{"/scans/1/fields", `{"business_unit": "marketing"}`, http.StatusBadRequest},
+		{"/scans/1/fields", `{"exception_ticket": "SEC-1"}`, http.StatusBadRequest},
+		{"/vulnerabilities/2/fields", `{"risk_score": "high"}`, http.StatusBadRequest},
+		{"/vulnerabilities/2/fields", `{"nope": "x"}`, http.StatusBadRequest},
+		{"/vulnerabilities/99/fields", `{"risk_score": 1}`, http.StatusNotFound},
+	} {
+		assert.Equal(t, tc.code, do(http.MethodPatch, tc.target, tc.body).Code, tc.body)
+	}
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/scans/99/fields", "").Code)
+
+	// A field with values keeps its type
+	rr = do(http.MethodPost, "/admin/custom-fields", `{"name": "risk_score", "target": "vulnerability", "type": "string"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// Queries return and filter by a vulnerability's fields and its scan's
+	ids := func(values map[string]string) []int64 {
+		vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{CustomFields: values, Sort: []string{"finding_id"}})
+		assert.NoError(t, err)
+		var ids []int64
+		for _, v := range vulns {
+			ids = append(ids, v.FindingID)
+		}
+		return ids
+	}
+	assert.Equal(t, []int64{1, 2}, ids(map[string]string{"business_unit": "payments"}))
+	assert.Equal(t, []int64{1}, ids(map[string]string{"business_unit": "payments", "risk_score": "7.50"}))
+	assert.Empty(t, ids(map[string]string{"undefined": "x"}))
+	vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{ID: "CVE-2024-1234", Dedup: handlers.DedupOff, Sort: []string{"finding_id"}})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 2) {
+		assert.Equal(t, map[string]any{"exception_ticket": "SEC-42", "risk_score": 7.5, "business_unit": "payments"}, vulns[0].CustomFields)
+		assert.Nil(t, vulns[1].CustomFields)
+	}
+	assert.Error(t, handlers.ValidateQueryFilters(handlers.QueryFilters{CustomFields: map[string]string{"Bad Name": "x"}}))
+	assert.NoError(t, handlers.ValidateQueryFilters(handlers.QueryFilters{CustomFields: map[string]string{"business_unit": "x"}}))
+
+	// Null clears a value; deleting a definition clears all of them
+	rr = do(http.MethodPatch, "/vulnerabilities/1/fields", `{"risk_score": null}`)
+	assert.JSONEq(t, `{"exception_ticket": "SEC-42"}`, rr.Body.String())
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/custom-fields/business_unit", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/admin/custom-fields/business_unit", "").Code)
+	var n int
+	assert.NoError(t, db.Get(&n, "SELECT COUNT(*) FROM custom_field_values WHERE field = 'business_unit'"))
+	assert.Zero(t, n)
+	assert.JSONEq(t, `{}`, do(http.MethodGet, "/scans/1/fields", "").Body.String())
+}
@@ -0,0 +1,130 @@
+package defectdojo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/defectdojo"
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// dojoReport is a DefectDojo export with a finding in each triage state
+const dojoReport = `{"findings": [
+	{"title": "CVE-2024-0001 in openssl", "severity": "Critical", "description": "Buffer overflow", "cvssv3_score": 9.8,
+		"component_name": "openssl", "component_version": "3.0.1", "planned_remediation_version": "3.0.8",
+		"references": "https://nvd.nist.gov/vuln/detail/CVE-2024-0001\nhttps://openssl.org", "publish_date": "2024-01-15",
+		"vulnerability_ids": [{"vulnerability_id": "CVE-2024-0001"}], "active": true, "verified": true},
+	{"title": "lodash prototype pollution", "severity": "High", "description": "", "cve": "CVE-2024-0002",
+		"component_name": "lodash", "component_version": "4.17.20", "file_path": "web/package-lock.json", "false_p": true, "active": false},
+	{"title": "zlib", "severity": "Info", "description": "Informational", "vuln_id_from_tool": "GHSA-xxxx-yyyy-zzzz",
+		"component_name": "zlib", "component_version": "1.2.11", "active": false, "is_mitigated": true},
+	{"title": "curl", "severity": "Low", "description": "Open", "vuln_id_from_tool": "CVE-2024-0004", "component_name": "curl"}
+]}`
+
+// TestDefectDojoIngest tests that DefectDojo findings are detected and
+// mapped, flags included
+func TestDefectDojoIngest(t *testing.T) {
+	format, results, err := formats.Parse([]byte(dojoReport))
+	assert.NoError(t, err)
+	assert.Equal(t, "defectdojo", format)
+	if !assert.Len(t, results, 1) || !assert.Len(t, results[0].Vulnerabilities, 4) {
+		return
+	}
+	vulns := results[0].Vulnerabilities
+	assert.Equal(t, "CVE-2024-0001", vulns[0].CVEID)
+	assert.Equal(t, "CRITICAL", vulns[0].Severity)
+	assert.Equal(t, 9.8, vulns[0].CVSS)
+	assert.Equal(t, "3.0.8", vulns[0].FixedVersion)
+	assert.Equal(t, "https://nvd.nist.gov/vuln/detail/CVE-2024-0001", vulns[0].Link)
+	assert.Equal(t, "2024-01-15", vulns[0].PublishedDate.Format("2006-01-02"))
+	assert.Equal(t, "acknowledged", vulns[0].TriageStatus)
+	assert.Equal(t, "CVE-2024-0002", vulns[1].CVEID)
+	assert.Equal(t, "lodash prototype pollution", vulns[1].Description)
+	assert.Equal(t, "web/package-lock.json", vulns[1].Location)
+	assert.Equal(t, "false_positive", vulns[1].TriageStatus)
+	assert.Equal(t, "GHSA-xxxx-yyyy-zzzz", vulns[2].CVEID)
+	assert.Equal(t, "UNKNOWN", vulns[2].Severity)
+	assert.Equal(t, "resolved", vulns[2].TriageStatus)
+	assert.Equal(t, "", vulns[3].TriageStatus)
+
+	_, _, err = formats.Parse([]byte(`{"findings": [{"title": "no id", "severity": "High"}]}`))
+	assert.Error(t, err)
+}
+
+// TestDefectDojoRoundTrip tests that scanned DefectDojo findings keep their
+// triage state and export back with the same flags
+func TestDefectDojoRoundTrip(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	scanner := handlers.NewScanner(fetcher{"dojo.json": dojoReport})
+	rr := httptest.NewRecorder()
+	scanner.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan",
+		strings.NewReader(`{"repo": "https://github.com/acme/api", "files": ["dojo.json"]}`)))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"filters": {"expr": "package_name ~ \"*\""}}`))
+	req.Header.Set("Accept", defectdojo.MediaType)
+	rr = httptest.NewRecorder()
+	handlers.QueryHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, defectdojo.MediaType, rr.Header().Get("Content-Type"))
+
+	var report defectdojo.Report
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	if !assert.Len(t, report.Findings, 4) {
+		return
+	}
+	byID := map[string]defectdojo.Finding{}
+	for _, f := range report.Findings {
+		byID[f.VulnIDFromTool] = f
+		assert.Len(t, f.UniqueIDFromTool, 64)
+	}
+	openssl := byID["CVE-2024-0001"]
+	assert.Equal(t, "Critical", openssl.Severity)
+	assert.Equal(t, "CVE-2024-0001 in openssl 3.0.1", openssl.Title)
+	assert.Equal(t, "3.0.8", openssl.PlannedRemediationVersion)
+	assert.Equal(t, "Upgrade openssl to 3.0.8", openssl.Mitigation)
+	assert.True(t, openssl.Verified)
+	assert.True(t, *openssl.Active)
+	assert.True(t, byID["CVE-2024-0002"].FalseP)
+	assert.False(t, *byID["CVE-2024-0002"].Active)
+	assert.Equal(t, "web/package-lock.json", byID["CVE-2024-0002"].FilePath)
+	assert.True(t, byID["GHSA-xxxx-yyyy-zzzz"].IsMitigated)
+	assert.Equal(t, "Info", byID["GHSA-xxxx-yyyy-zzzz"].Severity)
+	assert.True(t, *byID["CVE-2024-0004"].Active)
+	assert.False(t, byID["CVE-2024-0004"].Verified)
+
+	// The export is itself a report DefectDojo findings can be read from
+	format, results, err := formats.Parse(rr.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "defectdojo", format)
+	assert.Len(t, results[0].Vulnerabilities, 4)
+}
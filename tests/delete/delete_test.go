@@ -0,0 +1,168 @@
+package delete
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// TestBulkDelete tests previewing and confirming deletions of scans and
+// vulnerabilities by filter
+func TestBulkDelete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Two scans of api, 100 and 10 days old, and one of web, 100 days old
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, s := range []struct {
+		repo string
+		age  time.Duration
+	}{
+		{"https://github.com/acme/api", 100 * 24 * time.Hour},
+		{"https://github.com/acme/api", 10 * 24 * time.Hour},
+		{"https://github.com/acme/web", 100 * 24 * time.Hour},
+	} {
+		at := now.Add(-s.age)
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, sha256) VALUES (?, 'scan.json', ?, 'a', ?, ?)",
+			s.repo, at, at, fmt.Sprint(s.repo, s.age))
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		assert.NoError(t, storage.PutRawFile(ctx, db, fmt.Sprint(s.repo, s.age), storage.RawIdentity, []byte("{}")))
+		_, err = db.Exec("INSERT INTO scan_labels (scan_id, key, value) VALUES (?, 'team', 'payments')", scanID)
+		assert.NoError(t, err)
+		for _, v := range []models.Vulnerability{
+			{CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "openssl", RiskFactors: models.RiskFactors{}},
+			{CVEID: "CVE-2024-5678", Severity: "LOW", PackageName: "zlib", RiskFactors: models.RiskFactors{}},
+		} {
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+		}
+	}
+	_, err := db.Exec("INSERT INTO vulnerability_comments (vulnerability_id, author, body, created_at) VALUES (1, 'alice', 'x', ?)", now)
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/delete", handlers.Audit("/admin/delete", handlers.DeleteHandler))
+	do := func(body string) (int, handlers.DeleteResponse) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/delete", strings.NewReader(body))
+		req.Header.Set("X-Actor", "alice")
+		mux.ServeHTTP(rr, req)
+		var resp handlers.DeleteResponse
+		if rr.Code != http.StatusBadRequest {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp), rr.Body.String())
+		}
+		return rr.Code, resp
+	}
+	count := func(table string) int {
+		var n int
+		assert.NoError(t, db.Get(&n, "SELECT COUNT(*) FROM "+table))
+		return n
+	}
+
+	for _, body := range []string{
+		`{"target": "components", "filter": {"repo": "https://github.com/acme/api"}}`,
+		`{"target": "scans", "filter": {}}`,
+		`{"target": "scans", "filter": {"severity": "LOW"}}`,
+		`{"target": "scans", "filter": {"older_than": "soon"}}`,
+		`{"target": "scans", "filter": {"older_than": "-5d"}}`,
+		`{"target": "scans", "filter": {"repo": "https://github.com/acme/api", "severity": "LOW"}}`,
+	} {
+		code, _ := do(body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+
+	// A preview deletes nothing
+	code, preview := do(`{"target": "vulnerabilities", "filter": {"older_than": "30d", "severity": "low"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, preview.Applied)
+	assert.Equal(t, 0, preview.Scans)
+	assert.Equal(t, 2, preview.Vulnerabilities)
+	assert.NotEmpty(t, preview.ConfirmationToken)
+	assert.Equal(t, 6, count("vulnerabilities"))
+
+	// A wrong token is refused with the current preview
+	code, resp := do(`{"target": "vulnerabilities", "filter": {"older_than": "30d", "severity": "low"}, "confirm": "stale"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, preview, resp)
+
+	code, resp = do(`{"target": "vulnerabilities", "filter": {"older_than": "30d", "severity": "low"}, "confirm": "` + preview.ConfirmationToken + `"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.DeleteResponse{Applied: true, Vulnerabilities: 2}, resp)
+	assert.Equal(t, 4, count("vulnerabilities"))
+	assert.Equal(t, 3, count("scans"))
+	// api still reports zlib in its recent scan; web no longer does
+	assert.Equal(t, 3, count("findings"))
+
+	// Deleting api's old scan takes its vulnerabilities, comments, labels,
+	// and original content along
+	code, preview = do(`{"target": "scans", "filter": {"repo": "https://github.com/acme/api/", "older_than": "720h"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, preview.Scans)
+	assert.Equal(t, 1, preview.Vulnerabilities)
+	code, resp = do(`{"target": "scans", "filter": {"repo": "https://github.com/acme/api/", "older_than": "720h"}, "confirm": "` + preview.ConfirmationToken + `"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Applied)
+	assert.Equal(t, 2, count("scans"))
+	assert.Equal(t, 3, count("vulnerabilities"))
+	assert.Equal(t, 0, count("vulnerability_comments"))
+	assert.Equal(t, 2, count("scan_labels"))
+	assert.Equal(t, 2, count("raw_files"))
+
+	// A confirmation of a preview whose matches changed applies nothing
+	code, preview = do(`{"target": "scans", "filter": {"repo": "https://github.com/acme/web"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES ('https://github.com/acme/web', 'scan.json', ?, 'b', ?)", now, now)
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, models.Vulnerability{CVEID: "CVE-2024-9999", Severity: "HIGH", PackageName: "curl", RiskFactors: models.RiskFactors{}}))
+	code, resp = do(`{"target": "scans", "filter": {"repo": "https://github.com/acme/web"}, "confirm": "` + preview.ConfirmationToken + `"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.False(t, resp.Applied)
+	assert.Equal(t, 2, resp.Scans)
+	assert.Equal(t, 3, count("scans"))
+
+	code, resp = do(`{"target": "scans", "filter": {"repo": "https://github.com/acme/web"}, "confirm": "` + resp.ConfirmationToken + `"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Applied)
+	var repos []string
+	assert.NoError(t, db.Select(&repos, "SELECT DISTINCT repo FROM findings"))
+	assert.Equal(t, []string{"https://github.com/acme/api"}, repos)
+
+	// Previews and deletions are recorded in the audit log
+	entries, err := storage.ListAuditLog(ctx, db, storage.AuditFilter{Action: "POST /admin/delete", Limit: 50})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 14) {
+		assert.Equal(t, "alice", entries[0].Actor)
+		assert.Equal(t, "scans repo=https://github.com/acme/web: deleted 2 scans, 2 vulnerabilities", entries[0].Target)
+		assert.Equal(t, http.StatusConflict, entries[1].Status)
+		assert.Equal(t, "scans repo=https://github.com/acme/web", entries[1].Target)
+	}
+}
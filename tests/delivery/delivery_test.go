@@ -0,0 +1,255 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/delivery"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/notify"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestParseSchedule tests cron parsing and next-run computation
+func TestParseSchedule(t *testing.T) {
+	wed := time.Date(2026, 10, 14, 10, 7, 30, 0, time.UTC) // Wednesday
+	for expr, want := range map[string]time.Time{
+		"0 8 * * mon":      time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2026, 10, 14, 10, 15, 0, 0, time.UTC),
+		"0 9 * * 1-5":      time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC),
+		"30 6 1,15 * *":    time.Date(2026, 10, 15, 6, 30, 0, 0, time.UTC),
+		"0 0 1 jan *":      time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0 12 * * 7":       time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		"0 0 20 * fri":     time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), // Either day field matches
+		"5/20 10 * * *":    time.Date(2026, 10, 14, 10, 25, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 8-18/2 * * wed": time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC),
+	} {
+		s, err := delivery.ParseSchedule(expr)
+		if assert.NoError(t, err, expr) {
+			assert.Equal(t, want, s.Next(wed), expr)
+		}
+	}
+
+	// Schedules are evaluated in the location of the given time
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database unavailable")
+	}
+	s, _ := delivery.ParseSchedule("0 8 * * mon")
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), s.Next(wed.In(ny)).UTC())
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "0 0 * * funday", "0 0 30 2 *"} {
+		_, err := delivery.ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// capture records the messages sent to it
+type capture struct {
+	mu   sync.Mutex
+	msgs []notify.Message
+}
+
+// Send records msg
+func (c *capture) Send(ctx context.Context, msg notify.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+// smtpServer accepts one SMTP session at a time and records each message
+// received
+func smtpServer(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 4)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r, w := bufio.NewReader(conn), conn
+			io.WriteString(w, "220 localhost ESMTP\r\n")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+				case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+					io.WriteString(w, "250 localhost\r\n")
+				case cmd == "DATA":
+					io.WriteString(w, "354 go ahead\r\n")
+					var data strings.Builder
+					for {
+						l, err := r.ReadString('\n')
+						if err != nil || l == ".\r\n" {
+							break
+						}
+						data.WriteString(strings.TrimPrefix(l, "."))
+					}
+					received <- data.String()
+					io.WriteString(w, "250 queued\r\n")
+				case cmd == "QUIT":
+					io.WriteString(w, "221 bye\r\n")
+				default:
+					io.WriteString(w, "250 ok\r\n")
+				}
+				if strings.HasPrefix(strings.ToUpper(line), "QUIT") {
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+// TestDelivery tests running saved queries on schedule and sending their
+// results to chat and email channels
+func TestDelivery(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scanner := handlers.NewScanner(fetcher{
+		"trivy.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[
+			{"id":"CVE-2024-0001","severity":"CRITICAL","package_name":"openssl","fixed_version":"3.0.8"},
+			{"id":"CVE-2024-0002","severity":"HIGH","package_name":"curl"},
+			{"id":"CVE-2024-0003","severity":"LOW","package_name":"zlib"}]}}`,
+	})
+	resp := scanner.Run(ctx, handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"trivy.json"}})
+	assert.Equal(t, []string{"trivy.json"}, resp.Success)
+	_, err = handlers.SaveQuery(ctx, &handlers.SavedQuery{
+		Name: "prod-critical", Description: "Critical findings", Filters: handlers.QueryFilters{Severity: "CRITICAL"},
+		Columns: []string{"id", "package_name", "fixed_version"},
+	})
+	assert.NoError(t, err)
+
+	chat := &capture{}
+	notify.RegisterChannel("capture", func(cfg notify.ChannelConfig, client *http.Client) (notify.Channel, error) {
+		return chat, nil
+	})
+	addr, received := smtpServer(t)
+	n, err := notify.New(notify.Config{Channels: []notify.ChannelConfig{
+		{Name: "security", Type: "capture"},
+		{Name: "mail", Type: "email", SMTPAddr: addr, From: "vulnscan@example.com", To: []string{"sec@example.com", "ciso@example.com"}},
+	}}, db)
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC) // Wednesday
+	d, err := delivery.New(delivery.Config{Reports: []delivery.Report{
+		{Name: "weekly", Query: "prod-critical", Schedule: "0 8 * * mon", Channels: []string{"security", "mail"}},
+		{Name: "missing", Query: "nope", Schedule: "0 9 * * mon", Channels: []string{"security"}},
+	}}, n, now)
+	assert.NoError(t, err)
+	d.BaseURL = "https://vulnscan.example.com/"
+	next, ok := d.Next("weekly")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), next)
+
+	// Nothing is due before Monday
+	assert.NoError(t, d.RunDue(ctx, now.Add(time.Hour)))
+	assert.Empty(t, chat.msgs)
+
+	err = d.RunDue(ctx, time.Date(2026, 10, 19, 8, 0, 30, 0, time.UTC))
+	assert.NoError(t, err)
+	if assert.Len(t, chat.msgs, 1) {
+		msg := chat.msgs[0]
+		assert.Equal(t, notify.KindReport, msg.Kind)
+		assert.Equal(t, "Scheduled report weekly: 1 finding(s)", msg.Title)
+		assert.Equal(t, "CRITICAL", msg.Severity)
+		assert.Contains(t, msg.Text, "Critical findings\nSaved query prod-critical: 1 CRITICAL")
+		assert.Contains(t, msg.Text, "https://vulnscan.example.com/queries/prod-critical/run")
+		if assert.Len(t, msg.Attachments, 1) {
+			assert.Equal(t, "weekly-2026-10-19.csv", msg.Attachments[0].Name)
+			assert.Equal(t, "ID,Package,Fixed Version\nCVE-2024-0001,openssl,3.0.8\n", strings.ReplaceAll(string(msg.Attachments[0].Data), "\r\n", "\n"))
+		}
+	}
+	next, _ = d.Next("weekly")
+	assert.Equal(t, time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC), next)
+
+	// The email carries the CSV as an attachment
+	select {
+	case raw := <-received:
+		m, err := mail.ReadMessage(strings.NewReader(raw))
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.Equal(t, "sec@example.com, ciso@example.com", m.Header.Get("To"))
+		assert.Equal(t, "Scheduled report weekly: 1 finding(s)", m.Header.Get("Subject"))
+		_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		mr := multipart.NewReader(m.Body, params["boundary"])
+		body, err := mr.NextPart()
+		if assert.NoError(t, err) {
+			text, _ := io.ReadAll(body)
+			assert.Contains(t, string(text), "Saved query prod-critical")
+		}
+		part, err := mr.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "weekly-2026-10-19.csv", part.FileName())
+			data, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+			assert.Contains(t, string(data), "CVE-2024-0001,openssl,3.0.8")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+
+	// A report whose saved query is gone fails without affecting the others
+	err = d.RunDue(ctx, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC))
+	assert.ErrorContains(t, err, `report "missing": saved query "nope"`)
+
+	for _, cfg := range []delivery.Report{
+		{Name: "x", Query: "q", Schedule: "daily", Channels: []string{"security"}},
+		{Name: "x", Query: "q", Schedule: "0 8 * * *", Channels: []string{"pager"}},
+		{Name: "x", Query: "q", Schedule: "0 8 * * *"},
+		{Name: "x", Query: "q", Schedule: "0 8 * * *", Channels: []string{"security"}, Format: "pdf"},
+		{Name: "x", Query: "q", Schedule: "0 8 * * *", Channels: []string{"security"}, Timezone: "Mars/Olympus"},
+		{Query: "q", Schedule: "0 8 * * *", Channels: []string{"security"}},
+	} {
+		_, err := delivery.New(delivery.Config{Reports: []delivery.Report{cfg}}, n, now)
+		assert.Error(t, err, cfg)
+	}
+	_, err = notify.New(notify.Config{Channels: []notify.ChannelConfig{{Name: "m", Type: "email", To: []string{"a@example.com"}}}}, db)
+	assert.ErrorContains(t, err, "smtp_addr, from, and to are required")
+}
@@ -0,0 +1,258 @@
+package dtrack
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/dtrack"
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fpf is a Finding Packaging Format export with a finding in each analysis
+// state
+const fpf = `{"version": "1.2", "meta": {"application": "Dependency-Track", "timestamp": "2024-05-01T08:00:00.123Z"},
+	"project": {"uuid": "8f4c", "name": "legacy-app", "version": "2.x"},
+	"findings": [
+		{"component": {"name": "jackson-databind", "group": "com.fasterxml.jackson.core", "version": "2.9.8",
+			"purl": "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.9.8"},
+		 "vulnerability": {"source": "NVD", "vulnId": "CVE-2019-12384", "title": "", "severity": "HIGH", "cvssV3BaseScore": 5.9,
+			"description": "Polymorphic typing issue", "patchedVersions": "2.9.9.1", "published": "2019-06-24T16:15:00Z",
+			"aliases": [{"cveId": "CVE-2019-12384", "ghsaId": "GHSA-mph4-vhrx-mv67"}]},
+		 "analysis": {"state": "EXPLOITABLE", "isSuppressed": false}},
+		{"component": {"name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20"},
+		 "vulnerability": {"vulnId": "CVE-2021-23337", "title": "Command injection", "severity": "UNASSIGNED", "cvssV2BaseScore": 6.5},
+		 "analysis": {"state": "NOT_AFFECTED", "isSuppressed": true}},
+		{"component": {"name": "zlib", "group": "madler", "version": "1.2.11"},
+		 "vulnerability": {"vulnId": "CVE-2018-25032", "severity": "CRITICAL"},
+		 "analysis": {"isSuppressed": true}},
+		{"component": {"name": "curl", "version": "7.80.0"},
+		 "vulnerability": {"vulnId": "CVE-2022-22576", "severity": "medium"},
+		 "analysis": {"state": "NOT_SET"}}
+	]}`
+
+// TestFindingsIngest tests that Finding Packaging Format findings are
+// detected and mapped, analysis state included
+func TestFindingsIngest(t *testing.T) {
+	format, results, err := formats.Parse([]byte(fpf))
+	assert.NoError(t, err)
+	assert.Equal(t, "dependency-track", format)
+	if !assert.Len(t, results, 1) || !assert.Len(t, results[0].Vulnerabilities, 4) {
+		return
+	}
+	assert.Equal(t, "legacy-app 2.x", results[0].ResourceName)
+	assert.Equal(t, "2024-05-01", results[0].Timestamp.Format("2006-01-02"))
+
+	vulns := results[0].Vulnerabilities
+	assert.Equal(t, "CVE-2019-12384", vulns[0].CVEID)
+	assert.Equal(t, "HIGH", vulns[0].Severity)
+	assert.Equal(t, 5.9, vulns[0].CVSS)
+	assert.Equal(t, "com.fasterxml.jackson.core:jackson-databind", vulns[0].PackageName)
+	assert.Equal(t, "2.9.9.1", vulns[0].FixedVersion)
+	assert.Equal(t, []string{"GHSA-mph4-vhrx-mv67"}, vulns[0].Aliases)
+	assert.Equal(t, "acknowledged", vulns[0].TriageStatus)
+	assert.Equal(t, "UNKNOWN", vulns[1].Severity)
+	assert.Equal(t, 6.5, vulns[1].CVSS)
+	assert.Equal(t, "Command injection", vulns[1].Description)
+	assert.Equal(t, "false_positive", vulns[1].TriageStatus)
+	assert.Equal(t, "madler/zlib", vulns[2].PackageName)
+	assert.Equal(t, "wont_fix", vulns[2].TriageStatus)
+	assert.Equal(t, "MEDIUM", vulns[3].Severity)
+	assert.Equal(t, "", vulns[3].TriageStatus)
+
+	_, _, err = formats.Parse([]byte(`{"findings": [{"component": {"name": "x"}, "vulnerability": {"vulnId": "", "title": "t", "severity": "LOW"}}]}`))
+	assert.Error(t, err)
+}
+
+// server is a Dependency-Track server recording uploaded BOMs
+type server struct {
+	uploads []map[string]interface{}
+	fail    bool
+}
+
+// ServeHTTP implements the BOM upload, project lookup, and findings export
+// endpoints
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Api-Key") != "secret" || s.fail {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v1/bom":
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		s.uploads = append(s.uploads, body)
+		w.Write([]byte(`{"token": "abc"}`))
+	case r.URL.Path == "/api/v1/project/lookup" && r.URL.Query().Get("name") == "legacy-app" && r.URL.Query().Get("version") == "2.x":
+		w.Write([]byte(`{"uuid": "8f4c", "name": "legacy-app", "version": "2.x"}`))
+	case r.URL.Path == "/api/v1/finding/project/8f4c/export":
+		w.Write([]byte(fpf))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// TestPush tests that stored SBOM components are uploaded to the matching
+// push project, and that a failed upload only warns
+func TestPush(t *testing.T) {
+	dt := &server{}
+	srv := httptest.NewServer(dt)
+	defer srv.Close()
+	client := dtrack.NewClient(srv.URL, "secret", []dtrack.Project{
+		{Repo: "https://github.com/acme/payments", Mode: dtrack.ModePull},
+		{Repo: "https://github.com/Acme/*", Mode: dtrack.ModePush},
+		{Repo: "https://github.com/*/*", Mode: dtrack.ModePush, UUID: "0000"},
+	})
+
+	components := []models.Component{
+		{Name: "lodash", Version: "4.17.20", PURL: "pkg:npm/lodash@4.17.20", License: "MIT"},
+		{Name: "lodash", Version: "4.17.20", PURL: "pkg:npm/lodash@4.17.20", License: "MIT"},
+		{Name: "react", Version: "18.2.0", PURL: "pkg:npm/react@18.2.0", Type: "framework"},
+	}
+	in := &pipeline.Ingest{Repo: "https://github.com/acme/api", File: "sbom.json",
+		Results: []models.ScanResult{{Components: components}}}
+	assert.NoError(t, client.Push(context.Background(), in))
+	assert.Empty(t, in.Warnings)
+	if !assert.Len(t, dt.uploads, 1) {
+		return
+	}
+	upload := dt.uploads[0]
+	assert.Equal(t, "acme/api", upload["projectName"])
+	assert.Equal(t, "latest", upload["projectVersion"])
+	assert.Equal(t, true, upload["autoCreate"])
+
+	data, err := base64.StdEncoding.DecodeString(upload["bom"].(string))
+	assert.NoError(t, err)
+	var bom struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			Type     string `json:"type"`
+			Name     string `json:"name"`
+			PURL     string `json:"purl"`
+			Licenses []struct {
+				Expression string `json:"expression"`
+			} `json:"licenses"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &bom))
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	if assert.Len(t, bom.Components, 2) {
+		assert.Equal(t, "library", bom.Components[0].Type)
+		assert.Equal(t, "MIT", bom.Components[0].Licenses[0].Expression)
+		assert.Equal(t, "framework", bom.Components[1].Type)
+	}
+
+	// A project given by UUID is uploaded to, not created
+	in = &pipeline.Ingest{Repo: "https://github.com/other/app", Results: []models.ScanResult{{Components: components}}}
+	assert.NoError(t, client.Push(context.Background(), in))
+	if assert.Len(t, dt.uploads, 2) {
+		assert.Equal(t, "0000", dt.uploads[1]["project"])
+		assert.Nil(t, dt.uploads[1]["autoCreate"])
+	}
+
+	// Reports without components, and repositories of no push project, are not uploaded
+	in = &pipeline.Ingest{Repo: "https://github.com/acme/api", Results: []models.ScanResult{{}}}
+	assert.NoError(t, client.Push(context.Background(), in))
+	in = &pipeline.Ingest{Repo: "https://gitlab.com/acme/api", Results: []models.ScanResult{{Components: components}}}
+	assert.NoError(t, client.Push(context.Background(), in))
+	assert.Len(t, dt.uploads, 2)
+
+	dt.fail = true
+	in = &pipeline.Ingest{Repo: "https://github.com/acme/api", Results: []models.ScanResult{{Components: components}}}
+	assert.NoError(t, client.Push(context.Background(), in))
+	if assert.Len(t, in.Warnings, 1) {
+		assert.Equal(t, -1, in.Warnings[0].Index)
+		assert.Contains(t, in.Warnings[0].Reason, "HTTP status 401")
+	}
+}
+
+// TestPull tests that pull projects' findings are ingested as scans of
+// their repositories with their analysis state
+func TestPull(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	dt := &server{}
+	srv := httptest.NewServer(dt)
+	defer srv.Close()
+	client := dtrack.NewClient(srv.URL, "secret", []dtrack.Project{
+		{Repo: "https://github.com/acme/legacy", Mode: dtrack.ModePull, Name: "legacy-app", Version: "2.x"},
+		{Repo: "https://github.com/acme/missing", Mode: dtrack.ModePull, UUID: "ffff"},
+	})
+
+	scanner := handlers.NewScanner(nil)
+	var files []string
+	n, err := client.Pull(context.Background(), func(ctx context.Context, repo, file string, content []byte) error {
+		files = append(files, file)
+		resp := scanner.IngestArchive(ctx, repo, []archive.File{{Name: file, Content: content}}, nil)
+		if len(resp.Failed) > 0 {
+			return errors.New(resp.Failed[0].Error)
+		}
+		return nil
+	})
+	assert.Equal(t, 1, n)
+	assert.ErrorContains(t, err, "HTTP status 404")
+	assert.Equal(t, []string{"dependency-track/legacy-app@2.x"}, files)
+
+	var statuses []struct {
+		CVEID  string `db:"cve_id"`
+		Status string `db:"triage_status"`
+	}
+	err = db.Select(&statuses, `SELECT v.cve_id, v.triage_status FROM vulnerabilities v JOIN scans s ON s.id = v.scan_id
+		WHERE s.repo = 'https://github.com/acme/legacy' AND s.file_path = 'dependency-track/legacy-app@2.x' ORDER BY v.cve_id`)
+	assert.NoError(t, err)
+	assert.Equal(t, []struct {
+		CVEID  string `db:"cve_id"`
+		Status string `db:"triage_status"`
+	}{
+		{"CVE-2018-25032", "wont_fix"},
+		{"CVE-2019-12384", "acknowledged"},
+		{"CVE-2021-23337", "false_positive"},
+		{"CVE-2022-22576", "open"},
+	}, statuses)
+}
+
+// TestLoadConfig tests that invalid projects are rejected
+func TestLoadConfig(t *testing.T) {
+	for name, body := range map[string]string{
+		"mode":         `{"projects": [{"repo": "https://github.com/acme/api", "mode": "sync"}]}`,
+		"pull pattern": `{"projects": [{"repo": "https://github.com/acme/*", "mode": "pull"}]}`,
+		"push pattern": `{"projects": [{"repo": "https://github.com/[", "mode": "push"}]}`,
+		"json":         `{"projects": [`,
+	} {
+		file := t.TempDir() + "/dtrack.json"
+		assert.NoError(t, os.WriteFile(file, []byte(body), 0o600))
+		_, err := dtrack.LoadConfig(file)
+		assert.Error(t, err, name)
+	}
+
+	file := t.TempDir() + "/dtrack.json"
+	assert.NoError(t, os.WriteFile(file, []byte(`{"projects": [{"repo": "https://github.com/acme/*", "mode": "push"}]}`), 0o600))
+	cfg, err := dtrack.LoadConfig(file)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Projects, 1)
+}
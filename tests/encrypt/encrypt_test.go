@@ -0,0 +1,180 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/encrypt"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// newKey returns a random key in its base64 form
+func newKey(t *testing.T) string {
+	raw := make([]byte, encrypt.KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// TestStream tests encrypting and decrypting streams across chunk
+// boundaries and rejecting modified, truncated, or foreign ones
+func TestStream(t *testing.T) {
+	key, err := encrypt.ParseKey(newKey(t))
+	assert.NoError(t, err)
+	other, err := encrypt.ParseKey(newKey(t))
+	assert.NoError(t, err)
+
+	for _, size := range []int{0, 1, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		data := make([]byte, size)
+		rand.Read(data)
+		sealed, err := encrypt.Seal(key, data)
+		assert.NoError(t, err)
+		assert.True(t, encrypt.IsEncrypted(sealed))
+		opened, err := encrypt.Open(key, sealed)
+		assert.NoError(t, err, size)
+		assert.True(t, bytes.Equal(data, opened), size)
+
+		_, err = encrypt.Open(other, sealed)
+		assert.ErrorIs(t, err, encrypt.ErrWrongKey)
+		if size > 0 {
+			modified := bytes.Clone(sealed)
+			modified[len(modified)-20] ^= 1
+			_, err = encrypt.Open(key, modified)
+			assert.Error(t, err, size)
+		}
+	}
+
+	// Writes of any size produce the same plaintext, and dropping the last
+	// chunk of a stream is detected
+	data := make([]byte, 150*1024)
+	rand.Read(data)
+	var buf bytes.Buffer
+	w, err := encrypt.NewWriter(&buf, key)
+	assert.NoError(t, err)
+	for p := data; len(p) > 0; p = p[min(len(p), 1000):] {
+		_, err := w.Write(p[:min(len(p), 1000)])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	r, err := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+	assert.NoError(t, err)
+	opened, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, opened))
+	_, err = encrypt.Open(key, buf.Bytes()[:buf.Len()-(22*1024+16)])
+	assert.Error(t, err)
+}
+
+// TestLoadKey tests reading the key from a value, a file, and a command
+func TestLoadKey(t *testing.T) {
+	ctx := context.Background()
+	b64 := newKey(t)
+	want, err := encrypt.ParseKey(b64)
+	assert.NoError(t, err)
+
+	key, err := encrypt.LoadKey(ctx, encrypt.KeySource{})
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+
+	path := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(path, []byte(b64+"\n"), 0o600))
+	for _, src := range []encrypt.KeySource{
+		{Value: b64},
+		{File: path},
+		{Command: "cat " + path},
+	} {
+		key, err := encrypt.LoadKey(ctx, src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, want, key, src)
+	}
+
+	for _, src := range []encrypt.KeySource{
+		{Value: b64, File: path},
+		{Value: "not base64!"},
+		{Value: base64.StdEncoding.EncodeToString([]byte("short"))},
+		{File: path + ".missing"},
+		{Command: "exit 1"},
+	} {
+		_, err := encrypt.LoadKey(ctx, src)
+		assert.Error(t, err, src)
+	}
+}
+
+// TestEncryptedRawFiles tests storing original file content encrypted and
+// reading it back with and without the key
+func TestEncryptedRawFiles(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	content := []byte(`{"scanResults": {"vulnerabilities": []}}`)
+
+	// Content stored before a key was configured stays readable
+	assert.NoError(t, storage.PutRawFile(ctx, db, "plain", storage.RawGzip, content))
+	storage.EncryptionKey, err = encrypt.ParseKey(newKey(t))
+	assert.NoError(t, err)
+	defer func() { storage.EncryptionKey = nil }()
+	assert.NoError(t, storage.PutRawFile(ctx, db, "sealed", storage.RawGzip, content))
+
+	var stored struct {
+		Encoding string `db:"encoding"`
+		Content  []byte `db:"content"`
+	}
+	assert.NoError(t, db.Get(&stored, "SELECT encoding, content FROM raw_files WHERE sha256 = 'sealed'"))
+	assert.Equal(t, "gzip+aes-256-gcm", stored.Encoding)
+	assert.True(t, encrypt.IsEncrypted(stored.Content))
+	for _, sha := range []string{"plain", "sealed"} {
+		got, err := storage.GetRawFile(ctx, db, sha)
+		assert.NoError(t, err, sha)
+		assert.Equal(t, content, got, sha)
+	}
+
+	storage.EncryptionKey = nil
+	_, err = storage.GetRawFile(ctx, db, "sealed")
+	assert.Error(t, err)
+}
+
+// TestBackup tests copying an open database to a new file
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sqlx.Open("sqlite3", filepath.Join(dir, "vulnerabilities.db")+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES ('https://github.com/acme/api', 'scan.json', '2025-01-01T00:00:00Z', 'a', '2025-01-01T00:00:00Z')")
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "backup.db")
+	assert.NoError(t, storage.Backup(context.Background(), db, path))
+	assert.Error(t, storage.Backup(context.Background(), db, path))
+
+	copied, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+	var n int
+	assert.NoError(t, copied.Get(&n, "SELECT COUNT(*) FROM scans"))
+	assert.Equal(t, 1, n)
+}
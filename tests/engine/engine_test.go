@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan"
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const repo = "https://github.com/org/repo"
+
+// fileFetcher serves canned report files
+type fileFetcher map[string][]byte
+
+// FetchFileContent returns the file named filePath
+func (f fileFetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	body, ok := f[filePath]
+	if !ok {
+		return nil, github.Validators{}, errors.New("not found")
+	}
+	return body, github.Validators{}, nil
+}
+
+// TestEngine tests scanning and querying through an embedded engine
+func TestEngine(t *testing.T) {
+	var logs bytes.Buffer
+	engine, err := vulnscan.New(
+		vulnscan.WithDSN(filepath.Join(t.TempDir(), "vulnerabilities.db")+"?_journal=WAL&_busy_timeout=5000"),
+		vulnscan.WithFetcher(fileFetcher{
+			"scan.json": []byte(`{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-2024-1","severity":"HIGH","package_name":"openssl"},{"id":"CVE-2024-2","severity":"LOW","package_name":"zlib"}]}}`),
+		}),
+		vulnscan.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	assert.NoError(t, err)
+	_, err = vulnscan.New()
+	assert.ErrorIs(t, err, vulnscan.ErrEngineOpen)
+	ctx := context.Background()
+
+	resp, err := engine.Scan(ctx, api.ScanRequest{Repo: repo, Files: []string{"scan.json", "missing.json"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scan.json"}, resp.Success)
+	assert.Len(t, resp.Failed, 1)
+	assert.NotEmpty(t, logs.String())
+	_, err = engine.Scan(ctx, api.ScanRequest{Repo: repo, Files: []string{"scan.json"}, Checksums: map[string]string{"scan.json": "abc"}})
+	assert.Error(t, err, "an invalid checksum fails before fetching")
+
+	vulns, err := engine.Query(ctx, api.QueryRequest{Filters: api.QueryFilters{Severity: "HIGH"}})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2024-1", vulns[0].CVEID)
+	}
+	count, err := engine.QueryCount(ctx, api.QueryFilters{Expr: `package_name ~ "*"`})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	exists, err := engine.QueryExists(ctx, api.QueryFilters{Severity: "CRITICAL"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, err = engine.QueryCount(ctx, api.QueryFilters{Expr: "severity in ("})
+	assert.Error(t, err)
+
+	stats, err := engine.Stats(ctx, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Vulnerabilities)
+	assert.Equal(t, 1, stats.BySeverity["LOW"])
+
+	server := httptest.NewServer(engine.Handler())
+	defer server.Close()
+	res, err := http.Get(server.URL + "/stats")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var served api.StatsResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&served))
+	assert.Equal(t, 1, served.Scans)
+
+	assert.NoError(t, engine.Close())
+	assert.NoError(t, engine.Close())
+}
+
+// TestEngineWithDB tests that an engine on the caller's database migrates
+// it and leaves it open
+func TestEngineWithDB(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	engine, err := vulnscan.New(vulnscan.WithDB(db), vulnscan.WithFetcher(fileFetcher{}))
+	assert.NoError(t, err)
+	assert.Same(t, db, storage.DB)
+	stats, err := engine.Stats(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Scans)
+	assert.NoError(t, engine.Close())
+	assert.NoError(t, db.Ping())
+}
@@ -0,0 +1,119 @@
+package epss
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/epss"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const feed = `#model_version:v2023.03.01,score_date:2024-03-01T00:00:00+0000
+cve,epss,percentile
+CVE-2021-44228,0.97565,0.99996
+CVE-2024-0001,0.00043,0.09213
+`
+
+func setup(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	for _, id := range []string{"CVE-2021-44228", "CVE-2024-0001", "CVE-2024-9999"} {
+		_, err := db.Exec(`INSERT INTO vulnerabilities (scan_id, cve_id, severity, cvss, status, package_name,
+			current_version, fixed_version, description, published_date, link, risk_factors)
+			VALUES (1, ?, 'CRITICAL', 9.8, 'fixed', 'pkg', '1.0', '1.1', '', ?, '', ?)`,
+			id, time.Now(), []byte(`[]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestParse tests reading plain and gzipped feeds
+func TestParse(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(feed))
+	w.Close()
+
+	for _, input := range [][]byte{[]byte(feed), gz.Bytes()} {
+		f, err := epss.Parse(bytes.NewReader(input))
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-03-01T00:00:00+0000", f.ScoreDate)
+		assert.Equal(t, []epss.Score{
+			{CVEID: "CVE-2021-44228", EPSS: 0.97565, Percentile: 0.99996},
+			{CVEID: "CVE-2024-0001", EPSS: 0.00043, Percentile: 0.09213},
+		}, f.Scores)
+	}
+
+	_, err := epss.Parse(strings.NewReader("id,score\nCVE-1,0.1\n"))
+	assert.Error(t, err)
+}
+
+// TestSyncAndFilter tests importing the feed and filtering queries by epss_min
+func TestSyncAndFilter(t *testing.T) {
+	setup(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer server.Close()
+
+	client := &epss.Client{FeedURL: server.URL, HTTP: server.Client()}
+	n, err := client.Sync(context.Background(), storage.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	query := func(body string) (int, []models.Vulnerability) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, req)
+		var vulns []models.Vulnerability
+		json.NewDecoder(rr.Body).Decode(&vulns)
+		return rr.Code, vulns
+	}
+
+	// Without the filter, scores are included where known
+	code, vulns := query(`{"filters": {"severity": "CRITICAL"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, vulns, 3)
+	for _, v := range vulns {
+		if v.CVEID == "CVE-2024-9999" {
+			assert.Nil(t, v.EPSS)
+		} else {
+			assert.NotNil(t, v.EPSS)
+		}
+	}
+
+	code, vulns = query(`{"filters": {"severity": "CRITICAL", "epss_min": 0.5}}`)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2021-44228", vulns[0].CVEID)
+		assert.Equal(t, 0.97565, *vulns[0].EPSS)
+		assert.Equal(t, 0.99996, *vulns[0].EPSSPercentile)
+	}
+
+	code, _ = query(`{"filters": {"severity": "CRITICAL", "epss_min": 1.5}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,47 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestCategories tests matching categorized errors and their HTTP status
+// codes
+func TestCategories(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := fmt.Errorf("scan: %w", errs.Wrap(errs.ErrFetch, cause))
+	assert.ErrorIs(t, err, errs.ErrFetch)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, errs.ErrParse)
+	assert.Equal(t, "scan: connection reset", err.Error())
+	assert.NoError(t, errs.Wrap(errs.ErrFetch, nil))
+
+	err = errs.Errorf(errs.ErrUpstreamRateLimited, "github: %w", cause)
+	assert.ErrorIs(t, err, errs.ErrUpstreamRateLimited)
+	assert.ErrorIs(t, err, cause)
+
+	// Sentinels of other packages are in categories while staying distinct
+	assert.ErrorIs(t, storage.ErrNotFound, errs.ErrNotFound)
+	assert.ErrorIs(t, storage.ErrMaintenanceRunning, errs.ErrConflict)
+	assert.NotErrorIs(t, storage.ErrMaintenanceRunning, storage.ErrCustomFieldInUse)
+	assert.ErrorIs(t, formats.ErrUnknownFormat, errs.ErrParse)
+
+	for err, code := range map[error]int{
+		errs.ErrNotFound:                                              http.StatusNotFound,
+		storage.ErrCustomFieldInUse:                                   http.StatusConflict,
+		formats.ErrUnknownFormat:                                      http.StatusUnprocessableEntity,
+		errs.Wrap(errs.ErrFetch, cause):                               http.StatusBadGateway,
+		errs.New(errs.ErrUpstreamRateLimited, "osv: HTTP status 429"): http.StatusServiceUnavailable,
+		cause: http.StatusInternalServerError,
+	} {
+		assert.Equal(t, code, errs.HTTPStatus(err, http.StatusInternalServerError), err.Error())
+	}
+}
@@ -0,0 +1,300 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/Chinzzii/vulnscan/eventbus"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+// at is the time of the test events
+var at = time.Unix(1714550400, 0)
+
+// finding returns a finding event of a vulnerability
+func finding(repo, id string) events.Event {
+	return events.Event{Type: events.TypeFinding, Repo: repo, Severity: "HIGH", Time: at,
+		Data: models.Vulnerability{CVEID: id, Severity: "HIGH", PackageName: "openssl", CurrentVersion: "1.0", CVSS: 7.5,
+			Fingerprint: "fp-" + id, Aliases: []string{"GHSA-1", "GHSA-2"}}}
+}
+
+// scan returns a scan event of a report file
+func scan(repo string) events.Event {
+	return events.Event{Type: events.TypeScan, Repo: repo, Time: at,
+		Data: handlers.ScanEvent{File: "report.json", ScanID: "s1", ScanStatus: "completed", Vulnerabilities: 3}}
+}
+
+// TestKafka tests that events are produced through the REST Proxy as JSON
+// records keyed by repository, to their templated topics, with retries
+func TestKafka(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]map[string]interface{}{}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "vulnscan:secret", user+":"+pass)
+		if requests++; requests == 1 {
+			w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"leader not available"}]}`))
+			return
+		}
+		var body struct {
+			Records []map[string]interface{} `json:"records"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		topic := strings.TrimPrefix(r.URL.Path, "/topics/")
+		received[topic] = append(received[topic], body.Records...)
+		offsets := strings.Repeat(`{"partition":0,"offset":1},`, len(body.Records))
+		w.Write([]byte(`{"offsets":[` + strings.TrimSuffix(offsets, ",") + `]}`))
+	}))
+	defer srv.Close()
+
+	retries := 2
+	b, err := eventbus.New(eventbus.Config{Publishers: []eventbus.PublisherConfig{{
+		Name: "lake", Type: eventbus.TypeKafka, URL: srv.URL, Topic: "vulnscan.{event}.{owner}.{repo}",
+		Username: "vulnscan", Password: "secret", MaxRetries: &retries, RetryBackoff: "10ms",
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	broker := events.NewBroker()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	b.Start(ctx, broker)
+	for broker.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	broker.Publish(finding("https://github.com/acme/api.v2", "CVE-1"))
+	broker.Publish(events.Event{Type: events.TypeVulnerability, Repo: "https://github.com/acme/api", Severity: "HIGH",
+		Data: models.Vulnerability{CVEID: "CVE-9"}})
+	broker.Publish(scan("https://github.com/acme/api.v2"))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received["vulnscan.finding_created.acme.api_v2"]) == 1 && len(received["vulnscan.scan_completed.acme.api_v2"]) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, received, 2)
+	record := received["vulnscan.finding_created.acme.api_v2"][0]
+	assert.Equal(t, "https://github.com/acme/api.v2", record["key"])
+	assert.Equal(t, map[string]interface{}{
+		"event": "finding_created", "time": "2024-05-01T08:00:00Z", "repo": "https://github.com/acme/api.v2",
+		"finding": map[string]interface{}{"id": "CVE-1", "severity": "HIGH", "cvss": 7.5, "package_name": "openssl",
+			"current_version": "1.0", "fingerprint": "fp-CVE-1", "aliases": []interface{}{"GHSA-1", "GHSA-2"}},
+	}, record["value"])
+	value := received["vulnscan.scan_completed.acme.api_v2"][0]["value"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"file": "report.json", "scan_id": "s1", "scan_status": "completed",
+		"vulnerabilities": 3.0}, value["scan"])
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]eventbus.Stats{{Name: "lake", Published: 2}}, b.Stats())
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestKafkaProtobuf tests that protobuf payloads are produced as binary
+// records
+func TestKafkaProtobuf(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.kafka.binary.v2+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "/topics/vulnscan.scan_completed", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":7}]}`))
+	}))
+	defer srv.Close()
+
+	b, err := eventbus.New(eventbus.Config{Publishers: []eventbus.PublisherConfig{{
+		Name: "lake", Type: eventbus.TypeKafka, URL: srv.URL, Format: eventbus.FormatProtobuf,
+		Events: []string{eventbus.EventScanCompleted},
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	b.Handle(finding("https://github.com/acme/api", "CVE-1"))
+	b.Handle(scan("https://github.com/acme/api"))
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	b.Start(ctx, events.NewBroker())
+
+	var body struct {
+		Records []struct{ Key, Value string } `json:"records"`
+	}
+	select {
+	case data := <-bodies:
+		assert.NoError(t, json.Unmarshal(data, &body))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no records produced")
+	}
+	if !assert.Len(t, body.Records, 1) {
+		return
+	}
+	key, _ := base64.StdEncoding.DecodeString(body.Records[0].Key)
+	assert.Equal(t, "https://github.com/acme/api", string(key))
+	value, _ := base64.StdEncoding.DecodeString(body.Records[0].Value)
+	fields := decode(t, value)
+	assert.Equal(t, "scan_completed", fields[1])
+	assert.Equal(t, uint64(at.UnixMilli()), fields[2])
+	assert.Equal(t, map[protowire.Number]interface{}{1: "report.json", 2: "s1", 3: "completed", 5: uint64(3)},
+		decode(t, []byte(fields[10].(string))))
+}
+
+// TestNATS tests that events are published to subjects after connecting
+// with the configured token, and that a server error fails the batch
+func TestNATS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	type msg struct{ subject, payload string }
+	connects := make(chan string, 4)
+	msgs := make(chan msg, 10)
+	go func() {
+		for attempt := 1; ; attempt++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(attempt int) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					switch {
+					case strings.HasPrefix(line, "CONNECT "):
+						connects <- strings.TrimPrefix(line, "CONNECT ")
+					case line == "PING":
+						fmt.Fprint(conn, "PONG\r\n")
+					case strings.HasPrefix(line, "PUB "):
+						var subject string
+						var size int
+						fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+						payload := make([]byte, size+2)
+						io.ReadFull(r, payload)
+						if attempt == 1 {
+							fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish'\r\n")
+							return
+						}
+						msgs <- msg{subject, string(payload[:size])}
+					}
+				}
+			}(attempt)
+		}
+	}()
+
+	b, err := eventbus.New(eventbus.Config{Publishers: []eventbus.PublisherConfig{{
+		Name: "nats", Type: eventbus.TypeNATS, URL: "nats://" + ln.Addr().String(), Token: "s3cret",
+		Format: eventbus.FormatProtobuf, Topic: "vulns.{host}.{event}", RetryBackoff: "10ms",
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	b.Handle(finding("https://github.com/acme/api", "CVE-1"))
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	b.Start(ctx, events.NewBroker())
+
+	select {
+	case m := <-msgs:
+		assert.Equal(t, "vulns.github_com.finding_created", m.subject)
+		fields := decode(t, []byte(m.payload))
+		assert.Equal(t, "https://github.com/acme/api", fields[3])
+		f := decode(t, []byte(fields[11].(string)))
+		assert.Equal(t, "CVE-1", f[1])
+		assert.Equal(t, math.Float64bits(7.5), f[3])
+		assert.Equal(t, "fp-CVE-1", f[10])
+		assert.Equal(t, "GHSA-2", f[13], "the last alias")
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message published")
+	}
+	var connect map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(<-connects), &connect))
+	assert.Equal(t, "s3cret", connect["auth_token"])
+	assert.Equal(t, "vulnscan", connect["name"])
+	assert.Len(t, connects, 1, "reconnected once after the error")
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]eventbus.Stats{{Name: "nats", Published: 1}}, b.Stats())
+	}, time.Second, 10*time.Millisecond)
+}
+
+// decode returns the fields of a protobuf message by number: strings and
+// embedded messages as strings, varints and fixed64s as uint64s, the last
+// value of repeated fields
+func decode(t *testing.T, b []byte) map[protowire.Number]interface{} {
+	fields := map[protowire.Number]interface{}{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if !assert.GreaterOrEqual(t, n, 0) {
+			return fields
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(b)
+			fields[num], n = string(v), m
+		case protowire.VarintType:
+			fields[num], n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			fields[num], n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if !assert.GreaterOrEqual(t, n, 0) {
+			return fields
+		}
+		b = b[n:]
+	}
+	return fields
+}
+
+// TestConfig tests that invalid publishers are rejected
+func TestConfig(t *testing.T) {
+	for name, c := range map[string]eventbus.PublisherConfig{
+		"type":        {Name: "x", Type: "pulsar", URL: "http://proxy:8082"},
+		"kafka url":   {Name: "x", Type: eventbus.TypeKafka, URL: "kafka://broker:9092"},
+		"nats url":    {Name: "x", Type: eventbus.TypeNATS, URL: "http://nats:4222"},
+		"format":      {Name: "x", Type: eventbus.TypeKafka, URL: "http://proxy:8082", Format: "avro"},
+		"event":       {Name: "x", Type: eventbus.TypeKafka, URL: "http://proxy:8082", Events: []string{"scan_failed"}},
+		"placeholder": {Name: "x", Type: eventbus.TypeKafka, URL: "http://proxy:8082", Topic: "vulns.{tenant}"},
+		"kafka topic": {Name: "x", Type: eventbus.TypeKafka, URL: "http://proxy:8082", Topic: "vulns/{event}"},
+		"subject":     {Name: "x", Type: eventbus.TypeNATS, URL: "nats://nats", Topic: "vulns.*.{event}"},
+		"empty token": {Name: "x", Type: eventbus.TypeNATS, URL: "nats://nats", Topic: "vulns..{event}"},
+		"backoff":     {Name: "x", Type: eventbus.TypeNATS, URL: "nats://nats", RetryBackoff: "0s"},
+		"queue size":  {Name: "x", Type: eventbus.TypeNATS, URL: "nats://nats", QueueSize: -1},
+		"no name":     {Type: eventbus.TypeNATS, URL: "nats://nats"},
+	} {
+		_, err := eventbus.New(eventbus.Config{Publishers: []eventbus.PublisherConfig{c}})
+		assert.Error(t, err, name)
+	}
+	_, err := eventbus.New(eventbus.Config{Publishers: []eventbus.PublisherConfig{
+		{Name: "x", Type: eventbus.TypeNATS, URL: "nats://nats"},
+		{Name: "x", Type: eventbus.TypeKafka, URL: "http://proxy:8082"},
+	}})
+	assert.Error(t, err, "repeated name")
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/handlers"
+)
+
+// TestFilterMatches tests subscription filtering by type, severity, and repo
+func TestFilterMatches(t *testing.T) {
+	critical := events.Event{Type: events.TypeVulnerability, Repo: "r1", Severity: "CRITICAL"}
+	scan := events.Event{Type: events.TypeScan, Repo: "r2"}
+
+	assert.True(t, events.Filter{}.Matches(critical))
+	assert.True(t, events.Filter{Severities: []string{"critical"}}.Matches(critical))
+	assert.False(t, events.Filter{Severities: []string{"high"}}.Matches(critical))
+	assert.True(t, events.Filter{Severities: []string{"high"}}.Matches(scan))
+	assert.False(t, events.Filter{Types: []string{events.TypeScan}}.Matches(critical))
+	assert.False(t, events.Filter{Repo: "r1"}.Matches(scan))
+}
+
+// TestEventsHandler tests that published events are streamed to SSE subscribers
+func TestEventsHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handlers.EventsHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?types=vulnerability&severity=critical")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n') // ": connected"
+	assert.True(t, strings.HasPrefix(line, ":"))
+
+	// Wait for the subscription to register before publishing
+	deadline := time.Now().Add(time.Second)
+	for events.Default.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	events.Default.Publish(events.Event{Type: events.TypeVulnerability, Severity: "high", Data: "skipped"})
+	events.Default.Publish(events.Event{Type: events.TypeVulnerability, Severity: "critical", Data: "CVE-2024-1234"})
+
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, "event: vulnerability", lines[0])
+	assert.Contains(t, lines[1], "CVE-2024-1234")
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+func query(t *testing.T, accept, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	req.Header.Set("Accept", accept)
+	rr := httptest.NewRecorder()
+	handlers.QueryHandler(rr, req)
+	return rr
+}
+
+// TestQueryExport tests CSV and Excel output of the query endpoint
+func TestQueryExport(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"repo-a", "trivy.json", time.Now(), "s", time.Now())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2024-0001", Severity: "HIGH", CVSS: 8.1, PackageName: "openssl", CurrentVersion: "3.0.1",
+			FixedVersion: "3.0.9", Description: "Overflow, in \"parser\""},
+		{CVEID: "CVE-2024-0002", Severity: "HIGH", CVSS: 7.5, PackageName: "curl", Description: "=HYPERLINK(\"x\")"},
+	} {
+		v.RiskFactors = models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+	}
+	_, err = db.Exec("INSERT INTO epss_scores (cve_id, epss, percentile, score_date) VALUES ('CVE-2024-0001', 0.42, 0.97, '2024-03-01')")
+	assert.NoError(t, err)
+
+	// CSV with the default columns
+	rr := query(t, "text/csv", `{"filters": {"severity": "HIGH"}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, []string{"ID", "Severity", "CVSS", "EPSS", "Known Exploited", "Package", "Installed Version",
+			"Fixed Version", "Triage Status", "Assignee", "Link"}, rows[0])
+		assert.Equal(t, []string{"CVE-2024-0001", "HIGH", "8.1", "0.42", "false", "openssl", "3.0.1", "3.0.9", "open", "", ""}, rows[1])
+	}
+
+	// Chosen columns; formula-like text is neutralized
+	rr = query(t, "text/csv", `{"filters": {"severity": "HIGH"}, "columns": ["id", "Description"]}`)
+	rows, err = csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ID", "Description"},
+		{"CVE-2024-0001", "Overflow, in \"parser\""},
+		{"CVE-2024-0002", "'=HYPERLINK(\"x\")"},
+	}, rows)
+
+	rr = query(t, "text/csv", `{"filters": {"severity": "HIGH"}, "columns": ["id", "bogus"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `unknown column "bogus"`)
+
+	// Excel workbook
+	rr = query(t, export.XLSXMediaType, `{"filters": {"severity": "HIGH"}, "columns": ["id", "cvss", "kev"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, export.XLSXMediaType, rr.Header().Get("Content-Type"))
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+	assert.Contains(t, parts, "[Content_Types].xml")
+	assert.Contains(t, parts, "xl/workbook.xml")
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">ID</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">CVE-2024-0001</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2"><v>8.1</v></c>`)
+	assert.Contains(t, sheet, `<c r="C3" t="b"><v>0</v></c>`)
+	assert.Contains(t, sheet, `<autoFilter ref="A1:C3"/>`)
+
+	// JSON remains the default
+	rr = query(t, "", `{"filters": {"severity": "HIGH"}, "columns": ["bogus"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+}
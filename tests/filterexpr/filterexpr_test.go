@@ -0,0 +1,86 @@
+package filterexpr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/filterexpr"
+)
+
+// fields are the fields of the test expressions
+var fields = map[string]filterexpr.Field{
+	"severity":     {Column: "severity"},
+	"package_name": {Column: "package_name"},
+	"status":       {Column: "status"},
+	"cvss":         {Column: "cvss", Numeric: true},
+}
+
+// TestCompile tests the SQL and arguments expressions compile into
+func TestCompile(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		sql  string
+		args []any
+	}{
+		{
+			`severity in (critical,high) AND package_name ~ "openssl*" AND NOT status = "fixed"`,
+			`((severity COLLATE NOCASE IN (?, ?)) AND (package_name LIKE ? ESCAPE '\') AND NOT COALESCE((status = ? COLLATE NOCASE), 0))`,
+			[]any{"critical", "high", "openssl%", "fixed"},
+		},
+		{
+			`cvss >= 9 or severity = critical and status != 'fixed'`,
+			`((cvss >= ?) OR ((severity = ? COLLATE NOCASE) AND (status != ? COLLATE NOCASE)))`,
+			[]any{9.0, "critical", "fixed"},
+		},
+		{
+			`(cvss > 7 OR Severity = HIGH) AND package_name !~ lib?_*`,
+			`(((cvss > ?) OR (severity = ? COLLATE NOCASE)) AND (package_name NOT LIKE ? ESCAPE '\'))`,
+			[]any{7.0, "HIGH", `lib_\_%`},
+		},
+		{
+			`status not in ("fixed", "won't fix") and package_name = "say \"hi\""`,
+			`((status COLLATE NOCASE NOT IN (?, ?)) AND (package_name = ? COLLATE NOCASE))`,
+			[]any{"fixed", "won't fix", `say "hi"`},
+		},
+		{`NOT NOT cvss < 4`, `NOT COALESCE(NOT COALESCE((cvss < ?), 0), 0)`, []any{4.0}},
+	} {
+		sql, args, err := filterexpr.Compile(tc.expr, fields)
+		if assert.NoError(t, err, tc.expr) {
+			assert.Equal(t, tc.sql, sql, tc.expr)
+			assert.Equal(t, tc.args, args, tc.expr)
+		}
+	}
+}
+
+// TestCompileErrors tests that invalid expressions are rejected with the
+// offset of the problem
+func TestCompileErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		``:                           "expected a field, found \"end of expression\" at offset 0",
+		`owner = me`:                 `unknown field "owner" at offset 0`,
+		`severity`:                   "expected an operator",
+		`severity = `:                "expected a value",
+		`severity == high`:           `unknown operator "==" at offset 9`,
+		`cvss ~ 9*`:                  "~ needs a text field",
+		`severity > high`:            "> needs a numeric field",
+		`cvss > high`:                `expected a number, found "high" at offset 7`,
+		`severity in (high`:          "expected \",\" or \")\"",
+		`severity not = high`:        "expected IN",
+		`(cvss > 7`:                  "expected \")\"",
+		`cvss > 7)`:                  `unexpected ")" at offset 8`,
+		`cvss > 7 severity = high`:   `unexpected "severity"`,
+		`package_name = "openssl`:    "unterminated string at offset 15",
+		`severity = high; DROP`:      `unexpected character ';' at offset 15`,
+		`cvss <> 7`:                  `expected a value, found ">"`,
+		strings.Repeat("(", 40) + "": "nested deeper than 32",
+		strings.Repeat("x", 5000):    "longer than 4096 bytes",
+	} {
+		_, _, err := filterexpr.Compile(expr, fields)
+		var exprErr *filterexpr.Error
+		if assert.ErrorAs(t, err, &exprErr, expr) {
+			assert.Contains(t, err.Error(), want, expr)
+		}
+	}
+}
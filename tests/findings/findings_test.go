@@ -0,0 +1,373 @@
+package findings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestFindingTracking tests that rescans update one finding per repository,
+// package, and vulnerability instead of adding new ones
+func TestFindingTracking(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(repo, file string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	openssl := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "MEDIUM", PackageName: "openssl"}
+	curl := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "HIGH", PackageName: "curl"}
+
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+	scan("repo-a", "api.json", day1, openssl)
+	scan("repo-a", "api.json", day2, openssl, curl)
+	// Rescored upstream, and also reported by another file of the same repository
+	openssl.Severity = "HIGH"
+	scan("repo-a", "web.json", day3, openssl)
+	scan("repo-b", "api.json", day2, openssl)
+
+	findings, err := handlers.ListFindings(ctx, handlers.FindingFilters{Repo: "repo-a", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, findings, 2) {
+		f := findings[0]
+		assert.Equal(t, "CVE-2024-0001", f.CVEID)
+		assert.Equal(t, "openssl", f.PackageName)
+		assert.Equal(t, "HIGH", f.Severity)
+		assert.Equal(t, storage.FindingOpen, f.Status)
+		assert.Equal(t, day1, f.FirstSeen.UTC())
+		assert.Equal(t, day3, f.LastSeen.UTC())
+		assert.Equal(t, "CVE-2024-0002", findings[1].CVEID)
+		assert.Equal(t, day2, findings[1].FirstSeen.UTC())
+	}
+
+	// A late-arriving older scan widens first_seen without touching the rest
+	scan("repo-a", "old.json", day1.AddDate(0, 0, -7), models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "LOW", PackageName: "openssl"})
+	findings, _ = handlers.ListFindings(ctx, handlers.FindingFilters{Repo: "repo-a", ID: "CVE-2024-0001", Limit: 10})
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, day1.AddDate(0, 0, -7), findings[0].FirstSeen.UTC())
+		assert.Equal(t, day3, findings[0].LastSeen.UTC())
+		assert.Equal(t, "HIGH", findings[0].Severity)
+	}
+
+	get := func(target string) (int, []handlers.Finding) {
+		rr := httptest.NewRecorder()
+		handlers.FindingsHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var out []handlers.Finding
+		json.Unmarshal(rr.Body.Bytes(), &out)
+		return rr.Code, out
+	}
+	code, all := get("/findings")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, all, 3)
+	_, high := get("/findings?severity=high&repo=repo-a")
+	assert.Len(t, high, 2)
+	_, page := get("/findings?limit=1&offset=1")
+	assert.Len(t, page, 1)
+	code, _ = get("/findings?offset=-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestFindingBackfill tests that existing scan history is migrated into
+// findings
+func TestFindingBackfill(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Apply the schema before the findings table, then add history
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`DROP TABLE findings; DROP TABLE component_dependencies;
+		ALTER TABLE components DROP COLUMN license; ALTER TABLE components DROP COLUMN ref;
+		ALTER TABLE scans DROP COLUMN sha256; ALTER TABLE scans DROP COLUMN source;
+		ALTER TABLE scans DROP COLUMN resource_type; ALTER TABLE scans DROP COLUMN resource_name;
+		ALTER TABLE vulnerabilities DROP COLUMN package_class;
+		ALTER TABLE scans DROP COLUMN scan_status; ALTER TABLE scans DROP COLUMN incomplete;
+		ALTER TABLE vulnerabilities DROP COLUMN raw_json;
+		DROP INDEX idx_scans_tenant; ALTER TABLE scans DROP COLUMN tenant;
+		DROP INDEX idx_vulnerabilities_fingerprint; ALTER TABLE vulnerabilities DROP COLUMN fingerprint;
+		ALTER TABLE vulnerabilities DROP COLUMN location;
+		DROP INDEX idx_scans_ingest_id; ALTER TABLE scans DROP COLUMN ingest_id;
+		DELETE FROM schema_migrations WHERE version >= 12`)
+	assert.NoError(t, err)
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i, sev := range []string{"LOW", "CRITICAL"} {
+		at := day1.AddDate(0, 0, i)
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			"repo-a", "api.json", at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		_, err = db.Exec(`INSERT INTO vulnerabilities (scan_id, cve_id, severity, package_name, risk_factors)
+			VALUES (?, 'CVE-2024-0001', ?, 'openssl', '[]')`, id, sev)
+		assert.NoError(t, err)
+	}
+
+	// A third scan no longer reports the finding
+	_, err = db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"repo-a", "api.json", day1.AddDate(0, 0, 2), "s", day1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Migrate(db))
+	var f handlers.Finding
+	assert.NoError(t, db.Get(&f, "SELECT id, repo, package_name, cve_id, severity, status, first_seen, last_seen, last_scan_id, resolved_at FROM findings"))
+	assert.Equal(t, "CRITICAL", f.Severity)
+	assert.Equal(t, day1, f.FirstSeen.UTC())
+	assert.Equal(t, day1.AddDate(0, 0, 1), f.LastSeen.UTC())
+	assert.Equal(t, int64(2), f.LastScanID)
+	assert.Equal(t, storage.FindingResolved, f.Status)
+	if assert.NotNil(t, f.ResolvedAt) {
+		assert.Equal(t, day1.AddDate(0, 0, 2), f.ResolvedAt.UTC())
+	}
+}
+
+// TestResolution tests that findings missing from every latest scan are
+// resolved, and reopened when they reappear
+func TestResolution(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	a := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "HIGH", PackageName: "openssl", RiskFactors: models.RiskFactors{}}
+	b := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "LOW", PackageName: "zlib", RiskFactors: models.RiskFactors{}}
+	day := func(n int) time.Time { return time.Date(2024, time.March, n, 9, 0, 0, 0, time.UTC) }
+	// rescan stores a scan of a file and resolves what it no longer reports
+	rescan := func(file string, at time.Time, vulns ...models.Vulnerability) int64 {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			"repo-a", file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+		n, err := storage.ResolveFindings(ctx, db, "repo-a", at)
+		assert.NoError(t, err)
+		return n
+	}
+	status := func(cve string) (string, *time.Time) {
+		findings, err := handlers.ListFindings(ctx, handlers.FindingFilters{ID: cve, Limit: 1})
+		assert.NoError(t, err)
+		if len(findings) != 1 {
+			t.Fatalf("finding %s not found", cve)
+		}
+		return findings[0].Status, findings[0].ResolvedAt
+	}
+
+	assert.Equal(t, int64(0), rescan("api.json", day(1), a, b))
+	assert.Equal(t, int64(0), rescan("web.json", day(1), b))
+
+	// b is gone from api.json but web.json still reports it
+	assert.Equal(t, int64(0), rescan("api.json", day(2), a))
+	st, _ := status("CVE-2024-0002")
+	assert.Equal(t, storage.FindingOpen, st)
+
+	assert.Equal(t, int64(1), rescan("web.json", day(3)))
+	st, resolvedAt := status("CVE-2024-0002")
+	assert.Equal(t, storage.FindingResolved, st)
+	if assert.NotNil(t, resolvedAt) {
+		assert.Equal(t, day(3), resolvedAt.UTC())
+	}
+
+	assert.Equal(t, int64(1), rescan("api.json", day(4)))
+	st, _ = status("CVE-2024-0001")
+	assert.Equal(t, storage.FindingResolved, st)
+
+	// Reappearing reopens; an older, late-arriving sighting does not
+	assert.Equal(t, int64(0), rescan("old.json", day(2), b))
+	assert.Equal(t, int64(0), rescan("api.json", day(5), a))
+	st, resolvedAt = status("CVE-2024-0001")
+	assert.Equal(t, storage.FindingOpen, st)
+	assert.Nil(t, resolvedAt)
+
+	_, err = storage.ResolveFindings(ctx, db, "repo-a", day(5))
+	assert.NoError(t, err)
+	open, _ := handlers.ListFindings(ctx, handlers.FindingFilters{Status: storage.FindingOpen, Limit: 10})
+	assert.Len(t, open, 1)
+}
+
+// TestMultiResultResolution tests that every scan result of a report file
+// counts as its latest scan, and that an ingest with an incomplete result
+// resolves nothing
+func TestMultiResultResolution(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	// report returns a file with a scan result per status and its IDs
+	report := func(results ...[]string) []byte {
+		var entries []string
+		for i, r := range results {
+			var vulns []string
+			for _, id := range r[1:] {
+				vulns = append(vulns, `{"id":"`+id+`","severity":"HIGH","package_name":"openssl"}`)
+			}
+			entries = append(entries, fmt.Sprintf(`{"scanResults":{"scan_id":"s%d","scan_status":%q,"vulnerabilities":[%s]}}`,
+				i, r[0], strings.Join(vulns, ",")))
+		}
+		return []byte("[" + strings.Join(entries, ",") + "]")
+	}
+	scanner := handlers.NewScanner(nil)
+	ingest := func(content []byte) {
+		resp := scanner.IngestArchive(ctx, "repo-a", []archive.File{{Name: "report.json", Content: content}}, nil)
+		assert.Empty(t, resp.Failed)
+	}
+	status := func(cve string) string {
+		var st string
+		assert.NoError(t, db.Get(&st, "SELECT status FROM findings WHERE cve_id = ?", cve))
+		return st
+	}
+
+	ingest(report([]string{"completed", "CVE-1"}, []string{"completed", "CVE-2"}))
+	assert.Equal(t, storage.FindingOpen, status("CVE-1"), "reported by the first result")
+	assert.Equal(t, storage.FindingOpen, status("CVE-2"))
+
+	// An incomplete result keeps what the ingest leaves out open
+	ingest(report([]string{"completed", "CVE-2"}, []string{"partial"}))
+	assert.Equal(t, storage.FindingOpen, status("CVE-1"))
+
+	ingest(report([]string{"completed"}, []string{"completed", "CVE-2"}))
+	assert.Equal(t, storage.FindingResolved, status("CVE-1"))
+	assert.Equal(t, storage.FindingOpen, status("CVE-2"))
+}
+
+// TestVulnerabilityDetail tests the occurrence history and triage trail of
+// one stored vulnerability
+func TestVulnerabilityDetail(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(repo, file string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	openssl := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "HIGH", PackageName: "openssl", CurrentVersion: "3.0.0"}
+	curl := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "LOW", PackageName: "curl"}
+
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	scan("repo-a", "api.json", day1, openssl)
+	scan("repo-a", "api.json", day1.AddDate(0, 0, 1), curl)
+	scan("repo-a", "api.json", day1.AddDate(0, 0, 2), openssl)
+	scan("repo-a", "web.json", day1.AddDate(0, 0, 3), openssl)
+	scan("repo-b", "api.json", day1, openssl)
+	assert.NoError(t, handlers.UpdateTriage(ctx, 1, "alice", handlers.TriageUpdate{Comment: "looking"}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vulnerabilities/{id}", handlers.VulnerabilityHandler)
+	get := func(target string) (*httptest.ResponseRecorder, handlers.VulnerabilityDetail) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var detail handlers.VulnerabilityDetail
+		json.Unmarshal(rr.Body.Bytes(), &detail)
+		return rr, detail
+	}
+
+	rr, detail := get("/vulnerabilities/1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "CVE-2024-0001", detail.Vulnerability.CVEID)
+	assert.Equal(t, int64(1), detail.Vulnerability.FindingID)
+	assert.Equal(t, "repo-a", detail.Repo)
+	if assert.NotNil(t, detail.Finding) {
+		assert.Equal(t, day1, detail.Finding.FirstSeen.UTC())
+		assert.Equal(t, day1.AddDate(0, 0, 3), detail.Finding.LastSeen.UTC())
+	}
+
+	// Reports from the same repository only, oldest first
+	if assert.Len(t, detail.Occurrences, 3) {
+		assert.Equal(t, int64(1), detail.Occurrences[0].FindingID)
+		assert.Equal(t, "api.json", detail.Occurrences[1].FilePath)
+		assert.Equal(t, "web.json", detail.Occurrences[2].FilePath)
+		assert.Equal(t, "3.0.0", detail.Occurrences[2].CurrentVersion)
+	}
+
+	type change struct {
+		file   string
+		day    int
+		change string
+	}
+	var timeline []change
+	for _, c := range detail.Timeline {
+		timeline = append(timeline, change{c.FilePath, int(c.ScanTime.Sub(day1).Hours() / 24), c.Change})
+	}
+	assert.Equal(t, []change{
+		{"api.json", 0, "appeared"},
+		{"api.json", 1, "disappeared"},
+		{"api.json", 2, "appeared"},
+		{"web.json", 3, "appeared"},
+	}, timeline)
+
+	if assert.Len(t, detail.Triage.Comments, 1) {
+		assert.Equal(t, "alice", detail.Triage.Comments[0].Author)
+	}
+	assert.Len(t, detail.Triage.History, 1)
+
+	rr, _ = get("/vulnerabilities/99")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr, _ = get("/vulnerabilities/abc")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
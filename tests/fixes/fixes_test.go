@@ -0,0 +1,119 @@
+package fixes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/versions"
+)
+
+// TestCompare tests version ordering across common ecosystem conventions
+func TestCompare(t *testing.T) {
+	ordered := [][2]string{
+		{"1.2.3", "1.10.0"},
+		{"v0.1.0", "v0.17.0"},
+		{"1.1.1t-r0", "1.1.1u-r0"},
+		{"1.1.1u-r0", "1.1.1u-r1"},
+		{"1.0.0-beta.2", "1.0.0"},
+		{"1.0~rc1", "1.0"},
+		{"2.4.57", "2.4.58"},
+		{"9.9", "1:0.1"},
+		{"4.17.20", "4.17.21"},
+	}
+	for _, p := range ordered {
+		assert.Equal(t, -1, versions.Compare(p[0], p[1]), "%s < %s", p[0], p[1])
+		assert.Equal(t, 1, versions.Compare(p[1], p[0]), "%s > %s", p[1], p[0])
+	}
+	assert.Equal(t, 0, versions.Compare("v1.2.3", "1.2.3"))
+	assert.Equal(t, "1.10.0", versions.Max("1.2.0", "", "1.10.0", "1.9.9"))
+}
+
+// TestFixReport tests grouping fixable findings by package with the minimal upgrade target
+func TestFixReport(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(repo, file string) int64 {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, time.Now(), "s", time.Now())
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		return id
+	}
+	insert := func(scanID int64, cve, sev string, cvss float64, pkg, current, fixed string) {
+		err := storage.InsertVulnerability(ctx, db, scanID, models.Vulnerability{
+			CVEID: cve, Severity: sev, CVSS: cvss, PackageName: pkg, Ecosystem: "Alpine",
+			CurrentVersion: current, FixedVersion: fixed, PublishedDate: time.Now(), RiskFactors: models.RiskFactors{},
+		})
+		assert.NoError(t, err)
+	}
+
+	// A superseded scan whose findings must not be reported
+	old := scan("https://github.com/example/app", "trivy.json")
+	insert(old, "CVE-2020-0001", "CRITICAL", 9.8, "busybox", "1.30", "1.31")
+
+	latest := scan("https://github.com/example/app", "trivy.json")
+	insert(latest, "CVE-2023-0286", "HIGH", 7.4, "openssl", "1.1.1t-r0", "1.1.1t-r1")
+	insert(latest, "CVE-2023-0465", "MEDIUM", 5.3, "openssl", "1.1.1t-r0", "1.1.1u-r0")
+	insert(latest, "CVE-2023-2650", "MEDIUM", 6.5, "openssl", "1.1.1t-r0", "1.1.1u-r0")
+	insert(latest, "CVE-2022-48174", "CRITICAL", 9.8, "busybox", "1.35.0-r29", "1.35.0-r31, 1.36.1-r1")
+	insert(latest, "CVE-2023-9999", "LOW", 2.0, "zlib", "1.2.13-r0", "")
+
+	other := scan("https://github.com/example/api", "trivy.json")
+	insert(other, "CVE-2023-0286", "HIGH", 7.4, "openssl", "1.1.1s-r0", "1.1.1t-r1")
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/fixes", nil)
+	rr := httptest.NewRecorder()
+	handlers.FixesHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var report handlers.FixReport
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, 5, report.Findings)
+	if assert.Len(t, report.Packages, 2) {
+		// The critical busybox finding ranks first; the listed fix on its release line is chosen
+		busybox := report.Packages[0]
+		assert.Equal(t, "busybox", busybox.PackageName)
+		assert.Equal(t, "1.35.0-r31", busybox.UpgradeTo)
+		assert.Equal(t, []string{"CVE-2022-48174"}, busybox.CVEs)
+
+		openssl := report.Packages[1]
+		assert.Equal(t, "openssl", openssl.PackageName)
+		assert.Equal(t, "1.1.1u-r0", openssl.UpgradeTo)
+		assert.Equal(t, 4, openssl.Findings)
+		assert.Equal(t, []string{"1.1.1s-r0", "1.1.1t-r0"}, openssl.InstalledVersions)
+		assert.Equal(t, map[string]int{"HIGH": 2, "MEDIUM": 2}, openssl.BySeverity)
+		assert.Equal(t, 7.4, openssl.MaxCVSS)
+		assert.Equal(t, []string{"https://github.com/example/api", "https://github.com/example/app"}, openssl.Repos)
+	}
+
+	report, err = handlers.BuildFixReport(ctx, "https://github.com/example/api", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Findings)
+
+	report, err = handlers.BuildFixReport(ctx, "", "medium")
+	assert.NoError(t, err)
+	if assert.Len(t, report.Packages, 1) {
+		assert.Equal(t, "1.1.1u-r0", report.Packages[0].UpgradeTo)
+	}
+}
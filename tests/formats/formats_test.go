@@ -0,0 +1,200 @@
+package formats
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+const trivyReport = `{
+  "SchemaVersion": 2,
+  "CreatedAt": "2024-03-01T10:00:00Z",
+  "ArtifactName": "alpine:3.18",
+  "ArtifactType": "container_image",
+  "Results": [
+    {
+      "Target": "alpine:3.18 (alpine 3.18.0)",
+      "Class": "os-pkgs",
+      "Type": "alpine",
+      "Vulnerabilities": [
+        {
+          "VulnerabilityID": "CVE-2024-1234",
+          "PkgName": "openssl",
+          "InstalledVersion": "1.1.1t-r0",
+          "FixedVersion": "1.1.1u-r0",
+          "Severity": "HIGH",
+          "SeveritySource": "nvd",
+          "PrimaryURL": "https://avd.aquasec.com/nvd/cve-2024-1234",
+          "Title": "openssl: buffer overflow",
+          "PublishedDate": "2024-01-15T00:00:00Z",
+          "CVSS": {"nvd": {"V3Score": 8.5}, "redhat": {"V3Score": 7.0}}
+        },
+        {
+          "VulnerabilityID": "CVE-2024-5678",
+          "PkgName": "busybox",
+          "InstalledVersion": "1.36.0-r0",
+          "Severity": "low",
+          "CVSS": {"redhat": {"V3Score": 3.1}}
+        }
+      ]
+    }
+  ]
+}`
+
+// TestParseTrivy tests detection and mapping of Trivy JSON reports
+func TestParseTrivy(t *testing.T) {
+	format, results, err := formats.Parse([]byte(trivyReport))
+	assert.NoError(t, err)
+	assert.Equal(t, "trivy", format)
+	assert.Len(t, results, 1)
+
+	sr := results[0]
+	assert.Equal(t, "alpine:3.18", sr.ResourceName)
+	assert.Equal(t, "container_image", sr.ResourceType)
+	assert.Len(t, sr.Vulnerabilities, 2)
+
+	v := sr.Vulnerabilities[0]
+	assert.Equal(t, "CVE-2024-1234", v.CVEID)
+	assert.Equal(t, "HIGH", v.Severity)
+	assert.Equal(t, 8.5, v.CVSS)
+	assert.Equal(t, "fixed", v.Status)
+	assert.Equal(t, "openssl", v.PackageName)
+	assert.Equal(t, "1.1.1u-r0", v.FixedVersion)
+	assert.Equal(t, "openssl: buffer overflow", v.Description)
+	assert.Equal(t, 2024, v.PublishedDate.Year())
+
+	v = sr.Vulnerabilities[1]
+	assert.Equal(t, "LOW", v.Severity)
+	assert.Equal(t, 3.1, v.CVSS)
+	assert.Equal(t, "affected", v.Status)
+}
+
+// TestParseNative tests the native scanResults format in array and object form
+func TestParseNative(t *testing.T) {
+	format, results, err := formats.Parse([]byte(`[{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-1"}]}}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "native", format)
+	assert.Equal(t, "a", results[0].ScanID)
+	assert.Equal(t, "CVE-1", results[0].Vulnerabilities[0].CVEID)
+
+	_, results, err = formats.Parse([]byte(`{"scanResults":{"scan_id":"b"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "b", results[0].ScanID)
+}
+
+// TestParseRawFields tests that fields of vulnerability entries no model
+// field holds are kept as raw, and that mapped fields are not
+func TestParseRawFields(t *testing.T) {
+	_, results, err := formats.Parse([]byte(`{"SchemaVersion": 2, "Results": [{"Type": "alpine", "Vulnerabilities": [
+		{"VulnerabilityID": "CVE-1", "PkgName": "openssl", "Title": "t", "Layer": {"DiffID": "sha256:ab"}, "VendorSeverity": {"nvd": 3}},
+		{"VulnerabilityID": "CVE-2", "PkgName": "busybox"}]}]}`))
+	assert.NoError(t, err)
+	vulns := results[0].Vulnerabilities
+	assert.Equal(t, models.RawFields{
+		"Layer":          json.RawMessage(`{"DiffID": "sha256:ab"}`),
+		"VendorSeverity": json.RawMessage(`{"nvd": 3}`),
+	}, vulns[0].Raw)
+	assert.Nil(t, vulns[1].Raw)
+
+	// Native keys match ignoring case, and an entry's own raw fields stay
+	_, results, err = formats.Parse([]byte(`{"scanResults":{"vulnerabilities":[
+		{"id":"CVE-1","Package_Name":"openssl","published_date":"2024-01-15","fix_date":"2024-02-01","raw":{"layer":"a"}}]}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, models.RawFields{
+		"fix_date": json.RawMessage(`"2024-02-01"`),
+		"layer":    json.RawMessage(`"a"`),
+	}, results[0].Vulnerabilities[0].Raw)
+}
+
+// TestParseUnknown tests that unrecognized content is rejected
+func TestParseUnknown(t *testing.T) {
+	_, _, err := formats.Parse([]byte(`{"hello":"world"}`))
+	assert.ErrorIs(t, err, formats.ErrUnknownFormat)
+}
+
+// TestParseLenient tests that lenient parsing skips malformed vulnerability
+// entries with a warning, where strict parsing rejects the report
+func TestParseLenient(t *testing.T) {
+	native := []byte(`[{"scanResults":{"scan_id":"a","vulnerabilities":[
+		{"id":"CVE-1"},{"id":"CVE-2","cvss":"high"}]}},
+		{"scanResults":{"scan_id":"b","vulnerabilities":[{"severity":"LOW"},{"id":"CVE-3"}]}}]`)
+	_, _, err := formats.Parse(native)
+	assert.Error(t, err)
+
+	format, results, warnings, err := formats.ParseLenient(native)
+	assert.NoError(t, err)
+	assert.Equal(t, "native", format)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "a", results[0].ScanID)
+		assert.Len(t, results[0].Vulnerabilities, 1)
+		assert.Equal(t, "CVE-3", results[1].Vulnerabilities[0].CVEID)
+	}
+	if assert.Len(t, warnings, 2) {
+		assert.Equal(t, 1, warnings[0].Index)
+		assert.Contains(t, warnings[0].Reason, "cvss")
+		assert.Equal(t, formats.Warning{Index: 2, Reason: "missing vulnerability identifier"}, warnings[1])
+	}
+
+	trivy := strings.Replace(trivyReport, `"InstalledVersion": "1.1.1t-r0"`, `"InstalledVersion": 1`, 1)
+	_, _, err = formats.Parse([]byte(trivy))
+	assert.ErrorContains(t, err, "vulnerability 0")
+
+	format, results, warnings, err = formats.ParseFileLenient("reports/trivy.json", []byte(trivy))
+	assert.NoError(t, err)
+	assert.Equal(t, "trivy", format)
+	assert.Len(t, results[0].Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2024-5678", results[0].Vulnerabilities[0].CVEID)
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, 0, warnings[0].Index)
+	}
+
+	// Well-formed reports parse the same either way
+	_, results, warnings, err = formats.ParseLenient([]byte(trivyReport))
+	assert.NoError(t, err)
+	assert.Len(t, results[0].Vulnerabilities, 2)
+	assert.Empty(t, warnings)
+}
+
+// TestParseTimestamps tests that report times in assorted layouts and zones
+// are normalized to UTC at second precision
+func TestParseTimestamps(t *testing.T) {
+	want := time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC)
+	for _, published := range []string{
+		`"2024-01-15T08:30:00Z"`,
+		`"2024-01-15T10:30:00+02:00"`,
+		`"2024-01-15T03:30:00.250-05:00"`,
+		`"2024-01-15T10:30:00+0200"`,
+		`"2024-01-15T08:30:00"`,
+		`"2024-01-15 08:30:00"`,
+		`"2024-01-15 10:30:00+02:00"`,
+		`"Mon, 15 Jan 2024 08:30:00 +0000"`,
+		`1705307400`,
+	} {
+		content := `{"scanResults":{"scan_id":"a","timestamp":` + published + `,"vulnerabilities":[{"id":"CVE-1","published_date":` + published + `}]}}`
+		_, results, err := formats.Parse([]byte(content))
+		if assert.NoError(t, err, published) {
+			assert.Equal(t, want, results[0].Timestamp, published)
+			assert.Equal(t, want, results[0].Vulnerabilities[0].PublishedDate, published)
+		}
+	}
+
+	_, results, err := formats.Parse([]byte(`{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-1","published_date":"2024-01-15"},{"id":"CVE-2","published_date":null}]}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), results[0].Vulnerabilities[0].PublishedDate)
+	assert.True(t, results[0].Vulnerabilities[1].PublishedDate.IsZero())
+
+	_, _, err = formats.Parse([]byte(`{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-1","published_date":"last week"}]}}`))
+	assert.ErrorContains(t, err, `unrecognized timestamp "last week"`)
+
+	trivy := strings.Replace(trivyReport, `"2024-03-01T10:00:00Z"`, `"2024-03-01T11:00:00.123456+01:00"`, 1)
+	_, results, err = formats.Parse([]byte(trivy))
+	assert.NoError(t, err)
+	assert.Equal(t, "trivy:alpine:3.18@2024-03-01T10:00:00Z", results[0].ScanID)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), results[0].Timestamp)
+}
@@ -0,0 +1,114 @@
+package ghsa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/ghsa"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const log4shell = `{"ghsa_id": "GHSA-jfh8-c2jp-5v3q", "cve_id": "CVE-2021-44228",
+	"identifiers": [{"type": "GHSA", "value": "GHSA-jfh8-c2jp-5v3q"}, {"type": "CVE", "value": "CVE-2021-44228"}]}`
+
+const lodash = `{"ghsa_id": "GHSA-p6mc-m468-83gw", "cve_id": "CVE-2020-8203",
+	"identifiers": [{"type": "GHSA", "value": "GHSA-p6mc-m468-83gw"}, {"type": "CVE", "value": "CVE-2020-8203"}]}`
+
+func setup(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	// One finding recorded under its CVE, one under its GHSA ID
+	for _, id := range []string{"CVE-2021-44228", "GHSA-p6mc-m468-83gw"} {
+		_, err := db.Exec(`INSERT INTO vulnerabilities (scan_id, cve_id, severity, cvss, status, package_name,
+			current_version, fixed_version, description, published_date, link, risk_factors)
+			VALUES (1, ?, 'HIGH', 8, 'fixed', 'pkg', '1.0', '1.1', '', ?, '', ?)`,
+			id, time.Now(), []byte(`[]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestResolveAndQuery tests GHSA/CVE resolution and alias-aware /query matching
+func TestResolveAndQuery(t *testing.T) {
+	setup(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/advisories" && r.URL.Query().Get("cve_id") == "CVE-2021-44228":
+			w.Write([]byte("[" + log4shell + "]"))
+		case r.URL.Path == "/advisories/GHSA-p6mc-m468-83gw":
+			w.Write([]byte(lodash))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := ghsa.NewClient(server.URL, "token")
+	client.Limiter = nil
+
+	n, err := client.ResolveStored(context.Background(), storage.DB, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Resolved identifiers are not looked up again until they expire
+	n, err = client.ResolveStored(context.Background(), storage.DB, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	query := func(id string) []models.Vulnerability {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"filters": {"id": "`+id+`"}}`))
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var vulns []models.Vulnerability
+		json.NewDecoder(rr.Body).Decode(&vulns)
+		return vulns
+	}
+
+	for id, stored := range map[string]string{
+		"CVE-2021-44228":      "CVE-2021-44228",
+		"GHSA-jfh8-c2jp-5v3q": "CVE-2021-44228",
+		"GHSA-p6mc-m468-83gw": "GHSA-p6mc-m468-83gw",
+		"CVE-2020-8203":       "GHSA-p6mc-m468-83gw",
+	} {
+		vulns := query(id)
+		if assert.Len(t, vulns, 1, id) {
+			assert.Equal(t, stored, vulns[0].CVEID)
+			assert.Len(t, vulns[0].Aliases, 1)
+		}
+	}
+	assert.Empty(t, query("CVE-1999-0001"))
+}
+
+// TestQueryRequiresFilter tests that an unbounded query is rejected
+func TestQueryRequiresFilter(t *testing.T) {
+	setup(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"filters": {}}`))
+	rr := httptest.NewRecorder()
+	handlers.QueryHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,252 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// TestContentsFetch tests fetching files through the contents API
+func TestContentsFetch(t *testing.T) {
+	report := []byte(`{"scanResults":{}}`)
+	encoded := base64.StdEncoding.EncodeToString(report)
+	wrapped := encoded[:8] + "\n" + encoded[8:] + "\n" // The API wraps base64 in lines
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/repos/acme/api/contents/reports/trivy scan.json":
+			assert.Equal(t, "main", r.URL.Query().Get("ref"))
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, wrapped)
+		case "/repos/acme/api/contents/large.json":
+			fmt.Fprint(w, `{"type": "file", "encoding": "none", "content": "", "size": 2000000, "sha": "abc"}`)
+		case "/repos/acme/api/git/blobs/abc":
+			fmt.Fprintf(w, `{"encoding": "base64", "content": %q, "sha": "abc"}`, encoded)
+		case "/repos/acme/api/contents/reports":
+			fmt.Fprint(w, `[{"type": "file", "name": "trivy.json"}]`)
+		default:
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := github.NewClient(server.URL, "secret")
+	client.Host = "github.com"
+	ctx := context.Background()
+
+	body, v, err := client.FetchFileContent(ctx, "https://github.com/acme/api", "main", "reports/trivy scan.json", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, report, body)
+	assert.Equal(t, `"v1"`, v.ETag)
+
+	_, _, err = client.FetchFileContent(ctx, "https://github.com/acme/api", "main", "reports/trivy scan.json", &v)
+	assert.ErrorIs(t, err, github.ErrNotModified)
+
+	body, _, err = client.FetchFileContent(ctx, "https://github.com/acme/api", "main", "large.json", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, report, body)
+
+	_, _, err = client.FetchFileContent(ctx, "https://github.com/acme/api", "main", "reports", nil)
+	assert.Error(t, err)
+	_, _, err = client.FetchFileContent(ctx, "https://github.com/acme/api", "main", "missing.json", nil)
+	assert.ErrorContains(t, err, "HTTP status 404")
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	// Other hosts' repositories and dot segments never reach the API with
+	// the token
+	for _, repo := range []string{"https://gitlab.com/acme/api", "https://github.com/acme/../api", "https://github.com/acme"} {
+		_, _, err = client.FetchFileContent(ctx, repo, "main", "reports/trivy scan.json", nil)
+		assert.Error(t, err, repo)
+		assert.NotErrorIs(t, err, errs.ErrNotFound, repo)
+	}
+	for _, file := range []string{"../../../user", "reports/../../../../user", "./large.json", "reports//trivy scan.json"} {
+		_, _, err = client.FetchFileContent(ctx, "https://github.com/acme/api", "main", file, nil)
+		assert.ErrorContains(t, err, "invalid path", file)
+	}
+
+	// The repository host follows the API root
+	assert.Equal(t, "github.com", github.NewClient("https://api.github.com", "").Host)
+	assert.Equal(t, "ghe.example.com", github.NewClient("https://ghe.example.com/api/v3", "").Host)
+}
+
+// TestRawFetch tests that raw fetches only go to allowed hosts, for
+// well-formed repository URLs and paths, and never to internal addresses
+func TestRawFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/acme/api/release/1.0/reports/trivy%20scan.json":
+			w.Write([]byte("report"))
+		case "/acme/api/main/moved.json":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := httpclient.DefaultConfig
+	cfg.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	transport, err := httpclient.NewPublicTransport(cfg)
+	assert.NoError(t, err)
+	fetcher := &github.RawFetcher{HTTP: &http.Client{Transport: transport}, Hosts: map[string]string{"github.com": server.URL}}
+	ctx := context.Background()
+
+	for _, repo := range []string{"https://github.com/acme/api", "http://GitHub.com/acme/api.git/", " https://github.com/acme/api "} {
+		body, _, err := fetcher.FetchFileContent(ctx, repo, "release/1.0", "reports/trivy scan.json", nil)
+		assert.NoError(t, err, repo)
+		assert.Equal(t, "report", string(body), repo)
+	}
+
+	for _, repo := range []string{
+		"https://gitlab.com/acme/api",
+		"https://127.0.0.1/acme/api",
+		"https://[::1]/acme/api",
+		"https://github.com:8443/acme/api",
+		"https://user@github.com/acme/api",
+		"https://github.com/acme/api?ref=x",
+		"https://github.com/acme/api/tree/main",
+		"https://github.com/acme/..",
+		"https://github.com/acme/%2e%2e",
+		"file:///etc/passwd",
+	} {
+		_, _, err := fetcher.FetchFileContent(ctx, repo, "main", "reports/trivy.json", nil)
+		assert.Error(t, err, repo)
+	}
+	for _, file := range []string{"../../other/repo/main/secret.json", "reports//trivy.json", "./trivy.json"} {
+		_, _, err := fetcher.FetchFileContent(ctx, "https://github.com/acme/api", "main", file, nil)
+		assert.ErrorContains(t, err, "invalid path", file)
+	}
+	_, _, err = fetcher.FetchFileContent(ctx, "https://github.com/acme/api", "..", "trivy.json", nil)
+	assert.ErrorContains(t, err, "invalid path")
+
+	// A redirect to an internal address is refused
+	_, _, err = fetcher.FetchFileContent(ctx, "https://github.com/acme/api", "main", "moved.json", nil)
+	assert.ErrorIs(t, err, httpclient.ErrBlockedAddress)
+
+	hosts, err := github.ParseRawHosts([]string{"GitHub.example.com=https://raw.github.example.com/"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"github.example.com": "https://raw.github.example.com"}, hosts)
+	for _, entry := range []string{"github.com", "github.com=ftp://raw", "github.com:443=https://raw", "=https://raw"} {
+		_, err := github.ParseRawHosts([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+// TestRateLimit tests quota tracking, pausing near exhaustion, and the
+// error of an exhausted quota
+func TestRateLimit(t *testing.T) {
+	remaining := 5
+	var reset time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Now().After(reset) {
+			remaining = 5
+		}
+		w.Header().Set("X-RateLimit-Limit", "5")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if remaining == 0 {
+			http.Error(w, `{"message": "API rate limit exceeded"}`, http.StatusForbidden)
+			return
+		}
+		remaining--
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+	client := github.NewClient(server.URL, "")
+	ctx := context.Background()
+
+	// Nothing is known before the first response
+	assert.Zero(t, client.RateLimit().Limit)
+
+	reset = time.Now().Add(time.Second)
+	client.Reserve = 3
+	_, err := client.ListOrgRepos(ctx, "acme")
+	assert.NoError(t, err)
+	rl := client.RateLimit()
+	assert.Equal(t, 5, rl.Limit)
+	assert.Equal(t, 5, rl.Remaining)
+
+	// Near exhaustion, the request waits for the window to reset
+	remaining = 3
+	_, err = client.ListOrgRepos(ctx, "acme")
+	assert.NoError(t, err)
+	start := time.Now()
+	_, err = client.ListOrgRepos(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Greater(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 1, client.RateLimit().Pauses)
+
+	// An exhausted quota is reported as such
+	client.Reserve = 0
+	reset = time.Now().Add(time.Hour)
+	remaining = 0
+	_, err = client.ListOrgRepos(ctx, "acme")
+	assert.ErrorIs(t, err, errs.ErrUpstreamRateLimited)
+	assert.ErrorContains(t, err, "rate limit exhausted")
+	wait, ok := errs.RetryAfter(err)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), wait.Seconds(), 5)
+
+	// A canceled wait returns the context's error
+	client.Reserve = 10
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = client.ListOrgRepos(cctx, "acme")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestDefaultBranch tests looking up and caching default branches
+func TestDefaultBranch(t *testing.T) {
+	var lookups int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/api":
+			lookups++
+			w.Write([]byte(`{"default_branch": "master"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(server.URL, "")
+	ctx := context.Background()
+	for _, repo := range []string{"https://github.com/acme/api", "https://github.com/Acme/API.git"} {
+		branch, err := client.DefaultBranch(ctx, repo)
+		assert.NoError(t, err)
+		assert.Equal(t, "master", branch)
+	}
+	assert.Equal(t, 1, lookups)
+
+	client = github.NewClient(server.URL, "")
+	client.BranchTTL = 0
+	client.DefaultBranch(ctx, "https://github.com/acme/api")
+	client.DefaultBranch(ctx, "https://github.com/acme/api")
+	assert.Equal(t, 3, lookups)
+
+	_, err := client.DefaultBranch(ctx, "https://github.com/acme/missing")
+	assert.ErrorContains(t, err, "HTTP status 404")
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	// Raw fetchers look up branches through their API client
+	fetcher := &github.RawFetcher{API: github.NewClient(server.URL, "")}
+	branch, err := fetcher.DefaultBranch(ctx, "https://github.com/acme/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "master", branch)
+}
@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// app depends on express and jest; both reach the vulnerable minimist, jest
+// through a longer chain
+const bom = `{
+  "bomFormat": "CycloneDX",
+  "serialNumber": "urn:uuid:1",
+  "metadata": {"component": {"bom-ref": "app", "name": "app"}},
+  "components": [
+    {"bom-ref": "express", "name": "express", "version": "4.18.2"},
+    {"bom-ref": "jest", "name": "jest", "version": "29.0.0"},
+    {"bom-ref": "mkdirp", "name": "mkdirp", "version": "0.5.1"},
+    {"bom-ref": "yargs", "name": "yargs", "version": "17.0.0"},
+    {"bom-ref": "minimist", "name": "minimist", "version": "1.2.5"}
+  ],
+  "dependencies": [
+    {"ref": "app", "dependsOn": ["express", "jest"]},
+    {"ref": "express", "dependsOn": ["mkdirp"]},
+    {"ref": "jest", "dependsOn": ["yargs"]},
+    {"ref": "yargs", "dependsOn": ["mkdirp"]},
+    {"ref": "mkdirp", "dependsOn": ["minimist"]}
+  ]
+}`
+
+// TestDependencyEdges tests graph extraction from SBOMs and lockfiles
+func TestDependencyEdges(t *testing.T) {
+	_, results, err := formats.Parse([]byte(bom))
+	assert.NoError(t, err)
+	assert.Contains(t, results[0].Dependencies, models.Dependency{Parent: "", Child: "express"})
+	assert.Contains(t, results[0].Dependencies, models.Dependency{Parent: "mkdirp", Child: "minimist"})
+	assert.Len(t, results[0].Dependencies, 6)
+
+	_, results, err = formats.Parse([]byte(`{
+		"spdxVersion": "SPDX-2.3", "documentNamespace": "https://example.com/1",
+		"packages": [{"SPDXID": "SPDXRef-app", "name": "app"}, {"SPDXID": "SPDXRef-a", "name": "a", "versionInfo": "1"},
+			{"SPDXID": "SPDXRef-b", "name": "b", "versionInfo": "1"}],
+		"relationships": [
+			{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-app"},
+			{"spdxElementId": "SPDXRef-app", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-a"},
+			{"spdxElementId": "SPDXRef-b", "relationshipType": "DEPENDENCY_OF", "relatedSpdxElement": "SPDXRef-a"}
+		]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Dependency{{Parent: "", Child: "SPDXRef-a"}, {Parent: "SPDXRef-a", Child: "SPDXRef-b"}},
+		results[0].Dependencies)
+
+	// Nested installs resolve to the closest node_modules copy
+	_, results, err = formats.ParseFile("package-lock.json", []byte(`{"lockfileVersion": 3, "packages": {
+		"": {"dependencies": {"express": "^4"}, "devDependencies": {"jest": "^29"}},
+		"node_modules/express": {"version": "4.18.2", "dependencies": {"mkdirp": "^0.5"}},
+		"node_modules/jest": {"version": "29.0.0", "dependencies": {"mkdirp": "^1"}},
+		"node_modules/jest/node_modules/mkdirp": {"version": "1.0.4"},
+		"node_modules/mkdirp": {"version": "0.5.1"}}}`))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []models.Dependency{
+		{Parent: "", Child: "express@4.18.2"},
+		{Parent: "", Child: "jest@29.0.0"},
+		{Parent: "express@4.18.2", Child: "mkdirp@0.5.1"},
+		{Parent: "jest@29.0.0", Child: "mkdirp@1.0.4"},
+	}, results[0].Dependencies)
+
+	_, results, err = formats.ParseFile("go.mod", []byte("module m\n\nrequire (\n\ta v1.0.0\n\tb v1.0.0 // indirect\n)\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Dependency{{Parent: "", Child: "a@v1.0.0"}}, results[0].Dependencies)
+}
+
+// TestBlastRadius tests walking from a vulnerable package to the top-level
+// dependencies that pull it in
+func TestBlastRadius(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	store := func(repo string, sr models.ScanResult, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "sbom.json", time.Now(), "s", time.Now())
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		for _, c := range sr.Components {
+			assert.NoError(t, storage.InsertComponent(ctx, db, scanID, c))
+		}
+		for _, d := range sr.Dependencies {
+			assert.NoError(t, storage.InsertDependency(ctx, db, scanID, d))
+		}
+		for _, v := range vulns {
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+		}
+	}
+	minimist := models.Vulnerability{CVEID: "CVE-2021-44906", Severity: "CRITICAL", PackageName: "minimist",
+		CurrentVersion: "1.2.5", RiskFactors: models.RiskFactors{}}
+
+	_, results, err := formats.Parse([]byte(bom))
+	assert.NoError(t, err)
+	store("repo-a", results[0], minimist)
+	// A scan without relationships
+	store("repo-b", models.ScanResult{Components: []models.Component{{Name: "minimist", Version: "1.2.5"}}}, minimist)
+
+	get := func(target string) (int, handlers.BlastRadius) {
+		rr := httptest.NewRecorder()
+		handlers.BlastRadiusHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp handlers.BlastRadius
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := get("/blast-radius?id=CVE-2021-44906")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, resp.Affected, 2) {
+		a := resp.Affected[0]
+		assert.Equal(t, "repo-a", a.Repo)
+		assert.Equal(t, "minimist", a.Package)
+		assert.True(t, a.Graph)
+		assert.Equal(t, []handlers.TopLevelDependency{
+			{Name: "express", Version: "4.18.2", Path: []string{"express@4.18.2", "mkdirp@0.5.1", "minimist@1.2.5"}},
+			{Name: "jest", Version: "29.0.0", Path: []string{"jest@29.0.0", "yargs@17.0.0", "mkdirp@0.5.1", "minimist@1.2.5"}},
+		}, a.TopLevel)
+
+		assert.False(t, resp.Affected[1].Graph)
+		assert.Empty(t, resp.Affected[1].TopLevel)
+	}
+
+	_, resp = get("/blast-radius?id=CVE-2021-44906&repo=repo-b")
+	assert.Len(t, resp.Affected, 1)
+	_, resp = get("/blast-radius?id=CVE-2000-0001")
+	assert.NotNil(t, resp.Affected)
+	assert.Empty(t, resp.Affected)
+	code, _ = get("/blast-radius")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
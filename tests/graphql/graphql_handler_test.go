@@ -0,0 +1,124 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const repoURL = "https://github.com/velancio/vulnerability_scans"
+
+// setupTestDB creates a migrated in-memory SQLite database with one scan
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.Exec(`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		repoURL, "vulnscan16.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+
+	for _, v := range []struct{ cve, severity string }{
+		{"CVE-2024-0001", "critical"},
+		{"CVE-2024-0002", "high"},
+		{"CVE-2024-0003", "critical"},
+	} {
+		_, err := db.Exec(`INSERT INTO vulnerabilities (
+				scan_id, cve_id, severity, cvss, status, package_name, current_version,
+				fixed_version, description, published_date, link, risk_factors
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			scanID, v.cve, v.severity, 9.1, "active", "openssl", "1.1.1t-r0",
+			"1.1.1u-r0", "Test vulnerability", time.Now().UTC(), "https://nvd.nist.gov", []byte(`["Remote Code Execution"]`))
+		assert.NoError(t, err)
+	}
+
+	storage.DB = db
+	return db
+}
+
+// TestGraphQLHandler tests nested repo → latest scan → vulnerability queries
+func TestGraphQLHandler(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	body, _ := json.Marshal(handlers.GraphQLRequest{
+		Query: `query($repo: String!) {
+			repo(name: $repo) {
+				name
+				latestScan {
+					filePath
+					vulnerabilities(severity: "critical", limit: 10) { id riskFactors scan { scanId } }
+				}
+			}
+		}`,
+		Variables: map[string]interface{}{"repo": repoURL},
+	})
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.GraphQLHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data struct {
+			Repo struct {
+				Name       string
+				LatestScan struct {
+					FilePath        string
+					Vulnerabilities []struct {
+						ID          string
+						RiskFactors []string
+						Scan        struct{ ScanID string }
+					}
+				}
+			}
+		}
+		Errors []interface{}
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Empty(t, response.Errors)
+
+	scan := response.Data.Repo.LatestScan
+	assert.Equal(t, repoURL, response.Data.Repo.Name)
+	assert.Equal(t, "vulnscan16.json", scan.FilePath)
+	assert.Len(t, scan.Vulnerabilities, 2)
+	for _, v := range scan.Vulnerabilities {
+		assert.Equal(t, []string{"Remote Code Execution"}, v.RiskFactors)
+		assert.Equal(t, "scan-1", v.Scan.ScanID)
+	}
+}
+
+// TestGraphQLPagination tests limit and offset on top-level lists
+func TestGraphQLPagination(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	req, _ := http.NewRequest("GET", `/graphql?query={vulnerabilities(limit:2,offset:1){id}}`, nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.GraphQLHandler).ServeHTTP(rr, req)
+
+	var response struct {
+		Data struct {
+			Vulnerabilities []struct{ ID string }
+		}
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Len(t, response.Data.Vulnerabilities, 2)
+	assert.Equal(t, "CVE-2024-0002", response.Data.Vulnerabilities[0].ID)
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// setupTestDB creates a migrated in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.DB = db
+	return db
+}
+
+// TestProbeHandlers tests the health, liveness, and readiness endpoints
+func TestProbeHandlers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		handler      http.HandlerFunc
+		expectedCode int
+	}{
+		{name: "Healthz reports process up", path: "/healthz", handler: handlers.HealthzHandler, expectedCode: http.StatusOK},
+		{name: "Livez reports process alive", path: "/livez", handler: handlers.LivezHandler, expectedCode: http.StatusOK},
+		{name: "Readyz with migrated database", path: "/readyz", handler: handlers.ReadyzHandler, expectedCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+
+			var response handlers.HealthResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, "ok", response.Status)
+		})
+	}
+}
+
+// TestReadyzFailingCheck tests that a failing registered check marks the service unavailable
+func TestReadyzFailingCheck(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handlers.RegisterReadinessCheck("test-worker", func() error { return errors.New("worker stopped") })
+	defer handlers.RegisterReadinessCheck("test-worker", func() error { return nil })
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.ReadyzHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var response handlers.HealthResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Equal(t, "worker stopped", response.Checks["test-worker"])
+	assert.Equal(t, "ok", response.Checks["database"])
+	assert.Equal(t, "ok", response.Checks["migrations"])
+}
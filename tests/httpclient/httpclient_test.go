@@ -0,0 +1,253 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/httpclient"
+)
+
+// testConfig retries quickly
+var testConfig = httpclient.Config{Timeout: 5 * time.Second, MaxRetries: 2, Backoff: time.Millisecond, MaxBackoff: time.Second}
+
+// TestRetries tests which failures are retried, and how often
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/slow" {
+			w.Header().Set("Retry-After", "120")
+		}
+		if r.Method == http.MethodPost {
+			body := make([]byte, 4)
+			r.Body.Read(body)
+			assert.Equal(t, "data", string(body))
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	transport, err := httpclient.NewTransport(testConfig)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+	do := func(method, path string) int {
+		calls.Store(0)
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader("data"))
+		if method == http.MethodGet {
+			req, _ = http.NewRequest(method, server.URL+path, nil)
+		}
+		resp, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode)
+		return int(calls.Load())
+	}
+
+	// Refused requests are retried whatever the method, replaying the body
+	assert.Equal(t, 3, do(http.MethodGet, "/"))
+	assert.Equal(t, 3, do(http.MethodPost, "/"))
+
+	// A Retry-After beyond MaxBackoff ends retrying
+	assert.Equal(t, 1, do(http.MethodGet, "/slow"))
+
+	// Server errors are retried only for idempotent requests
+	status = http.StatusBadGateway
+	assert.Equal(t, 3, do(http.MethodGet, "/"))
+	assert.Equal(t, 1, do(http.MethodPost, "/"))
+
+	// Client errors are not retried
+	status = http.StatusNotFound
+	assert.Equal(t, 1, do(http.MethodGet, "/"))
+}
+
+// TestRetryAfter tests that the server's requested delay is honored
+func TestRetryAfter(t *testing.T) {
+	var first time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if first.IsZero() {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.GreaterOrEqual(t, time.Since(first), 900*time.Millisecond)
+	}))
+	defer server.Close()
+
+	transport, err := httpclient.NewTransport(testConfig)
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestCABundle tests trusting a server certificate from a CA bundle file
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport, err := httpclient.NewTransport(testConfig)
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(server.URL)
+	assert.ErrorContains(t, err, "certificate")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(bundle, cert, 0o600))
+	cfg := testConfig
+	cfg.CABundle = bundle
+	assert.NoError(t, transport.Configure(cfg))
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	cfg.CABundle = filepath.Join(t.TempDir(), "missing.pem")
+	assert.Error(t, transport.Configure(cfg))
+}
+
+// TestCircuitBreaker tests that a failing host's requests fail fast until a
+// probe after the cooldown succeeds, without affecting other hosts
+func TestCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	var changes []string
+	httpclient.OnCircuitChange = func(c httpclient.Circuit) { changes = append(changes, c.State) }
+	defer func() { httpclient.OnCircuitChange = nil }()
+
+	cfg := testConfig
+	cfg.BreakerThreshold, cfg.BreakerCooldown = 3, 100*time.Millisecond
+	transport, err := httpclient.NewTransport(cfg)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+	get := func(url string) (int, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// The third failed attempt opens the breaker
+	code, err := get(failing.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.Equal(t, int32(3), calls.Load())
+	_, err = get(failing.URL)
+	assert.ErrorIs(t, err, httpclient.ErrCircuitOpen)
+	assert.Equal(t, int32(3), calls.Load())
+
+	code, err = get(healthy.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	host := strings.TrimPrefix(failing.URL, "http://")
+	circuit := func() httpclient.Circuit {
+		for _, c := range transport.Circuits() {
+			if c.Host == host {
+				return c
+			}
+		}
+		return httpclient.Circuit{}
+	}
+	assert.Equal(t, httpclient.Circuit{Host: host, State: httpclient.CircuitOpen, Failures: 3, Opens: 1}, circuit())
+
+	// A failed probe opens the breaker again without retrying
+	time.Sleep(150 * time.Millisecond)
+	_, err = get(failing.URL)
+	assert.ErrorIs(t, err, httpclient.ErrCircuitOpen)
+	assert.Equal(t, int32(4), calls.Load())
+	assert.Equal(t, 2, circuit().Opens)
+
+	// A successful probe closes it
+	down.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	code, err = get(failing.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, httpclient.Circuit{Host: host, State: httpclient.CircuitClosed, Opens: 2}, circuit())
+
+	// Reopening after a failed probe is the same outage
+	assert.Equal(t, []string{httpclient.CircuitOpen, httpclient.CircuitClosed}, changes)
+}
+
+// TestPublicTransport tests that public transports refuse internal
+// addresses, whether given directly, reached by a redirect, or behind a
+// name that resolves to one
+func TestPublicTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	local := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	transport, err := httpclient.NewPublicTransport(testConfig)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+	for _, target := range []string{
+		server.URL,
+		local, // The name passes as a host but resolves to loopback when dialed
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::ffff:10.0.0.1]/",
+	} {
+		_, err := client.Get(target)
+		assert.ErrorIs(t, err, httpclient.ErrBlockedAddress, target)
+	}
+	assert.Zero(t, calls.Load())
+	assert.Empty(t, transport.Circuits()) // Refusals aren't upstream failures
+
+	// Allowed networks can be reached, but redirects from them still can't
+	// leave them
+	cfg := testConfig
+	cfg.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	assert.NoError(t, transport.Configure(cfg))
+	resp, err := client.Get(local + "/?to=" + url.QueryEscape(server.URL+"/ok"))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	for _, to := range []string{"http://169.254.169.254/latest/meta-data/", "http://192.168.1.1/", "http://[fd00::1]/"} {
+		_, err := client.Get(local + "/?to=" + url.QueryEscape(to))
+		assert.ErrorIs(t, err, httpclient.ErrBlockedAddress, to)
+	}
+	assert.Equal(t, int32(5), calls.Load())
+
+	// Other transports are unrestricted
+	open, err := httpclient.NewTransport(testConfig)
+	assert.NoError(t, err)
+	resp, err = (&http.Client{Transport: open}).Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestIdempotencyKey tests that retried requests with an Idempotency-Key
+// run once and receive the original response
+func TestIdempotencyKey(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	var calls atomic.Int32
+	status := http.StatusOK
+	release := make(chan struct{})
+	h := handlers.Idempotent("/scan", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call": %d, "body": %q}`, n, body)
+	})
+	do := func(key, actor, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/scan", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req.Header.Set("X-Actor", actor)
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	first := do("ci-run-1", "ci", `{"repo": "a"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+	retry := do("ci-run-1", "ci", `{"repo": "a"}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Keys belong to an actor, and requests without one always run
+	assert.Empty(t, do("ci-run-1", "alice", `{"repo": "a"}`).Header().Get("Idempotent-Replayed"))
+	do("", "ci", `{"repo": "a"}`)
+	do("", "ci", `{"repo": "a"}`)
+	assert.Equal(t, int32(4), calls.Load())
+
+	assert.Equal(t, http.StatusUnprocessableEntity, do("ci-run-1", "ci", `{"repo": "b"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("bad\nkey", "ci", `{}`).Code)
+
+	// A retry while the original runs conflicts instead of running twice
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- do("ci-run-2", "ci", "slow") }()
+	for calls.Load() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, http.StatusConflict, do("ci-run-2", "ci", "slow").Code)
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.Equal(t, "true", do("ci-run-2", "ci", "slow").Header().Get("Idempotent-Replayed"))
+
+	// Server errors are not replayed, so the retry runs again
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, do("ci-run-3", "ci", `{}`).Code)
+	status = http.StatusCreated
+	rr := do("ci-run-3", "ci", `{}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, http.StatusCreated, do("ci-run-3", "ci", `{}`).Code)
+	assert.Equal(t, int32(7), calls.Load())
+
+	// Expired keys are forgotten
+	defer func(ttl time.Duration) { handlers.IdempotencyTTL = ttl }(handlers.IdempotencyTTL)
+	handlers.IdempotencyTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	assert.Empty(t, do("ci-run-1", "ci", `{"repo": "a"}`).Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(8), calls.Load())
+}
@@ -0,0 +1,122 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/image"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fakeTrivy prints a report for alpine:3.18 and fails for any other image
+const fakeTrivy = `#!/bin/sh
+for a; do ref=$a; done
+if [ "$ref" != "alpine:3.18" ]; then
+	echo "FATAL	image scan error: $ref: not found" >&2
+	exit 1
+fi
+cat <<'JSON'
+{
+  "SchemaVersion": 2,
+  "CreatedAt": "2024-03-01T09:00:00Z",
+  "ArtifactName": "alpine:3.18",
+  "ArtifactType": "container_image",
+  "Results": [{
+    "Target": "alpine:3.18 (alpine 3.18.4)",
+    "Class": "os-pkgs",
+    "Type": "alpine",
+    "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2023-5678", "PkgName": "libcrypto3", "InstalledVersion": "3.1.3-r0",
+       "FixedVersion": "3.1.4-r1", "Severity": "MEDIUM"},
+      {"VulnerabilityID": "CVE-2024-0727", "PkgName": "libssl3", "InstalledVersion": "3.1.3-r0",
+       "Severity": "LOW"}
+    ]
+  }]
+}
+JSON
+`
+
+// TestImageScan tests that image scans run the scanner and store its report
+func TestImageScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake scanner is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "trivy")
+	if err := os.WriteFile(path, []byte(fakeTrivy), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s image.Scanner) { image.DefaultScanner = s }(image.DefaultScanner)
+	image.DefaultScanner = &image.Trivy{Path: path, Timeout: 10 * time.Second}
+
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scanner := handlers.NewScanner(github.DefaultFetcher)
+	resp := scanner.Run(ctx, handlers.ScanRequest{Image: "alpine:3.18"})
+	assert.Equal(t, []string{"alpine:3.18"}, resp.Success)
+	assert.Empty(t, resp.Failed)
+
+	var scan struct {
+		Repo     string `db:"repo"`
+		FilePath string `db:"file_path"`
+		ScanID   string `db:"scan_id"`
+	}
+	assert.NoError(t, db.Get(&scan, "SELECT repo, file_path, scan_id FROM scans"))
+	assert.Equal(t, "alpine:3.18", scan.Repo)
+	assert.Equal(t, "alpine:3.18", scan.FilePath)
+	assert.Equal(t, "trivy:alpine:3.18@2024-03-01T09:00:00Z", scan.ScanID)
+
+	findings, err := handlers.ListFindings(ctx, handlers.FindingFilters{Repo: "alpine:3.18", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, findings, 2)
+
+	// Findings can be filed under a repository instead
+	resp = scanner.Run(ctx, handlers.ScanRequest{Repo: "https://github.com/acme/api", Image: "alpine:3.18"})
+	assert.Len(t, resp.Success, 1)
+	findings, _ = handlers.ListFindings(ctx, handlers.FindingFilters{Repo: "https://github.com/acme/api", Limit: 10})
+	assert.Len(t, findings, 2)
+
+	resp = scanner.Run(ctx, handlers.ScanRequest{Image: "alpine:9.99"})
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, "alpine:9.99", resp.Failed[0].File)
+		assert.Contains(t, resp.Failed[0].Error, "alpine:9.99: not found")
+	}
+}
+
+// TestValidateRef tests that references cannot be mistaken for options
+func TestValidateRef(t *testing.T) {
+	for _, ref := range []string{"alpine", "alpine:3.18", "ghcr.io/acme/api:v1.2",
+		"registry:5000/acme/api@sha256:0123abcd", "localhost/img_name-x:1.0+build"} {
+		assert.NoError(t, image.ValidateRef(ref), ref)
+	}
+	for _, ref := range []string{"", "--help", "-o/tmp/x", "alpine 3.18", "alpine;rm", "alpine\n"} {
+		assert.Error(t, image.ValidateRef(ref), ref)
+	}
+
+	rr := httptest.NewRecorder()
+	handlers.NewScanner(github.DefaultFetcher).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan",
+		bytes.NewBufferString(`{"image": "--input=/etc/passwd"}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,157 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/jira"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fakeJira is an in-memory Jira project
+type fakeJira struct {
+	mu       sync.Mutex
+	issues   map[string]string // key -> summary
+	statuses map[string]string // key -> status category
+	creates  []map[string]interface{}
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/rest/api/2/issue":
+		f.creates = append(f.creates, body)
+		key := fmt.Sprintf("SEC-%d", 100+len(f.creates))
+		f.issues[key] = body["fields"].(map[string]interface{})["summary"].(string)
+		f.statuses[key] = "new"
+		json.NewEncoder(w).Encode(map[string]string{"key": key})
+	case "/rest/api/2/search":
+		jql := body["jql"].(string)
+		var issues []map[string]interface{}
+		var phrase string
+		if start, end := strings.Index(jql, `\"`), strings.LastIndex(jql, `\"`); start < end {
+			phrase = jql[start+2 : end]
+		}
+		for key, summary := range f.issues {
+			if strings.Contains(jql, `"`+key+`"`) || (phrase != "" && strings.Contains(summary, phrase)) {
+				issues = append(issues, map[string]interface{}{
+					"key": key,
+					"fields": map[string]interface{}{"status": map[string]interface{}{
+						"name": f.statuses[key], "statusCategory": map[string]string{"key": f.statuses[key]},
+					}},
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"issues": issues})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// TestSync tests issue creation with deduplication and status sync back to triage
+func TestSync(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	fake := &fakeJira{issues: map[string]string{}, statuses: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// A pre-existing issue for one finding is adopted instead of duplicated
+	fake.issues["SEC-100"] = "CVE-2024-0002 in curl (HIGH)"
+	fake.statuses["SEC-100"] = "indeterminate"
+
+	scan := func(repo string, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", time.Now(), "s", time.Now())
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl", FixedVersion: "3.0.9"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "HIGH", PackageName: "curl"}
+	low := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "LOW", PackageName: "zlib"}
+	scan("repo-a", critical, high, low)
+	scan("repo-b", critical)
+
+	client := jira.NewClient(srv.URL, "bot@example.com", "secret", "SEC")
+	client.Labels = []string{"security", "vulnscan"}
+
+	created, updated, err := client.Sync(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 0, updated)
+	if assert.Len(t, fake.creates, 1) {
+		fields := fake.creates[0]["fields"].(map[string]interface{})
+		assert.Equal(t, "CVE-2024-0001 in openssl (CRITICAL)", fields["summary"])
+		assert.Equal(t, map[string]interface{}{"key": "SEC"}, fields["project"])
+		assert.Equal(t, []interface{}{"security", "vulnscan"}, fields["labels"])
+		assert.Contains(t, fields["description"], "Repositories: repo-a, repo-b")
+	}
+
+	// Issue keys are returned with query results
+	vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{Severity: "CRITICAL"})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 2) {
+		assert.Equal(t, "SEC-101", vulns[0].JiraIssue)
+	}
+
+	// Rescanning does not open another issue
+	scan("repo-a", critical, high, low)
+	created, _, err = client.Sync(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	// Closing the issue resolves every finding of the pair; reopening reopens them
+	fake.statuses["SEC-101"] = "done"
+	_, updated, err = client.Sync(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, updated)
+	resp, err := handlers.GetTriage(ctx, vulns[0].FindingID)
+	assert.NoError(t, err)
+	assert.Equal(t, "resolved", resp.Status)
+	if assert.NotEmpty(t, resp.History) {
+		assert.Equal(t, "jira:SEC-101", resp.History[len(resp.History)-1].Actor)
+	}
+
+	fake.statuses["SEC-101"] = "indeterminate"
+	_, updated, err = client.Sync(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, updated)
+	resp, _ = handlers.GetTriage(ctx, vulns[0].FindingID)
+	assert.Equal(t, "open", resp.Status)
+}
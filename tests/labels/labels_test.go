@@ -0,0 +1,119 @@
+package labels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// TestScanLabels tests attaching labels to scans and filtering and
+// grouping by them
+func TestScanLabels(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	scanner := handlers.NewScanner(fetcher{
+		"api.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[
+			{"id":"CVE-2024-0001","severity":"CRITICAL","package_name":"openssl"},
+			{"id":"CVE-2024-0002","severity":"LOW","package_name":"zlib"}]}}`,
+		"web.json": `{"scanResults":{"scan_id":"b","vulnerabilities":[
+			{"id":"CVE-2024-0003","severity":"CRITICAL","package_name":"lodash"}]}}`,
+		"old.json": `{"scanResults":{"scan_id":"c","vulnerabilities":[]}}`,
+	})
+	scan := func(req handlers.ScanRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		scanner.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		return rr
+	}
+	payments := map[string]string{"team": "payments", "env": "prod"}
+	assert.Equal(t, http.StatusOK, scan(handlers.ScanRequest{Repo: "repo-a", Files: []string{"api.json"}, Labels: payments}).Code)
+	assert.Equal(t, http.StatusOK, scan(handlers.ScanRequest{Repo: "repo-b", Files: []string{"web.json"}, Labels: map[string]string{"team": "search"}}).Code)
+	assert.Equal(t, http.StatusOK, scan(handlers.ScanRequest{Repo: "repo-b", Files: []string{"old.json"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, scan(handlers.ScanRequest{Repo: "repo-a", Files: []string{"api.json"}, Labels: map[string]string{"bad key": "x"}}).Code)
+
+	// Query
+	filters := handlers.QueryFilters{Labels: map[string]string{"team": "payments"}}
+	assert.NoError(t, handlers.ValidateQueryFilters(filters))
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), filters)
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 2) {
+		assert.Equal(t, payments, vulns[0].Labels)
+	}
+	filters = handlers.QueryFilters{Severity: "CRITICAL", Labels: map[string]string{"team": "search"}}
+	vulns, err = handlers.QueryVulnerabilities(context.Background(), filters)
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2024-0003", vulns[0].CVEID)
+	}
+	filters = handlers.QueryFilters{Labels: map[string]string{"team": "payments", "env": "dev"}}
+	vulns, err = handlers.QueryVulnerabilities(context.Background(), filters)
+	assert.NoError(t, err)
+	assert.Empty(t, vulns)
+
+	// Stats
+	stats := func(query string) (int, handlers.StatsResponse) {
+		rr := httptest.NewRecorder()
+		handlers.StatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats?"+query, nil))
+		var resp handlers.StatsResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+	code, resp := stats("label=team:payments&label=env:prod")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, resp.Scans)
+	assert.Equal(t, 2, resp.Vulnerabilities)
+	assert.Equal(t, map[string]int{"CRITICAL": 1, "LOW": 1}, resp.BySeverity)
+	assert.Nil(t, resp.ByLabel)
+
+	code, resp = stats("group_by=team")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, resp.Scans)
+	assert.Equal(t, map[string]handlers.LabelStats{
+		"payments": {Scans: 1, Repos: 1, Vulnerabilities: 2, BySeverity: map[string]int{"CRITICAL": 1, "LOW": 1}},
+		"search":   {Scans: 1, Repos: 1, Vulnerabilities: 1, BySeverity: map[string]int{"CRITICAL": 1}},
+		"":         {Scans: 1, Repos: 1, BySeverity: map[string]int{}},
+	}, resp.ByLabel)
+
+	code, resp = stats("repo=repo-b&group_by=team")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.ByLabel, 2)
+
+	for _, query := range []string{"label=team", "label=bad%20key:x", "group_by=bad%20key"} {
+		code, _ := stats(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
@@ -0,0 +1,133 @@
+package license
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/license"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/policy"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestDenied tests deny-list evaluation of SPDX license expressions
+func TestDenied(t *testing.T) {
+	p := license.Policy{Deny: []string{"AGPL-*", "SSPL-1.0"}}
+
+	for expr, want := range map[string][]string{
+		"MIT":                               nil,
+		"agpl-3.0-only":                     {"agpl-3.0-only"},
+		"MIT OR AGPL-3.0-only":              nil, // MIT can be chosen
+		"MIT AND AGPL-3.0-or-later":         {"AGPL-3.0-or-later"},
+		"(MIT OR SSPL-1.0) AND AGPL-3.0":    {"AGPL-3.0"},
+		"SSPL-1.0 OR (AGPL-3.0 AND MIT)":    {"SSPL-1.0", "AGPL-3.0"},
+		"AGPL-3.0 WITH Classpath-exception": {"AGPL-3.0"},
+		"GPL-3.0-only":                      nil,
+		"":                                  nil,
+		// Malformed: every mentioned license applies
+		"MIT OR (AGPL-3.0": {"AGPL-3.0"},
+	} {
+		assert.Equal(t, want, p.Denied(expr), expr)
+	}
+	assert.Nil(t, license.Policy{}.Denied("AGPL-3.0-only"))
+
+	findings := license.Policy{Deny: []string{"AGPL-*"}, Severity: "medium"}.Violations([]models.Component{
+		{Name: "mongo-tools", Version: "1.0.0", Ecosystem: "npm", PURL: "pkg:npm/mongo-tools@1.0.0", License: "AGPL-3.0-only AND AGPL-3.0-only"},
+		{Name: "lodash", Version: "4.17.21", Ecosystem: "npm", License: "MIT"},
+	})
+	if assert.Len(t, findings, 1) {
+		f := findings[0]
+		assert.Equal(t, "license:AGPL-3.0-only", f.CVEID)
+		assert.Equal(t, "MEDIUM", f.Severity)
+		assert.Equal(t, "mongo-tools", f.PackageName)
+		assert.Equal(t, "1.0.0", f.CurrentVersion)
+		assert.Equal(t, "pkg:npm/mongo-tools@1.0.0", f.PURL)
+	}
+}
+
+// TestComponentLicenses tests that SBOM and lockfile licenses are recorded
+func TestComponentLicenses(t *testing.T) {
+	_, results, err := formats.Parse([]byte(`{
+		"bomFormat": "CycloneDX", "serialNumber": "urn:uuid:1",
+		"components": [
+			{"name": "a", "version": "1", "licenses": [{"license": {"id": "MIT"}}]},
+			{"name": "b", "version": "1", "licenses": [{"expression": "MIT OR Apache-2.0"}, {"license": {"name": "Custom"}}]},
+			{"name": "c", "version": "1"}
+		]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "MIT", results[0].Components[0].License)
+	assert.Equal(t, "(MIT OR Apache-2.0) AND Custom", results[0].Components[1].License)
+	assert.Equal(t, "", results[0].Components[2].License)
+
+	_, results, err = formats.Parse([]byte(`{
+		"spdxVersion": "SPDX-2.3", "documentNamespace": "https://example.com/1",
+		"packages": [
+			{"name": "a", "versionInfo": "1", "licenseConcluded": "NOASSERTION", "licenseDeclared": "BSD-3-Clause"},
+			{"name": "b", "versionInfo": "1", "licenseConcluded": "GPL-2.0-only", "licenseDeclared": "MIT"}
+		]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "BSD-3-Clause", results[0].Components[0].License)
+	assert.Equal(t, "GPL-2.0-only", results[0].Components[1].License)
+
+	_, results, err = formats.ParseFile("package-lock.json", []byte(`{"lockfileVersion": 3, "packages": {
+		"node_modules/a": {"version": "1.0.0", "license": "ISC"},
+		"node_modules/b": {"version": "1.0.0", "license": {"type": "MIT"}}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "ISC", results[0].Components[0].License)
+	assert.Equal(t, "MIT", results[0].Components[1].License)
+}
+
+// TestLicenseViolations tests querying and gating on stored violations
+func TestLicenseViolations(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"repo-a", "sbom.json", time.Now(), "s", time.Now())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	c := models.Component{Name: "mongo-tools", Version: "1.0.0", Ecosystem: "npm", License: "AGPL-3.0-only"}
+	assert.NoError(t, storage.InsertComponent(ctx, db, scanID, c))
+	var stored string
+	assert.NoError(t, db.Get(&stored, "SELECT license FROM components"))
+	assert.Equal(t, "AGPL-3.0-only", stored)
+
+	vulns := append(license.Policy{Deny: []string{"AGPL-*"}, Severity: "HIGH"}.Violations([]models.Component{c}),
+		models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "HIGH", PackageName: "lodash", RiskFactors: models.RiskFactors{}})
+	for _, v := range vulns {
+		assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+	}
+
+	for pattern, want := range map[string]int{"*": 1, "agpl-*": 1, "AGPL-3.0-only": 1, "GPL-*": 0} {
+		found, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{License: pattern})
+		assert.NoError(t, err)
+		assert.Len(t, found, want, pattern)
+	}
+	assert.NoError(t, handlers.ValidateQueryFilters(handlers.QueryFilters{License: "*"}))
+
+	p := policy.Policy{Name: "legal", Rules: []policy.Rule{{Name: "no-agpl", Licenses: []string{"AGPL-*"}, Max: 0}}}
+	assert.NoError(t, policy.Validate(p))
+	result := policy.Evaluate(p, vulns)
+	assert.False(t, result.Passed)
+	if assert.Len(t, result.Violations, 1) {
+		assert.Equal(t, 1, result.Violations[0].Count)
+		assert.Equal(t, "license:AGPL-3.0-only", result.Violations[0].Findings[0].CVEID)
+	}
+	assert.Error(t, policy.Validate(policy.Policy{Name: "x", Rules: []policy.Rule{{Name: "r", Licenses: []string{" "}}}}))
+}
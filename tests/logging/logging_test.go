@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/logging"
+)
+
+// TestSamplingHandler tests that repeated messages are sampled after the initial burst
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{Level: "info", Format: "json", Initial: 3, Thereafter: 5})
+	assert.NoError(t, err)
+
+	for i := 0; i < 13; i++ {
+		logger.Warn("file ingest failed", "index", i)
+	}
+	logger.Info("scan completed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// 3 initial records, then the 5th and 10th repeats, plus one distinct message
+	assert.Len(t, lines, 6)
+}
+
+// TestInvalidOptions tests that unknown levels and formats are rejected
+func TestInvalidOptions(t *testing.T) {
+	_, err := logging.New(&bytes.Buffer{}, logging.Options{Level: "loud", Format: "json"})
+	assert.Error(t, err)
+
+	_, err = logging.New(&bytes.Buffer{}, logging.Options{Level: "info", Format: "xml"})
+	assert.Error(t, err)
+}
+
+// TestMiddlewareRequestID tests that request IDs are propagated or generated
+func TestMiddlewareRequestID(t *testing.T) {
+	var seen string
+	handler := logging.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r)
+	})
+
+	req, _ := http.NewRequest("GET", "/query", nil)
+	req.Header.Set(logging.RequestIDHeader, "abc123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "abc123", seen)
+	assert.Equal(t, "abc123", rr.Header().Get(logging.RequestIDHeader))
+
+	req, _ = http.NewRequest("GET", "/query", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rr.Header().Get(logging.RequestIDHeader))
+}
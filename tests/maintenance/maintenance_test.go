@@ -0,0 +1,83 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestMaintenance tests checkpointing, vacuuming, and checking a database
+// file after a large deletion
+func TestMaintenance(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "vulnerabilities.db") + "?_journal=WAL&_busy_timeout=5000&_txlock=immediate&_auto_vacuum=incremental"
+	assert.NoError(t, storage.InitDB(dsn, ""))
+	db := storage.DB
+	defer db.Close()
+
+	rr := httptest.NewRecorder()
+	handlers.MaintenanceHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Fill, then empty, a table so the file has free pages
+	tx := db.MustBegin()
+	for i := 0; i < 500; i++ {
+		tx.MustExec("INSERT INTO raw_files (sha256, encoding, size, content, created_at) VALUES (?, 'identity', 4096, zeroblob(4096), CURRENT_TIMESTAMP)", i)
+	}
+	assert.NoError(t, tx.Commit())
+	db.MustExec("DELETE FROM raw_files")
+	db.MustExec("INSERT INTO raw_files (sha256, encoding, size, content, created_at) VALUES ('x', 'identity', 0, '', CURRENT_TIMESTAMP)")
+
+	run := func(body string) handlers.MaintenanceResult {
+		rr := httptest.NewRecorder()
+		handlers.MaintenanceHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var res handlers.MaintenanceResult
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		return res
+	}
+	res := run("")
+	assert.False(t, res.CheckpointBusy)
+	assert.Equal(t, res.WALFrames, res.CheckpointedFrames)
+	assert.Equal(t, "incremental", res.AutoVacuum)
+	assert.Greater(t, res.VacuumedPages, 500)
+	assert.True(t, res.Analyzed)
+	assert.Equal(t, []string{"ok"}, res.Integrity)
+	assert.Zero(t, res.FreeBytes)
+	assert.Less(t, res.SizeBytes, int64(500*4096))
+	assert.Empty(t, res.Error)
+
+	rr = httptest.NewRecorder()
+	handlers.MaintenanceHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var last handlers.MaintenanceResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &last))
+	assert.Equal(t, res.StartedAt, last.StartedAt)
+
+	// A database created without incremental vacuum is switched by a full one
+	plain, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "plain.db")+"?_journal=WAL")
+	assert.NoError(t, err)
+	defer plain.Close()
+	assert.NoError(t, storage.Migrate(plain))
+	storage.DB = plain
+	res = run("")
+	assert.Equal(t, "none", res.AutoVacuum)
+	assert.Zero(t, res.VacuumedPages)
+	res = run(`{"full_vacuum": true}`)
+	assert.True(t, res.FullVacuum)
+	assert.Equal(t, "incremental", res.AutoVacuum)
+	assert.Equal(t, []string{"ok"}, res.Integrity)
+
+	rr = httptest.NewRecorder()
+	handlers.MaintenanceHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
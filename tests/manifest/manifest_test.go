@@ -0,0 +1,116 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+)
+
+const goMod = `module github.com/acme/api
+
+go 1.22
+
+require github.com/gin-gonic/gin v1.9.0
+
+require (
+	golang.org/x/net v0.17.0 // indirect
+	github.com/acme/internal v0.0.0-20240101000000-abcdef123456
+	golang.org/x/text v0.13.0
+)
+
+replace golang.org/x/text => golang.org/x/text v0.14.0
+
+replace github.com/acme/internal => ../internal
+`
+
+const packageLock = `{
+  "name": "web",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "web", "version": "1.0.0"},
+    "node_modules/lodash": {"version": "4.17.20"},
+    "node_modules/@babel/core": {"version": "7.23.0"},
+    "node_modules/@babel/core/node_modules/semver": {"version": "6.3.0"},
+    "node_modules/shared": {"resolved": "packages/shared", "link": true}
+  }
+}`
+
+const packageLockV1 = `{
+  "name": "legacy",
+  "lockfileVersion": 1,
+  "dependencies": {
+    "minimist": {"version": "1.2.5"},
+    "mkdirp": {"version": "0.5.1", "dependencies": {"minimist": {"version": "0.0.8"}}}
+  }
+}`
+
+const requirements = `# Pinned dependencies
+Django==4.2.1
+requests[socks] == 2.31.0 ; python_version >= "3.8"
+PyYAML===6.0 \
+    --hash=sha256:0123
+flask>=2.0
+-r base.txt
+--index-url https://pypi.example.com/simple
+`
+
+// TestManifests tests dependency extraction from package manifests
+func TestManifests(t *testing.T) {
+	format, results, err := formats.ParseFile("go.mod", []byte(goMod))
+	assert.NoError(t, err)
+	assert.Equal(t, "gomod", format)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "manifest", results[0].ResourceType)
+		assert.Equal(t, "github.com/acme/api", results[0].ResourceName)
+		assert.Equal(t, "gomod:go.mod", results[0].ScanID)
+		assert.Equal(t, []models.Component{
+			{Name: "github.com/gin-gonic/gin", Version: "v1.9.0", Ecosystem: "Go", PURL: "pkg:golang/github.com/gin-gonic/gin@v1.9.0", Type: "library", Ref: "github.com/gin-gonic/gin@v1.9.0"},
+			{Name: "golang.org/x/net", Version: "v0.17.0", Ecosystem: "Go", PURL: "pkg:golang/golang.org/x/net@v0.17.0", Type: "library", Ref: "golang.org/x/net@v0.17.0"},
+			{Name: "github.com/acme/internal", Version: "v0.0.0-20240101000000-abcdef123456", Ecosystem: "Go",
+				PURL: "pkg:golang/github.com/acme/internal@v0.0.0-20240101000000-abcdef123456", Type: "library", Ref: "github.com/acme/internal@v0.0.0-20240101000000-abcdef123456"},
+			{Name: "golang.org/x/text", Version: "v0.14.0", Ecosystem: "Go", PURL: "pkg:golang/golang.org/x/text@v0.14.0", Type: "library", Ref: "golang.org/x/text@v0.14.0"},
+		}, results[0].Components)
+	}
+
+	format, results, err = formats.ParseFile("web/package-lock.json", []byte(packageLock))
+	assert.NoError(t, err)
+	assert.Equal(t, "npm-lock", format)
+	assert.Equal(t, "web", results[0].ResourceName)
+	assert.Equal(t, []models.Component{
+		{Name: "@babel/core", Version: "7.23.0", Ecosystem: "npm", PURL: "pkg:npm/%40babel/core@7.23.0", Type: "library", Ref: "@babel/core@7.23.0"},
+		{Name: "lodash", Version: "4.17.20", Ecosystem: "npm", PURL: "pkg:npm/lodash@4.17.20", Type: "library", Ref: "lodash@4.17.20"},
+		{Name: "semver", Version: "6.3.0", Ecosystem: "npm", PURL: "pkg:npm/semver@6.3.0", Type: "library", Ref: "semver@6.3.0"},
+	}, results[0].Components)
+
+	_, results, err = formats.ParseFile("package-lock.json", []byte(packageLockV1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minimist@0.0.8", "minimist@1.2.5", "mkdirp@0.5.1"}, nameVersions(results[0].Components))
+
+	format, results, err = formats.ParseFile("requirements-dev.txt", []byte(requirements))
+	assert.NoError(t, err)
+	assert.Equal(t, "requirements", format)
+	assert.Equal(t, "requirements-dev.txt", results[0].ResourceName)
+	assert.Equal(t, []string{"django@4.2.1", "requests@2.31.0", "pyyaml@6.0"}, nameVersions(results[0].Components))
+	assert.Equal(t, "PyPI", results[0].Components[0].Ecosystem)
+
+	// Malformed manifests are errors; other files are detected by content
+	_, _, err = formats.ParseFile("go.mod", []byte("require (\n\tgolang.org/x/net v0.17.0\n"))
+	assert.ErrorContains(t, err, "invalid gomod manifest")
+	_, _, err = formats.ParseFile("package-lock.json", []byte(`{"name": "x"}`))
+	assert.ErrorContains(t, err, "missing lockfileVersion")
+	format, _, err = formats.ParseFile("reports/go.mod.json", []byte(`{"SchemaVersion": 2, "Results": []}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "trivy", format)
+}
+
+// nameVersions lists components as name@version
+func nameVersions(components []models.Component) []string {
+	var out []string
+	for _, c := range components {
+		out = append(out, c.Name+"@"+c.Version)
+	}
+	return out
+}
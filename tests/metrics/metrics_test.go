@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/metrics"
+)
+
+// TestHandler tests the Prometheus text rendering of registered metrics
+func TestHandler(t *testing.T) {
+	metrics.Register(metrics.Metric{Name: "test_requests_total", Help: "Requests served", Type: metrics.Counter,
+		Collect: func() []metrics.Sample {
+			return []metrics.Sample{
+				{Labels: map[string]string{"status": "ok", "method": "GET"}, Value: 3},
+				{Labels: map[string]string{"status": "error", "method": "GET"}, Value: 1},
+			}
+		}})
+	metrics.Register(metrics.Metric{Name: "test_ratio", Help: "A ratio", Type: metrics.Gauge,
+		Collect: metrics.Value(func() float64 { return 0.25 })})
+	metrics.Register(metrics.Metric{Name: "test_unknown", Help: "Not yet known", Type: metrics.Gauge,
+		Collect: func() []metrics.Sample { return nil }})
+
+	rr := httptest.NewRecorder()
+	metrics.Handler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain")
+	assert.Equal(t, `# HELP test_ratio A ratio
+# TYPE test_ratio gauge
+test_ratio 0.25
+# HELP test_requests_total Requests served
+# TYPE test_requests_total counter
+test_requests_total{method="GET",status="ok"} 3
+test_requests_total{method="GET",status="error"} 1
+`, rr.Body.String())
+}
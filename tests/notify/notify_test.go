@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/notify"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// webhook records the JSON bodies posted to it
+type webhook struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	h.mu.Lock()
+	h.bodies = append(h.bodies, body)
+	h.mu.Unlock()
+}
+
+func (h *webhook) take() []map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	bodies := h.bodies
+	h.bodies = nil
+	return bodies
+}
+
+// TestNotifications tests routing, templates, and first-sighting detection
+func TestNotifications(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	slackHook, teamsHook := &webhook{}, &webhook{}
+	slackSrv, teamsSrv := httptest.NewServer(slackHook), httptest.NewServer(teamsHook)
+	defer slackSrv.Close()
+	defer teamsSrv.Close()
+
+	n, err := notify.New(notify.Config{Channels: []notify.ChannelConfig{
+		{Name: "security", Type: "slack", WebhookURL: slackSrv.URL, MinSeverity: "critical"},
+		{Name: "team-a", Type: "teams", WebhookURL: teamsSrv.URL, Repos: []string{"repo-a"}},
+	}}, db)
+	assert.NoError(t, err)
+
+	_, err = notify.New(notify.Config{Channels: []notify.ChannelConfig{{Name: "x", Type: "pager"}}}, db)
+	assert.ErrorContains(t, err, "unknown type")
+
+	scan := func(repo string, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", time.Now().UTC(), "s", time.Now())
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", CVSS: 9.8,
+		PackageName: "openssl", CurrentVersion: "3.0.1", FixedVersion: "3.0.9"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "HIGH", CVSS: 7.5, PackageName: "curl"}
+
+	publish := func(repo string, v models.Vulnerability) {
+		n.Handle(ctx, events.Event{Type: events.TypeVulnerability, Repo: repo, Severity: v.Severity, Data: v})
+	}
+
+	// A new critical finding in repo-a reaches both channels; the high one only Teams
+	scan("repo-a", critical, high)
+	publish("repo-a", critical)
+	publish("repo-a", high)
+	slack := slackHook.take()
+	if assert.Len(t, slack, 1) {
+		assert.Equal(t, ":rotating_light: New CRITICAL vulnerability in repo-a", slack[0]["text"])
+		blocks := slack[0]["blocks"].([]interface{})
+		section := blocks[1].(map[string]interface{})["text"].(map[string]interface{})
+		assert.Equal(t, "CVE-2024-0001 in openssl 3.0.1 (CVSS 9.8), fixed in 3.0.9", section["text"])
+	}
+	teams := teamsHook.take()
+	if assert.Len(t, teams, 2) {
+		assert.Equal(t, "MessageCard", teams[0]["@type"])
+		assert.Equal(t, "B00020", teams[0]["themeColor"])
+		assert.Equal(t, "New HIGH vulnerability in repo-a", teams[1]["title"])
+	}
+
+	// Rescans do not announce the same finding again; other repos filter by channel
+	scan("repo-a", critical)
+	publish("repo-a", critical)
+	scan("repo-b", critical)
+	publish("repo-b", critical)
+	assert.Len(t, slackHook.take(), 1)
+	assert.Empty(t, teamsHook.take())
+
+	// Scan failures carry no severity and pass every threshold
+	n.Handle(ctx, events.Event{Type: events.TypeScanFailed, Repo: "repo-a",
+		Data: map[string]string{"file": "trivy.json", "error": "fetch failed: HTTP status 404"}})
+	teams = teamsHook.take()
+	if assert.Len(t, teams, 1) {
+		assert.Equal(t, "Scan failed for repo-a", teams[0]["title"])
+		assert.Equal(t, "trivy.json: fetch failed: HTTP status 404", teams[0]["text"])
+	}
+	assert.Len(t, slackHook.take(), 1)
+
+	// Digests are limited to each channel's repositories and threshold
+	assert.NoError(t, n.SendDigest(ctx, time.Now().Add(-time.Hour)))
+	slack = slackHook.take()
+	if assert.Len(t, slack, 1) {
+		section := slack[0]["blocks"].([]interface{})[1].(map[string]interface{})["text"].(map[string]interface{})
+		assert.Equal(t, "repo-a: 2 scan(s), open findings: 1 CRITICAL\nrepo-b: 1 scan(s), open findings: 1 CRITICAL", section["text"])
+	}
+	teams = teamsHook.take()
+	if assert.Len(t, teams, 1) {
+		assert.Equal(t, "repo-a: 2 scan(s), open findings: 1 CRITICAL", teams[0]["text"])
+	}
+}
+
+// TestOperationalNotifications tests that operational messages only reach
+// channels that list them
+func TestOperationalNotifications(t *testing.T) {
+	ctx := context.Background()
+	securityHook, oncallHook := &webhook{}, &webhook{}
+	securitySrv, oncallSrv := httptest.NewServer(securityHook), httptest.NewServer(oncallHook)
+	defer securitySrv.Close()
+	defer oncallSrv.Close()
+
+	n, err := notify.New(notify.Config{Channels: []notify.ChannelConfig{
+		{Name: "security", Type: "slack", WebhookURL: securitySrv.URL},
+		{Name: "oncall", Type: "teams", WebhookURL: oncallSrv.URL,
+			Events: []string{notify.KindFetchFailures, notify.KindScanStuck, notify.KindDatabaseError, notify.KindUpstreamOutage}},
+	}}, nil)
+	assert.NoError(t, err)
+
+	n.Handle(ctx, events.Event{Type: events.TypeFetchFailures, Repo: "repo-a",
+		Data: map[string]interface{}{"failures": 3, "file": "trivy.json", "error": "connection refused"}})
+	n.Handle(ctx, events.Event{Type: events.TypeScanStuck,
+		Data: map[string]interface{}{"job": "abc123", "created_at": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "running": "45m0s", "repos": 10, "done": 4}})
+	n.Handle(ctx, events.Event{Type: events.TypeDatabaseError, Repo: "repo-a",
+		Data: map[string]interface{}{"file": "trivy.json", "error": "insert scan failed: database is locked"}})
+	n.Handle(ctx, events.Event{Type: events.TypeUpstreamOutage, Data: map[string]interface{}{"host": "api.github.com", "state": "open", "failures": 5}})
+	n.Handle(ctx, events.Event{Type: events.TypeUpstreamOutage, Data: map[string]interface{}{"host": "api.github.com", "state": "closed"}})
+
+	assert.Empty(t, securityHook.take())
+	oncall := oncallHook.take()
+	if assert.Len(t, oncall, 5) {
+		assert.Equal(t, "Repeated fetch failures for repo-a", oncall[0]["title"])
+		assert.Equal(t, "3 files in a row failed to download. Last: trivy.json: connection refused", oncall[0]["text"])
+		assert.Equal(t, "Bulk scan abc123 is stuck", oncall[1]["title"])
+		assert.Equal(t, "Running for 45m0s since 2024-05-01 12:00 UTC, 4 of 10 repositories done", oncall[1]["text"])
+		assert.Equal(t, "Database error storing a scan of repo-a", oncall[2]["title"])
+		assert.Equal(t, "Upstream api.github.com is down", oncall[3]["title"])
+		assert.Equal(t, "Upstream api.github.com recovered", oncall[4]["title"])
+	}
+}
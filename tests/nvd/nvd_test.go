@@ -0,0 +1,106 @@
+package nvd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/nvd"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const log4shell = `{
+  "totalResults": 1,
+  "vulnerabilities": [{"cve": {
+    "id": "CVE-2021-44228",
+    "lastModified": "2023-11-07T03:39:36.747",
+    "descriptions": [{"lang": "es", "value": "..."}, {"lang": "en", "value": "Apache Log4j2 JNDI features do not protect against attacker controlled LDAP."}],
+    "metrics": {"cvssMetricV31": [
+      {"source": "other", "type": "Secondary", "cvssData": {"vectorString": "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:C/C:H/I:H/A:H", "baseScore": 9.0}},
+      {"source": "nvd@nist.gov", "type": "Primary", "cvssData": {"vectorString": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", "baseScore": 10.0}}
+    ]},
+    "weaknesses": [{"description": [{"lang": "en", "value": "CWE-502"}, {"lang": "en", "value": "CWE-400"}]},
+                   {"description": [{"lang": "en", "value": "CWE-502"}]}],
+    "references": [{"url": "https://logging.apache.org/log4j/2.x/security.html"}]
+  }}]
+}`
+
+func setup(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	for _, id := range []string{"CVE-2021-44228", "CVE-2099-0001", "GHSA-jfh8-c2jp-5v3q"} {
+		_, err := db.Exec(`INSERT INTO vulnerabilities (scan_id, cve_id, severity, cvss, status, package_name,
+			current_version, fixed_version, description, published_date, link, risk_factors)
+			VALUES (1, ?, 'CRITICAL', 10, 'fixed', 'log4j-core', '2.14.1', '2.15.0', '', ?, '', ?)`,
+			id, time.Now(), []byte(`[]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestEnrich tests fetching NVD records and joining them into query results
+func TestEnrich(t *testing.T) {
+	setup(t)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "secret", r.Header.Get("apiKey"))
+		switch r.URL.Query().Get("cveId") {
+		case "CVE-2021-44228":
+			w.Write([]byte(log4shell))
+		default:
+			w.Write([]byte(`{"totalResults": 0, "vulnerabilities": []}`))
+		}
+	}))
+	defer server.Close()
+
+	client := nvd.NewClient(server.URL, "secret")
+	client.Limiter = nil
+
+	n, err := client.Enrich(context.Background(), storage.DB, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n) // GHSA identifiers are not looked up
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Fresh records are served from the local table
+	n, err = client.Enrich(context.Background(), storage.DB, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, int32(2), requests.Load())
+
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "CRITICAL"})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 3)
+	for _, v := range vulns {
+		if v.CVEID != "CVE-2021-44228" {
+			continue
+		}
+		if assert.NotNil(t, v.NVD) {
+			assert.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", v.NVD.CVSSVector)
+			assert.Equal(t, 10.0, v.NVD.CVSSScore)
+			assert.Equal(t, []string{"CWE-502", "CWE-400"}, []string(v.NVD.CWEIDs))
+			assert.Equal(t, []string{"https://logging.apache.org/log4j/2.x/security.html"}, []string(v.NVD.References))
+			assert.Contains(t, v.NVD.Description, "JNDI")
+			assert.Equal(t, 2023, v.NVD.LastModified.Year())
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package osv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/osv"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const lodashVuln = `{
+	"id": "GHSA-p6mc-m468-83gw", "summary": "Prototype Pollution in lodash",
+	"aliases": ["CVE-2020-8203"], "published": "2020-07-15T19:15:00Z",
+	"database_specific": {"severity": "HIGH"},
+	"affected": [{"package": {"name": "lodash", "ecosystem": "npm"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "4.17.21"}]}]}]
+}`
+
+const lodashVuln2 = `{
+	"id": "GHSA-35jh-r3h4-6jhm", "summary": "Command Injection in lodash",
+	"aliases": ["CVE-2021-23337"], "published": "2021-02-15T13:15:00Z",
+	"database_specific": {"severity": "HIGH"},
+	"affected": [{"package": {"name": "lodash", "ecosystem": "npm"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "4.17.21"}]}]}]
+}`
+
+// fakeOSV serves a configurable set of lodash vulnerabilities and counts batch calls
+type fakeOSV struct {
+	batches atomic.Int32
+	ids     atomic.Value // []string
+}
+
+func (f *fakeOSV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/querybatch":
+		f.batches.Add(1)
+		var body struct{ Queries []osv.Query }
+		json.NewDecoder(r.Body).Decode(&body)
+		type result struct {
+			Vulns []map[string]string `json:"vulns"`
+		}
+		var resp struct {
+			Results []result `json:"results"`
+		}
+		for _, q := range body.Queries {
+			var res result
+			if q.Package.Name == "lodash" {
+				for _, id := range f.ids.Load().([]string) {
+					res.Vulns = append(res.Vulns, map[string]string{"id": id})
+				}
+			}
+			resp.Results = append(resp.Results, res)
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/v1/vulns/GHSA-p6mc-m468-83gw":
+		w.Write([]byte(lodashVuln))
+	case "/v1/vulns/GHSA-35jh-r3h4-6jhm":
+		w.Write([]byte(lodashVuln2))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func setup(t *testing.T) *fakeOSV {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	fake := &fakeOSV{}
+	fake.ids.Store([]string{"GHSA-p6mc-m468-83gw"})
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	prev := osv.DefaultClient
+	osv.DefaultClient = &osv.Client{BaseURL: server.URL, HTTP: server.Client(), Cache: osv.NewCache(time.Hour)}
+	t.Cleanup(func() { osv.DefaultClient = prev })
+	return fake
+}
+
+var lodash = api.Package{Name: "lodash", Ecosystem: "npm", Version: "4.17.20"}
+
+// TestPackageScan tests materializing OSV findings for submitted packages
+func TestPackageScan(t *testing.T) {
+	fake := setup(t)
+
+	body := `{"repo": "https://github.com/example/app", "packages": [
+		{"name": "lodash", "ecosystem": "npm", "version": "4.17.20"},
+		{"purl": "pkg:npm/left-pad@1.3.0", "version": "1.3.0"}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/packages/scan", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handlers.PackageScanHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp handlers.PackageScanResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Packages)
+	assert.Equal(t, 1, resp.Findings)
+
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH"})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 1)
+	assert.Equal(t, "CVE-2020-8203", vulns[0].CVEID)
+
+	// A second lookup of the same package is served from the cache
+	resp2, err := handlers.ScanPackages(context.Background(), handlers.PackageScanRequest{
+		Repo: "https://github.com/example/other", Packages: []api.Package{lodash},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp2.Findings)
+	assert.Equal(t, int32(1), fake.batches.Load())
+}
+
+// TestPackageScanValidation tests request validation
+func TestPackageScanValidation(t *testing.T) {
+	setup(t)
+
+	for _, body := range []string{`{"packages": []}`, `{"packages": [{"name": "lodash"}]}`, `not json`} {
+		req := httptest.NewRequest(http.MethodPost, "/packages/scan", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handlers.PackageScanHandler(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+// TestRefresh tests that a refresh stores newly published findings exactly once
+func TestRefresh(t *testing.T) {
+	fake := setup(t)
+	ctx := context.Background()
+
+	_, err := handlers.ScanPackages(ctx, handlers.PackageScanRequest{
+		Repo: "https://github.com/example/app", Packages: []api.Package{lodash},
+	})
+	assert.NoError(t, err)
+
+	// A new advisory is published for lodash
+	fake.ids.Store([]string{"GHSA-p6mc-m468-83gw", "GHSA-35jh-r3h4-6jhm"})
+
+	n, err := osv.DefaultClient.Refresh(ctx, storage.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = osv.DefaultClient.Refresh(ctx, storage.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{Severity: "HIGH"})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 2)
+}
+
+// TestPackageScanResolves tests that a package scan resolves the findings
+// it no longer reports, and that a failed lookup stores nothing
+func TestPackageScanResolves(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	repo := "https://github.com/example/app"
+
+	_, err := handlers.ScanPackages(ctx, handlers.PackageScanRequest{Repo: repo, Packages: []api.Package{lodash}})
+	assert.NoError(t, err)
+	// lodash was replaced
+	leftPad := api.Package{Name: "left-pad", Ecosystem: "npm", Version: "1.3.0"}
+	_, err = handlers.ScanPackages(ctx, handlers.PackageScanRequest{Repo: repo, Packages: []api.Package{leftPad}})
+	assert.NoError(t, err)
+	var status string
+	assert.NoError(t, storage.DB.Get(&status, "SELECT status FROM findings WHERE repo = ? AND cve_id = 'CVE-2020-8203'", repo))
+	assert.Equal(t, storage.FindingResolved, status)
+
+	var scans int
+	assert.NoError(t, storage.DB.Get(&scans, "SELECT COUNT(*) FROM scans"))
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	osv.DefaultClient = &osv.Client{BaseURL: down.URL, HTTP: down.Client(), Cache: osv.NewCache(time.Hour)}
+	_, err = handlers.ScanPackages(ctx, handlers.PackageScanRequest{Repo: repo, Packages: []api.Package{lodash}})
+	assert.Error(t, err)
+	var after int
+	assert.NoError(t, storage.DB.Get(&after, "SELECT COUNT(*) FROM scans"))
+	assert.Equal(t, scans, after)
+}
@@ -0,0 +1,201 @@
+package overrides
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/policy"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestSeverityOverrides tests rule management and that queries and policies
+// use the effective severity while the reported one is kept
+func TestSeverityOverrides(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ctx := context.Background()
+	for _, repo := range []string{"https://github.com/acme/api", "https://github.com/other/api"} {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, 'scan.json', ?, 'a', ?)",
+			repo, time.Now().UTC(), time.Now().UTC())
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		for _, v := range []models.Vulnerability{
+			{CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "openssl", RiskFactors: models.RiskFactors{}},
+			{CVEID: "CVE-2024-5678", Severity: "MEDIUM", PackageName: "log4j", RiskFactors: models.RiskFactors{"Remote Code Execution"}},
+			{CVEID: "CVE-2024-9999", Severity: "LOW", PackageName: "zlib", RiskFactors: models.RiskFactors{"remote code execution"}},
+		} {
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/severity-overrides", handlers.SeverityOverridesHandler)
+	mux.HandleFunc("/admin/severity-overrides/{id}", handlers.SeverityOverrideHandler)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("X-Actor", "alice")
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	create := func(body string) handlers.SeverityOverride {
+		rr := do(http.MethodPost, "/admin/severity-overrides", body)
+		assert.Equal(t, http.StatusCreated, rr.Code, body)
+		var o handlers.SeverityOverride
+		json.Unmarshal(rr.Body.Bytes(), &o)
+		return o
+	}
+
+	rce := create(`{"risk_factor": "Remote Code Execution", "severity": "critical", "reason": "RCE is always critical for us"}`)
+	assert.Equal(t, "CRITICAL", rce.Severity)
+	assert.Equal(t, "alice", rce.CreatedBy)
+	create(`{"cve_id": "CVE-2024-9999", "severity": "MEDIUM", "reason": "not reachable"}`)
+	create(`{"org": "acme", "cve_id": "CVE-2024-1234", "severity": "MEDIUM"}`)
+
+	rr := do(http.MethodGet, "/admin/severity-overrides", "")
+	var listed []handlers.SeverityOverride
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed, 3)
+
+	// Queries return the effective severity beside the reported one
+	severities := func(filters ...handlers.QueryFilters) map[string]string {
+		got := map[string]string{}
+		for _, f := range filters {
+			f.Dedup = handlers.DedupOff
+			vulns, err := handlers.QueryVulnerabilities(ctx, f)
+			assert.NoError(t, err)
+			for _, v := range vulns {
+				got[v.CVEID+" "+v.Severity] = got[v.CVEID+" "+v.Severity] + v.EffectiveSeverity + ","
+			}
+		}
+		return got
+	}
+	assert.Equal(t, map[string]string{
+		"CVE-2024-1234 HIGH":   "HIGH,MEDIUM,",       // Only acme's repository is overridden
+		"CVE-2024-5678 MEDIUM": "CRITICAL,CRITICAL,", // Risk factors match ignoring case
+		"CVE-2024-9999 LOW":    "MEDIUM,MEDIUM,",     // The rule naming the CVE wins
+	}, severities(handlers.QueryFilters{ID: "CVE-2024-1234"}, handlers.QueryFilters{ID: "CVE-2024-5678"}, handlers.QueryFilters{ID: "CVE-2024-9999"}))
+	assert.Equal(t, map[string]string{"CVE-2024-1234 HIGH": "MEDIUM,", "CVE-2024-9999 LOW": "MEDIUM,MEDIUM,"},
+		severities(handlers.QueryFilters{Severity: "MEDIUM"}))
+
+	// Policies count findings at their effective severity
+	findings, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{Severity: "CRITICAL", Dedup: handlers.DedupOff})
+	assert.NoError(t, err)
+	assert.Len(t, findings, 2)
+	body, _ := json.Marshal(api.PolicyEvaluateRequest{Repo: "https://github.com/acme/api", Rules: []policy.Rule{
+		{Name: "no-critical", Severities: []string{"CRITICAL"}},
+		{Name: "no-high", Severities: []string{"HIGH"}},
+	}})
+	rr = httptest.NewRecorder()
+	handlers.PolicyHandler(rr, httptest.NewRequest(http.MethodPost, "/policy/evaluate", bytes.NewReader(body)))
+	var result policy.Result
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.False(t, result.Passed)
+	if assert.Len(t, result.Violations, 1) {
+		assert.Equal(t, "no-critical", result.Violations[0].Rule)
+	}
+
+	// Deleting a rule restores the reported severity
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/severity-overrides/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/admin/severity-overrides/1", "").Code)
+	assert.Equal(t, map[string]string{"CVE-2024-5678 MEDIUM": "MEDIUM,MEDIUM,"},
+		severities(handlers.QueryFilters{ID: "CVE-2024-5678"}))
+
+	for _, body := range []string{
+		`{"severity": "HIGH"}`,
+		`{"cve_id": "CVE-1", "severity": "SEVERE"}`,
+		`{"cve_id": "CVE-1", "severity": "HIGH", "org": "ac/me"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/severity-overrides", body).Code, body)
+	}
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, "/admin/severity-overrides/x", "").Code)
+}
+
+// TestSeveritySources tests that each finding carries its reported, NVD,
+// and override severity, that the effective one follows their precedence,
+// and that queries can filter on any of them
+func TestSeveritySources(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ctx := context.Background()
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES ('https://github.com/acme/api', 'scan.json', ?, 'a', ?)",
+		time.Now().UTC(), time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2024-0001", Severity: "LOW", PackageName: "openssl", RiskFactors: models.RiskFactors{}},
+		{CVEID: "CVE-2024-0002", Severity: "UNKNOWN", PackageName: "zlib", RiskFactors: models.RiskFactors{}},
+		{CVEID: "CVE-2024-0003", Severity: "MEDIUM", PackageName: "curl", RiskFactors: models.RiskFactors{}},
+	} {
+		assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+	}
+	for cve, score := range map[string]float64{"CVE-2024-0001": 9.8, "CVE-2024-0002": 7.5} {
+		assert.NoError(t, storage.UpsertCVEMetadata(ctx, db, models.CVEMetadata{CVEID: cve, CVSSScore: score, FetchedAt: time.Now().UTC()}))
+	}
+	assert.NoError(t, storage.InsertSeverityOverride(ctx, db, &models.SeverityOverride{CVEID: "CVE-2024-0003", Severity: "CRITICAL"}))
+
+	vulns, err := handlers.QueryVulnerabilities(ctx, api.QueryFilters{Expr: `package_name ~ "*"`, Sort: []string{"cve_id"}})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 3) {
+		// The reported severity wins over NVD's rating
+		assert.Equal(t, "LOW", vulns[0].Severity)
+		assert.Equal(t, "CRITICAL", vulns[0].NVDSeverity)
+		assert.Equal(t, "LOW", vulns[0].EffectiveSeverity)
+		// NVD's rating stands in for an UNKNOWN reported severity
+		assert.Equal(t, "HIGH", vulns[1].NVDSeverity)
+		assert.Equal(t, "HIGH", vulns[1].EffectiveSeverity)
+		// An override wins over both
+		assert.Empty(t, vulns[2].NVDSeverity)
+		assert.Equal(t, "CRITICAL", vulns[2].OverrideSeverity)
+		assert.Equal(t, "CRITICAL", vulns[2].EffectiveSeverity)
+	}
+
+	ids := func(filters api.QueryFilters) []string {
+		assert.NoError(t, handlers.ValidateQueryFilters(filters))
+		vulns, err := handlers.QueryVulnerabilities(ctx, filters)
+		assert.NoError(t, err)
+		var ids []string
+		for _, v := range vulns {
+			ids = append(ids, v.CVEID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"CVE-2024-0003"}, ids(api.QueryFilters{Severity: "CRITICAL"}))
+	assert.Equal(t, []string{"CVE-2024-0003"}, ids(api.QueryFilters{Severity: "CRITICAL", SeveritySource: handlers.SeveritySourceOverride}))
+	assert.Equal(t, []string{"CVE-2024-0001"}, ids(api.QueryFilters{Severity: "CRITICAL", SeveritySource: handlers.SeveritySourceNVD}))
+	assert.Empty(t, ids(api.QueryFilters{Severity: "CRITICAL", SeveritySource: handlers.SeveritySourceReported}))
+	assert.Equal(t, []string{"CVE-2024-0002"}, ids(api.QueryFilters{Severity: "UNKNOWN", SeveritySource: handlers.SeveritySourceReported}))
+	assert.Equal(t, []string{"CVE-2024-0002"}, ids(api.QueryFilters{Expr: "nvd_severity = high"}))
+
+	assert.Error(t, handlers.ValidateQueryFilters(api.QueryFilters{Severity: "HIGH", SeveritySource: "vendor"}))
+}
@@ -0,0 +1,352 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/pipeline"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestPipeline tests the order of stages, steps, and middleware, running a
+// subset of stages, and stage errors
+func TestPipeline(t *testing.T) {
+	var trace []string
+	step := func(name string) pipeline.Step {
+		return func(ctx context.Context, in *pipeline.Ingest) error {
+			trace = append(trace, name)
+			return nil
+		}
+	}
+	p := pipeline.New()
+	p.Add(pipeline.Persist, step("persist"))
+	p.Add(pipeline.Decode, step("decode 1"), step("decode 2"))
+	p.Add(pipeline.Fetch, step("fetch"))
+	p.Use(func(stage string, next pipeline.Step) pipeline.Step {
+		return func(ctx context.Context, in *pipeline.Ingest) error {
+			trace = append(trace, "outer "+stage)
+			return next(ctx, in)
+		}
+	}, func(stage string, next pipeline.Step) pipeline.Step {
+		return func(ctx context.Context, in *pipeline.Ingest) error {
+			trace = append(trace, "inner "+stage)
+			return next(ctx, in)
+		}
+	})
+
+	assert.NoError(t, p.Run(context.Background(), &pipeline.Ingest{}))
+	assert.Equal(t, []string{
+		"outer fetch", "inner fetch", "fetch",
+		"outer decode", "inner decode", "decode 1", "decode 2",
+		"outer normalize", "inner normalize",
+		"outer enrich", "inner enrich",
+		"outer persist", "inner persist", "persist",
+	}, trace)
+
+	trace = nil
+	assert.NoError(t, p.Run(context.Background(), &pipeline.Ingest{}, pipeline.Persist, pipeline.Decode))
+	assert.Equal(t, []string{"outer decode", "inner decode", "decode 1", "decode 2", "outer persist", "inner persist", "persist"}, trace)
+
+	// A failing step ends the ingest
+	failure := errors.New("no enrichment today")
+	p.Add(pipeline.Enrich, func(ctx context.Context, in *pipeline.Ingest) error { return failure })
+	trace = nil
+	err := p.Run(context.Background(), &pipeline.Ingest{})
+	var stageErr *pipeline.StageError
+	if assert.ErrorAs(t, err, &stageErr) {
+		assert.Equal(t, pipeline.Enrich, stageErr.Stage)
+	}
+	assert.ErrorIs(t, err, failure)
+	assert.NotContains(t, trace, "persist")
+
+	assert.Panics(t, func() { p.Add("publish", step("publish")) })
+}
+
+// fetcher serves the same report for every file
+type fetcher struct{}
+
+// FetchFileContent implements handlers.ContentFetcher
+func (fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(`{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-1","severity":"high","package_name":"openssl"}]}}`),
+		github.Validators{}, nil
+}
+
+// TestIngestExtensions tests steps added to the ingest pipeline by an
+// extension
+func TestIngestExtensions(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	var (
+		stored  []int64
+		fail    bool
+		formats []string
+	)
+	handlers.IngestPipeline.Add(pipeline.Normalize, func(ctx context.Context, in *pipeline.Ingest) error {
+		for i := range in.Results {
+			for j := range in.Results[i].Vulnerabilities {
+				v := &in.Results[i].Vulnerabilities[j]
+				v.Severity = strings.ToUpper(v.Severity)
+			}
+		}
+		return nil
+	})
+	handlers.IngestPipeline.Add(pipeline.Enrich, func(ctx context.Context, in *pipeline.Ingest) error {
+		if fail {
+			return errors.New("advisory feed unavailable")
+		}
+		in.Results[0].Vulnerabilities = append(in.Results[0].Vulnerabilities,
+			models.Vulnerability{CVEID: "CVE-2", Severity: "LOW", PackageName: "zlib"})
+		return nil
+	})
+	handlers.IngestPipeline.Add(pipeline.Persist, func(ctx context.Context, in *pipeline.Ingest) error {
+		stored = append(stored, in.ScanIDs...)
+		return nil
+	})
+	handlers.IngestPipeline.Use(func(stage string, next pipeline.Step) pipeline.Step {
+		return func(ctx context.Context, in *pipeline.Ingest) error {
+			err := next(ctx, in)
+			if stage == pipeline.Decode {
+				formats = append(formats, in.Format)
+			}
+			return err
+		}
+	})
+
+	scanner := handlers.NewScanner(fetcher{})
+	resp := scanner.Run(context.Background(), handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"report.json"}})
+	assert.Equal(t, handlers.ScanCompleted, resp.Status)
+	assert.Equal(t, []string{"native"}, formats)
+
+	var vulns []string
+	assert.NoError(t, db.Select(&vulns, "SELECT cve_id || ' ' || severity FROM vulnerabilities ORDER BY cve_id"))
+	assert.Equal(t, []string{"CVE-1 HIGH", "CVE-2 LOW"}, vulns)
+	var scanIDs []int64
+	assert.NoError(t, db.Select(&scanIDs, "SELECT id FROM scans"))
+	assert.Equal(t, scanIDs, stored)
+
+	// Failures of extension steps are categorized by their stage
+	fail = true
+	resp = scanner.Run(context.Background(), handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"report.json"}, Force: true})
+	assert.Equal(t, handlers.ScanFailed, resp.Status)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, handlers.FailureCorrelation, resp.Failed[0].Category)
+		assert.Equal(t, "advisory feed unavailable", resp.Failed[0].Error)
+	}
+}
+
+// TestPipelinedIngest tests that files are fetched while earlier ones are
+// still being stored
+func TestPipelinedIngest(t *testing.T) {
+	assert.NoError(t, handlers.SetConcurrency(1, 4))
+	assert.NoError(t, handlers.SetPersistConcurrency(1))
+	defer handlers.SetConcurrency(3, 4)
+	defer handlers.SetPersistConcurrency(2)
+
+	// The first file is stored only once the second has been fetched, which
+	// a single worker fetching and storing in turn would never do
+	fetched := make(chan string, 2)
+	p := pipeline.New()
+	p.Add(pipeline.Fetch, func(ctx context.Context, in *pipeline.Ingest) (err error) {
+		in.Content, err = in.Source(ctx)
+		fetched <- in.File
+		return err
+	})
+	p.Add(pipeline.Persist, func(ctx context.Context, in *pipeline.Ingest) error {
+		if in.File != "a.json" {
+			return nil
+		}
+		for {
+			select {
+			case f := <-fetched:
+				if f == "b.json" {
+					return nil
+				}
+			case <-time.After(time.Second):
+				return errors.New("b.json not fetched while a.json was stored")
+			}
+		}
+	})
+	defer func(p *pipeline.Pipeline) { handlers.IngestPipeline = p }(handlers.IngestPipeline)
+	handlers.IngestPipeline = p
+
+	resp := handlers.NewScanner(fetcher{}).Run(context.Background(),
+		handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"a.json", "b.json"}, Force: true})
+	assert.Equal(t, handlers.ScanCompleted, resp.Status, resp.Failed)
+	assert.ElementsMatch(t, []string{"a.json", "b.json"}, resp.Success)
+}
+
+// TestBudget tests that acquires wait for room, give up with their context,
+// and that content larger than the budget is refused
+func TestBudget(t *testing.T) {
+	ctx := context.Background()
+	b := pipeline.NewBudget(100)
+	assert.NoError(t, b.Acquire(ctx, 60))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.Acquire(ctx, 50) }()
+	assert.Eventually(t, func() bool { _, waiting := b.Stats(); return waiting == 1 }, time.Second, time.Millisecond)
+	b.Release(60)
+	assert.NoError(t, <-acquired)
+	used, waiting := b.Stats()
+	assert.Equal(t, int64(50), used)
+	assert.Zero(t, waiting)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Acquire(timeout, 60), context.DeadlineExceeded)
+	assert.ErrorIs(t, b.Acquire(ctx, 1000), pipeline.ErrTooLarge)
+	b.Release(50)
+
+	// A hold takes room for content before it is read, all of the budget
+	// when its size is unknown, and fits it once it has been
+	h := b.Hold()
+	r, err := pipeline.Reader(pipeline.WithHold(ctx, h), strings.NewReader(strings.Repeat("x", 80)), -1)
+	assert.NoError(t, err)
+	used, _ = b.Stats()
+	assert.Equal(t, int64(100), used)
+	content, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, h.Fit(ctx, int64(len(content))))
+	used, _ = b.Stats()
+	assert.Equal(t, int64(80), used)
+	h.Release()
+	r, err = pipeline.Reader(pipeline.WithHold(ctx, h), strings.NewReader(strings.Repeat("x", 101)), -1)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, pipeline.ErrTooLarge)
+	h.Release()
+	_, err = pipeline.Reader(pipeline.WithHold(ctx, h), strings.NewReader(""), 101)
+	assert.ErrorIs(t, err, pipeline.ErrTooLarge)
+	used, _ = b.Stats()
+	assert.Zero(t, used)
+
+	// Without a limit nothing waits
+	assert.NoError(t, pipeline.NewBudget(0).Acquire(ctx, 1<<40))
+
+	// A scan holds its files' content until they are stored
+	defer func(b *pipeline.Budget) { handlers.IngestBudget = b }(handlers.IngestBudget)
+	handlers.IngestBudget = pipeline.NewBudget(150)
+	var peak int64
+	p := pipeline.New()
+	p.Add(pipeline.Fetch, func(ctx context.Context, in *pipeline.Ingest) (err error) {
+		in.Content, err = in.Source(ctx)
+		return err
+	})
+	p.Add(pipeline.Persist, func(ctx context.Context, in *pipeline.Ingest) error {
+		used, _ := handlers.IngestBudget.Stats()
+		peak = max(peak, used)
+		return nil
+	})
+	defer func(p *pipeline.Pipeline) { handlers.IngestPipeline = p }(handlers.IngestPipeline)
+	handlers.IngestPipeline = p
+	assert.NoError(t, handlers.SetPersistConcurrency(1))
+	defer handlers.SetPersistConcurrency(2)
+
+	resp := handlers.NewScanner(fetcher{}).Run(ctx,
+		handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"a.json", "b.json", "c.json"}, Force: true})
+	assert.Equal(t, handlers.ScanCompleted, resp.Status, resp.Failed)
+	assert.LessOrEqual(t, peak, int64(150))
+	assert.Positive(t, peak)
+	used, waiting = handlers.IngestBudget.Stats()
+	assert.Zero(t, used)
+	assert.Zero(t, waiting)
+}
+
+// TestConcurrentScansBudget tests that concurrent scans never hold more
+// downloaded content than the ingest budget, whether or not its size is
+// known before the download, and that a file larger than the whole budget
+// fails
+func TestConcurrentScansBudget(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "large.json":
+			w.Write([]byte(strings.Repeat("x", 200)))
+		case "chunked.json":
+			// Flushing before the end leaves the size unknown
+			w.Write([]byte(strings.Repeat("x", 30)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("x", 30)))
+		default:
+			w.Write([]byte(strings.Repeat("x", 60)))
+		}
+	}))
+	defer server.Close()
+
+	defer func(b *pipeline.Budget) { handlers.IngestBudget = b }(handlers.IngestBudget)
+	handlers.IngestBudget = pipeline.NewBudget(150)
+	var held, peak atomic.Int64
+	p := pipeline.New()
+	p.Add(pipeline.Fetch, func(ctx context.Context, in *pipeline.Ingest) (err error) {
+		if in.Content, err = in.Source(ctx); err == nil {
+			n := held.Add(int64(len(in.Content)))
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+		}
+		return err
+	})
+	p.Add(pipeline.Persist, func(ctx context.Context, in *pipeline.Ingest) error {
+		time.Sleep(5 * time.Millisecond)
+		held.Add(-int64(len(in.Content)))
+		return nil
+	})
+	defer func(p *pipeline.Pipeline) { handlers.IngestPipeline = p }(handlers.IngestPipeline)
+	handlers.IngestPipeline = p
+
+	scanner := handlers.NewScanner(&github.RawFetcher{HTTP: server.Client(), Hosts: map[string]string{"github.com": server.URL}})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := scanner.Run(context.Background(), handlers.ScanRequest{Repo: "https://github.com/acme/api", Ref: "main",
+				Files: []string{"a.json", "b.json", "chunked.json", "large.json"}, Force: true})
+			assert.ElementsMatch(t, []string{"a.json", "b.json", "chunked.json"}, resp.Success)
+			if assert.Len(t, resp.Failed, 1) {
+				assert.Equal(t, "large.json", resp.Failed[0].File)
+				assert.Equal(t, handlers.FailureFetch, resp.Failed[0].Category)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak.Load(), int64(150))
+	assert.Positive(t, peak.Load())
+	used, waiting := handlers.IngestBudget.Stats()
+	assert.Zero(t, used)
+	assert.Zero(t, waiting)
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/kev"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/policy"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const catalog = `{
+  "title": "CISA Catalog of Known Exploited Vulnerabilities",
+  "catalogVersion": "2024.03.01",
+  "dateReleased": "2024-03-01T17:00:00.000Z",
+  "count": 1,
+  "vulnerabilities": [
+    {"cveID": "CVE-2021-44228", "vendorProject": "Apache", "product": "Log4j2",
+     "vulnerabilityName": "Apache Log4j2 Remote Code Execution Vulnerability",
+     "dateAdded": "2021-12-10", "dueDate": "2021-12-24", "knownRansomwareCampaignUse": "Known"}
+  ]
+}`
+
+func evaluate(t *testing.T, req handlers.PolicyEvaluateRequest) (int, policy.Result) {
+	body, _ := json.Marshal(req)
+	rr := httptest.NewRecorder()
+	handlers.PolicyHandler(rr, httptest.NewRequest(http.MethodPost, "/policy/evaluate", bytes.NewReader(body)))
+	var res policy.Result
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	return rr.Code, res
+}
+
+// TestEvaluate tests the default policy, inline rules, and the KEV catalog
+func TestEvaluate(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	c, err := kev.Parse(strings.NewReader(catalog))
+	assert.NoError(t, err)
+	n, err := kev.Store(ctx, db, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"repo-a", "trivy.json", time.Now(), "s", time.Now())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2021-44228", Severity: "MEDIUM", CVSS: 6.0, PackageName: "log4j-core", FixedVersion: "2.17.1"},
+		{CVEID: "CVE-2024-0002", Severity: "HIGH", CVSS: 7.5, PackageName: "curl"},
+		{CVEID: "CVE-2024-0003", Severity: "HIGH", CVSS: 8.1, PackageName: "zlib", FixedVersion: "1.3.1"},
+	} {
+		v.RiskFactors = models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+	}
+
+	// The default policy fails on the KEV-listed finding only
+	code, result := evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-a"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, result.Passed)
+	assert.Equal(t, "default", result.Policy)
+	assert.Equal(t, 3, result.Findings)
+	if assert.Len(t, result.Violations, 1) {
+		v := result.Violations[0]
+		assert.Equal(t, "no-kev", v.Rule)
+		assert.Equal(t, 1, v.Count)
+		assert.Equal(t, "CVE-2021-44228", v.Findings[0].CVEID)
+		assert.True(t, v.Findings[0].KEV)
+	}
+
+	// Closing the finding in triage clears the violation
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = 'wont_fix' WHERE cve_id = 'CVE-2021-44228'")
+	assert.NoError(t, err)
+	_, result = evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-a"})
+	assert.True(t, result.Passed)
+	assert.Empty(t, result.Violations)
+
+	// Inline rules
+	_, result = evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-a", Rules: []policy.Rule{
+		{Name: "no-fixable-high", Severities: []string{"high"}, Fixable: true},
+		{Name: "cvss-8", MinCVSS: 8, Max: 1},
+	}})
+	assert.Equal(t, "inline", result.Policy)
+	if assert.Len(t, result.Violations, 1) {
+		assert.Equal(t, "no-fixable-high", result.Violations[0].Rule)
+		assert.Equal(t, "CVE-2024-0003", result.Violations[0].Findings[0].CVEID)
+	}
+
+	// Unknown policies and malformed rules are rejected
+	code, _ = evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-a", Policy: "strict"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-a", Rules: []policy.Rule{{Name: "x", Max: -1}}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = evaluate(t, handlers.PolicyEvaluateRequest{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Unscanned repositories have nothing to violate
+	_, result = evaluate(t, handlers.PolicyEvaluateRequest{Repo: "repo-b"})
+	assert.True(t, result.Passed)
+	assert.Equal(t, 0, result.Findings)
+}
@@ -0,0 +1,113 @@
+package purl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/purl"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestBuild tests deriving package URLs from ecosystem, name, and version
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		ecosystem, name, version, want string
+	}{
+		{"Alpine", "openssl", "1.1.1t-r0", "pkg:apk/alpine/openssl@1.1.1t-r0"},
+		{"Debian", "libssl1.1", "1.1.1n-0+deb11u4", "pkg:deb/debian/libssl1.1@1.1.1n-0%2Bdeb11u4"},
+		{"npm", "@babel/core", "7.0.0", "pkg:npm/%40babel/core@7.0.0"},
+		{"PyPI", "Django_REST.framework", "3.14.0", "pkg:pypi/django-rest-framework@3.14.0"},
+		{"Go", "golang.org/x/net", "v0.1.0", "pkg:golang/golang.org/x/net@v0.1.0"},
+		{"Maven", "org.apache.logging.log4j:log4j-core", "2.14.1", "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"},
+		{"", "OpenSSL", "1.1.1", "pkg:generic/openssl@1.1.1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, purl.Build(tt.ecosystem, tt.name, tt.version), tt.name)
+	}
+}
+
+// TestNormalize tests that equivalent package URLs from different scanners compare equal
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"pkg:APK/alpine/openssl@1.1.1t-r0?arch=x86_64&distro=3.17": "pkg:apk/alpine/openssl@1.1.1t-r0",
+		"pkg:alpine/openssl@1.1.1t-r0":                              "pkg:apk/openssl@1.1.1t-r0",
+		"pkg:npm/%40babel/core@7.0.0":                               "pkg:npm/%40babel/core@7.0.0",
+		"pkg:npm/@babel/Core@7.0.0#lib":                             "pkg:npm/%40babel/core@7.0.0",
+		"pkg:pypi/Django_REST_framework@3.14.0":                     "pkg:pypi/django-rest-framework@3.14.0",
+		"pkg:golang/github.com/Masterminds/semver@v1.5.0":           "pkg:golang/github.com/Masterminds/semver@v1.5.0",
+		"not-a-purl":                                                "not-a-purl",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, purl.Normalize(in), in)
+	}
+
+	// Derived and scanner-reported URLs agree
+	assert.Equal(t, purl.Build("npm", "@babel/core", "7.0.0"), purl.Normalize("pkg:npm/@babel/core@7.0.0"))
+}
+
+// TestClass tests telling operating system packages from application dependencies
+func TestClass(t *testing.T) {
+	tests := map[string]string{
+		"pkg:apk/alpine/openssl@3.0.0":     purl.ClassOS,
+		"pkg:deb/debian/libssl1.1@1.1.1n":  purl.ClassOS,
+		"pkg:RPM/redhat/openssl@1.1.1k":    purl.ClassOS,
+		"pkg:npm/%40babel/core@7.0.0":      purl.ClassApplication,
+		"pkg:golang/golang.org/x/net@v0.1": purl.ClassApplication,
+		"pkg:generic/openssl@1.1.1":        "",
+		"openssl":                          "",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, purl.Class(in), in)
+	}
+}
+
+// TestQueryByPURL tests that findings from different scanners match on normalized purl
+func TestQueryByPURL(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ctx := context.Background()
+	findings := []models.Vulnerability{
+		// Reported with a purl by one scanner, with an ecosystem by another
+		{CVEID: "CVE-2023-0286", Severity: "HIGH", PackageName: "openssl", CurrentVersion: "1.1.1t-r0",
+			PURL: "pkg:apk/alpine/openssl@1.1.1t-r0?arch=x86_64"},
+		{CVEID: "CVE-2023-0286", Severity: "HIGH", PackageName: "openssl", CurrentVersion: "1.1.1t-r0",
+			Ecosystem: "Alpine"},
+		{CVEID: "CVE-2023-0465", Severity: "MEDIUM", PackageName: "openssl", CurrentVersion: "1.1.1s-r0",
+			Ecosystem: "Alpine"},
+	}
+	for _, f := range findings {
+		f.PublishedDate = time.Now()
+		f.RiskFactors = models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(ctx, db, 1, f))
+	}
+
+	vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{PURL: "pkg:apk/alpine/OpenSSL@1.1.1t-r0", Dedup: handlers.DedupOff})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 2) {
+		for _, v := range vulns {
+			assert.Equal(t, "pkg:apk/alpine/openssl@1.1.1t-r0", v.PURL)
+			assert.Equal(t, "Alpine", v.Ecosystem)
+		}
+	}
+
+	// Without a version, every version of the package matches
+	vulns, err = handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{PURL: "pkg:apk/alpine/openssl", Dedup: handlers.DedupOff})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 3)
+}
@@ -0,0 +1,115 @@
+package pushgateway
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/pushgateway"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// TestPush tests that a summary replaces its repository and ref group,
+// with a count of every severity
+func TestPush(t *testing.T) {
+	var method, path, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c, err := pushgateway.New(srv.URL+"/", "ci")
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = c.Push(context.Background(), pushgateway.Summary{
+		Repo: "https://github.com/acme/api", Ref: "release/1.2", Status: "partial",
+		BySeverity: map[string]int{"CRITICAL": 2, "high": 1, "": 3, "INFO": 1},
+		Succeeded:  2, Failed: 1, Time: time.Unix(1714550400, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPut, method)
+	b64 := base64.RawURLEncoding.EncodeToString
+	assert.Equal(t, "/metrics/job/ci/repo@base64/"+b64([]byte("https://github.com/acme/api"))+"/ref@base64/"+b64([]byte("release/1.2")), path)
+	for _, line := range []string{
+		`vulnscan_scan_open_findings{severity="CRITICAL"} 2`,
+		`vulnscan_scan_open_findings{severity="HIGH"} 1`,
+		`vulnscan_scan_open_findings{severity="MEDIUM"} 0`,
+		`vulnscan_scan_open_findings{severity="UNKNOWN"} 4`,
+		`vulnscan_scan_files{outcome="succeeded"} 2`,
+		`vulnscan_scan_files{outcome="failed"} 1`,
+		`vulnscan_scan_completed 0`,
+		`vulnscan_scan_timestamp_seconds 1714550400`,
+		`# TYPE vulnscan_scan_open_findings gauge`,
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+
+	// An empty ref is encoded as "="
+	assert.NoError(t, c.Push(context.Background(), pushgateway.Summary{Repo: "alpine:3.18"}))
+	assert.True(t, strings.HasSuffix(path, "/ref@base64/="), path)
+
+	status = http.StatusBadRequest
+	assert.ErrorContains(t, c.Push(context.Background(), pushgateway.Summary{Repo: "r"}), "HTTP status 400")
+
+	_, err = pushgateway.New("pushgateway:9091", "ci")
+	assert.Error(t, err)
+	_, err = pushgateway.New("http://pushgateway:9091", "")
+	assert.Error(t, err)
+}
+
+// TestScanHook tests that hooks are called after a scan with its ref and
+// outcome, once its findings are stored
+func TestScanHook(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	scanner := handlers.NewScanner(fetcher{
+		"report.json": `{"scanResults":{"scan_id":"s","vulnerabilities":[
+			{"id":"CVE-1","severity":"CRITICAL","package_name":"openssl"},
+			{"id":"CVE-2","severity":"low","package_name":"zlib"},
+			{"id":"CVE-3","severity":"LOW","package_name":"curl"}]}}`,
+		"broken.json": `{`,
+	})
+	var calls []map[string]int
+	scanner.AddHook(func(ctx context.Context, req handlers.ScanRequest, resp handlers.ScanResponse) {
+		assert.Equal(t, "v1.2.0", req.Ref)
+		assert.Equal(t, handlers.ScanPartial, resp.Status)
+		counts, err := storage.OpenFindingCounts(ctx, storage.DB, req.Repo)
+		assert.NoError(t, err)
+		calls = append(calls, counts)
+	})
+	scanner.Run(context.Background(), handlers.ScanRequest{Repo: "https://github.com/acme/api", Ref: "v1.2.0",
+		Files: []string{"report.json", "broken.json"}})
+	assert.Equal(t, []map[string]int{{"CRITICAL": 1, "LOW": 2}}, calls)
+}
@@ -0,0 +1,142 @@
+package queries
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/export"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// request sends a request through the saved query routes and returns the
+// recorded response
+func request(method, target, body, accept string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queries", handlers.SavedQueriesHandler)
+	mux.HandleFunc("/queries/{name}", handlers.SavedQueryHandler)
+	mux.HandleFunc("/queries/{name}/run", handlers.RunSavedQueryHandler)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestSavedQueries tests saving, listing, running, and deleting named
+// queries
+func TestSavedQueries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	scanner := handlers.NewScanner(fetcher{
+		"trivy.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[
+			{"id":"CVE-2024-0001","severity":"CRITICAL","package_name":"openssl","fixed_version":"3.0.8"},
+			{"id":"CVE-2024-0002","severity":"LOW","package_name":"zlib"}]}}`,
+	})
+	resp := scanner.Run(context.Background(), handlers.ScanRequest{
+		Repo: "https://github.com/acme/api", Files: []string{"trivy.json"}, Labels: map[string]string{"env": "prod"},
+	})
+	assert.Equal(t, []string{"trivy.json"}, resp.Success)
+
+	rr := request(http.MethodPost, "/queries", `{"name": "prod-critical", "description": "Critical findings in production",
+		"filters": {"severity": "CRITICAL", "labels": {"env": "prod"}}, "columns": ["id", "package_name"]}`, "")
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Equal(t, "/queries/prod-critical", rr.Header().Get("Location"))
+	var saved handlers.SavedQuery
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &saved))
+	assert.False(t, saved.CreatedAt.IsZero())
+
+	// Saving again under the same name replaces the query
+	rr = request(http.MethodPost, "/queries", `{"name": "prod-critical",
+		"filters": {"severity": "CRITICAL", "labels": {"env": "prod"}}, "columns": ["id", "package_name", "fixed_version"]}`, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = request(http.MethodPost, "/queries", `{"name": "low", "filters": {"severity": "LOW"}}`, "")
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	rr = request(http.MethodGet, "/queries", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var queries []handlers.SavedQuery
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &queries))
+	if assert.Len(t, queries, 2) {
+		assert.Equal(t, "low", queries[0].Name)
+		assert.Equal(t, "prod-critical", queries[1].Name)
+		assert.Empty(t, queries[1].Description)
+		assert.Equal(t, []string{"id", "package_name", "fixed_version"}, queries[1].Columns)
+		assert.Equal(t, map[string]string{"env": "prod"}, queries[1].Filters.Labels)
+	}
+
+	rr = request(http.MethodGet, "/queries/prod-critical", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &saved))
+	assert.Equal(t, "CRITICAL", saved.Filters.Severity)
+
+	// Running returns the current matches, as JSON or with the saved columns
+	rr = request(http.MethodGet, "/queries/prod-critical/run", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var vulns []models.Vulnerability
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &vulns))
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2024-0001", vulns[0].CVEID)
+	}
+	rr = request(http.MethodGet, "/queries/prod-critical/run", "", export.CSVMediaType)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ID,Package,Fixed Version\nCVE-2024-0001,openssl,3.0.8\n", strings.ReplaceAll(rr.Body.String(), "\r\n", "\n"))
+
+	for _, body := range []string{
+		`{"filters": {"severity": "LOW"}}`,
+		`{"name": "-bad", "filters": {"severity": "LOW"}}`,
+		`{"name": "a/b", "filters": {"severity": "LOW"}}`,
+		`{"name": "empty", "filters": {}}`,
+		`{"name": "cols", "filters": {"severity": "LOW"}, "columns": ["nope"]}`,
+		`not json`,
+	} {
+		rr = request(http.MethodPost, "/queries", body, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+
+	rr = request(http.MethodDelete, "/queries/low", "", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	for _, target := range []string{"/queries/low", "/queries/low/run"} {
+		rr = request(http.MethodGet, target, "", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code, target)
+	}
+	rr = request(http.MethodDelete, "/queries/low", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = request(http.MethodPut, "/queries/prod-critical", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
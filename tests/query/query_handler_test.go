@@ -2,7 +2,9 @@ package query
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -25,33 +27,8 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 		t.Fatal(err)
 	}
 
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS scans (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			repo TEXT,
-			file_path TEXT,
-			scan_time DATETIME,
-			scan_id TEXT,
-			timestamp DATETIME
-		);
-		CREATE TABLE IF NOT EXISTS vulnerabilities (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			scan_id TEXT,
-			cve_id TEXT,
-			severity TEXT,
-			cvss REAL,
-			status TEXT,
-			package_name TEXT,
-			current_version TEXT,
-			fixed_version TEXT,
-			description TEXT,
-			published_date DATETIME,
-			link TEXT,
-			risk_factors TEXT CHECK(json_valid(risk_factors)),
-			FOREIGN KEY(scan_id) REFERENCES scans(id)
-		);
-	`)
-	if err != nil {
+	// Apply the production schema
+	if err := storage.Migrate(db); err != nil {
 		t.Fatal(err)
 	}
 
@@ -77,9 +54,7 @@ func TestQueryHandler(t *testing.T) {
 		{
 			name: "Filter high severity - exact match",
 			queryRequest: handlers.QueryRequest{
-				Filters: struct {
-					Severity string `json:"severity"`
-				}{
+				Filters: handlers.QueryFilters{
 					Severity: "high",
 				},
 			},
@@ -116,9 +91,7 @@ func TestQueryHandler(t *testing.T) {
 		{
 			name: "No matching severity",
 			queryRequest: handlers.QueryRequest{
-				Filters: struct {
-					Severity string `json:"severity"`
-				}{
+				Filters: handlers.QueryFilters{
 					Severity: "extreme",
 				},
 			},
@@ -248,3 +221,492 @@ func clearDatabase(t *testing.T, db *sqlx.DB) {
 	_, err = db.Exec("DELETE FROM scans")
 	assert.NoError(t, err)
 }
+
+// TestQueryDedup tests that occurrences of a vulnerability reported by
+// several scanners in a repository are merged, listing their sources
+func TestQueryDedup(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	// Two scanners report the same finding in one repository, one of them in
+	// a second repository too; the purl spellings differ only in qualifiers
+	for _, s := range []struct {
+		repo, file, source, purl, severity string
+	}{
+		{repoURL, "trivy.json", "trivy", "pkg:apk/alpine/openssl@3.0.0?arch=x86_64", "HIGH"},
+		{repoURL, "grype.json", "native", "pkg:apk/alpine/openssl@3.0.0", "CRITICAL"},
+		{repoURL, "old.json", "", "pkg:apk/alpine/OpenSSL@3.0.0", "HIGH"},
+		{"https://github.com/acme/other", "trivy.json", "trivy", "pkg:apk/alpine/openssl@3.0.0", "HIGH"},
+	} {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, source) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''))",
+			s.repo, s.file, time.Now().UTC(), s.file, time.Now().UTC(), s.source)
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, models.Vulnerability{
+			CVEID: "CVE-2024-0001", Severity: s.severity, PackageName: "openssl", CurrentVersion: "3.0.0",
+			PURL: s.purl, RiskFactors: models.RiskFactors{},
+		}))
+	}
+
+	query := func(filters handlers.QueryFilters) (int, []models.Vulnerability) {
+		body, _ := json.Marshal(handlers.QueryRequest{Filters: filters})
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+		var vulns []models.Vulnerability
+		json.Unmarshal(rr.Body.Bytes(), &vulns)
+		return rr.Code, vulns
+	}
+
+	code, vulns := query(handlers.QueryFilters{ID: "CVE-2024-0001"})
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, vulns, 2) {
+		// The latest occurrence speaks for the merged finding
+		assert.Equal(t, "HIGH", vulns[0].Severity)
+		assert.Equal(t, []string{"native", "old.json", "trivy"}, vulns[0].Sources)
+		assert.Equal(t, []string{"trivy"}, vulns[1].Sources)
+	}
+
+	_, vulns = query(handlers.QueryFilters{ID: "CVE-2024-0001", Dedup: handlers.DedupCVEPackage})
+	assert.Len(t, vulns, 2)
+	_, vulns = query(handlers.QueryFilters{ID: "CVE-2024-0001", Dedup: handlers.DedupOff})
+	if assert.Len(t, vulns, 4) {
+		// The most severe occurrence sorts first
+		assert.Equal(t, "CRITICAL", vulns[0].Severity)
+		assert.Equal(t, []string{"native"}, vulns[0].Sources)
+	}
+
+	defer func(key string) { handlers.DefaultDedupKey = key }(handlers.DefaultDedupKey)
+	handlers.DefaultDedupKey = handlers.DedupOff
+	_, vulns = query(handlers.QueryFilters{ID: "CVE-2024-0001"})
+	assert.Len(t, vulns, 4)
+
+	code, _ = query(handlers.QueryFilters{ID: "CVE-2024-0001", Dedup: "cve"})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestQuerySort tests the default result order and explicit sort keys
+func TestQuerySort(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		repoURL, "trivy.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2024-0004", Severity: "HIGH", CVSS: 7.5, PackageName: "zlib", PublishedDate: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{CVEID: "CVE-2024-0003", Severity: "LOW", CVSS: 2.0, PackageName: "bash", PublishedDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{CVEID: "CVE-2024-0002", Severity: "CRITICAL", CVSS: 9.8, PackageName: "openssl", PublishedDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{CVEID: "CVE-2024-0001", Severity: "HIGH", CVSS: 7.5, PackageName: "curl", PublishedDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{CVEID: "CVE-2024-0005", Severity: "HIGH", CVSS: 8.1, PackageName: "curl", PublishedDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		v.RiskFactors = models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, v))
+	}
+
+	_, err = db.Exec("INSERT INTO scan_labels (scan_id, key, value) VALUES (?, 'team', 'payments')", scanID)
+	assert.NoError(t, err)
+
+	query := func(sort ...string) (int, []string) {
+		body, _ := json.Marshal(handlers.QueryRequest{Filters: handlers.QueryFilters{Labels: map[string]string{"team": "payments"}, Sort: sort}})
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+		var vulns []models.Vulnerability
+		json.Unmarshal(rr.Body.Bytes(), &vulns)
+		var ids []string
+		for _, v := range vulns {
+			ids = append(ids, v.CVEID)
+		}
+		return rr.Code, ids
+	}
+
+	// Most severe first, then highest CVSS, then by identifier
+	code, ids := query()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"CVE-2024-0002", "CVE-2024-0005", "CVE-2024-0001", "CVE-2024-0004", "CVE-2024-0003"}, ids)
+
+	// Explicit keys come first; ties fall back to the default order
+	_, ids = query("package")
+	assert.Equal(t, []string{"CVE-2024-0003", "CVE-2024-0005", "CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0004"}, ids)
+	_, ids = query("-published_date")
+	assert.Equal(t, []string{"CVE-2024-0005", "CVE-2024-0004", "CVE-2024-0002", "CVE-2024-0001", "CVE-2024-0003"}, ids)
+	_, ids = query("cvss", "-cve_id")
+	assert.Equal(t, []string{"CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0001", "CVE-2024-0005", "CVE-2024-0002"}, ids)
+
+	code, _ = query("cvss", "popularity")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestQueryExpr tests filtering by a boolean expression
+func TestQueryExpr(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		repoURL, "trivy.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2024-0001", Severity: "CRITICAL", CVSS: 9.8, PackageName: "openssl", Status: "fixed"},
+		{CVEID: "CVE-2024-0002", Severity: "HIGH", CVSS: 7.5, PackageName: "openssl-libs", Status: "affected"},
+		{CVEID: "CVE-2024-0003", Severity: "MEDIUM", CVSS: 5.3, PackageName: "openssl", Status: "affected"},
+		{CVEID: "CVE-2024-0004", Severity: "CRITICAL", CVSS: 9.1, PackageName: "zlib", Status: "affected"},
+	} {
+		v.RiskFactors = models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, v))
+	}
+
+	query := func(expr string) (int, []string) {
+		body, _ := json.Marshal(handlers.QueryRequest{Filters: handlers.QueryFilters{Expr: expr, Sort: []string{"cve_id"}}})
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+		var vulns []models.Vulnerability
+		json.Unmarshal(rr.Body.Bytes(), &vulns)
+		var ids []string
+		for _, v := range vulns {
+			ids = append(ids, v.CVEID)
+		}
+		return rr.Code, ids
+	}
+
+	for expr, want := range map[string][]string{
+		`severity in (critical,high) AND package_name ~ "openssl*" AND NOT status = "fixed"`: {"CVE-2024-0002"},
+		`(package_name = openssl OR cvss >= 9) AND status != fixed`:                          {"CVE-2024-0003", "CVE-2024-0004"},
+		`severity not in (critical) and package_name !~ "*-libs"`:                            {"CVE-2024-0003"},
+		`epss > 0.5`:         nil, // No finding has a score
+		`NOT epss > 0.5`:     {"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004"},
+		`id = cve-2024-0004`: {"CVE-2024-0004"},
+	} {
+		code, ids := query(expr)
+		assert.Equal(t, http.StatusOK, code, expr)
+		assert.Equal(t, want, ids, expr)
+	}
+
+	// Expressions combine with the other filters
+	body, _ := json.Marshal(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "CRITICAL", Expr: "package_name = zlib"}})
+	rr := httptest.NewRecorder()
+	handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+	var vulns []models.Vulnerability
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &vulns))
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2024-0004", vulns[0].CVEID)
+	}
+
+	code, _ := query(`owner = me`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestQueryLimit tests truncation at the default row limit, explicit
+// limits, and paging with cursors
+func TestQueryLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		repoURL, "trivy.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for _, id := range []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0005"} {
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID,
+			models.Vulnerability{CVEID: id, Severity: "HIGH", PackageName: "zlib", RiskFactors: models.RiskFactors{}}))
+	}
+	defer func(n int) { handlers.QueryMaxRows = n }(handlers.QueryMaxRows)
+	handlers.QueryMaxRows = 3
+
+	query := func(req handlers.QueryRequest, accept string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		r.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, r)
+		return rr
+	}
+	filters := handlers.QueryFilters{Severity: "HIGH"}
+
+	// Without a limit, results are cut at the default into a page that says so
+	rr := query(handlers.QueryRequest{Filters: filters}, "")
+	var cut handlers.QueryPage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &cut))
+	assert.Len(t, cut.Results, 3)
+	assert.True(t, cut.Truncated)
+	assert.Equal(t, "true", rr.Header().Get("X-Truncated"))
+	assert.Equal(t, cut.NextCursor, rr.Header().Get("X-Next-Cursor"))
+
+	// A query the default doesn't cut is a plain list
+	var vulns []models.Vulnerability
+	rr = query(handlers.QueryRequest{Filters: handlers.QueryFilters{ID: "CVE-2024-0001"}}, "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &vulns))
+	assert.Len(t, vulns, 1)
+	assert.Empty(t, rr.Header().Get("X-Truncated"))
+
+	// Pages of an explicit limit cover every result once
+	var ids []string
+	req := handlers.QueryRequest{Filters: filters, Limit: 2}
+	for pages := 0; ; pages++ {
+		rr = query(req, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page handlers.QueryPage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		for _, v := range page.Results {
+			ids = append(ids, v.CVEID)
+		}
+		if !page.Truncated || pages > 3 {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0005"}, ids)
+
+	// A limit above the default is honored
+	var page handlers.QueryPage
+	assert.NoError(t, json.Unmarshal(query(handlers.QueryRequest{Filters: filters, Limit: 10}, "").Body.Bytes(), &page))
+	assert.Len(t, page.Results, 5)
+	assert.False(t, page.Truncated)
+
+	// Spreadsheet exports stay complete
+	rr = query(handlers.QueryRequest{Filters: filters}, "text/csv")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("X-Truncated"))
+	assert.Len(t, bytes.Split(bytes.TrimSpace(rr.Body.Bytes()), []byte("\n")), 6)
+
+	// A cursor only continues the filters it was issued for
+	assert.Equal(t, http.StatusBadRequest, query(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "LOW"}, Cursor: req.Cursor}, "").Code)
+	assert.Equal(t, http.StatusBadRequest, query(handlers.QueryRequest{Filters: filters, Cursor: "not a cursor"}, "").Code)
+	assert.Equal(t, http.StatusBadRequest, query(handlers.QueryRequest{Filters: filters, Limit: -1}, "").Code)
+
+	// A page continues after the previous page's last result, so findings
+	// stored in between don't repeat results
+	var first, next handlers.QueryPage
+	assert.NoError(t, json.Unmarshal(query(handlers.QueryRequest{Filters: filters, Limit: 2}, "").Body.Bytes(), &first))
+	assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID,
+		models.Vulnerability{CVEID: "CVE-2024-0000", Severity: "HIGH", PackageName: "zlib", RiskFactors: models.RiskFactors{}}))
+	assert.NoError(t, json.Unmarshal(query(handlers.QueryRequest{Filters: filters, Limit: 2, Cursor: first.NextCursor}, "").Body.Bytes(), &next))
+	if assert.Len(t, next.Results, 2) {
+		assert.Equal(t, "CVE-2024-0003", next.Results[0].CVEID)
+	}
+}
+
+// TestQueryPageOrder tests that pages follow every sort key, including
+// descending and tied ones, and results a VEX status filter drops
+func TestQueryPageOrder(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+		repoURL, "trivy.json", time.Now().UTC(), "scan-1", time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	for i, f := range []struct {
+		severity string
+		cvss     float64
+	}{{"LOW", 2.5}, {"CRITICAL", 9.8}, {"HIGH", 7.5}, {"HIGH", 7.5}, {"HIGH", 8.1}, {"MEDIUM", 5.3}, {"CRITICAL", 9.8}} {
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, models.Vulnerability{
+			CVEID: fmt.Sprintf("CVE-2024-%04d", i+1), Severity: f.severity, CVSS: f.cvss,
+			PackageName: "zlib", PURL: "pkg:apk/alpine/zlib@1.3", RiskFactors: models.RiskFactors{}}))
+	}
+	_, err = db.Exec(`INSERT INTO vex_statements (vuln_id, product, status, timestamp) VALUES
+		('CVE-2024-0002', 'pkg:apk/alpine/zlib', 'not_affected', ?), ('CVE-2024-0005', 'pkg:apk/alpine/zlib', 'not_affected', ?)`,
+		time.Now().UTC(), time.Now().UTC())
+	assert.NoError(t, err)
+	defer db.Exec("DELETE FROM vex_statements")
+
+	pages := func(filters handlers.QueryFilters, limit int) []string {
+		var ids []string
+		req := handlers.QueryRequest{Filters: filters, Limit: limit}
+		for range 10 {
+			body, _ := json.Marshal(req)
+			rr := httptest.NewRecorder()
+			handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+			var page handlers.QueryPage
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+			assert.LessOrEqual(t, len(page.Results), limit)
+			for _, v := range page.Results {
+				ids = append(ids, v.CVEID)
+			}
+			if !page.Truncated {
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		return ids
+	}
+	all := handlers.QueryFilters{Expr: `package_name = "zlib"`}
+	for _, limit := range []int{1, 2, 3} {
+		assert.Equal(t, []string{"CVE-2024-0002", "CVE-2024-0007", "CVE-2024-0005", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0006", "CVE-2024-0001"},
+			pages(all, limit), "limit %d", limit)
+		all.Sort = []string{"cvss", "-cve_id"}
+		assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0006", "CVE-2024-0004", "CVE-2024-0003", "CVE-2024-0005", "CVE-2024-0007", "CVE-2024-0002"},
+			pages(all, limit), "limit %d", limit)
+		all.Sort = nil
+
+		vex := all
+		vex.VEXStatus = "none"
+		assert.Equal(t, []string{"CVE-2024-0007", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0006", "CVE-2024-0001"},
+			pages(vex, limit), "limit %d", limit)
+	}
+}
+
+func TestQueryCount(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	// One finding reported twice in one repository and once in another
+	for _, s := range []struct{ repo, file, purl string }{
+		{repoURL, "trivy.json", "pkg:apk/alpine/openssl@3.0.0?arch=x86_64"},
+		{repoURL, "grype.json", "pkg:apk/alpine/openssl@3.0.0"},
+		{"https://github.com/acme/other", "trivy.json", "pkg:apk/alpine/openssl@3.0.0"},
+	} {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			s.repo, s.file, time.Now().UTC(), s.file, time.Now().UTC())
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, models.Vulnerability{
+			CVEID: "CVE-2024-0001", Severity: "HIGH", PackageName: "OpenSSL", CurrentVersion: "3.0.0",
+			PURL: s.purl, RiskFactors: models.RiskFactors{},
+		}))
+	}
+
+	query := func(req handlers.QueryRequest) (int, map[string]any) {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handlers.QueryHandler(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	// Counts agree with the results a full query returns
+	for dedup, want := range map[string]float64{
+		"":                       2,
+		handlers.DedupCVEPURL:    2,
+		handlers.DedupCVEPackage: 2,
+		handlers.DedupOff:        3,
+	} {
+		code, resp := query(handlers.QueryRequest{
+			Filters: handlers.QueryFilters{Severity: "HIGH", Dedup: dedup}, CountOnly: true,
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]any{"count": want}, resp, dedup)
+	}
+	_, resp := query(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "LOW"}, CountOnly: true})
+	assert.Equal(t, map[string]any{"count": 0.0}, resp)
+	_, resp = query(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "HIGH", VEXStatus: "none"}, CountOnly: true})
+	assert.Equal(t, map[string]any{"count": 2.0}, resp)
+
+	_, resp = query(handlers.QueryRequest{Filters: handlers.QueryFilters{Expr: `package_name = openssl`}, ExistsOnly: true})
+	assert.Equal(t, map[string]any{"exists": true}, resp)
+	_, resp = query(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "LOW"}, ExistsOnly: true})
+	assert.Equal(t, map[string]any{"exists": false}, resp)
+
+	code, _ := query(handlers.QueryRequest{Filters: handlers.QueryFilters{Severity: "HIGH"}, CountOnly: true, ExistsOnly: true})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestQueryPackageClass(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	// A container image scan reports an OS package and an application
+	// dependency; a manifest scan reports a dependency without an ecosystem
+	res, err := db.Exec(`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, resource_type, resource_name)
+		VALUES (?, 'image.json', ?, 'image', ?, 'container_image', 'acme/api:1.0')`, repoURL, time.Now().UTC(), time.Now().UTC())
+	assert.NoError(t, err)
+	imageScan, _ := res.LastInsertId()
+	res, err = db.Exec(`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp, resource_type)
+		VALUES (?, 'deps.json', ?, 'deps', ?, 'manifest')`, repoURL, time.Now().UTC(), time.Now().UTC())
+	assert.NoError(t, err)
+	manifestScan, _ := res.LastInsertId()
+	for _, v := range []struct {
+		scan int64
+		vuln models.Vulnerability
+	}{
+		{imageScan, models.Vulnerability{CVEID: "CVE-2024-0001", PackageName: "openssl", CurrentVersion: "3.0.0", Ecosystem: "Alpine"}},
+		{imageScan, models.Vulnerability{CVEID: "CVE-2024-0002", PURL: "pkg:npm/lodash@4.17.20"}},
+		{manifestScan, models.Vulnerability{CVEID: "CVE-2024-0003", PackageName: "internal-lib", CurrentVersion: "1.0"}},
+	} {
+		v.vuln.Severity, v.vuln.RiskFactors = "HIGH", models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, v.scan, v.vuln))
+	}
+
+	ids := func(filters handlers.QueryFilters) []string {
+		filters.Severity = "HIGH"
+		vulns, err := handlers.QueryVulnerabilities(context.Background(), filters)
+		assert.NoError(t, err)
+		var ids []string
+		for _, v := range vulns {
+			ids = append(ids, v.CVEID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"CVE-2024-0001"}, ids(handlers.QueryFilters{PackageClass: "os"}))
+	assert.Equal(t, []string{"CVE-2024-0002"}, ids(handlers.QueryFilters{PackageClass: "application"}))
+	assert.Equal(t, []string{"CVE-2024-0001"}, ids(handlers.QueryFilters{Ecosystem: "alpine"}))
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002"}, ids(handlers.QueryFilters{ResourceType: "container_image"}))
+	assert.Equal(t, []string{"CVE-2024-0003"}, ids(handlers.QueryFilters{Expr: `resource_type = manifest AND package_class = ""`}))
+	assert.Equal(t, []string{"CVE-2024-0002"}, ids(handlers.QueryFilters{Expr: `resource_name ~ "acme/*" AND NOT package_class = os`}))
+
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{ID: "CVE-2024-0001"})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "os", vulns[0].PackageClass)
+	}
+	assert.Error(t, handlers.ValidateQueryFilters(handlers.QueryFilters{Severity: "HIGH", PackageClass: "kernel"}))
+
+	// Rows stored before classes were recorded are backfilled from their purl
+	_, err = db.Exec(`ALTER TABLE scans DROP COLUMN resource_type; ALTER TABLE scans DROP COLUMN resource_name;
+		ALTER TABLE vulnerabilities DROP COLUMN package_class; ALTER TABLE scans DROP COLUMN scan_status;
+		ALTER TABLE scans DROP COLUMN incomplete; ALTER TABLE vulnerabilities DROP COLUMN raw_json;
+		DROP INDEX idx_scans_tenant; ALTER TABLE scans DROP COLUMN tenant;
+		DROP INDEX idx_vulnerabilities_fingerprint; ALTER TABLE vulnerabilities DROP COLUMN fingerprint;
+		ALTER TABLE vulnerabilities DROP COLUMN location;
+		DROP INDEX idx_scans_ingest_id; ALTER TABLE scans DROP COLUMN ingest_id;
+		DELETE FROM schema_migrations WHERE version >= 27`)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	assert.Equal(t, []string{"CVE-2024-0001"}, ids(handlers.QueryFilters{PackageClass: "os"}))
+	assert.Equal(t, []string{"CVE-2024-0002"}, ids(handlers.QueryFilters{PackageClass: "application"}))
+}
+
+// TestQueryIncludeRaw tests that unrecognized report fields are stored and
+// returned only when a query asks for them
+func TestQueryIncludeRaw(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	clearDatabase(t, db)
+
+	res, err := db.Exec(`INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp)
+		VALUES (?, 'trivy.json', ?, 'a', ?)`, repoURL, time.Now().UTC(), time.Now().UTC())
+	assert.NoError(t, err)
+	scanID, _ := res.LastInsertId()
+	raw := models.RawFields{"Layer": json.RawMessage(`{"DiffID":"sha256:ab"}`)}
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2024-0001", PackageName: "openssl", Raw: raw},
+		{CVEID: "CVE-2024-0002", PackageName: "zlib"},
+	} {
+		v.Severity, v.RiskFactors = "HIGH", models.RiskFactors{}
+		assert.NoError(t, storage.InsertVulnerability(context.Background(), db, scanID, v))
+	}
+
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH"})
+	assert.NoError(t, err)
+	for _, v := range vulns {
+		assert.Nil(t, v.Raw)
+	}
+
+	vulns, err = handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH", IncludeRaw: true, Sort: []string{"cve_id"}})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 2) {
+		assert.Equal(t, raw, vulns[0].Raw)
+		assert.Nil(t, vulns[1].Raw)
+	}
+	body, _ := json.Marshal(vulns[1])
+	assert.NotContains(t, string(body), `"raw"`)
+}
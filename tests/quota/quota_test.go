@@ -0,0 +1,255 @@
+package quota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/csvimport"
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/quota"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const repo = "https://github.com/org/repo"
+
+// reportFetcher serves a report of two vulnerabilities for every file
+type reportFetcher struct{}
+
+// FetchFileContent implements handlers.ContentFetcher
+func (reportFetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(`{"scanResults":{"scan_id":"` + filePath + `","vulnerabilities":[{"id":"CVE-1","severity":"HIGH"},{"id":"CVE-2","severity":"LOW"}]}}`), github.Validators{}, nil
+}
+
+// unchangedFetcher serves report.json, finds every other file unchanged,
+// and fails to fetch missing.json
+type unchangedFetcher struct{}
+
+// FetchFileContent implements handlers.ContentFetcher
+func (unchangedFetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	switch filePath {
+	case "report.json":
+		return reportFetcher{}.FetchFileContent(ctx, repo, ref, filePath, cached)
+	case "missing.json":
+		return nil, github.Validators{}, errors.New("HTTP status 404")
+	}
+	return nil, github.Validators{}, github.ErrNotModified
+}
+
+// setupQuotas migrates an in-memory database and enables quotas on it
+func setupQuotas(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	assert.NoError(t, storage.Migrate(db))
+	storage.DB = db
+
+	q, err := quota.New(quota.Config{
+		Default: quota.Limits{FilesPerDay: 1},
+		Tenants: []quota.TenantConfig{
+			{Name: "payments", APIKeys: []string{"key-payments", "key-payments-ci"}, Limits: quota.Limits{FilesPerDay: 3}},
+			{Name: "search", APIKeys: []string{"key-search"}, Limits: quota.Limits{MaxRows: 3}},
+		},
+	}, db)
+	assert.NoError(t, err)
+	quota.Default = q
+	t.Cleanup(func() { quota.Default = nil })
+	return db
+}
+
+// TestQuotaConfig tests validating tenants and telling them apart by API key
+func TestQuotaConfig(t *testing.T) {
+	for _, cfg := range []quota.Config{
+		{Tenants: []quota.TenantConfig{{Name: "", APIKeys: []string{"a"}}}},
+		{Tenants: []quota.TenantConfig{{Name: "default", APIKeys: []string{"a"}}}},
+		{Tenants: []quota.TenantConfig{{Name: "a"}}},
+		{Tenants: []quota.TenantConfig{{Name: "a", APIKeys: []string{"k"}}, {Name: "b", APIKeys: []string{"k"}}}},
+		{Tenants: []quota.TenantConfig{{Name: "a", APIKeys: []string{"k"}, Limits: quota.Limits{MaxRows: -1}}}},
+	} {
+		_, err := quota.New(cfg, nil)
+		assert.Error(t, err, cfg)
+	}
+
+	q, err := quota.New(quota.Config{Tenants: []quota.TenantConfig{{Name: "payments", APIKeys: []string{"key-payments"}}}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{quota.DefaultTenant, "payments"}, q.Tenants())
+	for header, want := range map[[2]string]string{
+		{"Authorization", "Bearer key-payments"}: "payments",
+		{"X-API-Key", "key-payments"}:            "payments",
+		{"Authorization", "Bearer unknown"}:      quota.DefaultTenant,
+		{"Authorization", "key-payments"}:        quota.DefaultTenant,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/usage", nil)
+		r.Header.Set(header[0], header[1])
+		assert.Equal(t, want, q.Tenant(r), header)
+	}
+
+	var none *quota.Quotas
+	assert.Empty(t, none.Tenant(httptest.NewRequest(http.MethodGet, "/usage", nil)))
+	release, err := none.Reserve(context.Background(), "payments")
+	assert.NoError(t, err)
+	assert.NoError(t, release(context.Background()))
+}
+
+// TestScanQuotas tests that scans past a tenant's daily files or stored
+// rows are refused with 429, and reporting usage
+func TestScanQuotas(t *testing.T) {
+	db := setupQuotas(t)
+	defer db.Close()
+
+	scan := quota.Middleware(handlers.NewScanner(reportFetcher{}).ServeHTTP)
+	post := func(key string, files ...string) (*httptest.ResponseRecorder, handlers.ScanResponse) {
+		body, _ := json.Marshal(handlers.ScanRequest{Repo: repo, Files: files})
+		r := httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+key)
+		rr := httptest.NewRecorder()
+		scan(rr, r)
+		var resp handlers.ScanResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	// Requests for more files than are left are refused up front
+	rr, _ := post("key-payments", "a.json", "b.json", "c.json", "d.json")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, rr.Body.String(), "tenant payments ingested 0 of 3 files today; 4 more requested")
+	wait, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, wait > 0 && wait <= 86400, wait)
+
+	// Keys of one tenant share its quota
+	rr, _ = post("key-payments", "a.json", "b.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr, _ = post("key-payments-ci", "c.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr, _ = post("key-payments", "d.json")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	// Files counted concurrently past the quota fail with category quota
+	_, err = db.Exec("UPDATE quota_usage SET files = 2 WHERE tenant = 'payments'")
+	assert.NoError(t, err)
+	_, err = quota.Default.Reserve(context.Background(), "payments")
+	assert.NoError(t, err)
+	_, err = quota.Default.Reserve(context.Background(), "payments")
+	assert.ErrorIs(t, err, errs.ErrQuotaExceeded)
+	_, ok := errs.RetryAfter(err)
+	assert.True(t, ok)
+
+	// A tenant storing its maximum rows can't ingest more, with no retry hint
+	rr, _ = post("key-search", "a.json", "b.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr, _ = post("key-search", "c.json")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), "stores 4 of 3 rows")
+
+	// Callers without a known key share the default tenant's quota
+	rr, _ = post("", "a.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr, _ = post("unknown", "b.json")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	var tenants []string
+	assert.NoError(t, db.Select(&tenants, "SELECT DISTINCT tenant FROM scans ORDER BY tenant"))
+	assert.Equal(t, []string{"default", "payments", "search"}, tenants)
+
+	r := httptest.NewRequest(http.MethodGet, "/usage", nil)
+	r.Header.Set("X-API-Key", "key-search")
+	rr = httptest.NewRecorder()
+	handlers.UsageHandler(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var usage handlers.QuotaUsage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &usage))
+	assert.Equal(t, "search", usage.Tenant)
+	assert.Equal(t, 2, usage.Files)
+	assert.Equal(t, 4, usage.Rows)
+	assert.Equal(t, 3, usage.MaxRows)
+
+	rr = httptest.NewRecorder()
+	handlers.TenantUsageHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	var usages []handlers.QuotaUsage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &usages))
+	if assert.Len(t, usages, 3) {
+		assert.Equal(t, quota.DefaultTenant, usages[0].Tenant)
+		assert.Equal(t, 1, usages[0].Files)
+		assert.Equal(t, 3, usages[1].Files)
+	}
+
+	quota.Default = nil
+	rr = httptest.NewRecorder()
+	handlers.UsageHandler(rr, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestUnchangedFilesKeepQuota tests that files whose fetch brings nothing
+// to ingest don't count against the daily quota
+func TestUnchangedFilesKeepQuota(t *testing.T) {
+	db := setupQuotas(t)
+	defer db.Close()
+
+	// Files are reserved while they are fetched, so each scan stays within
+	// the quota of 3 files however its fetches overlap
+	scanner := handlers.NewScanner(unchangedFetcher{})
+	ctx := quota.WithTenant(context.Background(), "payments")
+	resp := scanner.Run(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"report.json", "a.json", "missing.json"}})
+	assert.Equal(t, []string{"report.json"}, resp.Success)
+	assert.Len(t, resp.Skipped, 1)
+	assert.Len(t, resp.Failed, 1)
+	resp = scanner.Run(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"a.json", "b.json"}})
+	assert.Len(t, resp.Skipped, 2)
+	assert.Empty(t, resp.Failed)
+
+	usage, err := quota.Default.Usage(context.Background(), "payments")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, usage.Files)
+
+	// A reservation taken back frees its file for another
+	release, err := quota.Default.Reserve(context.Background(), "payments")
+	assert.NoError(t, err)
+	_, err = quota.Default.Reserve(context.Background(), "payments")
+	assert.NoError(t, err)
+	_, err = quota.Default.Reserve(context.Background(), "payments")
+	assert.ErrorIs(t, err, errs.ErrQuotaExceeded)
+	assert.NoError(t, release(context.Background()))
+	_, err = quota.Default.Reserve(context.Background(), "payments")
+	assert.NoError(t, err)
+}
+
+// TestFailedImportKeepsQuota tests that a CSV import whose rows fail to
+// store doesn't count against the daily quota
+func TestFailedImportKeepsQuota(t *testing.T) {
+	db := setupQuotas(t)
+	defer db.Close()
+
+	content := []byte("CVE,Package\nCVE-1,openssl\nCVE-2,zlib\n")
+	rows, err := csvimport.Parse(bytes.NewReader(content), csvimport.Options{Repo: repo, Now: time.Now().UTC()})
+	assert.NoError(t, err)
+
+	_, err = db.Exec(`CREATE TRIGGER reject_zlib BEFORE INSERT ON vulnerabilities WHEN NEW.package_name = 'zlib' BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+	assert.NoError(t, err)
+	ctx := quota.WithTenant(context.Background(), quota.DefaultTenant)
+	_, err = handlers.ImportCSV(ctx, "migration", "findings.csv", content, rows)
+	assert.Error(t, err)
+	usage, err := quota.Default.Usage(context.Background(), quota.DefaultTenant)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, usage.Files)
+
+	// The retried import still fits the default tenant's one file
+	_, err = db.Exec(`DROP TRIGGER reject_zlib`)
+	assert.NoError(t, err)
+	resp, err := handlers.ImportCSV(ctx, "migration", "findings.csv", content, rows)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.Scans)
+}
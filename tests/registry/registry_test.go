@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/notify"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// request sends a request to handler and returns the recorded response
+func request(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos", handlers.ReposHandler)
+	mux.HandleFunc("/repos/scores", handlers.RepoScoresHandler)
+	mux.HandleFunc("/repos/{path...}", handlers.RepoHandler)
+	if handler != nil {
+		mux.HandleFunc("/scan", handler)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rr
+}
+
+// TestRepositoryRegistry tests registering, listing, and removing
+// repositories
+func TestRepositoryRegistry(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rr := request(nil, http.MethodPost, "/repos", `{"url": "https://github.com/acme/api/", "team": "payments",
+		"contact": "#payments-sec", "tier": 1, "patterns": ["*.sarif"], "labels": {"env": "prod"}}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var created models.Repository
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, "https://github.com/acme/api", created.URL)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	// Re-registering updates, keeping the creation time
+	rr = request(nil, http.MethodPost, "/repos", `{"url": "https://github.com/acme/api", "team": "payments", "tier": 2}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = request(nil, http.MethodPost, "/repos", `{"url": "https://github.com/acme/web", "team": "frontend"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var repos []models.Repository
+	rr = request(nil, http.MethodGet, "/repos?team=payments", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &repos))
+	if assert.Len(t, repos, 1) {
+		assert.Equal(t, 2, repos[0].Tier)
+		assert.Empty(t, repos[0].Patterns)
+		assert.Equal(t, created.CreatedAt.Unix(), repos[0].CreatedAt.Unix())
+	}
+
+	rr = request(nil, http.MethodGet, "/repos/github.com/acme/web", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"team":"frontend"`)
+	assert.Equal(t, http.StatusNoContent, request(nil, http.MethodDelete, "/repos/github.com/acme/web", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(nil, http.MethodGet, "/repos/github.com/acme/web", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(nil, http.MethodDelete, "/repos/github.com/acme/web", "").Code)
+
+	for _, body := range []string{
+		`{"url": "github.com/acme/api", "team": "payments"}`,
+		`{"url": "https://github.com/acme/api"}`,
+		`{"url": "https://github.com/acme/api", "team": "payments", "tier": 5}`,
+		`{"url": "https://github.com/acme/api", "team": "payments", "patterns": ["["]}`,
+		`{"url": "https://github.com/acme/api", "team": "payments", "labels": {"bad key": "x"}}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, request(nil, http.MethodPost, "/repos", body).Code, body)
+	}
+}
+
+// TestRepositoryDefaults tests that scans of a registered repository use
+// its default files and labels, and that scores report its owner
+func TestRepositoryDefaults(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := storage.UpsertRepository(context.Background(), db, &models.Repository{
+		URL: "https://github.com/acme/api", Team: "payments", Tier: 1,
+		Files: models.StringList{"trivy.json"}, Labels: models.StringMap{"env": "prod", "team": "payments"},
+	})
+	assert.NoError(t, err)
+
+	scanner := handlers.NewScanner(fetcher{
+		"trivy.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-2024-0001","severity":"HIGH","package_name":"openssl"}]}}`,
+		"other.json": `{"scanResults":{"scan_id":"b","vulnerabilities":[]}}`,
+	})
+	rr := request(scanner.ServeHTTP, http.MethodPost, "/scan", `{"repo": "https://github.com/acme/api"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp handlers.ScanResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"trivy.json"}, resp.Success)
+
+	// Named files and labels take precedence
+	body, _ := json.Marshal(handlers.ScanRequest{Repo: "https://github.com/acme/api", Files: []string{"other.json"}, Labels: map[string]string{"env": "staging"}})
+	rr = request(scanner.ServeHTTP, http.MethodPost, "/scan", string(body))
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"other.json"}, resp.Success)
+
+	var labels []string
+	assert.NoError(t, db.Select(&labels, `SELECT s.file_path || ' ' || l.key || '=' || l.value
+		FROM scan_labels l JOIN scans s ON s.id = l.scan_id ORDER BY s.id, l.key`))
+	assert.Equal(t, []string{"trivy.json env=prod", "trivy.json team=payments", "other.json env=staging", "other.json team=payments"}, labels)
+
+	// Unregistered repositories are scanned as requested
+	rr = request(scanner.ServeHTTP, http.MethodPost, "/scan", `{"repo": "https://github.com/acme/web", "files": ["other.json"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var scores []handlers.RepoScore
+	rr = request(nil, http.MethodGet, "/repos/scores?team=payments", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scores))
+	if assert.Len(t, scores, 1) {
+		assert.Equal(t, "payments", scores[0].Team)
+		assert.Equal(t, 1, scores[0].Tier)
+	}
+	rr = request(nil, http.MethodGet, "/repos/scores", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scores))
+	assert.Len(t, scores, 2)
+}
+
+// capture is a notification channel recording what it is sent
+type capture struct{ msgs *[]notify.Message }
+
+// Send records msg
+func (c capture) Send(ctx context.Context, msg notify.Message) error {
+	*c.msgs = append(*c.msgs, msg)
+	return nil
+}
+
+// TestNotificationOwnership tests routing notifications by owning team
+func TestNotificationOwnership(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := storage.UpsertRepository(context.Background(), db, &models.Repository{
+		URL: "https://github.com/acme/api", Team: "payments", Contact: "#payments-sec",
+	})
+	assert.NoError(t, err)
+
+	var msgs []notify.Message
+	notify.RegisterChannel("capture", func(cfg notify.ChannelConfig, client *http.Client) (notify.Channel, error) {
+		return capture{&msgs}, nil
+	})
+	n, err := notify.New(notify.Config{Channels: []notify.ChannelConfig{
+		{Name: "payments", Type: "capture", Teams: []string{"payments"}},
+	}}, db)
+	assert.NoError(t, err)
+
+	for _, repo := range []string{"https://github.com/acme/api", "https://github.com/acme/web"} {
+		n.Handle(context.Background(), events.Event{
+			Type: events.TypeScanFailed, Repo: repo, Data: handlers.FileError{File: "trivy.json", Error: "parse failed"},
+		})
+	}
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, "https://github.com/acme/api", msgs[0].Repo)
+		assert.Equal(t, "payments", msgs[0].Team)
+		assert.Equal(t, "trivy.json: parse failed\nOwner: payments (#payments-sec)", msgs[0].Text)
+	}
+}
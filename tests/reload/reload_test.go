@@ -0,0 +1,115 @@
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/config"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/jobs"
+)
+
+// TestSettingsFile tests reading settings from CONFIG_FILE over the
+// environment and listing the settings a new file changes
+func TestSettingsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vulnscan.env")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("OSV_RATE_LIMIT", "5")
+
+	assert.NoError(t, os.WriteFile(path, []byte("# Reloaded on SIGHUP\n\nLOG_LEVEL=debug\nSCAN_FILE_CONCURRENCY = 6\nNOTIFY_CONFIG=\"/etc/vulnscan/notify.json\"\n"), 0o600))
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, path, cfg.File)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 5, cfg.OSVRateLimit)
+	assert.Equal(t, 6, cfg.ScanFileConcurrency)
+	assert.Equal(t, 4, cfg.BulkScanConcurrency)
+	assert.Equal(t, "/etc/vulnscan/notify.json", cfg.NotifyConfig)
+
+	assert.NoError(t, os.WriteFile(path, []byte("LOG_LEVEL=debug\nSCAN_FILE_CONCURRENCY=2\nKEV_SYNC_INTERVAL=1h\n"), 0o600))
+	next, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"KEV_SYNC_INTERVAL", "NOTIFY_CONFIG", "SCAN_FILE_CONCURRENCY"}, config.Changed(cfg, next))
+	assert.Empty(t, config.Changed(next, next))
+
+	assert.NoError(t, os.WriteFile(path, []byte("LOG_LEVEL\n"), 0o600))
+	_, err = config.Load()
+	assert.ErrorContains(t, err, ":1: want KEY=VALUE")
+	t.Setenv("CONFIG_FILE", path+".missing")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
+
+// TestReschedule tests changing and pausing the interval of a running job
+func TestReschedule(t *testing.T) {
+	var runs atomic.Int32
+	r := jobs.NewRunner()
+	r.Add(jobs.Job{Name: "tick", Interval: time.Hour, Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+
+	assert.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.True(t, r.Reschedule("tick", 10*time.Millisecond))
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+
+	assert.True(t, r.Reschedule("tick", 0))
+	time.Sleep(30 * time.Millisecond) // Let a run in progress finish
+	paused := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, paused, runs.Load())
+
+	assert.False(t, r.Reschedule("missing", time.Minute))
+}
+
+// TestReloadHandler tests the reload endpoint and validating concurrency
+// limits
+func TestReloadHandler(t *testing.T) {
+	defer func() { handlers.Reloader = nil }()
+
+	post := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handlers.ReloadHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+		return rr
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, post().Code)
+
+	handlers.Reloader = func(context.Context) (handlers.ReloadResponse, error) {
+		return handlers.ReloadResponse{Applied: []string{"LOG_LEVEL"}, RestartRequired: []string{"DATABASE_DSN"}}, nil
+	}
+	rr := post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var res handlers.ReloadResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	assert.Equal(t, []string{"LOG_LEVEL"}, res.Applied)
+	assert.Equal(t, []string{"DATABASE_DSN"}, res.RestartRequired)
+
+	handlers.Reloader = func(context.Context) (handlers.ReloadResponse, error) {
+		return handlers.ReloadResponse{}, errors.New("config: vulnscan.env:3: want KEY=VALUE")
+	}
+	rr = post()
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "vulnscan.env:3")
+
+	rr = httptest.NewRecorder()
+	handlers.ReloadHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	assert.Error(t, handlers.SetConcurrency(0, 4))
+	assert.Error(t, handlers.SetConcurrency(3, 17))
+	assert.NoError(t, handlers.SetConcurrency(3, 4))
+}
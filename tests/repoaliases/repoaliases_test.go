@@ -0,0 +1,197 @@
+package repoaliases
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// request sends a request to handler and returns the recorded response
+func request(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rr
+}
+
+// TestCanonicalRepoURL tests that the common forms of a repository URL
+// map to one
+func TestCanonicalRepoURL(t *testing.T) {
+	for _, repo := range []string{
+		"https://github.com/acme/api",
+		"https://github.com/acme/api/",
+		"https://github.com/acme/api.git",
+		"HTTPS://GitHub.com/acme/api",
+		"github.com/acme/api",
+		"github.com/acme/api/",
+		"git@github.com:acme/api.git",
+		"ssh://git@github.com/acme/api.git",
+		"git://github.com/acme/api",
+		" https://github.com/acme/api.GIT/ ",
+	} {
+		assert.Equal(t, "https://github.com/acme/api", github.CanonicalRepoURL(repo), repo)
+	}
+
+	// The path keeps its case, plain http stays, and anything else is left
+	assert.Equal(t, "https://github.com/Acme/API", github.CanonicalRepoURL("github.com/Acme/API"))
+	assert.Equal(t, "http://git.internal/acme/api", github.CanonicalRepoURL("http://git.internal/acme/api/"))
+	for _, other := range []string{"repo-a", "nginx:1.25", "ghcr.io/acme/api:1.0", "ftp://example.com/acme/api.git", ""} {
+		assert.Equal(t, other, github.CanonicalRepoURL(other))
+	}
+}
+
+// TestRepoAliasMigration tests that repositories stored in several forms
+// before canonicalization are merged under one URL
+func TestRepoAliasMigration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`DROP TABLE repo_aliases;
+		DROP INDEX idx_vulnerabilities_fingerprint; ALTER TABLE vulnerabilities DROP COLUMN fingerprint;
+		ALTER TABLE vulnerabilities DROP COLUMN location;
+		DROP INDEX idx_scans_ingest_id; ALTER TABLE scans DROP COLUMN ingest_id;
+		DELETE FROM schema_migrations WHERE version >= 33`)
+	assert.NoError(t, err)
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	scans := [][2]string{
+		{"git@github.com:acme/api.git", "a.json"},
+		{"https://github.com/acme/api", "b.json"},
+		{"HTTPS://GitHub.com/acme/api/", "c.json"},
+		{"github.com/acme/web/", "d.json"},
+		{"ghcr.io/acme/api:1.0", "ghcr.io/acme/api:1.0"},
+	}
+	for i, s := range scans {
+		at := day1.AddDate(0, 0, i)
+		_, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			s[0], s[1], at, "s", at)
+		assert.NoError(t, err)
+	}
+	for _, f := range []struct {
+		repo, pkg, status string
+		day, scan         int
+	}{
+		{"git@github.com:acme/api.git", "openssl", "open", 0, 1},
+		{"https://github.com/acme/api", "openssl", "resolved", 1, 2},
+		{"git@github.com:acme/api.git", "zlib", "open", 0, 1},
+		{"github.com/acme/web/", "openssl", "open", 3, 4},
+	} {
+		at := day1.AddDate(0, 0, f.day)
+		_, err := db.Exec(`INSERT INTO findings (repo, package_name, cve_id, severity, status, first_seen, last_seen, last_scan_id)
+			VALUES (?, ?, 'CVE-2024-0001', 'HIGH', ?, ?, ?, ?)`, f.repo, f.pkg, f.status, at, at, f.scan)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, storage.Migrate(db))
+
+	// SQL and Go agree on the canonical form of every alias
+	aliases, err := storage.ListRepoAliases(context.Background(), db, "")
+	assert.NoError(t, err)
+	assert.Len(t, aliases, 3)
+	for _, a := range aliases {
+		assert.Equal(t, github.CanonicalRepoURL(a.Alias), a.Repo, a.Alias)
+	}
+
+	var repos []string
+	assert.NoError(t, db.Select(&repos, "SELECT DISTINCT repo FROM scans ORDER BY repo"))
+	assert.Equal(t, []string{"ghcr.io/acme/api:1.0", "https://github.com/acme/api", "https://github.com/acme/web"}, repos)
+
+	findings, err := handlers.ListFindings(context.Background(), handlers.FindingFilters{Repo: "https://github.com/acme/api", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, findings, 2) {
+		byPackage := map[string]handlers.Finding{}
+		for _, f := range findings {
+			byPackage[f.PackageName] = f
+		}
+		// First seen in the alias's history, in the state of its latest sighting
+		assert.Equal(t, day1, byPackage["openssl"].FirstSeen.UTC())
+		assert.Equal(t, day1.AddDate(0, 0, 1), byPackage["openssl"].LastSeen.UTC())
+		assert.Equal(t, "resolved", byPackage["openssl"].Status)
+		assert.Equal(t, "open", byPackage["zlib"].Status)
+	}
+}
+
+// TestRepoAliases tests that scans are stored under the canonical URL and
+// that manual aliases move rows and resolve queries
+func TestRepoAliases(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	scanner := handlers.NewScanner(fetcher{
+		"trivy.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[{"id":"CVE-2024-0001","severity":"HIGH","package_name":"openssl"}]}}`,
+	})
+	for _, repo := range []string{"git@github.com:acme/api.git", "github.com/acme/api/", "https://github.com/acme/legacy-api"} {
+		rr := request(scanner.ServeHTTP, http.MethodPost, "/scan", `{"repo": "`+repo+`", "files": ["trivy.json"], "force": true}`)
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var repos []string
+	assert.NoError(t, db.Select(&repos, "SELECT DISTINCT repo FROM scans ORDER BY repo"))
+	assert.Equal(t, []string{"https://github.com/acme/api", "https://github.com/acme/legacy-api"}, repos)
+
+	// A renamed repository's history moves to its new URL
+	rr := request(handlers.RepoAliasesHandler, http.MethodPost, "/admin/repo-aliases",
+		`{"alias": "github.com/acme/legacy-api", "repo": "git@github.com:acme/api.git"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var alias models.RepoAlias
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &alias))
+	assert.Equal(t, "https://github.com/acme/legacy-api", alias.Alias)
+	assert.Equal(t, "https://github.com/acme/api", alias.Repo)
+	assert.NoError(t, db.Select(&repos, "SELECT DISTINCT repo FROM scans ORDER BY repo"))
+	assert.Equal(t, []string{"https://github.com/acme/api"}, repos)
+
+	// Queries by the alias read the repository's findings
+	rr = request(handlers.FindingsHandler, http.MethodGet, "/findings?repo=https://github.com/acme/legacy-api", "")
+	var findings []handlers.Finding
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &findings))
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, "https://github.com/acme/api", findings[0].Repo)
+	}
+
+	// Aliases are listed per repository, can't map a repository to itself,
+	// and can be removed
+	rr = request(handlers.RepoAliasesHandler, http.MethodGet, "/admin/repo-aliases?repo=github.com/acme/api", "")
+	var aliases []models.RepoAlias
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &aliases))
+	assert.Len(t, aliases, 1)
+	rr = request(handlers.RepoAliasesHandler, http.MethodPost, "/admin/repo-aliases",
+		`{"alias": "https://github.com/acme/api", "repo": "https://github.com/acme/legacy-api"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = request(handlers.RepoAliasesHandler, http.MethodPost, "/admin/repo-aliases", `{"alias": "github.com/acme/api/", "repo": "https://github.com/acme/api"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = request(handlers.RepoAliasesHandler, http.MethodDelete, "/admin/repo-aliases?alias=github.com/acme/legacy-api", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = request(handlers.RepoAliasesHandler, http.MethodDelete, "/admin/repo-aliases?alias=github.com/acme/legacy-api", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
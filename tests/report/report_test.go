@@ -0,0 +1,176 @@
+package report
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+const repo = "https://github.com/acme/shop"
+
+// TestReport tests the report data, trend, and rendered HTML
+func TestReport(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(file string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", CVSS: 9.8, PackageName: "openssl",
+		CurrentVersion: "3.0.1", FixedVersion: "3.0.9", Link: "https://nvd.nist.gov/vuln/detail/CVE-2024-0001"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "high", CVSS: 7.5, PackageName: "<curl>"}
+	low := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "LOW", CVSS: 2.0, PackageName: "zlib"}
+
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	scan("api.json", day1, critical, high, low)
+	scan("web.json", day1.Add(time.Hour), low)
+	scan("api.json", day2, critical, low) // high fixed on day 2
+
+	rep, err := handlers.BuildReport(ctx, "github.com/acme/shop", day2.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, repo, rep.Repo)
+	assert.Equal(t, 2, rep.Files)
+	assert.Equal(t, day2, rep.LastScan)
+	assert.Equal(t, map[string]int{"CRITICAL": 1, "LOW": 2}, rep.BySeverity)
+	assert.Equal(t, map[string]int{"open": 3}, rep.ByTriage)
+	assert.Equal(t, 1, rep.Fixable)
+	if assert.Len(t, rep.Findings, 3) {
+		assert.Equal(t, "CVE-2024-0001", rep.Findings[0].CVEID)
+	}
+	if assert.Len(t, rep.Trend, 2) {
+		assert.Equal(t, map[string]int{"CRITICAL": 1, "HIGH": 1, "LOW": 2}, rep.Trend[0].BySeverity)
+		assert.Equal(t, map[string]int{"CRITICAL": 1, "LOW": 2}, rep.Trend[1].BySeverity)
+	}
+	assert.NotEmpty(t, rep.Chart())
+
+	// Rendered through the router, with the repository as the rest of the path
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reports/{repo...}", handlers.ReportHandler)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/github.com/acme/shop", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	body := rr.Body.String()
+	assert.Contains(t, body, "<title>Vulnerability report: https://github.com/acme/shop</title>")
+	assert.Contains(t, body, `<a href="https://nvd.nist.gov/vuln/detail/CVE-2024-0001">CVE-2024-0001</a>`)
+	assert.Contains(t, body, "<svg")
+
+	// Values are escaped
+	scan("web.json", day2, high)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/github.com/acme/shop", nil))
+	assert.Contains(t, rr.Body.String(), "&lt;curl&gt;")
+	assert.NotContains(t, rr.Body.String(), "<curl>")
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/github.com/acme/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestFileHistory tests that a file's ingests are listed with their counts
+// and changes since the ingest before
+func TestFileHistory(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(file string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl", CurrentVersion: "3.0.1"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "HIGH", PackageName: "curl", CurrentVersion: "8.0.0"}
+	low := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "LOW", PackageName: "zlib", CurrentVersion: "1.2.13"}
+	upgraded := critical
+	upgraded.CurrentVersion = "3.0.2"
+
+	day1 := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	scan("image.json", day1, critical, high)
+	scan("other.json", day1, low)
+	// Two scans stored from one ingest are counted together
+	scan("image.json", day1.AddDate(0, 0, 1), critical)
+	scan("image.json", day1.AddDate(0, 0, 1), low)
+	scan("image.json", day1.AddDate(0, 0, 2), upgraded)
+
+	history, err := handlers.QueryFileHistory(ctx, repo, "image.json", 50)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, day1.AddDate(0, 0, 2), history[0].ScanTime)
+		assert.Equal(t, map[string]int{"CRITICAL": 1}, history[0].BySeverity)
+		assert.Equal(t, map[string]int{"LOW": -1}, history[0].Delta)
+		assert.Equal(t, 1, history[0].New)   // openssl 3.0.2
+		assert.Equal(t, 2, history[0].Fixed) // openssl 3.0.1 and zlib
+
+		assert.Len(t, history[1].ScanIDs, 2)
+		assert.Equal(t, 2, history[1].Findings)
+		assert.Equal(t, map[string]int{"HIGH": -1, "LOW": 1}, history[1].Delta)
+		assert.Equal(t, 1, history[1].New)
+		assert.Equal(t, 1, history[1].Fixed)
+
+		assert.Equal(t, map[string]int{"CRITICAL": 1, "HIGH": 1}, history[2].Delta)
+		assert.Equal(t, 2, history[2].New)
+		assert.Zero(t, history[2].Fixed)
+	}
+
+	// A limit still compares the oldest ingest listed with the one before
+	history, err = handlers.QueryFileHistory(ctx, repo, "image.json", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, 2, history[0].Fixed)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/repos/{path...}", handlers.RepoHandler)
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+	rr := get("/repos/github.com/acme/shop/files/image.json/history?limit=2")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"delta":{"LOW":-1}`)
+	assert.Equal(t, http.StatusNotFound, get("/repos/github.com/acme/shop/files/missing.json/history").Code)
+	assert.Equal(t, http.StatusNotFound, get("/repos/github.com/acme/other/files/image.json/history").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/repos/github.com/acme/shop/files/image.json/history?limit=x").Code)
+}
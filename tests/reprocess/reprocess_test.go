@@ -0,0 +1,140 @@
+package reprocess
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// fetcher serves canned reports keyed by file path
+type fetcher map[string]string
+
+// FetchFileContent returns the report of filePath
+func (f fetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	return []byte(f[filePath]), github.Validators{}, nil
+}
+
+// setupTestDB initializes an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	return db
+}
+
+// reprocess posts a request to the reprocess endpoint
+func reprocess(body string) (int, handlers.ReprocessResponse) {
+	rr := httptest.NewRecorder()
+	handlers.ReprocessHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reprocess", strings.NewReader(body)))
+	var resp handlers.ReprocessResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr.Code, resp
+}
+
+// TestReprocess tests storing ingested files and parsing them again in place
+func TestReprocess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	repo := "https://github.com/acme/api"
+
+	scanner := handlers.NewScanner(fetcher{
+		"trivy.json": `{"scanResults":{"scan_id":"a","vulnerabilities":[
+			{"id":"CVE-2024-0001","severity":"CRITICAL","package_name":"openssl","current_version":"3.0.1"},
+			{"id":"CVE-2024-0002","severity":"HIGH","package_name":"curl","current_version":"8.0.0"}]}}`,
+		"old.json": `{"scanResults":{"scan_id":"b","vulnerabilities":[{"id":"CVE-2024-0003","severity":"LOW","package_name":"zlib"}]}}`,
+	})
+	resp := scanner.Run(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"trivy.json"}})
+	assert.Equal(t, []string{"trivy.json"}, resp.Success)
+
+	// A file ingested without keeping its content can't be reprocessed
+	defer func(enc string) { handlers.RawFileEncoding = enc }(handlers.RawFileEncoding)
+	handlers.RawFileEncoding = ""
+	resp = scanner.Run(ctx, handlers.ScanRequest{Repo: repo, Files: []string{"old.json"}})
+	assert.Equal(t, []string{"old.json"}, resp.Success)
+
+	var encoding string
+	assert.NoError(t, db.Get(&encoding, "SELECT encoding FROM raw_files"))
+	assert.Equal(t, storage.RawGzip, encoding)
+
+	// Simulate a parser bug: a wrong severity, a dropped and a spurious finding
+	var openssl, curl int64
+	assert.NoError(t, db.Get(&openssl, "SELECT id FROM vulnerabilities WHERE cve_id = 'CVE-2024-0001'"))
+	assert.NoError(t, db.Get(&curl, "SELECT id FROM vulnerabilities WHERE cve_id = 'CVE-2024-0002'"))
+	status := "acknowledged"
+	assert.NoError(t, handlers.UpdateTriage(ctx, openssl, "alice", handlers.TriageUpdate{Status: &status, Comment: "Upgrade planned"}))
+	_, err := db.Exec(`UPDATE vulnerabilities SET severity = 'UNKNOWN' WHERE id = ?;
+		DELETE FROM vulnerabilities WHERE id = ?;
+		INSERT INTO vulnerabilities (scan_id, cve_id, severity, package_name, risk_factors)
+			SELECT scan_id, 'CVE-0000-0000', 'LOW', 'bogus', '[]' FROM vulnerabilities WHERE id = ?`, openssl, curl, openssl)
+	assert.NoError(t, err)
+
+	// A dry run reports the changes without storing them
+	code, result := reprocess(`{"repo": "https://github.com/acme/api", "dry_run": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 1, result.Reprocessed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, []int{1, 1, 1}, []int{result.Added, result.Updated, result.Removed})
+	var severity string
+	assert.NoError(t, db.Get(&severity, "SELECT severity FROM vulnerabilities WHERE id = ?", openssl))
+	assert.Equal(t, "UNKNOWN", severity)
+
+	code, result = reprocess(`{"all": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, result.Results, 2) {
+		assert.Equal(t, handlers.ReprocessDone, result.Results[0].Status)
+		assert.Equal(t, "trivy.json", result.Results[0].File)
+		assert.Equal(t, "native", result.Results[0].Format)
+		assert.Equal(t, handlers.ReprocessSkipped, result.Results[1].Status)
+		assert.Equal(t, "original content not stored", result.Results[1].Reason)
+	}
+	assert.Equal(t, []int{1, 1, 1}, []int{result.Added, result.Updated, result.Removed})
+
+	// The kept finding has its ID, severity, and triage state; the bug's
+	// effects are gone
+	assert.NoError(t, db.Get(&severity, "SELECT severity FROM vulnerabilities WHERE id = ?", openssl))
+	assert.Equal(t, "CRITICAL", severity)
+	triage, err := handlers.GetTriage(ctx, openssl)
+	assert.NoError(t, err)
+	assert.Equal(t, "acknowledged", triage.Status)
+	assert.Len(t, triage.Comments, 1)
+	var cves []string
+	assert.NoError(t, db.Select(&cves, "SELECT cve_id FROM vulnerabilities ORDER BY cve_id"))
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003"}, cves)
+	var findings int
+	assert.NoError(t, db.Get(&findings, "SELECT COUNT(*) FROM findings WHERE status = 'open'"))
+	assert.Equal(t, 3, findings)
+
+	// Reprocessing unchanged data only rewrites in place
+	var scanID int64
+	assert.NoError(t, db.Get(&scanID, "SELECT id FROM scans WHERE file_path = 'trivy.json'"))
+	body, _ := json.Marshal(handlers.ReprocessRequest{ScanIDs: []int64{scanID}})
+	code, result = reprocess(string(body))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, result.Reprocessed)
+	assert.Equal(t, []int{0, 2, 0}, []int{result.Added, result.Updated, result.Removed})
+
+	code, _ = reprocess(`{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, result = reprocess(`{"repo": "https://github.com/acme/none"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, result.Results)
+}
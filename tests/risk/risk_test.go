@@ -0,0 +1,113 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/risk"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestWeights tests the per-finding points and the 0-100 mapping
+func TestWeights(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	w := risk.Default
+
+	assert.Equal(t, 10.0, w.Points(risk.Finding{Severity: "critical", FirstSeen: now}, now))
+	assert.Equal(t, 0.5, w.Points(risk.Finding{Severity: "whatever"}, now))
+	// EPSS 0.5 adds one multiple, KEV another
+	assert.Equal(t, 15.0, w.Points(risk.Finding{Severity: "HIGH", EPSS: 0.5, KEV: true, FirstSeen: now}, now))
+	// Age grows to one extra multiple at a year, then stops
+	assert.InDelta(t, 3.0, w.Points(risk.Finding{Severity: "MEDIUM", FirstSeen: now.Add(-w.MaxAge / 2)}, now), 1e-9)
+	assert.Equal(t, 4.0, w.Points(risk.Finding{Severity: "MEDIUM", FirstSeen: now.AddDate(-3, 0, 0)}, now))
+
+	assert.Equal(t, 0.0, w.Score(0))
+	assert.Equal(t, 63.2, w.Score(w.Scale))
+	assert.Equal(t, 100.0, w.Score(1e6))
+	assert.Less(t, w.Score(10), w.Score(20))
+}
+
+// TestRepoScores tests the per-repository and ranked score endpoints
+func TestRepoScores(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(repo string, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", time.Now(), "s", time.Now())
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	scan("https://github.com/acme/api",
+		models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"},
+		models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "LOW", PackageName: "zlib"})
+	scan("https://github.com/acme/web", models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "MEDIUM", PackageName: "lodash"})
+	scan("https://github.com/acme/docs")
+	_, err = db.Exec("INSERT INTO kev_catalog (cve_id) VALUES ('CVE-2024-0003')")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO epss_scores (cve_id, epss, percentile, score_date) VALUES ('CVE-2024-0001', 0.5, 0.99, '2024-06-01')")
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/scores", handlers.RepoScoresHandler)
+	mux.HandleFunc("/repos/{path...}", handlers.RepoHandler)
+	get := func(target string, out interface{}) int {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		json.Unmarshal(rr.Body.Bytes(), out)
+		return rr.Code
+	}
+
+	var score handlers.RepoScore
+	assert.Equal(t, http.StatusOK, get("/repos/github.com/acme/api/score", &score))
+	assert.Equal(t, "https://github.com/acme/api", score.Repo)
+	assert.Equal(t, 2, score.Findings)
+	assert.Equal(t, map[string]int{"CRITICAL": 1, "LOW": 1}, score.BySeverity)
+	assert.Equal(t, 0.5, score.MaxEPSS)
+	assert.Equal(t, 0, score.KEV)
+	assert.InDelta(t, 20.5, score.Points, 0.01)
+	assert.Equal(t, risk.Default.Score(20.5), score.Score)
+
+	var scores []handlers.RepoScore
+	assert.Equal(t, http.StatusOK, get("/repos/scores", &scores))
+	if assert.Len(t, scores, 3) {
+		assert.Equal(t, "https://github.com/acme/api", scores[0].Repo)
+		assert.Equal(t, "https://github.com/acme/web", scores[1].Repo)
+		assert.Equal(t, 1, scores[1].KEV)
+		assert.Equal(t, "https://github.com/acme/docs", scores[2].Repo)
+		assert.Equal(t, 0.0, scores[2].Score)
+	}
+
+	// Closed findings no longer count
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = 'resolved' WHERE cve_id = 'CVE-2024-0001'")
+	assert.NoError(t, err)
+	get("/repos/github.com/acme/api/score", &score)
+	assert.Equal(t, 1, score.Findings)
+	assert.InDelta(t, 0.5, score.Points, 0.01)
+
+	assert.Equal(t, http.StatusNotFound, get("/repos/github.com/acme/missing/score", &score))
+	assert.Equal(t, http.StatusNotFound, get("/repos/github.com/acme/api/other", &score))
+}
@@ -0,0 +1,84 @@
+package sarif
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/sarif"
+)
+
+const sarifLog = `{
+  "version": "2.1.0",
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "runs": [{
+    "tool": {"driver": {"name": "grype", "rules": [
+      {"id": "CVE-2024-1234", "helpUri": "https://nvd.nist.gov/vuln/detail/CVE-2024-1234",
+       "properties": {"security-severity": "9.8", "tags": ["Remote Code Execution"]}},
+      {"id": "GHSA-xxxx"}
+    ]}},
+    "invocations": [{"executionSuccessful": true, "endTimeUtc": "2024-03-01T10:00:00Z"}],
+    "results": [
+      {"ruleId": "CVE-2024-1234", "level": "error", "message": {"text": "openssl buffer overflow"},
+       "properties": {"packageName": "openssl", "installedVersion": "1.1.1t", "fixedVersion": "1.1.1u"}},
+      {"ruleId": "GHSA-xxxx", "level": "note", "message": {"text": "minor issue"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "go.mod"}}}]}
+    ]
+  }]
+}`
+
+// TestIngestSARIF tests the SARIF → vulnerability mapping rules
+func TestIngestSARIF(t *testing.T) {
+	format, results, err := formats.Parse([]byte(sarifLog))
+	assert.NoError(t, err)
+	assert.Equal(t, "sarif", format)
+	assert.Len(t, results, 1)
+
+	sr := results[0]
+	assert.Equal(t, "grype", sr.ResourceName)
+	assert.True(t, sr.Timestamp.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Len(t, sr.Vulnerabilities, 2)
+
+	v := sr.Vulnerabilities[0]
+	assert.Equal(t, "CVE-2024-1234", v.CVEID)
+	assert.Equal(t, "CRITICAL", v.Severity)
+	assert.Equal(t, 9.8, v.CVSS)
+	assert.Equal(t, "openssl", v.PackageName)
+	assert.Equal(t, "fixed", v.Status)
+	assert.Equal(t, models.RiskFactors{"Remote Code Execution"}, v.RiskFactors)
+
+	v = sr.Vulnerabilities[1]
+	assert.Equal(t, "LOW", v.Severity)
+	assert.Equal(t, "go.mod", v.PackageName)
+}
+
+// TestExportRoundTrip tests that exported SARIF can be ingested again
+func TestExportRoundTrip(t *testing.T) {
+	vulns := []models.Vulnerability{
+		{CVEID: "CVE-2024-1234", Severity: "HIGH", CVSS: 8.5, PackageName: "openssl", CurrentVersion: "1.1.1t-r0", FixedVersion: "1.1.1u-r0"},
+		{CVEID: "CVE-2024-1234", Severity: "HIGH", CVSS: 8.5, PackageName: "libssl", CurrentVersion: "1.1.1t-r0"},
+		{CVEID: "CVE-2024-8902", Severity: "MEDIUM", PackageName: "openldap"},
+	}
+
+	log := sarif.Export(vulns, "1.0.0")
+	assert.Equal(t, sarif.Version, log.Version)
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, 2)
+	assert.Len(t, log.Runs[0].Results, 3)
+	assert.Equal(t, "error", log.Runs[0].Results[0].Level)
+
+	data, err := json.Marshal(log)
+	assert.NoError(t, err)
+
+	_, results, err := formats.Parse(data)
+	assert.NoError(t, err)
+	back := results[0].Vulnerabilities
+	assert.Len(t, back, 3)
+	assert.Equal(t, "HIGH", back[0].Severity)
+	assert.Equal(t, "openssl", back[0].PackageName)
+	assert.Equal(t, "1.1.1u-r0", back[0].FixedVersion)
+	assert.Equal(t, "MEDIUM", back[2].Severity)
+}
@@ -0,0 +1,99 @@
+package sbom
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/formats"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/osv"
+)
+
+const cycloneDX = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "serialNumber": "urn:uuid:1234",
+  "metadata": {"timestamp": "2024-03-01T10:00:00Z", "component": {"name": "my-app"}},
+  "components": [
+    {"type": "library", "name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20",
+     "components": [{"type": "library", "name": "minimist", "version": "1.2.5", "purl": "pkg:npm/minimist@1.2.5"}]},
+    {"type": "library", "name": "x/net", "group": "golang.org", "version": "v0.1.0", "purl": "pkg:golang/golang.org/x/net@v0.1.0"}
+  ]
+}`
+
+const spdx = `{
+  "spdxVersion": "SPDX-2.3",
+  "name": "my-image",
+  "documentNamespace": "https://example.com/spdx/1",
+  "creationInfo": {"created": "2024-03-01T10:00:00Z"},
+  "packages": [
+    {"SPDXID": "SPDXRef-1", "name": "openssl", "versionInfo": "1.1.1t-r0",
+     "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl",
+                       "referenceLocator": "pkg:apk/alpine/openssl@1.1.1t-r0"}]}
+  ]
+}`
+
+// TestParseSBOMs tests CycloneDX and SPDX component extraction
+func TestParseSBOMs(t *testing.T) {
+	format, results, err := formats.Parse([]byte(cycloneDX))
+	assert.NoError(t, err)
+	assert.Equal(t, "cyclonedx", format)
+	assert.Equal(t, "my-app", results[0].ResourceName)
+	assert.Equal(t, []models.Component{
+		{Name: "lodash", Version: "4.17.20", Ecosystem: "npm", PURL: "pkg:npm/lodash@4.17.20", Type: "library"},
+		{Name: "minimist", Version: "1.2.5", Ecosystem: "npm", PURL: "pkg:npm/minimist@1.2.5", Type: "library"},
+		{Name: "golang.org/x/net", Version: "v0.1.0", Ecosystem: "Go", PURL: "pkg:golang/golang.org/x/net@v0.1.0", Type: "library"},
+	}, results[0].Components)
+
+	format, results, err = formats.Parse([]byte(spdx))
+	assert.NoError(t, err)
+	assert.Equal(t, "spdx", format)
+	assert.Equal(t, []models.Component{
+		{Name: "openssl", Version: "1.1.1t-r0", Ecosystem: "Alpine", PURL: "pkg:apk/alpine/openssl@1.1.1t-r0", Ref: "SPDXRef-1"},
+	}, results[0].Components)
+}
+
+// TestCorrelate tests OSV batch lookup and mapping of results to findings
+func TestCorrelate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/querybatch":
+			var body struct{ Queries []osv.Query }
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Len(t, body.Queries, 2)
+			w.Write([]byte(`{"results": [{"vulns": [{"id": "GHSA-p6mc-m468-83gw"}]}, {}]}`))
+		case "/v1/vulns/GHSA-p6mc-m468-83gw":
+			w.Write([]byte(`{
+				"id": "GHSA-p6mc-m468-83gw", "summary": "Prototype Pollution in lodash",
+				"aliases": ["CVE-2020-8203"], "published": "2020-07-15T19:15:00Z",
+				"database_specific": {"severity": "HIGH"},
+				"affected": [{"package": {"name": "lodash", "ecosystem": "npm"},
+					"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "4.17.21"}]}]}]
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &osv.Client{BaseURL: server.URL, HTTP: server.Client()}
+	findings, err := client.Correlate(context.Background(), []models.Component{
+		{Name: "lodash", Version: "4.17.20", Ecosystem: "npm", PURL: "pkg:npm/lodash@4.17.20"},
+		{Name: "left-pad", Version: "1.3.0", Ecosystem: "npm"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, findings, 1)
+
+	f := findings[0]
+	assert.Equal(t, "CVE-2020-8203", f.CVEID)
+	assert.Equal(t, "HIGH", f.Severity)
+	assert.Equal(t, "lodash", f.PackageName)
+	assert.Equal(t, "4.17.20", f.CurrentVersion)
+	assert.Equal(t, "4.17.21", f.FixedVersion)
+	assert.Equal(t, "fixed", f.Status)
+}
@@ -2,30 +2,38 @@ package scan
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/Chinzzii/vulnscan/errs"
+	"github.com/Chinzzii/vulnscan/github"
 	"github.com/Chinzzii/vulnscan/handlers"
 	"github.com/Chinzzii/vulnscan/storage"
 )
 
-// Mock for FetchFileContent
+// MockFile is a ContentFetcher returning canned file contents
 type MockFile struct {
 	mock.Mock
 }
 
 // FetchFileContent mocks the FetchFileContent method
-func (m *MockFile) FetchFileContent(repo, filePath string) ([]byte, error) {
+func (m *MockFile) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
 	args := m.Called(repo, filePath)
-	return args.Get(0).([]byte), args.Error(1)
+	body, _ := args.Get(0).([]byte)
+	return body, github.Validators{}, args.Error(1)
 }
 
 // setupTestDB initializes an in-memory SQLite database for testing
@@ -42,33 +50,7 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 	db.SetConnMaxLifetime(0) // Connections will not be closed
 
 	// Create tables
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS scans (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			repo TEXT,
-			file_path TEXT,
-			scan_time DATETIME,
-			scan_id TEXT,
-			timestamp DATETIME
-		);
-		CREATE TABLE IF NOT EXISTS vulnerabilities (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			scan_id TEXT,
-			cve_id TEXT,
-			severity TEXT,
-			cvss REAL,
-			status TEXT,
-			package_name TEXT,
-			current_version TEXT,
-			fixed_version TEXT,
-			description TEXT,
-			published_date DATETIME,
-			link TEXT,
-			risk_factors TEXT CHECK(json_valid(risk_factors)),
-			FOREIGN KEY(scan_id) REFERENCES scans(id)
-		);
-	`)
-	if err != nil {
+	if err := storage.Migrate(db); err != nil {
 		t.Fatal(err)
 	}
 
@@ -115,6 +97,7 @@ func TestScanHandler(t *testing.T) {
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanCompleted,
 				Success: []string{"vulnscan16.json"},
 				Failed:  []handlers.FileError(nil),
 			},
@@ -131,6 +114,7 @@ func TestScanHandler(t *testing.T) {
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanCompleted,
 				Success: []string{"vulnscan15.json", "vulnscan19.json"},
 				Failed:  []handlers.FileError(nil),
 			},
@@ -149,6 +133,7 @@ func TestScanHandler(t *testing.T) {
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanCompleted,
 				Success: []string{"vulnscan15.json", "vulnscan16.json", "vulnscan18.json", "vulnscan19.json"},
 				Failed:  []handlers.FileError(nil),
 			},
@@ -160,15 +145,17 @@ func TestScanHandler(t *testing.T) {
 				Files: []string{"vulnscan17.json"},
 			},
 			mockFiles: map[string]interface{}{
-				"vulnscan17.json": []byte(`{"scanResults":{}}`),
+				"vulnscan17.json": errors.New("HTTP status 404"),
 			},
-			expectedCode: http.StatusOK,
+			expectedCode: http.StatusUnprocessableEntity,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanFailed,
 				Success: []string{},
 				Failed: []handlers.FileError{
 					{
-						File:  "vulnscan17.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan17.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 				},
 			},
@@ -180,20 +167,23 @@ func TestScanHandler(t *testing.T) {
 				Files: []string{"vulnscan17.json", "vulnscan20.json"},
 			},
 			mockFiles: map[string]interface{}{
-				"vulnscan17.json": []byte(`{"scanResults":{}}`),
-				"vulnscan20.json": []byte(`{"scanResults":{}}`),
+				"vulnscan17.json": errors.New("HTTP status 404"),
+				"vulnscan20.json": errors.New("HTTP status 404"),
 			},
-			expectedCode: http.StatusOK,
+			expectedCode: http.StatusUnprocessableEntity,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanFailed,
 				Success: []string{},
 				Failed: []handlers.FileError{
 					{
-						File:  "vulnscan17.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan17.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 					{
-						File:  "vulnscan20.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan20.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 				},
 			},
@@ -205,25 +195,29 @@ func TestScanHandler(t *testing.T) {
 				Files: []string{"vulnscan17.json", "vulnscan20.json", "vulnscan21.json"},
 			},
 			mockFiles: map[string]interface{}{
-				"vulnscan17.json": []byte(`{"scanResults":{}}`),
-				"vulnscan20.json": []byte(`{"scanResults":{}}`),
-				"vulnscan21.json": []byte(`{"scanResults":{}}`),
+				"vulnscan17.json": errors.New("HTTP status 404"),
+				"vulnscan20.json": errors.New("HTTP status 404"),
+				"vulnscan21.json": errors.New("HTTP status 404"),
 			},
-			expectedCode: http.StatusOK,
+			expectedCode: http.StatusUnprocessableEntity,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanFailed,
 				Success: []string{},
 				Failed: []handlers.FileError{
 					{
-						File:  "vulnscan17.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan17.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 					{
-						File:  "vulnscan20.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan20.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 					{
-						File:  "vulnscan21.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan21.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 				},
 			},
@@ -236,15 +230,17 @@ func TestScanHandler(t *testing.T) {
 			},
 			mockFiles: map[string]interface{}{
 				"vulnscan16.json": []byte(`{"scanResults":{}}`),
-				"vulnscan17.json": errors.New("file not found"),
+				"vulnscan17.json": errors.New("HTTP status 404"),
 			},
-			expectedCode: http.StatusOK,
+			expectedCode: http.StatusMultiStatus,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanPartial,
 				Success: []string{"vulnscan16.json"},
 				Failed: []handlers.FileError{
 					{
-						File:  "vulnscan17.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan17.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 				},
 			},
@@ -258,16 +254,18 @@ func TestScanHandler(t *testing.T) {
 			mockFiles: map[string]interface{}{
 				"vulnscan15.json": []byte(`{"scanResults":{}}`),
 				"vulnscan16.json": []byte(`{"scanResults":{}}`),
-				"vulnscan17.json": []byte(`{"scanResults":{}}`),
+				"vulnscan17.json": errors.New("HTTP status 404"),
 				"vulnscan18.json": []byte(`{"scanResults":{}}`),
 			},
-			expectedCode: http.StatusOK,
+			expectedCode: http.StatusMultiStatus,
 			expectedBody: handlers.ScanResponse{
+				Status:  handlers.ScanPartial,
 				Success: []string{"vulnscan15.json", "vulnscan16.json", "vulnscan18.json"},
 				Failed: []handlers.FileError{
 					{
-						File:  "vulnscan17.json",
-						Error: "fetch failed: failed after 2 attempts: HTTP status 404",
+						File:     "vulnscan17.json",
+						Error:    "fetch failed: HTTP status 404",
+						Category: handlers.FailureFetch,
 					},
 				},
 			},
@@ -294,6 +292,7 @@ func TestScanHandler(t *testing.T) {
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: handlers.ScanResponse{
+				Status: handlers.ScanCompleted,
 				Success: []string{
 					"vulnscan1011.json", "vulnscan1213.json", "vulnscan15.json", "vulnscan16.json",
 					"vulnscan18.json", "vulnscan19.json", "vulnscan456.json", "vulnscan789.json", "vulscan123.json",
@@ -320,18 +319,587 @@ func TestScanHandler(t *testing.T) {
 
 			// Mock HTTP response recorder
 			recorder := httptest.NewRecorder()
-			http.HandlerFunc(handlers.ScanHandler).ServeHTTP(recorder, req)
+			handlers.NewScanner(mockFile).ServeHTTP(recorder, req)
 
 			// Verify response code
 			assert.Equal(t, tt.expectedCode, recorder.Code)
 
 			// Verify response body
-			if recorder.Code == http.StatusOK {
+			if tt.expectedBody.Status != "" {
 				var response handlers.ScanResponse
 				json.Unmarshal(recorder.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedBody.Status, response.Status)
 				assert.ElementsMatch(t, tt.expectedBody.Success, response.Success)
 				assert.ElementsMatch(t, tt.expectedBody.Failed, response.Failed)
 			}
+
+			// Every file was fetched through the injected fetcher
+			mockFile.AssertExpectations(t)
+		})
+	}
+}
+
+// TestConditionalFetch tests that files unchanged since their last ingest
+// are skipped, and ingested again when forced or changed
+func TestConditionalFetch(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev *sqlx.DB) { storage.DB = prev }(storage.DB)
+	storage.DB = db
+
+	etag := `"v1"`
+	var downloads, lookups int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/acme/api" {
+			lookups++
+			w.Write([]byte(`{"default_branch": "trunk"}`))
+			return
+		}
+		assert.Equal(t, "/acme/api/trunk/reports/trivy.json", r.URL.Path)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(`{"scanResults":{}}`))
+	}))
+	defer server.Close()
+
+	scanner := handlers.NewScanner(&github.RawFetcher{
+		HTTP: server.Client(), Hosts: map[string]string{"github.com": server.URL}, API: github.NewClient(server.URL, ""),
+	})
+	scan := func(force bool) handlers.ScanResponse {
+		return scanner.Run(context.Background(), handlers.ScanRequest{
+			Repo: "https://github.com/acme/api", Files: []string{"reports/trivy.json"}, Force: force,
 		})
 	}
+	scans := func() (n int) {
+		db.Get(&n, "SELECT COUNT(*) FROM scans")
+		return n
+	}
+
+	resp := scan(false)
+	assert.Equal(t, []string{"reports/trivy.json"}, resp.Success)
+	assert.Empty(t, resp.Skipped)
+	assert.Equal(t, 1, scans())
+
+	// Unchanged: skipped without a download or a new scan
+	resp = scan(false)
+	assert.Empty(t, resp.Success)
+	assert.Equal(t, []handlers.FileSkip{{File: "reports/trivy.json", Reason: "not modified, skipped"}}, resp.Skipped)
+	assert.Equal(t, 1, downloads)
+	assert.Equal(t, 1, scans())
+
+	// Forced, and changed upstream: ingested again
+	resp = scan(true)
+	assert.Equal(t, []string{"reports/trivy.json"}, resp.Success)
+	etag = `"v2"`
+	resp = scan(false)
+	assert.Equal(t, []string{"reports/trivy.json"}, resp.Success)
+	assert.Equal(t, 3, downloads)
+	assert.Equal(t, 3, scans())
+	assert.Equal(t, 1, lookups) // The default branch is looked up once
+
+	v, ok, err := storage.GetFetchValidators(context.Background(), db, "https://github.com/acme/api", "trunk", "reports/trivy.json")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `"v2"`, v.ETag)
+}
+
+// TestChecksumVerification tests that files are ingested only when they
+// match their expected SHA-256, which is recorded with the scan
+func TestChecksumVerification(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	content := []byte(`{"scanResults":{}}`)
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{"good.json": content, "tampered.json": content})
+	handler := handlers.NewScanner(mockFile)
+
+	post := func(req handlers.ScanRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		return rr
+	}
+
+	rr := post(handlers.ScanRequest{
+		Repo:  repoURL,
+		Files: []string{"good.json", "tampered.json"},
+		Checksums: map[string]string{
+			"good.json":     strings.ToUpper(digest),
+			"tampered.json": strings.Repeat("0", 64),
+		},
+	})
+	assert.Equal(t, http.StatusMultiStatus, rr.Code)
+	var resp handlers.ScanResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"good.json"}, resp.Success)
+	assert.Equal(t, []handlers.FileError{{
+		File:     "tampered.json",
+		Error:    "checksum mismatch: expected SHA-256 " + strings.Repeat("0", 64) + ", got " + digest,
+		Category: handlers.FailureChecksum,
+	}}, resp.Failed)
+	mockFile.AssertExpectations(t)
+
+	var recorded []string
+	assert.NoError(t, db.Select(&recorded, "SELECT file_path || ' ' || sha256 FROM scans"))
+	assert.Equal(t, []string{"good.json " + digest}, recorded)
+
+	for _, checksums := range []map[string]string{
+		{"other.json": digest},
+		{"good.json": "abc"},
+		{"good.json": strings.Repeat("zz", 32)},
+	} {
+		rr := post(handlers.ScanRequest{Repo: repoURL, Files: []string{"good.json"}, Checksums: checksums})
+		assert.Equal(t, http.StatusBadRequest, rr.Code, checksums)
+	}
+}
+
+// TestPathPrefix tests that files and checksums are resolved under a path
+// prefix and stored with their full paths
+func TestPathPrefix(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	content := []byte(`{"scanResults":{}}`)
+	sum := sha256.Sum256(content)
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{
+		"security/reports/trivy.json":     content,
+		"security/reports/deps/osv.json":  content,
+		"security/reports/unchecked.json": content,
+	})
+	handler := handlers.NewScanner(mockFile)
+	post := func(req handlers.ScanRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		return rr
+	}
+
+	rr := post(handlers.ScanRequest{
+		Repo: repoURL, PathPrefix: "security/reports/", Files: []string{"trivy.json", "/deps/osv.json"},
+		Checksums: map[string]string{"trivy.json": hex.EncodeToString(sum[:])},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp handlers.ScanResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{"security/reports/trivy.json", "security/reports/deps/osv.json"}, resp.Success)
+
+	var paths []string
+	assert.NoError(t, db.Select(&paths, "SELECT file_path FROM scans ORDER BY file_path"))
+	assert.Equal(t, []string{"security/reports/deps/osv.json", "security/reports/trivy.json"}, paths)
+
+	// Runs outside the handler apply the prefix too
+	resp = handler.Run(context.Background(), handlers.ScanRequest{Repo: repoURL, PathPrefix: "security/reports", Files: []string{"unchecked.json"}})
+	assert.Equal(t, []string{"security/reports/unchecked.json"}, resp.Success)
+	mockFile.AssertExpectations(t)
+
+	for _, prefix := range []string{"../secrets", "security//reports", "./reports", "/"} {
+		rr := post(handlers.ScanRequest{Repo: repoURL, PathPrefix: prefix, Files: []string{"trivy.json"}})
+		assert.Equal(t, http.StatusBadRequest, rr.Code, prefix)
+	}
+}
+
+// TestLenientParsing tests that a lenient scan ingests the well-formed
+// entries of a file and reports the skipped ones as warnings
+func TestLenientParsing(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	content := []byte(`{"scanResults":{"scan_id":"a","vulnerabilities":[
+		{"id":"CVE-1","severity":"HIGH","package_name":"openssl"},
+		{"id":"CVE-2","published_date":"yesterday"}]}}`)
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{"report.json": content})
+	handler := handlers.NewScanner(mockFile)
+
+	post := func(req handlers.ScanRequest) (int, handlers.ScanResponse) {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		var resp handlers.ScanResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := post(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Empty(t, resp.Success)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Contains(t, resp.Failed[0].Error, "parse failed")
+		assert.Equal(t, handlers.FailureParse, resp.Failed[0].Category)
+	}
+
+	code, resp = post(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}, ParseMode: handlers.ParseLenient})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"report.json"}, resp.Success)
+	if assert.Len(t, resp.Warnings, 1) {
+		assert.Equal(t, "report.json", resp.Warnings[0].File)
+		assert.Equal(t, 1, resp.Warnings[0].Index)
+		assert.Contains(t, resp.Warnings[0].Reason, "yesterday")
+	}
+	var ids []string
+	assert.NoError(t, db.Select(&ids, "SELECT cve_id FROM vulnerabilities"))
+	assert.Equal(t, []string{"CVE-1"}, ids)
+
+	// The server default applies when the request doesn't choose
+	defer func(mode string) { handlers.DefaultParseMode = mode }(handlers.DefaultParseMode)
+	handlers.DefaultParseMode = handlers.ParseLenient
+	_, resp = post(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}})
+	assert.Len(t, resp.Warnings, 1)
+	_, resp = post(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}, ParseMode: handlers.ParseStrict})
+	assert.Len(t, resp.Failed, 1)
+
+	code, _ = post(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}, ParseMode: "loose"})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestIncompleteScans tests that a report whose scanner reported an
+// incomplete run is stored and flagged, without resolving the findings it
+// leaves out, or fails when incomplete scans are skipped
+func TestIncompleteScans(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	report := func(status string, ids ...string) []byte {
+		var vulns []string
+		for _, id := range ids {
+			vulns = append(vulns, `{"id":"`+id+`","severity":"HIGH","package_name":"openssl"}`)
+		}
+		return []byte(`{"scanResults":{"scan_id":"s","scan_status":"` + status + `","vulnerabilities":[` + strings.Join(vulns, ",") + `]}}`)
+	}
+	post := func(content []byte) (int, handlers.ScanResponse) {
+		mockFile := new(MockFile)
+		setupMock(mockFile, map[string]interface{}{"report.json": content})
+		body, _ := json.Marshal(handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}, Force: true})
+		rr := httptest.NewRecorder()
+		handlers.NewScanner(mockFile).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		var resp handlers.ScanResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+	open := func() []string {
+		var ids []string
+		assert.NoError(t, db.Select(&ids, "SELECT cve_id FROM findings WHERE status = ? ORDER BY cve_id", storage.FindingOpen))
+		return ids
+	}
+
+	code, resp := post(report("completed", "CVE-1", "CVE-2"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Warnings)
+
+	// A partial run is stored and flagged, but doesn't resolve CVE-2
+	code, resp = post(report("Partial", "CVE-1"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"report.json"}, resp.Success)
+	if assert.Len(t, resp.Warnings, 1) {
+		assert.Equal(t, -1, resp.Warnings[0].Index)
+		assert.Contains(t, resp.Warnings[0].Reason, `"Partial"`)
+	}
+	var scans []struct {
+		Status     string `db:"scan_status"`
+		Incomplete bool   `db:"incomplete"`
+	}
+	assert.NoError(t, db.Select(&scans, "SELECT scan_status, incomplete FROM scans ORDER BY id"))
+	if assert.Len(t, scans, 2) {
+		assert.False(t, scans[0].Incomplete)
+		assert.Equal(t, "Partial", scans[1].Status)
+		assert.True(t, scans[1].Incomplete)
+	}
+	assert.Equal(t, []string{"CVE-1", "CVE-2"}, open())
+
+	// The next complete run resolves it
+	post(report("completed", "CVE-1"))
+	assert.Equal(t, []string{"CVE-1"}, open())
+
+	// Skipped runs fail without being stored
+	defer func(action string) { handlers.IncompleteScanAction = action }(handlers.IncompleteScanAction)
+	handlers.IncompleteScanAction = handlers.IncompleteSkip
+	code, resp = post(report("failed"))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, handlers.FailureIncomplete, resp.Failed[0].Category)
+		assert.Contains(t, resp.Failed[0].Error, `"failed"`)
+	}
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM scans"))
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"CVE-1"}, open())
+}
+
+// TestTimestampRoundTrip tests that report times are stored as UTC RFC 3339
+// text whatever their input zone, read back as the same instant, and that
+// rows stored in the driver's default layout are migrated
+func TestTimestampRoundTrip(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	content := []byte(`{"scanResults":{"scan_id":"a","timestamp":"2024-03-01 12:00:00+02:00","vulnerabilities":[
+		{"id":"CVE-1","published_date":"2024-01-15T10:30:00.5+02:00"},
+		{"id":"CVE-2","published_date":"2024-01-15"},
+		{"id":"CVE-3"}]}}`)
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{"report.json": content})
+	resp := handlers.NewScanner(mockFile).Run(context.Background(), handlers.ScanRequest{Repo: repoURL, Files: []string{"report.json"}})
+	assert.Equal(t, []string{"report.json"}, resp.Success)
+
+	var stored []string
+	assert.NoError(t, db.Select(&stored, "SELECT CAST(published_date AS TEXT) FROM vulnerabilities ORDER BY cve_id"))
+	assert.Equal(t, []string{"2024-01-15T08:30:00Z", "2024-01-15T00:00:00Z", "0001-01-01T00:00:00Z"}, stored)
+	var scanTimestamp string
+	assert.NoError(t, db.Get(&scanTimestamp, "SELECT CAST(timestamp AS TEXT) FROM scans"))
+	assert.Equal(t, "2024-03-01T10:00:00Z", scanTimestamp)
+
+	var published []time.Time
+	assert.NoError(t, db.Select(&published, "SELECT published_date FROM vulnerabilities ORDER BY cve_id"))
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC), time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), {},
+	}, published)
+	var timestamp time.Time
+	assert.NoError(t, db.Get(&timestamp, "SELECT timestamp FROM scans"))
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), timestamp)
+
+	// Rows written before normalization kept the report's zone
+	zoned := time.Date(2024, 1, 15, 10, 30, 0, 0, time.FixedZone("", 2*60*60))
+	_, err := db.Exec("UPDATE vulnerabilities SET published_date = ?", zoned)
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE scans SET timestamp = ?", zoned)
+	assert.NoError(t, err)
+	_, err = db.Exec(`ALTER TABLE scans DROP COLUMN source; ALTER TABLE scans DROP COLUMN resource_type;
+		ALTER TABLE scans DROP COLUMN resource_name; ALTER TABLE vulnerabilities DROP COLUMN package_class;
+		ALTER TABLE scans DROP COLUMN scan_status; ALTER TABLE scans DROP COLUMN incomplete;
+		ALTER TABLE vulnerabilities DROP COLUMN raw_json;
+		DROP INDEX idx_scans_tenant; ALTER TABLE scans DROP COLUMN tenant;
+		DROP INDEX idx_vulnerabilities_fingerprint; ALTER TABLE vulnerabilities DROP COLUMN fingerprint;
+		ALTER TABLE vulnerabilities DROP COLUMN location;
+		DROP INDEX idx_scans_ingest_id; ALTER TABLE scans DROP COLUMN ingest_id;
+		DELETE FROM schema_migrations WHERE version >= 23`)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	assert.NoError(t, db.Select(&stored, "SELECT DISTINCT CAST(published_date AS TEXT) FROM vulnerabilities"))
+	assert.Equal(t, []string{"2024-01-15T08:30:00Z"}, stored)
+	assert.NoError(t, db.Get(&scanTimestamp, "SELECT CAST(timestamp AS TEXT) FROM scans"))
+	assert.Equal(t, "2024-01-15T08:30:00Z", scanTimestamp)
+}
+
+// TestScanOutcome tests the failure categories of a scan and the configured
+// status code of one in which every file failed
+func TestScanOutcome(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(code int) { handlers.ScanFailedStatus = code }(handlers.ScanFailedStatus)
+	handlers.ScanFailedStatus = http.StatusBadGateway
+
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{
+		"trivy.json":  []byte(`{"scanResults":{}}`),
+		"notes.txt":   []byte("not a report"),
+		"gone.json":   errors.New("HTTP status 404"),
+		"stored.json": []byte(`{"scanResults":{}}`),
+	})
+	handler := handlers.NewScanner(mockFile)
+	post := func(files ...string) (int, handlers.ScanResponse) {
+		body, _ := json.Marshal(handlers.ScanRequest{Repo: repoURL, Files: files})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		var resp handlers.ScanResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return rr.Code, resp
+	}
+
+	code, resp := post("trivy.json", "notes.txt")
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, handlers.ScanPartial, resp.Status)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, handlers.FailureParse, resp.Failed[0].Category)
+	}
+
+	// Storage failures are categorized as db
+	_, err := db.Exec(`CREATE TRIGGER reject_scans BEFORE INSERT ON scans BEGIN SELECT RAISE(ABORT, 'disk full'); END`)
+	assert.NoError(t, err)
+	code, resp = post("gone.json", "stored.json")
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.Equal(t, handlers.ScanFailed, resp.Status)
+	assert.Empty(t, resp.Success)
+	assert.ElementsMatch(t, []string{handlers.FailureFetch, handlers.FailureDB},
+		[]string{resp.Failed[0].Category, resp.Failed[1].Category})
+}
+
+// hangingFetcher serves an empty report for every file except those named
+// hung*, which it holds until the request is cancelled
+type hangingFetcher struct{}
+
+// FetchFileContent implements handlers.ContentFetcher
+func (hangingFetcher) FetchFileContent(ctx context.Context, repo, ref, filePath string, cached *github.Validators) ([]byte, github.Validators, error) {
+	if strings.HasPrefix(filePath, "hung") {
+		<-ctx.Done()
+		return nil, github.Validators{}, ctx.Err()
+	}
+	return []byte(`{"scanResults":{}}`), github.Validators{}, nil
+}
+
+// TestScanTimeouts tests that hung files fail with category timeout once the
+// file timeout or the scan deadline passes
+func TestScanTimeouts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := handlers.NewScanner(hangingFetcher{})
+	post := func(req handlers.ScanRequest) (int, handlers.ScanResponse) {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		var resp handlers.ScanResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	// A hung file times out on its own while the others are ingested
+	code, resp := post(handlers.ScanRequest{Repo: repoURL, Files: []string{"hung.json", "ok.json"}, FileTimeout: "50ms"})
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, []string{"ok.json"}, resp.Success)
+	if assert.Len(t, resp.Failed, 1) {
+		assert.Equal(t, handlers.FailureTimeout, resp.Failed[0].Category)
+		assert.Contains(t, resp.Failed[0].Error, "timed out after 50ms")
+	}
+
+	// The scan deadline fails running files and those still waiting for a slot
+	start := time.Now()
+	files := []string{"hung1.json", "hung2.json", "hung3.json", "hung4.json", "hung5.json"}
+	code, resp = post(handlers.ScanRequest{Repo: repoURL, Files: files, Timeout: "50ms"})
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, handlers.ScanFailed, resp.Status)
+	if assert.Len(t, resp.Failed, len(files)) {
+		for _, f := range resp.Failed {
+			assert.Equal(t, handlers.FailureTimeout, f.Category, f.File)
+			assert.Contains(t, f.Error, "scan timed out after 50ms", f.File)
+		}
+	}
+
+	for _, req := range []handlers.ScanRequest{
+		{Repo: repoURL, Files: files, Timeout: "soon"},
+		{Repo: repoURL, Files: files, FileTimeout: "-1s"},
+	} {
+		code, _ := post(req)
+		assert.Equal(t, http.StatusBadRequest, code, req)
+	}
+}
+
+// TestRetryHints tests that files failing because upstream throttled or
+// the database was busy carry a retry hint, and that a scan only they
+// failed carries a Retry-After header
+func TestRetryHints(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	throttled := errs.WithRetryAfter(errs.New(errs.ErrUpstreamRateLimited, "github: rate limit exhausted"), 90*time.Second)
+	mockFile := new(MockFile)
+	setupMock(mockFile, map[string]interface{}{
+		"throttled.json": throttled,
+		"limited.json":   errs.New(errs.ErrUpstreamRateLimited, "osv: HTTP status 429"),
+		"missing.json":   errs.New(errs.ErrNotFound, "HTTP status 404"),
+	})
+	post := func(files ...string) (*httptest.ResponseRecorder, handlers.ScanResponse) {
+		body, _ := json.Marshal(handlers.ScanRequest{Repo: repoURL, Files: files})
+		rr := httptest.NewRecorder()
+		handlers.NewScanner(mockFile).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+		var resp handlers.ScanResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	rr, resp := post("throttled.json", "limited.json")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, "90", rr.Header().Get("Retry-After"))
+	hints := map[string]int{}
+	for _, f := range resp.Failed {
+		assert.Equal(t, handlers.FailureFetch, f.Category)
+		hints[f.File] = f.RetryAfterSeconds
+	}
+	assert.Equal(t, map[string]int{"throttled.json": 90, "limited.json": 60}, hints)
+
+	// A failure a retry won't fix has no hint, nor has the scan
+	rr, resp = post("throttled.json", "missing.json")
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+	for _, f := range resp.Failed {
+		if f.File == "missing.json" {
+			assert.Zero(t, f.RetryAfterSeconds)
+			assert.NotContains(t, rr.Body.String(), `"retry_after_seconds":0`)
+		}
+	}
+}
+
+// TestRepoAccess tests that scans of repositories outside the access list
+// are rejected with 403 before anything is fetched
+func TestRepoAccess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(a handlers.RepoAccess) { handlers.ScanAccess = a }(handlers.ScanAccess)
+	handlers.ScanAccess = handlers.RepoAccess{
+		Allow: []string{"github.com/velancio/*", "github.com/acme"},
+		Deny:  []string{"github.com/acme/secret-*"},
+	}
+	assert.NoError(t, handlers.ScanAccess.Validate())
+	assert.Error(t, handlers.RepoAccess{Allow: []string{"github.com/[org"}}.Validate())
+
+	for repo, allowed := range map[string]bool{
+		repoURL:                                        true,
+		"https://GitHub.com/Velancio/other.git":        true,
+		"https://github.com/acme/api/":                 true,
+		"https://github.com/acme/secret-keys":          false,
+		"https://github.com/velancio":                  false,
+		"https://github.com/elsewhere/repo":            false,
+		"https://github.com.evil.example/velancio/x":   false,
+		"https://169.254.169.254/latest/meta-data":     false,
+		"file:///etc/passwd":                           false,
+		"https://user@github.com/velancio/x":           false,
+		"https://github.com/velancio/x/../../evil/y":   false,
+		"github.com/velancio/vulnerability_scans":      false,
+		"https://github.com/velancio/%2e%2e/evil/repo": false,
+	} {
+		err := handlers.ScanAccess.Check(repo)
+		if allowed {
+			assert.NoError(t, err, repo)
+		} else {
+			assert.ErrorIs(t, err, handlers.ErrRepoNotAllowed, repo)
+		}
+	}
+
+	// Nothing is fetched for a denied repository
+	handler := handlers.NewScanner(new(MockFile))
+	post := func(h http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rr
+	}
+	rr := post(handler.ServeHTTP, "/scan", `{"repo": "https://github.com/elsewhere/repo", "files": ["a.json"]}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "repository not allowed")
+	rr = post(handler.BulkScanHandler, "/scan/bulk",
+		`{"entries": [{"repo": "`+repoURL+`", "files": ["a.json"]}, {"repo": "https://github.com/acme/secret-keys", "files": ["a.json"]}]}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "entry 2")
+	rr = post(handler.ArchiveScanHandler, "/scan/archive",
+		`{"repo": "https://github.com/elsewhere/repo", "url": "http://127.0.0.1:1/reports.zip"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = post(handlers.PackageScanHandler, "/packages/scan",
+		`{"repo": "https://github.com/acme/secret-keys", "packages": [{"name": "lodash", "ecosystem": "npm", "version": "4.17.20"}]}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	var scans int
+	assert.NoError(t, db.Get(&scans, "SELECT COUNT(*) FROM scans"))
+	assert.Zero(t, scans)
 }
@@ -0,0 +1,222 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/archive"
+	"github.com/Chinzzii/vulnscan/events"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/siem"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// finding returns a finding event of a vulnerability
+func finding(repo, id, severity, pkg string) events.Event {
+	return events.Event{Type: events.TypeFinding, Repo: repo, Severity: severity, Time: time.Unix(1714550400, 0),
+		Data: models.Vulnerability{CVEID: id, Severity: severity, PackageName: pkg, CurrentVersion: "1.0", CVSS: 7.5,
+			Fingerprint: "fp-" + id, Description: "a=b|c\nd"}}
+}
+
+// TestFindingEvents tests that a finding event is published for each
+// vulnerability the first time a repository reports it, whatever its
+// severity
+func TestFindingEvents(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+
+	ch, cancel := events.Default.Subscribe(events.Filter{Types: []string{events.TypeFinding}})
+	defer cancel()
+	report := func(ids ...string) []byte {
+		var vulns []string
+		for _, id := range ids {
+			vulns = append(vulns, `{"id":"`+id+`","severity":"LOW","package_name":"openssl"}`)
+		}
+		return []byte(`{"scanResults":{"scan_id":"s","vulnerabilities":[` + strings.Join(vulns, ",") + `]}}`)
+	}
+	scanner := handlers.NewScanner(nil)
+	ingest := func(content []byte) []string {
+		resp := scanner.IngestArchive(context.Background(), "https://github.com/acme/api",
+			[]archive.File{{Name: "report.json", Content: content}}, nil)
+		assert.Empty(t, resp.Failed)
+		var ids []string
+		for {
+			select {
+			case e := <-ch:
+				v := e.Data.(models.Vulnerability)
+				assert.Len(t, v.Fingerprint, 64)
+				ids = append(ids, v.CVEID)
+			default:
+				return ids
+			}
+		}
+	}
+	assert.Equal(t, []string{"CVE-1", "CVE-2"}, ingest(report("CVE-1", "CVE-2", "CVE-1")))
+	assert.Equal(t, []string{"CVE-3"}, ingest(report("CVE-1", "CVE-3")))
+	assert.Empty(t, ingest(report("CVE-2")), "resolved findings seen again are not new")
+}
+
+// TestCEF tests CEF formatting, escaping, and custom field labels
+func TestCEF(t *testing.T) {
+	r := siem.Record{"id": "CVE-1", "severity": "HIGH", "package_name": "a|b", "current_version": "1.0",
+		"repo": "https://github.com/acme/api", "description": "x=y\\z\nw", "cvss": 7.5, "time": time.UnixMilli(1714550400000)}
+	msg := siem.CEF(r, map[string]string{"cs1": "repo", "msg": "description", "cfp1": "cvss", "rt": "time", "cs2": "fixed_version"})
+	assert.Equal(t, `CEF:0|vulnscan|vulnscan|1.0|CVE-1|CVE-1 in a\|b 1.0|8|`+
+		`cfp1=7.5 cfp1Label=cvss cs1=https://github.com/acme/api cs1Label=repo msg=x\=y\\z\nw rt=1714550400000`, msg)
+}
+
+// TestSplunkHEC tests that findings are batched to a HEC with the
+// configured fields, and that a failed batch is retried
+func TestSplunkHEC(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/services/collector/event", r.URL.Path)
+		assert.Equal(t, "Splunk hec-token", r.Header.Get("Authorization"))
+		if requests++; requests == 1 {
+			http.Error(w, `{"text":"Server is busy","code":9}`, http.StatusBadRequest)
+			return
+		}
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var e map[string]interface{}
+			assert.NoError(t, dec.Decode(&e))
+			received = append(received, e)
+		}
+	}))
+	defer srv.Close()
+
+	retries := 2
+	f, err := siem.New(siem.Config{Outputs: []siem.OutputConfig{{
+		Name: "splunk", Type: siem.TypeSplunkHEC, URL: srv.URL, Token: "hec-token", Index: "vulns",
+		Fields:      map[string]string{"cve": "id", "sev": "severity", "repository": "repo", "finding": "fingerprint"},
+		MinSeverity: "high", BatchSize: 2, FlushInterval: "20ms", MaxRetries: &retries, RetryBackoff: "10ms",
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	broker := events.NewBroker()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	f.Start(ctx, broker)
+	for broker.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	broker.Publish(finding("https://github.com/acme/api", "CVE-1", "CRITICAL", "openssl"))
+	broker.Publish(finding("https://github.com/acme/api", "CVE-2", "LOW", "zlib"))
+	broker.Publish(events.Event{Type: events.TypeVulnerability, Repo: "https://github.com/acme/api", Severity: "HIGH",
+		Data: models.Vulnerability{CVEID: "CVE-9"}})
+	broker.Publish(finding("https://github.com/acme/api", "CVE-3", "HIGH", "curl"))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, "vulns", received[0]["index"])
+	assert.Equal(t, "vulnscan:finding", received[0]["sourcetype"])
+	assert.Equal(t, 1714550400.0, received[0]["time"])
+	assert.Equal(t, map[string]interface{}{"cve": "CVE-1", "sev": "CRITICAL",
+		"repository": "https://github.com/acme/api", "finding": "fp-CVE-1"}, received[0]["event"])
+	assert.Equal(t, "CVE-3", received[1]["event"].(map[string]interface{})["cve"])
+	assert.Equal(t, []siem.Stats{{Name: "splunk", Sent: 2}}, f.Stats())
+}
+
+// TestSyslog tests that findings are sent as newline-framed RFC 5424
+// messages carrying CEF events
+func TestSyslog(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	f, err := siem.New(siem.Config{Outputs: []siem.OutputConfig{{
+		Name: "arcsight", Type: siem.TypeSyslog, Address: ln.Addr().String(), Facility: "local4",
+		Repos: []string{"https://github.com/acme/api"}, FlushInterval: "10ms",
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	f.Handle(finding("https://github.com/other/app", "CVE-0", "HIGH", "openssl"))
+	f.Handle(finding("https://github.com/acme/api", "CVE-1", "CRITICAL", "openssl"))
+	f.Handle(finding("https://github.com/acme/api", "CVE-2", "", "zlib"))
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	f.Start(ctx, events.NewBroker())
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d messages", len(got))
+		}
+	}
+	assert.Regexp(t, `^<162>1 2024-05-01T08:00:00Z \S+ vulnscan - finding - CEF:0\|vulnscan\|vulnscan\|1\.0\|CVE-1\|CVE-1 in openssl 1\.0\|10\|`, got[0])
+	assert.Contains(t, got[0], "cs1=https://github.com/acme/api cs1Label=repo")
+	assert.Contains(t, got[0], `msg=a\=b|c\nd`)
+	assert.Contains(t, got[0], "cs6=fp-CVE-1 cs6Label=fingerprint")
+	assert.Regexp(t, `^<166>1 .*\|CVE-2\|CVE-2 in zlib 1\.0\|0\|`, got[1])
+}
+
+// TestConfig tests that invalid outputs are rejected
+func TestConfig(t *testing.T) {
+	for name, c := range map[string]siem.OutputConfig{
+		"type":      {Name: "x", Type: "kafka"},
+		"address":   {Name: "x", Type: siem.TypeSyslog, Address: "nohost"},
+		"network":   {Name: "x", Type: siem.TypeSyslog, Address: "h:514", Network: "sctp"},
+		"facility":  {Name: "x", Type: siem.TypeSyslog, Address: "h:514", Facility: "mail2"},
+		"field":     {Name: "x", Type: siem.TypeSyslog, Address: "h:514", Fields: map[string]string{"cs1": "owner"}},
+		"cef key":   {Name: "x", Type: siem.TypeSyslog, Address: "h:514", Fields: map[string]string{"c s": "id"}},
+		"url":       {Name: "x", Type: siem.TypeSplunkHEC, URL: "ftp://splunk", Token: "t"},
+		"token":     {Name: "x", Type: siem.TypeSplunkHEC, URL: "https://splunk:8088"},
+		"severity":  {Name: "x", Type: siem.TypeSplunkHEC, URL: "https://splunk:8088", Token: "t", MinSeverity: "urgent"},
+		"interval":  {Name: "x", Type: siem.TypeSplunkHEC, URL: "https://splunk:8088", Token: "t", FlushInterval: "-1s"},
+		"no name":   {Type: siem.TypeSplunkHEC, URL: "https://splunk:8088", Token: "t"},
+		"batchsize": {Name: "x", Type: siem.TypeSplunkHEC, URL: "https://splunk:8088", Token: "t", BatchSize: -1},
+	} {
+		_, err := siem.New(siem.Config{Outputs: []siem.OutputConfig{c}})
+		assert.Error(t, err, name)
+	}
+}
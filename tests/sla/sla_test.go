@@ -0,0 +1,232 @@
+package sla
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/sla"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestParse tests reading per-severity SLAs from configuration
+func TestParse(t *testing.T) {
+	p, err := sla.Parse("critical=7, High=30")
+	assert.NoError(t, err)
+	assert.Equal(t, sla.Policy{"CRITICAL": 7, "HIGH": 30}, p)
+
+	first := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	due, ok := p.DueDate("critical", first)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, time.March, 8, 0, 0, 0, 0, time.UTC), due)
+	_, ok = p.DueDate("LOW", first)
+	assert.False(t, ok)
+
+	for _, bad := range []string{"critical", "critical=soon", "high=0"} {
+		_, err := sla.Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestOverdue tests due dates computed from the first scan reporting a finding
+func TestOverdue(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	sla.Default = sla.Policy{"CRITICAL": 7, "HIGH": 30}
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	scan := func(repo string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "HIGH", PackageName: "curl"}
+	low := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "LOW", PackageName: "zlib"}
+
+	// The critical finding was first seen 10 days ago and is still present;
+	// the high finding appeared in the latest scan only
+	scan("repo-a", now.AddDate(0, 0, -10), critical, low)
+	scan("repo-a", now.AddDate(0, 0, -1), critical, high, low)
+	// In repo-b the critical finding is new
+	scan("repo-b", now.AddDate(0, 0, -2), critical)
+
+	overdue, err := handlers.QueryOverdue(ctx, "", "", now)
+	assert.NoError(t, err)
+	if assert.Len(t, overdue, 1) {
+		f := overdue[0]
+		assert.Equal(t, "CVE-2024-0001", f.CVEID)
+		assert.Equal(t, "repo-a", f.Repo)
+		assert.WithinDuration(t, now.AddDate(0, 0, -10), f.FirstSeen, time.Second)
+		assert.WithinDuration(t, now.AddDate(0, 0, -3), f.DueDate, time.Second)
+		assert.Equal(t, 3, f.DaysOverdue)
+	}
+
+	// Closing the finding removes it from the overdue list
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = 'acknowledged' WHERE cve_id = 'CVE-2024-0001'")
+	assert.NoError(t, err)
+	overdue, _ = handlers.QueryOverdue(ctx, "repo-a", "critical", now)
+	assert.Len(t, overdue, 1)
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = 'resolved' WHERE cve_id = 'CVE-2024-0001'")
+	assert.NoError(t, err)
+	overdue, _ = handlers.QueryOverdue(ctx, "repo-a", "critical", now)
+	assert.Empty(t, overdue)
+	_, err = db.Exec("UPDATE vulnerabilities SET triage_status = 'open'")
+	assert.NoError(t, err)
+
+	// Compliance counts open findings in the latest scans per SLA severity
+	stats, err := handlers.QueryStats(ctx, handlers.StatsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, handlers.SLACompliance{Days: 7, Open: 2, Overdue: 1, Compliance: 0.5}, stats.SLA["CRITICAL"])
+	assert.Equal(t, handlers.SLACompliance{Days: 30, Open: 1, Compliance: 1}, stats.SLA["HIGH"])
+	assert.NotContains(t, stats.SLA, "LOW")
+
+	// The endpoint serves the same list as JSON
+	rr := httptest.NewRecorder()
+	handlers.OverdueHandler(rr, httptest.NewRequest(http.MethodGet, "/vulnerabilities/overdue?repo=repo-b", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp []handlers.OverdueFinding
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Empty(t, resp)
+}
+
+// TestAging tests that stats count open findings by age per severity
+func TestAging(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	scan := func(repo string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	critical := models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"}
+	high := models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "high", PackageName: "curl"}
+	fixed := models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "HIGH", PackageName: "zlib"}
+
+	// Ages follow the first sighting, not the latest scan; findings no
+	// longer reported don't count
+	scan("repo-a", now.AddDate(0, 0, -120), critical, fixed)
+	scan("repo-a", now.AddDate(0, 0, -45), critical, high)
+	scan("repo-a", now.AddDate(0, 0, -1), critical, high)
+	scan("repo-b", now.AddDate(0, 0, -5), critical)
+
+	stats, err := handlers.QueryStats(ctx, handlers.StatsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]handlers.AgingBuckets{
+		"CRITICAL": {Under30Days: 1, Over90Days: 1},
+		"HIGH":     {Days30To90: 1},
+	}, stats.Aging)
+
+	stats, err = handlers.QueryStats(ctx, handlers.StatsFilter{Repo: "repo-b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]handlers.AgingBuckets{"CRITICAL": {Under30Days: 1}}, stats.Aging)
+}
+
+// TestTopOffenders tests ranking packages, vulnerabilities, and
+// repositories by their open findings weighted by severity
+func TestTopOffenders(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	scan := func(repo string, at time.Time, vulns ...models.Vulnerability) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for _, v := range vulns {
+			v.RiskFactors = models.RiskFactors{}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+	// One critical outweighs several lows; only the latest scans count
+	scan("repo-a", now.AddDate(0, 0, -3),
+		models.Vulnerability{CVEID: "CVE-2024-0009", Severity: "CRITICAL", PackageName: "busybox"})
+	scan("repo-a", now,
+		models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"},
+		models.Vulnerability{CVEID: "CVE-2024-0002", Severity: "LOW", PackageName: "zlib"},
+		models.Vulnerability{CVEID: "CVE-2024-0003", Severity: "LOW", PackageName: "zlib"})
+	scan("repo-b", now,
+		models.Vulnerability{CVEID: "CVE-2024-0001", Severity: "CRITICAL", PackageName: "openssl"},
+		models.Vulnerability{CVEID: "CVE-2024-0004", Severity: "HIGH", PackageName: "curl"})
+
+	top, err := handlers.QueryTopOffenders(ctx, handlers.TopByPackage, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []handlers.TopOffender{
+		{Name: "openssl", Score: 20, Findings: 2, BySeverity: map[string]int{"CRITICAL": 2}, Repos: 2},
+		{Name: "curl", Score: 5, Findings: 1, BySeverity: map[string]int{"HIGH": 1}, Repos: 1},
+	}, top)
+
+	top, err = handlers.QueryTopOffenders(ctx, handlers.TopByRepo, "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, top, 2) {
+		assert.Equal(t, "repo-b", top[0].Name)
+		assert.Equal(t, 15.0, top[0].Score)
+		assert.Equal(t, 11.0, top[1].Score)
+		assert.Zero(t, top[1].Repos)
+	}
+
+	// The endpoint ranks vulnerabilities of one repository and rejects
+	// unknown groupings
+	rr := httptest.NewRecorder()
+	handlers.TopOffendersHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/top?by=cve&repo=repo-a&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp []handlers.TopOffender
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	if assert.Len(t, resp, 1) {
+		assert.Equal(t, "CVE-2024-0001", resp[0].Name)
+	}
+	for _, target := range []string{"/stats/top?by=image", "/stats/top?limit=0"} {
+		rr = httptest.NewRecorder()
+		handlers.TopOffendersHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+	}
+}
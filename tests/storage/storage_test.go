@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestReadDatabase tests that read-only queries go to the read database
+// while writes, and reads pinned to the primary, go to the primary
+func TestReadDatabase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "primary.db") + "?_journal=WAL"
+	replica := filepath.Join(dir, "replica.db")
+
+	// Stand in for a replica with a database holding one finding
+	if !assert.NoError(t, storage.InitDB(replica, "")) {
+		return
+	}
+	err := storage.InsertVulnerability(ctx, storage.DB, 1, models.Vulnerability{
+		CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "openssl",
+		PublishedDate: time.Now(), RiskFactors: models.RiskFactors{},
+	})
+	assert.NoError(t, err)
+	storage.DB.Close()
+
+	if !assert.NoError(t, storage.InitDB(primary, "file:"+replica+"?mode=ro")) {
+		return
+	}
+	t.Cleanup(func() {
+		storage.DB.Close()
+		storage.ReadDB.Close()
+		storage.ReadDB = nil
+	})
+	assert.Same(t, storage.ReadDB, storage.Reader(ctx))
+	assert.Same(t, storage.DB, storage.Reader(storage.WithPrimary(ctx)))
+
+	filters := handlers.QueryFilters{Severity: "HIGH"}
+	vulns, err := handlers.QueryVulnerabilities(ctx, filters)
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 1)
+	vulns, err = handlers.QueryVulnerabilities(storage.WithPrimary(ctx), filters)
+	assert.NoError(t, err)
+	assert.Empty(t, vulns)
+
+	// The read-only pool refuses writes
+	_, err = storage.ReadDB.Exec("DELETE FROM vulnerabilities")
+	assert.Error(t, err)
+
+	// Opening fails when the read database does not exist
+	assert.Error(t, storage.InitDB(primary, "file:"+filepath.Join(dir, "missing.db")+"?mode=ro"))
+}
+
+// TestStatementCache tests that queries reuse prepared statements by query
+// text and that the cache stays within its size
+func TestStatementCache(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	cache := storage.NewStatementCache(2)
+	var n int
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cache.GetContext(ctx, db, &n, "SELECT ? + 1", i))
+		assert.Equal(t, i+1, n)
+	}
+	assert.Equal(t, storage.StatementCacheStats{Hits: 2, Misses: 1, Statements: 1}, cache.Stats())
+
+	// The least recently used statement is evicted and closed
+	var rows []int
+	assert.NoError(t, cache.SelectContext(ctx, db, &rows, "SELECT value FROM json_each(?)", "[1, 2, 3]"))
+	assert.Equal(t, []int{1, 2, 3}, rows)
+	assert.NoError(t, cache.GetContext(ctx, db, &n, "SELECT ? * 2", 4))
+	assert.Equal(t, 8, n)
+	assert.Equal(t, storage.StatementCacheStats{Hits: 2, Misses: 3, Statements: 2}, cache.Stats())
+	assert.NoError(t, cache.GetContext(ctx, db, &n, "SELECT ? + 1", 9))
+	assert.Equal(t, 10, n)
+	assert.Equal(t, int64(4), cache.Stats().Misses)
+
+	assert.Error(t, cache.GetContext(ctx, db, &n, "SELECT FROM"))
+	assert.Equal(t, 2, cache.Stats().Statements)
+
+	// Without a size queries run unprepared
+	cache.Resize(0)
+	assert.Equal(t, 0, cache.Stats().Statements)
+	assert.NoError(t, cache.GetContext(ctx, db, &n, "SELECT ? + 1", 1))
+	assert.Equal(t, 2, n)
+	assert.Equal(t, int64(5), cache.Stats().Misses)
+}
+
+// TestSerializedWrites tests that a write transaction waits for the
+// writer's turn instead of failing with SQLITE_BUSY, and that waiting
+// honors cancellation
+func TestSerializedWrites(t *testing.T) {
+	ctx := context.Background()
+	// Without a busy timeout an overlapping writer would fail at once
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "writes.db")+"?_journal=WAL&_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the turn with a write in progress
+	unlock, err := storage.LockWrites(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tx := db.MustBegin()
+	tx.MustExec("INSERT INTO saved_queries (name, description, filters, columns, created_at, updated_at) VALUES ('held', '', '{}', '[]', ?, ?)",
+		time.Now(), time.Now())
+
+	done := make(chan error, 1)
+	go func() {
+		q := storage.SavedQuery{Name: "waiting", Filters: `{"severity": "HIGH"}`, Columns: models.StringList{}}
+		_, err := storage.UpsertSavedQuery(ctx, db, &q)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("write did not wait for its turn: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = storage.LockWrites(waitCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, tx.Commit())
+	unlock()
+	assert.NoError(t, <-done)
+	var n int
+	assert.NoError(t, db.Get(&n, "SELECT COUNT(*) FROM saved_queries"))
+	assert.Equal(t, 2, n)
+}
@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Chinzzii/vulnscan/telemetry"
+)
+
+// setup records the spans of the global tracer provider, with the
+// propagation Init configures
+func setup(t *testing.T) *tracetest.SpanRecorder {
+	if _, err := telemetry.Init(context.Background(), "vulnscan-test"); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// serve sends a request through the middleware to a handler that starts a
+// child span, returning the span context the handler saw
+func serve(header string) trace.SpanContext {
+	var seen trace.SpanContext
+	h := telemetry.Middleware("/query", func(w http.ResponseWriter, r *http.Request) {
+		seen = trace.SpanContextFromContext(r.Context())
+		_, span := telemetry.StartSpan(r.Context(), "db.query")
+		telemetry.EndSpan(span, nil)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r := httptest.NewRequest(http.MethodPost, "/query", nil)
+	if header != "" {
+		r.Header.Set("traceparent", header)
+	}
+	h(httptest.NewRecorder(), r)
+	return seen
+}
+
+// TestMiddlewareContinuesTrace tests that a server span joins the trace of
+// a propagated traceparent header, as a child of the caller's span
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	recorder := setup(t)
+	seen := serve("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "POST /query", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Equal(t, "Internal Server Error", server.Status().Description)
+
+	// Spans of the handler are children of the server span
+	assert.Equal(t, server.SpanContext(), seen)
+	assert.Equal(t, server.SpanContext().TraceID(), child.SpanContext().TraceID())
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+}
+
+// TestMiddlewareStartsTrace tests that a request without a traceparent
+// header, or with a malformed one, gets a new root span
+func TestMiddlewareStartsTrace(t *testing.T) {
+	recorder := setup(t)
+	serve("")
+	serve("00-not-a-trace-01")
+
+	var roots []trace.TraceID
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() != trace.SpanKindServer {
+			continue
+		}
+		assert.False(t, span.Parent().IsValid())
+		assert.True(t, span.SpanContext().IsValid())
+		roots = append(roots, span.SpanContext().TraceID())
+	}
+	if assert.Len(t, roots, 2) {
+		assert.NotEqual(t, roots[0], roots[1])
+	}
+}
@@ -0,0 +1,97 @@
+package trends
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// TestQueryTrend tests daily counts replayed from scan history
+func TestQueryTrend(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	scan := func(repo, file string, at time.Time, severities ...string) {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, file, at, "s", at)
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		for i, sev := range severities {
+			v := models.Vulnerability{CVEID: "CVE-2024-000" + string(rune('1'+i)), Severity: sev,
+				PackageName: "openssl", RiskFactors: models.RiskFactors{}}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, id, v))
+		}
+	}
+
+	day1 := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	scan("repo-a", "api.json", day1.Add(9*time.Hour), "CRITICAL", "HIGH")
+	scan("repo-a", "web.json", day1.Add(10*time.Hour), "LOW")
+	scan("repo-b", "api.json", day1.Add(11*time.Hour), "medium")
+	// Day 2 has no scans; day 3 rescans api.json with the critical fixed
+	scan("repo-a", "api.json", day1.AddDate(0, 0, 2).Add(8*time.Hour), "HIGH")
+	now := day1.AddDate(0, 0, 3).Add(12 * time.Hour)
+
+	points, err := handlers.QueryTrend(ctx, "repo-a", 90, now)
+	assert.NoError(t, err)
+	if assert.Len(t, points, 4) {
+		assert.Equal(t, day1, points[0].Date)
+		assert.Equal(t, 3, points[0].Total)
+		assert.Equal(t, map[string]int{"CRITICAL": 1, "HIGH": 1, "LOW": 1}, points[0].BySeverity)
+		assert.Equal(t, points[0].BySeverity, points[1].BySeverity) // Carried forward
+		assert.Equal(t, map[string]int{"HIGH": 1, "LOW": 1}, points[2].BySeverity)
+		assert.Equal(t, 2, points[3].Total)
+	}
+
+	// All repositories, last two days only
+	points, err = handlers.QueryTrend(ctx, "", 2, now)
+	assert.NoError(t, err)
+	if assert.Len(t, points, 2) {
+		assert.Equal(t, day1.AddDate(0, 0, 2), points[0].Date)
+		assert.Equal(t, map[string]int{"HIGH": 1, "LOW": 1, "MEDIUM": 1}, points[0].BySeverity)
+	}
+
+	points, err = handlers.QueryTrend(ctx, "repo-c", 90, now)
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+
+	get := func(target string) (int, handlers.TrendResponse) {
+		rr := httptest.NewRecorder()
+		handlers.TrendsHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp handlers.TrendResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+	code, resp := get("/trends?repo=repo-b&window=30d")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "repo-b", resp.Repo)
+	assert.Equal(t, 30, resp.Days)
+	// The old scan's counts carry forward to today
+	if assert.Len(t, resp.Points, 30) {
+		assert.Equal(t, map[string]int{"MEDIUM": 1}, resp.Points[29].BySeverity)
+	}
+
+	for _, window := range []string{"0d", "400d", "3w"} {
+		code, _ = get("/trends?window=" + window)
+		assert.Equal(t, http.StatusBadRequest, code, window)
+	}
+}
@@ -0,0 +1,288 @@
+package triage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+func setup(t *testing.T) *http.ServeMux {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	err = storage.InsertVulnerability(context.Background(), db, 1, models.Vulnerability{
+		CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "openssl", CurrentVersion: "1.1.1t-r0",
+		PublishedDate: time.Now(), RiskFactors: models.RiskFactors{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vulnerabilities/{id}/triage", handlers.TriageHandler)
+	mux.HandleFunc("/vulnerabilities/{id}/comments", handlers.CommentsHandler)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, target, actor, body string) (*httptest.ResponseRecorder, handlers.TriageResponse) {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	if actor != "" {
+		req.Header.Set("X-Actor", actor)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var resp handlers.TriageResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr, resp
+}
+
+// TestTriageWorkflow tests status transitions, assignment, comments, and the audit trail
+func TestTriageWorkflow(t *testing.T) {
+	mux := setup(t)
+
+	// Query results expose the finding ID and default triage state
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH"})
+	assert.NoError(t, err)
+	if !assert.Len(t, vulns, 1) {
+		return
+	}
+	assert.Equal(t, "open", vulns[0].TriageStatus)
+	target := "/vulnerabilities/1/triage"
+
+	rr, resp := do(mux, http.MethodPatch, target, "alice",
+		`{"status": "acknowledged", "assignee": "bob", "comment": "Upgrade scheduled"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "acknowledged", resp.Status)
+	assert.Equal(t, "bob", resp.Assignee)
+	if assert.Len(t, resp.Comments, 1) {
+		assert.Equal(t, "alice", resp.Comments[0].Author)
+		assert.Equal(t, "Upgrade scheduled", resp.Comments[0].Body)
+	}
+	if assert.Len(t, resp.History, 3) {
+		assert.Equal(t, "triage_status", resp.History[0].Field)
+		assert.Equal(t, "open", resp.History[0].OldValue)
+		assert.Equal(t, "acknowledged", resp.History[0].NewValue)
+		assert.Equal(t, "alice", resp.History[0].Actor)
+		assert.Equal(t, "assignee", resp.History[1].Field)
+		assert.Equal(t, "comment", resp.History[2].Field)
+	}
+
+	rr, _ = do(mux, http.MethodPatch, target, "bob", `{"status": "resolved"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Closed findings can only be reopened
+	rr, _ = do(mux, http.MethodPatch, target, "bob", `{"status": "wont_fix"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr, _ = do(mux, http.MethodPatch, target, "bob", `{"status": "fixed"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr, resp = do(mux, http.MethodPost, "/vulnerabilities/1/comments", "", `{"body": "Verified in prod"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "anonymous", resp.Comments[1].Author)
+
+	rr, resp = do(mux, http.MethodGet, target, "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "resolved", resp.Status)
+	assert.Len(t, resp.History, 5)
+
+	vulns, err = handlers.QueryVulnerabilities(context.Background(),
+		handlers.QueryFilters{Severity: "HIGH", TriageStatus: "resolved", Assignee: "bob"})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 1)
+}
+
+// TestTriageNotFound tests requests for unknown or malformed finding IDs
+func TestTriageNotFound(t *testing.T) {
+	mux := setup(t)
+
+	rr, _ := do(mux, http.MethodPatch, "/vulnerabilities/99/triage", "", `{"status": "acknowledged"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr, _ = do(mux, http.MethodPost, "/vulnerabilities/99/comments", "", `{"body": "x"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr, _ = do(mux, http.MethodGet, "/vulnerabilities/abc/triage", "", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// TestBulkTriage tests previewing and confirming a triage update of every
+// finding matching a filter
+func TestBulkTriage(t *testing.T) {
+	mux := setup(t)
+	mux.HandleFunc("/vulnerabilities/bulk-update", handlers.BulkTriageHandler)
+	for _, pkg := range []string{"zlib", "curl", "expat"} {
+		err := storage.InsertVulnerability(context.Background(), storage.DB, 1, models.Vulnerability{
+			CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: pkg, CurrentVersion: "1.0",
+			PublishedDate: time.Now(), RiskFactors: models.RiskFactors{},
+		})
+		assert.NoError(t, err)
+	}
+	// Closed findings are skipped rather than failing the update
+	rr, _ := do(mux, http.MethodPatch, "/vulnerabilities/4/triage", "", `{"status": "resolved"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	bulk := func(body string) (int, handlers.BulkTriageResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/vulnerabilities/bulk-update", bytes.NewBufferString(body))
+		req.Header.Set("X-Actor", "alice")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var resp handlers.BulkTriageResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+	patch := `"filters": {"id": "CVE-2024-1234"}, "patch": {"status": "acknowledged", "assignee": "alice", "comment": "Base image"}`
+
+	code, resp := bulk(`{` + patch + `}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.BulkTriageResponse{Matched: 4, Updated: 3, Skipped: []int64{4}}, resp)
+	_, triage := do(mux, http.MethodGet, "/vulnerabilities/1/triage", "", "")
+	assert.Equal(t, "open", triage.Status, "a preview stores nothing")
+	assert.Empty(t, triage.History)
+
+	// A stale count applies nothing
+	code, resp = bulk(`{` + patch + `, "confirm": 3}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.False(t, resp.Applied)
+	assert.Equal(t, 4, resp.Matched)
+
+	code, resp = bulk(`{` + patch + `, "confirm": 4}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.BulkTriageResponse{Applied: true, Matched: 4, Updated: 3, Skipped: []int64{4}}, resp)
+	for _, id := range []string{"1", "2", "3"} {
+		_, triage = do(mux, http.MethodGet, "/vulnerabilities/"+id+"/triage", "", "")
+		assert.Equal(t, "acknowledged", triage.Status)
+		assert.Equal(t, "alice", triage.Assignee)
+		if assert.Len(t, triage.History, 3) {
+			assert.Equal(t, "alice", triage.History[0].Actor)
+		}
+	}
+	_, triage = do(mux, http.MethodGet, "/vulnerabilities/4/triage", "", "")
+	assert.Equal(t, "resolved", triage.Status)
+
+	// Repeating a status-only update changes nothing
+	code, resp = bulk(`{"filters": {"id": "CVE-2024-1234", "triage_status": "acknowledged"}, "patch": {"status": "acknowledged"}, "confirm": 3}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.BulkTriageResponse{Applied: true, Matched: 3, Unchanged: 3, Skipped: []int64{}}, resp)
+
+	// A finding stored while the update waits for its turn to write counts
+	// against the confirmation
+	unlock, err := storage.LockWrites(context.Background())
+	assert.NoError(t, err)
+	codes := make(chan int)
+	go func() {
+		code, _ := bulk(`{"filters": {"id": "CVE-2024-1234"}, "patch": {"assignee": "bob"}, "confirm": 4}`)
+		codes <- code
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, storage.InsertVulnerability(context.Background(), storage.DB, 1, models.Vulnerability{
+		CVEID: "CVE-2024-1234", Severity: "HIGH", PackageName: "libxml2", CurrentVersion: "1.0",
+		PublishedDate: time.Now(), RiskFactors: models.RiskFactors{},
+	}))
+	unlock()
+	assert.Equal(t, http.StatusConflict, <-codes)
+	_, triage = do(mux, http.MethodGet, "/vulnerabilities/1/triage", "", "")
+	assert.Equal(t, "alice", triage.Assignee)
+
+	for _, body := range []string{
+		`{"filters": {}, "patch": {"status": "acknowledged"}}`,
+		`{"filters": {"severity": "HIGH"}, "patch": {}}`,
+		`{"filters": {"severity": "HIGH"}, "patch": {"status": "fixed"}}`,
+	} {
+		code, _ = bulk(body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
+
+// TestFingerprintCarriesTriage tests that a finding keeps its fingerprint
+// and triage state across rescans under another report name and version,
+// and that only the same package at the same location matches
+func TestFingerprintCarriesTriage(t *testing.T) {
+	mux := setup(t)
+	ctx := context.Background()
+	rr, _ := do(mux, http.MethodPatch, "/vulnerabilities/1/triage", "alice", `{"status": "false_positive", "assignee": "bob"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	scan := func(repo, file string) int64 {
+		res, err := storage.DB.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, 's', ?)",
+			repo, file, time.Now(), time.Now())
+		assert.NoError(t, err)
+		id, _ := res.LastInsertId()
+		return id
+	}
+	vuln := models.Vulnerability{CVEID: "cve-2024-5678", Severity: "HIGH", Ecosystem: "npm", PackageName: "lodash",
+		CurrentVersion: "4.17.20", Location: "web/package-lock.json", PublishedDate: time.Now(), RiskFactors: models.RiskFactors{}}
+	assert.NoError(t, storage.InsertVulnerability(ctx, storage.DB, scan("repo-a", "trivy.json"), vuln))
+	rr, _ = do(mux, http.MethodPatch, "/vulnerabilities/2/triage", "alice", `{"status": "wont_fix", "assignee": "carol"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rescan := vuln
+	rescan.CVEID, rescan.CurrentVersion, rescan.Location = "CVE-2024-5678", "4.17.21", "./web//package-lock.json"
+	assert.NoError(t, storage.InsertVulnerability(ctx, storage.DB, scan("repo-a", "reports/grype.json"), rescan))
+	elsewhere := vuln
+	elsewhere.Location = "api/package-lock.json"
+	assert.NoError(t, storage.InsertVulnerability(ctx, storage.DB, scan("repo-a", "trivy.json"), elsewhere))
+	assert.NoError(t, storage.InsertVulnerability(ctx, storage.DB, scan("repo-b", "trivy.json"), vuln))
+
+	var got []struct {
+		ID          int64  `db:"id"`
+		Fingerprint string `db:"fingerprint"`
+		Status      string `db:"triage_status"`
+		Assignee    string `db:"assignee"`
+	}
+	assert.NoError(t, storage.DB.Select(&got, "SELECT id, fingerprint, triage_status, assignee FROM vulnerabilities ORDER BY id"))
+	if !assert.Len(t, got, 5) {
+		return
+	}
+	assert.Equal(t, storage.Fingerprint("", "repo-a", vuln), got[1].Fingerprint)
+	assert.Equal(t, got[1].Fingerprint, got[2].Fingerprint)
+	assert.Equal(t, "wont_fix", got[2].Status)
+	assert.Equal(t, "carol", got[2].Assignee)
+	for _, other := range got[3:] {
+		assert.NotEqual(t, got[1].Fingerprint, other.Fingerprint)
+		assert.Equal(t, "open", other.Status)
+	}
+
+	// The fingerprint is served with the finding and can be queried on
+	detail, err := handlers.GetVulnerabilityDetail(ctx, got[2].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, got[2].Fingerprint, detail.Vulnerability.Fingerprint)
+	assert.Equal(t, "./web//package-lock.json", detail.Vulnerability.Location)
+	vulns, err := handlers.QueryVulnerabilities(ctx, handlers.QueryFilters{Expr: `fingerprint = "` + got[1].Fingerprint + `"`})
+	assert.NoError(t, err)
+	assert.Len(t, vulns, 2)
+
+	// A resolved finding that reappears is reopened
+	_, err = storage.DB.Exec("UPDATE vulnerabilities SET triage_status = 'resolved' WHERE id = ?", got[4].ID)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.InsertVulnerability(ctx, storage.DB, scan("repo-b", "trivy.json"), vuln))
+	var status string
+	assert.NoError(t, storage.DB.Get(&status, "SELECT triage_status FROM vulnerabilities ORDER BY id DESC LIMIT 1"))
+	assert.Equal(t, "open", status)
+
+	// Fingerprints a stopped backfill left empty are filled by the next
+	// start, on an up-to-date schema
+	_, err = storage.DB.Exec("UPDATE vulnerabilities SET fingerprint = '' WHERE id IN (?, ?)", got[1].ID, got[4].ID)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(storage.DB))
+	var fingerprints []string
+	assert.NoError(t, storage.DB.Select(&fingerprints, "SELECT fingerprint FROM vulnerabilities WHERE id IN (?, ?) ORDER BY id", got[1].ID, got[4].ID))
+	assert.Equal(t, []string{got[1].Fingerprint, storage.Fingerprint("", "repo-b", vuln)}, fingerprints)
+}
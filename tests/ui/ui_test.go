@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/ui"
+)
+
+// TestAssets tests that the dashboard is served from the embedded files
+func TestAssets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle(ui.Prefix, ui.Handler())
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rr.Body.String(), `<script src="app.js"></script>`)
+
+	for path, contentType := range map[string]string{"/ui/app.js": "javascript", "/ui/style.css": "text/css"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		assert.Contains(t, rr.Header().Get("Content-Type"), contentType, path)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ui/missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestScanHistory tests the scan list backing the dashboard's history view
+func TestScanHistory(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	ctx := context.Background()
+
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i, repo := range []string{"repo-a", "repo-b", "repo-a"} {
+		res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, ?, ?, ?, ?)",
+			repo, "trivy.json", start.Add(time.Duration(i)*time.Hour), "s", start)
+		assert.NoError(t, err)
+		scanID, _ := res.LastInsertId()
+		for j := 0; j <= i; j++ {
+			v := models.Vulnerability{CVEID: "CVE-2024-000" + string(rune('1'+j)), Severity: []string{"HIGH", "LOW"}[j%2],
+				PackageName: "openssl", RiskFactors: models.RiskFactors{}}
+			assert.NoError(t, storage.InsertVulnerability(ctx, db, scanID, v))
+		}
+	}
+
+	get := func(target string) (int, []handlers.ScanSummary) {
+		rr := httptest.NewRecorder()
+		handlers.ScansHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var scans []handlers.ScanSummary
+		json.Unmarshal(rr.Body.Bytes(), &scans)
+		return rr.Code, scans
+	}
+
+	code, scans := get("/scans")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, scans, 3) {
+		assert.Equal(t, int64(3), scans[0].ID)
+		assert.Equal(t, 3, scans[0].Findings)
+		assert.Equal(t, map[string]int{"HIGH": 2, "LOW": 1}, scans[0].BySeverity)
+		assert.Equal(t, 1, scans[2].Findings)
+	}
+
+	_, scans = get("/scans?repo=repo-b")
+	if assert.Len(t, scans, 1) {
+		assert.Equal(t, "repo-b", scans[0].Repo)
+		assert.Equal(t, 2, scans[0].Findings)
+	}
+
+	_, scans = get("/scans?limit=1")
+	assert.Len(t, scans, 1)
+
+	code, _ = get("/scans?limit=zero")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	_, scans = get("/scans?repo=repo-c")
+	assert.NotNil(t, scans)
+	assert.Empty(t, scans)
+}
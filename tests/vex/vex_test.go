@@ -0,0 +1,150 @@
+package vex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+	"github.com/Chinzzii/vulnscan/vex"
+)
+
+const repo = "https://github.com/example/app"
+
+// openVEX marks one package not affected and, in the v0.0.1 string form,
+// another as affected
+const openVEX = `{
+  "@context": "https://openvex.dev/ns/v0.2.0",
+  "@id": "https://example.com/vex/1",
+  "author": "Security Team",
+  "timestamp": "2024-03-01T10:00:00Z",
+  "version": 1,
+  "statements": [
+    {
+      "vulnerability": {"name": "CVE-2023-0286"},
+      "products": [{"@id": "pkg:oci/app@sha256:abc", "subcomponents": [{"@id": "pkg:apk/alpine/openssl?arch=x86_64"}]}],
+      "status": "not_affected",
+      "justification": "vulnerable_code_not_in_execute_path"
+    },
+    {
+      "vulnerability": "CVE-2022-48174",
+      "products": ["pkg:apk/alpine/busybox@1.35.0-r29"],
+      "status": "affected",
+      "action_statement": "Upgrade busybox to 1.35.0-r31"
+    }
+  ]
+}`
+
+func setup(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	storage.DB = db
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec("INSERT INTO scans (repo, file_path, scan_time, scan_id, timestamp) VALUES (?, 'trivy.json', ?, 's1', ?)",
+		repo, time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanID, _ := res.LastInsertId()
+	for _, v := range []models.Vulnerability{
+		{CVEID: "CVE-2023-0286", PackageName: "openssl", CurrentVersion: "1.1.1t-r0", Ecosystem: "Alpine"},
+		{CVEID: "CVE-2022-48174", PackageName: "busybox", CurrentVersion: "1.35.0-r29", Ecosystem: "Alpine"},
+		{CVEID: "CVE-2023-5678", PackageName: "openssl", CurrentVersion: "1.1.1t-r0", Ecosystem: "Alpine"},
+	} {
+		v.Severity, v.PublishedDate, v.RiskFactors = "HIGH", time.Now(), models.RiskFactors{}
+		if err := storage.InsertVulnerability(context.Background(), db, scanID, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func do(t *testing.T, method, target string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.VEXHandler(rr, req)
+	return rr
+}
+
+// TestImportAndQuery tests that imported statements annotate and filter matching findings
+func TestImportAndQuery(t *testing.T) {
+	setup(t)
+
+	rr := do(t, http.MethodPost, "/vex", []byte(openVEX))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp handlers.VEXImportResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Statements)
+
+	vulns, err := handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH"})
+	assert.NoError(t, err)
+	status := map[string]string{}
+	for _, v := range vulns {
+		if v.VEX != nil {
+			status[v.CVEID] = v.VEX.Status
+		}
+	}
+	assert.Equal(t, map[string]string{"CVE-2023-0286": "not_affected", "CVE-2022-48174": "affected"}, status)
+
+	vulns, err = handlers.QueryVulnerabilities(context.Background(), handlers.QueryFilters{Severity: "HIGH", VEXStatus: "none"})
+	assert.NoError(t, err)
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-2023-5678", vulns[0].CVEID)
+	}
+}
+
+// TestImportValidation tests that invalid statements are rejected
+func TestImportValidation(t *testing.T) {
+	setup(t)
+
+	for _, body := range []string{
+		`not json`,
+		`{"statements": []}`,
+		`{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [{"vulnerability": "CVE-1", "products": ["pkg:npm/a"], "status": "not_affected"}]}`,
+		`{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [{"vulnerability": "CVE-1", "products": ["pkg:npm/a"], "status": "maybe"}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPost, "/vex", []byte(body)).Code, body)
+	}
+}
+
+// TestExport tests exporting stored statements and per-repository state
+func TestExport(t *testing.T) {
+	setup(t)
+	do(t, http.MethodPost, "/vex", []byte(openVEX))
+
+	rr := do(t, http.MethodGet, "/vex", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	doc, err := vex.Parse(rr.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, vex.Context, doc.Context)
+	assert.Len(t, doc.Statements, 2)
+
+	rr = do(t, http.MethodGet, "/vex?repo="+repo, nil)
+	doc, err = vex.Parse(rr.Body.Bytes())
+	assert.NoError(t, err)
+	got := map[string]string{}
+	for _, s := range doc.Statements {
+		got[s.Vulnerability.Name+" "+s.Products[0].ID] = s.Status
+	}
+	assert.Equal(t, map[string]string{
+		"CVE-2023-0286 pkg:apk/alpine/openssl@1.1.1t-r0":   "not_affected",
+		"CVE-2022-48174 pkg:apk/alpine/busybox@1.35.0-r29": "affected",
+		"CVE-2023-5678 pkg:apk/alpine/openssl@1.1.1t-r0":   "under_investigation",
+	}, got)
+}
@@ -0,0 +1,224 @@
+// vulnscan dashboard: a dependency-free client of the JSON API.
+"use strict";
+
+const SEVERITIES = ["CRITICAL", "HIGH", "MEDIUM", "LOW"];
+
+// api calls an endpoint and returns the decoded JSON response, throwing the
+// server's error text on failure
+async function api(method, path, body) {
+  const opts = { method, headers: {} };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const res = await fetch(path, opts);
+  if (!res.ok) {
+    throw new Error((await res.text()).trim() || res.statusText);
+  }
+  return res.json();
+}
+
+// el builds an element with text content; children are appended in order
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    e.setAttribute(k, v);
+  }
+  for (const c of children) {
+    e.append(c instanceof Node ? c : String(c ?? ""));
+  }
+  return e;
+}
+
+function showError(err) {
+  const box = document.getElementById("error");
+  box.textContent = err ? String(err.message || err) : "";
+  box.hidden = !err;
+}
+
+// run wraps an async action, surfacing errors in the banner
+function run(fn) {
+  return async (event) => {
+    if (event) event.preventDefault();
+    showError(null);
+    try {
+      await fn(event);
+    } catch (err) {
+      showError(err);
+    }
+  };
+}
+
+function severityBadge(sev) {
+  return el("span", { class: "sev " + String(sev || "").toLowerCase() }, sev || "UNKNOWN");
+}
+
+function formatTime(s) {
+  const d = new Date(s);
+  return isNaN(d) ? "" : d.toLocaleString();
+}
+
+// Dashboard
+
+async function loadStats() {
+  const repo = document.querySelector("#stats-form [name=repo]").value.trim();
+  const stats = await api("GET", "/stats" + (repo ? "?repo=" + encodeURIComponent(repo) : ""));
+  document.getElementById("stat-scans").textContent = stats.scans;
+  document.getElementById("stat-repos").textContent = stats.repos;
+  document.getElementById("stat-vulns").textContent = stats.vulnerabilities;
+  drawSeverityChart(stats.by_severity || {});
+
+  const body = document.querySelector("#sla-table tbody");
+  body.replaceChildren();
+  for (const sev of SEVERITIES) {
+    const s = (stats.sla || {})[sev];
+    if (!s) continue;
+    body.append(el("tr", {},
+      el("td", {}, severityBadge(sev)),
+      el("td", { class: "num" }, s.sla_days),
+      el("td", { class: "num" }, s.open),
+      el("td", { class: "num" }, s.overdue),
+      el("td", { class: "num" }, (s.compliance * 100).toFixed(0) + "%")));
+  }
+}
+
+// drawSeverityChart renders one bar per severity
+function drawSeverityChart(counts) {
+  const svg = document.getElementById("severity-chart");
+  const ns = "http://www.w3.org/2000/svg";
+  svg.replaceChildren();
+  const names = SEVERITIES.concat(Object.keys(counts).filter((s) => !SEVERITIES.includes(s.toUpperCase())));
+  const peak = Math.max(1, ...names.map((s) => counts[s] || 0));
+  const slot = 600 / names.length;
+  names.forEach((sev, i) => {
+    const n = counts[sev] || 0;
+    const h = (n / peak) * 130;
+    const x = i * slot + slot * 0.2;
+    const rect = document.createElementNS(ns, "rect");
+    rect.setAttribute("class", SEVERITIES.includes(sev) ? sev.toLowerCase() : "unknown");
+    rect.setAttribute("x", x);
+    rect.setAttribute("y", 140 - h);
+    rect.setAttribute("width", slot * 0.6);
+    rect.setAttribute("height", h);
+    svg.append(rect);
+    for (const [y, text] of [[136 - h, n], [158, sev || "UNKNOWN"]]) {
+      const t = document.createElementNS(ns, "text");
+      t.setAttribute("x", x + slot * 0.3);
+      t.setAttribute("y", y);
+      t.setAttribute("text-anchor", "middle");
+      t.textContent = text;
+      svg.append(t);
+    }
+  });
+}
+
+// Findings
+
+function queryRequest() {
+  const form = document.getElementById("query-form");
+  const filters = {};
+  for (const name of ["severity", "id", "purl", "triage_status", "assignee"]) {
+    const v = form.elements[name].value.trim();
+    if (v) filters[name] = v;
+  }
+  const epss = form.elements.epss_min.value;
+  if (epss !== "") filters.epss_min = Number(epss);
+  return { filters };
+}
+
+async function loadFindings() {
+  const vulns = (await api("POST", "/query", queryRequest())) || [];
+  document.getElementById("findings-count").textContent = vulns.length + " finding(s)";
+  const body = document.querySelector("#findings-table tbody");
+  body.replaceChildren();
+  for (const v of vulns) {
+    const id = v.link ? el("a", { href: v.link, target: "_blank", rel: "noopener" }, v.id) : el("span", {}, v.id);
+    const idCell = el("td", {}, id);
+    if (v.kev) idCell.append(" ", el("span", { class: "kev", title: "CISA Known Exploited Vulnerability" }, "KEV"));
+    body.append(el("tr", {},
+      el("td", {}, severityBadge(v.severity)),
+      idCell,
+      el("td", {}, v.package_name),
+      el("td", {}, v.current_version),
+      el("td", {}, v.fixed_version || "–"),
+      el("td", { class: "num" }, Number(v.cvss || 0).toFixed(1)),
+      el("td", { class: "num" }, v.epss == null ? "–" : v.epss.toFixed(3)),
+      el("td", {}, (v.triage_status || "") + (v.assignee ? " (" + v.assignee + ")" : ""))));
+  }
+}
+
+async function exportCSV() {
+  const res = await fetch("/query", {
+    method: "POST",
+    headers: { "Content-Type": "application/json", Accept: "text/csv" },
+    body: JSON.stringify(queryRequest()),
+  });
+  if (!res.ok) {
+    throw new Error((await res.text()).trim() || res.statusText);
+  }
+  const url = URL.createObjectURL(await res.blob());
+  el("a", { href: url, download: "vulnerabilities.csv" }).click();
+  URL.revokeObjectURL(url);
+}
+
+// Scan submission
+
+async function submitScan() {
+  const form = document.getElementById("scan-form");
+  const files = form.elements.files.value.split(/[\n,]/).map((f) => f.trim()).filter(Boolean);
+  const out = document.getElementById("scan-result");
+  out.replaceChildren(el("p", { class: "meta" }, "Scanning…"));
+  const image = form.elements.image.value.trim();
+  const res = await api("POST", "/scan", { repo: form.elements.repo.value.trim(), files, image });
+  out.replaceChildren();
+  for (const f of res.success || []) {
+    out.append(el("p", { class: "ok" }, "✓ " + f));
+  }
+  for (const f of res.failed || []) {
+    out.append(el("p", { class: "error" }, f.file + ": " + f.error));
+  }
+}
+
+// Scan history
+
+async function loadHistory() {
+  const repo = document.querySelector("#history-form [name=repo]").value.trim();
+  const scans = await api("GET", "/scans" + (repo ? "?repo=" + encodeURIComponent(repo) : ""));
+  const body = document.querySelector("#history-table tbody");
+  body.replaceChildren();
+  for (const s of scans) {
+    const counts = SEVERITIES.filter((sev) => s.by_severity[sev]).map((sev) => sev[0] + ":" + s.by_severity[sev]);
+    const report = "/reports/" + s.repo.replace(/^https?:\/\//, "");
+    body.append(el("tr", {},
+      el("td", {}, formatTime(s.scan_time)),
+      el("td", {}, s.repo),
+      el("td", {}, s.file_path),
+      el("td", { class: "num" }, s.findings),
+      el("td", {}, counts.join(" ")),
+      el("td", {}, el("a", { href: report, target: "_blank" }, "Report"))));
+  }
+}
+
+// Navigation: one section visible at a time, selected by the URL fragment
+
+const loaders = { dashboard: loadStats, findings: null, scan: null, history: loadHistory };
+
+function navigate() {
+  const name = location.hash.slice(1) in loaders ? location.hash.slice(1) : "dashboard";
+  for (const section of document.querySelectorAll("main section")) {
+    section.hidden = section.id !== name;
+  }
+  for (const link of document.querySelectorAll("nav a")) {
+    link.classList.toggle("active", link.getAttribute("href") === "#" + name);
+  }
+  showError(null);
+  if (loaders[name]) run(loaders[name])();
+}
+
+document.getElementById("stats-form").addEventListener("submit", run(loadStats));
+document.getElementById("query-form").addEventListener("submit", run(loadFindings));
+document.getElementById("export-csv").addEventListener("click", run(exportCSV));
+document.getElementById("scan-form").addEventListener("submit", run(submitScan));
+document.getElementById("history-form").addEventListener("submit", run(loadHistory));
+window.addEventListener("hashchange", navigate);
+navigate();
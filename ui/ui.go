@@ -0,0 +1,24 @@
+// Package ui serves the embedded single-page web dashboard
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Prefix is the URL path the dashboard is served under
+const Prefix = "/ui/"
+
+// Handler serves the dashboard's static assets under Prefix. The page talks
+// to the JSON API of the same server.
+func Handler() http.Handler {
+	root, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The embedded tree is fixed at build time
+	}
+	return http.StripPrefix(Prefix, http.FileServer(http.FS(root)))
+}
@@ -0,0 +1,148 @@
+// Package versions compares package version strings across ecosystems
+// without ecosystem-specific parsers.
+package versions
+
+import (
+	"strings"
+)
+
+// Compare orders two version strings, returning -1, 0, or 1. Versions are
+// split into runs of digits and non-digits; digit runs compare
+// numerically and other runs lexically. A leading "v" and Debian-style
+// epochs are honoured, and a "~" or pre-release suffix ("-rc1", "-beta")
+// sorts before the release it qualifies, so 1.0~rc1 < 1.0 and
+// 1.0.0-beta < 1.0.0, while distro revisions such as 1.1.1t-r0 < 1.1.1u-r0
+// still order correctly.
+func Compare(a, b string) int {
+	ea, ra := splitEpoch(a)
+	eb, rb := splitEpoch(b)
+	if c := compareRuns(ea, eb); c != 0 {
+		return c
+	}
+	return compareRuns(ra, rb)
+}
+
+// Less reports whether version a sorts before b
+func Less(a, b string) bool {
+	return Compare(a, b) < 0
+}
+
+// Max returns the highest of the given versions, ignoring empty strings
+func Max(vs ...string) string {
+	var best string
+	for _, v := range vs {
+		if v != "" && (best == "" || Compare(v, best) > 0) {
+			best = v
+		}
+	}
+	return best
+}
+
+// splitEpoch separates an "N:" epoch prefix, defaulting to "0"
+func splitEpoch(v string) (string, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, ':'); i > 0 && isDigits(v[:i]) {
+		return v[:i], v[i+1:]
+	}
+	return "0", v
+}
+
+// compareRuns walks both versions run by run
+func compareRuns(a, b string) int {
+	for a != "" || b != "" {
+		// A pre-release marker sorts before anything, including the end
+		if pa, pb := isPreRelease(a), isPreRelease(b); pa != pb {
+			if pa {
+				return -1
+			}
+			return 1
+		}
+
+		var ra, rb string
+		ra, a = nextRun(a)
+		rb, b = nextRun(b)
+		switch {
+		case ra == rb:
+			continue
+		case ra == "":
+			return -1
+		case rb == "":
+			return 1
+		}
+
+		da, db := isDigits(ra), isDigits(rb)
+		switch {
+		case da && db:
+			if c := compareNumeric(ra, rb); c != 0 {
+				return c
+			}
+		case da:
+			return 1 // 1.0.1 > 1.0.a
+		case db:
+			return -1
+		default:
+			if ra < rb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// isPreRelease reports whether the remaining version starts with "~" or
+// a "-"/"." separated pre-release label
+func isPreRelease(rest string) bool {
+	if strings.HasPrefix(rest, "~") {
+		return true
+	}
+	if len(rest) < 2 || (rest[0] != '-' && rest[0] != '.') {
+		return false
+	}
+	label := strings.ToLower(rest[1:])
+	for _, p := range []string{"alpha", "beta", "rc", "pre", "dev", "snapshot"} {
+		if strings.HasPrefix(label, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextRun returns the leading run of digits or letters, skipping separators
+func nextRun(v string) (string, string) {
+	v = strings.TrimLeft(v, ".-_+~")
+	if v == "" {
+		return "", ""
+	}
+	digit := isDigit(v[0])
+	i := 1
+	for i < len(v) && isDigit(v[i]) == digit && !isSeparator(v[i]) {
+		i++
+	}
+	return v[:i], v[i:]
+}
+
+// compareNumeric compares digit strings of any length
+func compareNumeric(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isSeparator(c byte) bool { return strings.IndexByte(".-_+~", c) >= 0 }
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,169 @@
+// Package vex reads and writes OpenVEX (https://openvex.dev) documents,
+// which state whether products are affected by vulnerabilities.
+package vex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Context is the OpenVEX specification version this package writes
+const Context = "https://openvex.dev/ns/v0.2.0"
+
+// Statuses defined by OpenVEX
+const (
+	StatusNotAffected        = "not_affected"
+	StatusAffected           = "affected"
+	StatusFixed              = "fixed"
+	StatusUnderInvestigation = "under_investigation"
+)
+
+// Justifications defined by OpenVEX for not_affected statements
+var Justifications = map[string]bool{
+	"component_not_present":                             true,
+	"vulnerable_code_not_present":                       true,
+	"vulnerable_code_not_in_execute_path":               true,
+	"vulnerable_code_cannot_be_controlled_by_adversary": true,
+	"inline_mitigations_already_exist":                  true,
+}
+
+// Document is an OpenVEX document
+type Document struct {
+	Context    string      `json:"@context"`
+	ID         string      `json:"@id"`
+	Author     string      `json:"author"`
+	Role       string      `json:"role,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Version    int         `json:"version"`
+	Tooling    string      `json:"tooling,omitempty"`
+	Statements []Statement `json:"statements"`
+}
+
+// Statement asserts the status of a vulnerability in one or more products
+type Statement struct {
+	Vulnerability   Vulnerability `json:"vulnerability"`
+	Timestamp       *time.Time    `json:"timestamp,omitempty"`
+	Products        []Product     `json:"products"`
+	Status          string        `json:"status"`
+	Justification   string        `json:"justification,omitempty"`
+	ImpactStatement string        `json:"impact_statement,omitempty"`
+	ActionStatement string        `json:"action_statement,omitempty"`
+}
+
+// Vulnerability identifies the vulnerability a statement is about
+type Vulnerability struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// UnmarshalJSON also accepts the OpenVEX v0.0.1 form, a bare string
+func (v *Vulnerability) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*v = Vulnerability{Name: name}
+		return nil
+	}
+	type plain Vulnerability
+	return json.Unmarshal(data, (*plain)(v))
+}
+
+// Product identifies software, usually by package URL. Subcomponents
+// narrow a statement to packages inside the product (e.g. an image).
+type Product struct {
+	ID            string      `json:"@id"`
+	Subcomponents []Component `json:"subcomponents,omitempty"`
+}
+
+// Component is a subcomponent of a product
+type Component struct {
+	ID string `json:"@id"`
+}
+
+// UnmarshalJSON also accepts the OpenVEX v0.0.1 form, a bare string
+func (p *Product) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*p = Product{ID: id}
+		return nil
+	}
+	type plain Product
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+// Parse decodes and validates an OpenVEX document
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenVEX document: %v", err)
+	}
+	if doc.Context == "" {
+		return nil, errors.New("invalid OpenVEX document: missing @context")
+	}
+	for i, s := range doc.Statements {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i, err)
+		}
+	}
+	return &doc, nil
+}
+
+// Validate checks the statement against the OpenVEX requirements
+func (s Statement) Validate() error {
+	if s.Vulnerability.Name == "" {
+		return errors.New("missing vulnerability name")
+	}
+	if len(s.Products) == 0 {
+		return errors.New("no products")
+	}
+	switch s.Status {
+	case StatusNotAffected:
+		if s.Justification == "" && s.ImpactStatement == "" {
+			return errors.New("not_affected requires a justification or impact_statement")
+		}
+		if s.Justification != "" && !Justifications[s.Justification] {
+			return fmt.Errorf("unknown justification %q", s.Justification)
+		}
+	case StatusAffected, StatusFixed, StatusUnderInvestigation:
+	default:
+		return fmt.Errorf("unknown status %q", s.Status)
+	}
+	return nil
+}
+
+// PackageIDs returns the identifiers a statement applies to: the
+// subcomponents of each product when listed, otherwise the product itself
+func (s Statement) PackageIDs() []string {
+	var ids []string
+	for _, p := range s.Products {
+		if len(p.Subcomponents) == 0 {
+			ids = append(ids, p.ID)
+			continue
+		}
+		for _, c := range p.Subcomponents {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// NewDocument wraps statements in a document with a content-derived ID
+func NewDocument(author string, statements []Statement) Document {
+	if statements == nil {
+		statements = []Statement{}
+	}
+	body, _ := json.Marshal(statements)
+	sum := sha256.Sum256(body)
+	return Document{
+		Context:    Context,
+		ID:         "urn:vulnscan:vex:" + hex.EncodeToString(sum[:16]),
+		Author:     author,
+		Timestamp:  time.Now().UTC(),
+		Version:    1,
+		Tooling:    "vulnscan",
+		Statements: statements,
+	}
+}
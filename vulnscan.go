@@ -0,0 +1,201 @@
+// Package vulnscan embeds the scan and query engine of the vulnscan service
+// in other Go programs, so that they can ingest reports and query findings
+// in-process instead of calling a separately run server:
+//
+//	engine, err := vulnscan.New(vulnscan.WithDSN("findings.db"))
+//	if err != nil {
+//		return err
+//	}
+//	defer engine.Close()
+//	resp, err := engine.Scan(ctx, api.ScanRequest{Repo: repo, Files: []string{"trivy.json"}})
+//
+// Its methods mirror those of the HTTP client in package client. Handler
+// serves the same operations over HTTP for programs that want to expose
+// them. The engine keeps its state in the process-wide database of package
+// storage, so a process runs one engine at a time.
+package vulnscan
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Chinzzii/vulnscan/api"
+	"github.com/Chinzzii/vulnscan/github"
+	"github.com/Chinzzii/vulnscan/handlers"
+	"github.com/Chinzzii/vulnscan/logging"
+	"github.com/Chinzzii/vulnscan/models"
+	"github.com/Chinzzii/vulnscan/storage"
+)
+
+// Fetcher retrieves report files of repositories, e.g. from a mirror or
+// the local filesystem instead of GitHub
+type Fetcher = handlers.ContentFetcher
+
+// ErrEngineOpen is returned by New while another engine of the process is
+// open
+var ErrEngineOpen = errors.New("vulnscan: an engine is already open in this process")
+
+// open guards the process-wide database the engine uses
+var open struct {
+	sync.Mutex
+	engine *Engine
+}
+
+// options configures New
+type options struct {
+	dsn     string
+	db      *sqlx.DB
+	fetcher Fetcher
+	logger  *slog.Logger
+}
+
+// Option configures an Engine
+type Option func(*options)
+
+// WithDSN stores findings in the SQLite database at dsn, opened and
+// migrated by New and closed by Close. It defaults to storage.DefaultDSN.
+func WithDSN(dsn string) Option {
+	return func(o *options) { o.dsn = dsn }
+}
+
+// WithDB stores findings in an open SQLite database, migrated by New. The
+// caller keeps ownership: Close leaves it open.
+func WithDB(db *sqlx.DB) Option {
+	return func(o *options) { o.db = db }
+}
+
+// WithFetcher retrieves report files with f instead of from GitHub's raw
+// file hosts
+func WithFetcher(f Fetcher) Option {
+	return func(o *options) { o.fetcher = f }
+}
+
+// WithLogger logs scans and queries to logger instead of slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// Engine ingests vulnerability reports and queries the stored findings
+type Engine struct {
+	scanner *handlers.Scanner
+	logger  *slog.Logger
+	ownsDB  bool // Whether Close closes the database
+}
+
+// New opens the store and returns an engine on it. It fails with
+// ErrEngineOpen while another engine of the process is open.
+func New(opts ...Option) (*Engine, error) {
+	o := options{dsn: storage.DefaultDSN, fetcher: github.DefaultFetcher}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	open.Lock()
+	defer open.Unlock()
+	if open.engine != nil {
+		return nil, ErrEngineOpen
+	}
+	e := &Engine{scanner: handlers.NewScanner(o.fetcher), logger: o.logger}
+	if o.db != nil {
+		if err := storage.Migrate(o.db); err != nil {
+			return nil, err
+		}
+		storage.DB, storage.ReadDB = o.db, nil
+	} else {
+		if err := storage.InitDB(o.dsn, ""); err != nil {
+			return nil, err
+		}
+		e.ownsDB = true
+	}
+	open.engine = e
+	return e, nil
+}
+
+// Close releases the engine, closing the database it opened
+func (e *Engine) Close() error {
+	open.Lock()
+	defer open.Unlock()
+	if open.engine != e {
+		return nil
+	}
+	open.engine = nil
+	if e.ownsDB {
+		return storage.DB.Close()
+	}
+	return nil
+}
+
+// context returns ctx carrying the engine's logger, if it has one
+func (e *Engine) context(ctx context.Context) context.Context {
+	if e.logger == nil {
+		return ctx
+	}
+	return logging.WithLogger(ctx, e.logger)
+}
+
+// Scan fetches and ingests the request's files, as POST /scan does. An
+// invalid request fails without fetching anything; failures of single
+// files are reported in the response.
+func (e *Engine) Scan(ctx context.Context, req api.ScanRequest) (*api.ScanResponse, error) {
+	resp, err := e.scanner.Scan(e.context(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Query returns the stored vulnerabilities the request's filters select
+func (e *Engine) Query(ctx context.Context, req api.QueryRequest) ([]models.Vulnerability, error) {
+	if err := handlers.ValidateQueryFilters(req.Filters); err != nil {
+		return nil, err
+	}
+	return handlers.QueryVulnerabilities(e.context(ctx), req.Filters)
+}
+
+// QueryCount returns the number of vulnerabilities the filters select
+func (e *Engine) QueryCount(ctx context.Context, filters api.QueryFilters) (int, error) {
+	if err := handlers.ValidateQueryFilters(filters); err != nil {
+		return 0, err
+	}
+	return handlers.CountVulnerabilities(e.context(ctx), filters)
+}
+
+// QueryExists reports whether the filters select any vulnerability
+func (e *Engine) QueryExists(ctx context.Context, filters api.QueryFilters) (bool, error) {
+	if err := handlers.ValidateQueryFilters(filters); err != nil {
+		return false, err
+	}
+	return handlers.VulnerabilitiesExist(e.context(ctx), filters)
+}
+
+// Stats returns aggregate counts of the stored scans and vulnerabilities
+// of repo, or of every repository when it is empty
+func (e *Engine) Stats(ctx context.Context, repo string) (*api.StatsResponse, error) {
+	stats, err := handlers.QueryStats(e.context(ctx), handlers.StatsFilter{Repo: repo})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Handler serves the engine's operations at the paths of the vulnscan API,
+// /scan, /query, /stats, and /scans, for mounting in the caller's server.
+// Authentication and repository access rules are left to the caller.
+func (e *Engine) Handler() http.Handler {
+	withLogger := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h(w, r.WithContext(e.context(r.Context())))
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /scan", withLogger(e.scanner.ServeHTTP))
+	mux.HandleFunc("POST /query", withLogger(handlers.QueryHandler))
+	mux.HandleFunc("GET /stats", withLogger(handlers.StatsHandler))
+	mux.HandleFunc("GET /scans", withLogger(handlers.ScansHandler))
+	return mux
+}